@@ -0,0 +1,68 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+// The ChaCha20 block function. See RFC 7539, section 2.3.
+
+func quarterRound(a, b, c, d uint32) (uint32, uint32, uint32, uint32) {
+	a += b
+	d ^= a
+	d = d<<16 | d>>16
+	c += d
+	b ^= c
+	b = b<<12 | b>>20
+	a += b
+	d ^= a
+	d = d<<8 | d>>24
+	c += d
+	b ^= c
+	b = b<<7 | b>>25
+	return a, b, c, d
+}
+
+// chachaBlock sets out to the ChaCha20 key stream block for the given key,
+// block counter and nonce.
+func chachaBlock(out *[64]byte, key *[8]uint32, counter uint32, nonce *[3]uint32) {
+	x := [16]uint32{
+		0x61707865, 0x3320646e, 0x79622d32, 0x6b206574,
+		key[0], key[1], key[2], key[3],
+		key[4], key[5], key[6], key[7],
+		counter, nonce[0], nonce[1], nonce[2],
+	}
+	s := x
+	for i := 0; i < 10; i++ {
+		// Column rounds.
+		s[0], s[4], s[8], s[12] = quarterRound(s[0], s[4], s[8], s[12])
+		s[1], s[5], s[9], s[13] = quarterRound(s[1], s[5], s[9], s[13])
+		s[2], s[6], s[10], s[14] = quarterRound(s[2], s[6], s[10], s[14])
+		s[3], s[7], s[11], s[15] = quarterRound(s[3], s[7], s[11], s[15])
+		// Diagonal rounds.
+		s[0], s[5], s[10], s[15] = quarterRound(s[0], s[5], s[10], s[15])
+		s[1], s[6], s[11], s[12] = quarterRound(s[1], s[6], s[11], s[12])
+		s[2], s[7], s[8], s[13] = quarterRound(s[2], s[7], s[8], s[13])
+		s[3], s[4], s[9], s[14] = quarterRound(s[3], s[4], s[9], s[14])
+	}
+	for i := range s {
+		putUint32(out[4*i:], s[i]+x[i])
+	}
+}
+
+// chachaXORKeyStream sets dst to the XOR of src and the ChaCha20 key
+// stream that starts at the given block counter. See RFC 7539, section 2.4.
+func chachaXORKeyStream(dst, src []byte, key *[8]uint32, nonce *[3]uint32, counter uint32) {
+	var block [64]byte
+	for len(src) > 0 {
+		chachaBlock(&block, key, counter, nonce)
+		counter++
+		n := len(src)
+		if n > len(block) {
+			n = len(block)
+		}
+		for i, b := range src[:n] {
+			dst[i] = b ^ block[i]
+		}
+		src, dst = src[n:], dst[n:]
+	}
+}
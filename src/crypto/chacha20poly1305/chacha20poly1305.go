@@ -0,0 +1,157 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chacha20poly1305 implements the ChaCha20-Poly1305 AEAD, as
+// defined in RFC 7539.
+//
+// ChaCha20-Poly1305 is fast in software, which makes it a better choice
+// than AES-GCM on machines without AES hardware.
+package chacha20poly1305
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+const (
+	// KeySize is the size of the key used by this AEAD, in bytes.
+	KeySize = 32
+	// NonceSize is the size of the nonce used with this AEAD, in bytes.
+	NonceSize = 12
+	// Overhead is the size of the Poly1305 authenticator added to each
+	// sealed message, in bytes.
+	Overhead = 16
+)
+
+var errOpen = errors.New("chacha20poly1305: message authentication failed")
+
+type chacha20poly1305 struct {
+	key [8]uint32
+}
+
+// New returns a ChaCha20-Poly1305 AEAD that uses the given 256-bit key.
+func New(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("chacha20poly1305: bad key length")
+	}
+	c := new(chacha20poly1305)
+	for i := range c.key {
+		c.key[i] = getUint32(key[4*i:])
+	}
+	return c, nil
+}
+
+func (c *chacha20poly1305) NonceSize() int { return NonceSize }
+func (c *chacha20poly1305) Overhead() int  { return Overhead }
+
+func (c *chacha20poly1305) Seal(dst, nonce, plaintext, data []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: incorrect nonce length given to ChaCha20-Poly1305")
+	}
+	// The 32-bit block counter starts at 1, block 0 being used for the
+	// Poly1305 key, so a message has at most 2^32-1 blocks of key stream.
+	if uint64(len(plaintext)) > (1<<38)-64 {
+		panic("chacha20poly1305: plaintext too large")
+	}
+	var n [3]uint32
+	readNonce(&n, nonce)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+Overhead)
+	chachaXORKeyStream(out, plaintext, &c.key, &n, 1)
+
+	var tag [Overhead]byte
+	c.tag(&tag, &n, out[:len(plaintext)], data)
+	copy(out[len(plaintext):], tag[:])
+
+	return ret
+}
+
+func (c *chacha20poly1305) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: incorrect nonce length given to ChaCha20-Poly1305")
+	}
+	if len(ciphertext) < Overhead || uint64(len(ciphertext)) > (1<<38)-48 {
+		return nil, errOpen
+	}
+	var n [3]uint32
+	readNonce(&n, nonce)
+
+	tag := ciphertext[len(ciphertext)-Overhead:]
+	ciphertext = ciphertext[:len(ciphertext)-Overhead]
+
+	var expectedTag [Overhead]byte
+	c.tag(&expectedTag, &n, ciphertext, data)
+	if subtle.ConstantTimeCompare(expectedTag[:], tag) != 1 {
+		return nil, errOpen
+	}
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	chachaXORKeyStream(out, ciphertext, &c.key, &n, 1)
+
+	return ret, nil
+}
+
+// tag computes the Poly1305 authenticator of the additional data and the
+// ciphertext, keyed with the first block of the ChaCha20 key stream. See
+// RFC 7539, section 2.8.
+func (c *chacha20poly1305) tag(out *[Overhead]byte, nonce *[3]uint32, ciphertext, data []byte) {
+	var block [64]byte
+	chachaBlock(&block, &c.key, 0, nonce)
+	var polyKey [32]byte
+	copy(polyKey[:], block[:32])
+
+	msg := make([]byte, 0, roundUp16(len(data))+roundUp16(len(ciphertext))+16)
+	msg = append(msg, data...)
+	msg = msg[:roundUp16(len(data))]
+	msg = append(msg, ciphertext...)
+	msg = msg[:cap(msg)-16]
+	var lengths [16]byte
+	putUint64(lengths[:], uint64(len(data)))
+	putUint64(lengths[8:], uint64(len(ciphertext)))
+	msg = append(msg, lengths[:]...)
+
+	poly1305Sum(out, msg, &polyKey)
+}
+
+func readNonce(n *[3]uint32, nonce []byte) {
+	for i := range n {
+		n[i] = getUint32(nonce[4*i:])
+	}
+}
+
+func roundUp16(n int) int {
+	return (n + 15) &^ 15
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes. If the
+// original slice has sufficient capacity then no allocation is performed.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+func getUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func putUint32(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
+func putUint64(b []byte, v uint64) {
+	putUint32(b, uint32(v))
+	putUint32(b[4:], uint32(v>>32))
+}
@@ -0,0 +1,221 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestChaChaBlock(t *testing.T) {
+	// RFC 7539, section 2.3.2.
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce, _ := hex.DecodeString("000000090000004a00000000")
+	want := "10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4ed2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e"
+
+	var k [8]uint32
+	for i := range k {
+		k[i] = getUint32(key[4*i:])
+	}
+	var n [3]uint32
+	readNonce(&n, nonce)
+	var block [64]byte
+	chachaBlock(&block, &k, 1, &n)
+	if got := hex.EncodeToString(block[:]); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// Poly1305 test vectors from RFC 7539, sections 2.5.2 and A.3. The latter
+// exercise the carries of the final reduction.
+var poly1305Tests = []struct {
+	key, msg, tag string
+}{
+	{
+		"85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b",
+		hex.EncodeToString([]byte("Cryptographic Forum Research Group")),
+		"a8061dc1305136c6c22b8baf0c0127a9",
+	},
+	{
+		"0200000000000000000000000000000000000000000000000000000000000000",
+		"ffffffffffffffffffffffffffffffff",
+		"03000000000000000000000000000000",
+	},
+	{
+		"02000000000000000000000000000000ffffffffffffffffffffffffffffffff",
+		"02000000000000000000000000000000",
+		"03000000000000000000000000000000",
+	},
+	{
+		"0100000000000000000000000000000000000000000000000000000000000000",
+		"fffffffffffffffffffffffffffffffff0ffffffffffffffffffffffffffffff11000000000000000000000000000000",
+		"05000000000000000000000000000000",
+	},
+	{
+		"0100000000000000000000000000000000000000000000000000000000000000",
+		"fffffffffffffffffffffffffffffffffbfefefefefefefefefefefefefefefe01010101010101010101010101010101",
+		"00000000000000000000000000000000",
+	},
+	{
+		"0200000000000000000000000000000000000000000000000000000000000000",
+		"fdffffffffffffffffffffffffffffff",
+		"faffffffffffffffffffffffffffffff",
+	},
+}
+
+func TestPoly1305(t *testing.T) {
+	for i, test := range poly1305Tests {
+		var key [32]byte
+		k, _ := hex.DecodeString(test.key)
+		copy(key[:], k)
+		msg, _ := hex.DecodeString(test.msg)
+
+		var tag [16]byte
+		poly1305Sum(&tag, msg, &key)
+		if got := hex.EncodeToString(tag[:]); got != test.tag {
+			t.Errorf("#%d: got %s, want %s", i, got, test.tag)
+		}
+	}
+}
+
+// The first test vector is from RFC 7539, section 2.8.2.
+var chaCha20Poly1305Tests = []struct {
+	key, nonce, plaintext, ad, result string
+}{
+	{
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"070000004041424344454647",
+		hex.EncodeToString([]byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")),
+		"50515253c0c1c2c3c4c5c6c7",
+		"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b61161ae10b594f09e26a7e902ecbd0600691",
+	},
+	{
+		"00070e151c232a31383f464d545b626970777e858c939aa1a8afb6bdc4cbd2d9",
+		"000306090c0f1215181b1e21",
+		"",
+		"",
+		"c43a50d7423c9e542079a7f472b809a6",
+	},
+	{
+		"01080f161d242b323940474e555c636a71787f868d949ba2a9b0b7bec5ccd3da",
+		"0104070a0d101316191c1f22",
+		"01",
+		"",
+		"7d81ebe46ed390a902680994fd5c299562",
+	},
+	{
+		"020910171e252c333a41484f565d646b727980878e959ca3aab1b8bfc6cdd4db",
+		"0205080b0e1114171a1d2023",
+		"010c17222d38434e59646f7a85909b",
+		"00050a0f14191e23282d32373c",
+		"f1bfdaa8c238a6ccfd8379addac8977dbd03c75a96ef27c69dc91d3ce3bd55",
+	},
+	{
+		"030a11181f262d343b424950575e656c737a81888f969da4abb2b9c0c7ced5dc",
+		"0306090c0f1215181b1e2124",
+		"010c17222d38434e59646f7a85909ba6b1bcc7d2dde8f3fe09141f2a35404b56616c77828d98a3aeb9c4cfdae5f0fb06111c27323d48535e69747f8a95a0abb6",
+		"00050a0f14191e23282d32373c41464b",
+		"aa13c827dcf04810f1221a137974c31d6eef92cc655e6def9c0d5f659c36651c046eb62341af88ca16140286450c0c95b5d30a2ce2af75af97dd3221a8b4db759534a3e91dee87a8623bf5e876f99abd",
+	},
+	{
+		"040b121920272e353c434a51585f666d747b828990979ea5acb3bac1c8cfd6dd",
+		"04070a0d101316191c1f2225",
+		"010c17222d38434e59646f7a85909ba6b1bcc7d2dde8f3fe09141f2a35404b56616c77828d98a3aeb9c4cfdae5f0fb06111c27323d48535e69747f8a95a0abb6c1ccd7e2edf8030e19242f3a45505b66717c87929da8b3bec9d4dfeaf5000b16212c37424d58636e79848f9aa5b0bbc6d1dce7f2fd08131e29343f4a55606b7681",
+		"00",
+		"7a80428c27de3dfa5ddd932ebc3bfb886fabd04d1b817b6ba80ce88708b33be02769a59652556ec4160f1891c44d8e189f7a1b8e4e1f1d7c3eba3a241f23713216f4e11e8d367e9a23567ecc9dda35a0d92fd4e79cb2672cd506f29f859484a929b52e426d5522371d383f7a0ed46702c6d062978f4c5bfca0b5a21ab14fe29db3d2ddb21145ff208dae4c84163524409f",
+	},
+}
+
+func TestChaCha20Poly1305(t *testing.T) {
+	for i, test := range chaCha20Poly1305Tests {
+		key, _ := hex.DecodeString(test.key)
+		nonce, _ := hex.DecodeString(test.nonce)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ad, _ := hex.DecodeString(test.ad)
+		aead, err := New(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ct := aead.Seal(nil, nonce, plaintext, ad)
+		if ctHex := hex.EncodeToString(ct); ctHex != test.result {
+			t.Errorf("#%d: got %s, want %s", i, ctHex, test.result)
+			continue
+		}
+
+		plaintext2, err := aead.Open(nil, nonce, ct, ad)
+		if err != nil {
+			t.Errorf("#%d: Open failed", i)
+			continue
+		}
+
+		if !bytes.Equal(plaintext, plaintext2) {
+			t.Errorf("#%d: plaintext's don't match: got %x vs %x", i, plaintext2, plaintext)
+			continue
+		}
+
+		if len(ad) > 0 {
+			ad[0] ^= 0x80
+			if _, err := aead.Open(nil, nonce, ct, ad); err == nil {
+				t.Errorf("#%d: Open was successful after altering additional data", i)
+			}
+			ad[0] ^= 0x80
+		}
+
+		nonce[0] ^= 0x80
+		if _, err := aead.Open(nil, nonce, ct, ad); err == nil {
+			t.Errorf("#%d: Open was successful after altering nonce", i)
+		}
+		nonce[0] ^= 0x80
+
+		ct[0] ^= 0x80
+		if _, err := aead.Open(nil, nonce, ct, ad); err == nil {
+			t.Errorf("#%d: Open was successful after altering ciphertext", i)
+		}
+		ct[0] ^= 0x80
+
+		if _, err := aead.Open(nil, nonce, ct[:Overhead-1], ad); err == nil {
+			t.Errorf("#%d: Open was successful with a truncated ciphertext", i)
+		}
+	}
+}
+
+func TestChaCha20Poly1305InPlace(t *testing.T) {
+	key := make([]byte, KeySize)
+	nonce := make([]byte, NonceSize)
+	aead, _ := New(key)
+
+	plaintext := []byte("the ciphertext and dst may alias exactly")
+	buf := make([]byte, len(plaintext), len(plaintext)+Overhead)
+	copy(buf, plaintext)
+
+	ct := aead.Seal(buf[:0], nonce, buf, nil)
+	if &ct[0] != &buf[0] {
+		t.Fatal("Seal allocated despite sufficient capacity")
+	}
+	pt, err := aead.Open(ct[:0], nonce, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pt, plaintext) {
+		t.Errorf("got %q, want %q", pt, plaintext)
+	}
+}
+
+func BenchmarkChaCha20Poly1305Seal1K(b *testing.B) {
+	buf := make([]byte, 1024)
+	b.SetBytes(int64(len(buf)))
+
+	var key [KeySize]byte
+	var nonce [NonceSize]byte
+	aead, _ := New(key[:])
+	var out []byte
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out = aead.Seal(out[:0], nonce[:], buf[:], nonce[:])
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+// poly1305Sum sets out to the Poly1305 authenticator of msg under the
+// one-time key. See RFC 7539, section 2.5.
+//
+// The accumulator and r are kept as five 26-bit limbs, so that products
+// fit in 64 bits and no step depends on secret values.
+func poly1305Sum(out *[16]byte, msg []byte, key *[32]byte) {
+	const mask = 1<<26 - 1
+
+	// r is clamped as it's read.
+	r0 := getUint32(key[0:]) & 0x3ffffff
+	r1 := (getUint32(key[3:]) >> 2) & 0x3ffff03
+	r2 := (getUint32(key[6:]) >> 4) & 0x3ffc0ff
+	r3 := (getUint32(key[9:]) >> 6) & 0x3f03fff
+	r4 := (getUint32(key[12:]) >> 8) & 0x00fffff
+
+	s1, s2, s3, s4 := r1*5, r2*5, r3*5, r4*5
+
+	var h0, h1, h2, h3, h4 uint32
+	var buf [16]byte
+	for len(msg) > 0 {
+		// Each block is read with a 1 byte appended above its top.
+		m := msg
+		hibit := uint32(1 << 24)
+		if len(msg) < 16 {
+			buf = [16]byte{}
+			copy(buf[:], msg)
+			buf[len(msg)] = 1
+			m = buf[:]
+			hibit = 0
+			msg = nil
+		} else {
+			msg = msg[16:]
+		}
+
+		h0 += getUint32(m[0:]) & mask
+		h1 += (getUint32(m[3:]) >> 2) & mask
+		h2 += (getUint32(m[6:]) >> 4) & mask
+		h3 += (getUint32(m[9:]) >> 6) & mask
+		h4 += (getUint32(m[12:]) >> 8) | hibit
+
+		// h *= r, modulo 2^130-5.
+		d0 := uint64(h0)*uint64(r0) + uint64(h1)*uint64(s4) + uint64(h2)*uint64(s3) + uint64(h3)*uint64(s2) + uint64(h4)*uint64(s1)
+		d1 := uint64(h0)*uint64(r1) + uint64(h1)*uint64(r0) + uint64(h2)*uint64(s4) + uint64(h3)*uint64(s3) + uint64(h4)*uint64(s2)
+		d2 := uint64(h0)*uint64(r2) + uint64(h1)*uint64(r1) + uint64(h2)*uint64(r0) + uint64(h3)*uint64(s4) + uint64(h4)*uint64(s3)
+		d3 := uint64(h0)*uint64(r3) + uint64(h1)*uint64(r2) + uint64(h2)*uint64(r1) + uint64(h3)*uint64(r0) + uint64(h4)*uint64(s4)
+		d4 := uint64(h0)*uint64(r4) + uint64(h1)*uint64(r3) + uint64(h2)*uint64(r2) + uint64(h3)*uint64(r1) + uint64(h4)*uint64(r0)
+
+		// Partial reduction.
+		c := uint32(d0 >> 26)
+		h0 = uint32(d0) & mask
+		d1 += uint64(c)
+		c = uint32(d1 >> 26)
+		h1 = uint32(d1) & mask
+		d2 += uint64(c)
+		c = uint32(d2 >> 26)
+		h2 = uint32(d2) & mask
+		d3 += uint64(c)
+		c = uint32(d3 >> 26)
+		h3 = uint32(d3) & mask
+		d4 += uint64(c)
+		c = uint32(d4 >> 26)
+		h4 = uint32(d4) & mask
+		h0 += c * 5
+		c = h0 >> 26
+		h0 &= mask
+		h1 += c
+	}
+
+	// Fully carry h.
+	c := h1 >> 26
+	h1 &= mask
+	h2 += c
+	c = h2 >> 26
+	h2 &= mask
+	h3 += c
+	c = h3 >> 26
+	h3 &= mask
+	h4 += c
+	c = h4 >> 26
+	h4 &= mask
+	h0 += c * 5
+	c = h0 >> 26
+	h0 &= mask
+	h1 += c
+
+	// g = h - p, which is kept if it isn't negative.
+	g0 := h0 + 5
+	c = g0 >> 26
+	g0 &= mask
+	g1 := h1 + c
+	c = g1 >> 26
+	g1 &= mask
+	g2 := h2 + c
+	c = g2 >> 26
+	g2 &= mask
+	g3 := h3 + c
+	c = g3 >> 26
+	g3 &= mask
+	g4 := h4 + c - 1<<26
+
+	selectG := (g4 >> 31) - 1
+	selectH := ^selectG
+	h0 = h0&selectH | g0&selectG
+	h1 = h1&selectH | g1&selectG
+	h2 = h2&selectH | g2&selectG
+	h3 = h3&selectH | g3&selectG
+	h4 = h4&selectH | g4&selectG
+
+	// h %= 2^128, then the tag is h + s.
+	h0 = h0 | h1<<26
+	h1 = h1>>6 | h2<<20
+	h2 = h2>>12 | h3<<14
+	h3 = h3>>18 | h4<<8
+
+	f := uint64(h0) + uint64(getUint32(key[16:]))
+	putUint32(out[0:], uint32(f))
+	f = uint64(h1) + uint64(getUint32(key[20:])) + f>>32
+	putUint32(out[4:], uint32(f))
+	f = uint64(h2) + uint64(getUint32(key[24:])) + f>>32
+	putUint32(out[8:], uint32(f))
+	f = uint64(h3) + uint64(getUint32(key[28:])) + f>>32
+	putUint32(out[12:], uint32(f))
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package curve25519 implements the X25519 Diffie-Hellman function, as
+// defined in RFC 7748.
+package curve25519
+
+import (
+	"crypto/internal/edwards25519"
+	"crypto/subtle"
+	"errors"
+)
+
+const (
+	// ScalarSize is the size of a scalar, or private key, in bytes.
+	ScalarSize = 32
+	// PointSize is the size of a point, or public key, in bytes.
+	PointSize = 32
+)
+
+// Basepoint is the canonical Curve25519 generator, u = 9.
+var Basepoint []byte
+
+var basePoint = [PointSize]byte{9}
+
+func init() { Basepoint = basePoint[:] }
+
+var errLowOrder = errors.New("curve25519: low order point")
+
+// X25519 returns the result of the scalar multiplication (scalar * point),
+// according to RFC 7748, section 5. scalar, point and the return value
+// are slices of 32 bytes.
+//
+// The scalar is clamped before it's used. If point is Basepoint, the
+// result is the public key for the private key scalar. X25519 returns an
+// error if the result is the all-zero value, which happens when point is
+// of low order.
+func X25519(scalar, point []byte) ([]byte, error) {
+	if len(scalar) != ScalarSize {
+		return nil, errors.New("curve25519: bad scalar length")
+	}
+	if len(point) != PointSize {
+		return nil, errors.New("curve25519: bad point length")
+	}
+	var k, u, out [32]byte
+	copy(k[:], scalar)
+	copy(u[:], point)
+	scalarMult(&out, &k, &u)
+
+	var zero [32]byte
+	if subtle.ConstantTimeCompare(out[:], zero[:]) == 1 {
+		return nil, errLowOrder
+	}
+	return out[:], nil
+}
+
+// scalarMult sets out to the u-coordinate of k*u, using the Montgomery
+// ladder from RFC 7748, section 5. It runs in constant time.
+func scalarMult(out, k, u *[32]byte) {
+	k[0] &= 248
+	k[31] &= 127
+	k[31] |= 64
+
+	var x1, x2, z2, x3, z3 edwards25519.FieldElement
+	var a, aa, b, bb, e, c, d, da, cb edwards25519.FieldElement
+	edwards25519.FeFromBytes(&x1, u)
+	edwards25519.FeOne(&x2)
+	edwards25519.FeZero(&z2)
+	edwards25519.FeCopy(&x3, &x1)
+	edwards25519.FeOne(&z3)
+
+	var swap int64
+	for t := 254; t >= 0; t-- {
+		bit := int64(k[t/8]>>uint(t&7)) & 1
+		swap ^= bit
+		edwards25519.FeCSwap(&x2, &x3, swap)
+		edwards25519.FeCSwap(&z2, &z3, swap)
+		swap = bit
+
+		edwards25519.FeAdd(&a, &x2, &z2)
+		edwards25519.FeSquare(&aa, &a)
+		edwards25519.FeSub(&b, &x2, &z2)
+		edwards25519.FeSquare(&bb, &b)
+		edwards25519.FeSub(&e, &aa, &bb)
+		edwards25519.FeAdd(&c, &x3, &z3)
+		edwards25519.FeSub(&d, &x3, &z3)
+		edwards25519.FeMul(&da, &d, &a)
+		edwards25519.FeMul(&cb, &c, &b)
+
+		edwards25519.FeAdd(&x3, &da, &cb)
+		edwards25519.FeSquare(&x3, &x3)
+		edwards25519.FeSub(&z3, &da, &cb)
+		edwards25519.FeSquare(&z3, &z3)
+		edwards25519.FeMul(&z3, &z3, &x1)
+		edwards25519.FeMul(&x2, &aa, &bb)
+		edwards25519.FeMulSmall(&z2, &e, 121665)
+		edwards25519.FeAdd(&z2, &z2, &aa)
+		edwards25519.FeMul(&z2, &z2, &e)
+	}
+	edwards25519.FeCSwap(&x2, &x3, swap)
+	edwards25519.FeCSwap(&z2, &z3, swap)
+
+	edwards25519.FeInvert(&z2, &z2)
+	edwards25519.FeMul(&x2, &x2, &z2)
+	edwards25519.FeToBytes(out, &x2)
+}
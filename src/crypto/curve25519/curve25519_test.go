@@ -0,0 +1,124 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curve25519
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// x25519Tests are from RFC 7748, sections 5.2 and 6.1.
+var x25519Tests = []struct {
+	scalar, point, out string
+}{
+	{
+		"a546e36bf0527c9d3b16154b82465edd62144c0ac1fc5a18506a2244ba449ac4",
+		"e6db6867583030db3594c1a424b15f7c726624ec26b3353b10a903a6d0ab1c4c",
+		"c3da55379de9c6908e94ea4df28d084f32eccf03491c71f754b4075577a28552",
+	},
+	{
+		"4b66e9d4d1b4673c5ad22691957d6af5c11b6421e0ea01d42ca4169e7918ba0d",
+		"e5210f12786811d3f4b7959d0538ae2c31dbe7106fc03c3efc4cd549c715a493",
+		"95cbde9476e8907d7aade45cb4b873f88b595a68799fa152e6f8f7647aac7957",
+	},
+	{
+		"77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a",
+		"0900000000000000000000000000000000000000000000000000000000000000",
+		"8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a",
+	},
+	{
+		"5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb",
+		"0900000000000000000000000000000000000000000000000000000000000000",
+		"de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f",
+	},
+	{
+		"77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a",
+		"de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f",
+		"4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742",
+	},
+	{
+		"5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb",
+		"8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a",
+		"4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742",
+	},
+}
+
+func TestX25519(t *testing.T) {
+	for i, test := range x25519Tests {
+		scalar := fromHex(test.scalar)
+		out, err := X25519(scalar, fromHex(test.point))
+		if err != nil {
+			t.Errorf("#%d: error: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(out, fromHex(test.out)) {
+			t.Errorf("#%d: got %x, want %s", i, out, test.out)
+		}
+		if !bytes.Equal(scalar, fromHex(test.scalar)) {
+			t.Errorf("#%d: scalar was modified", i)
+		}
+	}
+}
+
+func TestX25519Iterated(t *testing.T) {
+	// RFC 7748, section 5.2: k and u start as the base point and, at
+	// each step, k becomes X25519(k, u) and u becomes the old k.
+	k, u := Basepoint, Basepoint
+	want := map[int]string{
+		1:    "422c8e7a6227d7bca1350b3e2bb7279f7897b87bb6854b783c60e80311ae3079",
+		1000: "684cf59ba83309552800ef566f2f4d3c1c3887c49360e3875f2eb94d99532c51",
+	}
+	iterations := 1000
+	if testing.Short() {
+		iterations = 1
+	}
+	for i := 1; i <= iterations; i++ {
+		out, err := X25519(k, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, u = out, k
+		if w, ok := want[i]; ok && !bytes.Equal(k, fromHex(w)) {
+			t.Errorf("after %d iterations: got %x, want %s", i, k, w)
+		}
+	}
+}
+
+func TestX25519Errors(t *testing.T) {
+	scalar := fromHex(x25519Tests[0].scalar)
+	// Zero, the point of order 1 and one of order 8.
+	lowOrder := []string{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"0100000000000000000000000000000000000000000000000000000000000000",
+		"e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800",
+	}
+	for _, p := range lowOrder {
+		if _, err := X25519(scalar, fromHex(p)); err == nil {
+			t.Errorf("X25519 with point %s succeeded, want an error", p)
+		}
+	}
+	if _, err := X25519(scalar[:31], Basepoint); err == nil {
+		t.Errorf("X25519 with a short scalar succeeded")
+	}
+	if _, err := X25519(scalar, Basepoint[:31]); err == nil {
+		t.Errorf("X25519 with a short point succeeded")
+	}
+}
+
+func BenchmarkX25519(b *testing.B) {
+	scalar := fromHex(x25519Tests[0].scalar)
+	for i := 0; i < b.N; i++ {
+		X25519(scalar, Basepoint)
+	}
+}
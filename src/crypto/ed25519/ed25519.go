@@ -0,0 +1,198 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ed25519 implements the Ed25519 signature algorithm, as defined
+// in RFC 8032.
+//
+// Keys and signatures are plain byte slices. Private keys are the 32-byte
+// seed of RFC 8032 followed by the 32-byte public key.
+package ed25519
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/internal/edwards25519"
+	cryptorand "crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"strconv"
+)
+
+const (
+	// PublicKeySize is the size, in bytes, of public keys as used in this package.
+	PublicKeySize = 32
+	// PrivateKeySize is the size, in bytes, of private keys as used in this package.
+	PrivateKeySize = 64
+	// SignatureSize is the size, in bytes, of signatures generated and verified by this package.
+	SignatureSize = 64
+	// SeedSize is the size, in bytes, of private key seeds. These are the private key representations used by RFC 8032.
+	SeedSize = 32
+)
+
+// PublicKey is the type of Ed25519 public keys.
+type PublicKey []byte
+
+// PrivateKey is the type of Ed25519 private keys. It implements crypto.Signer.
+type PrivateKey []byte
+
+// Public returns the PublicKey corresponding to priv.
+func (priv PrivateKey) Public() crypto.PublicKey {
+	publicKey := make([]byte, PublicKeySize)
+	copy(publicKey, priv[SeedSize:])
+	return PublicKey(publicKey)
+}
+
+// Seed returns the private key seed corresponding to priv. It is provided for
+// interoperability with RFC 8032.
+func (priv PrivateKey) Seed() []byte {
+	seed := make([]byte, SeedSize)
+	copy(seed, priv[:SeedSize])
+	return seed
+}
+
+// Sign signs the given message with priv. rand is ignored, as Ed25519
+// signatures are deterministic. Ed25519 hashes the message itself, so
+// opts.HashFunc() must return zero, to show that message isn't a digest.
+func (priv PrivateKey) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, errors.New("ed25519: cannot sign hashed message")
+	}
+	return Sign(priv, message), nil
+}
+
+// GenerateKey generates a public/private key pair using entropy from rand.
+// If rand is nil, crypto/rand.Reader will be used.
+func GenerateKey(rand io.Reader) (PublicKey, PrivateKey, error) {
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+	seed := make([]byte, SeedSize)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, nil, err
+	}
+	privateKey := NewKeyFromSeed(seed)
+	publicKey := make([]byte, PublicKeySize)
+	copy(publicKey, privateKey[SeedSize:])
+	return publicKey, privateKey, nil
+}
+
+// NewKeyFromSeed calculates a private key from a seed. It will panic if
+// len(seed) is not SeedSize. This function is provided for interoperability
+// with RFC 8032.
+func NewKeyFromSeed(seed []byte) PrivateKey {
+	if l := len(seed); l != SeedSize {
+		panic("ed25519: bad seed length: " + strconv.Itoa(l))
+	}
+
+	var a [32]byte
+	expandSecret(&a, nil, seed)
+	var A edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMultBase(&A, &a)
+	var publicKey [32]byte
+	A.ToBytes(&publicKey)
+
+	privateKey := make([]byte, PrivateKeySize)
+	copy(privateKey, seed)
+	copy(privateKey[SeedSize:], publicKey[:])
+	return privateKey
+}
+
+// expandSecret sets a to the clamped secret scalar derived from seed and,
+// if prefix isn't nil, sets it to the nonce prefix. See RFC 8032, section
+// 5.1.5.
+func expandSecret(a, prefix *[32]byte, seed []byte) {
+	h := sha512.Sum512(seed)
+	copy(a[:], h[:32])
+	a[0] &= 248
+	a[31] &= 63
+	a[31] |= 64
+	if prefix != nil {
+		copy(prefix[:], h[32:])
+	}
+}
+
+// Sign signs the message with privateKey and returns a signature. It will
+// panic if len(privateKey) is not PrivateKeySize.
+func Sign(privateKey PrivateKey, message []byte) []byte {
+	if l := len(privateKey); l != PrivateKeySize {
+		panic("ed25519: bad private key length: " + strconv.Itoa(l))
+	}
+
+	var a, prefix [32]byte
+	expandSecret(&a, &prefix, privateKey[:SeedSize])
+
+	var digest [64]byte
+	h := sha512.New()
+	h.Write(prefix[:])
+	h.Write(message)
+	h.Sum(digest[:0])
+	var r [32]byte
+	edwards25519.ScReduce(&r, &digest)
+
+	var R edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMultBase(&R, &r)
+	var encodedR [32]byte
+	R.ToBytes(&encodedR)
+
+	h.Reset()
+	h.Write(encodedR[:])
+	h.Write(privateKey[SeedSize:])
+	h.Write(message)
+	h.Sum(digest[:0])
+	var k [32]byte
+	edwards25519.ScReduce(&k, &digest)
+
+	var s [32]byte
+	edwards25519.ScMulAdd(&s, &k, &a, &r)
+
+	signature := make([]byte, SignatureSize)
+	copy(signature, encodedR[:])
+	copy(signature[32:], s[:])
+	return signature
+}
+
+// Verify reports whether sig is a valid signature of message by publicKey. It
+// will panic if len(publicKey) is not PublicKeySize.
+func Verify(publicKey PublicKey, message, sig []byte) bool {
+	if l := len(publicKey); l != PublicKeySize {
+		panic("ed25519: bad public key length: " + strconv.Itoa(l))
+	}
+	if len(sig) != SignatureSize {
+		return false
+	}
+
+	var s [32]byte
+	copy(s[:], sig[32:])
+	if !edwards25519.ScMinimal(&s) {
+		return false
+	}
+
+	var encodedA [32]byte
+	copy(encodedA[:], publicKey)
+	var A edwards25519.ExtendedGroupElement
+	if !A.FromBytes(&encodedA) {
+		return false
+	}
+
+	var digest [64]byte
+	h := sha512.New()
+	h.Write(sig[:32])
+	h.Write(publicKey)
+	h.Write(message)
+	h.Sum(digest[:0])
+	var k [32]byte
+	edwards25519.ScReduce(&k, &digest)
+
+	// R = [s]B - [k]A.
+	var sB, kA, R edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMultBase(&sB, &s)
+	edwards25519.GeNeg(&A, &A)
+	edwards25519.GeScalarMult(&kA, &k, &A)
+	edwards25519.GeAdd(&R, &sB, &kA)
+
+	var checkR [32]byte
+	R.ToBytes(&checkR)
+	return bytes.Equal(sig[:32], checkR[:])
+}
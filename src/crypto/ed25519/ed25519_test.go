@@ -0,0 +1,148 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ed25519
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// signTests are from RFC 8032, section 7.1.
+var signTests = []struct {
+	seed, public, message, signature string
+}{
+	{
+		"9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		"d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		"",
+		"e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b",
+	},
+	{
+		"4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+		"3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		"72",
+		"92a009a9f0d4cab8720e820b5f642540a2b27b5416503f8fb3762223ebdb69da085ac1e43e15996e458f3613d0f11d8c387b2eaeb4302aeeb00d291612bb0c00",
+	},
+	{
+		"c5aa8df43f9f837bedb7442f31dcb7b166d38535076f094b85ce3a2e0b4458f7",
+		"fc51cd8e6218a1a38da47ed00230f0580816ed13ba3303ac5deb911548908025",
+		"af82",
+		"6291d657deec24024827e69c3abe01a30ce548a284743a445e3680d7db5ac3ac18ff9b538d16f290ae67f760984dc6594a7c15e9716ed28dc027beceea1ec40a",
+	},
+	{
+		"833fe62409237b9d62ec77587520911e9a759cec1d19755b7da901b96dca3d42",
+		"ec172b93ad5e563bf4932c70e1245034c35467ef2efd4d64ebf819683467e2bf",
+		"ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+		"dc2a4459e7369633a52b1bf277839a00201009a3efbf3ecb69bea2186c26b58909351fc9ac90b3ecfdfbc7c66431e0303dca179c138ac17ad9bef1177331a704",
+	},
+}
+
+func TestSignVerify(t *testing.T) {
+	for i, test := range signTests {
+		priv := NewKeyFromSeed(fromHex(test.seed))
+		pub := priv.Public().(PublicKey)
+		if !bytes.Equal(pub, fromHex(test.public)) {
+			t.Errorf("#%d: public key %x, want %s", i, pub, test.public)
+		}
+		if !bytes.Equal(priv.Seed(), fromHex(test.seed)) {
+			t.Errorf("#%d: seed %x, want %s", i, priv.Seed(), test.seed)
+		}
+
+		message := fromHex(test.message)
+		sig := Sign(priv, message)
+		if !bytes.Equal(sig, fromHex(test.signature)) {
+			t.Errorf("#%d: signature %x, want %s", i, sig, test.signature)
+		}
+		if !Verify(pub, message, sig) {
+			t.Errorf("#%d: valid signature rejected", i)
+		}
+
+		wrongMessage := append([]byte{'x'}, message...)
+		if Verify(pub, wrongMessage, sig) {
+			t.Errorf("#%d: signature of the wrong message accepted", i)
+		}
+		sig[10] ^= 0x80
+		if Verify(pub, message, sig) {
+			t.Errorf("#%d: corrupted signature accepted", i)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	pub, priv, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pub) != PublicKeySize || len(priv) != PrivateKeySize {
+		t.Fatalf("got key sizes %d and %d", len(pub), len(priv))
+	}
+	message := []byte("test message")
+	if !Verify(pub, message, Sign(priv, message)) {
+		t.Errorf("valid signature rejected")
+	}
+}
+
+func TestCryptoSigner(t *testing.T) {
+	var priv crypto.Signer = NewKeyFromSeed(fromHex(signTests[1].seed))
+	message := fromHex(signTests[1].message)
+
+	sig, err := priv.Sign(nil, message, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, fromHex(signTests[1].signature)) {
+		t.Errorf("signature %x, want %s", sig, signTests[1].signature)
+	}
+	if _, err := priv.Sign(nil, message, crypto.SHA256); err == nil {
+		t.Errorf("signing a hashed message succeeded")
+	}
+}
+
+func TestMalleability(t *testing.T) {
+	// Adding l to s gives a signature that passes the group equation but
+	// isn't in the canonical range, so it must be rejected. See RFC 8032,
+	// section 5.1.7.
+	test := signTests[0]
+	sig := fromHex(test.signature)
+	order := fromHex("edd3f55c1a631258d69cf7a2def9de1400000000000000000000000000000010")
+	var carry int
+	for i := range order {
+		v := int(sig[32+i]) + int(order[i]) + carry
+		sig[32+i] = byte(v)
+		carry = v >> 8
+	}
+	if Verify(fromHex(test.public), fromHex(test.message), sig) {
+		t.Errorf("non-canonical signature accepted")
+	}
+}
+
+func BenchmarkSign(b *testing.B) {
+	priv := NewKeyFromSeed(fromHex(signTests[0].seed))
+	message := []byte("Hello, world!")
+	for i := 0; i < b.N; i++ {
+		Sign(priv, message)
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	priv := NewKeyFromSeed(fromHex(signTests[0].seed))
+	pub := priv.Public().(PublicKey)
+	message := []byte("Hello, world!")
+	sig := Sign(priv, message)
+	for i := 0; i < b.N; i++ {
+		Verify(pub, message, sig)
+	}
+}
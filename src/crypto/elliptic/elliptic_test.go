@@ -368,6 +368,66 @@ func TestP256Mult(t *testing.T) {
 	}
 }
 
+// TestScalarMultGeneric checks the optimized curves against their generic
+// CurveParams implementation, including at the edges of the scalar range.
+func TestScalarMultGeneric(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve Curve
+	}{
+		{"p256", P256()},
+		{"p384", P384()},
+	}
+
+	for _, test := range tests {
+		curve := test.curve
+		params := curve.Params()
+		one := big.NewInt(1)
+		scalars := []*big.Int{
+			big.NewInt(0),
+			big.NewInt(1),
+			big.NewInt(2),
+			big.NewInt(15),
+			big.NewInt(16),
+			new(big.Int).Sub(params.N, one),
+			params.N,
+			new(big.Int).Add(params.N, one),
+			new(big.Int).Lsh(one, uint(params.BitSize)-1),
+			new(big.Int).Lsh(one, 500),
+		}
+		for i := 0; i < 8; i++ {
+			k, err := rand.Int(rand.Reader, params.N)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scalars = append(scalars, k)
+		}
+
+		px, py := params.ScalarBaseMult([]byte{0x2a})
+		for i, k := range scalars {
+			x, y := curve.ScalarBaseMult(k.Bytes())
+			x2, y2 := params.ScalarBaseMult(k.Bytes())
+			if x.Cmp(x2) != 0 || y.Cmp(y2) != 0 {
+				t.Errorf("%s: ScalarBaseMult #%d: got (%x, %x), want (%x, %x)", test.name, i, x, y, x2, y2)
+			}
+
+			x, y = curve.ScalarMult(px, py, k.Bytes())
+			x2, y2 = params.ScalarMult(px, py, k.Bytes())
+			if x.Cmp(x2) != 0 || y.Cmp(y2) != 0 {
+				t.Errorf("%s: ScalarMult #%d: got (%x, %x), want (%x, %x)", test.name, i, x, y, x2, y2)
+			}
+			if (x.Sign() != 0 || y.Sign() != 0) && !curve.IsOnCurve(x, y) {
+				t.Errorf("%s: ScalarMult #%d: result isn't on the curve", test.name, i)
+			}
+		}
+
+		x, y := curve.ScalarMult(new(big.Int), new(big.Int), []byte{1, 2, 3})
+		if x.Sign() != 0 || y.Sign() != 0 {
+			t.Errorf("%s: k∞ != ∞", test.name)
+		}
+	}
+}
+
 func TestInfinity(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -375,6 +435,7 @@ func TestInfinity(t *testing.T) {
 	}{
 		{"p224", P224()},
 		{"p256", P256()},
+		{"p384", P384()},
 	}
 
 	for _, test := range tests {
@@ -428,6 +489,41 @@ func BenchmarkBaseMultP256(b *testing.B) {
 	}
 }
 
+func BenchmarkBaseMultP384(b *testing.B) {
+	b.ResetTimer()
+	p384 := P384()
+	e := p224BaseMultTests[25]
+	k, _ := new(big.Int).SetString(e.k, 10)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		p384.ScalarBaseMult(k.Bytes())
+	}
+}
+
+func BenchmarkScalarMultP256(b *testing.B) {
+	b.ResetTimer()
+	p256 := P256()
+	e := p224BaseMultTests[25]
+	k, _ := new(big.Int).SetString(e.k, 10)
+	x, y := p256.ScalarBaseMult(k.Bytes())
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		p256.ScalarMult(x, y, k.Bytes())
+	}
+}
+
+func BenchmarkScalarMultP384(b *testing.B) {
+	b.ResetTimer()
+	p384 := P384()
+	e := p224BaseMultTests[25]
+	k, _ := new(big.Int).SetString(e.k, 10)
+	x, y := p384.ScalarBaseMult(k.Bytes())
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		p384.ScalarMult(x, y, k.Bytes())
+	}
+}
+
 func TestMarshal(t *testing.T) {
 	p224 := P224()
 	_, x, y, err := GenerateKey(p224, rand.Reader)
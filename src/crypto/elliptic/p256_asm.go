@@ -0,0 +1,352 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build amd64
+
+package elliptic
+
+// This file contains a constant-time implementation of P256 for amd64. The
+// field arithmetic is in p256_asm_amd64.s, and the point arithmetic, which
+// uses the same formulas as the generic implementation in elliptic.go, is
+// here.
+
+import (
+	"math/big"
+	"sync"
+)
+
+type p256Curve struct {
+	*CurveParams
+}
+
+var (
+	p256 p256Curve
+	// p256RR is R² mod p, which takes a number into the Montgomery
+	// domain, and p256One is R mod p, which is one in that domain.
+	p256RR, p256One p256Element
+	// p256PMinus2 is the big-endian exponent that inverts a field
+	// element.
+	p256PMinus2 []byte
+)
+
+func initP256() {
+	// See FIPS 186-3, section D.2.3
+	p256.CurveParams = new(CurveParams)
+	p256.P, _ = new(big.Int).SetString("115792089210356248762697446949407573530086143415290314195533631308867097853951", 10)
+	p256.N, _ = new(big.Int).SetString("115792089210356248762697446949407573529996955224135760342422259061068512044369", 10)
+	p256.B, _ = new(big.Int).SetString("5ac635d8aa3a93e7b3ebbd55769886bc651d06b0cc53b0f63bce3c3e27d2604b", 16)
+	p256.Gx, _ = new(big.Int).SetString("6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296", 16)
+	p256.Gy, _ = new(big.Int).SetString("4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5", 16)
+	p256.BitSize = 256
+
+	r := new(big.Int).Lsh(big.NewInt(1), 256)
+	p256SetBytes(&p256One, new(big.Int).Mod(r, p256.P).Bytes())
+	p256SetBytes(&p256RR, new(big.Int).Mod(new(big.Int).Mul(r, r), p256.P).Bytes())
+	p256PMinus2 = new(big.Int).Sub(p256.P, big.NewInt(2)).Bytes()
+}
+
+func (curve p256Curve) Params() *CurveParams {
+	return curve.CurveParams
+}
+
+func (p256Curve) ScalarBaseMult(scalar []byte) (x, y *big.Int) {
+	var k [32]byte
+	p256GetScalar(&k, scalar)
+	p256BaseTableOnce.Do(p256InitBaseTable)
+
+	// Window w of the scalar selects a multiple of 16**w·G, so the result
+	// is just the sum of one entry from each table.
+	var acc, t p256Point
+	for w := range p256BaseTable {
+		b := k[len(k)-1-w/2]
+		if w%2 == 1 {
+			b >>= 4
+		}
+		p256PointSelect(&t, &p256BaseTable[w], b&15)
+		p256PointAdd(&acc, &acc, &t)
+	}
+	return p256ToAffine(&acc)
+}
+
+func (p256Curve) ScalarMult(bigX, bigY *big.Int, scalar []byte) (x, y *big.Int) {
+	var k [32]byte
+	p256GetScalar(&k, scalar)
+
+	var p p256Point
+	p256FromAffine(&p, bigX, bigY)
+	var table [16]p256Point
+	p256InitTable(&table, &p)
+
+	// Fixed four-bit windows, most significant first.
+	var acc, t p256Point
+	for _, b := range k {
+		for i := 0; i < 4; i++ {
+			p256PointDouble(&acc, &acc)
+		}
+		p256PointSelect(&t, &table, b>>4)
+		p256PointAdd(&acc, &acc, &t)
+		for i := 0; i < 4; i++ {
+			p256PointDouble(&acc, &acc)
+		}
+		p256PointSelect(&t, &table, b&15)
+		p256PointAdd(&acc, &acc, &t)
+	}
+	return p256ToAffine(&acc)
+}
+
+// p256GetScalar writes the big-endian scalar value from in to out. If the
+// scalar is equal or greater than the order of the group, it's reduced
+// modulo that order.
+func p256GetScalar(out *[32]byte, in []byte) {
+	n := new(big.Int).SetBytes(in)
+	if n.Cmp(p256.N) >= 0 {
+		n.Mod(n, p256.N)
+		in = n.Bytes()
+	}
+	copy(out[len(out)-len(in):], in)
+}
+
+// A p256Element is a field element, x·R mod p, as four 64-bit limbs, least
+// significant first. It is always fully reduced, so zero has a single
+// representation.
+type p256Element [4]uint64
+
+// p256Mul sets res = a·b·R⁻¹ mod p.
+//go:noescape
+func p256Mul(res, a, b *p256Element)
+
+// p256Add sets res = a+b mod p.
+//go:noescape
+func p256Add(res, a, b *p256Element)
+
+// p256Sub sets res = a-b mod p.
+//go:noescape
+func p256Sub(res, a, b *p256Element)
+
+// p256SetBytes sets out to the big-endian value in, which is less than p,
+// without moving it into the Montgomery domain.
+func p256SetBytes(out *p256Element, in []byte) {
+	var buf [32]byte
+	copy(buf[len(buf)-len(in):], in)
+	for i := range out {
+		var limb uint64
+		for _, b := range buf[len(buf)-8*(i+1) : len(buf)-8*i] {
+			limb = limb<<8 | uint64(b)
+		}
+		out[i] = limb
+	}
+}
+
+// p256FromBig sets out to x in the Montgomery domain.
+func p256FromBig(out *p256Element, x *big.Int) {
+	if x.Sign() < 0 || x.Cmp(p256.P) >= 0 {
+		x = new(big.Int).Mod(x, p256.P)
+	}
+	p256SetBytes(out, x.Bytes())
+	p256Mul(out, out, &p256RR)
+}
+
+// p256ToBig returns the value of in, which is in the Montgomery domain.
+func p256ToBig(in *p256Element) *big.Int {
+	var t p256Element
+	p256Mul(&t, in, &p256Element{1})
+	var buf [32]byte
+	for i, limb := range t {
+		for j := 0; j < 8; j++ {
+			buf[len(buf)-1-8*i-j] = byte(limb >> uint(8*j))
+		}
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// p256Invert sets out = in⁻¹ mod p, and out = 0 if in is zero, by raising
+// in to the power p-2.
+func p256Invert(out, in *p256Element) {
+	x := *in
+	t := p256One
+	for _, b := range p256PMinus2 {
+		for bit := 7; bit >= 0; bit-- {
+			p256Mul(&t, &t, &t)
+			if b>>uint(bit)&1 == 1 {
+				p256Mul(&t, &t, &x)
+			}
+		}
+	}
+	*out = t
+}
+
+// p256IsZero returns all ones if in is zero and zero otherwise.
+func p256IsZero(in *p256Element) uint64 {
+	x := in[0] | in[1] | in[2] | in[3]
+	return ^uint64(int64(x|-x) >> 63)
+}
+
+// A p256Point is a point in Jacobian coordinates, (x/z², y/z³). The point at
+// infinity has z = 0.
+type p256Point struct {
+	x, y, z p256Element
+}
+
+// p256FromAffine sets out to the point (x, y), where (0, 0) is the point at
+// infinity.
+func p256FromAffine(out *p256Point, x, y *big.Int) {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		*out = p256Point{}
+		return
+	}
+	p256FromBig(&out.x, x)
+	p256FromBig(&out.y, y)
+	out.z = p256One
+}
+
+// p256ToAffine returns the affine coordinates of in. The inverse of z is
+// zero for the point at infinity, which yields (0, 0).
+func p256ToAffine(in *p256Point) (x, y *big.Int) {
+	var zInv, zInv2, t p256Element
+	p256Invert(&zInv, &in.z)
+	p256Mul(&zInv2, &zInv, &zInv)
+	p256Mul(&t, &in.x, &zInv2)
+	x = p256ToBig(&t)
+	p256Mul(&zInv2, &zInv2, &zInv)
+	p256Mul(&t, &in.y, &zInv2)
+	y = p256ToBig(&t)
+	return
+}
+
+// p256PointDouble sets out = 2·in. It's the doubling of doubleJacobian, for
+// a = -3, and maps the point at infinity to itself.
+func p256PointDouble(out, in *p256Point) {
+	var delta, gamma, beta, alpha, t, u p256Element
+	p256Mul(&delta, &in.z, &in.z)
+	p256Mul(&gamma, &in.y, &in.y)
+	p256Mul(&beta, &in.x, &gamma)
+
+	// alpha = 3·(x-delta)·(x+delta)
+	p256Sub(&t, &in.x, &delta)
+	p256Add(&u, &in.x, &delta)
+	p256Mul(&alpha, &t, &u)
+	p256Add(&t, &alpha, &alpha)
+	p256Add(&alpha, &alpha, &t)
+
+	// z3 = (y+z)² - gamma - delta
+	p256Add(&t, &in.y, &in.z)
+	p256Mul(&t, &t, &t)
+	p256Sub(&t, &t, &gamma)
+	p256Sub(&out.z, &t, &delta)
+
+	// x3 = alpha² - 8·beta
+	p256Add(&beta, &beta, &beta)
+	p256Add(&beta, &beta, &beta)
+	p256Add(&u, &beta, &beta)
+	p256Mul(&t, &alpha, &alpha)
+	p256Sub(&out.x, &t, &u)
+
+	// y3 = alpha·(4·beta - x3) - 8·gamma²
+	p256Sub(&t, &beta, &out.x)
+	p256Mul(&t, &alpha, &t)
+	p256Mul(&gamma, &gamma, &gamma)
+	p256Add(&gamma, &gamma, &gamma)
+	p256Add(&gamma, &gamma, &gamma)
+	p256Add(&gamma, &gamma, &gamma)
+	p256Sub(&out.y, &t, &gamma)
+}
+
+// p256PointAdd sets out = a+b. It's the addition of addJacobian, except
+// that the case a = b isn't handled: the scalar multiplications never add
+// a point to itself. If a or b is the point at infinity, the other is
+// selected in constant time.
+func p256PointAdd(out, a, b *p256Point) {
+	var z1z1, z2z2, u1, u2, s1, s2, h, i, j, r, v, t p256Element
+	var sum p256Point
+	p256Mul(&z1z1, &a.z, &a.z)
+	p256Mul(&z2z2, &b.z, &b.z)
+	p256Mul(&u1, &a.x, &z2z2)
+	p256Mul(&u2, &b.x, &z1z1)
+	p256Mul(&s1, &a.y, &b.z)
+	p256Mul(&s1, &s1, &z2z2)
+	p256Mul(&s2, &b.y, &a.z)
+	p256Mul(&s2, &s2, &z1z1)
+
+	p256Sub(&h, &u2, &u1)
+	p256Add(&i, &h, &h)
+	p256Mul(&i, &i, &i)
+	p256Mul(&j, &h, &i)
+	p256Sub(&r, &s2, &s1)
+	p256Add(&r, &r, &r)
+	p256Mul(&v, &u1, &i)
+
+	// x3 = r² - j - 2·v
+	p256Mul(&sum.x, &r, &r)
+	p256Sub(&sum.x, &sum.x, &j)
+	p256Sub(&sum.x, &sum.x, &v)
+	p256Sub(&sum.x, &sum.x, &v)
+
+	// y3 = r·(v - x3) - 2·s1·j
+	p256Sub(&t, &v, &sum.x)
+	p256Mul(&sum.y, &r, &t)
+	p256Mul(&t, &s1, &j)
+	p256Add(&t, &t, &t)
+	p256Sub(&sum.y, &sum.y, &t)
+
+	// z3 = ((z1+z2)² - z1z1 - z2z2)·h
+	p256Add(&t, &a.z, &b.z)
+	p256Mul(&t, &t, &t)
+	p256Sub(&t, &t, &z1z1)
+	p256Sub(&t, &t, &z2z2)
+	p256Mul(&sum.z, &t, &h)
+
+	p256PointMove(&sum, b, p256IsZero(&a.z))
+	p256PointMove(&sum, a, p256IsZero(&b.z))
+	*out = sum
+}
+
+// p256PointMove sets out = in if mask is all ones, and leaves out alone if
+// mask is zero.
+func p256PointMove(out, in *p256Point, mask uint64) {
+	for i := range out.x {
+		out.x[i] ^= mask & (out.x[i] ^ in.x[i])
+		out.y[i] ^= mask & (out.y[i] ^ in.y[i])
+		out.z[i] ^= mask & (out.z[i] ^ in.z[i])
+	}
+}
+
+// p256PointSelect sets out = table[idx], reading every entry of table.
+func p256PointSelect(out *p256Point, table *[16]p256Point, idx byte) {
+	*out = p256Point{}
+	for i := range table {
+		x := uint64(byte(i) ^ idx)
+		p256PointMove(out, &table[i], uint64(int64(x-1)>>63))
+	}
+}
+
+// p256InitTable sets table[i] = i·p. The entry for zero is the point at
+// infinity.
+func p256InitTable(table *[16]p256Point, p *p256Point) {
+	table[0] = p256Point{}
+	table[1] = *p
+	for i := 2; i < len(table); i += 2 {
+		p256PointDouble(&table[i], &table[i/2])
+		p256PointAdd(&table[i+1], &table[i], p)
+	}
+}
+
+var (
+	// p256BaseTable holds, for each four-bit window w of a scalar, the
+	// multiples of 16**w·G.
+	p256BaseTable     *[64][16]p256Point
+	p256BaseTableOnce sync.Once
+)
+
+func p256InitBaseTable() {
+	table := new([64][16]p256Point)
+	var g p256Point
+	p256FromAffine(&g, p256.Gx, p256.Gy)
+	for w := range table {
+		p256InitTable(&table[w], &g)
+		for i := 0; i < 4; i++ {
+			p256PointDouble(&g, &g)
+		}
+	}
+	p256BaseTable = table
+}
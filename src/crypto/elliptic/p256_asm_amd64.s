@@ -0,0 +1,195 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains the field arithmetic of the amd64 implementation of
+// P-256. Field elements are four 64-bit limbs, least significant first, in
+// the Montgomery domain with R = 2**256, and are always fully reduced.
+// Nothing here branches on, or indexes memory with, the limbs' values.
+//
+// The prime is p = 2**256 - 2**224 + 2**192 + 2**96 - 1, so its limbs are
+// -1, 0xffffffff, 0 and 0xffffffff00000001, and -p**-1 mod 2**64 is one.
+
+#include "textflag.h"
+
+// MULROW adds a·BX, where SI points to a, to the accumulator t0..t4, whose
+// top word t4 is not yet in use.
+#define MULROW(t0, t1, t2, t3, t4) \
+	MOVQ	0(SI), AX; \
+	MULQ	BX; \
+	ADDQ	AX, t0; \
+	ADCQ	$0, DX; \
+	MOVQ	DX, CX; \
+	MOVQ	8(SI), AX; \
+	MULQ	BX; \
+	ADDQ	CX, AX; \
+	ADCQ	$0, DX; \
+	ADDQ	AX, t1; \
+	ADCQ	$0, DX; \
+	MOVQ	DX, CX; \
+	MOVQ	16(SI), AX; \
+	MULQ	BX; \
+	ADDQ	CX, AX; \
+	ADCQ	$0, DX; \
+	ADDQ	AX, t2; \
+	ADCQ	$0, DX; \
+	MOVQ	DX, CX; \
+	MOVQ	24(SI), AX; \
+	MULQ	BX; \
+	ADDQ	CX, AX; \
+	ADCQ	$0, DX; \
+	ADDQ	AX, t3; \
+	ADCQ	$0, DX; \
+	MOVQ	DX, t4
+
+// REDSTEP adds t0·p to the accumulator t0..t4, which clears t0, and leaves
+// the carry out of t4 in the carry flag. SI and DI hold the second and
+// fourth limbs of p.
+#define REDSTEP(t0, t1, t2, t3, t4) \
+	MOVQ	t0, BX; \
+	MOVQ	$-1, AX; \
+	MULQ	BX; \
+	ADDQ	AX, t0; \
+	ADCQ	$0, DX; \
+	MOVQ	DX, CX; \
+	MOVQ	SI, AX; \
+	MULQ	BX; \
+	ADDQ	CX, AX; \
+	ADCQ	$0, DX; \
+	ADDQ	AX, t1; \
+	ADCQ	$0, DX; \
+	XORQ	CX, CX; \
+	ADDQ	DX, t2; \
+	ADCQ	$0, CX; \
+	MOVQ	DI, AX; \
+	MULQ	BX; \
+	ADDQ	CX, AX; \
+	ADCQ	$0, DX; \
+	ADDQ	AX, t3; \
+	ADCQ	$0, DX; \
+	ADDQ	DX, t4
+
+// REDUCE subtracts p from the value in t0..t4 if it isn't less than p. SI
+// and DI hold the second and fourth limbs of p. AX, BX, CX and DX are
+// clobbered.
+#define REDUCE(t0, t1, t2, t3, t4) \
+	MOVQ	t0, AX; \
+	MOVQ	t1, BX; \
+	MOVQ	t2, CX; \
+	MOVQ	t3, DX; \
+	SUBQ	$-1, t0; \
+	SBBQ	SI, t1; \
+	SBBQ	$0, t2; \
+	SBBQ	DI, t3; \
+	SBBQ	$0, t4; \
+	CMOVQCS	AX, t0; \
+	CMOVQCS	BX, t1; \
+	CMOVQCS	CX, t2; \
+	CMOVQCS	DX, t3
+
+// func p256Mul(res, a, b *p256Element)
+TEXT ·p256Mul(SB),NOSPLIT,$0-24
+	MOVQ	a+8(FP), SI
+	MOVQ	b+16(FP), DI
+
+	// The 512-bit product goes in R8..R15.
+	XORQ	R8, R8
+	XORQ	R9, R9
+	XORQ	R10, R10
+	XORQ	R11, R11
+	MOVQ	0(DI), BX
+	MULROW(R8, R9, R10, R11, R12)
+	MOVQ	8(DI), BX
+	MULROW(R9, R10, R11, R12, R13)
+	MOVQ	16(DI), BX
+	MULROW(R10, R11, R12, R13, R14)
+	MOVQ	24(DI), BX
+	MULROW(R11, R12, R13, R14, R15)
+
+	// Montgomery reduction, one word at a time. The first step clears R8,
+	// which then holds the carry out of the top word. The result, in
+	// R12..R15 and R8, is less than 2p.
+	MOVQ	$0x00000000ffffffff, SI
+	MOVQ	$0xffffffff00000001, DI
+	REDSTEP(R8, R9, R10, R11, R12)
+	ADCQ	$0, R13
+	ADCQ	$0, R14
+	ADCQ	$0, R15
+	ADCQ	$0, R8
+	REDSTEP(R9, R10, R11, R12, R13)
+	ADCQ	$0, R14
+	ADCQ	$0, R15
+	ADCQ	$0, R8
+	REDSTEP(R10, R11, R12, R13, R14)
+	ADCQ	$0, R15
+	ADCQ	$0, R8
+	REDSTEP(R11, R12, R13, R14, R15)
+	ADCQ	$0, R8
+
+	REDUCE(R12, R13, R14, R15, R8)
+
+	MOVQ	res+0(FP), SI
+	MOVQ	R12, 0(SI)
+	MOVQ	R13, 8(SI)
+	MOVQ	R14, 16(SI)
+	MOVQ	R15, 24(SI)
+	RET
+
+// func p256Add(res, a, b *p256Element)
+TEXT ·p256Add(SB),NOSPLIT,$0-24
+	MOVQ	a+8(FP), SI
+	MOVQ	b+16(FP), DI
+
+	XORQ	R12, R12
+	MOVQ	0(SI), R8
+	MOVQ	8(SI), R9
+	MOVQ	16(SI), R10
+	MOVQ	24(SI), R11
+	ADDQ	0(DI), R8
+	ADCQ	8(DI), R9
+	ADCQ	16(DI), R10
+	ADCQ	24(DI), R11
+	ADCQ	$0, R12
+
+	MOVQ	$0x00000000ffffffff, SI
+	MOVQ	$0xffffffff00000001, DI
+	REDUCE(R8, R9, R10, R11, R12)
+
+	MOVQ	res+0(FP), DI
+	MOVQ	R8, 0(DI)
+	MOVQ	R9, 8(DI)
+	MOVQ	R10, 16(DI)
+	MOVQ	R11, 24(DI)
+	RET
+
+// func p256Sub(res, a, b *p256Element)
+TEXT ·p256Sub(SB),NOSPLIT,$0-24
+	MOVQ	a+8(FP), SI
+	MOVQ	b+16(FP), DI
+
+	MOVQ	0(SI), R8
+	MOVQ	8(SI), R9
+	MOVQ	16(SI), R10
+	MOVQ	24(SI), R11
+	SUBQ	0(DI), R8
+	SBBQ	8(DI), R9
+	SBBQ	16(DI), R10
+	SBBQ	24(DI), R11
+
+	// If the subtraction borrowed, R12 is all ones and p is added back.
+	SBBQ	R12, R12
+	MOVQ	$0x00000000ffffffff, BX
+	MOVQ	$0xffffffff00000001, CX
+	ANDQ	R12, BX
+	ANDQ	R12, CX
+	ADDQ	R12, R8
+	ADCQ	BX, R9
+	ADCQ	$0, R10
+	ADCQ	CX, R11
+
+	MOVQ	res+0(FP), DI
+	MOVQ	R8, 0(DI)
+	MOVQ	R9, 8(DI)
+	MOVQ	R10, 16(DI)
+	MOVQ	R11, 24(DI)
+	RET
@@ -0,0 +1,427 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elliptic
+
+// This file contains a constant-time, 32-bit implementation of P384. Field
+// elements are in the Montgomery domain and the point arithmetic uses the
+// same formulas as the generic implementation in elliptic.go.
+
+import (
+	"math/big"
+	"sync"
+)
+
+type p384Curve struct {
+	*CurveParams
+}
+
+var (
+	p384 p384Curve
+	// p384P is the prime modulus, p384RR is R² mod p, which takes a number
+	// into the Montgomery domain, and p384One is R mod p, which is one in
+	// that domain.
+	p384P, p384RR, p384One p384Element
+	// p384PMinus2 is the big-endian exponent that inverts a field
+	// element.
+	p384PMinus2 []byte
+)
+
+func initP384() {
+	// See FIPS 186-3, section D.2.4
+	p384.CurveParams = new(CurveParams)
+	p384.P, _ = new(big.Int).SetString("39402006196394479212279040100143613805079739270465446667948293404245721771496870329047266088258938001861606973112319", 10)
+	p384.N, _ = new(big.Int).SetString("39402006196394479212279040100143613805079739270465446667946905279627659399113263569398956308152294913554433653942643", 10)
+	p384.B, _ = new(big.Int).SetString("b3312fa7e23ee7e4988e056be3f82d19181d9c6efe8141120314088f5013875ac656398d8a2ed19d2a85c8edd3ec2aef", 16)
+	p384.Gx, _ = new(big.Int).SetString("aa87ca22be8b05378eb1c71ef320ad746e1d3b628ba79b9859f741e082542a385502f25dbf55296c3a545e3872760ab7", 16)
+	p384.Gy, _ = new(big.Int).SetString("3617de4a96262c6f5d9e98bf9292dc29f8f41dbd289a147ce9da3113b5f0b8c00a60b1ce1d7e819d7a431d7c90ea0e5f", 16)
+	p384.BitSize = 384
+
+	r := new(big.Int).Lsh(big.NewInt(1), 384)
+	p384SetBytes(&p384P, p384.P.Bytes())
+	p384SetBytes(&p384One, new(big.Int).Mod(r, p384.P).Bytes())
+	p384SetBytes(&p384RR, new(big.Int).Mod(new(big.Int).Mul(r, r), p384.P).Bytes())
+	p384PMinus2 = new(big.Int).Sub(p384.P, big.NewInt(2)).Bytes()
+}
+
+func (curve p384Curve) Params() *CurveParams {
+	return curve.CurveParams
+}
+
+func (p384Curve) ScalarBaseMult(scalar []byte) (x, y *big.Int) {
+	var k [48]byte
+	p384GetScalar(&k, scalar)
+	p384BaseTableOnce.Do(p384InitBaseTable)
+
+	// Window w of the scalar selects a multiple of 16**w·G, so the result
+	// is just the sum of one entry from each table.
+	var acc, t p384Point
+	for w := range p384BaseTable {
+		b := k[len(k)-1-w/2]
+		if w%2 == 1 {
+			b >>= 4
+		}
+		p384PointSelect(&t, &p384BaseTable[w], b&15)
+		p384PointAdd(&acc, &acc, &t)
+	}
+	return p384ToAffine(&acc)
+}
+
+func (p384Curve) ScalarMult(bigX, bigY *big.Int, scalar []byte) (x, y *big.Int) {
+	var k [48]byte
+	p384GetScalar(&k, scalar)
+
+	var p p384Point
+	p384FromAffine(&p, bigX, bigY)
+	var table [16]p384Point
+	p384InitTable(&table, &p)
+
+	// Fixed four-bit windows, most significant first.
+	var acc, t p384Point
+	for _, b := range k {
+		for i := 0; i < 4; i++ {
+			p384PointDouble(&acc, &acc)
+		}
+		p384PointSelect(&t, &table, b>>4)
+		p384PointAdd(&acc, &acc, &t)
+		for i := 0; i < 4; i++ {
+			p384PointDouble(&acc, &acc)
+		}
+		p384PointSelect(&t, &table, b&15)
+		p384PointAdd(&acc, &acc, &t)
+	}
+	return p384ToAffine(&acc)
+}
+
+// p384GetScalar writes the big-endian scalar value from in to out. If the
+// scalar is equal or greater than the order of the group, it's reduced
+// modulo that order.
+func p384GetScalar(out *[48]byte, in []byte) {
+	n := new(big.Int).SetBytes(in)
+	if n.Cmp(p384.N) >= 0 {
+		n.Mod(n, p384.N)
+		in = n.Bytes()
+	}
+	copy(out[len(out)-len(in):], in)
+}
+
+const p384Limbs = 12
+
+// A p384Element is a field element, x·R mod p with R = 2**384, as twelve
+// 32-bit limbs, least significant first. It is always fully reduced, so zero
+// has a single representation.
+type p384Element [p384Limbs]uint32
+
+// p384Mul sets out = a·b·R⁻¹ mod p by word-by-word Montgomery
+// multiplication.
+func p384Mul(out, a, b *p384Element) {
+	var t [p384Limbs + 2]uint32
+	for i := 0; i < p384Limbs; i++ {
+		// t += a·b[i]
+		var c uint64
+		for j := 0; j < p384Limbs; j++ {
+			v := uint64(t[j]) + uint64(a[j])*uint64(b[i]) + c
+			t[j] = uint32(v)
+			c = v >> 32
+		}
+		v := uint64(t[p384Limbs]) + c
+		t[p384Limbs] = uint32(v)
+		t[p384Limbs+1] = uint32(v >> 32)
+
+		// t = (t + m·p) / 2**32, where m is chosen to clear the bottom
+		// word. Since p ≡ -1 mod 2**32, m is simply t[0].
+		m := uint64(t[0])
+		v = uint64(t[0]) + m*uint64(p384P[0])
+		c = v >> 32
+		for j := 1; j < p384Limbs; j++ {
+			v = uint64(t[j]) + m*uint64(p384P[j]) + c
+			t[j-1] = uint32(v)
+			c = v >> 32
+		}
+		v = uint64(t[p384Limbs]) + c
+		t[p384Limbs-1] = uint32(v)
+		t[p384Limbs] = t[p384Limbs+1] + uint32(v>>32)
+	}
+
+	var lo p384Element
+	copy(lo[:], t[:p384Limbs])
+	p384Reduce(out, &lo, t[p384Limbs])
+}
+
+// p384Reduce sets out to in + carry·2**384, less p if that isn't less than
+// p. The input must be less than 2p.
+func p384Reduce(out, in *p384Element, carry uint32) {
+	var d p384Element
+	var borrow uint64
+	for i := range d {
+		v := uint64(in[i]) - uint64(p384P[i]) - borrow
+		d[i] = uint32(v)
+		borrow = (v >> 32) & 1
+	}
+	// keep is all ones if the subtraction underflowed.
+	keep := uint32((uint64(carry) - borrow) >> 32)
+	for i := range out {
+		out[i] = in[i]&keep | d[i]&^keep
+	}
+}
+
+// p384Add sets out = a+b mod p.
+func p384Add(out, a, b *p384Element) {
+	var t p384Element
+	var carry uint64
+	for i := range t {
+		v := uint64(a[i]) + uint64(b[i]) + carry
+		t[i] = uint32(v)
+		carry = v >> 32
+	}
+	p384Reduce(out, &t, uint32(carry))
+}
+
+// p384Sub sets out = a-b mod p.
+func p384Sub(out, a, b *p384Element) {
+	var t p384Element
+	var borrow uint64
+	for i := range t {
+		v := uint64(a[i]) - uint64(b[i]) - borrow
+		t[i] = uint32(v)
+		borrow = (v >> 32) & 1
+	}
+	// If the subtraction underflowed, add p back.
+	mask := uint32(-borrow)
+	var carry uint64
+	for i := range out {
+		v := uint64(t[i]) + uint64(p384P[i]&mask) + carry
+		out[i] = uint32(v)
+		carry = v >> 32
+	}
+}
+
+// p384SetBytes sets out to the big-endian value in, which is less than p,
+// without moving it into the Montgomery domain.
+func p384SetBytes(out *p384Element, in []byte) {
+	var buf [48]byte
+	copy(buf[len(buf)-len(in):], in)
+	for i := range out {
+		j := len(buf) - 4*(i+1)
+		out[i] = uint32(buf[j])<<24 | uint32(buf[j+1])<<16 | uint32(buf[j+2])<<8 | uint32(buf[j+3])
+	}
+}
+
+// p384FromBig sets out to x in the Montgomery domain.
+func p384FromBig(out *p384Element, x *big.Int) {
+	if x.Sign() < 0 || x.Cmp(p384.P) >= 0 {
+		x = new(big.Int).Mod(x, p384.P)
+	}
+	p384SetBytes(out, x.Bytes())
+	p384Mul(out, out, &p384RR)
+}
+
+// p384ToBig returns the value of in, which is in the Montgomery domain.
+func p384ToBig(in *p384Element) *big.Int {
+	var t p384Element
+	p384Mul(&t, in, &p384Element{1})
+	var buf [48]byte
+	for i, limb := range t {
+		j := len(buf) - 4*(i+1)
+		buf[j] = byte(limb >> 24)
+		buf[j+1] = byte(limb >> 16)
+		buf[j+2] = byte(limb >> 8)
+		buf[j+3] = byte(limb)
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// p384Invert sets out = in⁻¹ mod p, and out = 0 if in is zero, by raising
+// in to the power p-2.
+func p384Invert(out, in *p384Element) {
+	x := *in
+	t := p384One
+	for _, b := range p384PMinus2 {
+		for bit := 7; bit >= 0; bit-- {
+			p384Mul(&t, &t, &t)
+			if b>>uint(bit)&1 == 1 {
+				p384Mul(&t, &t, &x)
+			}
+		}
+	}
+	*out = t
+}
+
+// p384IsZero returns all ones if in is zero and zero otherwise.
+func p384IsZero(in *p384Element) uint32 {
+	var x uint32
+	for _, limb := range in {
+		x |= limb
+	}
+	return ^uint32(int32(x|-x) >> 31)
+}
+
+// A p384Point is a point in Jacobian coordinates, (x/z², y/z³). The point at
+// infinity has z = 0.
+type p384Point struct {
+	x, y, z p384Element
+}
+
+// p384FromAffine sets out to the point (x, y), where (0, 0) is the point at
+// infinity.
+func p384FromAffine(out *p384Point, x, y *big.Int) {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		*out = p384Point{}
+		return
+	}
+	p384FromBig(&out.x, x)
+	p384FromBig(&out.y, y)
+	out.z = p384One
+}
+
+// p384ToAffine returns the affine coordinates of in. The inverse of z is
+// zero for the point at infinity, which yields (0, 0).
+func p384ToAffine(in *p384Point) (x, y *big.Int) {
+	var zInv, zInv2, t p384Element
+	p384Invert(&zInv, &in.z)
+	p384Mul(&zInv2, &zInv, &zInv)
+	p384Mul(&t, &in.x, &zInv2)
+	x = p384ToBig(&t)
+	p384Mul(&zInv2, &zInv2, &zInv)
+	p384Mul(&t, &in.y, &zInv2)
+	y = p384ToBig(&t)
+	return
+}
+
+// p384PointDouble sets out = 2·in. It's the doubling of doubleJacobian, for
+// a = -3, and maps the point at infinity to itself.
+func p384PointDouble(out, in *p384Point) {
+	var delta, gamma, beta, alpha, t, u p384Element
+	p384Mul(&delta, &in.z, &in.z)
+	p384Mul(&gamma, &in.y, &in.y)
+	p384Mul(&beta, &in.x, &gamma)
+
+	// alpha = 3·(x-delta)·(x+delta)
+	p384Sub(&t, &in.x, &delta)
+	p384Add(&u, &in.x, &delta)
+	p384Mul(&alpha, &t, &u)
+	p384Add(&t, &alpha, &alpha)
+	p384Add(&alpha, &alpha, &t)
+
+	// z3 = (y+z)² - gamma - delta
+	p384Add(&t, &in.y, &in.z)
+	p384Mul(&t, &t, &t)
+	p384Sub(&t, &t, &gamma)
+	p384Sub(&out.z, &t, &delta)
+
+	// x3 = alpha² - 8·beta
+	p384Add(&beta, &beta, &beta)
+	p384Add(&beta, &beta, &beta)
+	p384Add(&u, &beta, &beta)
+	p384Mul(&t, &alpha, &alpha)
+	p384Sub(&out.x, &t, &u)
+
+	// y3 = alpha·(4·beta - x3) - 8·gamma²
+	p384Sub(&t, &beta, &out.x)
+	p384Mul(&t, &alpha, &t)
+	p384Mul(&gamma, &gamma, &gamma)
+	p384Add(&gamma, &gamma, &gamma)
+	p384Add(&gamma, &gamma, &gamma)
+	p384Add(&gamma, &gamma, &gamma)
+	p384Sub(&out.y, &t, &gamma)
+}
+
+// p384PointAdd sets out = a+b. It's the addition of addJacobian, except
+// that the case a = b isn't handled: the scalar multiplications never add
+// a point to itself. If a or b is the point at infinity, the other is
+// selected in constant time.
+func p384PointAdd(out, a, b *p384Point) {
+	var z1z1, z2z2, u1, u2, s1, s2, h, i, j, r, v, t p384Element
+	var sum p384Point
+	p384Mul(&z1z1, &a.z, &a.z)
+	p384Mul(&z2z2, &b.z, &b.z)
+	p384Mul(&u1, &a.x, &z2z2)
+	p384Mul(&u2, &b.x, &z1z1)
+	p384Mul(&s1, &a.y, &b.z)
+	p384Mul(&s1, &s1, &z2z2)
+	p384Mul(&s2, &b.y, &a.z)
+	p384Mul(&s2, &s2, &z1z1)
+
+	p384Sub(&h, &u2, &u1)
+	p384Add(&i, &h, &h)
+	p384Mul(&i, &i, &i)
+	p384Mul(&j, &h, &i)
+	p384Sub(&r, &s2, &s1)
+	p384Add(&r, &r, &r)
+	p384Mul(&v, &u1, &i)
+
+	// x3 = r² - j - 2·v
+	p384Mul(&sum.x, &r, &r)
+	p384Sub(&sum.x, &sum.x, &j)
+	p384Sub(&sum.x, &sum.x, &v)
+	p384Sub(&sum.x, &sum.x, &v)
+
+	// y3 = r·(v - x3) - 2·s1·j
+	p384Sub(&t, &v, &sum.x)
+	p384Mul(&sum.y, &r, &t)
+	p384Mul(&t, &s1, &j)
+	p384Add(&t, &t, &t)
+	p384Sub(&sum.y, &sum.y, &t)
+
+	// z3 = ((z1+z2)² - z1z1 - z2z2)·h
+	p384Add(&t, &a.z, &b.z)
+	p384Mul(&t, &t, &t)
+	p384Sub(&t, &t, &z1z1)
+	p384Sub(&t, &t, &z2z2)
+	p384Mul(&sum.z, &t, &h)
+
+	p384PointMove(&sum, b, p384IsZero(&a.z))
+	p384PointMove(&sum, a, p384IsZero(&b.z))
+	*out = sum
+}
+
+// p384PointMove sets out = in if mask is all ones, and leaves out alone if
+// mask is zero.
+func p384PointMove(out, in *p384Point, mask uint32) {
+	for i := range out.x {
+		out.x[i] ^= mask & (out.x[i] ^ in.x[i])
+		out.y[i] ^= mask & (out.y[i] ^ in.y[i])
+		out.z[i] ^= mask & (out.z[i] ^ in.z[i])
+	}
+}
+
+// p384PointSelect sets out = table[idx], reading every entry of table.
+func p384PointSelect(out *p384Point, table *[16]p384Point, idx byte) {
+	*out = p384Point{}
+	for i := range table {
+		x := uint32(byte(i) ^ idx)
+		p384PointMove(out, &table[i], uint32(int32(x-1)>>31))
+	}
+}
+
+// p384InitTable sets table[i] = i·p. The entry for zero is the point at
+// infinity.
+func p384InitTable(table *[16]p384Point, p *p384Point) {
+	table[0] = p384Point{}
+	table[1] = *p
+	for i := 2; i < len(table); i += 2 {
+		p384PointDouble(&table[i], &table[i/2])
+		p384PointAdd(&table[i+1], &table[i], p)
+	}
+}
+
+var (
+	// p384BaseTable holds, for each four-bit window w of a scalar, the
+	// multiples of 16**w·G.
+	p384BaseTable     *[96][16]p384Point
+	p384BaseTableOnce sync.Once
+)
+
+func p384InitBaseTable() {
+	table := new([96][16]p384Point)
+	var g p384Point
+	p384FromAffine(&g, p384.Gx, p384.Gy)
+	for w := range table {
+		p384InitTable(&table[w], &g)
+		for i := 0; i < 4; i++ {
+			p384PointDouble(&g, &g)
+		}
+	}
+	p384BaseTable = table
+}
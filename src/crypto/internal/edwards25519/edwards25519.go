@@ -0,0 +1,214 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edwards25519
+
+// The curve is -x^2 + y^2 = 1 + d*x^2*y^2, with d = -121665/121666. See
+// RFC 8032, section 5.1.
+
+var (
+	dBytes = [32]byte{
+		0xa3, 0x78, 0x59, 0x13, 0xca, 0x4d, 0xeb, 0x75,
+		0xab, 0xd8, 0x41, 0x41, 0x4d, 0x0a, 0x70, 0x00,
+		0x98, 0xe8, 0x79, 0x77, 0x79, 0x40, 0xc7, 0x8c,
+		0x73, 0xfe, 0x6f, 0x2b, 0xee, 0x6c, 0x03, 0x52,
+	}
+	sqrtM1Bytes = [32]byte{
+		0xb0, 0xa0, 0x0e, 0x4a, 0x27, 0x1b, 0xee, 0xc4,
+		0x78, 0xe4, 0x2f, 0xad, 0x06, 0x18, 0x43, 0x2f,
+		0xa7, 0xd7, 0xfb, 0x3d, 0x99, 0x00, 0x4d, 0x2b,
+		0x0b, 0xdf, 0xc1, 0x4f, 0x80, 0x24, 0x83, 0x2b,
+	}
+	// The base point is the one with y = 4/5 and a positive x.
+	baseBytes = [32]byte{
+		0x58, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+		0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+		0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+		0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+	}
+
+	feD, feD2, feSqrtM1 FieldElement
+	basePoint           ExtendedGroupElement
+)
+
+func init() {
+	FeFromBytes(&feD, &dBytes)
+	FeAdd(&feD2, &feD, &feD)
+	FeFromBytes(&feSqrtM1, &sqrtM1Bytes)
+	if !basePoint.FromBytes(&baseBytes) {
+		panic("edwards25519: invalid base point")
+	}
+}
+
+// An ExtendedGroupElement is a point (x, y) on the curve in extended
+// coordinates (X:Y:Z:T), where x = X/Z, y = Y/Z and x*y = T/Z. See
+// "Twisted Edwards Curves Revisited", Hisil, Wong, Carter and Dawson.
+type ExtendedGroupElement struct {
+	X, Y, Z, T FieldElement
+}
+
+// Zero sets p to the neutral element, (0, 1).
+func (p *ExtendedGroupElement) Zero() {
+	FeZero(&p.X)
+	FeOne(&p.Y)
+	FeOne(&p.Z)
+	FeZero(&p.T)
+}
+
+// ToBytes sets s to the encoding of p: the little-endian y coordinate,
+// with the sign of x in the top bit.
+func (p *ExtendedGroupElement) ToBytes(s *[32]byte) {
+	var recip, x, y FieldElement
+	FeInvert(&recip, &p.Z)
+	FeMul(&x, &p.X, &recip)
+	FeMul(&y, &p.Y, &recip)
+	FeToBytes(s, &y)
+	s[31] ^= byte(FeIsNegative(&x) << 7)
+}
+
+// FromBytes sets p to the point encoded in s, and reports whether s is a
+// valid encoding. It doesn't run in constant time.
+func (p *ExtendedGroupElement) FromBytes(s *[32]byte) bool {
+	// x^2 = u/v, where u = y^2 - 1 and v = d*y^2 + 1. The candidate
+	// root is x = u*v^3 * (u*v^7)^((p-5)/8). See RFC 8032, section 5.1.3.
+	var u, v, v3, vxx, check FieldElement
+	FeFromBytes(&p.Y, s)
+	FeOne(&p.Z)
+	FeSquare(&u, &p.Y)
+	FeMul(&v, &u, &feD)
+	FeSub(&u, &u, &p.Z)
+	FeAdd(&v, &v, &p.Z)
+
+	FeSquare(&v3, &v)
+	FeMul(&v3, &v3, &v)
+	FeSquare(&p.X, &v3)
+	FeMul(&p.X, &p.X, &v)
+	FeMul(&p.X, &p.X, &u)
+	fePow22523(&p.X, &p.X)
+	FeMul(&p.X, &p.X, &v3)
+	FeMul(&p.X, &p.X, &u)
+
+	FeSquare(&vxx, &p.X)
+	FeMul(&vxx, &vxx, &v)
+	FeSub(&check, &vxx, &u)
+	if FeIsNonZero(&check) == 1 {
+		FeAdd(&check, &vxx, &u)
+		if FeIsNonZero(&check) == 1 {
+			return false
+		}
+		FeMul(&p.X, &p.X, &feSqrtM1)
+	}
+
+	sign := int64(s[31] >> 7)
+	if FeIsNonZero(&p.X) == 0 && sign == 1 {
+		return false
+	}
+	if FeIsNegative(&p.X) != sign {
+		FeNeg(&p.X, &p.X)
+	}
+	FeMul(&p.T, &p.X, &p.Y)
+	return true
+}
+
+// GeAdd sets r = p + q. The formula is complete, so p and q may be equal
+// or the neutral element.
+func GeAdd(r, p, q *ExtendedGroupElement) {
+	// add-2008-hwcd-3, for a = -1.
+	var a, b, c, d, e, f, g, h, t FieldElement
+	FeSub(&a, &p.Y, &p.X)
+	FeSub(&t, &q.Y, &q.X)
+	FeMul(&a, &a, &t)
+	FeAdd(&b, &p.Y, &p.X)
+	FeAdd(&t, &q.Y, &q.X)
+	FeMul(&b, &b, &t)
+	FeMul(&c, &p.T, &q.T)
+	FeMul(&c, &c, &feD2)
+	FeMul(&d, &p.Z, &q.Z)
+	FeAdd(&d, &d, &d)
+	FeSub(&e, &b, &a)
+	FeSub(&f, &d, &c)
+	FeAdd(&g, &d, &c)
+	FeAdd(&h, &b, &a)
+	FeMul(&r.X, &e, &f)
+	FeMul(&r.Y, &g, &h)
+	FeMul(&r.T, &e, &h)
+	FeMul(&r.Z, &f, &g)
+}
+
+// GeDouble sets r = 2*p.
+func GeDouble(r, p *ExtendedGroupElement) {
+	// dbl-2008-hwcd, for a = -1.
+	var a, b, c, d, e, f, g, h FieldElement
+	FeSquare(&a, &p.X)
+	FeSquare(&b, &p.Y)
+	FeSquare(&c, &p.Z)
+	FeAdd(&c, &c, &c)
+	FeNeg(&d, &a)
+	FeAdd(&e, &p.X, &p.Y)
+	FeSquare(&e, &e)
+	FeSub(&e, &e, &a)
+	FeSub(&e, &e, &b)
+	FeAdd(&g, &d, &b)
+	FeSub(&f, &g, &c)
+	FeSub(&h, &d, &b)
+	FeMul(&r.X, &e, &f)
+	FeMul(&r.Y, &g, &h)
+	FeMul(&r.T, &e, &h)
+	FeMul(&r.Z, &f, &g)
+}
+
+// GeNeg sets r = -p.
+func GeNeg(r, p *ExtendedGroupElement) {
+	FeNeg(&r.X, &p.X)
+	FeCopy(&r.Y, &p.Y)
+	FeCopy(&r.Z, &p.Z)
+	FeNeg(&r.T, &p.T)
+}
+
+func geCMove(p, q *ExtendedGroupElement, b int64) {
+	FeCMove(&p.X, &q.X, b)
+	FeCMove(&p.Y, &q.Y, b)
+	FeCMove(&p.Z, &q.Z, b)
+	FeCMove(&p.T, &q.T, b)
+}
+
+// equal returns 1 if b == c and 0 otherwise, for b, c < 256.
+func equal(b, c int) int64 {
+	x := int64(b ^ c)
+	return ((x - 1) >> 63) & 1
+}
+
+// GeScalarMult sets r = a*p, where a is a little-endian, 256-bit scalar.
+// It runs in constant time.
+func GeScalarMult(r *ExtendedGroupElement, a *[32]byte, p *ExtendedGroupElement) {
+	// A fixed 4-bit window: table[i] = i*p, and each lookup reads all
+	// of the table.
+	var table [16]ExtendedGroupElement
+	table[0].Zero()
+	table[1] = *p
+	for i := 2; i < len(table); i++ {
+		GeAdd(&table[i], &table[i-1], p)
+	}
+
+	var h, t ExtendedGroupElement
+	h.Zero()
+	for i := 63; i >= 0; i-- {
+		GeDouble(&h, &h)
+		GeDouble(&h, &h)
+		GeDouble(&h, &h)
+		GeDouble(&h, &h)
+		nibble := int(a[i/2]>>(4*uint(i&1))) & 15
+		t.Zero()
+		for j := range table {
+			geCMove(&t, &table[j], equal(j, nibble))
+		}
+		GeAdd(&h, &h, &t)
+	}
+	*r = h
+}
+
+// GeScalarMultBase sets r = a*B, where B is the base point.
+func GeScalarMultBase(r *ExtendedGroupElement, a *[32]byte) {
+	GeScalarMult(r, a, &basePoint)
+}
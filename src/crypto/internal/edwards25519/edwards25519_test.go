@@ -0,0 +1,240 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edwards25519
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var (
+	bigP     = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	bigOrder = bytesToBig(orderBytes[:])
+)
+
+func bytesToBig(s []byte) *big.Int {
+	be := make([]byte, len(s))
+	for i, b := range s {
+		be[len(s)-1-i] = b
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+func bigToBytes(x *big.Int) [32]byte {
+	var s [32]byte
+	be := x.Bytes()
+	for i, b := range be {
+		s[len(be)-1-i] = b
+	}
+	return s
+}
+
+func randBytes(r *rand.Rand, s []byte) {
+	for i := range s {
+		s[i] = byte(r.Intn(256))
+	}
+}
+
+// fieldTestValues returns random field encodings, along with some that
+// aren't reduced and some near the edges.
+func fieldTestValues(r *rand.Rand) [][32]byte {
+	edges := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(19),
+		new(big.Int).Sub(bigP, big.NewInt(1)),
+		bigP,
+		new(big.Int).Add(bigP, big.NewInt(1)),
+		new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1)),
+	}
+	var values [][32]byte
+	for _, e := range edges {
+		values = append(values, bigToBytes(e))
+	}
+	for i := 0; i < 50; i++ {
+		var s [32]byte
+		randBytes(r, s[:])
+		s[31] &= 127
+		values = append(values, s)
+	}
+	return values
+}
+
+func TestFieldArithmetic(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	values := fieldTestValues(r)
+
+	check := func(op string, got *FieldElement, want *big.Int) {
+		var s [32]byte
+		FeToBytes(&s, got)
+		want.Mod(want, bigP)
+		if w := bigToBytes(want); s != w {
+			t.Fatalf("%s: got %x, want %x", op, s, w)
+		}
+	}
+
+	for i := range values {
+		a, b := values[i], values[(i+1)%len(values)]
+		var fa, fb, h FieldElement
+		FeFromBytes(&fa, &a)
+		FeFromBytes(&fb, &b)
+		ba, bb := bytesToBig(a[:]), bytesToBig(b[:])
+
+		check("FromBytes", &fa, new(big.Int).Set(ba))
+		FeAdd(&h, &fa, &fb)
+		check("Add", &h, new(big.Int).Add(ba, bb))
+		FeSub(&h, &fa, &fb)
+		check("Sub", &h, new(big.Int).Sub(ba, bb))
+		FeNeg(&h, &fa)
+		check("Neg", &h, new(big.Int).Neg(ba))
+		FeMul(&h, &fa, &fb)
+		check("Mul", &h, new(big.Int).Mul(ba, bb))
+		FeMulSmall(&h, &fa, 121666)
+		check("MulSmall", &h, new(big.Int).Mul(ba, big.NewInt(121666)))
+		FeInvert(&h, &fa)
+		check("Invert", &h, new(big.Int).Exp(ba, new(big.Int).Sub(bigP, big.NewInt(2)), bigP))
+
+		// Chains of operations without a trip through bytes.
+		FeSub(&h, &fb, &fa)
+		FeMul(&h, &h, &h)
+		FeSub(&h, &h, &fa)
+		FeMul(&h, &h, &fb)
+		d := new(big.Int).Sub(bb, ba)
+		d.Mul(d, d)
+		d.Sub(d, ba)
+		d.Mul(d, bb)
+		check("chain", &h, d)
+	}
+}
+
+func TestScalarReduce(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+
+	var inputs [][64]byte
+	var max [64]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	inputs = append(inputs, [64]byte{}, max)
+	var order [64]byte
+	copy(order[:], orderBytes[:])
+	inputs = append(inputs, order)
+	order[0]--
+	inputs = append(inputs, order)
+	order[0] += 2
+	inputs = append(inputs, order)
+	for i := 0; i < 100; i++ {
+		var s [64]byte
+		randBytes(r, s[:])
+		inputs = append(inputs, s)
+	}
+
+	for _, in := range inputs {
+		var out [32]byte
+		ScReduce(&out, &in)
+		want := bigToBytes(new(big.Int).Mod(bytesToBig(in[:]), bigOrder))
+		if out != want {
+			t.Errorf("ScReduce(%x) = %x, want %x", in, out, want)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		var a, b, c, s [32]byte
+		randBytes(r, a[:])
+		randBytes(r, b[:])
+		randBytes(r, c[:])
+		if i == 0 {
+			for j := range a {
+				a[j], b[j], c[j] = 0xff, 0xff, 0xff
+			}
+		}
+		ScMulAdd(&s, &a, &b, &c)
+		want := new(big.Int).Mul(bytesToBig(a[:]), bytesToBig(b[:]))
+		want.Add(want, bytesToBig(c[:]))
+		want.Mod(want, bigOrder)
+		if w := bigToBytes(want); s != w {
+			t.Errorf("ScMulAdd(%x, %x, %x) = %x, want %x", a, b, c, s, w)
+		}
+	}
+}
+
+func TestBasePointOrder(t *testing.T) {
+	var p ExtendedGroupElement
+	GeScalarMultBase(&p, &orderBytes)
+
+	var got, identity [32]byte
+	p.ToBytes(&got)
+	identity[0] = 1
+	if got != identity {
+		t.Errorf("l*B = %x, want the identity", got)
+	}
+}
+
+func TestGroupArithmetic(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+
+	for i := 0; i < 10; i++ {
+		var a, b [32]byte
+		randBytes(r, a[:])
+		randBytes(r, b[:])
+		a[31] &= 15
+		b[31] &= 15
+
+		// a*B + b*B = (a+b)*B, computed with the sum of the scalars
+		// reduced modulo l.
+		var pa, pb, sum, want ExtendedGroupElement
+		GeScalarMultBase(&pa, &a)
+		GeScalarMultBase(&pb, &b)
+		GeAdd(&sum, &pa, &pb)
+		var one, ab [32]byte
+		one[0] = 1
+		ScMulAdd(&ab, &a, &one, &b)
+		GeScalarMultBase(&want, &ab)
+
+		var s1, s2 [32]byte
+		sum.ToBytes(&s1)
+		want.ToBytes(&s2)
+		if s1 != s2 {
+			t.Fatalf("a*B + b*B != (a+b)*B")
+		}
+
+		// 2*(a*B) = a*B + a*B, and -(a*B) + a*B = 0.
+		var dbl, neg ExtendedGroupElement
+		GeDouble(&dbl, &pa)
+		GeAdd(&sum, &pa, &pa)
+		dbl.ToBytes(&s1)
+		sum.ToBytes(&s2)
+		if s1 != s2 {
+			t.Fatalf("2*P != P + P")
+		}
+		GeNeg(&neg, &pa)
+		GeAdd(&sum, &neg, &pa)
+		sum.ToBytes(&s1)
+		if !bytes.Equal(s1[:], []byte{1, 31: 0}) {
+			t.Fatalf("-P + P = %x, want the identity", s1)
+		}
+
+		// Encodings round trip.
+		var decoded ExtendedGroupElement
+		pa.ToBytes(&s1)
+		if !decoded.FromBytes(&s1) {
+			t.Fatalf("failed to decode %x", s1)
+		}
+		decoded.ToBytes(&s2)
+		if s1 != s2 {
+			t.Fatalf("decoding %x gave %x", s1, s2)
+		}
+	}
+
+	// y = 2 isn't on the curve.
+	var bad [32]byte
+	bad[0] = 2
+	var p ExtendedGroupElement
+	if p.FromBytes(&bad) {
+		t.Errorf("decoded an invalid point")
+	}
+}
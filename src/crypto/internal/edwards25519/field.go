@@ -0,0 +1,273 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package edwards25519 implements arithmetic in GF(2^255-19), on the
+// twisted Edwards curve that's birationally equivalent to Curve25519, and
+// modulo the order of its prime-order subgroup. It's shared by
+// crypto/curve25519 and crypto/ed25519.
+//
+// All operations on secret values run in constant time.
+package edwards25519
+
+// A FieldElement is an element of GF(2^255-19), kept as ten limbs that
+// alternate between 26 and 25 bits: t[0] + t[1]*2^26 + t[2]*2^51 + ...
+// Limbs may exceed their width between operations, and are int64s so that
+// products fit without overflow.
+type FieldElement [10]int64
+
+// limbBits returns the width of limb i.
+func limbBits(i int) uint {
+	return 26 - uint(i&1)
+}
+
+// FeZero sets h to 0.
+func FeZero(h *FieldElement) {
+	*h = FieldElement{}
+}
+
+// FeOne sets h to 1.
+func FeOne(h *FieldElement) {
+	*h = FieldElement{1}
+}
+
+// feCarry brings every limb of h back to its width, folding the carry out
+// of the top limb into the bottom one, as 2^255 = 19.
+func feCarry(h *FieldElement) {
+	for i := 0; i < 10; i++ {
+		c := h[i] >> limbBits(i)
+		h[i] -= c << limbBits(i)
+		if i == 9 {
+			h[0] += 19 * c
+		} else {
+			h[i+1] += c
+		}
+	}
+	c := h[0] >> 26
+	h[0] -= c << 26
+	h[1] += c
+}
+
+// FeAdd sets h = f + g.
+func FeAdd(h, f, g *FieldElement) {
+	for i := range h {
+		h[i] = f[i] + g[i]
+	}
+	feCarry(h)
+}
+
+// FeSub sets h = f - g.
+func FeSub(h, f, g *FieldElement) {
+	for i := range h {
+		h[i] = f[i] - g[i]
+	}
+	feCarry(h)
+}
+
+// FeNeg sets h = -f.
+func FeNeg(h, f *FieldElement) {
+	for i := range h {
+		h[i] = -f[i]
+	}
+	feCarry(h)
+}
+
+// FeCopy sets h = f.
+func FeCopy(h, f *FieldElement) {
+	*h = *f
+}
+
+// FeMul sets h = f * g.
+func FeMul(h, f, g *FieldElement) {
+	// A limb product lands on the limb whose offset is the sum of the
+	// offsets, except that two odd limbs overshoot it by one bit. Limbs
+	// at 2^255 and above wrap around, multiplied by 19.
+	var t [19]int64
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			p := f[i] * g[j]
+			if i&j&1 == 1 {
+				p *= 2
+			}
+			t[i+j] += p
+		}
+	}
+	for i := 18; i >= 10; i-- {
+		t[i-10] += 19 * t[i]
+	}
+	copy(h[:], t[:10])
+	feCarry(h)
+}
+
+// FeSquare sets h = f * f.
+func FeSquare(h, f *FieldElement) {
+	FeMul(h, f, f)
+}
+
+// FeMulSmall sets h = f * n, for n < 2^20.
+func FeMulSmall(h, f *FieldElement, n int64) {
+	for i := range h {
+		h[i] = f[i] * n
+	}
+	feCarry(h)
+}
+
+// feSquareN sets h = f^(2^n).
+func feSquareN(h, f *FieldElement, n int) {
+	FeSquare(h, f)
+	for i := 1; i < n; i++ {
+		FeSquare(h, h)
+	}
+}
+
+// FeInvert sets out = z^-1, computed as z^(p-2). It sets out to zero if z
+// is zero.
+func FeInvert(out, z *FieldElement) {
+	var t0, t1, t2, t3 FieldElement
+	FeSquare(&t0, z)         // 2
+	feSquareN(&t1, &t0, 2)   // 8
+	FeMul(&t1, z, &t1)       // 9
+	FeMul(&t0, &t0, &t1)     // 11
+	FeSquare(&t2, &t0)       // 22
+	FeMul(&t1, &t1, &t2)     // 2^5 - 1
+	feSquareN(&t2, &t1, 5)   // 2^10 - 2^5
+	FeMul(&t1, &t2, &t1)     // 2^10 - 1
+	feSquareN(&t2, &t1, 10)  // 2^20 - 2^10
+	FeMul(&t2, &t2, &t1)     // 2^20 - 1
+	feSquareN(&t3, &t2, 20)  // 2^40 - 2^20
+	FeMul(&t2, &t3, &t2)     // 2^40 - 1
+	feSquareN(&t2, &t2, 10)  // 2^50 - 2^10
+	FeMul(&t1, &t2, &t1)     // 2^50 - 1
+	feSquareN(&t2, &t1, 50)  // 2^100 - 2^50
+	FeMul(&t2, &t2, &t1)     // 2^100 - 1
+	feSquareN(&t3, &t2, 100) // 2^200 - 2^100
+	FeMul(&t2, &t3, &t2)     // 2^200 - 1
+	feSquareN(&t2, &t2, 50)  // 2^250 - 2^50
+	FeMul(&t1, &t2, &t1)     // 2^250 - 1
+	feSquareN(&t1, &t1, 5)   // 2^255 - 2^5
+	FeMul(out, &t1, &t0)     // 2^255 - 21
+}
+
+// fePow22523 sets out = z^((p-5)/8) = z^(2^252-3), which is used to take
+// square roots.
+func fePow22523(out, z *FieldElement) {
+	var t0, t1, t2 FieldElement
+	FeSquare(&t0, z)         // 2
+	feSquareN(&t1, &t0, 2)   // 8
+	FeMul(&t1, z, &t1)       // 9
+	FeMul(&t0, &t0, &t1)     // 11
+	FeSquare(&t0, &t0)       // 22
+	FeMul(&t0, &t1, &t0)     // 2^5 - 1
+	feSquareN(&t1, &t0, 5)   // 2^10 - 2^5
+	FeMul(&t0, &t1, &t0)     // 2^10 - 1
+	feSquareN(&t1, &t0, 10)  // 2^20 - 2^10
+	FeMul(&t1, &t1, &t0)     // 2^20 - 1
+	feSquareN(&t2, &t1, 20)  // 2^40 - 2^20
+	FeMul(&t1, &t2, &t1)     // 2^40 - 1
+	feSquareN(&t1, &t1, 10)  // 2^50 - 2^10
+	FeMul(&t0, &t1, &t0)     // 2^50 - 1
+	feSquareN(&t1, &t0, 50)  // 2^100 - 2^50
+	FeMul(&t1, &t1, &t0)     // 2^100 - 1
+	feSquareN(&t2, &t1, 100) // 2^200 - 2^100
+	FeMul(&t1, &t2, &t1)     // 2^200 - 1
+	feSquareN(&t1, &t1, 50)  // 2^250 - 2^50
+	FeMul(&t0, &t1, &t0)     // 2^250 - 1
+	feSquareN(&t0, &t0, 2)   // 2^252 - 4
+	FeMul(out, &t0, z)       // 2^252 - 3
+}
+
+// FeCMove sets f = g if b == 1 and leaves it alone if b == 0.
+func FeCMove(f, g *FieldElement, b int64) {
+	mask := -b
+	for i := range f {
+		f[i] ^= mask & (f[i] ^ g[i])
+	}
+}
+
+// FeCSwap swaps f and g if b == 1 and leaves them alone if b == 0.
+func FeCSwap(f, g *FieldElement, b int64) {
+	mask := -b
+	for i := range f {
+		t := mask & (f[i] ^ g[i])
+		f[i] ^= t
+		g[i] ^= t
+	}
+}
+
+func load(s []byte, offset uint) int64 {
+	// Limbs start at bit offset and are at most 26 bits wide, so they're
+	// within the five bytes from offset/8.
+	var v uint64
+	for i := uint(0); i < 5 && offset/8+i < uint(len(s)); i++ {
+		v |= uint64(s[offset/8+i]) << (8 * i)
+	}
+	return int64(v >> (offset % 8))
+}
+
+// FeFromBytes sets h to the little-endian number in s, ignoring its top
+// bit.
+func FeFromBytes(h *FieldElement, s *[32]byte) {
+	var offset uint
+	for i := range h {
+		h[i] = load(s[:], offset) & (1<<limbBits(i) - 1)
+		offset += limbBits(i)
+	}
+}
+
+// FeToBytes sets s to the canonical, little-endian encoding of h, which is
+// fully reduced modulo p.
+func FeToBytes(s *[32]byte, h *FieldElement) {
+	t := *h
+	feCarry(&t)
+
+	// q is the number of times p goes into t, which is 0 or 1 once the
+	// limbs are carried, or -1 if t is negative.
+	q := (19*t[9] + 1<<24) >> 25
+	for i := 0; i < 10; i++ {
+		q = (t[i] + q) >> limbBits(i)
+	}
+	// t - q*p = t + 19*q - q*2^255, where the last term is dropped with
+	// the carry out of the top limb.
+	t[0] += 19 * q
+	for i := 0; i < 9; i++ {
+		c := t[i] >> limbBits(i)
+		t[i+1] += c
+		t[i] -= c << limbBits(i)
+	}
+	t[9] &= 1<<25 - 1
+
+	var acc uint64
+	var accBits uint
+	j := 0
+	for i := range t {
+		acc |= uint64(t[i]) << accBits
+		accBits += limbBits(i)
+		for accBits >= 8 {
+			s[j] = byte(acc)
+			acc >>= 8
+			accBits -= 8
+			j++
+		}
+	}
+	s[j] = byte(acc)
+}
+
+// FeIsNegative reports whether the canonical encoding of f is odd, which
+// is what the sign of an x coordinate means.
+func FeIsNegative(f *FieldElement) int64 {
+	var s [32]byte
+	FeToBytes(&s, f)
+	return int64(s[0] & 1)
+}
+
+// FeIsNonZero returns 1 if f != 0, and 0 otherwise.
+func FeIsNonZero(f *FieldElement) int64 {
+	var s [32]byte
+	FeToBytes(&s, f)
+	var x byte
+	for _, b := range s {
+		x |= b
+	}
+	// x is a byte, so x-1 is negative only if x is zero.
+	return 1 + (int64(x)-1)>>63
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edwards25519
+
+// Scalars are integers modulo l = 2^252 + 27742317777372353535851937790883648493,
+// the order of the base point, encoded in 32 little-endian bytes.
+//
+// They're reduced as 21-bit limbs, using 2^252 = -27742317777372353535851937790883648493
+// (mod l), whose limbs are the constants in scFold. The arithmetic
+// follows sc_reduce and sc_muladd from the ref10 implementation of
+// Ed25519.
+
+var orderBytes = [32]byte{
+	0xed, 0xd3, 0xf5, 0x5c, 0x1a, 0x63, 0x12, 0x58,
+	0xd6, 0x9c, 0xf7, 0xa2, 0xde, 0xf9, 0xde, 0x14,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10,
+}
+
+// scLimbs is enough 21-bit limbs for a 512-bit number.
+const scLimbs = 25
+
+func scLoad(t []int64, s []byte) {
+	for i := range t {
+		t[i] = load(s, 21*uint(i)) & (1<<21 - 1)
+	}
+}
+
+// scFold replaces limb i with its value times 2^(21*i) reduced modulo l,
+// which lands on limbs i-12 to i-7.
+func scFold(s *[scLimbs]int64, i int) {
+	s[i-12] += s[i] * 666643
+	s[i-11] += s[i] * 470296
+	s[i-10] += s[i] * 654183
+	s[i-9] -= s[i] * 997805
+	s[i-8] += s[i] * 136657
+	s[i-7] -= s[i] * 683901
+	s[i] = 0
+}
+
+// scCarry carries limbs lo to hi-1 into their successors, leaving them in
+// [-2^20, 2^20) if round is set, or [0, 2^21) otherwise.
+func scCarry(s *[scLimbs]int64, lo, hi int, round bool) {
+	var bias int64
+	if round {
+		bias = 1 << 20
+	}
+	for j := lo; j < hi; j++ {
+		c := (s[j] + bias) >> 21
+		s[j+1] += c
+		s[j] -= c << 21
+	}
+}
+
+// scReduceLimbs sets out to s modulo l.
+func scReduceLimbs(out *[32]byte, s *[scLimbs]int64) {
+	scCarry(s, 0, scLimbs-1, true)
+	for i := scLimbs - 1; i >= 12; i-- {
+		scFold(s, i)
+		scCarry(s, i-12, i-1, true)
+	}
+
+	// The remainder is below 2^253. Folding the bits above 2^252 twice
+	// more makes it fully reduced.
+	scCarry(s, 0, 12, true)
+	scFold(s, 12)
+	scCarry(s, 0, 12, false)
+	scFold(s, 12)
+	scCarry(s, 0, 11, false)
+
+	*out = [32]byte{}
+	var acc uint64
+	var accBits uint
+	j := 0
+	for i := 0; i < 12; i++ {
+		acc |= uint64(s[i]) << accBits
+		accBits += 21
+		for accBits >= 8 && j < len(out) {
+			out[j] = byte(acc)
+			acc >>= 8
+			accBits -= 8
+			j++
+		}
+	}
+	if j < len(out) {
+		out[j] = byte(acc)
+	}
+}
+
+// ScReduce sets out to s modulo l, where s is a little-endian, 512-bit
+// number.
+func ScReduce(out *[32]byte, s *[64]byte) {
+	var t [scLimbs]int64
+	scLoad(t[:], s[:])
+	scReduceLimbs(out, &t)
+}
+
+// ScMulAdd sets s = a*b + c modulo l, where a, b and c are little-endian,
+// 256-bit numbers.
+func ScMulAdd(s, a, b, c *[32]byte) {
+	var al, bl [13]int64
+	scLoad(al[:], a[:])
+	scLoad(bl[:], b[:])
+	var t [scLimbs]int64
+	scLoad(t[:13], c[:])
+	for i := range al {
+		for j := range bl {
+			t[i+j] += al[i] * bl[j]
+		}
+	}
+	scReduceLimbs(s, &t)
+}
+
+// ScMinimal reports whether s, a little-endian, 256-bit number, is less
+// than l. It doesn't run in constant time.
+func ScMinimal(s *[32]byte) bool {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] != orderBytes[i] {
+			return s[i] < orderBytes[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,706 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ocsp parses OCSP responses and builds OCSP requests and
+// responses, as specified in RFC 6960. It can be used to check the
+// revocation status of a certificate, either by querying the certificate's
+// OCSPServer or by checking a response stapled to a TLS handshake.
+package ocsp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+var idPKIXOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+// ResponseStatus contains the result of an OCSP request. See RFC 6960,
+// section 4.2.1.
+type ResponseStatus int
+
+const (
+	Success       ResponseStatus = 0
+	Malformed     ResponseStatus = 1
+	InternalError ResponseStatus = 2
+	TryLater      ResponseStatus = 3
+	// Status code four is unused in OCSP.
+	SignatureRequired ResponseStatus = 5
+	Unauthorized      ResponseStatus = 6
+)
+
+func (r ResponseStatus) String() string {
+	switch r {
+	case Success:
+		return "success"
+	case Malformed:
+		return "malformed"
+	case InternalError:
+		return "internal error"
+	case TryLater:
+		return "try later"
+	case SignatureRequired:
+		return "signature required"
+	case Unauthorized:
+		return "unauthorized"
+	default:
+		return "unknown OCSP status: " + strconv.Itoa(int(r))
+	}
+}
+
+// ResponseError is an error that may be returned by ParseResponse to
+// indicate that the response itself is an error, not just that it's
+// indicating that a certificate is revoked, unknown, etc.
+type ResponseError struct {
+	Status ResponseStatus
+}
+
+func (r ResponseError) Error() string {
+	return "ocsp: error from server: " + r.Status.String()
+}
+
+// ParseError results from an invalid OCSP request or response.
+type ParseError string
+
+func (p ParseError) Error() string {
+	return string(p)
+}
+
+// The certificate status values that can be expressed in OCSP. See RFC
+// 6960, section 4.2.1.
+const (
+	// Good means that the certificate is valid.
+	Good = iota
+	// Revoked means that the certificate has been deliberately revoked.
+	Revoked
+	// Unknown means that the OCSP responder doesn't know about the
+	// certificate.
+	Unknown
+	// ServerFailed is unused and was never used (see RFC 6960, section
+	// 4.2.1). It's kept so that Status values keep their meaning.
+	ServerFailed
+)
+
+// The enumerated reasons for revoking a certificate. See RFC 5280,
+// section 5.3.1.
+const (
+	Unspecified          = 0
+	KeyCompromise        = 1
+	CACompromise         = 2
+	AffiliationChanged   = 3
+	Superseded           = 4
+	CessationOfOperation = 5
+	CertificateHold      = 6
+	RemoveFromCRL        = 8
+	PrivilegeWithdrawn   = 9
+	AACompromise         = 10
+)
+
+// These are the ASN.1 structures of RFC 6960, section 4.
+
+type certID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest tbsRequest
+}
+
+type tbsRequest struct {
+	Version       int              `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
+	RequestList   []request
+}
+
+type request struct {
+	Cert certID
+}
+
+type responseASN1 struct {
+	Status   asn1.Enumerated
+	Response responseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicResponse struct {
+	TBSResponseData    responseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Raw         asn1.RawContent
+	Version     int           `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue // a CHOICE of byName [1] and byKey [2]
+	ProducedAt  time.Time     `asn1:"generalized"`
+	Responses   []singleResponse
+}
+
+type singleResponse struct {
+	CertID     certID
+	CertStatus asn1.RawValue // a CHOICE of good [0], revoked [1] and unknown [2]
+	ThisUpdate time.Time     `asn1:"generalized"`
+	NextUpdate time.Time     `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type revokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// revokedStatus is used to marshal the revoked arm of a CertStatus, which
+// is an implicitly tagged revokedInfo.
+type revokedStatus struct {
+	Revoked revokedInfo `asn1:"tag:1"`
+}
+
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26},
+	crypto.SHA256: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3},
+}
+
+func getHashAlgorithmFromOID(oid asn1.ObjectIdentifier) crypto.Hash {
+	for hash, hashOID := range hashOIDs {
+		if oid.Equal(hashOID) {
+			return hash
+		}
+	}
+	return crypto.Hash(0)
+}
+
+// signatureAlgorithms are the signature algorithms that responses can be
+// signed and verified with. crypto/x509 keeps its own table unexported.
+var signatureAlgorithms = []struct {
+	algo x509.SignatureAlgorithm
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{x509.SHA1WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, crypto.SHA1},
+	{x509.SHA256WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256},
+	{x509.SHA384WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, crypto.SHA384},
+	{x509.SHA512WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, crypto.SHA512},
+	{x509.ECDSAWithSHA1, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, crypto.SHA1},
+	{x509.ECDSAWithSHA256, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, crypto.SHA256},
+	{x509.ECDSAWithSHA384, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, crypto.SHA384},
+	{x509.ECDSAWithSHA512, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, crypto.SHA512},
+	{x509.PureEd25519, asn1.ObjectIdentifier{1, 3, 101, 112}, crypto.Hash(0)},
+}
+
+func getSignatureAlgorithmFromOID(oid asn1.ObjectIdentifier) x509.SignatureAlgorithm {
+	for _, details := range signatureAlgorithms {
+		if oid.Equal(details.oid) {
+			return details.algo
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// signingParams returns the signature algorithm, its OID and the hash to
+// use for signing with a key whose public half is pub.
+func signingParams(pub crypto.PublicKey) (x509.SignatureAlgorithm, asn1.ObjectIdentifier, crypto.Hash, error) {
+	var algo x509.SignatureAlgorithm
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		algo = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P224(), elliptic.P256():
+			algo = x509.ECDSAWithSHA256
+		case elliptic.P384():
+			algo = x509.ECDSAWithSHA384
+		case elliptic.P521():
+			algo = x509.ECDSAWithSHA512
+		default:
+			return 0, nil, 0, errors.New("ocsp: unknown elliptic curve")
+		}
+	case ed25519.PublicKey:
+		algo = x509.PureEd25519
+	default:
+		return 0, nil, 0, errors.New("ocsp: only RSA, ECDSA and Ed25519 keys supported")
+	}
+	for _, details := range signatureAlgorithms {
+		if details.algo == algo {
+			return algo, details.oid, details.hash, nil
+		}
+	}
+	panic("unreachable")
+}
+
+// Request represents an OCSP request for the status of a single
+// certificate. See RFC 6960, section 4.1.
+type Request struct {
+	HashAlgorithm  crypto.Hash
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+// Marshal returns the DER encoding of req.
+func (req *Request) Marshal() ([]byte, error) {
+	hashOID, ok := hashOIDs[req.HashAlgorithm]
+	if !ok {
+		return nil, errors.New("ocsp: unsupported hash algorithm")
+	}
+	return asn1.Marshal(ocspRequest{
+		tbsRequest{
+			RequestList: []request{
+				{
+					Cert: certID{
+						HashAlgorithm: pkix.AlgorithmIdentifier{
+							Algorithm:  hashOID,
+							Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
+						},
+						NameHash:      req.IssuerNameHash,
+						IssuerKeyHash: req.IssuerKeyHash,
+						SerialNumber:  req.SerialNumber,
+					},
+				},
+			},
+		},
+	})
+}
+
+// ParseRequest parses an OCSP request in DER form. It only supports
+// requests for a single certificate, and doesn't check signed requests.
+func ParseRequest(bytes []byte) (*Request, error) {
+	var req ocspRequest
+	rest, err := asn1.Unmarshal(bytes, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, ParseError("trailing data in OCSP request")
+	}
+	if len(req.TBSRequest.RequestList) != 1 {
+		return nil, ParseError("OCSP request contains " + strconv.Itoa(len(req.TBSRequest.RequestList)) + " certificates; only one is supported")
+	}
+
+	innerRequest := req.TBSRequest.RequestList[0]
+	hashFunc := getHashAlgorithmFromOID(innerRequest.Cert.HashAlgorithm.Algorithm)
+	if hashFunc == 0 {
+		return nil, ParseError("OCSP request uses unknown hash function")
+	}
+
+	return &Request{
+		HashAlgorithm:  hashFunc,
+		IssuerNameHash: innerRequest.Cert.NameHash,
+		IssuerKeyHash:  innerRequest.Cert.IssuerKeyHash,
+		SerialNumber:   innerRequest.Cert.SerialNumber,
+	}, nil
+}
+
+// RequestOptions contains options for constructing OCSP requests.
+type RequestOptions struct {
+	// Hash contains the hash function that should be used when
+	// constructing the OCSP request. If zero, SHA-1 will be used.
+	Hash crypto.Hash
+}
+
+func (opts *RequestOptions) hash() crypto.Hash {
+	if opts == nil || opts.Hash == 0 {
+		// SHA-1 is nearly universally used in OCSP.
+		return crypto.SHA1
+	}
+	return opts.Hash
+}
+
+// issuerHashes returns the hashes of issuer's name and public key that
+// identify it in OCSP requests and responses.
+func issuerHashes(issuer *x509.Certificate, hashFunc crypto.Hash) (nameHash, keyHash []byte, err error) {
+	if !hashFunc.Available() {
+		return nil, nil, x509.ErrUnsupportedAlgorithm
+	}
+
+	// The key hash covers the contents of the subjectPublicKey BIT
+	// STRING, not the whole SubjectPublicKeyInfo.
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return nil, nil, err
+	}
+
+	h := hashFunc.New()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	keyHash = h.Sum(nil)
+
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	nameHash = h.Sum(nil)
+	return nameHash, keyHash, nil
+}
+
+// CreateRequest returns a DER-encoded OCSP request for the status of cert.
+// If opts is nil then sensible defaults are used.
+func CreateRequest(cert, issuer *x509.Certificate, opts *RequestOptions) ([]byte, error) {
+	hashFunc := opts.hash()
+	if _, ok := hashOIDs[hashFunc]; !ok {
+		return nil, x509.ErrUnsupportedAlgorithm
+	}
+	nameHash, keyHash, err := issuerHashes(issuer, hashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &Request{
+		HashAlgorithm:  hashFunc,
+		IssuerNameHash: nameHash,
+		IssuerKeyHash:  keyHash,
+		SerialNumber:   cert.SerialNumber,
+	}
+	return req.Marshal()
+}
+
+// Response represents an OCSP response containing a single certificate
+// status. See RFC 6960, section 4.2.
+type Response struct {
+	// Status is one of Good, Revoked or Unknown.
+	Status                                        int
+	SerialNumber                                  *big.Int
+	ProducedAt, ThisUpdate, NextUpdate, RevokedAt time.Time
+	RevocationReason                              int
+
+	// Certificate is the certificate of the OCSP responder, if the
+	// response includes it. It's nil when the issuer signed the
+	// response itself.
+	Certificate *x509.Certificate
+
+	// TBSResponseData contains the raw bytes of the signed response.
+	TBSResponseData    []byte
+	Signature          []byte
+	SignatureAlgorithm x509.SignatureAlgorithm
+
+	// IssuerHash is the hash used to identify the issuer in the
+	// response.
+	IssuerHash crypto.Hash
+}
+
+// CheckSignatureFrom checks that the signature in resp is a valid
+// signature from issuer. This should only be used if resp.Certificate is
+// nil. Otherwise, the OCSP response contained an intermediate certificate
+// that created the signature. That signature is checked by ParseResponse
+// and only resp.Certificate remains to be validated.
+func (resp *Response) CheckSignatureFrom(issuer *x509.Certificate) error {
+	return issuer.CheckSignature(resp.SignatureAlgorithm, resp.TBSResponseData, resp.Signature)
+}
+
+// IsFresh reports whether now falls within the validity interval of resp,
+// from ThisUpdate to NextUpdate. A response without a NextUpdate time is
+// fresh from ThisUpdate on, as the responder always has newer information
+// available. See RFC 6960, section 4.2.2.1.
+func (resp *Response) IsFresh(now time.Time) bool {
+	if now.Before(resp.ThisUpdate) {
+		return false
+	}
+	return resp.NextUpdate.IsZero() || now.Before(resp.NextUpdate)
+}
+
+// ParseResponse parses an OCSP response in DER form. It only supports
+// responses for a single certificate. If the response contains a
+// certificate then the signature over the response is checked. If issuer
+// is not nil then it will be used to validate the signature or embedded
+// certificate.
+//
+// Invalid signatures or parse failures will result in a ParseError. Error
+// responses will result in a ResponseError.
+func ParseResponse(bytes []byte, issuer *x509.Certificate) (*Response, error) {
+	return ParseResponseForCert(bytes, nil, issuer)
+}
+
+// ParseResponseForCert acts identically to ParseResponse, except it
+// supports parsing responses that contain multiple statuses. If cert is
+// not nil, the status for cert is returned; otherwise the response must
+// contain exactly one status.
+func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Response, error) {
+	var resp responseASN1
+	rest, err := asn1.Unmarshal(bytes, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, ParseError("trailing data in OCSP response")
+	}
+
+	if status := ResponseStatus(resp.Status); status != Success {
+		return nil, ResponseError{status}
+	}
+
+	if !resp.Response.ResponseType.Equal(idPKIXOCSPBasic) {
+		return nil, ParseError("bad OCSP response type")
+	}
+
+	var basicResp basicResponse
+	rest, err = asn1.Unmarshal(resp.Response.Response, &basicResp)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, ParseError("trailing data in OCSP response")
+	}
+
+	if n := len(basicResp.TBSResponseData.Responses); n == 0 || cert == nil && n > 1 {
+		return nil, ParseError("OCSP response contains bad number of responses")
+	}
+
+	var singleResp singleResponse
+	if cert == nil {
+		singleResp = basicResp.TBSResponseData.Responses[0]
+	} else {
+		match := false
+		for _, r := range basicResp.TBSResponseData.Responses {
+			if cert.SerialNumber.Cmp(r.CertID.SerialNumber) == 0 {
+				singleResp = r
+				match = true
+				break
+			}
+		}
+		if !match {
+			return nil, ParseError("no response matching the supplied certificate")
+		}
+	}
+
+	ret := &Response{
+		TBSResponseData:    basicResp.TBSResponseData.Raw,
+		Signature:          basicResp.Signature.RightAlign(),
+		SignatureAlgorithm: getSignatureAlgorithmFromOID(basicResp.SignatureAlgorithm.Algorithm),
+		SerialNumber:       singleResp.CertID.SerialNumber,
+		ProducedAt:         basicResp.TBSResponseData.ProducedAt,
+		ThisUpdate:         singleResp.ThisUpdate,
+		NextUpdate:         singleResp.NextUpdate,
+		IssuerHash:         getHashAlgorithmFromOID(singleResp.CertID.HashAlgorithm.Algorithm),
+	}
+
+	if len(basicResp.Certificates) > 0 {
+		ret.Certificate, err = x509.ParseCertificate(basicResp.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ret.CheckSignatureFrom(ret.Certificate); err != nil {
+			return nil, ParseError("bad OCSP signature: " + err.Error())
+		}
+
+		if issuer != nil && !ret.Certificate.Equal(issuer) {
+			// A delegated responder must be certified by the issuer
+			// for OCSP signing. See RFC 6960, section 4.2.2.2.
+			if err := ret.Certificate.CheckSignatureFrom(issuer); err != nil {
+				return nil, ParseError("bad signature on embedded certificate: " + err.Error())
+			}
+			ocspSigning := false
+			for _, usage := range ret.Certificate.ExtKeyUsage {
+				if usage == x509.ExtKeyUsageOCSPSigning {
+					ocspSigning = true
+					break
+				}
+			}
+			if !ocspSigning {
+				return nil, ParseError("embedded certificate isn't authorized to sign OCSP responses")
+			}
+		}
+	} else if issuer != nil {
+		if err := ret.CheckSignatureFrom(issuer); err != nil {
+			return nil, ParseError("bad OCSP signature: " + err.Error())
+		}
+	}
+
+	switch singleResp.CertStatus.Tag {
+	case 0:
+		ret.Status = Good
+	case 1:
+		ret.Status = Revoked
+		var info revokedInfo
+		if _, err := asn1.UnmarshalWithParams(singleResp.CertStatus.FullBytes, &info, "tag:1"); err != nil {
+			return nil, err
+		}
+		ret.RevokedAt = info.RevocationTime
+		ret.RevocationReason = int(info.Reason)
+	case 2:
+		ret.Status = Unknown
+	default:
+		return nil, ParseError("bad OCSP certificate status")
+	}
+
+	return ret, nil
+}
+
+// CreateResponse returns a DER-encoded OCSP response with the specified
+// contents. The fields in the response are populated as follows:
+//
+// The responder cert is used to populate the responder's name field, and
+// the certificate itself is provided alongside the OCSP response signature
+// if it isn't the issuer.
+//
+// The issuer cert is used to populate the IssuerNameHash and
+// IssuerKeyHash fields, using template.IssuerHash, or SHA-1 if it's zero.
+//
+// The template is used to populate the SerialNumber, Status, RevokedAt,
+// RevocationReason, ThisUpdate, and NextUpdate fields. ProducedAt is set
+// to the current time.
+//
+// The response is signed by priv, which must be the private key of the
+// responder cert. The signature algorithm depends on its type: SHA-256
+// with RSA, ECDSA with a hash that matches the curve, or Ed25519.
+func CreateResponse(issuer, responderCert *x509.Certificate, template Response, priv crypto.Signer) ([]byte, error) {
+	hashFunc := template.IssuerHash
+	if hashFunc == 0 {
+		hashFunc = crypto.SHA1
+	}
+	hashOID, ok := hashOIDs[hashFunc]
+	if !ok {
+		return nil, x509.ErrUnsupportedAlgorithm
+	}
+	nameHash, keyHash, err := issuerHashes(issuer, hashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	innerResponse := singleResponse{
+		CertID: certID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  hashOID,
+				Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
+			},
+			NameHash:      nameHash,
+			IssuerKeyHash: keyHash,
+			SerialNumber:  template.SerialNumber,
+		},
+		ThisUpdate: template.ThisUpdate.UTC(),
+		NextUpdate: template.NextUpdate.UTC(),
+	}
+	if template.NextUpdate.IsZero() {
+		innerResponse.NextUpdate = time.Time{}
+	}
+
+	switch template.Status {
+	case Good:
+		innerResponse.CertStatus = asn1.RawValue{Class: 2, Tag: 0}
+	case Unknown:
+		innerResponse.CertStatus = asn1.RawValue{Class: 2, Tag: 2}
+	case Revoked:
+		status, err := asn1.Marshal(revokedStatus{revokedInfo{
+			RevocationTime: template.RevokedAt.UTC(),
+			Reason:         asn1.Enumerated(template.RevocationReason),
+		}})
+		if err != nil {
+			return nil, err
+		}
+		// Drop the wrapping SEQUENCE, keeping the tagged revokedInfo.
+		var wrapper asn1.RawValue
+		if _, err := asn1.Unmarshal(status, &wrapper); err != nil {
+			return nil, err
+		}
+		innerResponse.CertStatus = asn1.RawValue{FullBytes: wrapper.Bytes}
+	default:
+		return nil, errors.New("ocsp: invalid certificate status")
+	}
+
+	// The responder is identified by the SHA-1 hash of its public key.
+	_, responderKeyHash, err := issuerHashes(responderCert, crypto.SHA1)
+	if err != nil {
+		return nil, err
+	}
+	responderID, err := asn1.Marshal(responderKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	tbsResponseData := responseData{
+		ResponderID: asn1.RawValue{Class: 2, Tag: 2, IsCompound: true, Bytes: responderID},
+		ProducedAt:  time.Now().Truncate(time.Second).UTC(),
+		Responses:   []singleResponse{innerResponse},
+	}
+	tbsResponseDataDER, err := asn1.Marshal(tbsResponseData)
+	if err != nil {
+		return nil, err
+	}
+
+	_, sigOID, sigHash, err := signingParams(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	signed := tbsResponseDataDER
+	if sigHash != 0 {
+		h := sigHash.New()
+		h.Write(tbsResponseDataDER)
+		signed = h.Sum(nil)
+	}
+	signature, err := priv.Sign(rand.Reader, signed, sigHash)
+	if err != nil {
+		return nil, err
+	}
+
+	response := basicResponse{
+		TBSResponseData:    tbsResponseData,
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigOID},
+		Signature: asn1.BitString{
+			Bytes:     signature,
+			BitLength: 8 * len(signature),
+		},
+	}
+	if !responderCert.Equal(issuer) {
+		response.Certificates = []asn1.RawValue{{FullBytes: responderCert.Raw}}
+	}
+	responseDER, err := asn1.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(responseASN1{
+		Status: asn1.Enumerated(Success),
+		Response: responseBytes{
+			ResponseType: idPKIXOCSPBasic,
+			Response:     responseDER,
+		},
+	})
+}
+
+// VerifyStaple checks an OCSP response stapled to a TLS handshake for the
+// leaf of the first verified chain, and requires the certificate's status
+// to be Good and the response to be fresh at now. Its signature matches the
+// VerifyOCSPStaple field of crypto/tls.Config, so it can be used to
+// reject servers that don't staple a good response.
+func VerifyStaple(staple []byte, verifiedChains [][]*x509.Certificate, now time.Time) error {
+	if len(staple) == 0 {
+		return errors.New("ocsp: no stapled response")
+	}
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) < 2 {
+		return errors.New("ocsp: stapled response needs a verified chain with an issuer")
+	}
+	cert, issuer := verifiedChains[0][0], verifiedChains[0][1]
+	resp, err := ParseResponseForCert(staple, cert, issuer)
+	if err != nil {
+		return err
+	}
+	if resp.Status != Good {
+		return errors.New("ocsp: certificate status isn't good")
+	}
+	if !resp.IsFresh(now) {
+		return errors.New("ocsp: stapled response isn't fresh")
+	}
+	return nil
+}
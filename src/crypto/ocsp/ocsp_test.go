@@ -0,0 +1,414 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testPKI struct {
+	issuer, responder, leaf          *x509.Certificate
+	issuerKey, responderKey, leafKey crypto.Signer
+}
+
+func createCert(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	return cert
+}
+
+func newTestPKI(t *testing.T, issuerKey crypto.Signer) *testPKI {
+	p := &testPKI{issuerKey: issuerKey}
+	var err error
+	if p.responderKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if p.leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(24 * time.Hour)
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OCSP test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA: true,
+	}
+	p.issuer = createCert(t, issuerTemplate, issuerTemplate, issuerKey.Public(), issuerKey)
+
+	responderTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "OCSP test responder"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+	p.responder = createCert(t, responderTemplate, p.issuer, p.responderKey.Public(), issuerKey)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		OCSPServer:   []string{"http://ocsp.example.com"},
+	}
+	p.leaf = createCert(t, leafTemplate, p.issuer, p.leafKey.Public(), issuerKey)
+	return p
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+
+	for _, hash := range []crypto.Hash{0, crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		der, err := CreateRequest(p.leaf, p.issuer, &RequestOptions{Hash: hash})
+		if err != nil {
+			t.Fatalf("hash %d: CreateRequest: %s", hash, err)
+		}
+		req, err := ParseRequest(der)
+		if err != nil {
+			t.Fatalf("hash %d: ParseRequest: %s", hash, err)
+		}
+		want := hash
+		if want == 0 {
+			want = crypto.SHA1
+		}
+		if req.HashAlgorithm != want {
+			t.Errorf("hash %d: got hash %d", hash, req.HashAlgorithm)
+		}
+		if req.SerialNumber.Cmp(p.leaf.SerialNumber) != 0 {
+			t.Errorf("hash %d: got serial %s, want %s", hash, req.SerialNumber, p.leaf.SerialNumber)
+		}
+		nameHash, keyHash, _ := issuerHashes(p.issuer, want)
+		if !bytes.Equal(req.IssuerNameHash, nameHash) || !bytes.Equal(req.IssuerKeyHash, keyHash) {
+			t.Errorf("hash %d: issuer hashes don't match", hash)
+		}
+		if len(req.IssuerKeyHash) != want.Size() {
+			t.Errorf("hash %d: issuer key hash is %d bytes", hash, len(req.IssuerKeyHash))
+		}
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thisUpdate := time.Now().Add(-time.Minute).Truncate(time.Second).UTC()
+	nextUpdate := thisUpdate.Add(time.Hour)
+	revokedAt := thisUpdate.Add(-time.Hour)
+
+	for _, issuerKey := range []crypto.Signer{rsaKey, ecdsaKey, ed25519Key} {
+		p := newTestPKI(t, issuerKey)
+		for _, delegated := range []bool{false, true} {
+			responder, responderKey := p.issuer, p.issuerKey
+			if delegated {
+				responder, responderKey = p.responder, p.responderKey
+			}
+			for _, status := range []int{Good, Revoked, Unknown} {
+				template := Response{
+					Status:           status,
+					SerialNumber:     p.leaf.SerialNumber,
+					ThisUpdate:       thisUpdate,
+					NextUpdate:       nextUpdate,
+					RevokedAt:        revokedAt,
+					RevocationReason: KeyCompromise,
+				}
+				der, err := CreateResponse(p.issuer, responder, template, responderKey)
+				if err != nil {
+					t.Fatalf("%T, delegated %v, status %d: CreateResponse: %s", issuerKey, delegated, status, err)
+				}
+				resp, err := ParseResponse(der, p.issuer)
+				if err != nil {
+					t.Fatalf("%T, delegated %v, status %d: ParseResponse: %s", issuerKey, delegated, status, err)
+				}
+
+				if resp.Status != status {
+					t.Errorf("%T, delegated %v: got status %d, want %d", issuerKey, delegated, resp.Status, status)
+				}
+				if resp.SerialNumber.Cmp(p.leaf.SerialNumber) != 0 {
+					t.Errorf("%T, delegated %v: got serial %s", issuerKey, delegated, resp.SerialNumber)
+				}
+				if !resp.ThisUpdate.Equal(thisUpdate) || !resp.NextUpdate.Equal(nextUpdate) {
+					t.Errorf("%T, delegated %v: got validity %s to %s, want %s to %s", issuerKey, delegated, resp.ThisUpdate, resp.NextUpdate, thisUpdate, nextUpdate)
+				}
+				if status == Revoked {
+					if !resp.RevokedAt.Equal(revokedAt) || resp.RevocationReason != KeyCompromise {
+						t.Errorf("%T, delegated %v: got revocation at %s for %d", issuerKey, delegated, resp.RevokedAt, resp.RevocationReason)
+					}
+				}
+				if delegated != (resp.Certificate != nil) {
+					t.Errorf("%T, delegated %v: got certificate %v", issuerKey, delegated, resp.Certificate != nil)
+				}
+				if resp.IssuerHash != crypto.SHA1 {
+					t.Errorf("%T, delegated %v: got issuer hash %d", issuerKey, delegated, resp.IssuerHash)
+				}
+			}
+		}
+	}
+}
+
+func TestResponseWithoutNextUpdate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+
+	der, err := CreateResponse(p.issuer, p.issuer, Response{
+		Status:       Good,
+		SerialNumber: p.leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		IssuerHash:   crypto.SHA256,
+	}, p.issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ParseResponseForCert(der, p.leaf, p.issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.NextUpdate.IsZero() {
+		t.Errorf("got NextUpdate %s, want none", resp.NextUpdate)
+	}
+	if resp.IssuerHash != crypto.SHA256 {
+		t.Errorf("got issuer hash %d, want SHA-256", resp.IssuerHash)
+	}
+	if !resp.IsFresh(time.Now().Add(365 * 24 * time.Hour)) {
+		t.Errorf("response without NextUpdate isn't fresh")
+	}
+	if resp.IsFresh(time.Now().Add(-time.Hour)) {
+		t.Errorf("response is fresh before ThisUpdate")
+	}
+}
+
+func TestParseResponseErrors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+	other := newTestPKI(t, p.responderKey)
+
+	template := Response{
+		Status:       Good,
+		SerialNumber: p.leaf.SerialNumber,
+		ThisUpdate:   time.Now(),
+	}
+
+	// An error status from the responder.
+	der, err := asn1.Marshal(responseASN1{Status: asn1.Enumerated(TryLater)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(der, p.issuer); err != (ResponseError{TryLater}) {
+		t.Errorf("got %v, want a TryLater ResponseError", err)
+	}
+
+	// A response signed by another issuer.
+	der, err = CreateResponse(other.issuer, other.issuer, template, other.issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(der, p.issuer); err == nil {
+		t.Errorf("accepted a response signed by another issuer")
+	}
+
+	// A corrupt signature.
+	der, err = CreateResponse(p.issuer, p.issuer, template, p.issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ParseResponse(der, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(der, resp.Signature)
+	der[i+len(resp.Signature)-1] ^= 1
+	if _, err := ParseResponse(der, p.issuer); err == nil {
+		t.Errorf("accepted a corrupt signature")
+	}
+
+	// A delegated responder without the OCSP signing extended key usage.
+	der, err = CreateResponse(p.issuer, p.leaf, template, p.leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(der, p.issuer); err == nil {
+		t.Errorf("accepted a response from an unauthorized responder")
+	}
+
+	// A response for another certificate.
+	der, err = CreateResponse(p.issuer, p.issuer, template, p.issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponseForCert(der, p.responder, p.issuer); err == nil {
+		t.Errorf("accepted a response for another certificate")
+	}
+}
+
+// newResponder returns a test server that answers OCSP requests for the
+// certificates issued by p with the given status.
+func newResponder(t *testing.T, p *testPKI, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("responder: %s", err)
+			return
+		}
+		req, err := ParseRequest(body)
+		if err != nil {
+			t.Errorf("responder: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		nameHash, keyHash, _ := issuerHashes(p.issuer, req.HashAlgorithm)
+		if !bytes.Equal(req.IssuerNameHash, nameHash) || !bytes.Equal(req.IssuerKeyHash, keyHash) {
+			t.Errorf("responder: request for an unknown issuer")
+		}
+		resp, err := CreateResponse(p.issuer, p.responder, Response{
+			Status:           status,
+			SerialNumber:     req.SerialNumber,
+			ThisUpdate:       time.Now().Add(-time.Minute),
+			NextUpdate:       time.Now().Add(time.Hour),
+			RevokedAt:        time.Now().Add(-time.Hour),
+			RevocationReason: Superseded,
+			IssuerHash:       req.HashAlgorithm,
+		}, p.responderKey)
+		if err != nil {
+			t.Errorf("responder: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+}
+
+func TestResponder(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+
+	for _, status := range []int{Good, Revoked} {
+		server := newResponder(t, p, status)
+		p.leaf.OCSPServer = []string{server.URL}
+
+		req, err := CreateRequest(p.leaf, p.issuer, &RequestOptions{Hash: crypto.SHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp, err := http.Post(p.leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := ioutil.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := ParseResponseForCert(der, p.leaf, p.issuer)
+		if err != nil {
+			t.Fatalf("status %d: %s", status, err)
+		}
+		if resp.Status != status {
+			t.Errorf("got status %d, want %d", resp.Status, status)
+		}
+		if status == Revoked && resp.RevocationReason != Superseded {
+			t.Errorf("got revocation reason %d, want %d", resp.RevocationReason, Superseded)
+		}
+		if !resp.Certificate.Equal(p.responder) {
+			t.Errorf("response doesn't include the responder's certificate")
+		}
+	}
+}
+
+func TestVerifyStaple(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+	chains := [][]*x509.Certificate{{p.leaf, p.issuer}}
+
+	staple := func(status int, thisUpdate, nextUpdate time.Time) []byte {
+		der, err := CreateResponse(p.issuer, p.responder, Response{
+			Status:       status,
+			SerialNumber: p.leaf.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+			RevokedAt:    thisUpdate,
+		}, p.responderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	now := time.Now()
+	if err := VerifyStaple(staple(Good, now.Add(-time.Minute), now.Add(time.Hour)), chains, now); err != nil {
+		t.Errorf("rejected a good staple: %s", err)
+	}
+	if err := VerifyStaple(nil, chains, now); err == nil {
+		t.Errorf("accepted a missing staple")
+	}
+	if err := VerifyStaple(staple(Good, now.Add(-time.Minute), now.Add(time.Hour)), [][]*x509.Certificate{{p.leaf}}, now); err == nil {
+		t.Errorf("accepted a staple without an issuer")
+	}
+	if err := VerifyStaple(staple(Revoked, now.Add(-time.Minute), now.Add(time.Hour)), chains, now); err == nil {
+		t.Errorf("accepted a revoked staple")
+	}
+	if err := VerifyStaple(staple(Unknown, now.Add(-time.Minute), now.Add(time.Hour)), chains, now); err == nil {
+		t.Errorf("accepted an unknown staple")
+	}
+	if err := VerifyStaple(staple(Good, now.Add(-2*time.Hour), now.Add(-time.Hour)), chains, now); err == nil {
+		t.Errorf("accepted an expired staple")
+	}
+	if err := VerifyStaple(staple(Good, now.Add(-2*time.Hour), now.Add(-time.Hour)), chains, now.Add(-90*time.Minute)); err != nil {
+		t.Errorf("rejected a staple fresh at the given time: %s", err)
+	}
+}
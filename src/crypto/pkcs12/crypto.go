@@ -0,0 +1,223 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rc4"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidPBES2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+)
+
+// macHashes holds the hashes a PKCS#12 MAC may use, by OID.
+var macHashes = map[string]crypto.Hash{
+	oidSHA1.String():   crypto.SHA1,
+	oidSHA256.String(): crypto.SHA256,
+	oidSHA384.String(): crypto.SHA384,
+	oidSHA512.String(): crypto.SHA512,
+}
+
+const (
+	// iterations is the iteration count used when encoding, which
+	// matches OpenSSL.
+	iterations = 2048
+	saltSize   = 8
+
+	// maxIterations bounds the iteration count of the MAC and PBE
+	// parameters. The KDF of RFC 7292, appendix B, runs that many
+	// hash rounds for each key, IV and MAC key it derives, so the
+	// file, not the caller, would otherwise set the cost of Decode.
+	maxIterations = 1 << 22
+)
+
+// checkIterations returns an error if n is not an acceptable iteration
+// count.
+func checkIterations(n int) error {
+	if n <= 0 || n > maxIterations {
+		return errors.New("pkcs12: invalid iteration count " + strconv.Itoa(n))
+	}
+	return nil
+}
+
+// A pbeAlgorithm is one of the password based encryption schemes of RFC
+// 7292, appendix C, which derive the key and IV with the PKCS#12 key
+// derivation function and SHA-1.
+type pbeAlgorithm struct {
+	oid     asn1.ObjectIdentifier
+	keySize int
+	// Exactly one of newBlock, for a block cipher in CBC mode, and
+	// newStream is set.
+	newBlock  func(key []byte) (cipher.Block, error)
+	newStream func(key []byte) (cipher.Stream, error)
+}
+
+var pbeAlgorithms = []pbeAlgorithm{
+	{
+		oid:     asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 1}, // pbeWithSHAAnd128BitRC4
+		keySize: 16,
+		newStream: func(key []byte) (cipher.Stream, error) {
+			return rc4.NewCipher(key)
+		},
+	},
+	{
+		oid:     asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 2}, // pbeWithSHAAnd40BitRC4
+		keySize: 5,
+		newStream: func(key []byte) (cipher.Stream, error) {
+			return rc4.NewCipher(key)
+		},
+	},
+	{
+		oid:      asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}, // pbeWithSHAAnd3-KeyTripleDES-CBC
+		keySize:  24,
+		newBlock: des.NewTripleDESCipher,
+	},
+	{
+		oid:     asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}, // pbeWithSHAAnd128BitRC2-CBC
+		keySize: 16,
+		newBlock: func(key []byte) (cipher.Block, error) {
+			return newRC2Cipher(key, 128)
+		},
+	},
+	{
+		oid:     asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}, // pbeWithSHAAnd40BitRC2-CBC
+		keySize: 5,
+		newBlock: func(key []byte) (cipher.Block, error) {
+			return newRC2Cipher(key, 40)
+		},
+	},
+}
+
+// encryptionAlgorithm is the algorithm used by encrypt.
+var encryptionAlgorithm = &pbeAlgorithms[2]
+
+// pbeParams reflects the parameters of the algorithms in pbeAlgorithms.
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// decrypt decrypts data, encrypted with algorithm and password. PBES2, as
+// used by OpenSSL 3.0 and later, is handled by crypto/x509.
+func decrypt(algorithm pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	if algorithm.Algorithm.Equal(oidPBES2) {
+		// PBES2 derives the key from the password's UTF-8 bytes, and
+		// its encrypted content has the shape of an encrypted PKCS#8
+		// key.
+		der, err := asn1.Marshal(encryptedPrivateKeyInfo{algorithm, data})
+		if err != nil {
+			return nil, err
+		}
+		decrypted, err := x509.DecryptPKCS8PrivateKey(der, []byte(password))
+		if err == x509.IncorrectPasswordError {
+			err = ErrIncorrectPassword
+		}
+		return decrypted, err
+	}
+
+	var alg *pbeAlgorithm
+	for i := range pbeAlgorithms {
+		if pbeAlgorithms[i].oid.Equal(algorithm.Algorithm) {
+			alg = &pbeAlgorithms[i]
+		}
+	}
+	if alg == nil {
+		return nil, NotImplementedError("algorithm " + algorithm.Algorithm.String() + " is not supported")
+	}
+	var params pbeParams
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if err := checkIterations(params.Iterations); err != nil {
+		return nil, err
+	}
+	password16 := bmpString(password)
+	key := pbkdf(crypto.SHA1, params.Salt, password16, params.Iterations, 1, alg.keySize)
+
+	if alg.newStream != nil {
+		stream, err := alg.newStream(key)
+		if err != nil {
+			return nil, err
+		}
+		decrypted := make([]byte, len(data))
+		stream.XORKeyStream(decrypted, data)
+		return decrypted, nil
+	}
+
+	block, err := alg.newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("pkcs12: input is not a multiple of the block size")
+	}
+	iv := pbkdf(crypto.SHA1, params.Salt, password16, params.Iterations, 2, block.BlockSize())
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// A bad padding is taken to mean a wrong password.
+	n := int(decrypted[len(decrypted)-1])
+	if n == 0 || n > block.BlockSize() {
+		return nil, ErrIncorrectPassword
+	}
+	for _, b := range decrypted[len(decrypted)-n:] {
+		if int(b) != n {
+			return nil, ErrIncorrectPassword
+		}
+	}
+	return decrypted[:len(decrypted)-n], nil
+}
+
+// encrypt encrypts data with password and encryptionAlgorithm, with a
+// random salt, and returns the algorithm with its parameters and the
+// encrypted data.
+func encrypt(rand io.Reader, data []byte, password string) (pkix.AlgorithmIdentifier, []byte, error) {
+	var algorithm pkix.AlgorithmIdentifier
+	params := pbeParams{Salt: make([]byte, saltSize), Iterations: iterations}
+	if _, err := io.ReadFull(rand, params.Salt); err != nil {
+		return algorithm, nil, errors.New("pkcs12: cannot generate salt: " + err.Error())
+	}
+	paramBytes, err := asn1.Marshal(params)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	algorithm.Algorithm = encryptionAlgorithm.oid
+	algorithm.Parameters.FullBytes = paramBytes
+
+	password16 := bmpString(password)
+	key := pbkdf(crypto.SHA1, params.Salt, password16, params.Iterations, 1, encryptionAlgorithm.keySize)
+	block, err := encryptionAlgorithm.newBlock(key)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	iv := pbkdf(crypto.SHA1, params.Salt, password16, params.Iterations, 2, block.BlockSize())
+
+	// See RFC 1423, section 1.1.
+	pad := block.BlockSize() - len(data)%block.BlockSize()
+	encrypted := make([]byte, len(data)+pad)
+	copy(encrypted, data)
+	for i := len(data); i < len(encrypted); i++ {
+		encrypted[i] = byte(pad)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+	return algorithm, encrypted, nil
+}
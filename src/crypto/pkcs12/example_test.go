@@ -0,0 +1,34 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12_test
+
+import (
+	"crypto/pkcs12"
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+)
+
+func ExampleDecode() {
+	pfxData, err := ioutil.ReadFile("client.p12")
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, cert, caCerts, err := pkcs12.Decode(pfxData, "password")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tlsCert := tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+	for _, caCert := range caCerts {
+		tlsCert.Certificate = append(tlsCert.Certificate, caCert.Raw)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+	_ = config
+}
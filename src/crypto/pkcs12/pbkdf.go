@@ -0,0 +1,98 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto"
+	"unicode/utf16"
+)
+
+// bmpString returns password as a BMPString, big-endian UTF-16 with a
+// terminating NUL, which is how the PKCS#12 key derivation function takes
+// passwords. See RFC 7292, appendix B.1.
+func bmpString(password string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(password)) {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return append(b, 0, 0)
+}
+
+// pbkdf derives size bytes of keying material from password, a BMPString,
+// and salt with the PKCS#12 key derivation function, using the hash h. The
+// id is 1 for an encryption key, 2 for an IV and 3 for a MAC key. See RFC
+// 7292, appendix B.2.
+func pbkdf(h crypto.Hash, salt, password []byte, iterations int, id byte, size int) []byte {
+	// u and v are the output and block sizes of the hash.
+	u := h.Size()
+	v := 64
+	if h == crypto.SHA384 || h == crypto.SHA512 {
+		v = 128
+	}
+
+	// 1. Construct a string, D (the "diversifier"), by concatenating v/8
+	//    copies of ID.
+	D := make([]byte, v)
+	for i := range D {
+		D[i] = id
+	}
+
+	// 2. and 3. Concatenate copies of the salt and of the password to
+	//    create strings S and P of length a multiple of v.
+	// 4. Set I=S||P to be the concatenation of S and P.
+	fill := func(s []byte) []byte {
+		out := make([]byte, v*((len(s)+v-1)/v))
+		for i := range out {
+			out[i] = s[i%len(s)]
+		}
+		return out
+	}
+	var I []byte
+	if len(salt) > 0 {
+		I = append(I, fill(salt)...)
+	}
+	if len(password) > 0 {
+		I = append(I, fill(password)...)
+	}
+
+	// 5. Set c=ceiling(n/u).
+	// 6. For i=1, 2, ..., c, do the following:
+	var out []byte
+	B := make([]byte, v)
+	for len(out) < size {
+		// A. Set A_i=H^r(D||I).
+		hash := h.New()
+		hash.Write(D)
+		hash.Write(I)
+		A := hash.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			hash.Reset()
+			hash.Write(A)
+			A = hash.Sum(A[:0])
+		}
+		out = append(out, A...)
+		if len(out) >= size {
+			break
+		}
+
+		// B. Concatenate copies of A_i to create a string B of length v
+		//    bits.
+		for j := range B {
+			B[j] = A[j%u]
+		}
+
+		// C. Treating I as a concatenation I_0, I_1, ..., I_(k-1) of
+		//    v-bit blocks, set I_j=(I_j+B+1) mod 2^v for each j.
+		for j := 0; j < len(I); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(I[j+k]) + int(B[k]) + carry
+				I[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
@@ -0,0 +1,434 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pkcs12 reads and writes PKCS#12 (PFX) files, as specified in RFC
+// 7292, which bundle a private key with its certificate chain and are
+// protected by a password.
+//
+// The private key and certificates returned by Decode fit directly into a
+// tls.Certificate.
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+)
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+
+	oidCertTypeX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidLocalKeyID              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+)
+
+// ErrIncorrectPassword is returned when an incorrect password is detected.
+var ErrIncorrectPassword = errors.New("pkcs12: decryption password incorrect")
+
+// NotImplementedError is returned when a PKCS#12 file uses a feature this
+// package doesn't support, such as public key integrity protection.
+type NotImplementedError string
+
+func (e NotImplementedError) Error() string {
+	return "pkcs12: " + string(e)
+}
+
+// These structures reflect the ASN.1 structures of RFC 7292 and of the
+// PKCS#7 ContentInfo they are wrapped in.
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	Id         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	Id     asn1.ObjectIdentifier
+	Values asn1.RawValue // SET OF ANY
+}
+
+type certBag struct {
+	Id   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// Decode extracts a private key, the certificate for it and any other
+// certificates, usually its chain, from pfxData, a DER encoded PKCS#12
+// file protected by password. The file must hold exactly one private key,
+// which is an *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey.
+func Decode(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	keys, certs, err := DecodeAll(pfxData, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(keys) != 1 {
+		return nil, nil, nil, errors.New("pkcs12: expected exactly one private key")
+	}
+	privateKey = keys[0]
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, errors.New("pkcs12: unsupported private key type")
+	}
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, cert := range certs {
+		if certificate == nil && bytes.Equal(cert.RawSubjectPublicKeyInfo, pub) {
+			certificate = cert
+			continue
+		}
+		caCerts = append(caCerts, cert)
+	}
+	if certificate == nil {
+		return nil, nil, nil, errors.New("pkcs12: no certificate for the private key")
+	}
+	return privateKey, certificate, caCerts, nil
+}
+
+// DecodeAll extracts all the private keys and certificates from pfxData, a
+// DER encoded PKCS#12 file protected by password, in the order they appear
+// in the file.
+func DecodeAll(pfxData []byte, password string) (privateKeys []interface{}, certificates []*x509.Certificate, err error) {
+	bags, err := decodeSafeBags(pfxData, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, bag := range bags {
+		switch {
+		case bag.Id.Equal(oidCertBag):
+			var cb certBag
+			if err := unmarshal(bag.Value.Bytes, &cb); err != nil {
+				return nil, nil, err
+			}
+			if !cb.Id.Equal(oidCertTypeX509Certificate) {
+				return nil, nil, NotImplementedError("only X.509 certificates are supported")
+			}
+			cert, err := x509.ParseCertificate(cb.Data)
+			if err != nil {
+				return nil, nil, err
+			}
+			certificates = append(certificates, cert)
+
+		case bag.Id.Equal(oidKeyBag):
+			key, err := x509.ParsePKCS8PrivateKey(bag.Value.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			privateKeys = append(privateKeys, key)
+
+		case bag.Id.Equal(oidPKCS8ShroudedKeyBag):
+			var info encryptedPrivateKeyInfo
+			if err := unmarshal(bag.Value.Bytes, &info); err != nil {
+				return nil, nil, err
+			}
+			der, err := decrypt(info.Algorithm, info.EncryptedData, password)
+			if err != nil {
+				return nil, nil, err
+			}
+			key, err := x509.ParsePKCS8PrivateKey(der)
+			if err != nil {
+				return nil, nil, err
+			}
+			privateKeys = append(privateKeys, key)
+		}
+		// Other bag types, such as CRLs and secrets, are skipped.
+	}
+	return privateKeys, certificates, nil
+}
+
+// decodeSafeBags checks the integrity of pfxData and returns the safe bags
+// it holds, decrypting those that are encrypted.
+func decodeSafeBags(pfxData []byte, password string) ([]safeBag, error) {
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, NotImplementedError("only password-protected PFX is implemented")
+	}
+
+	var authSafeData []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &authSafeData); err != nil {
+		return nil, err
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) == 0 {
+		return nil, errors.New("pkcs12: no MAC in data")
+	}
+	if err := verifyMac(&pfx.MacData, authSafeData, password); err != nil {
+		return nil, err
+	}
+
+	var authSafe []contentInfo
+	if err := unmarshal(authSafeData, &authSafe); err != nil {
+		return nil, err
+	}
+
+	var bags []safeBag
+	for _, ci := range authSafe {
+		var data []byte
+		switch {
+		case ci.ContentType.Equal(oidDataContentType):
+			if err := unmarshal(ci.Content.Bytes, &data); err != nil {
+				return nil, err
+			}
+		case ci.ContentType.Equal(oidEncryptedDataContentType):
+			var ed encryptedData
+			if err := unmarshal(ci.Content.Bytes, &ed); err != nil {
+				return nil, err
+			}
+			if ed.Version != 0 {
+				return nil, NotImplementedError("only version 0 of EncryptedData is supported")
+			}
+			info := ed.EncryptedContentInfo
+			var err error
+			if data, err = decrypt(info.ContentEncryptionAlgorithm, info.EncryptedContent, password); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, NotImplementedError("only data and encryptedData content types are supported in authenticated safe")
+		}
+
+		var safeContents []safeBag
+		if err := unmarshal(data, &safeContents); err != nil {
+			return nil, err
+		}
+		bags = append(bags, safeContents...)
+	}
+	return bags, nil
+}
+
+// Encode produces a PKCS#12 file holding privateKey, its certificate and
+// caCerts, protected by password, which should be ASCII for compatibility
+// with other implementations.
+//
+// For compatibility with as many readers as possible, the key and the
+// certificates are encrypted with pbeWithSHAAnd3-KeyTripleDES-CBC and the
+// file's integrity is protected by HMAC-SHA1.
+func Encode(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, password string) (pfxData []byte, err error) {
+	if certificate == nil {
+		return nil, errors.New("pkcs12: a certificate for the private key is required")
+	}
+
+	// The key and its certificate are tied together by the hash of the
+	// certificate, as other implementations do.
+	localKeyID := sha1.Sum(certificate.Raw)
+	localKeyIDValue, err := asn1.Marshal(localKeyID[:])
+	if err != nil {
+		return nil, err
+	}
+	attributes := []pkcs12Attribute{{
+		Id:     oidLocalKeyID,
+		Values: asn1.RawValue{Tag: 17, IsCompound: true, Bytes: localKeyIDValue},
+	}}
+
+	var certBags []safeBag
+	for i, cert := range append([]*x509.Certificate{certificate}, caCerts...) {
+		bag, err := makeSafeBag(oidCertBag, certBag{oidCertTypeX509Certificate, cert.Raw})
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			bag.Attributes = attributes
+		}
+		certBags = append(certBags, bag)
+	}
+	certContents, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	certsInfo, err := makeEncryptedContentInfo(rand, certContents, password)
+	if err != nil {
+		return nil, err
+	}
+
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, encryptedKey, err := encrypt(rand, pkcs8Key, password)
+	if err != nil {
+		return nil, err
+	}
+	keyBag, err := makeSafeBag(oidPKCS8ShroudedKeyBag, encryptedPrivateKeyInfo{algorithm, encryptedKey})
+	if err != nil {
+		return nil, err
+	}
+	keyBag.Attributes = attributes
+	keyContents, err := asn1.Marshal([]safeBag{keyBag})
+	if err != nil {
+		return nil, err
+	}
+	keyInfo, err := makeDataContentInfo(keyContents)
+	if err != nil {
+		return nil, err
+	}
+
+	authSafeData, err := asn1.Marshal([]contentInfo{certsInfo, keyInfo})
+	if err != nil {
+		return nil, err
+	}
+	pfx := pfxPdu{Version: 3}
+	if pfx.AuthSafe, err = makeDataContentInfo(authSafeData); err != nil {
+		return nil, err
+	}
+	if pfx.MacData, err = computeMac(rand, authSafeData, password); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pfx)
+}
+
+// makeSafeBag returns a safe bag of type id holding value.
+func makeSafeBag(id asn1.ObjectIdentifier, value interface{}) (safeBag, error) {
+	bag := safeBag{Id: id}
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return bag, err
+	}
+	bag.Value = explicitTag(der)
+	return bag, nil
+}
+
+// makeDataContentInfo returns a data ContentInfo holding data.
+func makeDataContentInfo(data []byte) (contentInfo, error) {
+	der, err := asn1.Marshal(data)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidDataContentType, Content: explicitTag(der)}, nil
+}
+
+// makeEncryptedContentInfo returns an encryptedData ContentInfo holding
+// data encrypted with password.
+func makeEncryptedContentInfo(rand io.Reader, data []byte, password string) (contentInfo, error) {
+	algorithm, encrypted, err := encrypt(rand, data, password)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	der, err := asn1.Marshal(encryptedData{
+		Version: 0,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidDataContentType,
+			ContentEncryptionAlgorithm: algorithm,
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidEncryptedDataContentType, Content: explicitTag(der)}, nil
+}
+
+// explicitTag wraps der, a DER encoded value, in the context specific,
+// explicit tag 0 that PKCS#12 uses for ANY fields. The encoding/asn1
+// package ignores the tags of RawValue fields, so it's done by hand.
+func explicitTag(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// verifyMac checks the MAC of the authenticated safe, data.
+func verifyMac(md *macData, data []byte, password string) error {
+	h, ok := macHashes[md.Mac.Algorithm.Algorithm.String()]
+	if !ok {
+		return NotImplementedError("unknown digest algorithm: " + md.Mac.Algorithm.Algorithm.String())
+	}
+	if err := checkIterations(md.Iterations); err != nil {
+		return err
+	}
+	key := pbkdf(h, md.MacSalt, bmpString(password), md.Iterations, 3, h.Size())
+	mac := hmac.New(h.New, key)
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), md.Mac.Digest) {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+// computeMac returns the MacData for the authenticated safe, data.
+func computeMac(rand io.Reader, data []byte, password string) (macData, error) {
+	md := macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidSHA1,
+				Parameters: asn1.RawValue{Tag: 5},
+			},
+		},
+		MacSalt:    make([]byte, saltSize),
+		Iterations: iterations,
+	}
+	if _, err := io.ReadFull(rand, md.MacSalt); err != nil {
+		return md, errors.New("pkcs12: cannot generate salt: " + err.Error())
+	}
+	key := pbkdf(crypto.SHA1, md.MacSalt, bmpString(password), md.Iterations, 3, sha1.Size)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(data)
+	md.Mac.Digest = mac.Sum(nil)
+	return md, nil
+}
+
+// unmarshal parses the single DER encoded value in der into out.
+func unmarshal(der []byte, out interface{}) error {
+	rest, err := asn1.Unmarshal(der, out)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("pkcs12: trailing data found")
+	}
+	return nil
+}
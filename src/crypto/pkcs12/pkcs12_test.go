@@ -0,0 +1,266 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// The test files hold a P-256 key for "client" and its certificate, and the
+// "PKCS12 Test CA" certificate that signed it, protected by the password
+// "correct-horse". They were generated with OpenSSL 3.0 using:
+//   openssl pkcs12 -export -inkey leaf.key -in leaf.pem -certfile ca.pem [options]
+var testFiles = []struct {
+	name     string
+	options  string
+	contents string
+	withCA   bool
+}{
+	{
+		name:    "legacy",
+		options: "-legacy",
+		withCA:  true,
+		contents: `MIIE4gIBAzCCBKgGCSqGSIb3DQEHAaCCBJkEggSVMIIEkTCCA4cGCSqGSIb3DQEH
+BqCCA3gwggN0AgEAMIIDbQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQYwDgQIhx6g
+OGzwdisCAggAgIIDQA/soFhr7TRlJqSMUEa24E1BDzsDFzVZAl/o/Z0HQcEKjxAB
+xWSVdHogGQdjdpR3qV+E8DQx0UqJCRfUzZllp/56DK5ajId6A655TdtjVRtFjxK1
+GsZqzvD+AtV65W9tvhOaRUrbyWYSxc0yFS5tA5EXp3gikumfIXP7AzLeKJgQ3V+M
+07LHMXHRiJMK69FU0zGtkjePusJ9AUNZUcFpwRlbL8eMvkJEKo+4rL3I9lbIuyul
+3F3AjzKjCskcPZoZQ5GLIkPOe/ddRAFfeM/n/RHwQV1aLe4/z++BfgMvB05zuKpU
+FHsd8QEr7twPeX8fu6OAwoGwVFaoL9LqCcXuywrctljYYhbNvBJvomihi+WQvj3q
+J0Bj7F9CDDHVKaskSYI2FJ8O4gTO3W6dTowwU6p7U9uJFfcFb8f+f27erh4+ClfI
+2uWDc+4PjM5ruCOKfs2jG8ajdPXbXyQunKHDIjSH5wQUEmDlyPnajTktAmhv4IvB
+qHw6kmZXyHd+rmHZxeL8AP0bwK6KfHXcmL/d2qJ8FRixkowZG03ej1tT9xmPGR9t
+9SpTFSG6BWzWH381GNWQir5X6wPRE6ycY28ZbmvoEKjb0fofrb9MUgGEBv0DqROC
+1gpCtiJg/46xIBYYfngj/TXNX80HqPBXlfmQn9MeVPcr4JXmEN6n2NgGK3FDMHCk
+lluKyr1M82poM5Gj7sSbtV7J2AXGZWaNIk2AXzk86P++uIt3sU8o/pWaJeKpb93p
+onN8kdUmMYi6+zZ1EcG3Mi4nX961BIfiu7oH8GJ2atTv/VP3OnbwAhux+s02B6Ol
+ezfzFvoug24s5cniLDl9KP9a2ZL7LIkWiKh6zCgsUzQTMrbwJCoAF5AMPfiIWpJw
+VRJq1Fi+HDk2FBrEY2lsxaOGWY5m6SChy7QCK2VJ5rCxmMBN6iIPX5qE1bdz1glA
+eLUhauzE4346L9AHxHpEDsy/m4kUFoxbICApAysTbSDypjkwJoukM40vSL0R81tt
+zxEN0A2m7/IDlCb+TUDJTC4N5UMIIHF+si8dzzahAkxnYd/6TlHY6fl2n7NSZX7q
+CYAU/keDmU2WKo2J2lZ0cS5ydbVOEWRkCQ708IgwggECBgkqhkiG9w0BBwGggfQE
+gfEwge4wgesGCyqGSIb3DQEMCgECoIG0MIGxMBwGCiqGSIb3DQEMAQMwDgQIdD8x
+cJ5RdXACAggABIGQeJbRjYryNyLgdde+rZ8ZZulsJOUhMowfIW7yWxiwmUcxbDyU
+jA6qAXKP+O0UlNx6cOAui07257kgZ646IPv2tdPvcvuhS4kZcY2XyctjHOW2sZqW
+ur/DZcvKy8MSQa1X4Jw+x5HiC310h7xh1rFr66ft4l/QCHMkG/pqZ5fy7H8bDZDv
+ntQ4YawwcrHabEbsMSUwIwYJKoZIhvcNAQkVMRYEFLSQMvLMzFnuxjpjpU5dmvlr
+KZMxMDEwITAJBgUrDgMCGgUABBQY9PKlJX91ihyTXQPE6DluaG4itwQI0cT+3ogV
+rxECAggA
+`,
+	},
+	{
+		name:    "modern",
+		options: "",
+		withCA:  true,
+		contents: `MIIFbAIBAzCCBSIGCSqGSIb3DQEHAaCCBRMEggUPMIIFCzCCA8IGCSqGSIb3DQEH
+BqCCA7MwggOvAgEAMIIDqAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqG
+SIb3DQEFDDAcBAjGbMMqpnEeNwICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQME
+ASoEEA+ZjuD2p2ZqeT4o0BxD9DeAggNAz++3WPQBpRMXG4OCvRi4D6RXxgfiitVp
+Pnc1aMaD84fv4ayXdQdlcRdlovKdR2PoIcgjKuApqPIPcYAlmXuj77TQ+rQIpK/F
+yaxdF9KHqXsIM3udIDl22rR18lo5PRl4zPZ6Vaq9S5k8t9zZC4ShWYbbmjNJv0Pk
+SbQOOmyWskbOy1I+rDuxfPvyTyizGevQTA7QDA6fT6mk2QhP16tWoepd3nR9h7kT
+SQajubN6kp4a5vWWgtr3Oz6pxuU362aMjgb1fJ+FHZZ5nOMs3jCGH8iLCW+GqIlv
+8HZK2MVEGbOkfJYAv2XCjgtxlL3x6V71IVtjtZ3nTjAJ5NzZ6wAlUBXSElD/3y35
+zAA1XUSWPlBTP4Yl8pCzQjb9ZAqQh8zeyynkIhWjdR2Y+JfswKvyz9Lql7IsDcaI
+zc6rLfj4pLexlYepDeEqT4bXUVzElfwCoLtRXn/T/iK6d1bwSE92SjnclckCbewG
+Nj1n6mgoOZT3khkNpRbbBML2wAQbX9C1EfTDa+SEz9o6o5G/W+amuHvFDoUruPGm
+rUozOskO9RfwXC2ib0JKpKnK5lfnz/1gz82CR3BX/ccxLkif95eBaK1c/nut4CSn
+vKXF4uVbFR6ooZlzCQrPzl2m9HULs7448YvgJiYaP+eIoUA/8WzVKLfziLOB6RMv
+jfz/r7vDqkISrpItTQoAkh/+ZZuIKL/PTlBzqUO1CM4+prQg+HWqSR0oGrOf/cc8
+o3N18MFeSUG5//NJ3xgSRAOsnXXJL/f6Z6IaLBEd+Ti/jAIhCE/SCYshl8VicIE7
+H47DWtlYcTXHkSSimuUP2XayFU9QGA0+PW1dXN6b/OCxdy6SCt/Hpu0vItWZQOym
+foCbdCPj8Q824LhdtZq2wJtqyGYgiTlUehPzG2Uz//eSyCE500DsXFxT7/zu8Cws
+NEsu+XdprGVfg2logjGwfPSe0cEiM8waFNbD22sQ96+X9i4PKKct/by/vAJheCmE
+PwgN1MbYnudo/uJVpQCc3/VCCODcn3ipeknM6oI3/JPIh7Hf8JWPfNXrnfrAQwPD
+VeOJ3q1sBE9QWIOPsy6b32eNCbTSgDeY/1edUIpAwB2BSn1tM9XbyjCCAUEGCSqG
+SIb3DQEHAaCCATIEggEuMIIBKjCCASYGCyqGSIb3DQEMCgECoIHvMIHsMFcGCSqG
+SIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAhm96Ipo+kshgICCAAwDAYIKoZIhvcN
+AgkFADAdBglghkgBZQMEASoEENfR6oEd7p+0hL8SSpaENoAEgZD2DmV4HomhPTpR
+vdbVKrzolU4KbBTJC/tpvGE2xfa9/7ox2GKsvfJbCnNXaqgGDvMs7juCpOhQeOD6
+mNxd2NRJ0wXl724xadOagVKrSn5CTO9P7pdBbLwdkjHvLQCjDBcDzBtB7Mx2aWN5
+48EwiFc1KCsKhoOltr5hoXxM1c9zclDMyOTA1VmuTIjyHDoiKbkxJTAjBgkqhkiG
+9w0BCRUxFgQUtJAy8szMWe7GOmOlTl2a+WspkzEwQTAxMA0GCWCGSAFlAwQCAQUA
+BCAeLToqalkp59SAUvLCLmv3YCHZXDwUm4DJ/SAKjCK1+gQIOhuI9EhYMD8CAggA
+`,
+	},
+	{
+		name:    "rc4",
+		options: "-legacy -keypbe PBE-SHA1-RC4-128 -certpbe PBE-SHA1-RC2-128",
+		withCA:  false,
+		contents: `MIIDIwIBAzCCAukGCSqGSIb3DQEHAaCCAtoEggLWMIIC0jCCAc8GCSqGSIb3DQEH
+BqCCAcAwggG8AgEAMIIBtQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQUwDgQI1hHw
+s9IQMP8CAggAgIIBiMSQtQBP2c9wL8AnO59ys4tm+rK0tX+ypeEbWIeWc0CaChVS
+ceQHOvJ4SIAy8/dZQm7GNeuZlNdquVqpa/V5smUqgUUmy/UNRtEUvaBHK68+7gWp
+sKSdGzh0MyyqEzlnIFSNzgeuT/CuuGRghtQ33O0Ve7lq56Ac8OyAyNjzEpwD2xga
+FFHQbSPpWKTKvNP1Tz5v5kiKni8UAgdYWy8RzpKp5IPVLE0MaalNn5j8+kF8BMpz
+mfAu2rAJef3oj0UShHt2yV5rn0ed/HzxcZCf1WxjuBUn0glH543Cr+jFMfQbzrrf
+8rZioJkhpEfXc3SUJZhLx6yHigaACkVarAl1ApewLaF+3SJ5qp5SL4lPMeEbMEJ2
+fQU7TS3v1JPMv9yWQ+tCEG2joip43VCMrcOFnyZ7YMjUjob0j1Yy4TC8w4VlRU0M
+LDRj3wNmZ4afZeN9Du0KyQwxG2U/3BoklZVzee31zgEtmRgahsBDo2eKUWPedE2r
+nGfH9xfalYUE0CR8g/UCgmLVHdR5MIH8BgkqhkiG9w0BBwGgge4EgeswgegwgeUG
+CyqGSIb3DQEMCgECoIGuMIGrMBwGCiqGSIb3DQEMAQEwDgQIdacsfSqhNdcCAggA
+BIGKD54DnjpJ5SPXpkVXbhbQ6T8Qn8hmBSF10A4mleuBZbbj3Lf7HMYjsYPQ9wrH
+GC6oG45RylCFid5twPwe4OSAOpyTWyOMqw9yry1OUWbYZQJJ9oTj+oolE91Su8kU
+AYqerQ/OJO0GOZt3N9mHMwshzz4hBCJIlw90vVlQ5m6UsGL9sIjQmL2yG4QDMSUw
+IwYJKoZIhvcNAQkVMRYEFLSQMvLMzFnuxjpjpU5dmvlrKZMxMDEwITAJBgUrDgMC
+GgUABBRnJ2bCqtdeUaCucmBw3RUObF1fzwQIgkKAJgFkkhYCAggA
+`,
+	},
+	{
+		name:    "plain",
+		options: "-keypbe NONE -certpbe NONE -macalg sha512",
+		withCA:  false,
+		contents: `MIIC9QIBAzCCAosGCSqGSIb3DQEHAaCCAnwEggJ4MIICdDCCAZUGCSqGSIb3DQEH
+AaCCAYYEggGCMIIBfjCCAXoGCyqGSIb3DQEMCgEDoIIBQjCCAT4GCiqGSIb3DQEJ
+FgGgggEuBIIBKjCCASYwgc0CFGn6Q1yFrAXAcuqIjAKvP3kFi3jKMAoGCCqGSM49
+BAMCMBkxFzAVBgNVBAMMDlBLQ1MxMiBUZXN0IENBMCAXDTI2MTAxNjE4MDY0N1oY
+DzIxMjYwOTIyMTgwNjQ3WjARMQ8wDQYDVQQDDAZjbGllbnQwWTATBgcqhkjOPQIB
+BggqhkjOPQMBBwNCAARhwPpduE1GhteypvzTXp+z7SqWk08qMBI55acmxbJHycEC
+GVr80bZHM4T0c+Ar2OyX3pWPwvEScVNzSmAc1yn0MAoGCCqGSM49BAMCA0gAMEUC
+IQDP6nYDtuVn+Ny56XId+yf7vYmWfvciYPG+f5j8036ctgIgdajWV3hfPMclpz99
+6dU26GJ+hDtXsdB13gUlykyF91sxJTAjBgkqhkiG9w0BCRUxFgQUtJAy8szMWe7G
+OmOlTl2a+WspkzEwgdgGCSqGSIb3DQEHAaCBygSBxzCBxDCBwQYLKoZIhvcNAQwK
+AQGggYowgYcCAQAwEwYHKoZIzj0CAQYIKoZIzj0DAQcEbTBrAgEBBCBlXfW4lEyW
+NjILV4DTbMQbBtP38r4b5UNkF+LdKg5BqqFEA0IABGHA+l24TUaG17Km/NNen7Pt
+KpaTTyowEjnlpybFskfJwQIZWvzRtkczhPRz4CvY7JfelY/C8RJxU3NKYBzXKfQx
+JTAjBgkqhkiG9w0BCRUxFgQUtJAy8szMWe7GOmOlTl2a+WspkzEwYTBRMA0GCWCG
+SAFlAwQCAwUABEAf2jjLtSkP4ljJfDnty43ZZSpJLtuwXcVkKtRdCYZp/N+99OBv
+VUaEsD5wl2xEHf2Jswksk/L4QDd5wMPQehujBAiyTWJUfZU9cgICCAA=
+`,
+	},
+}
+
+const testPassword = "correct-horse"
+
+func TestDecode(t *testing.T) {
+	for _, test := range testFiles {
+		p12, _ := base64.StdEncoding.DecodeString(test.contents)
+		key, cert, caCerts, err := Decode(p12, testPassword)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if _, ok := key.(*ecdsa.PrivateKey); !ok {
+			t.Errorf("%s: got key of type %T, want *ecdsa.PrivateKey", test.name, key)
+		}
+		if cert.Subject.CommonName != "client" {
+			t.Errorf("%s: got certificate for %q, want \"client\"", test.name, cert.Subject.CommonName)
+		}
+		if !test.withCA {
+			if len(caCerts) != 0 {
+				t.Errorf("%s: got %d CA certificates, want none", test.name, len(caCerts))
+			}
+			continue
+		}
+		if len(caCerts) != 1 || caCerts[0].Subject.CommonName != "PKCS12 Test CA" {
+			t.Errorf("%s: got CA certificates %v, want the test CA", test.name, caCerts)
+			continue
+		}
+		if err := cert.CheckSignatureFrom(caCerts[0]); err != nil {
+			t.Errorf("%s: certificate not signed by the CA: %s", test.name, err)
+		}
+
+		if _, _, _, err := Decode(p12, "wrong"); err != ErrIncorrectPassword {
+			t.Errorf("%s: got error %v with the wrong password, want ErrIncorrectPassword", test.name, err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(testFiles[0].contents)
+	key, cert, caCerts, err := Decode(p12, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, password := range []string{"", "pässword"} {
+		encoded, err := Encode(rand.Reader, key, cert, caCerts, password)
+		if err != nil {
+			t.Fatalf("failed to encode: %s", err)
+		}
+		key2, cert2, caCerts2, err := Decode(encoded, password)
+		if err != nil {
+			t.Fatalf("failed to decode with password %q: %s", password, err)
+		}
+		if !reflect.DeepEqual(key2, key) {
+			t.Errorf("password %q: private key didn't round trip", password)
+		}
+		if !cert2.Equal(cert) || len(caCerts2) != 1 || !caCerts2[0].Equal(caCerts[0]) {
+			t.Errorf("password %q: certificates didn't round trip", password)
+		}
+		if _, _, _, err := Decode(encoded, "x"+password); err != ErrIncorrectPassword {
+			t.Errorf("password %q: got error %v with the wrong password, want ErrIncorrectPassword", password, err)
+		}
+	}
+
+	keys, certs, err := DecodeAll(p12, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || len(certs) != 2 {
+		t.Errorf("DecodeAll returned %d keys and %d certificates, want 1 and 2", len(keys), len(certs))
+	}
+}
+
+// Generated using:
+//   openssl kdf -keylen N -kdfopt digest:H -kdfopt pass:sesame
+//     -kdfopt hexsalt:SALT -kdfopt iter:ITER -kdfopt id:ID PKCS12KDF
+// which takes the password's bytes as they are, rather than as a BMPString.
+var pbkdfTests = []struct {
+	hash       crypto.Hash
+	salt       string
+	iterations int
+	id         byte
+	want       string
+}{
+	{crypto.SHA1, "0102030405060708", 2048, 1, "39fcf8e5fa18ffa2d2af81ba1997d7f8f1df3f1d71b316e2"},
+	{crypto.SHA512, "01020304050607080910", 3, 3, "4b9cf15645c2674087fcab5ed952fe8f3ff013b50606c15a3548eb9f07acff1ed10de160916ccca152da258086affc7be9635aeb1b60afd80b6edbcde01e7775f9a7bd079baf"},
+}
+
+func TestPBKDF(t *testing.T) {
+	for i, test := range pbkdfTests {
+		salt, _ := hex.DecodeString(test.salt)
+		want, _ := hex.DecodeString(test.want)
+		got := pbkdf(test.hash, salt, []byte("sesame"), test.iterations, test.id, len(want))
+		if !bytes.Equal(got, want) {
+			t.Errorf("#%d: got %x, want %x", i, got, want)
+		}
+	}
+
+	if got := bmpString("Beavis"); !bytes.Equal(got, []byte{0, 'B', 0, 'e', 0, 'a', 0, 'v', 0, 'i', 0, 's', 0, 0}) {
+		t.Errorf("got BMPString %x", got)
+	}
+}
+
+func TestIterationLimit(t *testing.T) {
+	const n = maxIterations + 1
+	params, err := asn1.Marshal(pbeParams{Salt: make([]byte, saltSize), Iterations: n})
+	if err != nil {
+		t.Fatal(err)
+	}
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: encryptionAlgorithm.oid, Parameters: asn1.RawValue{FullBytes: params}}
+	if _, err := decrypt(algorithm, make([]byte, 16), "sesame"); err == nil || err == ErrIncorrectPassword {
+		t.Errorf("decrypt with %d iterations: got %v, want an iteration count error", n, err)
+	}
+
+	md := &macData{
+		Mac:        digestInfo{Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1}},
+		MacSalt:    make([]byte, saltSize),
+		Iterations: n,
+	}
+	if err := verifyMac(md, nil, "sesame"); err == nil || err == ErrIncorrectPassword {
+		t.Errorf("verifyMac with %d iterations: got %v, want an iteration count error", n, err)
+	}
+}
@@ -38,6 +38,9 @@ const (
 	alertInappropriateFallback  alert = 86
 	alertUserCanceled           alert = 90
 	alertNoRenegotiation        alert = 100
+	alertMissingExtension       alert = 109
+	alertBadCertStatusResponse  alert = 113
+	alertCertificateRequired    alert = 116
 )
 
 var alertText = map[alert]string{
@@ -64,6 +67,9 @@ var alertText = map[alert]string{
 	alertInappropriateFallback:  "inappropriate fallback",
 	alertUserCanceled:           "user canceled",
 	alertNoRenegotiation:        "no renegotiation",
+	alertMissingExtension:       "missing extension",
+	alertBadCertStatusResponse:  "bad certificate status response",
+	alertCertificateRequired:    "certificate required",
 }
 
 func (e alert) String() string {
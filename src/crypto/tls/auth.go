@@ -0,0 +1,152 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"io"
+)
+
+// TLS 1.3 CertificateVerify signatures cover the transcript hash,
+// prefixed by 64 spaces and a context string that tells the server's
+// signatures from the client's. See RFC 8446, section 4.4.3.
+const (
+	serverSignatureContext = "TLS 1.3, server CertificateVerify\x00"
+	clientSignatureContext = "TLS 1.3, client CertificateVerify\x00"
+)
+
+var signaturePadding = bytes.Repeat([]byte{0x20}, 64)
+
+// signedMessageTLS13 returns the digest, under sigHash, of the content
+// signed by a TLS 1.3 CertificateVerify message. If sigHash is zero, as it
+// is for Ed25519, it returns the content itself.
+func signedMessageTLS13(sigHash crypto.Hash, context string, transcript hash.Hash) []byte {
+	if sigHash == 0 {
+		var b bytes.Buffer
+		b.Write(signaturePadding)
+		b.WriteString(context)
+		b.Write(transcript.Sum(nil))
+		return b.Bytes()
+	}
+	h := sigHash.New()
+	h.Write(signaturePadding)
+	io.WriteString(h, context)
+	h.Write(transcript.Sum(nil))
+	return h.Sum(nil)
+}
+
+// signatureSchemeTLS13 returns the TLS 1.3 signature scheme to use with
+// the given public key, provided the peer supports it, and the hash it
+// uses.
+func signatureSchemeTLS13(pub crypto.PublicKey, peerAlgs []signatureAndHash) (signatureAndHash, crypto.Hash, error) {
+	var want signatureAndHash
+	var sigHash crypto.Hash
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		// RSA-PSS with SHA-256 and a salt as long as the hash
+		// doesn't fit in keys smaller than 528 bits.
+		if (pub.N.BitLen()-1+7)/8 < 2*crypto.SHA256.Size()+2 {
+			return want, 0, errors.New("tls: RSA key too small for RSA-PSS")
+		}
+		want, sigHash = signatureAndHash{hashIntrinsic, signatureRSAPSSSHA256}, crypto.SHA256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			want, sigHash = signatureAndHash{hashSHA256, signatureECDSA}, crypto.SHA256
+		case elliptic.P384():
+			want, sigHash = signatureAndHash{hashSHA384, signatureECDSA}, crypto.SHA384
+		case elliptic.P521():
+			want, sigHash = signatureAndHash{hashSHA512, signatureECDSA}, crypto.SHA512
+		default:
+			return want, 0, errors.New("tls: unsupported elliptic curve in certificate")
+		}
+	case ed25519.PublicKey:
+		want = signatureAndHash{hashIntrinsic, signatureEd25519}
+	default:
+		return want, 0, errors.New("tls: unsupported certificate key type")
+	}
+	for _, alg := range peerAlgs {
+		if alg == want {
+			return want, sigHash, nil
+		}
+	}
+	return want, 0, errors.New("tls: peer doesn't support the certificate's signature algorithm")
+}
+
+// signTLS13 signs the digest of a TLS 1.3 CertificateVerify message, or
+// the message itself for Ed25519.
+func signTLS13(rand io.Reader, key crypto.Signer, sigAndHash signatureAndHash, sigHash crypto.Hash, digest []byte) ([]byte, error) {
+	var opts crypto.SignerOpts = sigHash
+	if sigAndHash == (signatureAndHash{hashIntrinsic, signatureRSAPSSSHA256}) {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: sigHash}
+	}
+	return key.Sign(rand, digest, opts)
+}
+
+// verifyTLS13 checks the signature of a TLS 1.3 CertificateVerify message
+// made by the owner of pub with the scheme sigAndHash.
+func verifyTLS13(pub crypto.PublicKey, sigAndHash signatureAndHash, context string, transcript hash.Hash, sig []byte) error {
+	supported := false
+	for _, alg := range supportedSignatureAlgorithmsTLS13 {
+		if alg == sigAndHash {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return errors.New("tls: peer used an unsupported signature algorithm")
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if sigAndHash != (signatureAndHash{hashIntrinsic, signatureRSAPSSSHA256}) {
+			return errors.New("tls: RSA key used with a non-PSS signature")
+		}
+		digest := signedMessageTLS13(crypto.SHA256, context, transcript)
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+		return rsa.VerifyPSS(pub, crypto.SHA256, digest, sig, opts)
+	case *ecdsa.PublicKey:
+		var sigHash crypto.Hash
+		switch sigAndHash.hash {
+		case hashSHA256:
+			sigHash = crypto.SHA256
+		case hashSHA384:
+			sigHash = crypto.SHA384
+		case hashSHA512:
+			sigHash = crypto.SHA512
+		default:
+			return errors.New("tls: ECDSA key used with a non-ECDSA signature")
+		}
+		ecdsaSig := new(ecdsaSignature)
+		if _, err := asn1.Unmarshal(sig, ecdsaSig); err != nil {
+			return err
+		}
+		if ecdsaSig.R.Sign() <= 0 || ecdsaSig.S.Sign() <= 0 {
+			return errors.New("ECDSA signature contained zero or negative values")
+		}
+		digest := signedMessageTLS13(sigHash, context, transcript)
+		if !ecdsa.Verify(pub, digest, ecdsaSig.R, ecdsaSig.S) {
+			return errors.New("ECDSA verification failure")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if sigAndHash != (signatureAndHash{hashIntrinsic, signatureEd25519}) {
+			return errors.New("tls: Ed25519 key used with a non-Ed25519 signature")
+		}
+		if !ed25519.Verify(pub, signedMessageTLS13(0, context, transcript), sig) {
+			return errors.New("tls: Ed25519 verification failure")
+		}
+		return nil
+	}
+	return errors.New("tls: unsupported certificate key type")
+}
@@ -22,6 +22,7 @@ const (
 	VersionTLS10 = 0x0301
 	VersionTLS11 = 0x0302
 	VersionTLS12 = 0x0303
+	VersionTLS13 = 0x0304
 )
 
 const (
@@ -46,18 +47,22 @@ const (
 
 // TLS handshake message types.
 const (
-	typeClientHello        uint8 = 1
-	typeServerHello        uint8 = 2
-	typeNewSessionTicket   uint8 = 4
-	typeCertificate        uint8 = 11
-	typeServerKeyExchange  uint8 = 12
-	typeCertificateRequest uint8 = 13
-	typeServerHelloDone    uint8 = 14
-	typeCertificateVerify  uint8 = 15
-	typeClientKeyExchange  uint8 = 16
-	typeFinished           uint8 = 20
-	typeCertificateStatus  uint8 = 22
-	typeNextProtocol       uint8 = 67 // Not IANA assigned
+	typeClientHello         uint8 = 1
+	typeServerHello         uint8 = 2
+	typeNewSessionTicket    uint8 = 4
+	typeEndOfEarlyData      uint8 = 5
+	typeEncryptedExtensions uint8 = 8
+	typeCertificate         uint8 = 11
+	typeServerKeyExchange   uint8 = 12
+	typeCertificateRequest  uint8 = 13
+	typeServerHelloDone     uint8 = 14
+	typeCertificateVerify   uint8 = 15
+	typeClientKeyExchange   uint8 = 16
+	typeFinished            uint8 = 20
+	typeCertificateStatus   uint8 = 22
+	typeKeyUpdate           uint8 = 24
+	typeNextProtocol        uint8 = 67  // Not IANA assigned
+	typeMessageHash         uint8 = 254 // synthetic message
 )
 
 // TLS compression types.
@@ -67,15 +72,23 @@ const (
 
 // TLS extension numbers
 const (
-	extensionServerName          uint16 = 0
-	extensionStatusRequest       uint16 = 5
-	extensionSupportedCurves     uint16 = 10
-	extensionSupportedPoints     uint16 = 11
-	extensionSignatureAlgorithms uint16 = 13
-	extensionALPN                uint16 = 16
-	extensionSessionTicket       uint16 = 35
-	extensionNextProtoNeg        uint16 = 13172 // not IANA assigned
-	extensionRenegotiationInfo   uint16 = 0xff01
+	extensionServerName             uint16 = 0
+	extensionStatusRequest          uint16 = 5
+	extensionSupportedCurves        uint16 = 10
+	extensionSupportedPoints        uint16 = 11
+	extensionSignatureAlgorithms    uint16 = 13
+	extensionALPN                   uint16 = 16
+	extensionSCT                    uint16 = 18 // RFC 6962, section 3.3.1
+	extensionSessionTicket          uint16 = 35
+	extensionPreSharedKey           uint16 = 41
+	extensionEarlyData              uint16 = 42
+	extensionSupportedVersions      uint16 = 43
+	extensionCookie                 uint16 = 44
+	extensionPSKModes               uint16 = 45
+	extensionCertificateAuthorities uint16 = 47
+	extensionKeyShare               uint16 = 51
+	extensionNextProtoNeg           uint16 = 13172 // not IANA assigned
+	extensionRenegotiationInfo      uint16 = 0xff01
 )
 
 // TLS signaling cipher suite values
@@ -91,6 +104,7 @@ const (
 	CurveP256 CurveID = 23
 	CurveP384 CurveID = 24
 	CurveP521 CurveID = 25
+	X25519    CurveID = 29
 )
 
 // TLS Elliptic Curve Point Formats
@@ -99,6 +113,28 @@ const (
 	pointFormatUncompressed uint8 = 0
 )
 
+// TLS 1.3 PSK key exchange modes (RFC 8446, section 4.2.9)
+const (
+	pskModeDHE uint8 = 1
+)
+
+// helloRetryRequestRandom is the random value of a ServerHello that is
+// actually a TLS 1.3 HelloRetryRequest. See RFC 8446, section 4.1.3.
+var helloRetryRequestRandom = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11,
+	0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e,
+	0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+// Servers that support TLS 1.3 but negotiate an older version end their
+// ServerHello random with one of these values, which TLS 1.3 clients
+// check to detect downgrade attacks. See RFC 8446, section 4.1.3.
+const (
+	downgradeCanaryTLS12 = "DOWNGRD\x01"
+	downgradeCanaryTLS11 = "DOWNGRD\x00"
+)
+
 // TLS CertificateStatusType (RFC 3546)
 const (
 	statusTypeOCSP uint8 = 1
@@ -123,6 +159,8 @@ const (
 const (
 	hashSHA1   uint8 = 2
 	hashSHA256 uint8 = 4
+	hashSHA384 uint8 = 5
+	hashSHA512 uint8 = 6
 )
 
 // Signature algorithms for TLS 1.2 (See RFC 5246, section A.4.1)
@@ -131,6 +169,15 @@ const (
 	signatureECDSA uint8 = 3
 )
 
+// TLS 1.3 names signature schemes with a uint16 (RFC 8446, section
+// 4.2.3). The ECDSA schemes keep the TLS 1.2 layout, but RSA-PSS and
+// Ed25519 are written as hashIntrinsic followed by a scheme-specific byte.
+const (
+	hashIntrinsic         uint8 = 8
+	signatureRSAPSSSHA256 uint8 = 4
+	signatureEd25519      uint8 = 7
+)
+
 // signatureAndHash mirrors the TLS 1.2, SignatureAndHashAlgorithm struct. See
 // RFC 5246, section A.4.1.
 type signatureAndHash struct {
@@ -146,6 +193,32 @@ var supportedSKXSignatureAlgorithms = []signatureAndHash{
 	{hashSHA1, signatureECDSA},
 }
 
+// supportedSignatureAlgorithmsTLS13 contains the signature schemes that
+// may be used in TLS 1.3 CertificateVerify messages, and that a client
+// offering TLS 1.3 advertises after supportedSKXSignatureAlgorithms.
+var supportedSignatureAlgorithmsTLS13 = []signatureAndHash{
+	{hashIntrinsic, signatureRSAPSSSHA256},
+	{hashSHA256, signatureECDSA},
+	{hashSHA384, signatureECDSA},
+	{hashSHA512, signatureECDSA},
+	{hashIntrinsic, signatureEd25519},
+}
+
+// supportedSignatureAlgorithmsWithTLS13 contains the signature and hash
+// algorithms that the code advertises in a ClientHello offering TLS 1.3:
+// those of supportedSKXSignatureAlgorithms followed by the remaining ones
+// of supportedSignatureAlgorithmsTLS13.
+var supportedSignatureAlgorithmsWithTLS13 = []signatureAndHash{
+	{hashSHA256, signatureRSA},
+	{hashSHA256, signatureECDSA},
+	{hashSHA1, signatureRSA},
+	{hashSHA1, signatureECDSA},
+	{hashIntrinsic, signatureRSAPSSSHA256},
+	{hashSHA384, signatureECDSA},
+	{hashSHA512, signatureECDSA},
+	{hashIntrinsic, signatureEd25519},
+}
+
 // supportedClientCertSignatureAlgorithms contains the signature and hash
 // algorithms that the code advertises as supported in a TLS 1.2
 // CertificateRequest.
@@ -154,17 +227,34 @@ var supportedClientCertSignatureAlgorithms = []signatureAndHash{
 	{hashSHA256, signatureECDSA},
 }
 
+// supportedClientCertSignatureAlgorithmsSHA384 is advertised instead with
+// cipher suites whose handshake hash, which client certificates sign, is
+// SHA-384.
+var supportedClientCertSignatureAlgorithmsSHA384 = []signatureAndHash{
+	{hashSHA384, signatureRSA},
+	{hashSHA384, signatureECDSA},
+}
+
 // ConnectionState records basic TLS details about the connection.
 type ConnectionState struct {
 	Version                    uint16                // TLS version used by the connection (e.g. VersionTLS12)
 	HandshakeComplete          bool                  // TLS handshake is complete
 	DidResume                  bool                  // connection resumes a previous TLS connection
+	EarlyDataAccepted          bool                  // TLS 1.3 early data was accepted (see Conn.SetEarlyData)
 	CipherSuite                uint16                // cipher suite in use (TLS_RSA_WITH_RC4_128_SHA, ...)
 	NegotiatedProtocol         string                // negotiated next protocol (from Config.NextProtos)
 	NegotiatedProtocolIsMutual bool                  // negotiated protocol was advertised by server
 	ServerName                 string                // server name requested by client, if any (server side only)
 	PeerCertificates           []*x509.Certificate   // certificate chain presented by remote peer
 	VerifiedChains             [][]*x509.Certificate // verified chains built from PeerCertificates
+	OCSPResponse               []byte                // stapled OCSP response from the server, if any (client side only)
+
+	// SignedCertificateTimestamps contains the SCTs for the server's
+	// certificate that it sent in the signed_certificate_timestamp
+	// extension, followed by those embedded in the certificate (client
+	// side only). The former are only requested if Config.VerifySCTs is
+	// set.
+	SignedCertificateTimestamps [][]byte
 
 	// TLSUnique contains the "tls-unique" channel binding value (see RFC
 	// 5929, section 3). For resumed sessions this value will be nil
@@ -195,6 +285,15 @@ type ClientSessionState struct {
 	cipherSuite        uint16              // Ciphersuite negotiated for the session
 	masterSecret       []byte              // MasterSecret generated by client on a full handshake
 	serverCertificates []*x509.Certificate // Certificate chain presented by the server
+	sessionID          []uint8             // Session ID to resume the session with, if the server issued no ticket
+
+	// The following are only used by TLS 1.3 sessions, for which
+	// masterSecret holds the pre-shared key.
+	receivedAt   time.Time // when the ticket was received
+	lifetime     uint32    // seconds the ticket can be used for
+	ageAdd       uint32    // obfuscates the ticket age sent to the server
+	maxEarlyData uint32    // zero unless the server accepts early data
+	alpnProtocol string    // protocol negotiated in the session
 }
 
 // ClientSessionCache is a cache of ClientSessionState objects that can be used
@@ -210,6 +309,26 @@ type ClientSessionCache interface {
 	Put(sessionKey string, cs *ClientSessionState)
 }
 
+// ServerSessionState contains the state needed by servers to resume TLS
+// sessions without session tickets.
+type ServerSessionState struct {
+	state []byte // serialized sessionState or sessionStateTLS13
+}
+
+// ServerSessionCache is a cache of ServerSessionState objects that can be
+// used by a server to resume TLS sessions without session tickets.
+// ServerSessionCache implementations should expect to be called
+// concurrently from different goroutines.
+type ServerSessionCache interface {
+	// Get searches for a ServerSessionState associated with the given
+	// session ID. On return, ok is true if one was found.
+	Get(sessionID string) (session *ServerSessionState, ok bool)
+
+	// Put adds the ServerSessionState to the cache with the given
+	// session ID.
+	Put(sessionID string, ss *ServerSessionState)
+}
+
 // ClientHelloInfo contains information from a ClientHello message in order to
 // guide certificate selection in the GetCertificate callback.
 type ClientHelloInfo struct {
@@ -301,8 +420,28 @@ type Config struct {
 	// This should be used only for testing.
 	InsecureSkipVerify bool
 
+	// VerifyOCSPStaple, if not nil, is called by a client during a full
+	// handshake with the OCSP response stapled by the server, which is
+	// nil if the server didn't staple one, the chains verified from
+	// the server's certificate (nil if InsecureSkipVerify is set), and
+	// the current time as given by Time. If it returns an error, the
+	// handshake is aborted. The VerifyStaple function in crypto/ocsp can
+	// be used to require a fresh response with a good status.
+	VerifyOCSPStaple func(staple []byte, verifiedChains [][]*x509.Certificate, now time.Time) error
+
+	// VerifySCTs, if not nil, makes a client request Signed Certificate
+	// Timestamps from the server, and is called during a full handshake
+	// with the SCTs for the server's certificate, as returned in
+	// ConnectionState, and the chains verified from it (nil if
+	// InsecureSkipVerify is set). If it returns an error, the handshake is
+	// aborted. The VerifySCTs method of x509.Certificate can be used to
+	// require SCTs from known Certificate Transparency logs.
+	VerifySCTs func(scts [][]byte, verifiedChains [][]*x509.Certificate) error
+
 	// CipherSuites is a list of supported cipher suites. If CipherSuites
 	// is nil, TLS uses a list of suites supported by the implementation.
+	// The TLS 1.3 cipher suites are always enabled and aren't affected
+	// by CipherSuites.
 	CipherSuites []uint16
 
 	// PreferServerCipherSuites controls whether the server selects the
@@ -317,7 +456,8 @@ type Config struct {
 
 	// SessionTicketKey is used by TLS servers to provide session
 	// resumption. See RFC 5077. If zero, it will be filled with
-	// random data before the first server handshake.
+	// random data before the first server handshake. It's ignored once
+	// SetSessionTicketKeys has been called.
 	//
 	// If multiple servers are terminating connections for the same host
 	// they should all have the same SessionTicketKey. If the
@@ -329,21 +469,56 @@ type Config struct {
 	// resumption.
 	ClientSessionCache ClientSessionCache
 
+	// ServerSessionCache is a cache of ServerSessionState entries that a
+	// server uses to resume sessions without session tickets, either
+	// because SessionTicketsDisabled is set or because a TLS 1.2 client
+	// doesn't support them. TLS 1.2 sessions are then resumed by session
+	// ID, and TLS 1.3 tickets only carry the ID of a cache entry. If nil,
+	// such sessions can't be resumed.
+	ServerSessionCache ServerSessionCache
+
 	// MinVersion contains the minimum SSL/TLS version that is acceptable.
 	// If zero, then SSLv3 is taken as the minimum.
 	MinVersion uint16
 
 	// MaxVersion contains the maximum SSL/TLS version that is acceptable.
-	// If zero, then the maximum version supported by this package is used,
-	// which is currently TLS 1.2.
+	// If zero, then TLS 1.2 is used as the maximum. TLS 1.3 must be
+	// enabled explicitly by setting MaxVersion to VersionTLS13.
 	MaxVersion uint16
 
+	// MaxEarlyData is the largest amount of TLS 1.3 early data (0-RTT),
+	// in bytes, that a server accepts from a client resuming a session.
+	// If zero, early data is rejected. Early data can be replayed by an
+	// attacker, so it should only be accepted from clients that use it
+	// for requests that are safe to repeat.
+	MaxEarlyData uint32
+
 	// CurvePreferences contains the elliptic curves that will be used in
 	// an ECDHE handshake, in preference order. If empty, the default will
 	// be used.
 	CurvePreferences []CurveID
 
 	serverInitOnce sync.Once // guards calling (*Config).serverInit
+
+	// mutex protects sessionTicketKeys.
+	mutex sync.RWMutex
+	// sessionTicketKeys contains zero or more ticket keys. If the length
+	// is zero, SessionTicketKey is used instead.
+	sessionTicketKeys []ticketKey
+}
+
+// ticketKey is the internal representation of a session ticket key.
+type ticketKey struct {
+	aesKey  [16]byte
+	hmacKey [16]byte
+}
+
+// ticketKeyFromBytes converts from the external representation of a session
+// ticket key, 32 random bytes, to a ticketKey.
+func ticketKeyFromBytes(b [32]byte) (key ticketKey) {
+	copy(key.aesKey[:], b[:16])
+	copy(key.hmacKey[:], b[16:])
+	return key
 }
 
 func (c *Config) serverInit() {
@@ -351,7 +526,13 @@ func (c *Config) serverInit() {
 		return
 	}
 
-	// If the key has already been set then we have nothing to do.
+	// If a key has already been set then we have nothing to do.
+	c.mutex.RLock()
+	keysSet := len(c.sessionTicketKeys) > 0
+	c.mutex.RUnlock()
+	if keysSet {
+		return
+	}
 	for _, b := range c.SessionTicketKey {
 		if b != 0 {
 			return
@@ -363,6 +544,41 @@ func (c *Config) serverInit() {
 	}
 }
 
+// ticketKeys returns the keys that session tickets are encrypted and
+// decrypted with. The first one encrypts new tickets.
+func (c *Config) ticketKeys() []ticketKey {
+	c.mutex.RLock()
+	// c.sessionTicketKeys is constant once created. SetSessionTicketKeys
+	// will only update it by replacing it with a new value.
+	keys := c.sessionTicketKeys
+	c.mutex.RUnlock()
+	if len(keys) == 0 {
+		keys = []ticketKey{ticketKeyFromBytes(c.SessionTicketKey)}
+	}
+	return keys
+}
+
+// SetSessionTicketKeys updates the session ticket keys for a server. The
+// first key will be used when creating new tickets, while all keys can be
+// used for decrypting tickets. A session resumed with a ticket under any
+// key but the first is given a fresh ticket. It is safe to call this
+// function while the server is running in order to rotate the session
+// ticket keys. The function will panic if keys is empty.
+func (c *Config) SetSessionTicketKeys(keys [][32]byte) {
+	if len(keys) == 0 {
+		panic("tls: keys must have at least one key")
+	}
+
+	newKeys := make([]ticketKey, len(keys))
+	for i, bytes := range keys {
+		newKeys[i] = ticketKeyFromBytes(bytes)
+	}
+
+	c.mutex.Lock()
+	c.sessionTicketKeys = newKeys
+	c.mutex.Unlock()
+}
+
 func (c *Config) rand() io.Reader {
 	r := c.Rand
 	if r == nil {
@@ -401,7 +617,34 @@ func (c *Config) maxVersion() uint16 {
 	return c.MaxVersion
 }
 
-var defaultCurvePreferences = []CurveID{CurveP256, CurveP384, CurveP521}
+// supportedVersions returns the protocol versions enabled by c, newest
+// first.
+func (c *Config) supportedVersions() []uint16 {
+	maxVersion := c.maxVersion()
+	if maxVersion > VersionTLS13 {
+		maxVersion = VersionTLS13
+	}
+	var versions []uint16
+	for v := maxVersion; v >= c.minVersion() && v >= VersionSSL30; v-- {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// mutualSupportedVersion returns the newest protocol version enabled by c
+// out of the ones listed in a supported_versions extension.
+func (c *Config) mutualSupportedVersion(peerVersions []uint16) (uint16, bool) {
+	for _, v := range c.supportedVersions() {
+		for _, peerVersion := range peerVersions {
+			if v == peerVersion {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+var defaultCurvePreferences = []CurveID{X25519, CurveP256, CurveP384, CurveP521}
 
 func (c *Config) curvePreferences() []CurveID {
 	if c == nil || len(c.CurvePreferences) == 0 {
@@ -488,14 +731,19 @@ func (c *Config) BuildNameToCertificate() {
 type Certificate struct {
 	Certificate [][]byte
 	// PrivateKey contains the private key corresponding to the public key
-	// in Leaf. For a server, this must be a *rsa.PrivateKey or
-	// *ecdsa.PrivateKey. For a client doing client authentication, this
-	// can be any type that implements crypto.Signer (which includes RSA
-	// and ECDSA private keys).
+	// in Leaf. For a server, this must be a *rsa.PrivateKey,
+	// *ecdsa.PrivateKey or, for TLS 1.3 only, an ed25519.PrivateKey. For a
+	// client doing client authentication, this can be any type that
+	// implements crypto.Signer (which includes RSA, ECDSA and Ed25519
+	// private keys).
 	PrivateKey crypto.PrivateKey
 	// OCSPStaple contains an optional OCSP response which will be served
 	// to clients that request it.
 	OCSPStaple []byte
+	// SignedCertificateTimestamps contains an optional list of Signed
+	// Certificate Timestamps which will be served to clients that request
+	// it.
+	SignedCertificateTimestamps [][]byte
 	// Leaf is the parsed form of the leaf certificate, which may be
 	// initialized using x509.ParseCertificate to reduce per-handshake
 	// processing for TLS clients doing client authentication. If nil, the
@@ -518,6 +766,60 @@ type handshakeMessage interface {
 // lruSessionCache is a ClientSessionCache implementation that uses an LRU
 // caching strategy.
 type lruSessionCache struct {
+	lruCache
+}
+
+// NewLRUClientSessionCache returns a ClientSessionCache with the given
+// capacity that uses an LRU strategy. If capacity is < 1, a default capacity
+// is used instead.
+func NewLRUClientSessionCache(capacity int) ClientSessionCache {
+	return &lruSessionCache{newLRUCache(capacity)}
+}
+
+// Put adds the provided (sessionKey, cs) pair to the cache.
+func (c *lruSessionCache) Put(sessionKey string, cs *ClientSessionState) {
+	c.put(sessionKey, cs)
+}
+
+// Get returns the ClientSessionState value associated with a given key. It
+// returns (nil, false) if no value is found.
+func (c *lruSessionCache) Get(sessionKey string) (*ClientSessionState, bool) {
+	if state, ok := c.get(sessionKey); ok {
+		return state.(*ClientSessionState), true
+	}
+	return nil, false
+}
+
+// lruServerSessionCache is a ServerSessionCache implementation that uses an
+// LRU caching strategy.
+type lruServerSessionCache struct {
+	lruCache
+}
+
+// NewLRUServerSessionCache returns a ServerSessionCache with the given
+// capacity that uses an LRU strategy. If capacity is < 1, a default capacity
+// is used instead.
+func NewLRUServerSessionCache(capacity int) ServerSessionCache {
+	return &lruServerSessionCache{newLRUCache(capacity)}
+}
+
+// Put adds the provided (sessionID, ss) pair to the cache.
+func (c *lruServerSessionCache) Put(sessionID string, ss *ServerSessionState) {
+	c.put(sessionID, ss)
+}
+
+// Get returns the ServerSessionState value associated with a given session
+// ID. It returns (nil, false) if no value is found.
+func (c *lruServerSessionCache) Get(sessionID string) (*ServerSessionState, bool) {
+	if state, ok := c.get(sessionID); ok {
+		return state.(*ServerSessionState), true
+	}
+	return nil, false
+}
+
+// lruCache is the LRU map from keys to session states behind the session
+// cache implementations.
+type lruCache struct {
 	sync.Mutex
 
 	m        map[string]*list.Element
@@ -527,39 +829,35 @@ type lruSessionCache struct {
 
 type lruSessionCacheEntry struct {
 	sessionKey string
-	state      *ClientSessionState
+	state      interface{}
 }
 
-// NewLRUClientSessionCache returns a ClientSessionCache with the given
-// capacity that uses an LRU strategy. If capacity is < 1, a default capacity
-// is used instead.
-func NewLRUClientSessionCache(capacity int) ClientSessionCache {
+func newLRUCache(capacity int) lruCache {
 	const defaultSessionCacheCapacity = 64
 
 	if capacity < 1 {
 		capacity = defaultSessionCacheCapacity
 	}
-	return &lruSessionCache{
+	return lruCache{
 		m:        make(map[string]*list.Element),
 		q:        list.New(),
 		capacity: capacity,
 	}
 }
 
-// Put adds the provided (sessionKey, cs) pair to the cache.
-func (c *lruSessionCache) Put(sessionKey string, cs *ClientSessionState) {
+func (c *lruCache) put(sessionKey string, state interface{}) {
 	c.Lock()
 	defer c.Unlock()
 
 	if elem, ok := c.m[sessionKey]; ok {
 		entry := elem.Value.(*lruSessionCacheEntry)
-		entry.state = cs
+		entry.state = state
 		c.q.MoveToFront(elem)
 		return
 	}
 
 	if c.q.Len() < c.capacity {
-		entry := &lruSessionCacheEntry{sessionKey, cs}
+		entry := &lruSessionCacheEntry{sessionKey, state}
 		c.m[sessionKey] = c.q.PushFront(entry)
 		return
 	}
@@ -568,14 +866,12 @@ func (c *lruSessionCache) Put(sessionKey string, cs *ClientSessionState) {
 	entry := elem.Value.(*lruSessionCacheEntry)
 	delete(c.m, entry.sessionKey)
 	entry.sessionKey = sessionKey
-	entry.state = cs
+	entry.state = state
 	c.q.MoveToFront(elem)
 	c.m[sessionKey] = elem
 }
 
-// Get returns the ClientSessionState value associated with a given key. It
-// returns (nil, false) if no value is found.
-func (c *lruSessionCache) Get(sessionKey string) (*ClientSessionState, bool) {
+func (c *lruCache) get(sessionKey string) (interface{}, bool) {
 	c.Lock()
 	defer c.Unlock()
 
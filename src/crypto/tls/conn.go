@@ -35,7 +35,8 @@ type Conn struct {
 	handshakeComplete bool
 	didResume         bool // whether this connection was a session resumption
 	cipherSuite       uint16
-	ocspResponse      []byte // stapled OCSP response
+	ocspResponse      []byte   // stapled OCSP response
+	scts              [][]byte // signed certificate timestamps from the server
 	peerCertificates  []*x509.Certificate
 	// verifiedChains contains the certificate chains that we built, as
 	// opposed to the ones presented by the server.
@@ -49,6 +50,20 @@ type Conn struct {
 	clientProtocol         string
 	clientProtocolFallback bool
 
+	// earlyData is the TLS 1.3 early data that a client sends with its
+	// ClientHello. See SetEarlyData.
+	earlyData         []byte
+	earlyDataAccepted bool
+	// skipEarlyData is the number of bytes of TLS 1.3 early data that a
+	// server which rejected it may still skip.
+	skipEarlyData int
+	// earlyDataServer holds the handshake state of a TLS 1.3 server that
+	// accepted early data, until the client's Finished message is read.
+	earlyDataServer *serverHandshakeStateTLS13
+	// resumptionSecret is the TLS 1.3 secret from which a client derives
+	// the pre-shared keys of the session tickets it receives.
+	resumptionSecret []byte
+
 	// input/output
 	in, out  halfConn     // in.Mutex < out.Mutex
 	rawInput *block       // raw input, right off the wire
@@ -107,6 +122,8 @@ type halfConn struct {
 	nextCipher interface{} // next encryption state
 	nextMac    macFunction // next MAC algorithm
 
+	trafficSecret []byte // current TLS 1.3 traffic secret
+
 	// used to save allocating a new buffer for each MAC.
 	inDigestBuf, outDigestBuf []byte
 }
@@ -147,6 +164,17 @@ func (hc *halfConn) changeCipherSpec() error {
 	return nil
 }
 
+// setTrafficSecret switches hc to the TLS 1.3 traffic keys derived from
+// secret.
+func (hc *halfConn) setTrafficSecret(suite *cipherSuiteTLS13, secret []byte) {
+	hc.trafficSecret = secret
+	key, iv := suite.trafficKey(secret)
+	hc.version = VersionTLS13
+	hc.cipher = suite.aead(key, iv)
+	hc.mac = nil
+	hc.resetSeq()
+}
+
 // incSeq increments the sequence number.
 func (hc *halfConn) incSeq() {
 	for i := 7; i >= 0; i-- {
@@ -254,12 +282,18 @@ func (hc *halfConn) decrypt(b *block) (ok bool, prefixLen int, alertValue alert)
 		case cipher.Stream:
 			c.XORKeyStream(payload, payload)
 		case cipher.AEAD:
-			explicitIVLen = 8
+			if hc.version >= VersionTLS13 {
+				return hc.decryptTLS13(b, c)
+			}
+			explicitIVLen = c.(aead).explicitNonceLen()
 			if len(payload) < explicitIVLen {
 				return false, 0, alertBadRecordMAC
 			}
-			nonce := payload[:8]
-			payload = payload[8:]
+			nonce := payload[:explicitIVLen]
+			if len(nonce) == 0 {
+				nonce = hc.seq[:]
+			}
+			payload = payload[explicitIVLen:]
 
 			var additionalData [13]byte
 			copy(additionalData[:], hc.seq[:])
@@ -334,6 +368,36 @@ func (hc *halfConn) decrypt(b *block) (ok bool, prefixLen int, alertValue alert)
 	return true, recordHeaderLen + explicitIVLen, 0
 }
 
+// decryptTLS13 decrypts a TLS 1.3 record, whose header covers the
+// encrypted length, and removes its padding. The content type hidden at
+// the end of the plaintext replaces the outer one in the record header.
+func (hc *halfConn) decryptTLS13(b *block, c cipher.AEAD) (ok bool, prefixLen int, alertValue alert) {
+	payload := b.data[recordHeaderLen:]
+	if recordType(b.data[0]) != recordTypeApplicationData || len(payload) < c.Overhead() {
+		return false, 0, alertBadRecordMAC
+	}
+	var additionalData [recordHeaderLen]byte
+	copy(additionalData[:], b.data[:recordHeaderLen])
+	payload, err := c.Open(payload[:0], hc.seq[:], payload, additionalData[:])
+	if err != nil {
+		return false, 0, alertBadRecordMAC
+	}
+	i := len(payload) - 1
+	for i >= 0 && payload[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return false, 0, alertUnexpectedMessage
+	}
+	b.data[0] = payload[i]
+	b.data[3] = byte(i >> 8)
+	b.data[4] = byte(i)
+	b.resize(recordHeaderLen + i)
+	hc.incSeq()
+
+	return true, recordHeaderLen, 0
+}
+
 // padToBlockSize calculates the needed padding block, if any, for a payload.
 // On exit, prefix aliases payload and extends to the end of the last full
 // block of payload. finalBlock is a fresh slice which contains the contents of
@@ -371,9 +435,25 @@ func (hc *halfConn) encrypt(b *block, explicitIVLen int) (bool, alert) {
 		case cipher.Stream:
 			c.XORKeyStream(payload, payload)
 		case cipher.AEAD:
+			if hc.version >= VersionTLS13 {
+				// The content type has been appended to the
+				// plaintext, and the header is the additional
+				// data.
+				payloadLen := len(b.data) - recordHeaderLen
+				b.resize(len(b.data) + c.Overhead())
+				n := len(b.data) - recordHeaderLen
+				b.data[3] = byte(n >> 8)
+				b.data[4] = byte(n)
+				payload := b.data[recordHeaderLen : recordHeaderLen+payloadLen]
+				c.Seal(payload[:0], hc.seq[:], payload, b.data[:recordHeaderLen])
+				break
+			}
 			payloadLen := len(b.data) - recordHeaderLen - explicitIVLen
 			b.resize(len(b.data) + c.Overhead())
 			nonce := b.data[recordHeaderLen : recordHeaderLen+explicitIVLen]
+			if len(nonce) == 0 {
+				nonce = hc.seq[:]
+			}
 			payload := b.data[recordHeaderLen+explicitIVLen:]
 			payload = payload[:payloadLen]
 
@@ -518,7 +598,7 @@ func (c *Conn) readRecord(want recordType) error {
 		c.sendAlert(alertInternalError)
 		return c.in.setErrorLocked(errors.New("tls: unknown record type requested"))
 	case recordTypeHandshake, recordTypeChangeCipherSpec:
-		if c.handshakeComplete {
+		if c.handshakeComplete && (want != recordTypeHandshake || c.vers < VersionTLS13) {
 			c.sendAlert(alertInternalError)
 			return c.in.setErrorLocked(errors.New("tls: handshake or ChangeCipherSpec requested after handshake complete"))
 		}
@@ -561,7 +641,8 @@ Again:
 
 	vers := uint16(b.data[1])<<8 | uint16(b.data[2])
 	n := int(b.data[3])<<8 | int(b.data[4])
-	if c.haveVers && vers != c.vers {
+	// TLS 1.3 records keep the TLS 1.2 version number.
+	if c.haveVers && c.vers < VersionTLS13 && vers != c.vers {
 		c.sendAlert(alertProtocolVersion)
 		return c.in.setErrorLocked(fmt.Errorf("tls: received record with version %x when expecting version %x", vers, c.vers))
 	}
@@ -595,11 +676,32 @@ Again:
 
 	// Process message.
 	b, c.rawInput = c.in.splitBlock(b, recordHeaderLen+n)
+	if c.vers >= VersionTLS13 && typ == recordTypeChangeCipherSpec {
+		// TLS 1.3 peers may send a plaintext ChangeCipherSpec for
+		// compatibility with middleboxes; it's ignored.
+		if n != 1 || b.data[recordHeaderLen] != 1 || (c.handshakeComplete && c.earlyDataServer == nil) {
+			c.in.freeBlock(b)
+			return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+		}
+		c.in.freeBlock(b)
+		goto Again
+	}
 	ok, off, err := c.in.decrypt(b)
+	if c.skipEarlyData > 0 && typ == recordTypeApplicationData && (!ok || c.in.cipher == nil) {
+		// A TLS 1.3 server that rejected early data skips the
+		// records that it can't decrypt, which are early data.
+		if c.skipEarlyData -= n; c.skipEarlyData >= 0 {
+			c.in.freeBlock(b)
+			goto Again
+		}
+	}
 	if !ok {
 		c.in.setErrorLocked(c.sendAlert(err))
+	} else if c.in.cipher != nil {
+		c.skipEarlyData = 0
 	}
 	b.off = off
+	typ = recordType(b.data[0])
 	data := b.data[b.off:]
 	if len(data) > maxPlaintext {
 		err := c.sendAlert(alertRecordOverflow)
@@ -651,7 +753,9 @@ Again:
 
 	case recordTypeHandshake:
 		// TODO(rsc): Should at least pick off connection close.
-		if typ != want {
+		if typ != want && !(c.handshakeComplete && c.vers >= VersionTLS13) {
+			// TLS 1.3 has post-handshake messages, which Read
+			// processes.
 			return c.in.setErrorLocked(c.sendAlert(alertNoRenegotiation))
 		}
 		c.hand.Write(data)
@@ -701,6 +805,9 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 		}
 		explicitIVLen := 0
 		explicitIVIsSeq := false
+		// TLS 1.3 records hide their content type at the end of the
+		// encrypted data.
+		tls13 := c.out.version >= VersionTLS13 && c.out.cipher != nil
 
 		var cbc cbcMode
 		if c.out.version >= VersionTLS11 {
@@ -709,9 +816,9 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 				explicitIVLen = cbc.BlockSize()
 			}
 		}
-		if explicitIVLen == 0 {
-			if _, ok := c.out.cipher.(cipher.AEAD); ok {
-				explicitIVLen = 8
+		if explicitIVLen == 0 && !tls13 {
+			if aead, ok := c.out.cipher.(aead); ok {
+				explicitIVLen = aead.explicitNonceLen()
 				// The AES-GCM construction in TLS has an
 				// explicit nonce so that the nonce can be
 				// random. However, the nonce is only 8 bytes
@@ -729,6 +836,9 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 			// greater than TLS 1.0 for the initial ClientHello.
 			vers = VersionTLS10
 		}
+		if tls13 || vers >= VersionTLS13 {
+			vers = VersionTLS12
+		}
 		b.data[1] = byte(vers >> 8)
 		b.data[2] = byte(vers)
 		b.data[3] = byte(m >> 8)
@@ -744,6 +854,11 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 			}
 		}
 		copy(b.data[recordHeaderLen+explicitIVLen:], data)
+		if tls13 {
+			b.data[0] = byte(recordTypeApplicationData)
+			b.resize(len(b.data) + 1)
+			b.data[len(b.data)-1] = byte(typ)
+		}
 		c.out.encrypt(b, explicitIVLen)
 		_, err = c.conn.Write(b.data)
 		if err != nil {
@@ -802,12 +917,28 @@ func (c *Conn) readHandshake() (interface{}, error) {
 	case typeServerHello:
 		m = new(serverHelloMsg)
 	case typeNewSessionTicket:
-		m = new(newSessionTicketMsg)
+		if c.vers >= VersionTLS13 {
+			m = new(newSessionTicketMsgTLS13)
+		} else {
+			m = new(newSessionTicketMsg)
+		}
+	case typeEndOfEarlyData:
+		m = new(endOfEarlyDataMsg)
+	case typeEncryptedExtensions:
+		m = new(encryptedExtensionsMsg)
 	case typeCertificate:
-		m = new(certificateMsg)
+		if c.vers >= VersionTLS13 {
+			m = new(certificateMsgTLS13)
+		} else {
+			m = new(certificateMsg)
+		}
 	case typeCertificateRequest:
-		m = &certificateRequestMsg{
-			hasSignatureAndHash: c.vers >= VersionTLS12,
+		if c.vers >= VersionTLS13 {
+			m = new(certificateRequestMsgTLS13)
+		} else {
+			m = &certificateRequestMsg{
+				hasSignatureAndHash: c.vers >= VersionTLS12,
+			}
 		}
 	case typeCertificateStatus:
 		m = new(certificateStatusMsg)
@@ -825,6 +956,8 @@ func (c *Conn) readHandshake() (interface{}, error) {
 		m = new(nextProtoMsg)
 	case typeFinished:
 		m = new(finishedMsg)
+	case typeKeyUpdate:
+		m = new(keyUpdateMsg)
 	default:
 		return nil, c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
 	}
@@ -905,6 +1038,11 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 				// Soft error, like EAGAIN
 				return 0, err
 			}
+			for c.hand.Len() > 0 && c.in.err == nil {
+				if err := c.handlePostHandshakeMessage(); err != nil {
+					return 0, err
+				}
+			}
 		}
 		if err := c.in.err; err != nil {
 			return 0, err
@@ -943,6 +1081,79 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 	return 0, io.ErrNoProgress
 }
 
+// handlePostHandshakeMessage processes a TLS 1.3 handshake message
+// received after the handshake.
+// c.in.Mutex <= L.
+func (c *Conn) handlePostHandshakeMessage() error {
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+
+	if hs := c.earlyDataServer; hs != nil {
+		// The early data is followed by the rest of the client's
+		// handshake.
+		if err := hs.readClientFinished(msg); err != nil {
+			return c.in.setErrorLocked(err)
+		}
+		c.earlyDataServer = nil
+		return nil
+	}
+
+	switch msg := msg.(type) {
+	case *newSessionTicketMsgTLS13:
+		if !c.isClient {
+			return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+		}
+		return c.handleNewSessionTicket(msg)
+	case *keyUpdateMsg:
+		return c.handleKeyUpdate(msg)
+	}
+	return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+}
+
+// handleKeyUpdate moves the reading side to the next traffic secret and,
+// if the peer asks for it, updates the writing side too. See RFC 8446,
+// section 4.6.3.
+// c.in.Mutex <= L.
+func (c *Conn) handleKeyUpdate(msg *keyUpdateMsg) error {
+	suite := mutualCipherSuiteTLS13(c.cipherSuite)
+	if suite == nil {
+		return c.in.setErrorLocked(c.sendAlert(alertInternalError))
+	}
+	c.in.setTrafficSecret(suite, suite.nextTrafficSecret(c.in.trafficSecret))
+
+	if msg.updateRequested {
+		c.out.Lock()
+		defer c.out.Unlock()
+		if _, err := c.writeRecord(recordTypeHandshake, new(keyUpdateMsg).marshal()); err != nil {
+			return c.out.setErrorLocked(err)
+		}
+		c.out.setTrafficSecret(suite, suite.nextTrafficSecret(c.out.trafficSecret))
+	}
+	return nil
+}
+
+// SetEarlyData sets data to be sent as TLS 1.3 early data (0-RTT) by a
+// client resuming a session whose server allows it. It must be called
+// before the handshake. Early data isn't sent again if the server
+// rejects it; ConnectionState reports whether it was accepted.
+//
+// Early data isn't protected against replay, so it must only be used
+// for requests that are safe to repeat.
+func (c *Conn) SetEarlyData(data []byte) error {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	if !c.isClient {
+		return errors.New("tls: SetEarlyData called on TLS server connection")
+	}
+	if c.handshakeComplete || c.handshakeErr != nil {
+		return errors.New("tls: SetEarlyData called after the handshake")
+	}
+	c.earlyData = data
+	return nil
+}
+
 // Close closes the connection.
 func (c *Conn) Close() error {
 	var alertErr error
@@ -996,8 +1207,11 @@ func (c *Conn) ConnectionState() ConnectionState {
 		state.CipherSuite = c.cipherSuite
 		state.PeerCertificates = c.peerCertificates
 		state.VerifiedChains = c.verifiedChains
+		state.OCSPResponse = c.ocspResponse
+		state.SignedCertificateTimestamps = c.scts
 		state.ServerName = c.serverName
-		if !c.didResume {
+		state.EarlyDataAccepted = c.earlyDataAccepted
+		if !c.didResume && c.vers < VersionTLS13 {
 			state.TLSUnique = c.firstFinished[:]
 		}
 	}
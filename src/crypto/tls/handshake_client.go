@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/subtle"
 	"crypto/x509"
@@ -16,6 +17,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"time"
 )
 
 type clientHandshakeState struct {
@@ -60,10 +62,30 @@ func (c *Conn) clientHandshake() error {
 		nextProtoNeg:        len(c.config.NextProtos) > 0,
 		secureRenegotiation: true,
 		alpnProtocols:       c.config.NextProtos,
+		scts:                c.config.VerifySCTs != nil,
+	}
+
+	offerTLS13 := hello.vers >= VersionTLS13
+	if offerTLS13 {
+		// TLS 1.3 is offered in the supported_versions extension,
+		// while the version field says TLS 1.2. See RFC 8446,
+		// section 4.2.1.
+		hello.vers = VersionTLS12
+		for _, v := range c.config.supportedVersions() {
+			if v >= VersionTLS10 {
+				hello.supportedVersions = append(hello.supportedVersions, v)
+			}
+		}
 	}
 
 	possibleCipherSuites := c.config.cipherSuites()
-	hello.cipherSuites = make([]uint16, 0, len(possibleCipherSuites))
+	hello.cipherSuites = make([]uint16, 0, len(cipherSuitesTLS13)+len(possibleCipherSuites))
+
+	if offerTLS13 {
+		for _, suite := range cipherSuitesTLS13 {
+			hello.cipherSuites = append(hello.cipherSuites, suite.id)
+		}
+	}
 
 NextCipherSuite:
 	for _, suiteId := range possibleCipherSuites {
@@ -91,6 +113,21 @@ NextCipherSuite:
 		hello.signatureAndHashes = supportedSKXSignatureAlgorithms
 	}
 
+	var ecdheParams ecdheParameters
+	if offerTLS13 {
+		hello.signatureAndHashes = supportedSignatureAlgorithmsWithTLS13
+		hello.pskModes = []uint8{pskModeDHE}
+
+		// Send a key share for the most preferred group only, in the
+		// hope that the server supports it too.
+		ecdheParams, err = generateECDHEParameters(c.config.rand(), hello.supportedCurves[0])
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		hello.keyShares = []keyShare{{group: ecdheParams.CurveID(), data: ecdheParams.PublicKey()}}
+	}
+
 	var session *ClientSessionState
 	var cacheKey string
 	sessionCache := c.config.ClientSessionCache
@@ -118,13 +155,26 @@ NextCipherSuite:
 
 			versOk := candidateSession.vers >= c.config.minVersion() &&
 				candidateSession.vers <= c.config.maxVersion()
+			if candidateSession.vers >= VersionTLS13 {
+				// TLS 1.3 tickets expire.
+				lifetime := time.Duration(candidateSession.lifetime) * time.Second
+				versOk = versOk && offerTLS13 &&
+					c.config.time().Sub(candidateSession.receivedAt) < lifetime
+			}
 			if versOk && cipherSuiteOk {
 				session = candidateSession
 			}
 		}
 	}
 
-	if session != nil {
+	var earlySecret []byte
+	if session != nil && session.vers >= VersionTLS13 {
+		earlySecret = c.offerPSK(hello, session)
+	} else if session != nil && len(session.sessionTicket) == 0 {
+		// The server issued no ticket, so the session is resumed by
+		// its ID.
+		hello.sessionId = session.sessionID
+	} else if session != nil {
 		hello.sessionTicket = session.sessionTicket
 		// A random session ID is used to detect when the
 		// server accepted the ticket and is resuming a session
@@ -138,6 +188,17 @@ NextCipherSuite:
 
 	c.writeRecord(recordTypeHandshake, hello.marshal())
 
+	if hello.earlyData {
+		suite := mutualCipherSuiteTLS13(session.cipherSuite)
+		transcript := suite.hash.New()
+		transcript.Write(hello.marshal())
+		earlyTrafficSecret := suite.deriveSecret(earlySecret, clientEarlyTrafficLabel, transcript)
+		c.out.setTrafficSecret(suite, earlyTrafficSecret)
+		if _, err := c.writeRecord(recordTypeApplicationData, c.earlyData); err != nil {
+			return err
+		}
+	}
+
 	msg, err := c.readHandshake()
 	if err != nil {
 		return err
@@ -148,8 +209,31 @@ NextCipherSuite:
 		return unexpectedMessageError(serverHello, msg)
 	}
 
+	if offerTLS13 && serverHello.supportedVersion != 0 {
+		if serverHello.supportedVersion != VersionTLS13 || serverHello.vers != VersionTLS12 {
+			c.sendAlert(alertIllegalParameter)
+			return fmt.Errorf("tls: server selected unsupported protocol version %x", serverHello.supportedVersion)
+		}
+		c.vers = VersionTLS13
+		c.haveVers = true
+
+		hs := &clientHandshakeStateTLS13{
+			c:           c,
+			hello:       hello,
+			serverHello: serverHello,
+			ecdheParams: ecdheParams,
+			session:     session,
+			earlySecret: earlySecret,
+		}
+		return hs.handshake()
+	}
+	if serverHello.supportedVersion != 0 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server sent an unsolicited supported_versions extension")
+	}
+
 	vers, ok := c.config.mutualVersion(serverHello.vers)
-	if !ok || vers < VersionTLS10 {
+	if !ok || vers < VersionTLS10 || vers > VersionTLS12 {
 		// TLS 1.0 is the minimum version supported as a client.
 		c.sendAlert(alertProtocolVersion)
 		return fmt.Errorf("tls: server selected unsupported protocol version %x", serverHello.vers)
@@ -157,6 +241,20 @@ NextCipherSuite:
 	c.vers = vers
 	c.haveVers = true
 
+	if offerTLS13 {
+		// A TLS 1.3 server that is made to negotiate an older version
+		// says so in its random. See RFC 8446, section 4.1.3.
+		canary := string(serverHello.random[24:])
+		if canary == downgradeCanaryTLS12 || canary == downgradeCanaryTLS11 {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: downgrade attempt detected, possibly due to a MitM attack or a broken middlebox")
+		}
+	}
+
+	if session != nil && session.vers >= VersionTLS13 {
+		session = nil
+	}
+
 	suite := mutualCipherSuite(c.config.cipherSuites(), serverHello.cipherSuite)
 	if suite == nil {
 		c.sendAlert(alertHandshakeFailure)
@@ -168,7 +266,7 @@ NextCipherSuite:
 		serverHello:  serverHello,
 		hello:        hello,
 		suite:        suite,
-		finishedHash: newFinishedHash(c.vers),
+		finishedHash: newFinishedHash(c.vers, suite),
 		session:      session,
 	}
 
@@ -235,46 +333,10 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 	}
 	hs.finishedHash.Write(certMsg.marshal())
 
-	certs := make([]*x509.Certificate, len(certMsg.certificates))
-	for i, asn1Data := range certMsg.certificates {
-		cert, err := x509.ParseCertificate(asn1Data)
-		if err != nil {
-			c.sendAlert(alertBadCertificate)
-			return errors.New("tls: failed to parse certificate from server: " + err.Error())
-		}
-		certs[i] = cert
-	}
-
-	if !c.config.InsecureSkipVerify {
-		opts := x509.VerifyOptions{
-			Roots:         c.config.RootCAs,
-			CurrentTime:   c.config.time(),
-			DNSName:       c.config.ServerName,
-			Intermediates: x509.NewCertPool(),
-		}
-
-		for i, cert := range certs {
-			if i == 0 {
-				continue
-			}
-			opts.Intermediates.AddCert(cert)
-		}
-		c.verifiedChains, err = certs[0].Verify(opts)
-		if err != nil {
-			c.sendAlert(alertBadCertificate)
-			return err
-		}
-	}
-
-	switch certs[0].PublicKey.(type) {
-	case *rsa.PublicKey, *ecdsa.PublicKey:
-		break
-	default:
-		c.sendAlert(alertUnsupportedCertificate)
-		return fmt.Errorf("tls: server's certificate contains an unsupported type of public key: %T", certs[0].PublicKey)
+	if err := c.verifyServerCertificate(certMsg.certificates); err != nil {
+		return err
 	}
-
-	c.peerCertificates = certs
+	certs := c.peerCertificates
 
 	if hs.serverHello.ocspStapling {
 		msg, err = c.readHandshake()
@@ -292,6 +354,12 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 			c.ocspResponse = cs.response
 		}
 	}
+	if err := c.verifyOCSPStaple(); err != nil {
+		return err
+	}
+	if err := c.verifySCTs(hs.serverHello.scts); err != nil {
+		return err
+	}
 
 	msg, err = c.readHandshake()
 	if err != nil {
@@ -457,7 +525,7 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 		c.writeRecord(recordTypeHandshake, certVerify.marshal())
 	}
 
-	hs.masterSecret = masterFromPreMasterSecret(c.vers, preMasterSecret, hs.hello.random, hs.serverHello.random)
+	hs.masterSecret = masterFromPreMasterSecret(c.vers, hs.suite, preMasterSecret, hs.hello.random, hs.serverHello.random)
 	return nil
 }
 
@@ -465,7 +533,7 @@ func (hs *clientHandshakeState) establishKeys() error {
 	c := hs.c
 
 	clientMAC, serverMAC, clientKey, serverKey, clientIV, serverIV :=
-		keysFromMasterSecret(c.vers, hs.masterSecret, hs.hello.random, hs.serverHello.random, hs.suite.macLen, hs.suite.keyLen, hs.suite.ivLen)
+		keysFromMasterSecret(c.vers, hs.suite, hs.masterSecret, hs.hello.random, hs.serverHello.random, hs.suite.macLen, hs.suite.keyLen, hs.suite.ivLen)
 	var clientCipher, serverCipher interface{}
 	var clientHash, serverHash macFunction
 	if hs.suite.cipher != nil {
@@ -562,11 +630,23 @@ func (hs *clientHandshakeState) readFinished(out []byte) error {
 }
 
 func (hs *clientHandshakeState) readSessionTicket() error {
+	c := hs.c
+
 	if !hs.serverHello.ticketSupported {
+		if len(hs.serverHello.sessionId) > 0 && !hs.serverResumedSession() {
+			// Without a ticket, the session can still be resumed by
+			// the ID the server gave it.
+			hs.session = &ClientSessionState{
+				sessionID:          hs.serverHello.sessionId,
+				vers:               c.vers,
+				cipherSuite:        hs.suite.id,
+				masterSecret:       hs.masterSecret,
+				serverCertificates: c.peerCertificates,
+			}
+		}
 		return nil
 	}
 
-	c := hs.c
 	msg, err := c.readHandshake()
 	if err != nil {
 		return err
@@ -612,6 +692,86 @@ func (hs *clientHandshakeState) sendFinished(out []byte) error {
 	return nil
 }
 
+// verifyServerCertificate parses and, unless InsecureSkipVerify is set,
+// verifies the certificate chain sent by the server, and records it in c.
+func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
+	certs := make([]*x509.Certificate, len(certificates))
+	for i, asn1Data := range certificates {
+		cert, err := x509.ParseCertificate(asn1Data)
+		if err != nil {
+			c.sendAlert(alertBadCertificate)
+			return errors.New("tls: failed to parse certificate from server: " + err.Error())
+		}
+		certs[i] = cert
+	}
+
+	if !c.config.InsecureSkipVerify {
+		opts := x509.VerifyOptions{
+			Roots:         c.config.RootCAs,
+			CurrentTime:   c.config.time(),
+			DNSName:       c.config.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+
+		for i, cert := range certs {
+			if i == 0 {
+				continue
+			}
+			opts.Intermediates.AddCert(cert)
+		}
+		var err error
+		c.verifiedChains, err = certs[0].Verify(opts)
+		if err != nil {
+			c.sendAlert(alertBadCertificate)
+			return err
+		}
+	}
+
+	switch certs[0].PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		break
+	case ed25519.PublicKey:
+		if c.vers < VersionTLS13 {
+			c.sendAlert(alertUnsupportedCertificate)
+			return errors.New("tls: server sent an Ed25519 certificate in a pre-TLS 1.3 handshake")
+		}
+	default:
+		c.sendAlert(alertUnsupportedCertificate)
+		return fmt.Errorf("tls: server's certificate contains an unsupported type of public key: %T", certs[0].PublicKey)
+	}
+
+	c.peerCertificates = certs
+	return nil
+}
+
+// verifyOCSPStaple passes the OCSP response stapled by the server, if any,
+// to Config.VerifyOCSPStaple.
+func (c *Conn) verifyOCSPStaple() error {
+	if c.config.VerifyOCSPStaple == nil {
+		return nil
+	}
+	if err := c.config.VerifyOCSPStaple(c.ocspResponse, c.verifiedChains, c.config.time()); err != nil {
+		c.sendAlert(alertBadCertStatusResponse)
+		return err
+	}
+	return nil
+}
+
+// verifySCTs records the SCTs for the server's certificate, those the
+// server sent followed by the embedded ones, and passes them to
+// Config.VerifySCTs.
+func (c *Conn) verifySCTs(scts [][]byte) error {
+	c.scts = append(scts[:len(scts):len(scts)], c.peerCertificates[0].SignedCertificateTimestamps...)
+	if c.config.VerifySCTs == nil {
+		return nil
+	}
+	if err := c.config.VerifySCTs(c.scts, c.verifiedChains); err != nil {
+		c.sendAlert(alertBadCertificate)
+		return err
+	}
+	return nil
+}
+
 // clientSessionCacheKey returns a key used to cache sessionTickets that could
 // be used to resume previously negotiated TLS sessions with a server.
 func clientSessionCacheKey(serverAddr net.Addr, config *Config) string {
@@ -401,6 +401,90 @@ func TestClientResumption(t *testing.T) {
 	testResumeState("WithoutSessionCache", false)
 }
 
+func TestSessionTicketKeyRotation(t *testing.T) {
+	serverConfig := &Config{
+		CipherSuites: []uint16{TLS_RSA_WITH_RC4_128_SHA},
+		Certificates: testConfig.Certificates,
+	}
+	clientConfig := &Config{
+		CipherSuites:       []uint16{TLS_RSA_WITH_RC4_128_SHA},
+		InsecureSkipVerify: true,
+		ClientSessionCache: NewLRUClientSessionCache(32),
+	}
+
+	testResumeState := func(test string, didResume bool) {
+		hs, err := testHandshake(clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %s", test, err)
+		}
+		if hs.DidResume != didResume {
+			t.Fatalf("%s resumed: %v, expected: %v", test, hs.DidResume, didResume)
+		}
+	}
+
+	var key1, key2, key3 [32]byte
+	for i := range key1 {
+		key1[i], key2[i], key3[i] = 1, 2, 3
+	}
+
+	serverConfig.SetSessionTicketKeys([][32]byte{key1})
+	testResumeState("Handshake", false)
+	testResumeState("Resume", true)
+
+	// A ticket under an old key is still accepted, and replaced with
+	// one under the new key.
+	serverConfig.SetSessionTicketKeys([][32]byte{key2, key1})
+	testResumeState("ResumeWithOldKey", true)
+	serverConfig.SetSessionTicketKeys([][32]byte{key2})
+	testResumeState("ResumeWithRenewedTicket", true)
+
+	serverConfig.SetSessionTicketKeys([][32]byte{key3})
+	testResumeState("UnknownKey", false)
+	testResumeState("ResumeAfterUnknownKey", true)
+}
+
+func TestServerSessionCache(t *testing.T) {
+	serverConfig := &Config{
+		CipherSuites:           []uint16{TLS_RSA_WITH_RC4_128_SHA},
+		Certificates:           testConfig.Certificates,
+		SessionTicketsDisabled: true,
+		ServerSessionCache:     NewLRUServerSessionCache(1),
+	}
+	clientConfig := &Config{
+		CipherSuites:       []uint16{TLS_RSA_WITH_RC4_128_SHA},
+		ServerName:         "example.golang",
+		InsecureSkipVerify: true,
+		ClientSessionCache: NewLRUClientSessionCache(32),
+	}
+
+	testResumeState := func(test string, didResume bool) {
+		hs, err := testHandshake(clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %s", test, err)
+		}
+		if hs.DidResume != didResume {
+			t.Fatalf("%s resumed: %v, expected: %v", test, hs.DidResume, didResume)
+		}
+	}
+
+	testResumeState("Handshake", false)
+	session, ok := clientConfig.ClientSessionCache.Get("example.golang")
+	if !ok || len(session.sessionTicket) != 0 || len(session.sessionID) != sessionIDLen {
+		t.Fatalf("client didn't store a session ID")
+	}
+	testResumeState("Resume", true)
+
+	// A session evicted from the server's cache can't be resumed.
+	if _, err := testHandshake(&Config{InsecureSkipVerify: true}, serverConfig); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	testResumeState("Evicted", false)
+	testResumeState("ResumeAfterEvicted", true)
+
+	serverConfig.ServerSessionCache = nil
+	testResumeState("WithoutServerSessionCache", false)
+}
+
 func TestLRUClientSessionCache(t *testing.T) {
 	// Initialize cache of capacity 4.
 	cache := NewLRUClientSessionCache(4)
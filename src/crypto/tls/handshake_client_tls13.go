@@ -0,0 +1,561 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/x509"
+	"errors"
+	"hash"
+	"time"
+)
+
+// clientHandshakeStateTLS13 contains details of a TLS 1.3 client handshake
+// in progress.
+type clientHandshakeStateTLS13 struct {
+	c           *Conn
+	hello       *clientHelloMsg
+	serverHello *serverHelloMsg
+	ecdheParams ecdheParameters
+	session     *ClientSessionState
+	earlySecret []byte
+
+	suite      *cipherSuiteTLS13
+	transcript hash.Hash
+	usingPSK   bool
+	sharedKey  []byte
+	certReq    *certificateRequestMsgTLS13
+
+	masterSecret          []byte
+	clientHandshakeSecret []byte
+	trafficSecret         []byte // client_application_traffic_secret_0
+}
+
+// offerPSK adds session, a TLS 1.3 session, to hello as a pre-shared key,
+// along with early data if possible, and returns the PSK's early secret.
+func (c *Conn) offerPSK(hello *clientHelloMsg, session *ClientSessionState) []byte {
+	suite := mutualCipherSuiteTLS13(session.cipherSuite)
+
+	ticketAge := uint32(c.config.time().Sub(session.receivedAt) / time.Millisecond)
+	hello.pskIdentities = []pskIdentity{{
+		label:               session.sessionTicket,
+		obfuscatedTicketAge: ticketAge + session.ageAdd,
+	}}
+	hello.pskBinders = [][]byte{make([]byte, suite.hash.Size())}
+
+	// The server only accepts early data with the protocol negotiated
+	// in the session.
+	alpnOK := session.alpnProtocol == ""
+	for _, proto := range hello.alpnProtocols {
+		if proto == session.alpnProtocol {
+			alpnOK = true
+		}
+	}
+	hello.earlyData = len(c.earlyData) > 0 && alpnOK &&
+		uint64(len(c.earlyData)) <= uint64(session.maxEarlyData)
+
+	earlySecret := suite.earlySecret(session.masterSecret)
+	binderKey := suite.deriveSecret(earlySecret, resumptionBinderLabel, nil)
+	transcript := suite.hash.New()
+	transcript.Write(hello.marshalWithoutBinders())
+	hello.updateBinders([][]byte{suite.finishedHash(binderKey, transcript)})
+
+	return earlySecret
+}
+
+func (hs *clientHandshakeStateTLS13) handshake() error {
+	c := hs.c
+
+	// For an overview of the TLS 1.3 handshake, see RFC 8446, section 2.
+	if err := hs.checkServerHelloOrHRR(); err != nil {
+		return err
+	}
+
+	hs.transcript = hs.suite.hash.New()
+	hs.transcript.Write(hs.hello.marshal())
+
+	if bytes.Equal(hs.serverHello.random, helloRetryRequestRandom) {
+		if err := hs.processHelloRetryRequest(); err != nil {
+			return err
+		}
+	}
+
+	hs.transcript.Write(hs.serverHello.marshal())
+
+	if err := hs.processServerHello(); err != nil {
+		return err
+	}
+	hs.establishHandshakeKeys()
+	if err := hs.readServerParameters(); err != nil {
+		return err
+	}
+	if err := hs.readServerCertificate(); err != nil {
+		return err
+	}
+	if err := hs.readServerFinished(); err != nil {
+		return err
+	}
+	if err := hs.sendClientCertificate(); err != nil {
+		return err
+	}
+	if err := hs.sendClientFinished(); err != nil {
+		return err
+	}
+
+	c.handshakeComplete = true
+	return nil
+}
+
+// checkServerHelloOrHRR does validity checks that apply to both
+// ServerHello and HelloRetryRequest messages.
+func (hs *clientHandshakeStateTLS13) checkServerHelloOrHRR() error {
+	c := hs.c
+
+	if hs.serverHello.compressionMethod != compressionNone {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected unsupported compression format")
+	}
+	if !bytes.Equal(hs.hello.sessionId, hs.serverHello.sessionId) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server did not echo the legacy session ID")
+	}
+
+	selectedSuite := mutualCipherSuiteTLS13(hs.serverHello.cipherSuite)
+	if hs.suite != nil && selectedSuite != hs.suite {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server changed cipher suite after a HelloRetryRequest")
+	}
+	if selectedSuite == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server chose an unconfigured cipher suite")
+	}
+	hs.suite = selectedSuite
+	c.cipherSuite = hs.suite.id
+
+	return nil
+}
+
+// processHelloRetryRequest handles the HelloRetryRequest in hs.serverHello,
+// sends a second ClientHello, and reads the ServerHello that follows.
+func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
+	c := hs.c
+
+	// The first ClientHello is replaced by its hash in the transcript.
+	restartTranscript(hs.transcript)
+	hs.transcript.Write(hs.serverHello.marshal())
+
+	hello := *hs.hello
+	hello.raw = nil
+	hello.cookie = hs.serverHello.cookie
+
+	if hs.serverHello.serverShare.group != 0 {
+		c.sendAlert(alertDecodeError)
+		return errors.New("tls: server sent a key share in a HelloRetryRequest")
+	}
+	if curveID := hs.serverHello.selectedGroup; curveID != 0 {
+		curveOK := false
+		for _, id := range hello.supportedCurves {
+			if id == curveID {
+				curveOK = true
+				break
+			}
+		}
+		if !curveOK {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server selected unsupported group")
+		}
+		if hs.ecdheParams.CurveID() == curveID {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server sent an unnecessary HelloRetryRequest")
+		}
+		params, err := generateECDHEParameters(c.config.rand(), curveID)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		hs.ecdheParams = params
+		hello.keyShares = []keyShare{{group: curveID, data: params.PublicKey()}}
+	} else if hello.cookie == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server sent an unnecessary HelloRetryRequest")
+	}
+
+	// Early data can't be sent after a HelloRetryRequest, and whatever
+	// was sent is skipped by the server.
+	if hello.earlyData {
+		hello.earlyData = false
+		c.out.cipher = nil
+	}
+
+	if len(hello.pskIdentities) > 0 {
+		pskSuite := mutualCipherSuiteTLS13(hs.session.cipherSuite)
+		if pskSuite.hash == hs.suite.hash {
+			// The binder now covers the HelloRetryRequest too.
+			binderKey := hs.suite.deriveSecret(hs.earlySecret, resumptionBinderLabel, nil)
+			withoutBinders := hello.marshalWithoutBinders()
+			hs.transcript.Write(withoutBinders)
+			hello.updateBinders([][]byte{hs.suite.finishedHash(binderKey, hs.transcript)})
+			hs.transcript.Write(hello.marshal()[len(withoutBinders):])
+		} else {
+			// The server can't select the PSK with this cipher
+			// suite, so don't offer it.
+			hello.pskIdentities = nil
+			hello.pskBinders = nil
+			hs.transcript.Write(hello.marshal())
+		}
+	} else {
+		hs.transcript.Write(hello.marshal())
+	}
+
+	hs.hello = &hello
+	c.writeRecord(recordTypeHandshake, hs.hello.marshal())
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	serverHello, ok := msg.(*serverHelloMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(serverHello, msg)
+	}
+	if bytes.Equal(serverHello.random, helloRetryRequestRandom) {
+		c.sendAlert(alertUnexpectedMessage)
+		return errors.New("tls: server sent two HelloRetryRequest messages")
+	}
+	if serverHello.supportedVersion != VersionTLS13 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server changed protocol version after a HelloRetryRequest")
+	}
+	hs.serverHello = serverHello
+
+	return hs.checkServerHelloOrHRR()
+}
+
+func (hs *clientHandshakeStateTLS13) processServerHello() error {
+	c := hs.c
+
+	if hs.serverHello.selectedGroup != 0 || hs.serverHello.cookie != nil {
+		c.sendAlert(alertDecodeError)
+		return errors.New("tls: server sent HelloRetryRequest extensions in a ServerHello")
+	}
+
+	if hs.serverHello.serverShare.group != hs.ecdheParams.CurveID() {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected unsupported group")
+	}
+	hs.sharedKey = hs.ecdheParams.SharedKey(hs.serverHello.serverShare.data)
+	if hs.sharedKey == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: invalid server key share")
+	}
+
+	if !hs.serverHello.selectedIdentityPresent {
+		return nil
+	}
+	if int(hs.serverHello.selectedIdentity) >= len(hs.hello.pskIdentities) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected an invalid PSK")
+	}
+	pskSuite := mutualCipherSuiteTLS13(hs.session.cipherSuite)
+	if pskSuite.hash != hs.suite.hash {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected an invalid PSK and cipher suite pair")
+	}
+	hs.usingPSK = true
+	c.didResume = true
+	c.peerCertificates = hs.session.serverCertificates
+
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) establishHandshakeKeys() {
+	c := hs.c
+
+	earlySecret := hs.earlySecret
+	if !hs.usingPSK {
+		earlySecret = hs.suite.earlySecret(nil)
+	}
+	handshakeSecret := hs.suite.handshakeSecret(earlySecret, hs.sharedKey)
+	hs.clientHandshakeSecret = hs.suite.deriveSecret(handshakeSecret, clientHandshakeTrafficLabel, hs.transcript)
+	serverSecret := hs.suite.deriveSecret(handshakeSecret, serverHandshakeTrafficLabel, hs.transcript)
+	c.in.setTrafficSecret(hs.suite, serverSecret)
+	// If early data was sent, it may still be going on.
+	if !hs.hello.earlyData {
+		c.out.setTrafficSecret(hs.suite, hs.clientHandshakeSecret)
+	}
+	hs.masterSecret = hs.suite.masterSecret(handshakeSecret)
+}
+
+func (hs *clientHandshakeStateTLS13) readServerParameters() error {
+	c := hs.c
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	encryptedExtensions, ok := msg.(*encryptedExtensionsMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(encryptedExtensions, msg)
+	}
+	hs.transcript.Write(encryptedExtensions.marshal())
+
+	if proto := encryptedExtensions.alpnProtocol; proto != "" {
+		protoOK := false
+		for _, p := range hs.hello.alpnProtocols {
+			if p == proto {
+				protoOK = true
+				break
+			}
+		}
+		if !protoOK {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server selected an unadvertised ALPN protocol")
+		}
+		c.clientProtocol = proto
+	}
+
+	if encryptedExtensions.earlyData {
+		if !hs.hello.earlyData {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server accepted early data that wasn't sent")
+		}
+		c.earlyDataAccepted = true
+	} else if hs.hello.earlyData {
+		c.out.setTrafficSecret(hs.suite, hs.clientHandshakeSecret)
+	}
+
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) readServerCertificate() error {
+	c := hs.c
+
+	// Only one of PSK and certificates are used at a time.
+	if hs.usingPSK {
+		return nil
+	}
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+
+	if certReq, ok := msg.(*certificateRequestMsgTLS13); ok {
+		hs.certReq = certReq
+		hs.transcript.Write(certReq.marshal())
+
+		if msg, err = c.readHandshake(); err != nil {
+			return err
+		}
+	}
+
+	certMsg, ok := msg.(*certificateMsgTLS13)
+	if !ok || len(certMsg.certificates) == 0 {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certMsg, msg)
+	}
+	hs.transcript.Write(certMsg.marshal())
+
+	if err := c.verifyServerCertificate(certMsg.certificates); err != nil {
+		return err
+	}
+	c.ocspResponse = certMsg.ocspStaple
+	if err := c.verifyOCSPStaple(); err != nil {
+		return err
+	}
+	if err := c.verifySCTs(certMsg.scts); err != nil {
+		return err
+	}
+
+	msg, err = c.readHandshake()
+	if err != nil {
+		return err
+	}
+	certVerify, ok := msg.(*certificateVerifyMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certVerify, msg)
+	}
+	pub := c.peerCertificates[0].PublicKey
+	if err := verifyTLS13(pub, certVerify.signatureAndHash, serverSignatureContext, hs.transcript, certVerify.signature); err != nil {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: invalid signature by the server certificate: " + err.Error())
+	}
+	hs.transcript.Write(certVerify.marshal())
+
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) readServerFinished() error {
+	c := hs.c
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	finished, ok := msg.(*finishedMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(finished, msg)
+	}
+	expected := hs.suite.finishedHash(c.in.trafficSecret, hs.transcript)
+	if !hmac.Equal(expected, finished.verifyData) {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: invalid server finished hash")
+	}
+	hs.transcript.Write(finished.marshal())
+
+	hs.trafficSecret = hs.suite.deriveSecret(hs.masterSecret, clientApplicationTrafficLabel, hs.transcript)
+	serverSecret := hs.suite.deriveSecret(hs.masterSecret, serverApplicationTrafficLabel, hs.transcript)
+	c.in.setTrafficSecret(hs.suite, serverSecret)
+
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) sendClientCertificate() error {
+	c := hs.c
+
+	if c.earlyDataAccepted {
+		endOfEarlyData := new(endOfEarlyDataMsg)
+		hs.transcript.Write(endOfEarlyData.marshal())
+		c.writeRecord(recordTypeHandshake, endOfEarlyData.marshal())
+		c.out.setTrafficSecret(hs.suite, hs.clientHandshakeSecret)
+	}
+
+	if hs.certReq == nil {
+		return nil
+	}
+
+	cert, sigAndHash, sigHash, err := hs.pickClientCertificate()
+	if err != nil {
+		return err
+	}
+
+	certMsg := new(certificateMsgTLS13)
+	if cert != nil {
+		certMsg.certificates = cert.Certificate
+	}
+	hs.transcript.Write(certMsg.marshal())
+	c.writeRecord(recordTypeHandshake, certMsg.marshal())
+
+	if cert == nil {
+		return nil
+	}
+
+	digest := signedMessageTLS13(sigHash, clientSignatureContext, hs.transcript)
+	sig, err := signTLS13(c.config.rand(), cert.PrivateKey.(crypto.Signer), sigAndHash, sigHash, digest)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to sign handshake: " + err.Error())
+	}
+	certVerify := &certificateVerifyMsg{
+		hasSignatureAndHash: true,
+		signatureAndHash:    sigAndHash,
+		signature:           sig,
+	}
+	hs.transcript.Write(certVerify.marshal())
+	c.writeRecord(recordTypeHandshake, certVerify.marshal())
+
+	return nil
+}
+
+// pickClientCertificate returns the first of the configured certificates
+// that can sign with an algorithm the server supports and, if the server
+// named certificate authorities, that was issued by one of them. It
+// returns a nil certificate if there is none.
+func (hs *clientHandshakeStateTLS13) pickClientCertificate() (*Certificate, signatureAndHash, crypto.Hash, error) {
+	c := hs.c
+
+findCert:
+	for i := range c.config.Certificates {
+		chain := &c.config.Certificates[i]
+		key, ok := chain.PrivateKey.(crypto.Signer)
+		if !ok {
+			continue
+		}
+		sigAndHash, sigHash, err := signatureSchemeTLS13(key.Public(), hs.certReq.signatureAndHashes)
+		if err != nil {
+			continue
+		}
+		if len(hs.certReq.certificateAuthorities) == 0 {
+			return chain, sigAndHash, sigHash, nil
+		}
+		for j, certData := range chain.Certificate {
+			x509Cert := chain.Leaf
+			if j != 0 || x509Cert == nil {
+				if x509Cert, err = x509.ParseCertificate(certData); err != nil {
+					c.sendAlert(alertInternalError)
+					return nil, sigAndHash, 0, errors.New("tls: failed to parse client certificate: " + err.Error())
+				}
+			}
+			for _, ca := range hs.certReq.certificateAuthorities {
+				if bytes.Equal(x509Cert.RawIssuer, ca) {
+					return chain, sigAndHash, sigHash, nil
+				}
+			}
+		}
+		continue findCert
+	}
+
+	return nil, signatureAndHash{}, 0, nil
+}
+
+func (hs *clientHandshakeStateTLS13) sendClientFinished() error {
+	c := hs.c
+
+	finished := &finishedMsg{
+		verifyData: hs.suite.finishedHash(c.out.trafficSecret, hs.transcript),
+	}
+	hs.transcript.Write(finished.marshal())
+	c.writeRecord(recordTypeHandshake, finished.marshal())
+
+	c.out.setTrafficSecret(hs.suite, hs.trafficSecret)
+	c.resumptionSecret = hs.suite.deriveSecret(hs.masterSecret, resumptionLabel, hs.transcript)
+
+	return nil
+}
+
+// handleNewSessionTicket stores a session ticket sent by a TLS 1.3 server
+// after the handshake in the client session cache.
+// c.in.Mutex <= L.
+func (c *Conn) handleNewSessionTicket(msg *newSessionTicketMsgTLS13) error {
+	if c.config.SessionTicketsDisabled || c.config.ClientSessionCache == nil {
+		return nil
+	}
+
+	// A zero lifetime tells the client to discard the ticket.
+	if msg.lifetime == 0 {
+		return nil
+	}
+	if time.Duration(msg.lifetime)*time.Second > maxSessionTicketLifetime {
+		return c.in.setErrorLocked(c.sendAlert(alertIllegalParameter))
+	}
+
+	suite := mutualCipherSuiteTLS13(c.cipherSuite)
+	if suite == nil || c.resumptionSecret == nil {
+		return c.in.setErrorLocked(c.sendAlert(alertInternalError))
+	}
+
+	session := &ClientSessionState{
+		sessionTicket:      msg.label,
+		vers:               c.vers,
+		cipherSuite:        c.cipherSuite,
+		masterSecret:       suite.resumptionPSK(c.resumptionSecret, msg.nonce),
+		serverCertificates: c.peerCertificates,
+		receivedAt:         c.config.time(),
+		lifetime:           msg.lifetime,
+		ageAdd:             msg.ageAdd,
+		maxEarlyData:       msg.maxEarlyData,
+		alpnProtocol:       c.clientProtocol,
+	}
+	cacheKey := clientSessionCacheKey(c.conn.RemoteAddr(), c.config)
+	c.config.ClientSessionCache.Put(cacheKey, session)
+
+	return nil
+}
@@ -23,6 +23,28 @@ type clientHelloMsg struct {
 	signatureAndHashes  []signatureAndHash
 	secureRenegotiation bool
 	alpnProtocols       []string
+	scts                bool
+
+	// TLS 1.3 extensions.
+	supportedVersions []uint16
+	keyShares         []keyShare
+	earlyData         bool
+	pskModes          []uint8
+	cookie            []byte
+	pskIdentities     []pskIdentity
+	pskBinders        [][]byte
+}
+
+// keyShare is a TLS 1.3 KeyShareEntry. See RFC 8446, section 4.2.8.
+type keyShare struct {
+	group CurveID
+	data  []byte
+}
+
+// pskIdentity is a TLS 1.3 PskIdentity. See RFC 8446, section 4.2.11.
+type pskIdentity struct {
+	label               []byte
+	obfuscatedTicketAge uint32
 }
 
 func (m *clientHelloMsg) equal(i interface{}) bool {
@@ -46,7 +68,15 @@ func (m *clientHelloMsg) equal(i interface{}) bool {
 		bytes.Equal(m.sessionTicket, m1.sessionTicket) &&
 		eqSignatureAndHashes(m.signatureAndHashes, m1.signatureAndHashes) &&
 		m.secureRenegotiation == m1.secureRenegotiation &&
-		eqStrings(m.alpnProtocols, m1.alpnProtocols)
+		eqStrings(m.alpnProtocols, m1.alpnProtocols) &&
+		m.scts == m1.scts &&
+		eqUint16s(m.supportedVersions, m1.supportedVersions) &&
+		eqKeyShares(m.keyShares, m1.keyShares) &&
+		m.earlyData == m1.earlyData &&
+		bytes.Equal(m.pskModes, m1.pskModes) &&
+		bytes.Equal(m.cookie, m1.cookie) &&
+		eqPSKIdentities(m.pskIdentities, m1.pskIdentities) &&
+		eqByteSlices(m.pskBinders, m1.pskBinders)
 }
 
 func (m *clientHelloMsg) marshal() []byte {
@@ -99,8 +129,16 @@ func (m *clientHelloMsg) marshal() []byte {
 		}
 		numExtensions++
 	}
+	if m.scts {
+		numExtensions++
+	}
 	if numExtensions > 0 {
 		extensionsLength += 4 * numExtensions
+	}
+	tls13Extensions := m.marshalTLS13Extensions()
+	extensionsLength += len(tls13Extensions)
+	hasExtensions := extensionsLength > 0 || numExtensions > 0
+	if hasExtensions {
 		length += 2 + extensionsLength
 	}
 
@@ -126,7 +164,7 @@ func (m *clientHelloMsg) marshal() []byte {
 	copy(z[1:], m.compressionMethods)
 
 	z = z[1+len(m.compressionMethods):]
-	if numExtensions > 0 {
+	if hasExtensions {
 		z[0] = byte(extensionsLength >> 8)
 		z[1] = byte(extensionsLength)
 		z = z[2:]
@@ -271,12 +309,110 @@ func (m *clientHelloMsg) marshal() []byte {
 		lengths[0] = byte(stringsLength >> 8)
 		lengths[1] = byte(stringsLength)
 	}
+	if m.scts {
+		// RFC 6962, section 3.3.1
+		z[0] = byte(extensionSCT >> 8)
+		z[1] = byte(extensionSCT)
+		// The length is always 0
+		z = z[4:]
+	}
+	copy(z, tls13Extensions)
 
 	m.raw = x
 
 	return x
 }
 
+// marshalTLS13Extensions returns the extensions that are only sent by
+// clients offering TLS 1.3. pre_shared_key comes last, as RFC 8446,
+// section 4.2.11 requires.
+func (m *clientHelloMsg) marshalTLS13Extensions() []byte {
+	var b []byte
+	if len(m.supportedVersions) > 0 {
+		d := []byte{uint8(2 * len(m.supportedVersions))}
+		for _, v := range m.supportedVersions {
+			d = appendUint16(d, v)
+		}
+		b = appendExtension(b, extensionSupportedVersions, d)
+	}
+	if len(m.keyShares) > 0 {
+		var d []byte
+		for _, ks := range m.keyShares {
+			d = appendUint16(d, uint16(ks.group))
+			d = appendUint16(d, uint16(len(ks.data)))
+			d = append(d, ks.data...)
+		}
+		b = appendExtension(b, extensionKeyShare, appendUint16Prefixed(nil, d))
+	}
+	if m.earlyData {
+		b = appendExtension(b, extensionEarlyData, nil)
+	}
+	if len(m.pskModes) > 0 {
+		d := append([]byte{uint8(len(m.pskModes))}, m.pskModes...)
+		b = appendExtension(b, extensionPSKModes, d)
+	}
+	if len(m.cookie) > 0 {
+		b = appendExtension(b, extensionCookie, appendUint16Prefixed(nil, m.cookie))
+	}
+	if len(m.pskIdentities) > 0 {
+		var identities, binders []byte
+		for _, psk := range m.pskIdentities {
+			identities = appendUint16Prefixed(identities, psk.label)
+			identities = appendUint32(identities, psk.obfuscatedTicketAge)
+		}
+		for _, binder := range m.pskBinders {
+			binders = append(binders, uint8(len(binder)))
+			binders = append(binders, binder...)
+		}
+		d := appendUint16Prefixed(nil, identities)
+		d = appendUint16Prefixed(d, binders)
+		b = appendExtension(b, extensionPreSharedKey, d)
+	}
+	return b
+}
+
+// bindersLength returns the length of the binders list, including its
+// length prefix, at the end of the marshaled message.
+func (m *clientHelloMsg) bindersLength() int {
+	if len(m.pskIdentities) == 0 {
+		return 0
+	}
+	n := 2
+	for _, binder := range m.pskBinders {
+		n += 1 + len(binder)
+	}
+	return n
+}
+
+// marshalWithoutBinders returns the marshaled message up to, but
+// excluding, the PSK binders, which is what the binders cover.
+func (m *clientHelloMsg) marshalWithoutBinders() []byte {
+	x := m.marshal()
+	return x[:len(x)-m.bindersLength()]
+}
+
+// updateBinders replaces the PSK binders of the marshaled message with
+// binders, which must be of the same lengths.
+func (m *clientHelloMsg) updateBinders(binders [][]byte) {
+	if len(binders) != len(m.pskBinders) {
+		panic("tls: internal error: wrong number of PSK binders")
+	}
+	for i, binder := range binders {
+		if len(binder) != len(m.pskBinders[i]) {
+			panic("tls: internal error: wrong length of PSK binder")
+		}
+	}
+	m.pskBinders = binders
+	if m.raw != nil {
+		z := m.raw[len(m.raw)-m.bindersLength()+2:]
+		for _, binder := range binders {
+			z[0] = uint8(len(binder))
+			copy(z[1:], binder)
+			z = z[1+len(binder):]
+		}
+	}
+}
+
 func (m *clientHelloMsg) unmarshal(data []byte) bool {
 	if len(data) < 42 {
 		return false
@@ -326,6 +462,14 @@ func (m *clientHelloMsg) unmarshal(data []byte) bool {
 	m.sessionTicket = nil
 	m.signatureAndHashes = nil
 	m.alpnProtocols = nil
+	m.scts = false
+	m.supportedVersions = nil
+	m.keyShares = nil
+	m.earlyData = false
+	m.pskModes = nil
+	m.cookie = nil
+	m.pskIdentities = nil
+	m.pskBinders = nil
 
 	if len(data) == 0 {
 		// ClientHello is optionally followed by extension data
@@ -453,6 +597,82 @@ func (m *clientHelloMsg) unmarshal(data []byte) bool {
 				m.alpnProtocols = append(m.alpnProtocols, string(d[:stringLen]))
 				d = d[stringLen:]
 			}
+		case extensionSCT:
+			if length != 0 {
+				return false
+			}
+			m.scts = true
+		case extensionSupportedVersions:
+			d, rest, ok := readUint8LengthPrefixed(data[:length])
+			if !ok || len(rest) != 0 || len(d) == 0 || len(d)%2 != 0 {
+				return false
+			}
+			for ; len(d) > 0; d = d[2:] {
+				m.supportedVersions = append(m.supportedVersions, uint16(d[0])<<8|uint16(d[1]))
+			}
+		case extensionKeyShare:
+			d, rest, ok := readUint16LengthPrefixed(data[:length])
+			if !ok || len(rest) != 0 {
+				return false
+			}
+			for len(d) > 0 {
+				if len(d) < 2 {
+					return false
+				}
+				var ks keyShare
+				ks.group = CurveID(d[0])<<8 | CurveID(d[1])
+				if ks.data, d, ok = readUint16LengthPrefixed(d[2:]); !ok || len(ks.data) == 0 {
+					return false
+				}
+				m.keyShares = append(m.keyShares, ks)
+			}
+		case extensionEarlyData:
+			if length != 0 {
+				return false
+			}
+			m.earlyData = true
+		case extensionPSKModes:
+			d, rest, ok := readUint8LengthPrefixed(data[:length])
+			if !ok || len(rest) != 0 {
+				return false
+			}
+			m.pskModes = d
+		case extensionCookie:
+			d, rest, ok := readUint16LengthPrefixed(data[:length])
+			if !ok || len(rest) != 0 || len(d) == 0 {
+				return false
+			}
+			m.cookie = d
+		case extensionPreSharedKey:
+			// RFC 8446, section 4.2.11
+			if len(data) != length {
+				// pre_shared_key must be the last extension.
+				return false
+			}
+			identities, rest, ok := readUint16LengthPrefixed(data)
+			if !ok || len(identities) == 0 {
+				return false
+			}
+			for len(identities) > 0 {
+				var psk pskIdentity
+				if psk.label, identities, ok = readUint16LengthPrefixed(identities); !ok || len(psk.label) == 0 || len(identities) < 4 {
+					return false
+				}
+				psk.obfuscatedTicketAge = uint32(identities[0])<<24 | uint32(identities[1])<<16 | uint32(identities[2])<<8 | uint32(identities[3])
+				identities = identities[4:]
+				m.pskIdentities = append(m.pskIdentities, psk)
+			}
+			binders, rest, ok := readUint16LengthPrefixed(rest)
+			if !ok || len(rest) != 0 || len(binders) == 0 {
+				return false
+			}
+			for len(binders) > 0 {
+				var binder []byte
+				if binder, binders, ok = readUint8LengthPrefixed(binders); !ok || len(binder) == 0 {
+					return false
+				}
+				m.pskBinders = append(m.pskBinders, binder)
+			}
 		}
 		data = data[length:]
 	}
@@ -473,6 +693,17 @@ type serverHelloMsg struct {
 	ticketSupported     bool
 	secureRenegotiation bool
 	alpnProtocol        string
+	scts                [][]byte
+
+	// TLS 1.3 extensions.
+	supportedVersion        uint16
+	serverShare             keyShare
+	selectedIdentityPresent bool
+	selectedIdentity        uint16
+	cookie                  []byte
+
+	// selectedGroup is the group asked for by a HelloRetryRequest.
+	selectedGroup CurveID
 }
 
 func (m *serverHelloMsg) equal(i interface{}) bool {
@@ -492,7 +723,15 @@ func (m *serverHelloMsg) equal(i interface{}) bool {
 		m.ocspStapling == m1.ocspStapling &&
 		m.ticketSupported == m1.ticketSupported &&
 		m.secureRenegotiation == m1.secureRenegotiation &&
-		m.alpnProtocol == m1.alpnProtocol
+		m.alpnProtocol == m1.alpnProtocol &&
+		eqByteSlices(m.scts, m1.scts) &&
+		m.supportedVersion == m1.supportedVersion &&
+		m.serverShare.group == m1.serverShare.group &&
+		bytes.Equal(m.serverShare.data, m1.serverShare.data) &&
+		m.selectedIdentityPresent == m1.selectedIdentityPresent &&
+		m.selectedIdentity == m1.selectedIdentity &&
+		bytes.Equal(m.cookie, m1.cookie) &&
+		m.selectedGroup == m1.selectedGroup
 }
 
 func (m *serverHelloMsg) marshal() []byte {
@@ -530,9 +769,20 @@ func (m *serverHelloMsg) marshal() []byte {
 		extensionsLength += 2 + 1 + alpnLen
 		numExtensions++
 	}
+	var sctList []byte
+	if len(m.scts) > 0 {
+		sctList = marshalSCTList(m.scts)
+		extensionsLength += len(sctList)
+		numExtensions++
+	}
 
 	if numExtensions > 0 {
 		extensionsLength += 4 * numExtensions
+	}
+	tls13Extensions := m.marshalTLS13Extensions()
+	extensionsLength += len(tls13Extensions)
+	hasExtensions := extensionsLength > 0 || numExtensions > 0
+	if hasExtensions {
 		length += 2 + extensionsLength
 	}
 
@@ -552,7 +802,7 @@ func (m *serverHelloMsg) marshal() []byte {
 	z[2] = uint8(m.compressionMethod)
 
 	z = z[3:]
-	if numExtensions > 0 {
+	if hasExtensions {
 		z[0] = byte(extensionsLength >> 8)
 		z[1] = byte(extensionsLength)
 		z = z[2:]
@@ -605,12 +855,44 @@ func (m *serverHelloMsg) marshal() []byte {
 		copy(z[7:], []byte(m.alpnProtocol))
 		z = z[7+alpnLen:]
 	}
+	if len(m.scts) > 0 {
+		z[0] = byte(extensionSCT >> 8)
+		z[1] = byte(extensionSCT)
+		z[2] = byte(len(sctList) >> 8)
+		z[3] = byte(len(sctList))
+		copy(z[4:], sctList)
+		z = z[4+len(sctList):]
+	}
+	copy(z, tls13Extensions)
 
 	m.raw = x
 
 	return x
 }
 
+// marshalTLS13Extensions returns the extensions that are only sent in
+// TLS 1.3 ServerHellos and HelloRetryRequests.
+func (m *serverHelloMsg) marshalTLS13Extensions() []byte {
+	var b []byte
+	if m.supportedVersion != 0 {
+		b = appendExtension(b, extensionSupportedVersions, appendUint16(nil, m.supportedVersion))
+	}
+	if m.selectedGroup != 0 {
+		b = appendExtension(b, extensionKeyShare, appendUint16(nil, uint16(m.selectedGroup)))
+	} else if m.serverShare.group != 0 {
+		d := appendUint16(nil, uint16(m.serverShare.group))
+		d = appendUint16Prefixed(d, m.serverShare.data)
+		b = appendExtension(b, extensionKeyShare, d)
+	}
+	if m.selectedIdentityPresent {
+		b = appendExtension(b, extensionPreSharedKey, appendUint16(nil, m.selectedIdentity))
+	}
+	if len(m.cookie) > 0 {
+		b = appendExtension(b, extensionCookie, appendUint16Prefixed(nil, m.cookie))
+	}
+	return b
+}
+
 func (m *serverHelloMsg) unmarshal(data []byte) bool {
 	if len(data) < 42 {
 		return false
@@ -636,6 +918,13 @@ func (m *serverHelloMsg) unmarshal(data []byte) bool {
 	m.ocspStapling = false
 	m.ticketSupported = false
 	m.alpnProtocol = ""
+	m.scts = nil
+	m.supportedVersion = 0
+	m.serverShare = keyShare{}
+	m.selectedIdentityPresent = false
+	m.selectedIdentity = 0
+	m.cookie = nil
+	m.selectedGroup = 0
 
 	if len(data) == 0 {
 		// ServerHello is optionally followed by extension data
@@ -706,6 +995,44 @@ func (m *serverHelloMsg) unmarshal(data []byte) bool {
 			}
 			d = d[1:]
 			m.alpnProtocol = string(d)
+		case extensionSCT:
+			scts, ok := parseSCTList(data[:length])
+			if !ok {
+				return false
+			}
+			m.scts = scts
+		case extensionSupportedVersions:
+			if length != 2 {
+				return false
+			}
+			m.supportedVersion = uint16(data[0])<<8 | uint16(data[1])
+		case extensionKeyShare:
+			if length < 2 {
+				return false
+			}
+			group := CurveID(data[0])<<8 | CurveID(data[1])
+			if length == 2 {
+				// A HelloRetryRequest only names a group.
+				m.selectedGroup = group
+				break
+			}
+			d, rest, ok := readUint16LengthPrefixed(data[2:length])
+			if !ok || len(rest) != 0 || len(d) == 0 {
+				return false
+			}
+			m.serverShare = keyShare{group, d}
+		case extensionPreSharedKey:
+			if length != 2 {
+				return false
+			}
+			m.selectedIdentityPresent = true
+			m.selectedIdentity = uint16(data[0])<<8 | uint16(data[1])
+		case extensionCookie:
+			d, rest, ok := readUint16LengthPrefixed(data[:length])
+			if !ok || len(rest) != 0 || len(d) == 0 {
+				return false
+			}
+			m.cookie = d
 		}
 		data = data[length:]
 	}
@@ -1376,6 +1703,562 @@ func (m *newSessionTicketMsg) unmarshal(data []byte) bool {
 	return true
 }
 
+// encryptedExtensionsMsg is the TLS 1.3 EncryptedExtensions message. See
+// RFC 8446, section 4.3.1.
+type encryptedExtensionsMsg struct {
+	raw          []byte
+	alpnProtocol string
+	earlyData    bool
+}
+
+func (m *encryptedExtensionsMsg) equal(i interface{}) bool {
+	m1, ok := i.(*encryptedExtensionsMsg)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		m.alpnProtocol == m1.alpnProtocol &&
+		m.earlyData == m1.earlyData
+}
+
+func (m *encryptedExtensionsMsg) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	var extensions []byte
+	if len(m.alpnProtocol) > 0 {
+		if len(m.alpnProtocol) >= 256 {
+			panic("invalid ALPN protocol")
+		}
+		d := append([]byte{uint8(len(m.alpnProtocol))}, m.alpnProtocol...)
+		extensions = appendExtension(extensions, extensionALPN, appendUint16Prefixed(nil, d))
+	}
+	if m.earlyData {
+		extensions = appendExtension(extensions, extensionEarlyData, nil)
+	}
+
+	m.raw = marshalHandshake(typeEncryptedExtensions, appendUint16Prefixed(nil, extensions))
+	return m.raw
+}
+
+func (m *encryptedExtensionsMsg) unmarshal(data []byte) bool {
+	m.raw = data
+	m.alpnProtocol = ""
+	m.earlyData = false
+
+	body, ok := parseHandshake(data)
+	if !ok {
+		return false
+	}
+	extensions, rest, ok := readUint16LengthPrefixed(body)
+	if !ok || len(rest) != 0 {
+		return false
+	}
+	for len(extensions) > 0 {
+		extension, d, ok := readExtension(&extensions)
+		if !ok {
+			return false
+		}
+		switch extension {
+		case extensionALPN:
+			protos, rest, ok := readUint16LengthPrefixed(d)
+			if !ok || len(rest) != 0 {
+				return false
+			}
+			proto, rest, ok := readUint8LengthPrefixed(protos)
+			if !ok || len(rest) != 0 || len(proto) == 0 {
+				return false
+			}
+			m.alpnProtocol = string(proto)
+		case extensionEarlyData:
+			if len(d) != 0 {
+				return false
+			}
+			m.earlyData = true
+		}
+	}
+
+	return true
+}
+
+// certificateMsgTLS13 is the TLS 1.3 Certificate message, which carries
+// extensions alongside each certificate. See RFC 8446, section 4.4.2.
+type certificateMsgTLS13 struct {
+	raw          []byte
+	certificates [][]byte
+	// ocspStaple is the OCSP response in the status_request extension of
+	// the first certificate, if any. See RFC 8446, section 4.4.2.1.
+	ocspStaple []byte
+	// scts are the SCTs in the signed_certificate_timestamp extension of
+	// the first certificate, if any.
+	scts [][]byte
+}
+
+func (m *certificateMsgTLS13) equal(i interface{}) bool {
+	m1, ok := i.(*certificateMsgTLS13)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		eqByteSlices(m.certificates, m1.certificates) &&
+		bytes.Equal(m.ocspStaple, m1.ocspStaple) &&
+		eqByteSlices(m.scts, m1.scts)
+}
+
+func (m *certificateMsgTLS13) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	var list []byte
+	for i, cert := range m.certificates {
+		list = appendUint24Prefixed(list, cert)
+		var extensions []byte
+		if i == 0 && len(m.ocspStaple) > 0 {
+			status := appendUint24Prefixed([]byte{statusTypeOCSP}, m.ocspStaple)
+			extensions = appendExtension(extensions, extensionStatusRequest, status)
+		}
+		if i == 0 && len(m.scts) > 0 {
+			extensions = appendExtension(extensions, extensionSCT, marshalSCTList(m.scts))
+		}
+		list = appendUint16Prefixed(list, extensions)
+	}
+	// The certificate_request_context is always empty as post-handshake
+	// authentication isn't supported.
+	body := appendUint24Prefixed([]byte{0}, list)
+
+	m.raw = marshalHandshake(typeCertificate, body)
+	return m.raw
+}
+
+func (m *certificateMsgTLS13) unmarshal(data []byte) bool {
+	m.raw = data
+	m.certificates = nil
+	m.ocspStaple = nil
+	m.scts = nil
+
+	body, ok := parseHandshake(data)
+	if !ok {
+		return false
+	}
+	context, body, ok := readUint8LengthPrefixed(body)
+	if !ok || len(context) != 0 {
+		return false
+	}
+	list, rest, ok := readUint24LengthPrefixed(body)
+	if !ok || len(rest) != 0 {
+		return false
+	}
+	for len(list) > 0 {
+		var cert, extensions []byte
+		if cert, list, ok = readUint24LengthPrefixed(list); !ok || len(cert) == 0 {
+			return false
+		}
+		if extensions, list, ok = readUint16LengthPrefixed(list); !ok {
+			return false
+		}
+		for len(extensions) > 0 {
+			extension, d, ok := readExtension(&extensions)
+			if !ok {
+				return false
+			}
+			// Only the extensions of the end-entity certificate are kept.
+			if len(m.certificates) > 0 {
+				continue
+			}
+			switch extension {
+			case extensionStatusRequest:
+				if len(d) == 0 || d[0] != statusTypeOCSP {
+					return false
+				}
+				staple, rest, ok := readUint24LengthPrefixed(d[1:])
+				if !ok || len(rest) != 0 || len(staple) == 0 {
+					return false
+				}
+				m.ocspStaple = staple
+			case extensionSCT:
+				if m.scts, ok = parseSCTList(d); !ok {
+					return false
+				}
+			}
+		}
+		m.certificates = append(m.certificates, cert)
+	}
+
+	return true
+}
+
+// certificateRequestMsgTLS13 is the TLS 1.3 CertificateRequest message.
+// See RFC 8446, section 4.3.2.
+type certificateRequestMsgTLS13 struct {
+	raw                    []byte
+	signatureAndHashes     []signatureAndHash
+	certificateAuthorities [][]byte
+}
+
+func (m *certificateRequestMsgTLS13) equal(i interface{}) bool {
+	m1, ok := i.(*certificateRequestMsgTLS13)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		eqSignatureAndHashes(m.signatureAndHashes, m1.signatureAndHashes) &&
+		eqByteSlices(m.certificateAuthorities, m1.certificateAuthorities)
+}
+
+func (m *certificateRequestMsgTLS13) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	var algs []byte
+	for _, sigAndHash := range m.signatureAndHashes {
+		algs = append(algs, sigAndHash.hash, sigAndHash.signature)
+	}
+	extensions := appendExtension(nil, extensionSignatureAlgorithms, appendUint16Prefixed(nil, algs))
+	if len(m.certificateAuthorities) > 0 {
+		var cas []byte
+		for _, ca := range m.certificateAuthorities {
+			cas = appendUint16Prefixed(cas, ca)
+		}
+		extensions = appendExtension(extensions, extensionCertificateAuthorities, appendUint16Prefixed(nil, cas))
+	}
+	body := appendUint16Prefixed([]byte{0}, extensions)
+
+	m.raw = marshalHandshake(typeCertificateRequest, body)
+	return m.raw
+}
+
+func (m *certificateRequestMsgTLS13) unmarshal(data []byte) bool {
+	m.raw = data
+	m.signatureAndHashes = nil
+	m.certificateAuthorities = nil
+
+	body, ok := parseHandshake(data)
+	if !ok {
+		return false
+	}
+	context, body, ok := readUint8LengthPrefixed(body)
+	if !ok || len(context) != 0 {
+		return false
+	}
+	extensions, rest, ok := readUint16LengthPrefixed(body)
+	if !ok || len(rest) != 0 {
+		return false
+	}
+	for len(extensions) > 0 {
+		extension, d, ok := readExtension(&extensions)
+		if !ok {
+			return false
+		}
+		switch extension {
+		case extensionSignatureAlgorithms:
+			algs, rest, ok := readUint16LengthPrefixed(d)
+			if !ok || len(rest) != 0 || len(algs) == 0 || len(algs)%2 != 0 {
+				return false
+			}
+			for ; len(algs) > 0; algs = algs[2:] {
+				m.signatureAndHashes = append(m.signatureAndHashes, signatureAndHash{algs[0], algs[1]})
+			}
+		case extensionCertificateAuthorities:
+			cas, rest, ok := readUint16LengthPrefixed(d)
+			if !ok || len(rest) != 0 {
+				return false
+			}
+			for len(cas) > 0 {
+				var ca []byte
+				if ca, cas, ok = readUint16LengthPrefixed(cas); !ok || len(ca) == 0 {
+					return false
+				}
+				m.certificateAuthorities = append(m.certificateAuthorities, ca)
+			}
+		}
+	}
+
+	// signature_algorithms is required.
+	return len(m.signatureAndHashes) > 0
+}
+
+// newSessionTicketMsgTLS13 is the TLS 1.3 NewSessionTicket message. See
+// RFC 8446, section 4.6.1.
+type newSessionTicketMsgTLS13 struct {
+	raw          []byte
+	lifetime     uint32
+	ageAdd       uint32
+	nonce        []byte
+	label        []byte
+	maxEarlyData uint32
+}
+
+func (m *newSessionTicketMsgTLS13) equal(i interface{}) bool {
+	m1, ok := i.(*newSessionTicketMsgTLS13)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		m.lifetime == m1.lifetime &&
+		m.ageAdd == m1.ageAdd &&
+		bytes.Equal(m.nonce, m1.nonce) &&
+		bytes.Equal(m.label, m1.label) &&
+		m.maxEarlyData == m1.maxEarlyData
+}
+
+func (m *newSessionTicketMsgTLS13) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	body := appendUint32(nil, m.lifetime)
+	body = appendUint32(body, m.ageAdd)
+	body = append(body, uint8(len(m.nonce)))
+	body = append(body, m.nonce...)
+	body = appendUint16Prefixed(body, m.label)
+	var extensions []byte
+	if m.maxEarlyData > 0 {
+		extensions = appendExtension(extensions, extensionEarlyData, appendUint32(nil, m.maxEarlyData))
+	}
+	body = appendUint16Prefixed(body, extensions)
+
+	m.raw = marshalHandshake(typeNewSessionTicket, body)
+	return m.raw
+}
+
+func (m *newSessionTicketMsgTLS13) unmarshal(data []byte) bool {
+	m.raw = data
+	m.maxEarlyData = 0
+
+	body, ok := parseHandshake(data)
+	if !ok || len(body) < 8 {
+		return false
+	}
+	m.lifetime = readUint32(body)
+	m.ageAdd = readUint32(body[4:])
+	if m.nonce, body, ok = readUint8LengthPrefixed(body[8:]); !ok {
+		return false
+	}
+	if m.label, body, ok = readUint16LengthPrefixed(body); !ok || len(m.label) == 0 {
+		return false
+	}
+	extensions, rest, ok := readUint16LengthPrefixed(body)
+	if !ok || len(rest) != 0 {
+		return false
+	}
+	for len(extensions) > 0 {
+		extension, d, ok := readExtension(&extensions)
+		if !ok {
+			return false
+		}
+		if extension == extensionEarlyData {
+			if len(d) != 4 {
+				return false
+			}
+			m.maxEarlyData = readUint32(d)
+		}
+	}
+
+	return true
+}
+
+// endOfEarlyDataMsg is the TLS 1.3 EndOfEarlyData message. See RFC 8446,
+// section 4.5.
+type endOfEarlyDataMsg struct{}
+
+func (m *endOfEarlyDataMsg) equal(i interface{}) bool {
+	_, ok := i.(*endOfEarlyDataMsg)
+	return ok
+}
+
+func (m *endOfEarlyDataMsg) marshal() []byte {
+	return marshalHandshake(typeEndOfEarlyData, nil)
+}
+
+func (m *endOfEarlyDataMsg) unmarshal(data []byte) bool {
+	return len(data) == 4
+}
+
+// keyUpdateMsg is the TLS 1.3 KeyUpdate message. See RFC 8446, section
+// 4.6.3.
+type keyUpdateMsg struct {
+	raw             []byte
+	updateRequested bool
+}
+
+func (m *keyUpdateMsg) equal(i interface{}) bool {
+	m1, ok := i.(*keyUpdateMsg)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		m.updateRequested == m1.updateRequested
+}
+
+func (m *keyUpdateMsg) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	var body [1]byte
+	if m.updateRequested {
+		body[0] = 1
+	}
+
+	m.raw = marshalHandshake(typeKeyUpdate, body[:])
+	return m.raw
+}
+
+func (m *keyUpdateMsg) unmarshal(data []byte) bool {
+	m.raw = data
+
+	body, ok := parseHandshake(data)
+	if !ok || len(body) != 1 {
+		return false
+	}
+	switch body[0] {
+	case 0:
+		m.updateRequested = false
+	case 1:
+		m.updateRequested = true
+	default:
+		return false
+	}
+
+	return true
+}
+
+// marshalHandshake returns a handshake message of type typ with the given
+// body.
+func marshalHandshake(typ uint8, body []byte) []byte {
+	x := make([]byte, 4, 4+len(body))
+	x[0] = typ
+	x[1] = uint8(len(body) >> 16)
+	x[2] = uint8(len(body) >> 8)
+	x[3] = uint8(len(body))
+	return append(x, body...)
+}
+
+// parseHandshake returns the body of the handshake message data, checking
+// its length.
+func parseHandshake(data []byte) (body []byte, ok bool) {
+	if len(data) < 4 {
+		return nil, false
+	}
+	length := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if len(data)-4 != length {
+		return nil, false
+	}
+	return data[4:], true
+}
+
+// marshalSCTList returns a SignedCertificateTimestampList holding scts. See
+// RFC 6962, section 3.3.
+func marshalSCTList(scts [][]byte) []byte {
+	var list []byte
+	for _, sct := range scts {
+		list = appendUint16Prefixed(list, sct)
+	}
+	return appendUint16Prefixed(nil, list)
+}
+
+// parseSCTList parses a non-empty SignedCertificateTimestampList.
+func parseSCTList(data []byte) ([][]byte, bool) {
+	list, rest, ok := readUint16LengthPrefixed(data)
+	if !ok || len(rest) != 0 || len(list) == 0 {
+		return nil, false
+	}
+	var scts [][]byte
+	for len(list) > 0 {
+		var sct []byte
+		if sct, list, ok = readUint16LengthPrefixed(list); !ok || len(sct) == 0 {
+			return nil, false
+		}
+		scts = append(scts, sct)
+	}
+	return scts, true
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, uint8(v>>8), uint8(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, uint8(v>>24), uint8(v>>16), uint8(v>>8), uint8(v))
+}
+
+func appendUint16Prefixed(b, v []byte) []byte {
+	b = appendUint16(b, uint16(len(v)))
+	return append(b, v...)
+}
+
+func appendUint24Prefixed(b, v []byte) []byte {
+	b = append(b, uint8(len(v)>>16), uint8(len(v)>>8), uint8(len(v)))
+	return append(b, v...)
+}
+
+func appendExtension(b []byte, extension uint16, data []byte) []byte {
+	b = appendUint16(b, extension)
+	return appendUint16Prefixed(b, data)
+}
+
+func readUint32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// readUint8LengthPrefixed splits data into a vector with a one byte
+// length and the data that follows it.
+func readUint8LengthPrefixed(data []byte) (v, rest []byte, ok bool) {
+	if len(data) < 1 {
+		return nil, nil, false
+	}
+	n := int(data[0])
+	if len(data) < 1+n {
+		return nil, nil, false
+	}
+	return data[1 : 1+n], data[1+n:], true
+}
+
+// readUint16LengthPrefixed is like readUint8LengthPrefixed for vectors
+// with a two byte length.
+func readUint16LengthPrefixed(data []byte) (v, rest []byte, ok bool) {
+	if len(data) < 2 {
+		return nil, nil, false
+	}
+	n := int(data[0])<<8 | int(data[1])
+	if len(data) < 2+n {
+		return nil, nil, false
+	}
+	return data[2 : 2+n], data[2+n:], true
+}
+
+// readUint24LengthPrefixed is like readUint8LengthPrefixed for vectors
+// with a three byte length.
+func readUint24LengthPrefixed(data []byte) (v, rest []byte, ok bool) {
+	if len(data) < 3 {
+		return nil, nil, false
+	}
+	n := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+	if len(data) < 3+n {
+		return nil, nil, false
+	}
+	return data[3 : 3+n], data[3+n:], true
+}
+
+// readExtension removes the first extension from *extensions and returns
+// its type and data.
+func readExtension(extensions *[]byte) (extension uint16, data []byte, ok bool) {
+	if len(*extensions) < 2 {
+		return 0, nil, false
+	}
+	extension = uint16((*extensions)[0])<<8 | uint16((*extensions)[1])
+	data, *extensions, ok = readUint16LengthPrefixed((*extensions)[2:])
+	return
+}
+
 func eqUint16s(x, y []uint16) bool {
 	if len(x) != len(y) {
 		return false
@@ -1436,3 +2319,27 @@ func eqSignatureAndHashes(x, y []signatureAndHash) bool {
 	}
 	return true
 }
+
+func eqKeyShares(x, y []keyShare) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i, v := range x {
+		if y[i].group != v.group || !bytes.Equal(y[i].data, v.data) {
+			return false
+		}
+	}
+	return true
+}
+
+func eqPSKIdentities(x, y []pskIdentity) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i, v := range x {
+		if y[i].obfuscatedTicketAge != v.obfuscatedTicketAge || !bytes.Equal(y[i].label, v.label) {
+			return false
+		}
+	}
+	return true
+}
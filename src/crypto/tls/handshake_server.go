@@ -7,6 +7,7 @@ package tls
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/subtle"
 	"crypto/x509"
@@ -26,6 +27,7 @@ type serverHandshakeState struct {
 	ellipticOk      bool
 	ecdsaOk         bool
 	sessionState    *sessionState
+	usedOldKey      bool // the session ticket was encrypted with an old key
 	finishedHash    finishedHash
 	masterSecret    []byte
 	certsFromClient [][]byte
@@ -40,10 +42,24 @@ func (c *Conn) serverHandshake() error {
 	// encrypt the tickets with.
 	config.serverInitOnce.Do(config.serverInit)
 
+	clientHello, err := c.readClientHello()
+	if err != nil {
+		return err
+	}
+
+	if c.vers >= VersionTLS13 {
+		hs := serverHandshakeStateTLS13{
+			c:           c,
+			clientHello: clientHello,
+		}
+		return hs.handshake()
+	}
+
 	hs := serverHandshakeState{
-		c: c,
+		c:           c,
+		clientHello: clientHello,
 	}
-	isResume, err := hs.readClientHello()
+	isResume, err := hs.processClientHello()
 	if err != nil {
 		return err
 	}
@@ -57,6 +73,9 @@ func (c *Conn) serverHandshake() error {
 		if err := hs.establishKeys(); err != nil {
 			return err
 		}
+		if err := hs.sendSessionTicket(); err != nil {
+			return err
+		}
 		if err := hs.sendFinished(c.firstFinished[:]); err != nil {
 			return err
 		}
@@ -76,6 +95,7 @@ func (c *Conn) serverHandshake() error {
 		if err := hs.readFinished(c.firstFinished[:]); err != nil {
 			return err
 		}
+		hs.cacheSession()
 		if err := hs.sendSessionTicket(); err != nil {
 			return err
 		}
@@ -88,31 +108,49 @@ func (c *Conn) serverHandshake() error {
 	return nil
 }
 
-// readClientHello reads a ClientHello message from the client and decides
-// whether we will perform session resumption.
-func (hs *serverHandshakeState) readClientHello() (isResume bool, err error) {
-	config := hs.c.config
-	c := hs.c
-
+// readClientHello reads a ClientHello message from the client and selects
+// the protocol version.
+func (c *Conn) readClientHello() (*clientHelloMsg, error) {
 	msg, err := c.readHandshake()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	var ok bool
-	hs.clientHello, ok = msg.(*clientHelloMsg)
+	clientHello, ok := msg.(*clientHelloMsg)
 	if !ok {
 		c.sendAlert(alertUnexpectedMessage)
-		return false, unexpectedMessageError(hs.clientHello, msg)
+		return nil, unexpectedMessageError(clientHello, msg)
 	}
-	c.vers, ok = config.mutualVersion(hs.clientHello.vers)
-	if !ok {
-		c.sendAlert(alertProtocolVersion)
-		return false, fmt.Errorf("tls: client offered an unsupported, maximum protocol version of %x", hs.clientHello.vers)
+
+	if len(clientHello.supportedVersions) > 0 && c.config.maxVersion() >= VersionTLS13 {
+		// Clients that offer TLS 1.3 list their versions in the
+		// supported_versions extension. See RFC 8446, section 4.2.1.
+		c.vers, ok = c.config.mutualSupportedVersion(clientHello.supportedVersions)
+		if !ok {
+			c.sendAlert(alertProtocolVersion)
+			return nil, fmt.Errorf("tls: client offered only unsupported protocol versions %x", clientHello.supportedVersions)
+		}
+	} else {
+		c.vers, ok = c.config.mutualVersion(clientHello.vers)
+		if !ok {
+			c.sendAlert(alertProtocolVersion)
+			return nil, fmt.Errorf("tls: client offered an unsupported, maximum protocol version of %x", clientHello.vers)
+		}
+		if c.vers > VersionTLS12 {
+			// TLS 1.3 can only be negotiated with
+			// supported_versions.
+			c.vers = VersionTLS12
+		}
 	}
 	c.haveVers = true
 
-	hs.finishedHash = newFinishedHash(c.vers)
-	hs.finishedHash.Write(hs.clientHello.marshal())
+	return clientHello, nil
+}
+
+// processClientHello processes the ClientHello message from the client and
+// decides whether we will perform session resumption.
+func (hs *serverHandshakeState) processClientHello() (isResume bool, err error) {
+	config := hs.c.config
+	c := hs.c
 
 	hs.hello = new(serverHelloMsg)
 
@@ -158,6 +196,14 @@ Curves:
 		c.sendAlert(alertInternalError)
 		return false, err
 	}
+	if config.maxVersion() >= VersionTLS13 {
+		// Let TLS 1.3 clients detect that they've been downgraded.
+		if c.vers == VersionTLS12 {
+			copy(hs.hello.random[24:], downgradeCanaryTLS12)
+		} else {
+			copy(hs.hello.random[24:], downgradeCanaryTLS11)
+		}
+	}
 	hs.hello.secureRenegotiation = hs.clientHello.secureRenegotiation
 	hs.hello.compressionMethod = compressionNone
 	if len(hs.clientHello.serverName) > 0 {
@@ -198,6 +244,10 @@ Curves:
 		}
 	}
 
+	if _, ok := hs.cert.PrivateKey.(ed25519.PrivateKey); ok {
+		c.sendAlert(alertHandshakeFailure)
+		return false, errors.New("tls: Ed25519 certificates require TLS 1.3")
+	}
 	_, hs.ecdsaOk = hs.cert.PrivateKey.(*ecdsa.PrivateKey)
 
 	if hs.checkForResumption() {
@@ -208,6 +258,9 @@ Curves:
 	if c.config.PreferServerCipherSuites {
 		preferenceList = c.config.cipherSuites()
 		supportedList = hs.clientHello.cipherSuites
+		if !aesGCMPreferred(hs.clientHello.cipherSuites) {
+			preferenceList = preferChaCha20(preferenceList)
+		}
 	} else {
 		preferenceList = hs.clientHello.cipherSuites
 		supportedList = c.config.cipherSuites()
@@ -243,16 +296,24 @@ Curves:
 func (hs *serverHandshakeState) checkForResumption() bool {
 	c := hs.c
 
-	if c.config.SessionTicketsDisabled {
+	var plaintext []byte
+	var ok bool
+	if len(hs.clientHello.sessionTicket) > 0 {
+		plaintext, hs.usedOldKey, ok = c.decryptTicket(hs.clientHello.sessionTicket)
+	} else {
+		// Without a ticket, the client may be resuming a session from
+		// the ServerSessionCache by its ID.
+		plaintext, ok = c.lookupSession(hs.clientHello.sessionId)
+	}
+	if !ok {
 		return false
 	}
-
-	var ok bool
-	if hs.sessionState, ok = c.decryptTicket(hs.clientHello.sessionTicket); !ok {
+	hs.sessionState = new(sessionState)
+	if !hs.sessionState.unmarshal(plaintext) {
 		return false
 	}
 
-	if hs.sessionState.vers > hs.clientHello.vers {
+	if hs.sessionState.vers > hs.clientHello.vers || hs.sessionState.vers >= VersionTLS13 {
 		return false
 	}
 	if vers, ok := c.config.mutualVersion(hs.sessionState.vers); !ok || vers != hs.sessionState.vers {
@@ -296,11 +357,16 @@ func (hs *serverHandshakeState) doResumeHandshake() error {
 	// We echo the client's session ID in the ServerHello to let it know
 	// that we're doing a resumption.
 	hs.hello.sessionId = hs.clientHello.sessionId
+	// A ticket encrypted with an old key is replaced with a fresh one.
+	hs.hello.ticketSupported = hs.usedOldKey
+	hs.finishedHash = newFinishedHash(c.vers, hs.suite)
+	hs.finishedHash.Write(hs.clientHello.marshal())
 	hs.finishedHash.Write(hs.hello.marshal())
 	c.writeRecord(recordTypeHandshake, hs.hello.marshal())
 
 	if len(hs.sessionState.certificates) > 0 {
-		if _, err := hs.processCertsFromClient(hs.sessionState.certificates); err != nil {
+		hs.certsFromClient = hs.sessionState.certificates
+		if _, err := c.processCertsFromClient(hs.certsFromClient); err != nil {
 			return err
 		}
 	}
@@ -317,9 +383,23 @@ func (hs *serverHandshakeState) doFullHandshake() error {
 	if hs.clientHello.ocspStapling && len(hs.cert.OCSPStaple) > 0 {
 		hs.hello.ocspStapling = true
 	}
+	if hs.clientHello.scts {
+		hs.hello.scts = hs.cert.SignedCertificateTimestamps
+	}
 
 	hs.hello.ticketSupported = hs.clientHello.ticketSupported && !config.SessionTicketsDisabled
+	if !hs.hello.ticketSupported && config.ServerSessionCache != nil {
+		// The session can only be resumed by its ID.
+		var err error
+		if hs.hello.sessionId, err = c.newSessionID(); err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+	}
 	hs.hello.cipherSuite = hs.suite.id
+
+	hs.finishedHash = newFinishedHash(c.vers, hs.suite)
+	hs.finishedHash.Write(hs.clientHello.marshal())
 	hs.finishedHash.Write(hs.hello.marshal())
 	c.writeRecord(recordTypeHandshake, hs.hello.marshal())
 
@@ -357,6 +437,9 @@ func (hs *serverHandshakeState) doFullHandshake() error {
 		if c.vers >= VersionTLS12 {
 			certReq.hasSignatureAndHash = true
 			certReq.signatureAndHashes = supportedClientCertSignatureAlgorithms
+			if hs.finishedHash.hash == crypto.SHA384 {
+				certReq.signatureAndHashes = supportedClientCertSignatureAlgorithmsSHA384
+			}
 		}
 
 		// An empty list of certificateAuthorities signals to
@@ -401,7 +484,8 @@ func (hs *serverHandshakeState) doFullHandshake() error {
 			}
 		}
 
-		pub, err = hs.processCertsFromClient(certMsg.certificates)
+		hs.certsFromClient = certMsg.certificates
+		pub, err = c.processCertsFromClient(certMsg.certificates)
 		if err != nil {
 			return err
 		}
@@ -469,7 +553,7 @@ func (hs *serverHandshakeState) doFullHandshake() error {
 		c.sendAlert(alertHandshakeFailure)
 		return err
 	}
-	hs.masterSecret = masterFromPreMasterSecret(c.vers, preMasterSecret, hs.clientHello.random, hs.hello.random)
+	hs.masterSecret = masterFromPreMasterSecret(c.vers, hs.suite, preMasterSecret, hs.clientHello.random, hs.hello.random)
 
 	return nil
 }
@@ -478,7 +562,7 @@ func (hs *serverHandshakeState) establishKeys() error {
 	c := hs.c
 
 	clientMAC, serverMAC, clientKey, serverKey, clientIV, serverIV :=
-		keysFromMasterSecret(c.vers, hs.masterSecret, hs.clientHello.random, hs.hello.random, hs.suite.macLen, hs.suite.keyLen, hs.suite.ivLen)
+		keysFromMasterSecret(c.vers, hs.suite, hs.masterSecret, hs.clientHello.random, hs.hello.random, hs.suite.macLen, hs.suite.keyLen, hs.suite.ivLen)
 
 	var clientCipher, serverCipher interface{}
 	var clientHash, serverHash macFunction
@@ -543,6 +627,23 @@ func (hs *serverHandshakeState) readFinished(out []byte) error {
 	return nil
 }
 
+// cacheSession stores the session in the ServerSessionCache if it was
+// given an ID to be resumed with.
+func (hs *serverHandshakeState) cacheSession() {
+	if len(hs.hello.sessionId) == 0 {
+		return
+	}
+
+	c := hs.c
+	state := sessionState{
+		vers:         c.vers,
+		cipherSuite:  hs.suite.id,
+		masterSecret: hs.masterSecret,
+		certificates: hs.certsFromClient,
+	}
+	c.cacheSession(hs.hello.sessionId, state.marshal())
+}
+
 func (hs *serverHandshakeState) sendSessionTicket() error {
 	if !hs.hello.ticketSupported {
 		return nil
@@ -558,7 +659,7 @@ func (hs *serverHandshakeState) sendSessionTicket() error {
 		masterSecret: hs.masterSecret,
 		certificates: hs.certsFromClient,
 	}
-	m.ticket, err = c.encryptTicket(&state)
+	m.ticket, err = c.encryptTicket(state.marshal())
 	if err != nil {
 		return err
 	}
@@ -588,10 +689,7 @@ func (hs *serverHandshakeState) sendFinished(out []byte) error {
 // processCertsFromClient takes a chain of client certificates either from a
 // Certificates message or from a sessionState and verifies them. It returns
 // the public key of the leaf certificate.
-func (hs *serverHandshakeState) processCertsFromClient(certificates [][]byte) (crypto.PublicKey, error) {
-	c := hs.c
-
-	hs.certsFromClient = certificates
+func (c *Conn) processCertsFromClient(certificates [][]byte) (crypto.PublicKey, error) {
 	certs := make([]*x509.Certificate, len(certificates))
 	var err error
 	for i, asn1Data := range certificates {
@@ -639,6 +737,12 @@ func (hs *serverHandshakeState) processCertsFromClient(certificates [][]byte) (c
 		switch key := certs[0].PublicKey.(type) {
 		case *ecdsa.PublicKey, *rsa.PublicKey:
 			pub = key
+		case ed25519.PublicKey:
+			if c.vers < VersionTLS13 {
+				c.sendAlert(alertUnsupportedCertificate)
+				return nil, errors.New("tls: client sent an Ed25519 certificate in a pre-TLS 1.3 handshake")
+			}
+			pub = key
 		default:
 			c.sendAlert(alertUnsupportedCertificate)
 			return nil, fmt.Errorf("tls: client's certificate contains an unsupported public key of type %T", certs[0].PublicKey)
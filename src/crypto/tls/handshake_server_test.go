@@ -45,6 +45,8 @@ func init() {
 		InsecureSkipVerify: true,
 		MinVersion:         VersionSSL30,
 		MaxVersion:         VersionTLS12,
+		CipherSuites:       recordedCipherSuites,
+		CurvePreferences:   []CurveID{CurveP256, CurveP384, CurveP521},
 	}
 	testConfig.Certificates[0].Certificate = [][]byte{testRSACertificate}
 	testConfig.Certificates[0].PrivateKey = testRSAPrivateKey
@@ -53,6 +55,26 @@ func init() {
 	testConfig.BuildNameToCertificate()
 }
 
+// recordedCipherSuites are the cipher suites that the recorded handshakes
+// in testdata were made with. Suites added since then would change the
+// ClientHello, and the server's choice. The curve preferences are pinned
+// for the same reason.
+var recordedCipherSuites = []uint16{
+	TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	TLS_RSA_WITH_RC4_128_SHA,
+	TLS_RSA_WITH_AES_128_CBC_SHA,
+	TLS_RSA_WITH_AES_256_CBC_SHA,
+	TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+}
+
 func testClientHelloFailure(t *testing.T, m handshakeMessage, expectedSubStr string) {
 	// Create in-memory network connection,
 	// send message to server.  Should return
@@ -240,6 +262,125 @@ func TestCipherSuitePreference(t *testing.T) {
 	}
 }
 
+func TestAEADCipherSuites(t *testing.T) {
+	ecdsaCerts := []Certificate{{
+		Certificate: [][]byte{testECDSACertificate},
+		PrivateKey:  testECDSAPrivateKey,
+	}}
+
+	tests := []struct {
+		suite uint16
+		certs []Certificate
+	}{
+		{TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, testConfig.Certificates},
+		{TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, ecdsaCerts},
+		{TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, testConfig.Certificates},
+		{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, ecdsaCerts},
+	}
+	for _, test := range tests {
+		for _, clientAuth := range []ClientAuthType{NoClientCert, RequireAnyClientCert} {
+			serverConfig := &Config{
+				Certificates: test.certs,
+				ClientAuth:   clientAuth,
+			}
+			clientConfig := &Config{
+				CipherSuites:       []uint16{test.suite},
+				InsecureSkipVerify: true,
+			}
+			if clientAuth != NoClientCert {
+				clientConfig.Certificates = testConfig.Certificates
+			}
+			state, err := testHandshake(clientConfig, serverConfig)
+			if err != nil {
+				t.Errorf("%x, client auth %d: handshake failed: %s", test.suite, clientAuth, err)
+				continue
+			}
+			if state.CipherSuite != test.suite {
+				t.Errorf("%x, client auth %d: got cipher suite %x", test.suite, clientAuth, state.CipherSuite)
+			}
+			if clientAuth != NoClientCert && len(state.PeerCertificates) != 1 {
+				t.Errorf("%x, client auth %d: got %d client certificates", test.suite, clientAuth, len(state.PeerCertificates))
+			}
+		}
+	}
+}
+
+func TestX25519(t *testing.T) {
+	serverConfig := &Config{
+		Certificates:     testConfig.Certificates,
+		CurvePreferences: []CurveID{X25519},
+	}
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+		CurvePreferences:   []CurveID{CurveP256, X25519},
+	}
+	state, err := testHandshake(clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if state.CipherSuite != TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("got cipher suite %x, want an ECDHE suite", state.CipherSuite)
+	}
+
+	// A client without X25519 can't use ECDHE with that server.
+	clientConfig.CurvePreferences = []CurveID{CurveP256}
+	clientConfig.CipherSuites = []uint16{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+	if _, err := testHandshake(clientConfig, serverConfig); err == nil {
+		t.Error("handshake succeeded without a mutual curve")
+	}
+}
+
+func TestEd25519RequiresTLS13(t *testing.T) {
+	cert, err := X509KeyPair([]byte(ed25519CertPEM), []byte(ed25519KeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &Config{
+		Certificates: []Certificate{cert},
+	}
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+	}
+	if _, err := testHandshake(clientConfig, serverConfig); err == nil || !strings.Contains(err.Error(), "TLS 1.3") {
+		t.Errorf("TLS 1.2 handshake with an Ed25519 certificate returned %v", err)
+	}
+}
+
+func TestChaCha20Preference(t *testing.T) {
+	serverConfig := &Config{
+		CipherSuites:             []uint16{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, TLS_RSA_WITH_AES_128_CBC_SHA},
+		Certificates:             testConfig.Certificates,
+		PreferServerCipherSuites: true,
+	}
+
+	tests := []struct {
+		clientSuites []uint16
+		want         uint16
+	}{
+		{[]uint16{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305}, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		{[]uint16{TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305},
+		// Only AEADs tell whether the client has AES hardware.
+		{[]uint16{TLS_RSA_WITH_AES_128_CBC_SHA, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305},
+		{[]uint16{TLS_RSA_WITH_AES_128_CBC_SHA, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305}, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		// Without ChaCha20-Poly1305, the server's preference stands.
+		{[]uint16{TLS_RSA_WITH_AES_128_CBC_SHA, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}
+	for i, test := range tests {
+		clientConfig := &Config{
+			CipherSuites:       test.clientSuites,
+			InsecureSkipVerify: true,
+		}
+		state, err := testHandshake(clientConfig, serverConfig)
+		if err != nil {
+			t.Errorf("#%d: handshake failed: %s", i, err)
+			continue
+		}
+		if state.CipherSuite != test.want {
+			t.Errorf("#%d: got cipher suite %x, want %x", i, state.CipherSuite, test.want)
+		}
+	}
+}
+
 // Note: see comment in handshake_test.go for details of how the reference
 // tests work.
 
@@ -0,0 +1,649 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// maxSessionTicketLifetime is the longest a TLS 1.3 session ticket may be
+// used for. See RFC 8446, section 4.6.1.
+const maxSessionTicketLifetime = 7 * 24 * time.Hour
+
+// maxSkippedEarlyData is the number of bytes of early data records that a
+// server which rejected them skips before giving up on the connection.
+const maxSkippedEarlyData = 1 << 16
+
+// serverHandshakeStateTLS13 contains details of a TLS 1.3 server handshake
+// in progress. Unless the client sends early data, it's discarded once the
+// handshake has completed.
+type serverHandshakeStateTLS13 struct {
+	c           *Conn
+	clientHello *clientHelloMsg
+	hello       *serverHelloMsg
+	suite       *cipherSuiteTLS13
+	transcript  hash.Hash
+	sentHRR     bool
+	sharedKey   []byte
+
+	usingPSK        bool
+	earlySecret     []byte
+	earlyData       bool
+	certsFromClient [][]byte
+
+	cert       *Certificate
+	sigAndHash signatureAndHash
+	sigHash    crypto.Hash
+
+	masterSecret          []byte
+	clientHandshakeSecret []byte
+	trafficSecret         []byte // client_application_traffic_secret_0
+}
+
+func (hs *serverHandshakeStateTLS13) handshake() error {
+	c := hs.c
+
+	// For an overview of the TLS 1.3 handshake, see RFC 8446, section 2.
+	if err := hs.processClientHello(); err != nil {
+		return err
+	}
+	if err := hs.checkForResumption(); err != nil {
+		return err
+	}
+	if err := hs.pickCertificate(); err != nil {
+		return err
+	}
+	if hs.earlyData {
+		clientEarlySecret := hs.suite.deriveSecret(hs.earlySecret, clientEarlyTrafficLabel, hs.transcript)
+		c.in.setTrafficSecret(hs.suite, clientEarlySecret)
+	} else if hs.clientHello.earlyData {
+		c.skipEarlyData = maxSkippedEarlyData
+	}
+	if err := hs.sendServerParameters(); err != nil {
+		return err
+	}
+	if err := hs.sendServerCertificate(); err != nil {
+		return err
+	}
+	if err := hs.sendServerFinished(); err != nil {
+		return err
+	}
+
+	if hs.earlyData {
+		// The client's early data comes first, followed by the
+		// rest of its handshake, which Read processes.
+		c.earlyDataAccepted = true
+		c.earlyDataServer = hs
+		c.handshakeComplete = true
+		return nil
+	}
+
+	if err := hs.readClientCertificate(); err != nil {
+		return err
+	}
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	if err := hs.readClientFinished(msg); err != nil {
+		return err
+	}
+	c.handshakeComplete = true
+	return nil
+}
+
+func (hs *serverHandshakeStateTLS13) processClientHello() error {
+	c := hs.c
+	config := c.config
+
+	hs.hello = &serverHelloMsg{
+		vers:              VersionTLS12,
+		random:            make([]byte, 32),
+		sessionId:         hs.clientHello.sessionId,
+		compressionMethod: compressionNone,
+		supportedVersion:  VersionTLS13,
+	}
+	if _, err := io.ReadFull(config.rand(), hs.hello.random); err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+
+	if len(hs.clientHello.compressionMethods) != 1 ||
+		hs.clientHello.compressionMethods[0] != compressionNone {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: TLS 1.3 client supports illegal compression methods")
+	}
+	if len(hs.clientHello.serverName) > 0 {
+		c.serverName = hs.clientHello.serverName
+	}
+
+	var preferenceList, supportedList []uint16
+	var tls13Suites []uint16
+	for _, suite := range cipherSuitesTLS13 {
+		tls13Suites = append(tls13Suites, suite.id)
+	}
+	if config.PreferServerCipherSuites {
+		preferenceList = tls13Suites
+		supportedList = hs.clientHello.cipherSuites
+		if !aesGCMPreferred(hs.clientHello.cipherSuites) {
+			preferenceList = preferChaCha20(preferenceList)
+		}
+	} else {
+		preferenceList = hs.clientHello.cipherSuites
+		supportedList = tls13Suites
+	}
+FindSuite:
+	for _, id := range preferenceList {
+		for _, supported := range supportedList {
+			if id == supported {
+				if hs.suite = mutualCipherSuiteTLS13(id); hs.suite != nil {
+					break FindSuite
+				}
+			}
+		}
+	}
+	if hs.suite == nil {
+		c.sendAlert(alertHandshakeFailure)
+		return errors.New("tls: no cipher suite supported by both client and server")
+	}
+	c.cipherSuite = hs.suite.id
+	hs.hello.cipherSuite = hs.suite.id
+	hs.transcript = hs.suite.hash.New()
+
+	// Pick the server's most preferred group that the client supports,
+	// but favor those the client sent a key share for, which save a
+	// round trip.
+	var selectedGroup CurveID
+	var clientKeyShare *keyShare
+GroupSelection:
+	for _, preferredGroup := range config.curvePreferences() {
+		for i, ks := range hs.clientHello.keyShares {
+			if ks.group == preferredGroup {
+				selectedGroup = ks.group
+				clientKeyShare = &hs.clientHello.keyShares[i]
+				break GroupSelection
+			}
+		}
+		if selectedGroup != 0 {
+			continue
+		}
+		for _, group := range hs.clientHello.supportedCurves {
+			if group == preferredGroup {
+				selectedGroup = group
+				break
+			}
+		}
+	}
+	if selectedGroup == 0 {
+		c.sendAlert(alertHandshakeFailure)
+		return errors.New("tls: no ECDHE curve supported by both client and server")
+	}
+	if clientKeyShare == nil {
+		if err := hs.doHelloRetryRequest(selectedGroup); err != nil {
+			return err
+		}
+		clientKeyShare = &hs.clientHello.keyShares[0]
+	}
+
+	params, err := generateECDHEParameters(config.rand(), selectedGroup)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	hs.hello.serverShare = keyShare{group: selectedGroup, data: params.PublicKey()}
+	hs.sharedKey = params.SharedKey(clientKeyShare.data)
+	if hs.sharedKey == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: invalid client key share")
+	}
+
+	if len(hs.clientHello.alpnProtocols) > 0 {
+		if selectedProto, fallback := mutualProtocol(hs.clientHello.alpnProtocols, config.NextProtos); !fallback {
+			c.clientProtocol = selectedProto
+		}
+	}
+
+	return nil
+}
+
+// doHelloRetryRequest asks the client for a key share for group, and reads
+// its second ClientHello.
+func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(group CurveID) error {
+	c := hs.c
+
+	hs.transcript.Write(hs.clientHello.marshal())
+	restartTranscript(hs.transcript)
+
+	helloRetryRequest := &serverHelloMsg{
+		vers:              hs.hello.vers,
+		random:            helloRetryRequestRandom,
+		sessionId:         hs.hello.sessionId,
+		cipherSuite:       hs.hello.cipherSuite,
+		compressionMethod: hs.hello.compressionMethod,
+		supportedVersion:  hs.hello.supportedVersion,
+		selectedGroup:     group,
+	}
+	hs.transcript.Write(helloRetryRequest.marshal())
+	c.writeRecord(recordTypeHandshake, helloRetryRequest.marshal())
+	hs.sentHRR = true
+
+	if hs.clientHello.earlyData {
+		// Early data sent with the first ClientHello is skipped.
+		c.skipEarlyData = maxSkippedEarlyData
+	}
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	clientHello, ok := msg.(*clientHelloMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(clientHello, msg)
+	}
+	if len(clientHello.keyShares) != 1 || clientHello.keyShares[0].group != group {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: client sent invalid key share in second ClientHello")
+	}
+	if clientHello.earlyData {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: client indicated early data in second ClientHello")
+	}
+	if !eqUint16s(clientHello.cipherSuites, hs.clientHello.cipherSuites) ||
+		!eqUint16s(clientHello.supportedVersions, hs.clientHello.supportedVersions) ||
+		clientHello.serverName != hs.clientHello.serverName ||
+		!eqStrings(clientHello.alpnProtocols, hs.clientHello.alpnProtocols) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: client changed its offer in second ClientHello")
+	}
+	hs.clientHello = clientHello
+
+	return nil
+}
+
+// checkForResumption looks for a PSK identity that is a valid session
+// ticket, and checks its binder. It also adds the ClientHello to the
+// transcript.
+func (hs *serverHandshakeStateTLS13) checkForResumption() error {
+	c := hs.c
+
+	// The binders cover the ClientHello up to themselves, which is
+	// hashed first; the transcript then gets the rest of it.
+	raw := hs.clientHello.marshal()
+	withoutBinders := hs.clientHello.marshalWithoutBinders()
+	hs.transcript.Write(withoutBinders)
+	defer hs.transcript.Write(raw[len(withoutBinders):])
+
+	if (c.config.SessionTicketsDisabled && c.config.ServerSessionCache == nil) ||
+		len(hs.clientHello.pskIdentities) == 0 {
+		return nil
+	}
+	modeOK := false
+	for _, mode := range hs.clientHello.pskModes {
+		if mode == pskModeDHE {
+			modeOK = true
+			break
+		}
+	}
+	if !modeOK {
+		return nil
+	}
+	if len(hs.clientHello.pskIdentities) != len(hs.clientHello.pskBinders) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: invalid or missing PSK binders")
+	}
+
+	for i, identity := range hs.clientHello.pskIdentities {
+		var plaintext []byte
+		var ok bool
+		if c.config.SessionTicketsDisabled {
+			plaintext, ok = c.lookupSession(identity.label)
+		} else {
+			plaintext, _, ok = c.decryptTicket(identity.label)
+		}
+		if !ok {
+			continue
+		}
+		session := new(sessionStateTLS13)
+		if !session.unmarshal(plaintext) {
+			continue
+		}
+		createdAt := time.Unix(int64(session.createdAt), 0)
+		if c.config.time().Sub(createdAt) > maxSessionTicketLifetime {
+			continue
+		}
+		// The PSK can be used with any suite that has the same hash.
+		pskSuite := mutualCipherSuiteTLS13(session.cipherSuite)
+		if pskSuite == nil || pskSuite.hash != hs.suite.hash {
+			continue
+		}
+		sessionHasClientCerts := len(session.certificates) != 0
+		needClientCerts := c.config.ClientAuth == RequireAnyClientCert ||
+			c.config.ClientAuth == RequireAndVerifyClientCert
+		if needClientCerts && !sessionHasClientCerts {
+			continue
+		}
+		if sessionHasClientCerts && c.config.ClientAuth == NoClientCert {
+			continue
+		}
+
+		earlySecret := hs.suite.earlySecret(session.psk)
+		binderKey := hs.suite.deriveSecret(earlySecret, resumptionBinderLabel, nil)
+		if !hmac.Equal(hs.clientHello.pskBinders[i], hs.suite.finishedHash(binderKey, hs.transcript)) {
+			c.sendAlert(alertDecryptError)
+			return errors.New("tls: invalid PSK binder")
+		}
+
+		if sessionHasClientCerts {
+			if _, err := c.processCertsFromClient(session.certificates); err != nil {
+				return err
+			}
+			hs.certsFromClient = session.certificates
+		}
+
+		// Early data is only accepted with the first PSK, and with
+		// the parameters of the session it was issued in.
+		hs.earlyData = i == 0 && hs.clientHello.earlyData && !hs.sentHRR &&
+			c.config.MaxEarlyData > 0 && session.maxEarlyData > 0 &&
+			session.cipherSuite == hs.suite.id &&
+			session.alpnProtocol == c.clientProtocol
+
+		hs.usingPSK = true
+		hs.earlySecret = earlySecret
+		hs.hello.selectedIdentityPresent = true
+		hs.hello.selectedIdentity = uint16(i)
+		c.didResume = true
+		return nil
+	}
+
+	return nil
+}
+
+func (hs *serverHandshakeStateTLS13) pickCertificate() error {
+	c := hs.c
+	config := c.config
+
+	// Only one of PSK and certificates are used at a time.
+	if hs.usingPSK {
+		return nil
+	}
+
+	if len(config.Certificates) == 0 {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: no certificates configured")
+	}
+	hs.cert = &config.Certificates[0]
+	if len(hs.clientHello.serverName) > 0 {
+		chi := &ClientHelloInfo{
+			CipherSuites:    hs.clientHello.cipherSuites,
+			ServerName:      hs.clientHello.serverName,
+			SupportedCurves: hs.clientHello.supportedCurves,
+			SupportedPoints: hs.clientHello.supportedPoints,
+		}
+		var err error
+		if hs.cert, err = config.getCertificate(chi); err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+	}
+
+	key, ok := hs.cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		c.sendAlert(alertInternalError)
+		return fmt.Errorf("tls: certificate private key of type %T does not implement crypto.Signer", hs.cert.PrivateKey)
+	}
+	var err error
+	hs.sigAndHash, hs.sigHash, err = signatureSchemeTLS13(key.Public(), hs.clientHello.signatureAndHashes)
+	if err != nil {
+		c.sendAlert(alertHandshakeFailure)
+		return err
+	}
+
+	return nil
+}
+
+func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
+	c := hs.c
+
+	hs.transcript.Write(hs.hello.marshal())
+	c.writeRecord(recordTypeHandshake, hs.hello.marshal())
+
+	earlySecret := hs.earlySecret
+	if earlySecret == nil {
+		earlySecret = hs.suite.earlySecret(nil)
+	}
+	handshakeSecret := hs.suite.handshakeSecret(earlySecret, hs.sharedKey)
+	hs.clientHandshakeSecret = hs.suite.deriveSecret(handshakeSecret, clientHandshakeTrafficLabel, hs.transcript)
+	serverSecret := hs.suite.deriveSecret(handshakeSecret, serverHandshakeTrafficLabel, hs.transcript)
+	c.out.setTrafficSecret(hs.suite, serverSecret)
+	if !hs.earlyData {
+		c.in.setTrafficSecret(hs.suite, hs.clientHandshakeSecret)
+	}
+	hs.masterSecret = hs.suite.masterSecret(handshakeSecret)
+
+	encryptedExtensions := &encryptedExtensionsMsg{
+		alpnProtocol: c.clientProtocol,
+		earlyData:    hs.earlyData,
+	}
+	hs.transcript.Write(encryptedExtensions.marshal())
+	c.writeRecord(recordTypeHandshake, encryptedExtensions.marshal())
+
+	return nil
+}
+
+func (hs *serverHandshakeStateTLS13) requestClientCert() bool {
+	return hs.c.config.ClientAuth >= RequestClientCert && !hs.usingPSK
+}
+
+func (hs *serverHandshakeStateTLS13) sendServerCertificate() error {
+	c := hs.c
+
+	if hs.usingPSK {
+		return nil
+	}
+
+	if hs.requestClientCert() {
+		certReq := &certificateRequestMsgTLS13{
+			signatureAndHashes: supportedSignatureAlgorithmsTLS13,
+		}
+		if c.config.ClientCAs != nil {
+			certReq.certificateAuthorities = c.config.ClientCAs.Subjects()
+		}
+		hs.transcript.Write(certReq.marshal())
+		c.writeRecord(recordTypeHandshake, certReq.marshal())
+	}
+
+	certMsg := &certificateMsgTLS13{
+		certificates: hs.cert.Certificate,
+	}
+	if hs.clientHello.ocspStapling {
+		certMsg.ocspStaple = hs.cert.OCSPStaple
+	}
+	if hs.clientHello.scts {
+		certMsg.scts = hs.cert.SignedCertificateTimestamps
+	}
+	hs.transcript.Write(certMsg.marshal())
+	c.writeRecord(recordTypeHandshake, certMsg.marshal())
+
+	digest := signedMessageTLS13(hs.sigHash, serverSignatureContext, hs.transcript)
+	sig, err := signTLS13(c.config.rand(), hs.cert.PrivateKey.(crypto.Signer), hs.sigAndHash, hs.sigHash, digest)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to sign handshake: " + err.Error())
+	}
+	certVerify := &certificateVerifyMsg{
+		hasSignatureAndHash: true,
+		signatureAndHash:    hs.sigAndHash,
+		signature:           sig,
+	}
+	hs.transcript.Write(certVerify.marshal())
+	c.writeRecord(recordTypeHandshake, certVerify.marshal())
+
+	return nil
+}
+
+func (hs *serverHandshakeStateTLS13) sendServerFinished() error {
+	c := hs.c
+
+	finished := &finishedMsg{
+		verifyData: hs.suite.finishedHash(c.out.trafficSecret, hs.transcript),
+	}
+	hs.transcript.Write(finished.marshal())
+	c.writeRecord(recordTypeHandshake, finished.marshal())
+
+	// The server can send application data from now on, before the
+	// client's Finished message.
+	hs.trafficSecret = hs.suite.deriveSecret(hs.masterSecret, clientApplicationTrafficLabel, hs.transcript)
+	serverSecret := hs.suite.deriveSecret(hs.masterSecret, serverApplicationTrafficLabel, hs.transcript)
+	c.out.setTrafficSecret(hs.suite, serverSecret)
+
+	return nil
+}
+
+func (hs *serverHandshakeStateTLS13) readClientCertificate() error {
+	c := hs.c
+
+	if !hs.requestClientCert() {
+		return nil
+	}
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	certMsg, ok := msg.(*certificateMsgTLS13)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certMsg, msg)
+	}
+	hs.transcript.Write(certMsg.marshal())
+
+	if len(certMsg.certificates) == 0 {
+		switch c.config.ClientAuth {
+		case RequireAnyClientCert, RequireAndVerifyClientCert:
+			c.sendAlert(alertCertificateRequired)
+			return errors.New("tls: client didn't provide a certificate")
+		}
+		return nil
+	}
+
+	pub, err := c.processCertsFromClient(certMsg.certificates)
+	if err != nil {
+		return err
+	}
+	hs.certsFromClient = certMsg.certificates
+
+	msg, err = c.readHandshake()
+	if err != nil {
+		return err
+	}
+	certVerify, ok := msg.(*certificateVerifyMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certVerify, msg)
+	}
+	if err := verifyTLS13(pub, certVerify.signatureAndHash, clientSignatureContext, hs.transcript, certVerify.signature); err != nil {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: could not validate signature of connection nonces: " + err.Error())
+	}
+	hs.transcript.Write(certVerify.marshal())
+
+	return nil
+}
+
+// readClientFinished processes the end of the client's handshake, starting
+// with msg, which is EndOfEarlyData if early data was accepted. It's
+// called by Read in that case, with c.in locked.
+func (hs *serverHandshakeStateTLS13) readClientFinished(msg interface{}) error {
+	c := hs.c
+
+	if hs.earlyData {
+		endOfEarlyData, ok := msg.(*endOfEarlyDataMsg)
+		if !ok {
+			c.sendAlert(alertUnexpectedMessage)
+			return unexpectedMessageError(endOfEarlyData, msg)
+		}
+		hs.transcript.Write(endOfEarlyData.marshal())
+		c.in.setTrafficSecret(hs.suite, hs.clientHandshakeSecret)
+
+		var err error
+		if msg, err = c.readHandshake(); err != nil {
+			return err
+		}
+	}
+
+	finished, ok := msg.(*finishedMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(finished, msg)
+	}
+	expected := hs.suite.finishedHash(c.in.trafficSecret, hs.transcript)
+	if !hmac.Equal(expected, finished.verifyData) {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: client's Finished message is incorrect")
+	}
+	hs.transcript.Write(finished.marshal())
+
+	c.in.setTrafficSecret(hs.suite, hs.trafficSecret)
+	resumptionSecret := hs.suite.deriveSecret(hs.masterSecret, resumptionLabel, hs.transcript)
+
+	return hs.sendSessionTicket(resumptionSecret)
+}
+
+func (hs *serverHandshakeStateTLS13) sendSessionTicket(resumptionSecret []byte) error {
+	c := hs.c
+
+	if c.config.SessionTicketsDisabled && c.config.ServerSessionCache == nil {
+		return nil
+	}
+
+	m := &newSessionTicketMsgTLS13{
+		lifetime:     uint32(maxSessionTicketLifetime / time.Second),
+		nonce:        []byte{0},
+		maxEarlyData: c.config.MaxEarlyData,
+	}
+	var ageAdd [4]byte
+	if _, err := io.ReadFull(c.config.rand(), ageAdd[:]); err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	m.ageAdd = readUint32(ageAdd[:])
+
+	state := sessionStateTLS13{
+		cipherSuite:  hs.suite.id,
+		createdAt:    uint64(c.config.time().Unix()),
+		psk:          hs.suite.resumptionPSK(resumptionSecret, m.nonce),
+		maxEarlyData: c.config.MaxEarlyData,
+		alpnProtocol: c.clientProtocol,
+		certificates: hs.certsFromClient,
+	}
+	var err error
+	if c.config.SessionTicketsDisabled {
+		// The ticket only names the session in the ServerSessionCache.
+		if m.label, err = c.newSessionID(); err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		c.cacheSession(m.label, state.marshal())
+	} else if m.label, err = c.encryptTicket(state.marshal()); err != nil {
+		return err
+	}
+
+	// The ticket may be sent after the handshake, along with
+	// application data.
+	c.out.Lock()
+	defer c.out.Unlock()
+	if _, err := c.writeRecord(recordTypeHandshake, m.marshal()); err != nil {
+		return c.out.setErrorLocked(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,634 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/ocsp"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// localPipe returns the two ends of a local TCP connection. Unlike
+// net.Pipe, it buffers writes, which TLS 1.3 relies on: the server sends
+// session tickets after the handshake, and the client sends early data
+// before reading the server's reply.
+func localPipe(t *testing.T) (client, server net.Conn) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+	return client, server
+}
+
+const tls13TestMessage = "hello, TLS 1.3"
+
+// runTLS13 has a client send tls13TestMessage, as early data if
+// earlyData is set, to a server which echoes it back. It returns the
+// connection states seen by both sides.
+func runTLS13(t *testing.T, clientConn net.Conn, clientConfig, serverConfig *Config, earlyData bool) (clientState, serverState ConnectionState, err error) {
+	c, s := localPipe(t)
+	if clientConn == nil {
+		clientConn = c
+	} else {
+		clientConn.(*rewriteConn).Conn = c
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		defer s.Close()
+		server := Server(s, serverConfig)
+		buf := make([]byte, len(tls13TestMessage))
+		if _, err := io.ReadFull(server, buf); err != nil {
+			serverErr <- err
+			return
+		}
+		if _, err := server.Write(buf); err != nil {
+			serverErr <- err
+			return
+		}
+		serverState = server.ConnectionState()
+		serverErr <- nil
+	}()
+
+	client := Client(clientConn, clientConfig)
+	defer func() {
+		client.Close()
+		if serr := <-serverErr; err == nil && serr != nil {
+			err = errors.New("server: " + serr.Error())
+		}
+	}()
+
+	if earlyData {
+		if err := client.SetEarlyData([]byte(tls13TestMessage)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = client.Handshake(); err != nil {
+		return
+	}
+	if !client.ConnectionState().EarlyDataAccepted {
+		if _, err = io.WriteString(client, tls13TestMessage); err != nil {
+			return
+		}
+	}
+	buf := make([]byte, len(tls13TestMessage))
+	if _, err = io.ReadFull(client, buf); err != nil {
+		return
+	}
+	if string(buf) != tls13TestMessage {
+		err = errors.New("client read " + string(buf))
+		return
+	}
+	clientState = client.ConnectionState()
+	return
+}
+
+func tls13ServerConfig() *Config {
+	config := &Config{
+		Certificates: testConfig.Certificates,
+		MaxVersion:   VersionTLS13,
+	}
+	copy(config.SessionTicketKey[:], "TLS 1.3 test session ticket key.")
+	return config
+}
+
+func tls13ClientConfig() *Config {
+	return &Config{
+		ServerName:         "example.golang",
+		InsecureSkipVerify: true,
+		MaxVersion:         VersionTLS13,
+	}
+}
+
+func TestTLS13Handshake(t *testing.T) {
+	ecdsaCerts := []Certificate{{
+		Certificate: [][]byte{testECDSACertificate},
+		PrivateKey:  testECDSAPrivateKey,
+	}}
+	ed25519Cert, err := X509KeyPair([]byte(ed25519CertPEM), []byte(ed25519KeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, certs := range [][]Certificate{testConfig.Certificates, ecdsaCerts, {ed25519Cert}} {
+		serverConfig := tls13ServerConfig()
+		serverConfig.Certificates = certs
+		serverConfig.NextProtos = []string{"http/1.1"}
+		clientConfig := tls13ClientConfig()
+		clientConfig.NextProtos = []string{"h2", "http/1.1"}
+
+		cs, ss, err := runTLS13(t, nil, clientConfig, serverConfig, false)
+		if err != nil {
+			t.Errorf("#%d: handshake failed: %s", i, err)
+			continue
+		}
+		for _, state := range []ConnectionState{cs, ss} {
+			if state.Version != VersionTLS13 {
+				t.Errorf("#%d: got version %x, want %x", i, state.Version, VersionTLS13)
+			}
+			if state.CipherSuite != TLS_AES_128_GCM_SHA256 {
+				t.Errorf("#%d: got cipher suite %x, want %x", i, state.CipherSuite, TLS_AES_128_GCM_SHA256)
+			}
+			if state.NegotiatedProtocol != "http/1.1" {
+				t.Errorf("#%d: got protocol %q, want http/1.1", i, state.NegotiatedProtocol)
+			}
+			if state.DidResume {
+				t.Errorf("#%d: resumed without a session", i)
+			}
+		}
+		if len(cs.PeerCertificates) != 1 || !bytes.Equal(cs.PeerCertificates[0].Raw, certs[0].Certificate[0]) {
+			t.Errorf("#%d: client got wrong server certificate", i)
+		}
+	}
+}
+
+func TestTLS13HelloRetryRequest(t *testing.T) {
+	serverConfig := tls13ServerConfig()
+	serverConfig.CurvePreferences = []CurveID{CurveP384}
+
+	cs, _, err := runTLS13(t, nil, tls13ClientConfig(), serverConfig, false)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if cs.Version != VersionTLS13 {
+		t.Errorf("got version %x, want %x", cs.Version, VersionTLS13)
+	}
+}
+
+func TestTLS13Resumption(t *testing.T) {
+	serverConfig := tls13ServerConfig()
+	clientConfig := tls13ClientConfig()
+	clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+
+	if _, _, err := runTLS13(t, nil, clientConfig, serverConfig, false); err != nil {
+		t.Fatalf("first handshake failed: %s", err)
+	}
+	if _, ok := clientConfig.ClientSessionCache.Get("example.golang"); !ok {
+		t.Fatal("client didn't store a session ticket")
+	}
+
+	cs, ss, err := runTLS13(t, nil, clientConfig, serverConfig, false)
+	if err != nil {
+		t.Fatalf("resumed handshake failed: %s", err)
+	}
+	if !cs.DidResume || !ss.DidResume {
+		t.Fatalf("session wasn't resumed: client %v, server %v", cs.DidResume, ss.DidResume)
+	}
+	if len(cs.PeerCertificates) == 0 {
+		t.Error("resumed session lost the server certificates")
+	}
+
+	// The PSK binder covers the HelloRetryRequest too.
+	hrrConfig := tls13ServerConfig()
+	hrrConfig.CurvePreferences = []CurveID{CurveP384}
+	if cs, _, err = runTLS13(t, nil, clientConfig, hrrConfig, false); err != nil {
+		t.Fatalf("resumed handshake with HelloRetryRequest failed: %s", err)
+	}
+	if !cs.DidResume {
+		t.Error("session wasn't resumed after a HelloRetryRequest")
+	}
+
+	disabledConfig := tls13ServerConfig()
+	disabledConfig.SessionTicketsDisabled = true
+	if cs, _, err = runTLS13(t, nil, clientConfig, disabledConfig, false); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if cs.DidResume {
+		t.Error("session resumed with tickets disabled")
+	}
+
+	// With tickets disabled, a ServerSessionCache still allows
+	// resumption.
+	disabledConfig.ServerSessionCache = NewLRUServerSessionCache(1)
+	if _, _, err = runTLS13(t, nil, clientConfig, disabledConfig, false); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if cs, _, err = runTLS13(t, nil, clientConfig, disabledConfig, false); err != nil {
+		t.Fatalf("resumed handshake failed: %s", err)
+	}
+	if !cs.DidResume {
+		t.Error("session wasn't resumed from the ServerSessionCache")
+	}
+}
+
+func TestTLS13EarlyData(t *testing.T) {
+	serverConfig := tls13ServerConfig()
+	serverConfig.MaxEarlyData = 1024
+	clientConfig := tls13ClientConfig()
+	clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+
+	// Early data needs a session from a server that allows it.
+	cs, ss, err := runTLS13(t, nil, clientConfig, serverConfig, true)
+	if err != nil {
+		t.Fatalf("first handshake failed: %s", err)
+	}
+	if cs.EarlyDataAccepted || ss.EarlyDataAccepted {
+		t.Fatal("early data accepted without a session")
+	}
+
+	cs, ss, err = runTLS13(t, nil, clientConfig, serverConfig, true)
+	if err != nil {
+		t.Fatalf("handshake with early data failed: %s", err)
+	}
+	if !cs.EarlyDataAccepted || !ss.EarlyDataAccepted {
+		t.Fatalf("early data wasn't accepted: client %v, server %v", cs.EarlyDataAccepted, ss.EarlyDataAccepted)
+	}
+	if !cs.DidResume || !ss.DidResume {
+		t.Fatal("session wasn't resumed")
+	}
+
+	// The server skips the early data it rejects, and the client sends
+	// its message again.
+	rejectConfig := tls13ServerConfig()
+	cs, ss, err = runTLS13(t, nil, clientConfig, rejectConfig, true)
+	if err != nil {
+		t.Fatalf("handshake with rejected early data failed: %s", err)
+	}
+	if cs.EarlyDataAccepted || ss.EarlyDataAccepted {
+		t.Error("early data accepted by a server that doesn't allow it")
+	}
+	if !cs.DidResume {
+		t.Error("session wasn't resumed")
+	}
+
+	if _, _, err = runTLS13(t, nil, clientConfig, serverConfig, false); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	hrrConfig := tls13ServerConfig()
+	hrrConfig.MaxEarlyData = 1024
+	hrrConfig.CurvePreferences = []CurveID{CurveP384}
+	cs, _, err = runTLS13(t, nil, clientConfig, hrrConfig, true)
+	if err != nil {
+		t.Fatalf("handshake with early data and HelloRetryRequest failed: %s", err)
+	}
+	if cs.EarlyDataAccepted {
+		t.Error("early data accepted after a HelloRetryRequest")
+	}
+}
+
+func TestTLS13ClientAuth(t *testing.T) {
+	serverConfig := tls13ServerConfig()
+	serverConfig.ClientAuth = RequireAnyClientCert
+	clientConfig := tls13ClientConfig()
+
+	if _, _, err := runTLS13(t, nil, clientConfig, serverConfig, false); err == nil {
+		t.Error("handshake succeeded without a required client certificate")
+	}
+
+	clientConfig.Certificates = testConfig.Certificates[:1]
+	_, ss, err := runTLS13(t, nil, clientConfig, serverConfig, false)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if len(ss.PeerCertificates) != 1 || !bytes.Equal(ss.PeerCertificates[0].Raw, testRSACertificate) {
+		t.Error("server got wrong client certificate")
+	}
+
+	ed25519Cert, err := X509KeyPair([]byte(ed25519CertPEM), []byte(ed25519KeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig.Certificates = []Certificate{ed25519Cert}
+	_, ss, err = runTLS13(t, nil, clientConfig, serverConfig, false)
+	if err != nil {
+		t.Fatalf("handshake with an Ed25519 client certificate failed: %s", err)
+	}
+	if len(ss.PeerCertificates) != 1 || !bytes.Equal(ss.PeerCertificates[0].Raw, ed25519Cert.Certificate[0]) {
+		t.Error("server got wrong Ed25519 client certificate")
+	}
+}
+
+func TestTLS13X25519(t *testing.T) {
+	for _, serverCurves := range [][]CurveID{{X25519}, {CurveP256, X25519}} {
+		serverConfig := tls13ServerConfig()
+		serverConfig.CurvePreferences = serverCurves
+		clientConfig := tls13ClientConfig()
+		// The client sends a P-256 key share first, so a server that
+		// only supports X25519 has to ask for another.
+		clientConfig.CurvePreferences = []CurveID{CurveP256, X25519}
+
+		cs, _, err := runTLS13(t, nil, clientConfig, serverConfig, false)
+		if err != nil {
+			t.Errorf("server curves %v: handshake failed: %s", serverCurves, err)
+			continue
+		}
+		if cs.Version != VersionTLS13 {
+			t.Errorf("server curves %v: got version %x, want %x", serverCurves, cs.Version, VersionTLS13)
+		}
+	}
+}
+
+func TestTLS13VersionNegotiation(t *testing.T) {
+	tests := []struct {
+		clientMax, serverMax, want uint16
+	}{
+		{VersionTLS13, VersionTLS12, VersionTLS12},
+		{VersionTLS13, VersionTLS11, VersionTLS11},
+		{VersionTLS12, VersionTLS13, VersionTLS12},
+		{VersionTLS11, VersionTLS13, VersionTLS11},
+	}
+	for i, test := range tests {
+		clientConfig := tls13ClientConfig()
+		clientConfig.MaxVersion = test.clientMax
+		serverConfig := tls13ServerConfig()
+		serverConfig.MaxVersion = test.serverMax
+
+		cs, ss, err := runTLS13(t, nil, clientConfig, serverConfig, false)
+		if err != nil {
+			t.Errorf("#%d: handshake failed: %s", i, err)
+			continue
+		}
+		if cs.Version != test.want || ss.Version != test.want {
+			t.Errorf("#%d: got versions %x and %x, want %x", i, cs.Version, ss.Version, test.want)
+		}
+	}
+}
+
+// rewriteConn passes the first record written through rewrite.
+type rewriteConn struct {
+	net.Conn
+	rewrite func(record []byte) []byte
+	done    bool
+}
+
+func (c *rewriteConn) Write(b []byte) (int, error) {
+	if c.done {
+		return c.Conn.Write(b)
+	}
+	c.done = true
+	if _, err := c.Conn.Write(c.rewrite(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func TestTLS13DowngradeProtection(t *testing.T) {
+	// Stripping TLS 1.3 from the ClientHello makes the server negotiate
+	// TLS 1.2, which it signals in its random.
+	stripTLS13 := func(record []byte) []byte {
+		hello := new(clientHelloMsg)
+		if !hello.unmarshal(record[5:]) {
+			t.Fatal("failed to parse ClientHello")
+		}
+		hello.raw = nil
+		hello.supportedVersions = nil
+		msg := hello.marshal()
+		return append([]byte{record[0], record[1], record[2], byte(len(msg) >> 8), byte(len(msg))}, msg...)
+	}
+
+	conn := &rewriteConn{rewrite: stripTLS13}
+	_, _, err := runTLS13(t, conn, tls13ClientConfig(), tls13ServerConfig(), false)
+	if err == nil || !strings.Contains(err.Error(), "downgrade") {
+		t.Errorf("got error %v, want a downgrade error", err)
+	}
+}
+
+// ocspTestPKI returns a server certificate for "example.golang", a pool
+// holding its issuer, and a function that returns a response from the
+// issuer with the given status for the certificate.
+func ocspTestPKI(t *testing.T) (Certificate, *x509.CertPool, func(status int, nextUpdate time.Time) []byte) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(24 * time.Hour)
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OCSP test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA: true,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.golang"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		DNSNames:     []string{"example.golang"},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, issuer, &leafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := Certificate{
+		Certificate: [][]byte{leafDER, issuerDER},
+		PrivateKey:  leafKey,
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer)
+
+	staple := func(status int, nextUpdate time.Time) []byte {
+		resp, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       status,
+			SerialNumber: leafTemplate.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   nextUpdate,
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, issuerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	return cert, roots, staple
+}
+
+func TestOCSPStapling(t *testing.T) {
+	cert, roots, staple := ocspTestPKI(t)
+	fresh := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		status     int
+		nextUpdate time.Time
+		noStaple   bool
+		verify     bool
+		clock      time.Time // the client's Config.Time, if set
+		ok         bool
+	}{
+		{status: ocsp.Good, nextUpdate: fresh, ok: true},
+		{status: ocsp.Good, nextUpdate: fresh, verify: true, ok: true},
+		{status: ocsp.Revoked, nextUpdate: fresh, ok: true},
+		{noStaple: true, ok: true},
+		{status: ocsp.Revoked, nextUpdate: fresh, verify: true},
+		{status: ocsp.Good, nextUpdate: time.Now().Add(-time.Second), verify: true},
+		{noStaple: true, verify: true},
+		{status: ocsp.Good, nextUpdate: fresh, verify: true, clock: time.Now().Add(2 * time.Hour)},
+		{status: ocsp.Good, nextUpdate: time.Now().Add(-time.Second), verify: true, clock: time.Now().Add(-30 * time.Second), ok: true},
+	}
+
+	for _, vers := range []uint16{VersionTLS12, VersionTLS13} {
+		for i, test := range tests {
+			cert.OCSPStaple = nil
+			if !test.noStaple {
+				cert.OCSPStaple = staple(test.status, test.nextUpdate)
+			}
+			serverConfig := tls13ServerConfig()
+			serverConfig.Certificates = []Certificate{cert}
+			clientConfig := &Config{
+				ServerName: "example.golang",
+				RootCAs:    roots,
+				MaxVersion: vers,
+			}
+			if test.verify {
+				clientConfig.VerifyOCSPStaple = ocsp.VerifyStaple
+			}
+			if clock := test.clock; !clock.IsZero() {
+				clientConfig.Time = func() time.Time { return clock }
+			}
+
+			cs, _, err := runTLS13(t, nil, clientConfig, serverConfig, false)
+			if !test.ok {
+				if err == nil {
+					t.Errorf("version %x, #%d: handshake succeeded", vers, i)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("version %x, #%d: handshake failed: %s", vers, i, err)
+				continue
+			}
+			if cs.Version != vers {
+				t.Errorf("version %x, #%d: got version %x", vers, i, cs.Version)
+			}
+			if !bytes.Equal(cs.OCSPResponse, cert.OCSPStaple) {
+				t.Errorf("version %x, #%d: client got staple %x, want %x", vers, i, cs.OCSPResponse, cert.OCSPStaple)
+			}
+		}
+	}
+}
+
+// sctFor returns an SCT for the DER certificate cert from the log with key,
+// as served in the signed_certificate_timestamp extension.
+func sctFor(t *testing.T, key *ecdsa.PrivateKey, cert []byte) []byte {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID := sha256.Sum256(der)
+	timestamp := []byte{0, 0, 1, 0x45, 0x57, 0x5f, 0x84, 0}
+
+	// version, signature_type, timestamp, x509_entry, the certificate
+	// and no extensions.
+	signed := append([]byte{0, 0}, timestamp...)
+	signed = append(signed, 0, 0)
+	signed = appendUint24Prefixed(signed, cert)
+	signed = append(signed, 0, 0)
+	digest := sha256.Sum256(signed)
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sct := append([]byte{0}, logID[:]...)
+	sct = append(sct, timestamp...)
+	sct = append(sct, 0, 0, hashSHA256, signatureECDSA)
+	return appendUint16Prefixed(sct, sig)
+}
+
+func TestSignedCertificateTimestamps(t *testing.T) {
+	cert, roots, _ := ocspTestPKI(t)
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := sctFor(t, logKey, cert.Certificate[0])
+	cert.SignedCertificateTimestamps = [][]byte{sct}
+
+	requireSCTs := func(logKey *ecdsa.PrivateKey) func([][]byte, [][]*x509.Certificate) error {
+		logs := []*x509.CTLog{{PublicKey: &logKey.PublicKey}}
+		return func(scts [][]byte, chains [][]*x509.Certificate) error {
+			_, err := chains[0][0].VerifySCTs(chains[0][1], scts, logs)
+			return err
+		}
+	}
+
+	tests := []struct {
+		verify func([][]byte, [][]*x509.Certificate) error
+		scts   [][]byte
+		ok     bool
+	}{
+		{nil, nil, true},
+		{requireSCTs(logKey), [][]byte{sct}, true},
+		{requireSCTs(otherKey), nil, false},
+	}
+
+	for _, vers := range []uint16{VersionTLS12, VersionTLS13} {
+		for i, test := range tests {
+			serverConfig := tls13ServerConfig()
+			serverConfig.Certificates = []Certificate{cert}
+			clientConfig := &Config{
+				ServerName: "example.golang",
+				RootCAs:    roots,
+				MaxVersion: vers,
+				VerifySCTs: test.verify,
+			}
+
+			cs, _, err := runTLS13(t, nil, clientConfig, serverConfig, false)
+			if !test.ok {
+				if err == nil {
+					t.Errorf("version %x, #%d: handshake succeeded", vers, i)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("version %x, #%d: handshake failed: %s", vers, i, err)
+				continue
+			}
+			if len(cs.SignedCertificateTimestamps) != len(test.scts) ||
+				len(test.scts) > 0 && !bytes.Equal(cs.SignedCertificateTimestamps[0], test.scts[0]) {
+				t.Errorf("version %x, #%d: client got SCTs %x, want %x", vers, i, cs.SignedCertificateTimestamps, test.scts)
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"crypto/curve25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"errors"
+	"hash"
+	"io"
+	"math/big"
+)
+
+// This file implements the TLS 1.3 key schedule, which is built on
+// HKDF. See RFC 8446, section 7.1 and RFC 5869.
+
+const (
+	resumptionBinderLabel         = "res binder"
+	clientEarlyTrafficLabel       = "c e traffic"
+	clientHandshakeTrafficLabel   = "c hs traffic"
+	serverHandshakeTrafficLabel   = "s hs traffic"
+	clientApplicationTrafficLabel = "c ap traffic"
+	serverApplicationTrafficLabel = "s ap traffic"
+	resumptionLabel               = "res master"
+	trafficUpdateLabel            = "traffic upd"
+)
+
+// hkdfExtract implements HKDF-Extract. A nil salt is treated as a string
+// of zeros as long as the hash output.
+func hkdfExtract(hash func() hash.Hash, secret, salt []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, hash().Size())
+	}
+	h := hmac.New(hash, salt)
+	h.Write(secret)
+	return h.Sum(nil)
+}
+
+// hkdfExpand implements HKDF-Expand.
+func hkdfExpand(hash func() hash.Hash, prk, info []byte, length int) []byte {
+	h := hmac.New(hash, prk)
+	out := make([]byte, 0, length+h.Size())
+	var prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		h.Reset()
+		h.Write(prev)
+		h.Write(info)
+		h.Write([]byte{i})
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+// expandLabel implements HKDF-Expand-Label from RFC 8446, section 7.1.
+func (c *cipherSuiteTLS13) expandLabel(secret []byte, label string, context []byte, length int) []byte {
+	const prefix = "tls13 "
+	hkdfLabel := make([]byte, 0, 2+1+len(prefix)+len(label)+1+len(context))
+	hkdfLabel = append(hkdfLabel, byte(length>>8), byte(length))
+	hkdfLabel = append(hkdfLabel, byte(len(prefix)+len(label)))
+	hkdfLabel = append(hkdfLabel, prefix...)
+	hkdfLabel = append(hkdfLabel, label...)
+	hkdfLabel = append(hkdfLabel, byte(len(context)))
+	hkdfLabel = append(hkdfLabel, context...)
+	return hkdfExpand(c.hash.New, secret, hkdfLabel, length)
+}
+
+// deriveSecret implements Derive-Secret from RFC 8446, section 7.1. A
+// nil transcript stands for the empty one.
+func (c *cipherSuiteTLS13) deriveSecret(secret []byte, label string, transcript hash.Hash) []byte {
+	if transcript == nil {
+		transcript = c.hash.New()
+	}
+	return c.expandLabel(secret, label, transcript.Sum(nil), c.hash.Size())
+}
+
+// extract implements the HKDF-Extract steps of the key schedule. A nil
+// newSecret, used when there's no PSK or once the handshake secret has
+// been mixed in, is treated as a string of zeros.
+func (c *cipherSuiteTLS13) extract(newSecret, currentSecret []byte) []byte {
+	if newSecret == nil {
+		newSecret = make([]byte, c.hash.Size())
+	}
+	return hkdfExtract(c.hash.New, newSecret, currentSecret)
+}
+
+// earlySecret returns the first secret of the key schedule, derived from
+// psk, which is nil for handshakes that don't resume a session.
+func (c *cipherSuiteTLS13) earlySecret(psk []byte) []byte {
+	return c.extract(psk, nil)
+}
+
+// handshakeSecret mixes the (EC)DHE shared secret into the key schedule.
+func (c *cipherSuiteTLS13) handshakeSecret(earlySecret, sharedKey []byte) []byte {
+	return c.extract(sharedKey, c.deriveSecret(earlySecret, "derived", nil))
+}
+
+// masterSecret returns the secret from which the application traffic
+// secrets are derived.
+func (c *cipherSuiteTLS13) masterSecret(handshakeSecret []byte) []byte {
+	return c.extract(nil, c.deriveSecret(handshakeSecret, "derived", nil))
+}
+
+// trafficKey returns the record protection key and IV for a traffic
+// secret. See RFC 8446, section 7.3.
+func (c *cipherSuiteTLS13) trafficKey(trafficSecret []byte) (key, iv []byte) {
+	key = c.expandLabel(trafficSecret, "key", nil, c.keyLen)
+	iv = c.expandLabel(trafficSecret, "iv", nil, 12)
+	return
+}
+
+// nextTrafficSecret returns the traffic secret that follows trafficSecret
+// after a KeyUpdate. See RFC 8446, section 7.2.
+func (c *cipherSuiteTLS13) nextTrafficSecret(trafficSecret []byte) []byte {
+	return c.expandLabel(trafficSecret, trafficUpdateLabel, nil, c.hash.Size())
+}
+
+// finishedHash returns the verify_data of a Finished message, or of a
+// PSK binder, sent under baseKey. See RFC 8446, section 4.4.4.
+func (c *cipherSuiteTLS13) finishedHash(baseKey []byte, transcript hash.Hash) []byte {
+	finishedKey := c.expandLabel(baseKey, "finished", nil, c.hash.Size())
+	verifyData := hmac.New(c.hash.New, finishedKey)
+	verifyData.Write(transcript.Sum(nil))
+	return verifyData.Sum(nil)
+}
+
+// resumptionPSK returns the pre-shared key of the session ticket sent
+// with nonce. See RFC 8446, section 4.6.1.
+func (c *cipherSuiteTLS13) resumptionPSK(resumptionSecret, nonce []byte) []byte {
+	return c.expandLabel(resumptionSecret, "resumption", nonce, c.hash.Size())
+}
+
+// restartTranscript replaces the contents of transcript, which holds the
+// first ClientHello of a handshake, by the message_hash message standing
+// in for it after a HelloRetryRequest. See RFC 8446, section 4.4.1.
+func restartTranscript(transcript hash.Hash) {
+	chHash := transcript.Sum(nil)
+	transcript.Reset()
+	transcript.Write([]byte{typeMessageHash, 0, 0, uint8(len(chHash))})
+	transcript.Write(chHash)
+}
+
+// ecdheParameters is an ephemeral key pair for an ECDHE key exchange: a
+// TLS 1.3 key share or the ECDH parameters of a TLS 1.2 handshake.
+type ecdheParameters interface {
+	CurveID() CurveID
+	PublicKey() []byte
+	// SharedKey returns the shared secret, or nil if peerPublicKey is
+	// invalid.
+	SharedKey(peerPublicKey []byte) []byte
+}
+
+func generateECDHEParameters(rand io.Reader, curveID CurveID) (ecdheParameters, error) {
+	if curveID == X25519 {
+		p := &x25519Parameters{}
+		if _, err := io.ReadFull(rand, p.privateKey[:]); err != nil {
+			return nil, err
+		}
+		publicKey, err := curve25519.X25519(p.privateKey[:], curve25519.Basepoint)
+		if err != nil {
+			return nil, err
+		}
+		copy(p.publicKey[:], publicKey)
+		return p, nil
+	}
+
+	curve, ok := curveForCurveID(curveID)
+	if !ok {
+		return nil, errors.New("tls: internal error: unsupported curve")
+	}
+	p := &nistParameters{curveID: curveID}
+	var err error
+	p.privateKey, p.x, p.y, err = elliptic.GenerateKey(curve, rand)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// nistParameters are ecdheParameters for the NIST curves, whose shares
+// are uncompressed points and whose shared secret is the x coordinate.
+type nistParameters struct {
+	privateKey []byte
+	x, y       *big.Int
+	curveID    CurveID
+}
+
+func (p *nistParameters) CurveID() CurveID {
+	return p.curveID
+}
+
+func (p *nistParameters) PublicKey() []byte {
+	curve, _ := curveForCurveID(p.curveID)
+	return elliptic.Marshal(curve, p.x, p.y)
+}
+
+func (p *nistParameters) SharedKey(peerPublicKey []byte) []byte {
+	curve, _ := curveForCurveID(p.curveID)
+	x, y := elliptic.Unmarshal(curve, peerPublicKey)
+	if x == nil || !curve.IsOnCurve(x, y) {
+		return nil
+	}
+	xShared, _ := curve.ScalarMult(x, y, p.privateKey)
+	sharedKey := make([]byte, (curve.Params().BitSize+7)>>3)
+	xBytes := xShared.Bytes()
+	copy(sharedKey[len(sharedKey)-len(xBytes):], xBytes)
+	return sharedKey
+}
+
+// x25519Parameters are ecdheParameters for X25519, whose shares and
+// shared secret are 32-byte strings. See RFC 7748 and RFC 8422.
+type x25519Parameters struct {
+	privateKey [curve25519.ScalarSize]byte
+	publicKey  [curve25519.PointSize]byte
+}
+
+func (p *x25519Parameters) CurveID() CurveID {
+	return X25519
+}
+
+func (p *x25519Parameters) PublicKey() []byte {
+	return p.publicKey[:]
+}
+
+func (p *x25519Parameters) SharedKey(peerPublicKey []byte) []byte {
+	if len(peerPublicKey) != curve25519.PointSize {
+		return nil
+	}
+	// X25519 fails for low order points, whose shared secret would be
+	// all zeros.
+	sharedKey, err := curve25519.X25519(p.privateKey[:], peerPublicKey)
+	if err != nil {
+		return nil
+	}
+	return sharedKey
+}
@@ -130,8 +130,87 @@ func (s *sessionState) unmarshal(data []byte) bool {
 	return true
 }
 
-func (c *Conn) encryptTicket(state *sessionState) ([]byte, error) {
-	serialized := state.marshal()
+// sessionStateTLS13 contains the information that is serialized into a
+// TLS 1.3 session ticket. Its serialization starts with VersionTLS13,
+// which tells it apart from a sessionState.
+type sessionStateTLS13 struct {
+	cipherSuite  uint16
+	createdAt    uint64 // seconds since the Unix epoch
+	psk          []byte
+	maxEarlyData uint32
+	alpnProtocol string
+	certificates [][]byte
+}
+
+func (s *sessionStateTLS13) equal(i interface{}) bool {
+	s1, ok := i.(*sessionStateTLS13)
+	if !ok {
+		return false
+	}
+
+	return s.cipherSuite == s1.cipherSuite &&
+		s.createdAt == s1.createdAt &&
+		bytes.Equal(s.psk, s1.psk) &&
+		s.maxEarlyData == s1.maxEarlyData &&
+		s.alpnProtocol == s1.alpnProtocol &&
+		eqByteSlices(s.certificates, s1.certificates)
+}
+
+func (s *sessionStateTLS13) marshal() []byte {
+	x := appendUint16(nil, VersionTLS13)
+	x = appendUint16(x, s.cipherSuite)
+	x = appendUint32(x, uint32(s.createdAt>>32))
+	x = appendUint32(x, uint32(s.createdAt))
+	x = append(x, uint8(len(s.psk)))
+	x = append(x, s.psk...)
+	x = appendUint32(x, s.maxEarlyData)
+	x = append(x, uint8(len(s.alpnProtocol)))
+	x = append(x, s.alpnProtocol...)
+	var certs []byte
+	for _, cert := range s.certificates {
+		certs = appendUint24Prefixed(certs, cert)
+	}
+	return appendUint24Prefixed(x, certs)
+}
+
+func (s *sessionStateTLS13) unmarshal(data []byte) bool {
+	if len(data) < 12 || uint16(data[0])<<8|uint16(data[1]) != VersionTLS13 {
+		return false
+	}
+	s.cipherSuite = uint16(data[2])<<8 | uint16(data[3])
+	s.createdAt = uint64(readUint32(data[4:]))<<32 | uint64(readUint32(data[8:]))
+
+	var ok bool
+	if s.psk, data, ok = readUint8LengthPrefixed(data[12:]); !ok || len(data) < 4 {
+		return false
+	}
+	s.maxEarlyData = readUint32(data)
+	alpn, data, ok := readUint8LengthPrefixed(data[4:])
+	if !ok {
+		return false
+	}
+	s.alpnProtocol = string(alpn)
+	certs, data, ok := readUint24LengthPrefixed(data)
+	if !ok || len(data) != 0 {
+		return false
+	}
+	s.certificates = nil
+	for len(certs) > 0 {
+		var cert []byte
+		if cert, certs, ok = readUint24LengthPrefixed(certs); !ok {
+			return false
+		}
+		s.certificates = append(s.certificates, cert)
+	}
+
+	return true
+}
+
+// encryptTicket encrypts and authenticates a serialized session state
+// with the first session ticket key.
+func (c *Conn) encryptTicket(serialized []byte) ([]byte, error) {
+	key := c.config.ticketKeys()[0]
+
 	encrypted := make([]byte, aes.BlockSize+len(serialized)+sha256.Size)
 	iv := encrypted[:aes.BlockSize]
 	macBytes := encrypted[len(encrypted)-sha256.Size:]
@@ -139,45 +218,87 @@ func (c *Conn) encryptTicket(state *sessionState) ([]byte, error) {
 	if _, err := io.ReadFull(c.config.rand(), iv); err != nil {
 		return nil, err
 	}
-	block, err := aes.NewCipher(c.config.SessionTicketKey[:16])
+	block, err := aes.NewCipher(key.aesKey[:])
 	if err != nil {
 		return nil, errors.New("tls: failed to create cipher while encrypting ticket: " + err.Error())
 	}
 	cipher.NewCTR(block, iv).XORKeyStream(encrypted[aes.BlockSize:], serialized)
 
-	mac := hmac.New(sha256.New, c.config.SessionTicketKey[16:32])
+	mac := hmac.New(sha256.New, key.hmacKey[:])
 	mac.Write(encrypted[:len(encrypted)-sha256.Size])
 	mac.Sum(macBytes[:0])
 
 	return encrypted, nil
 }
 
-func (c *Conn) decryptTicket(encrypted []byte) (*sessionState, bool) {
+// decryptTicket returns the serialized session state in a ticket made by
+// encryptTicket, and whether it was encrypted with a key other than the
+// first. Tickets don't name their key, so each key's MAC is tried in turn.
+// The ticket itself isn't modified, as it's part of a ClientHello that is
+// still to be hashed.
+func (c *Conn) decryptTicket(encrypted []byte) (plaintext []byte, usedOldKey, ok bool) {
 	if c.config.SessionTicketsDisabled ||
 		len(encrypted) < aes.BlockSize+sha256.Size {
-		return nil, false
+		return nil, false, false
 	}
 
 	iv := encrypted[:aes.BlockSize]
 	macBytes := encrypted[len(encrypted)-sha256.Size:]
 
-	mac := hmac.New(sha256.New, c.config.SessionTicketKey[16:32])
-	mac.Write(encrypted[:len(encrypted)-sha256.Size])
-	expected := mac.Sum(nil)
-
-	if subtle.ConstantTimeCompare(macBytes, expected) != 1 {
-		return nil, false
+	keys := c.config.ticketKeys()
+	keyIndex := -1
+	for i := range keys {
+		mac := hmac.New(sha256.New, keys[i].hmacKey[:])
+		mac.Write(encrypted[:len(encrypted)-sha256.Size])
+		if subtle.ConstantTimeCompare(macBytes, mac.Sum(nil)) == 1 {
+			keyIndex = i
+			break
+		}
+	}
+	if keyIndex == -1 {
+		return nil, false, false
 	}
 
-	block, err := aes.NewCipher(c.config.SessionTicketKey[:16])
+	block, err := aes.NewCipher(keys[keyIndex].aesKey[:])
 	if err != nil {
-		return nil, false
+		return nil, false, false
 	}
 	ciphertext := encrypted[aes.BlockSize : len(encrypted)-sha256.Size]
-	plaintext := ciphertext
+	plaintext = make([]byte, len(ciphertext))
 	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
 
-	state := new(sessionState)
-	ok := state.unmarshal(plaintext)
-	return state, ok
+	return plaintext, keyIndex > 0, true
+}
+
+// sessionIDLen is the length of the IDs under which sessions are stored in
+// a ServerSessionCache. It's the longest session ID TLS 1.2 allows.
+const sessionIDLen = 32
+
+// newSessionID returns a random ID to store a session under in the
+// ServerSessionCache.
+func (c *Conn) newSessionID() ([]byte, error) {
+	id := make([]byte, sessionIDLen)
+	if _, err := io.ReadFull(c.config.rand(), id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// cacheSession stores a serialized session state in the ServerSessionCache
+// under id.
+func (c *Conn) cacheSession(id, serialized []byte) {
+	c.config.ServerSessionCache.Put(string(id), &ServerSessionState{serialized})
+}
+
+// lookupSession returns the serialized session state stored under id by
+// cacheSession, if the ServerSessionCache still holds it.
+func (c *Conn) lookupSession(id []byte) ([]byte, bool) {
+	if c.config.ServerSessionCache == nil || len(id) == 0 {
+		return nil, false
+	}
+	session, ok := c.config.ServerSessionCache.Get(string(id))
+	if !ok || session == nil {
+		return nil, false
+	}
+	return session.state, true
 }
@@ -0,0 +1,292 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+)
+
+// Certificate Transparency (RFC 6962) logs issue Signed Certificate
+// Timestamps (SCTs), promises to publish a certificate, which reach a
+// client embedded in the certificate, in a TLS extension or in an OCSP
+// response.
+
+// oidExtensionSCT is the X.509 extension holding embedded SCTs. See RFC
+// 6962, section 3.3.
+var oidExtensionSCT = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// SCT entry types, which tell the data a log signed. See RFC 6962, section
+// 3.1.
+const (
+	sctEntryX509    = 0
+	sctEntryPrecert = 1
+)
+
+// A SignedCertificateTimestamp is a parsed, version 1 SCT. See RFC 6962,
+// section 3.2.
+type SignedCertificateTimestamp struct {
+	Raw        []byte
+	LogID      [32]byte // SHA-256 hash of the log's DER encoded public key.
+	Timestamp  uint64   // Milliseconds since the Unix epoch.
+	Extensions []byte
+
+	// SignatureAlgorithm is the algorithm of Signature, one of
+	// ECDSAWithSHA256 and SHA256WithRSA.
+	SignatureAlgorithm SignatureAlgorithm
+	Signature          []byte
+}
+
+// ParseSignedCertificateTimestamp parses a single serialized SCT.
+func ParseSignedCertificateTimestamp(data []byte) (*SignedCertificateTimestamp, error) {
+	sct := &SignedCertificateTimestamp{Raw: data}
+	if len(data) < 1+32+8+2 {
+		return nil, errors.New("x509: SCT truncated")
+	}
+	if data[0] != 0 {
+		return nil, errors.New("x509: unsupported SCT version")
+	}
+	copy(sct.LogID[:], data[1:33])
+	for _, b := range data[33:41] {
+		sct.Timestamp = sct.Timestamp<<8 | uint64(b)
+	}
+	data = data[41:]
+
+	var ok bool
+	if sct.Extensions, data, ok = readUint16Prefixed(data); !ok || len(data) < 2 {
+		return nil, errors.New("x509: SCT truncated")
+	}
+	// Only SHA-256 (4) with ECDSA (3) or RSA (1) is allowed by RFC 6962,
+	// section 2.1.4.
+	switch {
+	case data[0] == 4 && data[1] == 3:
+		sct.SignatureAlgorithm = ECDSAWithSHA256
+	case data[0] == 4 && data[1] == 1:
+		sct.SignatureAlgorithm = SHA256WithRSA
+	default:
+		return nil, errors.New("x509: unsupported SCT signature algorithm")
+	}
+	if sct.Signature, data, ok = readUint16Prefixed(data[2:]); !ok || len(data) != 0 {
+		return nil, errors.New("x509: malformed SCT signature")
+	}
+	return sct, nil
+}
+
+// A CTLog is a Certificate Transparency log whose SCTs are trusted.
+type CTLog struct {
+	Description string
+	PublicKey   interface{} // *ecdsa.PublicKey or *rsa.PublicKey.
+}
+
+// ID returns the log's ID, the SHA-256 hash of its public key.
+func (l *CTLog) ID() ([32]byte, error) {
+	var id [32]byte
+	der, err := MarshalPKIXPublicKey(l.PublicKey)
+	if err != nil {
+		return id, err
+	}
+	return sha256.Sum256(der), nil
+}
+
+// VerifySCTs checks scts, as delivered in a TLS extension, in an OCSP
+// response or embedded in c, and returns the logs, out of logs, that issued
+// a valid SCT for c. issuer is the certificate that signed c, which is
+// needed to check embedded SCTs; it may be nil if there are none. SCTs
+// from unknown logs and ones that fail to verify are skipped, but an error
+// is returned if none were valid.
+func (c *Certificate) VerifySCTs(issuer *Certificate, scts [][]byte, logs []*CTLog) ([]*CTLog, error) {
+	ids := make([][32]byte, len(logs))
+	for i, log := range logs {
+		id, err := log.ID()
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	var valid []*CTLog
+	for _, raw := range scts {
+		sct, err := ParseSignedCertificateTimestamp(raw)
+		if err != nil {
+			continue
+		}
+		for i, log := range logs {
+			if ids[i] != sct.LogID || containsLog(valid, log) {
+				continue
+			}
+			if c.checkSCT(issuer, sct, log) == nil {
+				valid = append(valid, log)
+			}
+		}
+	}
+	if len(valid) == 0 {
+		return nil, errors.New("x509: no valid SCTs from a known log")
+	}
+	return valid, nil
+}
+
+func containsLog(logs []*CTLog, log *CTLog) bool {
+	for _, l := range logs {
+		if l == log {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSCT verifies sct's signature by log over c, either as an X.509
+// entry or, if issuer is given, as the precertificate entry of an embedded
+// SCT.
+func (c *Certificate) checkSCT(issuer *Certificate, sct *SignedCertificateTimestamp, log *CTLog) error {
+	signed := sctSignedData(sct, sctEntryX509, c.Raw)
+	err := checkSignature(sct.SignatureAlgorithm, signed, sct.Signature, log.PublicKey)
+	if err == nil || issuer == nil {
+		return err
+	}
+
+	tbs, err := removeSCTExtension(c.RawTBSCertificate)
+	if err != nil {
+		return err
+	}
+	keyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	signed = sctSignedData(sct, sctEntryPrecert, append(keyHash[:], appendUint24Prefixed(nil, tbs)...))
+	return checkSignature(sct.SignatureAlgorithm, signed, sct.Signature, log.PublicKey)
+}
+
+// sctSignedData returns the data covered by an SCT's signature, where entry
+// is the serialized log entry of type entryType. See RFC 6962, section 3.2.
+func sctSignedData(sct *SignedCertificateTimestamp, entryType uint16, entry []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(0) // version v1
+	b.WriteByte(0) // signature_type certificate_timestamp
+	for i := 56; i >= 0; i -= 8 {
+		b.WriteByte(byte(sct.Timestamp >> uint(i)))
+	}
+	b.WriteByte(byte(entryType >> 8))
+	b.WriteByte(byte(entryType))
+	if entryType == sctEntryX509 {
+		b.Write(appendUint24Prefixed(nil, entry))
+	} else {
+		b.Write(entry)
+	}
+	b.WriteByte(byte(len(sct.Extensions) >> 8))
+	b.WriteByte(byte(len(sct.Extensions)))
+	b.Write(sct.Extensions)
+	return b.Bytes()
+}
+
+// removeSCTExtension returns tbs, a DER encoded TBSCertificate, without its
+// SCT extension, which is what the log signed for an embedded SCT.
+func removeSCTExtension(tbs []byte) ([]byte, error) {
+	var seq asn1.RawValue
+	if rest, err := asn1.Unmarshal(tbs, &seq); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after TBSCertificate")
+	}
+
+	var fields []byte
+	for data := seq.Bytes; len(data) > 0; {
+		var field asn1.RawValue
+		var err error
+		if data, err = asn1.Unmarshal(data, &field); err != nil {
+			return nil, err
+		}
+		// extensions [3] EXPLICIT SEQUENCE OF Extension
+		if field.Class != 2 || field.Tag != 3 {
+			fields = append(fields, field.FullBytes...)
+			continue
+		}
+		var exts asn1.RawValue
+		if _, err := asn1.Unmarshal(field.Bytes, &exts); err != nil {
+			return nil, err
+		}
+		var kept []byte
+		for data := exts.Bytes; len(data) > 0; {
+			var ext asn1.RawValue
+			if data, err = asn1.Unmarshal(data, &ext); err != nil {
+				return nil, err
+			}
+			var e pkix.Extension
+			if _, err := asn1.Unmarshal(ext.FullBytes, &e); err != nil {
+				return nil, err
+			}
+			if !e.Id.Equal(oidExtensionSCT) {
+				kept = append(kept, ext.FullBytes...)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		seqBytes, err := asn1.Marshal(asn1.RawValue{Tag: 16, IsCompound: true, Bytes: kept})
+		if err != nil {
+			return nil, err
+		}
+		explicit, err := asn1.Marshal(asn1.RawValue{Class: 2, Tag: 3, IsCompound: true, Bytes: seqBytes})
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, explicit...)
+	}
+	return asn1.Marshal(asn1.RawValue{Tag: 16, IsCompound: true, Bytes: fields})
+}
+
+// parseSCTExtension parses the value of an SCT extension: an OCTET STRING
+// holding a SignedCertificateTimestampList.
+func parseSCTExtension(value []byte) ([][]byte, error) {
+	var list []byte
+	if rest, err := asn1.Unmarshal(value, &list); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after SCT extension")
+	}
+	list, rest, ok := readUint16Prefixed(list)
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("x509: malformed SCT list")
+	}
+	var scts [][]byte
+	for len(list) > 0 {
+		var sct []byte
+		if sct, list, ok = readUint16Prefixed(list); !ok || len(sct) == 0 {
+			return nil, errors.New("x509: malformed SCT list")
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+func marshalSCTExtension(scts [][]byte) ([]byte, error) {
+	var list []byte
+	for _, sct := range scts {
+		if len(sct) == 0 || len(sct) > 0xffff {
+			return nil, errors.New("x509: invalid SCT length")
+		}
+		list = append(list, byte(len(sct)>>8), byte(len(sct)))
+		list = append(list, sct...)
+	}
+	if len(list) > 0xffff {
+		return nil, errors.New("x509: SCT list too long")
+	}
+	return asn1.Marshal(append([]byte{byte(len(list) >> 8), byte(len(list))}, list...))
+}
+
+func readUint16Prefixed(data []byte) (v, rest []byte, ok bool) {
+	if len(data) < 2 {
+		return nil, nil, false
+	}
+	n := int(data[0])<<8 | int(data[1])
+	if len(data) < 2+n {
+		return nil, nil, false
+	}
+	return data[2 : 2+n], data[2+n:], true
+}
+
+func appendUint24Prefixed(b, v []byte) []byte {
+	b = append(b, byte(len(v)>>16), byte(len(v)>>8), byte(len(v)))
+	return append(b, v...)
+}
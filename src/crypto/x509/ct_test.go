@@ -0,0 +1,166 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// makeSCT returns an SCT from the log with key over the given entry.
+func makeSCT(t *testing.T, key crypto.Signer, entryType uint16, entry []byte) []byte {
+	der, err := MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sha256.Sum256(der)
+	sct := &SignedCertificateTimestamp{Timestamp: 1400000000000}
+
+	digest := sha256.Sum256(sctSignedData(sct, entryType, entry))
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := append([]byte{0}, id[:]...)
+	for i := 56; i >= 0; i -= 8 {
+		b = append(b, byte(sct.Timestamp>>uint(i)))
+	}
+	b = append(b, 0, 0, 4) // no extensions, SHA-256
+	if _, ok := key.Public().(*ecdsa.PublicKey); ok {
+		b = append(b, 3)
+	} else {
+		b = append(b, 1)
+	}
+	b = append(b, byte(len(sig)>>8), byte(len(sig)))
+	return append(b, sig...)
+}
+
+func TestSignedCertificateTimestamps(t *testing.T) {
+	block, _ := pem.Decode([]byte(pemPrivateKey))
+	rsaLogKey, err := ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaLogKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaLog := &CTLog{Description: "RSA log", PublicKey: &rsaLogKey.PublicKey}
+	ecdsaLog := &CTLog{Description: "ECDSA log", PublicKey: &ecdsaLogKey.PublicKey}
+	logs := []*CTLog{rsaLog, ecdsaLog}
+
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CT CA"},
+		NotBefore:             time.Unix(1000, 0),
+		NotAfter:              time.Unix(100000, 0),
+		BasicConstraintsValid: true,
+		IsCA: true,
+	}
+	caDER, err := CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Unix(1000, 0),
+		NotAfter:     time.Unix(100000, 0),
+		DNSNames:     []string{"example.com"},
+		ExtKeyUsage:  []ExtKeyUsage{ExtKeyUsageServerAuth},
+	}
+	precertDER, err := CreateCertificate(rand.Reader, template, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := ParseCertificate(precertDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Embed an SCT over the precertificate, as a CA issuing a certificate
+	// after logging it would.
+	keyHash := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+	entry := append(keyHash[:], appendUint24Prefixed(nil, precert.RawTBSCertificate)...)
+	embedded := makeSCT(t, ecdsaLogKey, sctEntryPrecert, entry)
+	template.SignedCertificateTimestamps = [][]byte{embedded}
+	certDER, err := CreateCertificate(rand.Reader, template, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert.SignedCertificateTimestamps, template.SignedCertificateTimestamps) {
+		t.Fatalf("embedded SCTs didn't round trip: got %x", cert.SignedCertificateTimestamps)
+	}
+
+	sct, err := ParseSignedCertificateTimestamp(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := ecdsaLog.ID(); sct.LogID != id || sct.Timestamp != 1400000000000 || sct.SignatureAlgorithm != ECDSAWithSHA256 {
+		t.Errorf("unexpected parsed SCT: %+v", sct)
+	}
+
+	valid, err := cert.VerifySCTs(ca, cert.SignedCertificateTimestamps, logs)
+	if err != nil {
+		t.Fatalf("embedded SCT failed to verify: %s", err)
+	}
+	if len(valid) != 1 || valid[0] != ecdsaLog {
+		t.Errorf("got valid logs %v, want the ECDSA log", valid)
+	}
+	if _, err := cert.VerifySCTs(nil, cert.SignedCertificateTimestamps, logs); err == nil {
+		t.Error("embedded SCT verified without the issuer")
+	}
+
+	// An SCT delivered over TLS covers the final certificate.
+	tlsSCT := makeSCT(t, rsaLogKey, sctEntryX509, cert.Raw)
+	valid, err = cert.VerifySCTs(ca, [][]byte{tlsSCT, embedded, embedded}, logs)
+	if err != nil {
+		t.Fatalf("SCTs failed to verify: %s", err)
+	}
+	if len(valid) != 2 || valid[0] != rsaLog || valid[1] != ecdsaLog {
+		t.Errorf("got valid logs %v, want both logs once", valid)
+	}
+
+	if _, err := cert.VerifySCTs(ca, [][]byte{tlsSCT}, []*CTLog{ecdsaLog}); err == nil {
+		t.Error("SCT from an unknown log verified")
+	}
+	bad := append([]byte(nil), tlsSCT...)
+	bad[len(bad)-1] ^= 1
+	if _, err := cert.VerifySCTs(ca, [][]byte{bad}, logs); err == nil {
+		t.Error("SCT with a bad signature verified")
+	}
+	if _, err := precert.VerifySCTs(ca, [][]byte{tlsSCT}, logs); err == nil {
+		t.Error("SCT verified for the wrong certificate")
+	}
+	if _, err := ParseSignedCertificateTimestamp(tlsSCT[:40]); err == nil {
+		t.Error("truncated SCT parsed")
+	}
+}
@@ -95,10 +95,11 @@ func (c rfc1423Algo) deriveKey(password, salt []byte) []byte {
 	return out
 }
 
-// IsEncryptedPEMBlock returns if the PEM block is password encrypted.
+// IsEncryptedPEMBlock returns if the PEM block is password encrypted, either
+// with a DEK-Info header or as an encrypted PKCS#8 private key.
 func IsEncryptedPEMBlock(b *pem.Block) bool {
 	_, ok := b.Headers["DEK-Info"]
-	return ok
+	return ok || b.Type == encryptedPKCS8BlockType
 }
 
 // IncorrectPasswordError is returned when an incorrect password is detected.
@@ -107,9 +108,13 @@ var IncorrectPasswordError = errors.New("x509: decryption password incorrect")
 // DecryptPEMBlock takes a password encrypted PEM block and the password used to
 // encrypt it and returns a slice of decrypted DER encoded bytes. It inspects
 // the DEK-Info header to determine the algorithm used for decryption. If no
-// DEK-Info header is present, an error is returned. If an incorrect password
-// is detected an IncorrectPasswordError is returned.
+// DEK-Info header is present, an error is returned, unless the block is an
+// "ENCRYPTED PRIVATE KEY", which is decrypted with DecryptPKCS8PrivateKey.
+// If an incorrect password is detected an IncorrectPasswordError is returned.
 func DecryptPEMBlock(b *pem.Block, password []byte) ([]byte, error) {
+	if b.Type == encryptedPKCS8BlockType {
+		return DecryptPKCS8PrivateKey(b.Bytes, password)
+	}
 	dek, ok := b.Headers["DEK-Info"]
 	if !ok {
 		return nil, errors.New("x509: no DEK-Info header in block")
@@ -144,7 +149,11 @@ func DecryptPEMBlock(b *pem.Block, password []byte) ([]byte, error) {
 	data := make([]byte, len(b.Bytes))
 	dec := cipher.NewCBCDecrypter(block, iv)
 	dec.CryptBlocks(data, b.Bytes)
+	return unpadCBC(data, ciph.blockSize)
+}
 
+// unpadCBC removes the padding from data, decrypted in CBC mode.
+func unpadCBC(data []byte, blockSize int) ([]byte, error) {
 	// Blocks are padded using a scheme where the last n bytes of padding are all
 	// equal to n. It can pad from 1 to blocksize bytes inclusive. See RFC 1423.
 	// For example:
@@ -152,14 +161,14 @@ func DecryptPEMBlock(b *pem.Block, password []byte) ([]byte, error) {
 	//	[x y 7 7 7 7 7 7 7]
 	// If we detect a bad padding, we assume it is an invalid password.
 	dlen := len(data)
-	if dlen == 0 || dlen%ciph.blockSize != 0 {
+	if dlen == 0 || dlen%blockSize != 0 {
 		return nil, errors.New("x509: invalid padding")
 	}
 	last := int(data[dlen-1])
 	if dlen < last {
 		return nil, IncorrectPasswordError
 	}
-	if last == 0 || last > ciph.blockSize {
+	if last == 0 || last > blockSize {
 		return nil, IncorrectPasswordError
 	}
 	for _, val := range data[dlen-last:] {
@@ -189,8 +198,22 @@ func EncryptPEMBlock(rand io.Reader, blockType string, data, password []byte, al
 	if err != nil {
 		return nil, err
 	}
+	encrypted := encryptCBC(block, iv, data)
+
+	return &pem.Block{
+		Type: blockType,
+		Headers: map[string]string{
+			"Proc-Type": "4,ENCRYPTED",
+			"DEK-Info":  ciph.name + "," + hex.EncodeToString(iv),
+		},
+		Bytes: encrypted,
+	}, nil
+}
+
+// encryptCBC pads data and encrypts it with block in CBC mode.
+func encryptCBC(block cipher.Block, iv, data []byte) []byte {
 	enc := cipher.NewCBCEncrypter(block, iv)
-	pad := ciph.blockSize - len(data)%ciph.blockSize
+	pad := block.BlockSize() - len(data)%block.BlockSize()
 	encrypted := make([]byte, len(data), len(data)+pad)
 	// We could save this copy by encrypting all the whole blocks in
 	// the data separately, but it doesn't seem worth the additional
@@ -201,15 +224,7 @@ func EncryptPEMBlock(rand io.Reader, blockType string, data, password []byte, al
 		encrypted = append(encrypted, byte(pad))
 	}
 	enc.CryptBlocks(encrypted, encrypted)
-
-	return &pem.Block{
-		Type: blockType,
-		Headers: map[string]string{
-			"Proc-Type": "4,ENCRYPTED",
-			"DEK-Info":  ciph.name + "," + hex.EncodeToString(iv),
-		},
-		Bytes: encrypted,
-	}, nil
+	return encrypted
 }
 
 func cipherByName(name string) *rfc1423Algo {
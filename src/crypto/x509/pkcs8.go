@@ -5,10 +5,20 @@
 package x509
 
 import (
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 )
 
 // pkcs8 reflects an ASN.1, PKCS#8 PrivateKey. See
@@ -22,7 +32,8 @@ type pkcs8 struct {
 }
 
 // ParsePKCS8PrivateKey parses an unencrypted, PKCS#8 private key. See
-// http://www.rsa.com/rsalabs/node.asp?id=2130 and RFC5208.
+// http://www.rsa.com/rsalabs/node.asp?id=2130 and RFC5208. Encrypted keys
+// must first be decrypted with DecryptPKCS8PrivateKey.
 func ParsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
 	var privKey pkcs8
 	if _, err := asn1.Unmarshal(der, &privKey); err != nil {
@@ -48,7 +59,319 @@ func ParsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
 		}
 		return key, nil
 
+	case privKey.Algo.Algorithm.Equal(oidPublicKeyEd25519):
+		if len(privKey.Algo.Parameters.FullBytes) != 0 {
+			return nil, errors.New("x509: invalid Ed25519 private key parameters")
+		}
+		// RFC 8410, section 7: the key is a CurvePrivateKey, an OCTET
+		// STRING holding the seed.
+		var seed []byte
+		if _, err := asn1.Unmarshal(privKey.PrivateKey, &seed); err != nil {
+			return nil, errors.New("x509: failed to parse Ed25519 private key embedded in PKCS#8: " + err.Error())
+		}
+		if l := len(seed); l != ed25519.SeedSize {
+			return nil, fmt.Errorf("x509: invalid Ed25519 private key length: %d", l)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+
 	default:
 		return nil, fmt.Errorf("x509: PKCS#8 wrapping contained private key with unknown algorithm: %v", privKey.Algo.Algorithm)
 	}
 }
+
+// MarshalPKCS8PrivateKey converts a private key to PKCS#8 encoded form. The
+// following key types are supported: *rsa.PrivateKey, *ecdsa.PrivateKey and
+// ed25519.PrivateKey.
+func MarshalPKCS8PrivateKey(key interface{}) ([]byte, error) {
+	var privKey pkcs8
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		privKey.Algo = pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyRSA,
+			Parameters: asn1.RawValue{Tag: 5},
+		}
+		privKey.PrivateKey = MarshalPKCS1PrivateKey(key)
+
+	case *ecdsa.PrivateKey:
+		oid, ok := oidFromNamedCurve(key.Curve)
+		if !ok {
+			return nil, errors.New("x509: unknown curve while marshalling to PKCS#8")
+		}
+		oidBytes, err := asn1.Marshal(oid)
+		if err != nil {
+			return nil, errors.New("x509: failed to marshal curve OID: " + err.Error())
+		}
+		privKey.Algo = pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: oidBytes},
+		}
+		// The curve is already in the algorithm parameters.
+		if privKey.PrivateKey, err = marshalECPrivateKeyWithOID(key, nil); err != nil {
+			return nil, errors.New("x509: failed to marshal EC private key while building PKCS#8: " + err.Error())
+		}
+
+	case ed25519.PrivateKey:
+		privKey.Algo = pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyEd25519}
+		seed, err := asn1.Marshal(key.Seed())
+		if err != nil {
+			return nil, err
+		}
+		privKey.PrivateKey = seed
+
+	default:
+		return nil, fmt.Errorf("x509: unknown key type while marshalling PKCS#8: %T", key)
+	}
+
+	return asn1.Marshal(privKey)
+}
+
+// Encrypted PKCS#8 private keys are EncryptedPrivateKeyInfo structures
+// (RFC 5208, section 6) and are encrypted with PBES2 from PKCS #5 v2.1
+// (RFC 8018): a key derived from the password with PBKDF2 and a block
+// cipher in CBC mode.
+
+// encryptedPKCS8BlockType is the PEM block type of an encrypted PKCS#8
+// private key.
+const encryptedPKCS8BlockType = "ENCRYPTED PRIVATE KEY"
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+)
+
+// pbes2Ciphers maps the PEMCiphers to their PBES2 encryption scheme OIDs.
+var pbes2Ciphers = []struct {
+	cipher PEMCipher
+	oid    asn1.ObjectIdentifier
+}{
+	{PEMCipherDES, asn1.ObjectIdentifier{1, 3, 14, 3, 2, 7}},
+	{PEMCipher3DES, asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}},
+	{PEMCipherAES128, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}},
+	{PEMCipherAES192, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}},
+	{PEMCipherAES256, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}},
+}
+
+const (
+	// pbkdf2Iterations is the PBKDF2 iteration count used to encrypt
+	// keys, which matches OpenSSL.
+	pbkdf2Iterations = 2048
+	pbkdf2SaltSize   = 16
+
+	// pbkdf2MaxIterations bounds the PBKDF2 iteration count of a
+	// PBES2-encrypted key. The count is chosen by whoever encrypted
+	// the key, and each iteration is an HMAC over the password, so
+	// without a bound DecryptPKCS8PrivateKey could be made to run
+	// for hours.
+	pbkdf2MaxIterations = 1 << 22
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algo          pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// RFC 8018, appendix A.4
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// RFC 8018, appendix A.2. The PRF defaults to HMAC-SHA1.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// EncryptPKCS8PrivateKey encrypts der, a PKCS#8 private key as returned by
+// MarshalPKCS8PrivateKey, with password and returns a DER encoded
+// EncryptedPrivateKeyInfo, which is usually PEM encoded with the type
+// "ENCRYPTED PRIVATE KEY". The key is encrypted with PBES2, using PBKDF2
+// with HMAC-SHA256 and the given cipher in CBC mode.
+func EncryptPKCS8PrivateKey(rand io.Reader, der, password []byte, alg PEMCipher) ([]byte, error) {
+	ciph := cipherByKey(alg)
+	if ciph == nil {
+		return nil, errors.New("x509: unknown encryption mode")
+	}
+	var cipherOID asn1.ObjectIdentifier
+	for _, c := range pbes2Ciphers {
+		if c.cipher == alg {
+			cipherOID = c.oid
+		}
+	}
+
+	salt := make([]byte, pbkdf2SaltSize)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, errors.New("x509: cannot generate salt: " + err.Error())
+	}
+	iv := make([]byte, ciph.blockSize)
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return nil, errors.New("x509: cannot generate IV: " + err.Error())
+	}
+
+	key := pbkdf2(sha256.New, password, salt, pbkdf2Iterations, ciph.keySize)
+	block, err := ciph.cipherFunc(key)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := encryptCBC(block, iv, der)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF: pkix.AlgorithmIdentifier{
+			Algorithm:  oidHMACWithSHA256,
+			Parameters: asn1.RawValue{Tag: 5},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivBytes, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams},
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  cipherOID,
+			Parameters: asn1.RawValue{FullBytes: ivBytes},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedData: encrypted,
+	})
+}
+
+// DecryptPKCS8PrivateKey decrypts der, a DER encoded, PBES2 encrypted
+// PKCS#8 private key, with password and returns the PKCS#8 private key,
+// which can be parsed with ParsePKCS8PrivateKey. If an incorrect password
+// is detected an IncorrectPasswordError is returned.
+func DecryptPKCS8PrivateKey(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after encrypted PKCS#8 private key")
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("x509: unsupported PKCS#8 encryption scheme: %v", info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("x509: failed to parse PBES2 parameters: " + err.Error())
+	}
+
+	var ciph *rfc1423Algo
+	for _, c := range pbes2Ciphers {
+		if c.oid.Equal(params.EncryptionScheme.Algorithm) {
+			ciph = cipherByKey(c.cipher)
+		}
+	}
+	if ciph == nil {
+		return nil, fmt.Errorf("x509: unsupported PBES2 cipher: %v", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("x509: failed to parse PBES2 IV: " + err.Error())
+	}
+	if len(iv) != ciph.blockSize {
+		return nil, errors.New("x509: incorrect IV size")
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("x509: unsupported PBES2 key derivation function: %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.New("x509: failed to parse PBKDF2 parameters: " + err.Error())
+	}
+	if kdfParams.IterationCount <= 0 {
+		return nil, errors.New("x509: invalid PBKDF2 iteration count")
+	}
+	if kdfParams.IterationCount > pbkdf2MaxIterations {
+		return nil, fmt.Errorf("x509: PBKDF2 iteration count %d is too large", kdfParams.IterationCount)
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != ciph.keySize {
+		return nil, errors.New("x509: incorrect PBKDF2 key length")
+	}
+	var h func() hash.Hash
+	switch prf := kdfParams.PRF.Algorithm; {
+	case len(prf) == 0, prf.Equal(oidHMACWithSHA1):
+		h = sha1.New
+	case prf.Equal(oidHMACWithSHA256):
+		h = sha256.New
+	case prf.Equal(oidHMACWithSHA384):
+		h = sha512.New384
+	case prf.Equal(oidHMACWithSHA512):
+		h = sha512.New
+	default:
+		return nil, fmt.Errorf("x509: unsupported PBKDF2 pseudorandom function: %v", prf)
+	}
+
+	key := pbkdf2(h, password, kdfParams.Salt, kdfParams.IterationCount, ciph.keySize)
+	block, err := ciph.cipherFunc(key)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(info.EncryptedData))
+	if len(data)%ciph.blockSize != 0 {
+		return nil, errors.New("x509: invalid padding")
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, info.EncryptedData)
+	return unpadCBC(data, ciph.blockSize)
+}
+
+// pbkdf2 derives a keyLen byte key from password and salt with PBKDF2, using
+// HMAC with the hash h as the pseudorandom function. See RFC 8018, section
+// 5.2.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		// U_1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		prf.Write(salt)
+		buf[0] = byte(block >> 24)
+		buf[1] = byte(block >> 16)
+		buf[2] = byte(block >> 8)
+		buf[3] = byte(block)
+		prf.Write(buf[:4])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		// T_block = U_1 xor U_2 xor ... xor U_iter
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -5,8 +5,13 @@
 package x509
 
 import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"net"
+	"net/url"
+	"reflect"
 	"runtime"
 	"strings"
 	"time"
@@ -23,8 +28,9 @@ const (
 	// given in the VerifyOptions.
 	Expired
 	// CANotAuthorizedForThisName results when an intermediate or root
-	// certificate has a name constraint which doesn't include the name
-	// being checked.
+	// certificate has a name constraint which doesn't permit, or excludes,
+	// a name in a certificate below it in the chain or the name being
+	// checked.
 	CANotAuthorizedForThisName
 	// TooManyIntermediates results when a path length constraint is
 	// violated.
@@ -32,6 +38,13 @@ const (
 	// IncompatibleUsage results when the certificate's key usage indicates
 	// that it may only be used for a different purpose.
 	IncompatibleUsage
+	// InvalidPolicy results when a chain isn't valid for the certificate
+	// policies required by the VerifyOptions or by a CA in the chain, or
+	// when a CA maps a policy to or from anyPolicy.
+	InvalidPolicy
+	// Revoked results when a certificate is listed in a CRL from its
+	// issuer given in the VerifyOptions.
+	Revoked
 )
 
 // CertificateInvalidError results when an odd error occurs. Users of this
@@ -53,6 +66,10 @@ func (e CertificateInvalidError) Error() string {
 		return "x509: too many intermediates for path length constraint"
 	case IncompatibleUsage:
 		return "x509: certificate specifies an incompatible key usage"
+	case InvalidPolicy:
+		return "x509: certificate chain is not valid for the required certificate policies"
+	case Revoked:
+		return "x509: certificate has been revoked"
 	}
 	return "x509: unknown error"
 }
@@ -134,6 +151,25 @@ type VerifyOptions struct {
 	// constraint down the chain which mirrors Windows CryptoAPI behaviour,
 	// but not the spec. To accept any key usage, include ExtKeyUsageAny.
 	KeyUsages []ExtKeyUsage
+
+	// CertificatePolicies is the user-initial-policy-set of RFC 5280,
+	// 6.1.1: the policies that are acceptable for the leaf. If empty, any
+	// policy is. As in RFC 5280, a chain is only rejected for its policies
+	// if RequireExplicitPolicy is set or a CA in the chain requires an
+	// explicit policy.
+	CertificatePolicies []asn1.ObjectIdentifier
+	// RequireExplicitPolicy, InhibitPolicyMapping and InhibitAnyPolicy
+	// are the initial-explicit-policy, initial-policy-mapping-inhibit and
+	// initial-any-policy-inhibit inputs of RFC 5280, 6.1.1.
+	RequireExplicitPolicy bool
+	InhibitPolicyMapping  bool
+	InhibitAnyPolicy      bool
+
+	// CRLs contains certificate revocation lists, as returned by ParseCRL,
+	// that chains are checked against: a certificate that a CRL signed by
+	// its issuer lists as revoked before CurrentTime is rejected.
+	// Certificates whose issuer has no CRL here aren't checked.
+	CRLs []*pkix.CertificateList
 }
 
 const (
@@ -152,20 +188,9 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 		return CertificateInvalidError{c, Expired}
 	}
 
-	if len(c.PermittedDNSDomains) > 0 {
-		ok := false
-		for _, domain := range c.PermittedDNSDomains {
-			if opts.DNSName == domain ||
-				(strings.HasSuffix(opts.DNSName, domain) &&
-					len(opts.DNSName) >= 1+len(domain) &&
-					opts.DNSName[len(opts.DNSName)-len(domain)-1] == '.') {
-				ok = true
-				break
-			}
-		}
-
-		if !ok {
-			return CertificateInvalidError{c, CANotAuthorizedForThisName}
+	if certType != leafCertificate && hasNameConstraints(c) {
+		if err := c.checkNameConstraints(currentChain, opts); err != nil {
+			return err
 		}
 	}
 
@@ -208,7 +233,12 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 // If opts.Roots is nil and system roots are unavailable the returned error
 // will be of type SystemRootsError.
 //
-// WARNING: this doesn't do any revocation checking.
+// Chains are validated as in RFC 5280, section 6.1, including name
+// constraints and certificate policies. Revocation is only checked against
+// the CRLs in opts.
+//
+// On Windows, when opts.Roots is nil, the system's own verification is
+// used and the policy and CRL options are ignored.
 func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err error) {
 	// Use Windows's own verification and chain building.
 	if opts.Roots == nil && runtime.GOOS == "windows" {
@@ -244,22 +274,40 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 		keyUsages = []ExtKeyUsage{ExtKeyUsageServerAuth}
 	}
 
-	// If any key usage is acceptable then we're done.
+	anyUsage := false
 	for _, usage := range keyUsages {
 		if usage == ExtKeyUsageAny {
-			chains = candidateChains
-			return
+			anyUsage = true
+			break
 		}
 	}
 
+	// The first reason a chain was rejected is returned if none are left.
+	var chainErr error
 	for _, candidate := range candidateChains {
-		if checkChainForKeyUsage(candidate, keyUsages) {
-			chains = append(chains, candidate)
+		if !anyUsage && !checkChainForKeyUsage(candidate, keyUsages) {
+			if chainErr == nil {
+				chainErr = CertificateInvalidError{c, IncompatibleUsage}
+			}
+			continue
+		}
+		if err := checkChainPolicies(candidate, &opts); err != nil {
+			if chainErr == nil {
+				chainErr = err
+			}
+			continue
+		}
+		if err := checkChainRevocation(candidate, &opts); err != nil {
+			if chainErr == nil {
+				chainErr = err
+			}
+			continue
 		}
+		chains = append(chains, candidate)
 	}
 
 	if len(chains) == 0 {
-		err = CertificateInvalidError{c, IncompatibleUsage}
+		err = chainErr
 	}
 
 	return
@@ -474,3 +522,536 @@ NextCert:
 
 	return true
 }
+
+// oidEmailAddress is the PKCS #9 emailAddress attribute, which RFC 5280,
+// 4.2.1.10, requires to be checked against email constraints.
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+// checkNameConstraints checks the names in chain, the certificates that c,
+// a CA, issued directly or through other CAs, against c's name
+// constraints. See RFC 5280, 6.1.3 (b) and (c).
+func (c *Certificate) checkNameConstraints(chain []*Certificate, opts *VerifyOptions) error {
+	for i, cert := range chain {
+		// Self-issued intermediates, used to roll over keys, are exempt.
+		if i > 0 && bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			continue
+		}
+		var dnsName string
+		if i == 0 {
+			dnsName = opts.DNSName
+		}
+		if !c.permitsNames(cert, dnsName) {
+			return CertificateInvalidError{c, CANotAuthorizedForThisName}
+		}
+	}
+	return nil
+}
+
+// permitsNames reports whether all the names in cert, and dnsName if it's
+// a host name, are allowed by c's name constraints.
+func (c *Certificate) permitsNames(cert *Certificate, dnsName string) bool {
+	var subject pkix.RDNSequence
+	if _, err := asn1.Unmarshal(cert.RawSubject, &subject); err != nil {
+		return false
+	}
+
+	dnsNames := cert.DNSNames
+	if len(dnsName) > 0 && net.ParseIP(strings.Trim(dnsName, "[]")) == nil {
+		dnsNames = append(dnsNames[:len(dnsNames):len(dnsNames)], dnsName)
+	}
+	for _, name := range dnsNames {
+		if !permitsName(name, c.PermittedDNSDomains, c.ExcludedDNSDomains, matchDomainConstraint) {
+			return false
+		}
+	}
+
+	emails := cert.EmailAddresses
+	for _, rdn := range subject {
+		for _, atv := range rdn {
+			if email, ok := atv.Value.(string); ok && atv.Type.Equal(oidEmailAddress) {
+				emails = append(emails[:len(emails):len(emails)], email)
+			}
+		}
+	}
+	for _, email := range emails {
+		if !permitsName(email, c.PermittedEmailAddresses, c.ExcludedEmailAddresses, matchEmailConstraint) {
+			return false
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		if len(c.PermittedURIDomains) == 0 && len(c.ExcludedURIDomains) == 0 {
+			break
+		}
+		// A URI without a host name can't be checked.
+		host, ok := uriHost(uri)
+		if !ok || !permitsName(host, c.PermittedURIDomains, c.ExcludedURIDomains, matchURIConstraint) {
+			return false
+		}
+	}
+
+	for _, ip := range cert.IPAddresses {
+		if !permitsIP(ip, c.PermittedIPRanges, c.ExcludedIPRanges) {
+			return false
+		}
+	}
+
+	if len(subject) > 0 {
+		for _, constraint := range c.ExcludedDirectoryNames {
+			if matchDirectoryName(subject, constraint) {
+				return false
+			}
+		}
+		if len(c.PermittedDirectoryNames) > 0 {
+			ok := false
+			for _, constraint := range c.PermittedDirectoryNames {
+				if matchDirectoryName(subject, constraint) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// permitsName reports whether name matches none of the excluded
+// constraints and, if there are any, one of the permitted ones.
+func permitsName(name string, permitted, excluded []string, match func(name, constraint string) bool) bool {
+	for _, constraint := range excluded {
+		if match(name, constraint) {
+			return false
+		}
+	}
+	if len(permitted) == 0 {
+		return true
+	}
+	for _, constraint := range permitted {
+		if match(name, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+func permitsIP(ip net.IP, permitted, excluded []*net.IPNet) bool {
+	for _, ipNet := range excluded {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	if len(permitted) == 0 {
+		return true
+	}
+	for _, ipNet := range permitted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomainConstraint reports whether domain is within constraint: equal
+// to it or one of its subdomains, or only the latter if constraint starts
+// with a period.
+func matchDomainConstraint(domain, constraint string) bool {
+	if len(constraint) == 0 {
+		return true
+	}
+	domain = toLowerCaseASCII(domain)
+	constraint = toLowerCaseASCII(constraint)
+	if constraint[0] == '.' {
+		return len(domain) > len(constraint) && strings.HasSuffix(domain, constraint)
+	}
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+// matchEmailConstraint reports whether mailbox is within constraint: a
+// particular mailbox, all mailboxes on a host, or, if it starts with a
+// period, all mailboxes on the subdomains of a domain.
+func matchEmailConstraint(mailbox, constraint string) bool {
+	at := strings.LastIndex(mailbox, "@")
+	if at < 0 {
+		return false
+	}
+	local, host := mailbox[:at], mailbox[at+1:]
+	if at := strings.LastIndex(constraint, "@"); at >= 0 {
+		// The local part is case sensitive. See RFC 5280, 7.5.
+		return local == constraint[:at] && strings.EqualFold(host, constraint[at+1:])
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return matchDomainConstraint(host, constraint)
+	}
+	return strings.EqualFold(host, constraint)
+}
+
+// matchURIConstraint reports whether host, the host name of a URI, is
+// within constraint: equal to it or, if it starts with a period, one of
+// its subdomains.
+func matchURIConstraint(host, constraint string) bool {
+	if strings.HasPrefix(constraint, ".") {
+		return matchDomainConstraint(host, constraint)
+	}
+	return strings.EqualFold(host, constraint)
+}
+
+// uriHost returns the host name of uri, if it has one that isn't an IP
+// address.
+func uriHost(uri *url.URL) (string, bool) {
+	host := uri.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if len(host) == 0 || net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return "", false
+	}
+	return host, true
+}
+
+// matchDirectoryName reports whether name starts with the RDNs of
+// constraint. Strings are compared ignoring case and repeated white
+// space.
+func matchDirectoryName(name, constraint pkix.RDNSequence) bool {
+	if len(constraint) > len(name) {
+		return false
+	}
+	for i, rdn := range constraint {
+		if len(rdn) != len(name[i]) {
+			return false
+		}
+		for j, atv := range rdn {
+			other := name[i][j]
+			if !atv.Type.Equal(other.Type) {
+				return false
+			}
+			s1, ok1 := atv.Value.(string)
+			s2, ok2 := other.Value.(string)
+			if ok1 && ok2 {
+				if !strings.EqualFold(strings.Join(strings.Fields(s1), " "), strings.Join(strings.Fields(s2), " ")) {
+					return false
+				}
+			} else if !reflect.DeepEqual(atv.Value, other.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var oidAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+// A policyNode is a node of the valid_policy_tree of RFC 5280, 6.1.2.
+type policyNode struct {
+	validPolicy      asn1.ObjectIdentifier
+	expectedPolicies []asn1.ObjectIdentifier
+	parent           *policyNode
+}
+
+func newPolicyNode(policy asn1.ObjectIdentifier, parent *policyNode) *policyNode {
+	return &policyNode{policy, []asn1.ObjectIdentifier{policy}, parent}
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkChainPolicies runs the certificate policy processing of RFC 5280,
+// section 6.1, over chain, which runs from the leaf to the trust anchor.
+// The tree is kept as a list of levels, the nodes at each depth.
+func checkChainPolicies(chain []*Certificate, opts *VerifyOptions) error {
+	// The trust anchor isn't processed.
+	n := len(chain) - 1
+	explicitPolicy, policyMapping, inhibitAnyPolicy := n+1, n+1, n+1
+	if opts.RequireExplicitPolicy {
+		explicitPolicy = 0
+	}
+	if opts.InhibitPolicyMapping {
+		policyMapping = 0
+	}
+	if opts.InhibitAnyPolicy {
+		inhibitAnyPolicy = 0
+	}
+	tree := [][]*policyNode{{newPolicyNode(oidAnyPolicy, nil)}}
+
+	for i := 1; i <= n; i++ {
+		cert := chain[n-i]
+		selfIssued := bytes.Equal(cert.RawIssuer, cert.RawSubject)
+
+		// 6.1.3 (d) and (e): extend the tree with the certificate's
+		// policies, or delete it if there are none.
+		if tree != nil && len(cert.PolicyIdentifiers) > 0 {
+			tree = append(tree, nextPolicyLevel(tree[i-1], cert.PolicyIdentifiers, inhibitAnyPolicy > 0 || i < n && selfIssued))
+			tree = prunePolicyTree(tree)
+		} else {
+			tree = nil
+		}
+		// 6.1.3 (f)
+		if explicitPolicy == 0 && tree == nil {
+			return CertificateInvalidError{cert, InvalidPolicy}
+		}
+		if i == n {
+			break
+		}
+
+		// 6.1.4 (a) and (b): apply policy mappings.
+		for _, mapping := range cert.PolicyMappings {
+			if mapping.IssuerDomainPolicy.Equal(oidAnyPolicy) || mapping.SubjectDomainPolicy.Equal(oidAnyPolicy) {
+				return CertificateInvalidError{cert, InvalidPolicy}
+			}
+		}
+		if tree != nil && len(cert.PolicyMappings) > 0 {
+			tree = applyPolicyMappings(tree, cert.PolicyMappings, policyMapping > 0)
+		}
+
+		// 6.1.4 (h), (i) and (j): update the counters.
+		if !selfIssued {
+			if explicitPolicy > 0 {
+				explicitPolicy--
+			}
+			if policyMapping > 0 {
+				policyMapping--
+			}
+			if inhibitAnyPolicy > 0 {
+				inhibitAnyPolicy--
+			}
+		}
+		if v := policySkipCerts(cert.RequireExplicitPolicy, cert.RequireExplicitPolicyZero); v >= 0 && v < explicitPolicy {
+			explicitPolicy = v
+		}
+		if v := policySkipCerts(cert.InhibitPolicyMapping, cert.InhibitPolicyMappingZero); v >= 0 && v < policyMapping {
+			policyMapping = v
+		}
+		if v := policySkipCerts(cert.InhibitAnyPolicy, cert.InhibitAnyPolicyZero); v >= 0 && v < inhibitAnyPolicy {
+			inhibitAnyPolicy = v
+		}
+	}
+
+	// 6.1.5 (a), (b) and (g): wrap up with the leaf.
+	leaf := chain[0]
+	if explicitPolicy > 0 {
+		explicitPolicy--
+	}
+	if policySkipCerts(leaf.RequireExplicitPolicy, leaf.RequireExplicitPolicyZero) == 0 {
+		explicitPolicy = 0
+	}
+	if tree != nil && len(opts.CertificatePolicies) > 0 && !containsOID(opts.CertificatePolicies, oidAnyPolicy) {
+		tree = intersectPolicyTree(tree, opts.CertificatePolicies)
+	}
+	if explicitPolicy == 0 && tree == nil {
+		return CertificateInvalidError{leaf, InvalidPolicy}
+	}
+	return nil
+}
+
+// nextPolicyLevel returns the nodes for a certificate with the given
+// policies below the nodes in prev. See RFC 5280, 6.1.3 (d).
+func nextPolicyLevel(prev []*policyNode, policies []asn1.ObjectIdentifier, allowAny bool) []*policyNode {
+	var level []*policyNode
+	hasAny := false
+	for _, policy := range policies {
+		if policy.Equal(oidAnyPolicy) {
+			hasAny = true
+			continue
+		}
+		matched := false
+		for _, node := range prev {
+			if containsOID(node.expectedPolicies, policy) {
+				level = append(level, newPolicyNode(policy, node))
+				matched = true
+			}
+		}
+		if matched {
+			continue
+		}
+		for _, node := range prev {
+			if node.validPolicy.Equal(oidAnyPolicy) {
+				level = append(level, newPolicyNode(policy, node))
+			}
+		}
+	}
+
+	if hasAny && allowAny {
+		for _, node := range prev {
+		nextExpected:
+			for _, policy := range node.expectedPolicies {
+				for _, child := range level {
+					if child.parent == node && child.validPolicy.Equal(policy) {
+						continue nextExpected
+					}
+				}
+				level = append(level, newPolicyNode(policy, node))
+			}
+		}
+	}
+	return level
+}
+
+// applyPolicyMappings applies the mappings of the certificate at the
+// deepest level of tree, or deletes the mapped policies if mapping is
+// inhibited. See RFC 5280, 6.1.4 (b).
+func applyPolicyMappings(tree [][]*policyNode, mappings []PolicyMapping, allowMapping bool) [][]*policyNode {
+	level := tree[len(tree)-1]
+	var issuerPolicies []asn1.ObjectIdentifier
+	for _, mapping := range mappings {
+		if !containsOID(issuerPolicies, mapping.IssuerDomainPolicy) {
+			issuerPolicies = append(issuerPolicies, mapping.IssuerDomainPolicy)
+		}
+	}
+
+	for _, issuerPolicy := range issuerPolicies {
+		if !allowMapping {
+			var kept []*policyNode
+			for _, node := range level {
+				if !node.validPolicy.Equal(issuerPolicy) {
+					kept = append(kept, node)
+				}
+			}
+			level = kept
+			continue
+		}
+
+		var subjectPolicies []asn1.ObjectIdentifier
+		for _, mapping := range mappings {
+			if mapping.IssuerDomainPolicy.Equal(issuerPolicy) && !containsOID(subjectPolicies, mapping.SubjectDomainPolicy) {
+				subjectPolicies = append(subjectPolicies, mapping.SubjectDomainPolicy)
+			}
+		}
+		found := false
+		for _, node := range level {
+			if node.validPolicy.Equal(issuerPolicy) {
+				node.expectedPolicies = subjectPolicies
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		for _, node := range level {
+			if node.validPolicy.Equal(oidAnyPolicy) {
+				level = append(level, &policyNode{issuerPolicy, subjectPolicies, node.parent})
+				break
+			}
+		}
+	}
+
+	tree[len(tree)-1] = level
+	return prunePolicyTree(tree)
+}
+
+// intersectPolicyTree keeps the branches of tree that are valid for
+// policies. See RFC 5280, 6.1.5 (g) (iii).
+func intersectPolicyTree(tree [][]*policyNode, policies []asn1.ObjectIdentifier) [][]*policyNode {
+	deleted := make(map[*policyNode]bool)
+	var validNodes []*policyNode
+	for depth, level := range tree {
+		var kept []*policyNode
+		for _, node := range level {
+			if node.parent != nil && deleted[node.parent] {
+				deleted[node] = true
+				continue
+			}
+			if node.parent != nil && node.parent.validPolicy.Equal(oidAnyPolicy) {
+				if !node.validPolicy.Equal(oidAnyPolicy) && !containsOID(policies, node.validPolicy) {
+					deleted[node] = true
+					continue
+				}
+				validNodes = append(validNodes, node)
+			}
+			kept = append(kept, node)
+		}
+		tree[depth] = kept
+	}
+
+	// An anyPolicy node at the leaf's depth stands for each acceptable
+	// policy that isn't already in the tree.
+	var leafLevel []*policyNode
+	for _, node := range tree[len(tree)-1] {
+		if !node.validPolicy.Equal(oidAnyPolicy) {
+			leafLevel = append(leafLevel, node)
+			continue
+		}
+	nextPolicy:
+		for _, policy := range policies {
+			for _, valid := range validNodes {
+				if valid.validPolicy.Equal(policy) {
+					continue nextPolicy
+				}
+			}
+			leafLevel = append(leafLevel, newPolicyNode(policy, node.parent))
+		}
+	}
+	tree[len(tree)-1] = leafLevel
+	return prunePolicyTree(tree)
+}
+
+// prunePolicyTree deletes the nodes above the deepest level that have no
+// children, and returns nil if that leaves the tree empty.
+func prunePolicyTree(tree [][]*policyNode) [][]*policyNode {
+	for depth := len(tree) - 2; depth >= 0; depth-- {
+		var kept []*policyNode
+		for _, node := range tree[depth] {
+			for _, child := range tree[depth+1] {
+				if child.parent == node {
+					kept = append(kept, node)
+					break
+				}
+			}
+		}
+		tree[depth] = kept
+	}
+	if len(tree[0]) == 0 {
+		return nil
+	}
+	return tree
+}
+
+// checkChainRevocation checks the certificates in chain, other than the
+// trust anchor, against the CRLs in opts.
+func checkChainRevocation(chain []*Certificate, opts *VerifyOptions) error {
+	if len(opts.CRLs) == 0 {
+		return nil
+	}
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		cert, issuer := chain[i], chain[i+1]
+		for _, crl := range opts.CRLs {
+			if !issuer.issuedCRL(crl) {
+				continue
+			}
+			for _, revoked := range crl.TBSCertList.RevokedCertificates {
+				if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 && !revoked.RevocationTime.After(now) {
+					return CertificateInvalidError{cert, Revoked}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// issuedCRL reports whether crl was issued and signed by c.
+func (c *Certificate) issuedCRL(crl *pkix.CertificateList) bool {
+	if c.KeyUsage != 0 && c.KeyUsage&KeyUsageCRLSign == 0 {
+		return false
+	}
+	var subject pkix.RDNSequence
+	if _, err := asn1.Unmarshal(c.RawSubject, &subject); err != nil {
+		return false
+	}
+	issuer := crl.TBSCertList.Issuer
+	if len(subject) != len(issuer) || !matchDirectoryName(subject, issuer) {
+		return false
+	}
+	return c.CheckCRLSignature(crl) == nil
+}
@@ -5,9 +5,19 @@
 package x509
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -411,6 +421,455 @@ func nameToKey(name *pkix.Name) string {
 	return strings.Join(name.Country, ",") + "/" + strings.Join(name.Organization, ",") + "/" + strings.Join(name.OrganizationalUnit, ",") + "/" + name.CommonName
 }
 
+// generatedChain is a root, intermediate and leaf certificate made for a
+// test, with the keys that signed them.
+type generatedChain struct {
+	root, intermediate, leaf          *Certificate
+	rootKey, intermediateKey, leafKey crypto.Signer
+}
+
+var generatedSerial int64
+
+// generateTestCert issues a certificate for key, signed by signer, the key of
+// parent, or self-signed if parent is nil.
+func generateTestCert(t *testing.T, template, parent *Certificate, signer, key crypto.Signer) *Certificate {
+	generatedSerial++
+	template.SerialNumber = big.NewInt(generatedSerial)
+	template.NotBefore = time.Unix(1000, 0)
+	template.NotAfter = time.Unix(100000, 0)
+	if parent == nil {
+		parent = template
+	}
+	der, err := CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// generateChain returns a chain whose intermediate and leaf are made from
+// the given templates.
+func generateChain(t *testing.T, intermediate, leaf *Certificate) *generatedChain {
+	var keys [3]crypto.Signer
+	for i := range keys {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	return generateChainWithKeys(t, keys, intermediate, leaf)
+}
+
+func generateChainWithKeys(t *testing.T, keys [3]crypto.Signer, intermediate, leaf *Certificate) *generatedChain {
+	chain := &generatedChain{rootKey: keys[0], intermediateKey: keys[1], leafKey: keys[2]}
+	chain.root = generateTestCert(t, &Certificate{
+		Subject:               pkix.Name{CommonName: "Root"},
+		BasicConstraintsValid: true,
+		IsCA: true,
+	}, nil, keys[0], keys[0])
+	if len(intermediate.Subject.CommonName) == 0 {
+		intermediate.Subject.CommonName = "Intermediate"
+	}
+	intermediate.BasicConstraintsValid = true
+	intermediate.IsCA = true
+	chain.intermediate = generateTestCert(t, intermediate, chain.root, keys[0], keys[1])
+	if len(leaf.Subject.CommonName) == 0 {
+		leaf.Subject.CommonName = "Leaf"
+	}
+	chain.leaf = generateTestCert(t, leaf, chain.intermediate, keys[1], keys[2])
+	return chain
+}
+
+func (c *generatedChain) verify(opts VerifyOptions) error {
+	opts.Roots = NewCertPool()
+	opts.Roots.AddCert(c.root)
+	opts.Intermediates = NewCertPool()
+	opts.Intermediates.AddCert(c.intermediate)
+	opts.CurrentTime = time.Unix(5000, 0)
+	_, err := c.leaf.Verify(opts)
+	return err
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+var nameConstraintsTests = []struct {
+	constraints Certificate
+	leaf        Certificate
+	dnsName     string
+	ok          bool
+}{
+	{
+		constraints: Certificate{PermittedDNSDomains: []string{"example.com"}},
+		leaf:        Certificate{DNSNames: []string{"example.com", "www.EXAMPLE.com"}},
+		ok:          true,
+	},
+	{
+		constraints: Certificate{PermittedDNSDomains: []string{"example.com"}},
+		leaf:        Certificate{DNSNames: []string{"www.notexample.com"}},
+	},
+	{
+		constraints: Certificate{PermittedDNSDomains: []string{".example.com"}},
+		leaf:        Certificate{DNSNames: []string{"example.com"}},
+	},
+	{
+		constraints: Certificate{
+			PermittedDNSDomains: []string{"example.com"},
+			ExcludedDNSDomains:  []string{"internal.example.com"},
+		},
+		leaf: Certificate{DNSNames: []string{"host.internal.example.com"}},
+	},
+	{
+		// The name being verified is checked even if it's missing
+		// from the certificate, which then matches on its common name.
+		constraints: Certificate{PermittedDNSDomains: []string{"example.com"}},
+		leaf:        Certificate{Subject: pkix.Name{CommonName: "example.org"}},
+		dnsName:     "example.org",
+	},
+	{
+		constraints: Certificate{PermittedIPRanges: []*net.IPNet{mustParseCIDR("10.0.0.0/8")}},
+		leaf:        Certificate{IPAddresses: []net.IP{net.ParseIP("10.1.2.3")}},
+		ok:          true,
+	},
+	{
+		constraints: Certificate{
+			PermittedIPRanges: []*net.IPNet{mustParseCIDR("10.0.0.0/8")},
+			ExcludedIPRanges:  []*net.IPNet{mustParseCIDR("2001:db8::/32")},
+		},
+		leaf: Certificate{IPAddresses: []net.IP{net.ParseIP("2001:db8::1")}},
+	},
+	{
+		constraints: Certificate{PermittedEmailAddresses: []string{"admin@example.com", ".example.org"}},
+		leaf:        Certificate{EmailAddresses: []string{"admin@EXAMPLE.com", "root@mail.example.org"}},
+		ok:          true,
+	},
+	{
+		constraints: Certificate{PermittedEmailAddresses: []string{"admin@example.com"}},
+		leaf:        Certificate{EmailAddresses: []string{"Admin@example.com"}},
+	},
+	{
+		constraints: Certificate{ExcludedEmailAddresses: []string{"example.com"}},
+		leaf:        Certificate{EmailAddresses: []string{"admin@example.com"}},
+	},
+	{
+		constraints: Certificate{PermittedURIDomains: []string{".example.com"}},
+		leaf:        Certificate{URIs: []*url.URL{mustParseURL("https://www.example.com:8443/path")}},
+		ok:          true,
+	},
+	{
+		constraints: Certificate{PermittedURIDomains: []string{".example.com"}},
+		leaf:        Certificate{URIs: []*url.URL{mustParseURL("https://10.0.0.1/")}},
+	},
+	{
+		constraints: Certificate{ExcludedURIDomains: []string{"example.com"}},
+		leaf:        Certificate{URIs: []*url.URL{mustParseURL("urn:example")}},
+	},
+	{
+		constraints: Certificate{PermittedDirectoryNames: []pkix.RDNSequence{
+			pkix.Name{Country: []string{"US"}, Organization: []string{"Acme  Co"}}.ToRDNSequence(),
+		}},
+		leaf: Certificate{Subject: pkix.Name{Country: []string{"US"}, Organization: []string{"ACME Co"}}},
+		ok:   true,
+	},
+	{
+		constraints: Certificate{PermittedDirectoryNames: []pkix.RDNSequence{
+			pkix.Name{Organization: []string{"Acme Co"}}.ToRDNSequence(),
+		}},
+		leaf: Certificate{Subject: pkix.Name{Organization: []string{"Other Co"}}},
+	},
+	{
+		constraints: Certificate{ExcludedDirectoryNames: []pkix.RDNSequence{
+			pkix.Name{Organization: []string{"Acme Co"}}.ToRDNSequence(),
+		}},
+		leaf: Certificate{Subject: pkix.Name{Organization: []string{"Acme Co"}, OrganizationalUnit: []string{"Sales"}}},
+	},
+}
+
+func TestNameConstraints(t *testing.T) {
+	for i, test := range nameConstraintsTests {
+		constraints, leaf := test.constraints, test.leaf
+		chain := generateChain(t, &constraints, &leaf)
+		err := chain.verify(VerifyOptions{DNSName: test.dnsName})
+		if test.ok {
+			if err != nil {
+				t.Errorf("#%d: unexpected failure: %s", i, err)
+			}
+			continue
+		}
+		if err, ok := err.(CertificateInvalidError); !ok || err.Reason != CANotAuthorizedForThisName || err.Cert != chain.intermediate {
+			t.Errorf("#%d: got error %v, want the intermediate not to be authorized", i, err)
+		}
+	}
+}
+
+func TestNameConstraintsRoundTrip(t *testing.T) {
+	template := Certificate{
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         []string{"example.com"},
+		ExcludedDNSDomains:          []string{".internal.example.com"},
+		PermittedIPRanges:           []*net.IPNet{mustParseCIDR("10.0.0.0/8"), mustParseCIDR("2001:db8::/32")},
+		ExcludedIPRanges:            []*net.IPNet{mustParseCIDR("10.1.0.0/16")},
+		PermittedEmailAddresses:     []string{"example.com"},
+		ExcludedEmailAddresses:      []string{"root@example.com"},
+		PermittedURIDomains:         []string{".example.com"},
+		ExcludedURIDomains:          []string{"bad.example.com"},
+		PermittedDirectoryNames:     []pkix.RDNSequence{pkix.Name{Organization: []string{"Acme Co"}}.ToRDNSequence()},
+		ExcludedDirectoryNames:      []pkix.RDNSequence{pkix.Name{Organization: []string{"Acme Co"}, OrganizationalUnit: []string{"Legal"}}.ToRDNSequence()},
+	}
+	leaf := Certificate{
+		Subject: pkix.Name{Organization: []string{"Acme Co"}},
+		URIs:    []*url.URL{mustParseURL("spiffe://svc.example.com/service")},
+	}
+	chain := generateChain(t, &template, &leaf)
+	got := chain.intermediate
+
+	for _, field := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"PermittedDNSDomains", got.PermittedDNSDomains, template.PermittedDNSDomains},
+		{"ExcludedDNSDomains", got.ExcludedDNSDomains, template.ExcludedDNSDomains},
+		{"PermittedIPRanges", got.PermittedIPRanges, template.PermittedIPRanges},
+		{"ExcludedIPRanges", got.ExcludedIPRanges, template.ExcludedIPRanges},
+		{"PermittedEmailAddresses", got.PermittedEmailAddresses, template.PermittedEmailAddresses},
+		{"ExcludedEmailAddresses", got.ExcludedEmailAddresses, template.ExcludedEmailAddresses},
+		{"PermittedURIDomains", got.PermittedURIDomains, template.PermittedURIDomains},
+		{"ExcludedURIDomains", got.ExcludedURIDomains, template.ExcludedURIDomains},
+		{"PermittedDirectoryNames", got.PermittedDirectoryNames, template.PermittedDirectoryNames},
+		{"ExcludedDirectoryNames", got.ExcludedDirectoryNames, template.ExcludedDirectoryNames},
+	} {
+		if !reflect.DeepEqual(field.got, field.want) {
+			t.Errorf("%s: got %v, want %v", field.name, field.got, field.want)
+		}
+	}
+	if len(chain.leaf.URIs) != 1 || chain.leaf.URIs[0].String() != "spiffe://svc.example.com/service" {
+		t.Errorf("got URIs %v", chain.leaf.URIs)
+	}
+	if err := chain.verify(VerifyOptions{}); err != nil {
+		t.Errorf("unexpected failure: %s", err)
+	}
+}
+
+var (
+	testPolicy1 = asn1.ObjectIdentifier{1, 2, 3, 1}
+	testPolicy2 = asn1.ObjectIdentifier{1, 2, 3, 2}
+)
+
+var policyTests = []struct {
+	intermediate Certificate
+	leaf         Certificate
+	opts         VerifyOptions
+	ok           bool
+}{
+	{
+		intermediate: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{oidAnyPolicy}},
+		leaf:         Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1}},
+		opts:         VerifyOptions{CertificatePolicies: []asn1.ObjectIdentifier{testPolicy1}, RequireExplicitPolicy: true},
+		ok:           true,
+	},
+	{
+		intermediate: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{oidAnyPolicy}},
+		leaf:         Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1}},
+		opts:         VerifyOptions{CertificatePolicies: []asn1.ObjectIdentifier{testPolicy2}, RequireExplicitPolicy: true},
+	},
+	{
+		// Without an explicit policy required, any chain is acceptable.
+		intermediate: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{oidAnyPolicy}},
+		leaf:         Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1}},
+		opts:         VerifyOptions{CertificatePolicies: []asn1.ObjectIdentifier{testPolicy2}},
+		ok:           true,
+	},
+	{
+		intermediate: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1}},
+		leaf:         Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy2}},
+		opts:         VerifyOptions{RequireExplicitPolicy: true},
+	},
+	{
+		// The intermediate maps testPolicy1 in its own domain to
+		// testPolicy2 in the leaf's.
+		intermediate: Certificate{
+			PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1},
+			PolicyMappings:    []PolicyMapping{{testPolicy1, testPolicy2}},
+		},
+		leaf: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy2}},
+		opts: VerifyOptions{CertificatePolicies: []asn1.ObjectIdentifier{testPolicy1}, RequireExplicitPolicy: true},
+		ok:   true,
+	},
+	{
+		intermediate: Certificate{
+			PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1},
+			PolicyMappings:    []PolicyMapping{{testPolicy1, testPolicy2}},
+		},
+		leaf: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy2}},
+		opts: VerifyOptions{CertificatePolicies: []asn1.ObjectIdentifier{testPolicy1}, RequireExplicitPolicy: true, InhibitPolicyMapping: true},
+	},
+	{
+		intermediate: Certificate{
+			PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1},
+			PolicyMappings:    []PolicyMapping{{testPolicy1, oidAnyPolicy}},
+		},
+		leaf: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1}},
+	},
+	{
+		intermediate: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{oidAnyPolicy}},
+		leaf:         Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1}},
+		opts:         VerifyOptions{RequireExplicitPolicy: true, InhibitAnyPolicy: true},
+	},
+	{
+		intermediate: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{oidAnyPolicy}},
+		leaf:         Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy1}},
+		opts:         VerifyOptions{InhibitAnyPolicy: true},
+		ok:           true,
+	},
+	{
+		// The intermediate requires an explicit policy from the leaf
+		// on.
+		intermediate: Certificate{
+			PolicyIdentifiers:         []asn1.ObjectIdentifier{testPolicy1},
+			RequireExplicitPolicyZero: true,
+		},
+		leaf: Certificate{},
+	},
+	{
+		intermediate: Certificate{
+			PolicyIdentifiers:     []asn1.ObjectIdentifier{testPolicy1},
+			RequireExplicitPolicy: 2,
+		},
+		leaf: Certificate{},
+		ok:   true,
+	},
+	{
+		// anyPolicy in the leaf doesn't count once inhibited.
+		intermediate: Certificate{
+			PolicyIdentifiers:    []asn1.ObjectIdentifier{oidAnyPolicy},
+			InhibitAnyPolicyZero: true,
+		},
+		leaf: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{oidAnyPolicy}},
+		opts: VerifyOptions{RequireExplicitPolicy: true},
+	},
+}
+
+func TestCertificatePolicies(t *testing.T) {
+	for i, test := range policyTests {
+		intermediate, leaf := test.intermediate, test.leaf
+		chain := generateChain(t, &intermediate, &leaf)
+		err := chain.verify(test.opts)
+		if test.ok {
+			if err != nil {
+				t.Errorf("#%d: unexpected failure: %s", i, err)
+			}
+			continue
+		}
+		if err, ok := err.(CertificateInvalidError); !ok || err.Reason != InvalidPolicy {
+			t.Errorf("#%d: got error %v, want an invalid policy", i, err)
+		}
+	}
+}
+
+func TestPolicyExtensionsRoundTrip(t *testing.T) {
+	template := Certificate{
+		PolicyIdentifiers:         []asn1.ObjectIdentifier{testPolicy1},
+		PolicyMappings:            []PolicyMapping{{testPolicy1, testPolicy2}},
+		RequireExplicitPolicyZero: true,
+		InhibitPolicyMapping:      2,
+		InhibitAnyPolicyZero:      true,
+	}
+	chain := generateChain(t, &template, &Certificate{})
+	got := chain.intermediate
+	if !reflect.DeepEqual(got.PolicyMappings, template.PolicyMappings) {
+		t.Errorf("got policy mappings %v, want %v", got.PolicyMappings, template.PolicyMappings)
+	}
+	if got.RequireExplicitPolicy != 0 || !got.RequireExplicitPolicyZero {
+		t.Errorf("got RequireExplicitPolicy %d (zero: %t), want 0", got.RequireExplicitPolicy, got.RequireExplicitPolicyZero)
+	}
+	if got.InhibitPolicyMapping != 2 || got.InhibitPolicyMappingZero {
+		t.Errorf("got InhibitPolicyMapping %d (zero: %t), want 2", got.InhibitPolicyMapping, got.InhibitPolicyMappingZero)
+	}
+	if got.InhibitAnyPolicy != 0 || !got.InhibitAnyPolicyZero {
+		t.Errorf("got InhibitAnyPolicy %d (zero: %t), want 0", got.InhibitAnyPolicy, got.InhibitAnyPolicyZero)
+	}
+	if leaf := chain.leaf; leaf.RequireExplicitPolicy != 0 || leaf.RequireExplicitPolicyZero || leaf.InhibitAnyPolicyZero || len(leaf.PolicyMappings) != 0 {
+		t.Errorf("policy constraints found in the leaf: %+v", leaf)
+	}
+}
+
+func TestCRLRevocation(t *testing.T) {
+	// CreateCRL only supports RSA keys.
+	var keys [4]crypto.Signer
+	for i := range keys {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	chain := generateChainWithKeys(t, [3]crypto.Signer{keys[0], keys[1], keys[2]}, &Certificate{}, &Certificate{})
+
+	crl := func(issuer *Certificate, key crypto.Signer, serial *big.Int, revoked int64) *pkix.CertificateList {
+		der, err := issuer.CreateCRL(rand.Reader, key, []pkix.RevokedCertificate{
+			{SerialNumber: serial, RevocationTime: time.Unix(revoked, 0)},
+		}, time.Unix(1000, 0), time.Unix(100000, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := ParseDERCRL(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	// An impostor with the intermediate's name but not its key.
+	impostorKey := keys[3]
+	impostor := generateTestCert(t, &Certificate{
+		Subject:               chain.intermediate.Subject,
+		BasicConstraintsValid: true,
+		IsCA: true,
+	}, nil, impostorKey, impostorKey)
+
+	tests := []struct {
+		crl     *pkix.CertificateList
+		revoked *Certificate
+	}{
+		{crl(chain.intermediate, chain.intermediateKey, chain.leaf.SerialNumber, 2000), chain.leaf},
+		{crl(chain.root, chain.rootKey, chain.intermediate.SerialNumber, 2000), chain.intermediate},
+		{crl(chain.intermediate, chain.intermediateKey, chain.leaf.SerialNumber, 9000), nil},
+		{crl(chain.intermediate, chain.intermediateKey, chain.intermediate.SerialNumber, 2000), nil},
+		{crl(chain.root, chain.rootKey, chain.leaf.SerialNumber, 2000), nil},
+		{crl(impostor, impostorKey, chain.leaf.SerialNumber, 2000), nil},
+	}
+	for i, test := range tests {
+		err := chain.verify(VerifyOptions{CRLs: []*pkix.CertificateList{test.crl}})
+		if test.revoked == nil {
+			if err != nil {
+				t.Errorf("#%d: unexpected failure: %s", i, err)
+			}
+			continue
+		}
+		if err, ok := err.(CertificateInvalidError); !ok || err.Reason != Revoked || err.Cert != test.revoked {
+			t.Errorf("#%d: got error %v, want %s to be revoked", i, err, test.revoked.Subject.CommonName)
+		}
+	}
+}
+
 const geoTrustRoot = `-----BEGIN CERTIFICATE-----
 MIIDVDCCAjygAwIBAgIDAjRWMA0GCSqGSIb3DQEBBQUAMEIxCzAJBgNVBAYTAlVT
 MRYwFAYDVQQKEw1HZW9UcnVzdCBJbmMuMRswGQYDVQQDExJHZW9UcnVzdCBHbG9i
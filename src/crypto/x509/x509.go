@@ -10,6 +10,7 @@ import (
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -22,6 +23,7 @@ import (
 	"io"
 	"math/big"
 	"net"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -74,8 +76,12 @@ func marshalPublicKey(pub interface{}) (publicKeyBytes []byte, publicKeyAlgorith
 			return
 		}
 		publicKeyAlgorithm.Parameters.FullBytes = paramBytes
+	case ed25519.PublicKey:
+		publicKeyBytes = pub
+		// RFC 8410, section 3: the parameters must be absent.
+		publicKeyAlgorithm.Algorithm = oidPublicKeyEd25519
 	default:
-		return nil, pkix.AlgorithmIdentifier{}, errors.New("x509: only RSA and ECDSA public keys supported")
+		return nil, pkix.AlgorithmIdentifier{}, errors.New("x509: only RSA, ECDSA and Ed25519 public keys supported")
 	}
 
 	return publicKeyBytes, publicKeyAlgorithm, nil
@@ -167,6 +173,7 @@ const (
 	ECDSAWithSHA256
 	ECDSAWithSHA384
 	ECDSAWithSHA512
+	PureEd25519
 )
 
 type PublicKeyAlgorithm int
@@ -176,6 +183,7 @@ const (
 	RSA
 	DSA
 	ECDSA
+	Ed25519
 )
 
 // OIDs for signature algorithms
@@ -227,6 +235,11 @@ const (
 //
 // ecdsa-with-SHA512 OBJECT IDENTIFIER ::= { iso(1) member-body(2)
 //    us(840) ansi-X9-62(10045) signatures(4) ecdsa-with-SHA2(3) 4 }
+//
+//
+// RFC 8410 3 Curve25519 and Curve448 Algorithm Identifiers
+//
+// id-Ed25519 OBJECT IDENTIFIER ::= { 1 3 101 112 }
 
 var (
 	oidSignatureMD2WithRSA      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 2}
@@ -241,6 +254,7 @@ var (
 	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
 	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
 	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
 )
 
 var signatureAlgorithmDetails = []struct {
@@ -261,6 +275,7 @@ var signatureAlgorithmDetails = []struct {
 	{ECDSAWithSHA256, oidSignatureECDSAWithSHA256, ECDSA, crypto.SHA256},
 	{ECDSAWithSHA384, oidSignatureECDSAWithSHA384, ECDSA, crypto.SHA384},
 	{ECDSAWithSHA512, oidSignatureECDSAWithSHA512, ECDSA, crypto.SHA512},
+	{PureEd25519, oidSignatureEd25519, Ed25519, crypto.Hash(0) /* no pre-hashing */},
 }
 
 func getSignatureAlgorithmFromOID(oid asn1.ObjectIdentifier) SignatureAlgorithm {
@@ -286,10 +301,15 @@ func getSignatureAlgorithmFromOID(oid asn1.ObjectIdentifier) SignatureAlgorithm
 //
 // id-ecPublicKey OBJECT IDENTIFIER ::= {
 //       iso(1) member-body(2) us(840) ansi-X9-62(10045) keyType(2) 1 }
+//
+// RFC 8410, 3 Curve25519 and Curve448 Algorithm Identifiers
+//
+// id-Ed25519 OBJECT IDENTIFIER ::= { 1 3 101 112 }
 var (
-	oidPublicKeyRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
-	oidPublicKeyDSA   = asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1}
-	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidPublicKeyRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPublicKeyDSA     = asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1}
+	oidPublicKeyECDSA   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidPublicKeyEd25519 = oidSignatureEd25519
 )
 
 func getPublicKeyAlgorithmFromOID(oid asn1.ObjectIdentifier) PublicKeyAlgorithm {
@@ -300,6 +320,8 @@ func getPublicKeyAlgorithmFromOID(oid asn1.ObjectIdentifier) PublicKeyAlgorithm
 		return DSA
 	case oid.Equal(oidPublicKeyECDSA):
 		return ECDSA
+	case oid.Equal(oidPublicKeyEd25519):
+		return Ed25519
 	}
 	return UnknownPublicKeyAlgorithm
 }
@@ -511,15 +533,49 @@ type Certificate struct {
 	DNSNames       []string
 	EmailAddresses []string
 	IPAddresses    []net.IP
-
-	// Name constraints
+	URIs           []*url.URL
+
+	// Name constraints (RFC 5280, 4.2.1.10). A DNS or URI domain
+	// constraint matches the domain and its subdomains, or only its
+	// subdomains if it starts with a period. An email constraint is a
+	// mailbox, a host, or a domain whose subdomains match if it starts
+	// with a period. A directory name constraint matches subjects that
+	// start with its RDNs.
 	PermittedDNSDomainsCritical bool // if true then the name constraints are marked critical.
 	PermittedDNSDomains         []string
+	ExcludedDNSDomains          []string
+	PermittedIPRanges           []*net.IPNet
+	ExcludedIPRanges            []*net.IPNet
+	PermittedEmailAddresses     []string
+	ExcludedEmailAddresses      []string
+	PermittedURIDomains         []string
+	ExcludedURIDomains          []string
+	PermittedDirectoryNames     []pkix.RDNSequence
+	ExcludedDirectoryNames      []pkix.RDNSequence
 
 	// CRL Distribution Points
 	CRLDistributionPoints []string
 
 	PolicyIdentifiers []asn1.ObjectIdentifier
+	PolicyMappings    []PolicyMapping
+
+	// RequireExplicitPolicy and InhibitPolicyMapping are the policy
+	// constraints (RFC 5280, 4.2.1.11), and InhibitAnyPolicy the
+	// inhibitAnyPolicy extension (RFC 5280, 4.2.1.14): the number of
+	// further certificates in a path after which they take effect. A
+	// field is absent if it's negative or, like MaxPathLen, zero without
+	// the matching Zero field set.
+	RequireExplicitPolicy     int
+	RequireExplicitPolicyZero bool
+	InhibitPolicyMapping      int
+	InhibitPolicyMappingZero  bool
+	InhibitAnyPolicy          int
+	InhibitAnyPolicyZero      bool
+
+	// SignedCertificateTimestamps holds the serialized SCTs embedded in
+	// the certificate by Certificate Transparency logs (RFC 6962, 3.3).
+	// See VerifySCTs.
+	SignedCertificateTimestamps [][]byte
 }
 
 // ErrUnsupportedAlgorithm results from attempting to perform an operation that
@@ -619,9 +675,25 @@ func (c *Certificate) CheckSignatureFrom(parent *Certificate) (err error) {
 // CheckSignature verifies that signature is a valid signature over signed from
 // c's public key.
 func (c *Certificate) CheckSignature(algo SignatureAlgorithm, signed, signature []byte) (err error) {
+	return checkSignature(algo, signed, signature, c.PublicKey)
+}
+
+// checkSignature verifies that signature is a valid signature over signed
+// from publicKey.
+func checkSignature(algo SignatureAlgorithm, signed, signature []byte, publicKey interface{}) (err error) {
 	var hashType crypto.Hash
 
 	switch algo {
+	case PureEd25519:
+		// Ed25519 signs the message itself, rather than a digest of it.
+		pub, ok := publicKey.(ed25519.PublicKey)
+		if !ok {
+			return ErrUnsupportedAlgorithm
+		}
+		if !ed25519.Verify(pub, signed, signature) {
+			return errors.New("x509: Ed25519 verification failure")
+		}
+		return nil
 	case SHA1WithRSA, DSAWithSHA1, ECDSAWithSHA1:
 		hashType = crypto.SHA1
 	case SHA256WithRSA, DSAWithSHA256, ECDSAWithSHA256:
@@ -642,7 +714,7 @@ func (c *Certificate) CheckSignature(algo SignatureAlgorithm, signed, signature
 	h.Write(signed)
 	digest := h.Sum(nil)
 
-	switch pub := c.PublicKey.(type) {
+	switch pub := publicKey.(type) {
 	case *rsa.PublicKey:
 		return rsa.VerifyPKCS1v15(pub, hashType, digest, signature)
 	case *dsa.PublicKey:
@@ -696,6 +768,20 @@ type policyInformation struct {
 	// policyQualifiers omitted
 }
 
+// PolicyMapping declares that a certificate policy of the issuing CA,
+// IssuerDomainPolicy, is equivalent to SubjectDomainPolicy of the subject
+// CA. See RFC 5280, 4.2.1.5.
+type PolicyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
+}
+
+// RFC 5280, 4.2.1.11
+type policyConstraints struct {
+	RequireExplicitPolicy int `asn1:"optional,tag:0,default:-1"`
+	InhibitPolicyMapping  int `asn1:"optional,tag:1,default:-1"`
+}
+
 // RFC 5280, 4.2.1.10
 type nameConstraints struct {
 	Permitted []generalSubtree `asn1:"optional,tag:0"`
@@ -703,7 +789,7 @@ type nameConstraints struct {
 }
 
 type generalSubtree struct {
-	Name string `asn1:"tag:2,optional,ia5"`
+	Name asn1.RawValue // GeneralName
 }
 
 // RFC 5280, 4.2.2.1
@@ -791,12 +877,23 @@ func parsePublicKey(algo PublicKeyAlgorithm, keyData *publicKeyInfo) (interface{
 			Y:     y,
 		}
 		return pub, nil
+	case Ed25519:
+		// RFC 8410, section 3: the parameters must be absent.
+		if len(keyData.Algorithm.Parameters.FullBytes) != 0 {
+			return nil, errors.New("x509: Ed25519 key encoded with illegal parameters")
+		}
+		if len(asn1Data) != ed25519.PublicKeySize {
+			return nil, errors.New("x509: wrong Ed25519 public key size")
+		}
+		pub := make([]byte, ed25519.PublicKeySize)
+		copy(pub, asn1Data)
+		return ed25519.PublicKey(pub), nil
 	default:
 		return nil, nil
 	}
 }
 
-func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddresses []net.IP, err error) {
+func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL, err error) {
 	// RFC 5280, 4.2.1.6
 
 	// SubjectAltName ::= GeneralNames
@@ -834,6 +931,12 @@ func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddre
 			emailAddresses = append(emailAddresses, string(v.Bytes))
 		case 2:
 			dnsNames = append(dnsNames, string(v.Bytes))
+		case 6:
+			uri, err := url.Parse(string(v.Bytes))
+			if err != nil {
+				return nil, nil, nil, nil, errors.New("x509: cannot parse URI " + strconv.Quote(string(v.Bytes)) + ": " + err.Error())
+			}
+			uris = append(uris, uri)
 		case 7:
 			switch len(v.Bytes) {
 			case net.IPv4len, net.IPv6len:
@@ -848,6 +951,91 @@ func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddre
 	return
 }
 
+// parseNameConstraintsExtension sets the name constraint fields of out
+// from the value of a name constraints extension. It reports whether there
+// were constraints on name types that aren't supported.
+func parseNameConstraintsExtension(out *Certificate, value []byte) (unhandled bool, err error) {
+	var seq asn1.RawValue
+	if _, err = asn1.Unmarshal(value, &seq); err != nil {
+		return false, err
+	}
+	if !seq.IsCompound || seq.Tag != 16 || seq.Class != 0 {
+		return false, asn1.StructuralError{Msg: "bad name constraints sequence"}
+	}
+
+	for rest := seq.Bytes; len(rest) > 0; {
+		var subtrees asn1.RawValue
+		if rest, err = asn1.Unmarshal(rest, &subtrees); err != nil {
+			return false, err
+		}
+		if subtrees.Class != 2 || subtrees.Tag > 1 {
+			return false, asn1.StructuralError{Msg: "bad name constraints sequence"}
+		}
+		excluded := subtrees.Tag == 1
+
+		for data := subtrees.Bytes; len(data) > 0; {
+			var subtree, base asn1.RawValue
+			if data, err = asn1.Unmarshal(data, &subtree); err != nil {
+				return false, err
+			}
+			// The minimum and maximum fields aren't used in the
+			// Internet PKI and are ignored.
+			if _, err = asn1.Unmarshal(subtree.Bytes, &base); err != nil {
+				return false, err
+			}
+			if base.Class != 2 {
+				return false, asn1.StructuralError{Msg: "bad name constraint"}
+			}
+
+			switch base.Tag {
+			case 1:
+				if excluded {
+					out.ExcludedEmailAddresses = append(out.ExcludedEmailAddresses, string(base.Bytes))
+				} else {
+					out.PermittedEmailAddresses = append(out.PermittedEmailAddresses, string(base.Bytes))
+				}
+			case 2:
+				if excluded {
+					out.ExcludedDNSDomains = append(out.ExcludedDNSDomains, string(base.Bytes))
+				} else {
+					out.PermittedDNSDomains = append(out.PermittedDNSDomains, string(base.Bytes))
+				}
+			case 4:
+				var name pkix.RDNSequence
+				if _, err = asn1.Unmarshal(base.Bytes, &name); err != nil {
+					return false, err
+				}
+				if excluded {
+					out.ExcludedDirectoryNames = append(out.ExcludedDirectoryNames, name)
+				} else {
+					out.PermittedDirectoryNames = append(out.PermittedDirectoryNames, name)
+				}
+			case 6:
+				if excluded {
+					out.ExcludedURIDomains = append(out.ExcludedURIDomains, string(base.Bytes))
+				} else {
+					out.PermittedURIDomains = append(out.PermittedURIDomains, string(base.Bytes))
+				}
+			case 7:
+				// An address followed by a mask of the same length.
+				l := len(base.Bytes)
+				if l != 2*net.IPv4len && l != 2*net.IPv6len {
+					return false, errors.New("x509: certificate contained IP address range of length " + strconv.Itoa(l))
+				}
+				ipNet := &net.IPNet{IP: net.IP(base.Bytes[:l/2]), Mask: net.IPMask(base.Bytes[l/2:])}
+				if excluded {
+					out.ExcludedIPRanges = append(out.ExcludedIPRanges, ipNet)
+				} else {
+					out.PermittedIPRanges = append(out.PermittedIPRanges, ipNet)
+				}
+			default:
+				unhandled = true
+			}
+		}
+	}
+	return unhandled, nil
+}
+
 func parseCertificate(in *certificate) (*Certificate, error) {
 	out := new(Certificate)
 	out.Raw = in.Raw
@@ -922,12 +1110,12 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 					continue
 				}
 			case 17:
-				out.DNSNames, out.EmailAddresses, out.IPAddresses, err = parseSANExtension(e.Value)
+				out.DNSNames, out.EmailAddresses, out.IPAddresses, out.URIs, err = parseSANExtension(e.Value)
 				if err != nil {
 					return nil, err
 				}
 
-				if len(out.DNSNames) > 0 || len(out.EmailAddresses) > 0 || len(out.IPAddresses) > 0 {
+				if len(out.DNSNames) > 0 || len(out.EmailAddresses) > 0 || len(out.IPAddresses) > 0 || len(out.URIs) > 0 {
 					continue
 				}
 				// If we didn't parse any of the names then we
@@ -949,25 +1137,40 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				//
 				// BaseDistance ::= INTEGER (0..MAX)
 
-				var constraints nameConstraints
-				_, err := asn1.Unmarshal(e.Value, &constraints)
+				unhandled, err := parseNameConstraintsExtension(out, e.Value)
 				if err != nil {
 					return nil, err
 				}
-
-				if len(constraints.Excluded) > 0 && e.Critical {
+				if unhandled && e.Critical {
 					return out, UnhandledCriticalExtension{}
 				}
+				continue
 
-				for _, subtree := range constraints.Permitted {
-					if len(subtree.Name) == 0 {
-						if e.Critical {
-							return out, UnhandledCriticalExtension{}
-						}
-						continue
-					}
-					out.PermittedDNSDomains = append(out.PermittedDNSDomains, subtree.Name)
+			case 33:
+				// RFC 5280, 4.2.1.5
+				if _, err = asn1.Unmarshal(e.Value, &out.PolicyMappings); err != nil {
+					return nil, err
+				}
+				continue
+
+			case 36:
+				// RFC 5280, 4.2.1.11
+				var constraints policyConstraints
+				if _, err = asn1.Unmarshal(e.Value, &constraints); err != nil {
+					return nil, err
+				}
+				out.RequireExplicitPolicy = constraints.RequireExplicitPolicy
+				out.RequireExplicitPolicyZero = out.RequireExplicitPolicy == 0
+				out.InhibitPolicyMapping = constraints.InhibitPolicyMapping
+				out.InhibitPolicyMappingZero = out.InhibitPolicyMapping == 0
+				continue
+
+			case 54:
+				// RFC 5280, 4.2.1.14
+				if _, err = asn1.Unmarshal(e.Value, &out.InhibitAnyPolicy); err != nil {
+					return nil, err
 				}
+				out.InhibitAnyPolicyZero = out.InhibitAnyPolicy == 0
 				continue
 
 			case 31:
@@ -1059,6 +1262,10 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 					out.PolicyIdentifiers[i] = policy.Policy
 				}
 			}
+		} else if e.Id.Equal(oidExtensionSCT) {
+			if out.SignedCertificateTimestamps, err = parseSCTExtension(e.Value); err != nil {
+				return nil, err
+			}
 		} else if e.Id.Equal(oidExtensionAuthorityInfoAccess) {
 			// RFC 5280 4.2.2.1: Authority Information Access
 			var aia []authorityInfoAccess
@@ -1145,6 +1352,9 @@ var (
 	oidExtensionCertificatePolicies   = []int{2, 5, 29, 32}
 	oidExtensionNameConstraints       = []int{2, 5, 29, 30}
 	oidExtensionCRLDistributionPoints = []int{2, 5, 29, 31}
+	oidExtensionPolicyMappings        = []int{2, 5, 29, 33}
+	oidExtensionPolicyConstraints     = []int{2, 5, 29, 36}
+	oidExtensionInhibitAnyPolicy      = []int{2, 5, 29, 54}
 	oidExtensionAuthorityInfoAccess   = []int{1, 3, 6, 1, 5, 5, 7, 1, 1}
 )
 
@@ -1166,7 +1376,7 @@ func oidInExtensions(oid asn1.ObjectIdentifier, extensions []pkix.Extension) boo
 
 // marshalSANs marshals a list of addresses into a the contents of an X.509
 // SubjectAlternativeName extension.
-func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP) (derBytes []byte, err error) {
+func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL) (derBytes []byte, err error) {
 	var rawValues []asn1.RawValue
 	for _, name := range dnsNames {
 		rawValues = append(rawValues, asn1.RawValue{Tag: 2, Class: 2, Bytes: []byte(name)})
@@ -1182,11 +1392,14 @@ func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP) (derBy
 		}
 		rawValues = append(rawValues, asn1.RawValue{Tag: 7, Class: 2, Bytes: ip})
 	}
+	for _, uri := range uris {
+		rawValues = append(rawValues, asn1.RawValue{Tag: 6, Class: 2, Bytes: []byte(uri.String())})
+	}
 	return asn1.Marshal(rawValues)
 }
 
 func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
-	ret = make([]pkix.Extension, 10 /* maximum number of elements. */)
+	ret = make([]pkix.Extension, 14 /* maximum number of elements. */)
 	n := 0
 
 	if template.KeyUsage != 0 &&
@@ -1290,10 +1503,10 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 		n++
 	}
 
-	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0) &&
+	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0 || len(template.URIs) > 0) &&
 		!oidInExtensions(oidExtensionSubjectAltName, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionSubjectAltName
-		ret[n].Value, err = marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses)
+		ret[n].Value, err = marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses, template.URIs)
 		if err != nil {
 			return
 		}
@@ -1314,15 +1527,17 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 		n++
 	}
 
-	if len(template.PermittedDNSDomains) > 0 &&
+	if hasNameConstraints(template) &&
 		!oidInExtensions(oidExtensionNameConstraints, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionNameConstraints
 		ret[n].Critical = template.PermittedDNSDomainsCritical
 
 		var out nameConstraints
-		out.Permitted = make([]generalSubtree, len(template.PermittedDNSDomains))
-		for i, permitted := range template.PermittedDNSDomains {
-			out.Permitted[i] = generalSubtree{Name: permitted}
+		if out.Permitted, err = marshalSubtrees(template.PermittedDNSDomains, template.PermittedEmailAddresses, template.PermittedURIDomains, template.PermittedIPRanges, template.PermittedDirectoryNames); err != nil {
+			return
+		}
+		if out.Excluded, err = marshalSubtrees(template.ExcludedDNSDomains, template.ExcludedEmailAddresses, template.ExcludedURIDomains, template.ExcludedIPRanges, template.ExcludedDirectoryNames); err != nil {
+			return
 		}
 		ret[n].Value, err = asn1.Marshal(out)
 		if err != nil {
@@ -1354,12 +1569,108 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 		n++
 	}
 
+	if len(template.SignedCertificateTimestamps) > 0 &&
+		!oidInExtensions(oidExtensionSCT, template.ExtraExtensions) {
+		ret[n].Id = oidExtensionSCT
+		ret[n].Value, err = marshalSCTExtension(template.SignedCertificateTimestamps)
+		if err != nil {
+			return
+		}
+		n++
+	}
+
+	if len(template.PolicyMappings) > 0 &&
+		!oidInExtensions(oidExtensionPolicyMappings, template.ExtraExtensions) {
+		ret[n].Id = oidExtensionPolicyMappings
+		ret[n].Critical = true
+		ret[n].Value, err = asn1.Marshal(template.PolicyMappings)
+		if err != nil {
+			return
+		}
+		n++
+	}
+
+	// Like MaxPathLen, a zero value is omitted unless the matching Zero
+	// field is set, and -1 causes encoding/asn1 to omit the value.
+	requireExplicit := policySkipCerts(template.RequireExplicitPolicy, template.RequireExplicitPolicyZero)
+	inhibitMapping := policySkipCerts(template.InhibitPolicyMapping, template.InhibitPolicyMappingZero)
+	if (requireExplicit >= 0 || inhibitMapping >= 0) &&
+		!oidInExtensions(oidExtensionPolicyConstraints, template.ExtraExtensions) {
+		ret[n].Id = oidExtensionPolicyConstraints
+		ret[n].Critical = true
+		ret[n].Value, err = asn1.Marshal(policyConstraints{requireExplicit, inhibitMapping})
+		if err != nil {
+			return
+		}
+		n++
+	}
+
+	if inhibitAny := policySkipCerts(template.InhibitAnyPolicy, template.InhibitAnyPolicyZero); inhibitAny >= 0 &&
+		!oidInExtensions(oidExtensionInhibitAnyPolicy, template.ExtraExtensions) {
+		ret[n].Id = oidExtensionInhibitAnyPolicy
+		ret[n].Critical = true
+		ret[n].Value, err = asn1.Marshal(inhibitAny)
+		if err != nil {
+			return
+		}
+		n++
+	}
+
 	// Adding another extension here? Remember to update the maximum number
 	// of elements in the make() at the top of the function.
 
 	return append(ret[:n], template.ExtraExtensions...), nil
 }
 
+func hasNameConstraints(c *Certificate) bool {
+	return len(c.PermittedDNSDomains) > 0 || len(c.ExcludedDNSDomains) > 0 ||
+		len(c.PermittedEmailAddresses) > 0 || len(c.ExcludedEmailAddresses) > 0 ||
+		len(c.PermittedURIDomains) > 0 || len(c.ExcludedURIDomains) > 0 ||
+		len(c.PermittedIPRanges) > 0 || len(c.ExcludedIPRanges) > 0 ||
+		len(c.PermittedDirectoryNames) > 0 || len(c.ExcludedDirectoryNames) > 0
+}
+
+// marshalSubtrees returns the GeneralSubtrees for the given name
+// constraints.
+func marshalSubtrees(dnsDomains, emailAddresses, uriDomains []string, ipRanges []*net.IPNet, directoryNames []pkix.RDNSequence) (subtrees []generalSubtree, err error) {
+	for _, domain := range dnsDomains {
+		subtrees = append(subtrees, generalSubtree{asn1.RawValue{Tag: 2, Class: 2, Bytes: []byte(domain)}})
+	}
+	for _, email := range emailAddresses {
+		subtrees = append(subtrees, generalSubtree{asn1.RawValue{Tag: 1, Class: 2, Bytes: []byte(email)}})
+	}
+	for _, domain := range uriDomains {
+		subtrees = append(subtrees, generalSubtree{asn1.RawValue{Tag: 6, Class: 2, Bytes: []byte(domain)}})
+	}
+	for _, ipNet := range ipRanges {
+		ip, mask := ipNet.IP.To4(), ipNet.Mask
+		if ip == nil || len(mask) != net.IPv4len {
+			ip = ipNet.IP.To16()
+		}
+		if ip == nil || len(mask) != len(ip) {
+			return nil, errors.New("x509: invalid IP range in name constraints: " + ipNet.String())
+		}
+		subtrees = append(subtrees, generalSubtree{asn1.RawValue{Tag: 7, Class: 2, Bytes: append(append([]byte(nil), ip...), mask...)}})
+	}
+	for _, name := range directoryNames {
+		der, err := asn1.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		subtrees = append(subtrees, generalSubtree{asn1.RawValue{Tag: 4, Class: 2, IsCompound: true, Bytes: der}})
+	}
+	return subtrees, nil
+}
+
+// policySkipCerts returns the value of a policy constraint field of a
+// Certificate, or -1 if it's absent.
+func policySkipCerts(v int, zero bool) int {
+	if v > 0 || v == 0 && zero {
+		return v
+	}
+	return -1
+}
+
 func subjectBytes(cert *Certificate) ([]byte, error) {
 	if len(cert.RawSubject) > 0 {
 		return cert.RawSubject, nil
@@ -1397,8 +1708,12 @@ func signingParamsForPrivateKey(priv interface{}, requestedSigAlgo SignatureAlgo
 			err = errors.New("x509: unknown elliptic curve")
 		}
 
+	case ed25519.PrivateKey:
+		pubType = Ed25519
+		sigAlgo.Algorithm = oidSignatureEd25519
+
 	default:
-		err = errors.New("x509: only RSA and ECDSA private keys supported")
+		err = errors.New("x509: only RSA, ECDSA and Ed25519 private keys supported")
 	}
 
 	if err != nil {
@@ -1417,7 +1732,7 @@ func signingParamsForPrivateKey(priv interface{}, requestedSigAlgo SignatureAlgo
 				return
 			}
 			sigAlgo.Algorithm, hashFunc = details.oid, details.hash
-			if hashFunc == 0 {
+			if hashFunc == 0 && pubType != Ed25519 {
 				err = errors.New("x509: cannot sign with hash function requested")
 				return
 			}
@@ -1433,11 +1748,40 @@ func signingParamsForPrivateKey(priv interface{}, requestedSigAlgo SignatureAlgo
 	return
 }
 
+// signTBS signs the to-be-signed part of a certificate or certificate
+// request with priv, hashing it with hashFunc first unless priv is an
+// Ed25519 key.
+func signTBS(rand io.Reader, priv interface{}, hashFunc crypto.Hash, tbs []byte) (signature []byte, err error) {
+	if priv, ok := priv.(ed25519.PrivateKey); ok {
+		return ed25519.Sign(priv, tbs), nil
+	}
+
+	h := hashFunc.New()
+	h.Write(tbs)
+	digest := h.Sum(nil)
+
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand, priv, hashFunc, digest)
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand, priv, digest); err == nil {
+			signature, err = asn1.Marshal(ecdsaSignature{r, s})
+		}
+	default:
+		panic("internal error")
+	}
+	return
+}
+
 // CreateCertificate creates a new certificate based on a template. The
 // following members of template are used: SerialNumber, Subject, NotBefore,
 // NotAfter, KeyUsage, ExtKeyUsage, UnknownExtKeyUsage, BasicConstraintsValid,
-// IsCA, MaxPathLen, SubjectKeyId, DNSNames, PermittedDNSDomainsCritical,
-// PermittedDNSDomains, SignatureAlgorithm.
+// IsCA, MaxPathLen, SubjectKeyId, DNSNames, EmailAddresses, IPAddresses,
+// URIs, the name constraints (PermittedDNSDomainsCritical and the Permitted
+// and Excluded fields), PolicyIdentifiers, PolicyMappings, the policy
+// constraints (RequireExplicitPolicy, InhibitPolicyMapping, InhibitAnyPolicy
+// and their Zero flags), SignatureAlgorithm.
 //
 // The certificate is signed by parent. If parent is equal to template then the
 // certificate is self-signed. The parameter pub is the public key of the
@@ -1445,8 +1789,9 @@ func signingParamsForPrivateKey(priv interface{}, requestedSigAlgo SignatureAlgo
 //
 // The returned slice is the certificate in DER encoding.
 //
-// The only supported key types are RSA and ECDSA (*rsa.PublicKey or
-// *ecdsa.PublicKey for pub, *rsa.PrivateKey or *ecdsa.PrivateKey for priv).
+// The only supported key types are RSA, ECDSA and Ed25519 (*rsa.PublicKey,
+// *ecdsa.PublicKey or ed25519.PublicKey for pub, *rsa.PrivateKey,
+// *ecdsa.PrivateKey or ed25519.PrivateKey for priv).
 func CreateCertificate(rand io.Reader, template, parent *Certificate, pub interface{}, priv interface{}) (cert []byte, err error) {
 	hashFunc, signatureAlgorithm, err := signingParamsForPrivateKey(priv, template.SignatureAlgorithm)
 	if err != nil {
@@ -1500,24 +1845,7 @@ func CreateCertificate(rand io.Reader, template, parent *Certificate, pub interf
 
 	c.Raw = tbsCertContents
 
-	h := hashFunc.New()
-	h.Write(tbsCertContents)
-	digest := h.Sum(nil)
-
-	var signature []byte
-
-	switch priv := priv.(type) {
-	case *rsa.PrivateKey:
-		signature, err = rsa.SignPKCS1v15(rand, priv, hashFunc, digest)
-	case *ecdsa.PrivateKey:
-		var r, s *big.Int
-		if r, s, err = ecdsa.Sign(rand, priv, digest); err == nil {
-			signature, err = asn1.Marshal(ecdsaSignature{r, s})
-		}
-	default:
-		panic("internal error")
-	}
-
+	signature, err := signTBS(rand, priv, hashFunc, tbsCertContents)
 	if err != nil {
 		return
 	}
@@ -1675,8 +2003,8 @@ var oidExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
 //
 // The returned slice is the certificate request in DER encoding.
 //
-// The only supported key types are RSA (*rsa.PrivateKey) and ECDSA
-// (*ecdsa.PrivateKey).
+// The only supported key types are RSA (*rsa.PrivateKey), ECDSA
+// (*ecdsa.PrivateKey) and Ed25519 (ed25519.PrivateKey).
 func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv interface{}) (csr []byte, err error) {
 	hashFunc, sigAlgo, err := signingParamsForPrivateKey(priv, template.SignatureAlgorithm)
 	if err != nil {
@@ -1691,6 +2019,8 @@ func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv
 		publicKeyBytes, publicKeyAlgorithm, err = marshalPublicKey(&priv.PublicKey)
 	case *ecdsa.PrivateKey:
 		publicKeyBytes, publicKeyAlgorithm, err = marshalPublicKey(&priv.PublicKey)
+	case ed25519.PrivateKey:
+		publicKeyBytes, publicKeyAlgorithm, err = marshalPublicKey(priv.Public())
 	default:
 		panic("internal error")
 	}
@@ -1703,7 +2033,7 @@ func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv
 
 	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0) &&
 		!oidInExtensions(oidExtensionSubjectAltName, template.ExtraExtensions) {
-		sanBytes, err := marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses)
+		sanBytes, err := marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -1801,23 +2131,7 @@ func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv
 	}
 	tbsCSR.Raw = tbsCSRContents
 
-	h := hashFunc.New()
-	h.Write(tbsCSRContents)
-	digest := h.Sum(nil)
-
-	var signature []byte
-	switch priv := priv.(type) {
-	case *rsa.PrivateKey:
-		signature, err = rsa.SignPKCS1v15(rand, priv, hashFunc, digest)
-	case *ecdsa.PrivateKey:
-		var r, s *big.Int
-		if r, s, err = ecdsa.Sign(rand, priv, digest); err == nil {
-			signature, err = asn1.Marshal(ecdsaSignature{r, s})
-		}
-	default:
-		panic("internal error")
-	}
-
+	signature, err := signTBS(rand, priv, hashFunc, tbsCSRContents)
 	if err != nil {
 		return
 	}
@@ -1904,7 +2218,7 @@ func parseCertificateRequest(in *certificateRequest) (*CertificateRequest, error
 		if len(e.Type) == 4 && e.Type[0] == 2 && e.Type[1] == 5 && e.Type[2] == 29 {
 			switch e.Type[3] {
 			case 17:
-				out.DNSNames, out.EmailAddresses, out.IPAddresses, err = parseSANExtension(value)
+				out.DNSNames, out.EmailAddresses, out.IPAddresses, _, err = parseSANExtension(value)
 				if err != nil {
 					return nil, err
 				}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -303,6 +304,11 @@ func TestCreateSelfSignedCertificate(t *testing.T) {
 		t.Fatalf("Failed to generate ECDSA key: %s", err)
 	}
 
+	ed25519Pub, ed25519Priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %s", err)
+	}
+
 	tests := []struct {
 		name      string
 		pub, priv interface{}
@@ -313,6 +319,9 @@ func TestCreateSelfSignedCertificate(t *testing.T) {
 		{"RSA/ECDSA", &rsaPriv.PublicKey, ecdsaPriv, false, ECDSAWithSHA384},
 		{"ECDSA/RSA", &ecdsaPriv.PublicKey, rsaPriv, false, SHA256WithRSA},
 		{"ECDSA/ECDSA", &ecdsaPriv.PublicKey, ecdsaPriv, true, ECDSAWithSHA1},
+		{"RSA/Ed25519", &rsaPriv.PublicKey, ed25519Priv, false, PureEd25519},
+		{"Ed25519/ECDSA", ed25519Pub, ecdsaPriv, false, ECDSAWithSHA256},
+		{"Ed25519/Ed25519", ed25519Pub, ed25519Priv, true, PureEd25519},
 	}
 
 	testExtKeyUsage := []ExtKeyUsage{ExtKeyUsageClientAuth, ExtKeyUsageServerAuth}
@@ -556,6 +565,71 @@ func TestECDSA(t *testing.T) {
 	}
 }
 
+// Self-signed certificate using Ed25519, generated using:
+//   openssl genpkey -algorithm ed25519 -out ed25519.key
+//   openssl req -new -x509 -key ed25519.key -subj /CN=ed25519.example.com -days 36500
+// The key is pkcs8Ed25519PrivateKeyHex.
+var ed25519CertPem = `-----BEGIN CERTIFICATE-----
+MIIBUzCCAQWgAwIBAgIUGzIMZIUfcFroj4G60xze+6YMPOkwBQYDK2VwMB4xHDAa
+BgNVBAMME2VkMjU1MTkuZXhhbXBsZS5jb20wIBcNMjYxMDE2MTcxNTA5WhgPMjEy
+NjA5MjIxNzE1MDlaMB4xHDAaBgNVBAMME2VkMjU1MTkuZXhhbXBsZS5jb20wKjAF
+BgMrZXADIQC7onLUEQAkIloTkdcou5qqK2jR0Dn/SIWfIB+/+z+01qNTMFEwHQYD
+VR0OBBYEFAEI5vLZvb6IOpajzBS7wHmgBk3KMB8GA1UdIwQYMBaAFAEI5vLZvb6I
+OpajzBS7wHmgBk3KMA8GA1UdEwEB/wQFMAMBAf8wBQYDK2VwA0EAlKMEJxPhQXbu
+0Gzim7qBYYV61EESO/4jYNNb+CVY9CcBy8d23HCF+Cdicj145E9YqZqTbyW/JeXR
+UvbZPXCCBA==
+-----END CERTIFICATE-----
+`
+
+func TestEd25519(t *testing.T) {
+	pemBlock, _ := pem.Decode([]byte(ed25519CertPem))
+	cert, err := ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	if sa := cert.SignatureAlgorithm; sa != PureEd25519 {
+		t.Errorf("signature algorithm is %v, want PureEd25519", sa)
+	}
+	if pka := cert.PublicKeyAlgorithm; pka != Ed25519 {
+		t.Errorf("public key algorithm is %v, want Ed25519", pka)
+	}
+	pub, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		t.Fatalf("wanted an Ed25519 public key but found: %#v", cert.PublicKey)
+	}
+	if err = cert.CheckSignatureFrom(cert); err != nil {
+		t.Errorf("certificate verification failed: %s", err)
+	}
+
+	derBytes, _ := hex.DecodeString(pkcs8Ed25519PrivateKeyHex)
+	priv, err := ParsePKCS8PrivateKey(derBytes)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %s", err)
+	}
+	if !bytes.Equal(priv.(ed25519.PrivateKey).Public().(ed25519.PublicKey), pub) {
+		t.Errorf("private key doesn't match the certificate")
+	}
+
+	pubBytes, err := MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %s", err)
+	}
+	if !bytes.Equal(pubBytes, cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("marshaled public key is %x, want %x", pubBytes, cert.RawSubjectPublicKeyInfo)
+	}
+	if parsed, err := ParsePKIXPublicKey(pubBytes); err != nil || !bytes.Equal(parsed.(ed25519.PublicKey), pub) {
+		t.Errorf("failed to parse public key: %v", err)
+	}
+
+	// A signature with the wrong algorithm, or over other data, fails.
+	if err := cert.CheckSignature(ECDSAWithSHA256, cert.RawTBSCertificate, cert.Signature); err == nil {
+		t.Errorf("Ed25519 signature verified as ECDSAWithSHA256")
+	}
+	if err := cert.CheckSignature(PureEd25519, cert.RawSubject, cert.Signature); err == nil {
+		t.Errorf("Ed25519 signature verified over the wrong data")
+	}
+}
+
 // Self-signed certificate using DSA with SHA1
 var dsaCertPem = `-----BEGIN CERTIFICATE-----
 MIIEDTCCA82gAwIBAgIJALHPghaoxeDhMAkGByqGSM44BAMweTELMAkGA1UEBhMC
@@ -777,6 +851,11 @@ func TestCreateCertificateRequest(t *testing.T) {
 		t.Fatalf("Failed to generate ECDSA key: %s", err)
 	}
 
+	_, ed25519Priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %s", err)
+	}
+
 	tests := []struct {
 		name    string
 		priv    interface{}
@@ -786,6 +865,7 @@ func TestCreateCertificateRequest(t *testing.T) {
 		{"ECDSA-256", ecdsa256Priv, ECDSAWithSHA1},
 		{"ECDSA-384", ecdsa384Priv, ECDSAWithSHA1},
 		{"ECDSA-521", ecdsa521Priv, ECDSAWithSHA1},
+		{"Ed25519", ed25519Priv, PureEd25519},
 	}
 
 	for _, test := range tests {
@@ -847,7 +927,7 @@ func marshalAndParseCSR(t *testing.T, template *CertificateRequest) *Certificate
 }
 
 func TestCertificateRequestOverrides(t *testing.T) {
-	sanContents, err := marshalSANs([]string{"foo.example.com"}, nil, nil)
+	sanContents, err := marshalSANs([]string{"foo.example.com"}, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -904,7 +984,7 @@ func TestCertificateRequestOverrides(t *testing.T) {
 		t.Errorf("bad attributes: %#v\n", csr.Attributes)
 	}
 
-	sanContents2, err := marshalSANs([]string{"foo2.example.com"}, nil, nil)
+	sanContents2, err := marshalSANs([]string{"foo2.example.com"}, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
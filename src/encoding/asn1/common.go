@@ -74,6 +74,7 @@ type fieldParameters struct {
 	defaultValue *int64 // a default value for INTEGER typed fields (maybe nil).
 	tag          *int   // the EXPLICIT or IMPLICIT tag (maybe nil).
 	stringType   int    // the string tag to use when marshaling.
+	timeType     int    // the time tag to use when marshaling.
 	set          bool   // true iff this should be encoded as a SET
 	omitEmpty    bool   // true iff this should be omitted if empty when marshaling.
 
@@ -100,6 +101,8 @@ func parseFieldParameters(str string) (ret fieldParameters) {
 			ret.stringType = tagPrintableString
 		case part == "utf8":
 			ret.stringType = tagUTF8String
+		case part == "generalized":
+			ret.timeType = tagGeneralizedTime
 		case strings.HasPrefix(part, "default:"):
 			i, err := strconv.ParseInt(part[8:], 10, 64)
 			if err == nil {
@@ -412,7 +412,7 @@ func marshalBody(out *forkableWriter, value reflect.Value, params fieldParameter
 	switch value.Type() {
 	case timeType:
 		t := value.Interface().(time.Time)
-		if outsideUTCRange(t) {
+		if params.timeType == tagGeneralizedTime || outsideUTCRange(t) {
 			return marshalGeneralizedTime(out, t)
 		} else {
 			return marshalUTCTime(out, t)
@@ -575,7 +575,7 @@ func marshalField(out *forkableWriter, v reflect.Value, params fieldParameters)
 			tag = params.stringType
 		}
 	case tagUTCTime:
-		if outsideUTCRange(v.Interface().(time.Time)) {
+		if params.timeType == tagGeneralizedTime || outsideUTCRange(v.Interface().(time.Time)) {
 			tag = tagGeneralizedTime
 		}
 	}
@@ -629,6 +629,7 @@ func marshalField(out *forkableWriter, v reflect.Value, params fieldParameters)
 // In addition to the struct tags recognised by Unmarshal, the following can be
 // used:
 //
+//	generalized:	causes times to be marshaled as ASN.1, GeneralizedTime
 //	ia5:		causes strings to be marshaled as ASN.1, IA5 strings
 //	omitempty:	causes empty slices to be skipped
 //	printable:	causes strings to be marshaled as ASN.1, PrintableString strings.
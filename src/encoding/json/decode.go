@@ -37,6 +37,15 @@ import (
 // To unmarshal JSON into a struct, Unmarshal matches incoming object
 // keys to the keys used by Marshal (either the struct field name or its tag),
 // preferring an exact match but also accepting a case-insensitive match.
+// Keys that match no field are ignored, and if an object has the same key
+// more than once, the last value wins. A Decoder can be made stricter with
+// its DisallowUnknownFields, DisallowDuplicateKeys and
+// DisallowCaseInsensitiveMatch methods.
+//
+// To unmarshal a JSON object into a map, Unmarshal uses the object keys as
+// map keys. The map's key type must either be a string, an integer type, or
+// implement encoding.TextUnmarshaler, which is the inverse of the rules
+// Marshal uses for map keys.
 //
 // To unmarshal JSON into an interface value,
 // Unmarshal stores one of these in the interface value:
@@ -111,6 +120,32 @@ func (e *UnmarshalFieldError) Error() string {
 	return "json: cannot unmarshal object key " + strconv.Quote(e.Key) + " into unexported field " + e.Field.Name + " of type " + e.Type.String()
 }
 
+// An UnknownFieldError describes a JSON object key that matches no field
+// of the struct being decoded into. It is reported only by a Decoder on
+// which DisallowUnknownFields has been called.
+type UnknownFieldError struct {
+	Key  string       // the object key
+	Path string       // JSON path of the key's value, such as ".items[3].name"
+	Type reflect.Type // type of the struct that has no field for the key
+}
+
+func (e *UnknownFieldError) Error() string {
+	return "json: unknown field " + strconv.Quote(e.Key) + " at " + e.Path + " for Go value of type " + e.Type.String()
+}
+
+// A DuplicateKeyError describes a JSON object key that appears more than
+// once in the same object. When decoding into a struct, two keys that match
+// the same field are duplicates too. It is reported only by a Decoder on
+// which DisallowDuplicateKeys has been called.
+type DuplicateKeyError struct {
+	Key  string // the repeated object key
+	Path string // JSON path of the repeated key's value
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return "json: duplicate key " + strconv.Quote(e.Key) + " at " + e.Path
+}
+
 // An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
 // (The argument to Unmarshal must be a non-nil pointer.)
 type InvalidUnmarshalError struct {
@@ -174,6 +209,22 @@ type decodeState struct {
 	nextscan   scanner // for calls to nextValue
 	savedError error
 	useNumber  bool
+
+	// Settings of a strict Decoder.
+	disallowUnknownFields        bool
+	disallowDuplicateKeys        bool
+	disallowCaseInsensitiveMatch bool
+
+	// path holds the object keys and array indexes leading to the value
+	// being decoded. It is kept only if the errors of a strict Decoder
+	// may need it.
+	path []pathElem
+}
+
+// A pathElem is an object key or, if index isn't negative, an array index.
+type pathElem struct {
+	key   string
+	index int
 }
 
 // errPhase is used for errors that should not happen unless
@@ -185,9 +236,62 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.data = data
 	d.off = 0
 	d.savedError = nil
+	d.path = d.path[:0]
 	return d
 }
 
+// tracksPath reports whether d keeps the path of the value being decoded.
+func (d *decodeState) tracksPath() bool {
+	return d.disallowUnknownFields || d.disallowDuplicateKeys
+}
+
+func (d *decodeState) pushKey(key string) {
+	d.path = append(d.path, pathElem{key: key, index: -1})
+}
+
+func (d *decodeState) pushIndex(i int) {
+	d.path = append(d.path, pathElem{index: i})
+}
+
+func (d *decodeState) pop() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// pathString returns the path of the value being decoded, such as
+// .items[3].name. Keys that aren't simple names are quoted, as in
+// .items["a.b"].
+func (d *decodeState) pathString() string {
+	var b bytes.Buffer
+	for _, e := range d.path {
+		switch {
+		case e.index >= 0:
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(e.index))
+			b.WriteByte(']')
+		case isSimpleKey(e.key):
+			b.WriteByte('.')
+			b.WriteString(e.key)
+		default:
+			b.WriteByte('[')
+			b.WriteString(strconv.Quote(e.key))
+			b.WriteByte(']')
+		}
+	}
+	return b.String()
+}
+
+func isSimpleKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if c != '_' && c != '-' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
 // error aborts the decoding by panicking with err.
 func (d *decodeState) error(err error) {
 	panic(err)
@@ -434,6 +538,9 @@ func (d *decodeState) array(v reflect.Value) {
 			}
 		}
 
+		if d.tracksPath() {
+			d.pushIndex(i)
+		}
 		if i < v.Len() {
 			// Decode into element.
 			d.value(v.Index(i))
@@ -441,6 +548,9 @@ func (d *decodeState) array(v reflect.Value) {
 			// Ran out of fixed array: skip.
 			d.value(reflect.Value{})
 		}
+		if d.tracksPath() {
+			d.pop()
+		}
 		i++
 
 		// Next token must be , or ].
@@ -501,13 +611,20 @@ func (d *decodeState) object(v reflect.Value) {
 	// Check type of target: struct or map[string]T
 	switch v.Kind() {
 	case reflect.Map:
-		// map must have string kind
+		// Map key must either have string kind, have an integer kind,
+		// or be an encoding.TextUnmarshaler.
 		t := v.Type()
-		if t.Key().Kind() != reflect.String {
-			d.saveError(&UnmarshalTypeError{"object", v.Type()})
-			d.off--
-			d.next() // skip over { } in input
-			return
+		switch t.Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !reflect.PtrTo(t.Key()).Implements(textUnmarshalerType) {
+				d.saveError(&UnmarshalTypeError{"object", v.Type()})
+				d.off--
+				d.next() // skip over { } in input
+				return
+			}
 		}
 		if v.IsNil() {
 			v.Set(reflect.MakeMap(t))
@@ -522,6 +639,7 @@ func (d *decodeState) object(v reflect.Value) {
 	}
 
 	var mapElem reflect.Value
+	var seen map[string]bool // keys or field names, for DisallowDuplicateKeys
 
 	for {
 		// Read opening " of string key or closing }.
@@ -543,8 +661,13 @@ func (d *decodeState) object(v reflect.Value) {
 			d.error(errPhase)
 		}
 
+		if d.tracksPath() {
+			d.pushKey(string(key))
+		}
+
 		// Figure out field corresponding to key.
 		var subv reflect.Value
+		var f *field
 		destring := false // whether the value is wrapped in a string to be decoded first
 
 		if v.Kind() == reflect.Map {
@@ -556,7 +679,6 @@ func (d *decodeState) object(v reflect.Value) {
 			}
 			subv = mapElem
 		} else {
-			var f *field
 			fields := cachedTypeFields(v.Type())
 			for i := range fields {
 				ff := &fields[i]
@@ -564,7 +686,7 @@ func (d *decodeState) object(v reflect.Value) {
 					f = ff
 					break
 				}
-				if f == nil && ff.equalFold(ff.nameBytes, key) {
+				if f == nil && !d.disallowCaseInsensitiveMatch && ff.equalFold(ff.nameBytes, key) {
 					f = ff
 				}
 			}
@@ -580,6 +702,23 @@ func (d *decodeState) object(v reflect.Value) {
 					}
 					subv = subv.Field(i)
 				}
+			} else if d.disallowUnknownFields {
+				d.saveError(&UnknownFieldError{string(key), d.pathString(), v.Type()})
+			}
+		}
+
+		if d.disallowDuplicateKeys {
+			name := string(key)
+			if f != nil {
+				name = f.name
+			}
+			if seen[name] {
+				d.saveError(&DuplicateKeyError{string(key), d.pathString()})
+			} else {
+				if seen == nil {
+					seen = make(map[string]bool)
+				}
+				seen[name] = true
 			}
 		}
 
@@ -605,11 +744,16 @@ func (d *decodeState) object(v reflect.Value) {
 			d.value(subv)
 		}
 
+		if d.tracksPath() {
+			d.pop()
+		}
+
 		// Write value back to map;
 		// if using struct, subv points into struct already.
 		if v.Kind() == reflect.Map {
-			kv := reflect.ValueOf(key).Convert(v.Type().Key())
-			v.SetMapIndex(kv, subv)
+			if kv, ok := d.mapKey(key, v.Type().Key()); ok {
+				v.SetMapIndex(kv, subv)
+			}
 		}
 
 		// Next token must be , or }.
@@ -623,6 +767,43 @@ func (d *decodeState) object(v reflect.Value) {
 	}
 }
 
+var textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+
+// mapKey converts the object key to a map key of type kt. Keys of string
+// kind are used directly, encoding.TextUnmarshalers unmarshal the key, and
+// integers are parsed from it. If the key isn't a valid integer, mapKey
+// saves an error and returns false.
+func (d *decodeState) mapKey(key []byte, kt reflect.Type) (reflect.Value, bool) {
+	if kt.Kind() == reflect.String {
+		return reflect.ValueOf(key).Convert(kt), true
+	}
+	if reflect.PtrTo(kt).Implements(textUnmarshalerType) {
+		kv := reflect.New(kt)
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText(key); err != nil {
+			d.error(err)
+		}
+		return kv.Elem(), true
+	}
+	s := string(key)
+	switch kt.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || reflect.Zero(kt).OverflowInt(n) {
+			d.saveError(&UnmarshalTypeError{"number " + s, kt})
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(n).Convert(kt), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || reflect.Zero(kt).OverflowUint(n) {
+			d.saveError(&UnmarshalTypeError{"number " + s, kt})
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(n).Convert(kt), true
+	}
+	panic("unexpected map key type")
+}
+
 // literal consumes a literal from d.data[d.off-1:], decoding into the value v.
 // The first byte of the literal has been read already
 // (that's how the caller knows it's a literal).
@@ -851,7 +1032,13 @@ func (d *decodeState) arrayInterface() []interface{} {
 		d.off--
 		d.scan.undo(op)
 
-		v = append(v, d.valueInterface())
+		if d.tracksPath() {
+			d.pushIndex(len(v))
+			v = append(v, d.valueInterface())
+			d.pop()
+		} else {
+			v = append(v, d.valueInterface())
+		}
 
 		// Next token must be , or ].
 		op = d.scanWhile(scanSkipSpace)
@@ -896,9 +1083,20 @@ func (d *decodeState) objectInterface() map[string]interface{} {
 			d.error(errPhase)
 		}
 
+		if d.tracksPath() {
+			d.pushKey(key)
+			if _, dup := m[key]; dup && d.disallowDuplicateKeys {
+				d.saveError(&DuplicateKeyError{key, d.pathString()})
+			}
+		}
+
 		// Read value.
 		m[key] = d.valueInterface()
 
+		if d.tracksPath() {
+			d.pop()
+		}
+
 		// Next token must be , or }.
 		op = d.scanWhile(scanSkipSpace)
 		if op == scanEndObject {
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"image"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -411,8 +412,56 @@ var unmarshalTests = []unmarshalTest{
 	{
 		in:  `{"2009-11-10T23:00:00Z": "hello world"}`,
 		ptr: &map[time.Time]string{},
-		err: &UnmarshalTypeError{"object", reflect.TypeOf(map[time.Time]string{})},
+		out: map[time.Time]string{time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC): "hello world"},
 	},
+
+	// map keys
+	{
+		in:  `{"-1": "a", "0": "b", "10": "c"}`,
+		ptr: new(map[int]string),
+		out: map[int]string{-1: "a", 0: "b", 10: "c"},
+	},
+	{
+		in:  `{"255": 1}`,
+		ptr: new(map[uint8]int),
+		out: map[uint8]int{255: 1},
+	},
+	{
+		in:  `{"256": 1}`,
+		ptr: new(map[uint8]int),
+		err: &UnmarshalTypeError{"number 256", reflect.TypeOf(uint8(0))},
+	},
+	{
+		in:  `{"x": 1}`,
+		ptr: new(map[int]int),
+		err: &UnmarshalTypeError{"number x", reflect.TypeOf(0)},
+	},
+	{
+		in:  `{"id-7": "seven", "id-42": "forty-two"}`,
+		ptr: new(map[textKey]string),
+		out: map[textKey]string{7: "seven", 42: "forty-two"},
+	},
+	{
+		in:  `{"x": 1}`,
+		ptr: new(map[bool]int),
+		err: &UnmarshalTypeError{"object", reflect.TypeOf(map[bool]int{})},
+	},
+}
+
+// textKey is a map key that marshals as text.
+type textKey int
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte("id-" + strconv.Itoa(int(k))), nil
+}
+
+func (k *textKey) UnmarshalText(b []byte) error {
+	if !bytes.HasPrefix(b, []byte("id-")) {
+		return fmt.Errorf("bad key %q", b)
+	}
+	n, err := strconv.Atoi(string(b[3:]))
+	*k = textKey(n)
+	return err
 }
 
 func TestMarshal(t *testing.T) {
@@ -569,6 +618,152 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+type strictItem struct {
+	Name string `json:"name"`
+	Tags []string
+}
+
+type strictConfig struct {
+	Items []strictItem `json:"items"`
+	Extra map[string]int
+	Any   interface{}
+}
+
+var itemType = reflect.TypeOf(strictItem{})
+
+var strictTests = []struct {
+	in               string
+	unknown, dup, cs bool // DisallowUnknownFields, DisallowDuplicateKeys, DisallowCaseInsensitiveMatch
+	out              strictConfig
+	err              error
+}{
+	// Lenient decoding accepts everything.
+	{
+		in:  `{"items": [{"name": "a", "nmae": "b", "name": "c"}]}`,
+		out: strictConfig{Items: []strictItem{{Name: "c"}}},
+	},
+	{
+		in:  `{"items": [{"NAME": "a"}]}`,
+		out: strictConfig{Items: []strictItem{{Name: "a"}}},
+	},
+
+	// Unknown fields.
+	{
+		in:      `{"items": [{"name": "a"}, {}, {}, {"nmae": "b"}]}`,
+		unknown: true,
+		err:     &UnknownFieldError{"nmae", ".items[3].nmae", itemType},
+	},
+	{
+		in:      `{"items": [{"name": "a", "Tags": ["x"]}], "Extra": {"anything": 1}, "Any": {"goes": true}}`,
+		unknown: true,
+		out: strictConfig{
+			Items: []strictItem{{Name: "a", Tags: []string{"x"}}},
+			Extra: map[string]int{"anything": 1},
+			Any:   map[string]interface{}{"goes": true},
+		},
+	},
+	{
+		in:      `{"items": [{"a.b": 1}]}`,
+		unknown: true,
+		err:     &UnknownFieldError{"a.b", `.items[0]["a.b"]`, itemType},
+	},
+
+	// Duplicate keys.
+	{
+		in:  `{"items": [{"name": "a", "name": "b"}]}`,
+		dup: true,
+		err: &DuplicateKeyError{"name", ".items[0].name"},
+	},
+	{
+		in:  `{"items": [{"name": "a", "Name": "b"}]}`,
+		dup: true,
+		err: &DuplicateKeyError{"Name", ".items[0].Name"},
+	},
+	{
+		in:  `{"Extra": {"x": 1, "y": 2, "x": 3}}`,
+		dup: true,
+		err: &DuplicateKeyError{"x", ".Extra.x"},
+	},
+	{
+		in:  `{"Any": [0, {"k": 1, "k": 2}]}`,
+		dup: true,
+		err: &DuplicateKeyError{"k", ".Any[1].k"},
+	},
+	{
+		in:  `{"items": [], "items": []}`,
+		dup: true,
+		err: &DuplicateKeyError{"items", ".items"},
+	},
+	{
+		in:  `{"Extra": {"x": 1, "X": 2}, "Any": {"k": 1, "K": 2}}`,
+		dup: true,
+		out: strictConfig{
+			Extra: map[string]int{"x": 1, "X": 2},
+			Any:   map[string]interface{}{"k": float64(1), "K": float64(2)},
+		},
+	},
+
+	// Exact-case field names.
+	{
+		in:  `{"items": [{"NAME": "a", "tags": ["x"]}]}`,
+		cs:  true,
+		out: strictConfig{Items: []strictItem{{}}},
+	},
+	{
+		in:      `{"items": [{"NAME": "a"}]}`,
+		cs:      true,
+		unknown: true,
+		err:     &UnknownFieldError{"NAME", ".items[0].NAME", itemType},
+	},
+	{
+		in:  `{"items": [{"name": "a", "Name": "b"}]}`,
+		cs:  true,
+		dup: true,
+		out: strictConfig{Items: []strictItem{{Name: "a"}}},
+	},
+}
+
+func TestDecoderStrict(t *testing.T) {
+	for i, tt := range strictTests {
+		dec := NewDecoder(strings.NewReader(tt.in))
+		if tt.unknown {
+			dec.DisallowUnknownFields()
+		}
+		if tt.dup {
+			dec.DisallowDuplicateKeys()
+		}
+		if tt.cs {
+			dec.DisallowCaseInsensitiveMatch()
+		}
+		var out strictConfig
+		err := dec.Decode(&out)
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: error %#v, want %#v", i, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("#%d: got %+v, want %+v", i, out, tt.out)
+		}
+	}
+}
+
+func TestDecoderStrictErrorMessages(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`{"items": [{"nmae": "a"}]} {"items": [], "items": []}`))
+	dec.DisallowUnknownFields()
+	dec.DisallowDuplicateKeys()
+
+	var c strictConfig
+	want := `json: unknown field "nmae" at .items[0].nmae for Go value of type json.strictItem`
+	if err := dec.Decode(&c); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	// The decoder is still usable, and the path starts afresh.
+	want = `json: duplicate key "items" at .items`
+	if err := dec.Decode(&c); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
 func TestUnmarshalMarshal(t *testing.T) {
 	initBig()
 	var v interface{}
@@ -112,9 +112,12 @@ import (
 // an anonymous struct field in both current and earlier versions, give the field
 // a JSON tag of "-".
 //
-// Map values encode as JSON objects.
-// The map's key type must be string; the object keys are used directly
-// as map keys.
+// Map values encode as JSON objects. The map's key type must either be a
+// string, an integer type, or implement encoding.TextMarshaler. The map keys
+// are sorted and used as JSON object keys by applying the following rules:
+//   - keys of any string type are used directly
+//   - encoding.TextMarshalers are marshaled
+//   - integer keys are converted to strings
 //
 // Pointer values encode as the value pointed to.
 // A nil pointer encodes as the null JSON object.
@@ -131,7 +134,7 @@ import (
 // an infinite recursion.
 //
 func Marshal(v interface{}) ([]byte, error) {
-	e := &encodeState{}
+	e := &encodeState{escapeHTML: true}
 	err := e.marshal(v)
 	if err != nil {
 		return nil, err
@@ -242,6 +245,7 @@ var hex = "0123456789abcdef"
 type encodeState struct {
 	bytes.Buffer // accumulated output
 	scratch      [64]byte
+	escapeHTML   bool // whether to escape <, > and & in strings
 }
 
 var encodeStatePool sync.Pool
@@ -416,7 +420,7 @@ func marshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	b, err := m.MarshalJSON()
 	if err == nil {
 		// copy JSON into buffer, checking validity.
-		err = compact(&e.Buffer, b, true)
+		err = compact(&e.Buffer, b, e.escapeHTML)
 	}
 	if err != nil {
 		e.error(&MarshalerError{v.Type(), err})
@@ -433,7 +437,7 @@ func addrMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	b, err := m.MarshalJSON()
 	if err == nil {
 		// copy JSON into buffer, checking validity.
-		err = compact(&e.Buffer, b, true)
+		err = compact(&e.Buffer, b, e.escapeHTML)
 	}
 	if err != nil {
 		e.error(&MarshalerError{v.Type(), err})
@@ -608,22 +612,38 @@ func (me *mapEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
 		return
 	}
 	e.WriteByte('{')
-	var sv stringValues = v.MapKeys()
+
+	// Extract and sort the keys.
+	keys := v.MapKeys()
+	sv := make(keyValues, len(keys))
+	for i, k := range keys {
+		sv[i].v = k
+		if err := sv[i].resolve(); err != nil {
+			e.error(&MarshalerError{k.Type(), err})
+		}
+	}
 	sort.Sort(sv)
-	for i, k := range sv {
+
+	for i, kv := range sv {
 		if i > 0 {
 			e.WriteByte(',')
 		}
-		e.string(k.String())
+		e.string(kv.s)
 		e.WriteByte(':')
-		me.elemEnc(e, v.MapIndex(k), false)
+		me.elemEnc(e, v.MapIndex(kv.v), false)
 	}
 	e.WriteByte('}')
 }
 
 func newMapEncoder(t reflect.Type) encoderFunc {
-	if t.Key().Kind() != reflect.String {
-		return unsupportedTypeEncoder
+	switch t.Key().Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !t.Key().Implements(textMarshalerType) {
+			return unsupportedTypeEncoder
+		}
 	}
 	me := &mapEncoder{typeEncoder(t.Elem())}
 	return me.encode
@@ -772,14 +792,43 @@ func typeByIndex(t reflect.Type, index []int) reflect.Type {
 	return t
 }
 
-// stringValues is a slice of reflect.Value holding *reflect.StringValue.
-// It implements the methods to sort by string.
-type stringValues []reflect.Value
+// A keyValue is a map key and the string it encodes as.
+type keyValue struct {
+	v reflect.Value
+	s string
+}
+
+// resolve sets kv.s to the object key for kv.v.
+func (kv *keyValue) resolve() error {
+	if kv.v.Kind() == reflect.String {
+		kv.s = kv.v.String()
+		return nil
+	}
+	if tm, ok := kv.v.Interface().(encoding.TextMarshaler); ok {
+		if kv.v.Kind() == reflect.Ptr && kv.v.IsNil() {
+			return nil
+		}
+		b, err := tm.MarshalText()
+		kv.s = string(b)
+		return err
+	}
+	switch kv.v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		kv.s = strconv.FormatInt(kv.v.Int(), 10)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		kv.s = strconv.FormatUint(kv.v.Uint(), 10)
+		return nil
+	}
+	panic("unexpected map key type")
+}
+
+// keyValues is a slice of map keys that sorts by their strings.
+type keyValues []keyValue
 
-func (sv stringValues) Len() int           { return len(sv) }
-func (sv stringValues) Swap(i, j int)      { sv[i], sv[j] = sv[j], sv[i] }
-func (sv stringValues) Less(i, j int) bool { return sv.get(i) < sv.get(j) }
-func (sv stringValues) get(i int) string   { return sv[i].String() }
+func (sv keyValues) Len() int           { return len(sv) }
+func (sv keyValues) Swap(i, j int)      { sv[i], sv[j] = sv[j], sv[i] }
+func (sv keyValues) Less(i, j int) bool { return sv[i].s < sv[j].s }
 
 // NOTE: keep in sync with stringBytes below.
 func (e *encodeState) string(s string) (int, error) {
@@ -788,7 +837,7 @@ func (e *encodeState) string(s string) (int, error) {
 	start := 0
 	for i := 0; i < len(s); {
 		if b := s[i]; b < utf8.RuneSelf {
-			if 0x20 <= b && b != '\\' && b != '"' && b != '<' && b != '>' && b != '&' {
+			if 0x20 <= b && b != '\\' && b != '"' && (!e.escapeHTML || b != '<' && b != '>' && b != '&') {
 				i++
 				continue
 			}
@@ -810,9 +859,10 @@ func (e *encodeState) string(s string) (int, error) {
 				e.WriteByte('t')
 			default:
 				// This encodes bytes < 0x20 except for \n and \r,
-				// as well as <, > and &. The latter are escaped because they
-				// can lead to security holes when user-controlled strings
-				// are rendered into JSON and served to some browsers.
+				// as well as <, > and & unless HTML escaping is off. The
+				// latter are escaped because they can lead to security holes
+				// when user-controlled strings are rendered into JSON and
+				// served to some browsers.
 				e.WriteString(`\u00`)
 				e.WriteByte(hex[b>>4])
 				e.WriteByte(hex[b&0xF])
@@ -864,7 +914,7 @@ func (e *encodeState) stringBytes(s []byte) (int, error) {
 	start := 0
 	for i := 0; i < len(s); {
 		if b := s[i]; b < utf8.RuneSelf {
-			if 0x20 <= b && b != '\\' && b != '"' && b != '<' && b != '>' && b != '&' {
+			if 0x20 <= b && b != '\\' && b != '"' && (!e.escapeHTML || b != '<' && b != '>' && b != '&') {
 				i++
 				continue
 			}
@@ -886,9 +936,10 @@ func (e *encodeState) stringBytes(s []byte) (int, error) {
 				e.WriteByte('t')
 			default:
 				// This encodes bytes < 0x20 except for \n and \r,
-				// as well as <, >, and &. The latter are escaped because they
-				// can lead to security holes when user-controlled strings
-				// are rendered into JSON and served to some browsers.
+				// as well as <, > and & unless HTML escaping is off. The
+				// latter are escaped because they can lead to security holes
+				// when user-controlled strings are rendered into JSON and
+				// served to some browsers.
 				e.WriteString(`\u00`)
 				e.WriteByte(hex[b>>4])
 				e.WriteByte(hex[b&0xF])
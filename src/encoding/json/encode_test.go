@@ -453,6 +453,43 @@ func TestHTMLEscape(t *testing.T) {
 	}
 }
 
+func TestMarshalMapKeys(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{map[int]string{10: "c", -1: "a", 2: "b"}, `{"-1":"a","10":"c","2":"b"}`},
+		{map[uint8]bool{255: true, 0: false}, `{"0":false,"255":true}`},
+		{map[textKey]int{42: 2, 7: 1}, `{"id-42":2,"id-7":1}`},
+		{map[string]int{"<b>": 1}, `{"\u003cb\u003e":1}`},
+	}
+	for _, tt := range tests {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("Marshal(%v): %v", tt.in, err)
+			continue
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal(%v) = %s, want %s", tt.in, b, tt.want)
+		}
+
+		// The keys round trip.
+		out := reflect.New(reflect.TypeOf(tt.in))
+		if err := Unmarshal(b, out.Interface()); err != nil {
+			t.Errorf("Unmarshal(%s): %v", b, err)
+			continue
+		}
+		if !reflect.DeepEqual(out.Elem().Interface(), tt.in) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", b, out.Elem().Interface(), tt.in)
+		}
+	}
+
+	_, err := Marshal(map[bool]int{true: 1})
+	if _, ok := err.(*UnsupportedTypeError); !ok {
+		t.Errorf("Marshal(map[bool]int) error %v, want UnsupportedTypeError", err)
+	}
+}
+
 // golang.org/issue/8582
 func TestEncodePointerString(t *testing.T) {
 	type stringPointer struct {
@@ -0,0 +1,60 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"encoding/jsonpatch"
+	"fmt"
+	"log"
+)
+
+func ExamplePointer_GetRaw() {
+	doc := []byte(`{"servers": [{"name": "alpha", "port": 8080}, {"name": "beta", "port": 8081}]}`)
+	p, err := jsonpatch.ParsePointer("/servers/1/port")
+	if err != nil {
+		log.Fatal(err)
+	}
+	port, err := p.GetRaw(doc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s\n", port)
+	// Output:
+	// 8081
+}
+
+func ExamplePatch_Apply() {
+	doc := []byte(`{"name": "alpha", "tags": ["a", "b"]}`)
+	var patch jsonpatch.Patch
+	err := json.Unmarshal([]byte(`[
+		{"op": "test", "path": "/name", "value": "alpha"},
+		{"op": "replace", "path": "/name", "value": "beta"},
+		{"op": "add", "path": "/tags/-", "value": "c"},
+		{"op": "remove", "path": "/tags/0"}
+	]`), &patch)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := patch.Apply(doc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s\n", out)
+	// Output:
+	// {"name":"beta","tags":["b","c"]}
+}
+
+func ExampleMergePatch() {
+	config := []byte(`{"log": {"level": "info", "file": "/var/log/app"}, "port": 8080}`)
+	override := []byte(`{"log": {"level": "debug", "file": null}}`)
+	out, err := jsonpatch.MergePatch(config, override)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s\n", out)
+	// Output:
+	// {"log":{"level":"debug"},"port":8080}
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// MergePatch applies the JSON Merge Patch patch to the JSON document doc
+// and returns the encoding of the result.
+//
+// A merge patch is a document shaped like the result: the members of an
+// object in the patch replace those of the corresponding object in doc,
+// recursively, and members whose value is null are removed. Anything
+// other than an object, arrays included, replaces the target as a whole.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	d, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(d, p))
+}
+
+// MergePatchValue is like MergePatch but works on decoded documents. It
+// modifies neither doc nor patch; the result shares no maps or slices
+// with them.
+func MergePatchValue(doc, patch interface{}) interface{} {
+	return mergePatch(deepCopy(doc), patch)
+}
+
+// mergePatch is the algorithm of section 2 of RFC 7386. It changes the
+// objects of doc in place but copies what it takes from patch.
+func mergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopy(patch)
+	}
+	d, ok := doc.(map[string]interface{})
+	if !ok {
+		d = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+		} else {
+			d[k] = mergePatch(d[k], v)
+		}
+	}
+	return d
+}
+
+// CreateMergePatch returns a JSON Merge Patch that turns the JSON
+// document original into modified.
+//
+// Since null removes a member, a merge patch can't set a member of an
+// object to null. CreateMergePatch returns an error if modified would
+// need it to.
+func CreateMergePatch(original, modified []byte) ([]byte, error) {
+	a, err := decode(original)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decode(modified)
+	if err != nil {
+		return nil, err
+	}
+	p, err := mergeDiff(Pointer{}, a, b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(p)
+}
+
+// mergeDiff returns the merge patch that turns a, found at p, into b.
+func mergeDiff(p Pointer, a, b interface{}) (interface{}, error) {
+	am, ok := a.(map[string]interface{})
+	bm, ok1 := b.(map[string]interface{})
+	if !ok || !ok1 {
+		if err := checkNoNull(p, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	patch := make(map[string]interface{})
+	for k := range am {
+		if _, ok := bm[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, bv := range bm {
+		av, ok := am[k]
+		switch {
+		case ok && equal(av, bv):
+			continue
+		case bv == nil:
+			return nil, errNullMember(p.append(k))
+		case ok:
+			v, err := mergeDiff(p.append(k), av, bv)
+			if err != nil {
+				return nil, err
+			}
+			patch[k] = v
+		default:
+			if err := checkNoNull(p.append(k), bv); err != nil {
+				return nil, err
+			}
+			patch[k] = bv
+		}
+	}
+	return patch, nil
+}
+
+// checkNoNull returns an error if v, found at p, is an object with a
+// member, at any depth, whose value is null. Arrays aren't searched, since
+// a merge patch copies them as they are.
+func checkNoNull(p Pointer, v interface{}) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for k, e := range m {
+		if e == nil {
+			return errNullMember(p.append(k))
+		}
+		if err := checkNoNull(p.append(k), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func errNullMember(p Pointer) error {
+	return errors.New("jsonpatch: merge patch can't set " + strconv.Quote(p.String()) + " to null")
+}
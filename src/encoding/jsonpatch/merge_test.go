@@ -0,0 +1,107 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The examples of appendix A of RFC 7386.
+var mergeTests = []struct {
+	doc, patch, want string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, tt := range mergeTests {
+		out, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s): %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !jsonEqual(t, out, []byte(tt.want)) {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", tt.doc, tt.patch, out, tt.want)
+		}
+	}
+}
+
+func TestMergePatchValue(t *testing.T) {
+	for _, tt := range mergeTests {
+		doc, err := decode([]byte(tt.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patch, err := decode([]byte(tt.patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		origDoc, origPatch := deepCopy(doc), deepCopy(patch)
+		v := MergePatchValue(doc, patch)
+		if !reflect.DeepEqual(doc, origDoc) || !reflect.DeepEqual(patch, origPatch) {
+			t.Errorf("MergePatchValue(%s, %s) modified its arguments", tt.doc, tt.patch)
+		}
+		want, _ := decode([]byte(tt.want))
+		if !equal(v, want) {
+			t.Errorf("MergePatchValue(%s, %s) = %v, want %v", tt.doc, tt.patch, v, want)
+		}
+	}
+}
+
+var mergeDiffTests = []struct {
+	a, b string
+	ok   bool
+}{
+	{`{}`, `{}`, true},
+	{`{"a":1,"b":{"c":2,"d":3}}`, `{"b":{"c":2,"d":4},"e":[null]}`, true},
+	{`{"a":{"b":1}}`, `{"a":[1]}`, true},
+	{`{"a":[1]}`, `{"a":{"b":1}}`, true},
+	{`{"a":1}`, `"x"`, true},
+	{`"x"`, `{"a":1}`, true},
+	{`{"a":1}`, `null`, true},
+	{`{"a":null}`, `{"a":null,"b":1}`, true},
+	{`{"a":1}`, `{"a":null}`, false},
+	{`{}`, `{"a":{"b":null}}`, false},
+	{`[]`, `{"a":{"b":null}}`, false},
+}
+
+func TestCreateMergePatch(t *testing.T) {
+	for _, tt := range mergeDiffTests {
+		p, err := CreateMergePatch([]byte(tt.a), []byte(tt.b))
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("CreateMergePatch(%s, %s) = %s, want error", tt.a, tt.b, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("CreateMergePatch(%s, %s): %v", tt.a, tt.b, err)
+			continue
+		}
+		out, err := MergePatch([]byte(tt.a), p)
+		if err != nil {
+			t.Errorf("CreateMergePatch(%s, %s) = %s: MergePatch: %v", tt.a, tt.b, p, err)
+			continue
+		}
+		if !jsonEqual(t, out, []byte(tt.b)) {
+			t.Errorf("CreateMergePatch(%s, %s) = %s, which gives %s", tt.a, tt.b, p, out)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Operation is a single operation of a JSON Patch. Op is one of "add",
+// "remove", "replace", "move", "copy" or "test". Path and From are JSON
+// Pointers in their string form; From is used only by move and copy.
+// Value is the encoding of the operand of add, replace and test.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// A Patch is a JSON Patch: a sequence of operations applied to a document
+// in order. Its JSON encoding is the one given by RFC 6902, so a patch
+// can be read with json.Unmarshal.
+type Patch []Operation
+
+// ErrTestFailed is the error of a test operation whose value doesn't
+// match the document.
+var ErrTestFailed = errors.New("jsonpatch: test failed")
+
+// An OperationError describes an operation of a Patch that could not be
+// applied.
+type OperationError struct {
+	Index int       // index of the operation in the Patch
+	Op    Operation // the operation
+	Err   error     // why it failed
+}
+
+func (e *OperationError) Error() string {
+	return "jsonpatch: operation " + strconv.Itoa(e.Index) + " (" + e.Op.Op + " " + strconv.Quote(e.Op.Path) + "): " +
+		strings.TrimPrefix(e.Err.Error(), "jsonpatch: ")
+}
+
+// Apply applies the patch to the JSON document doc and returns the
+// encoding of the result. Either every operation is applied or, if one
+// fails, an error is returned, which is an *OperationError unless doc
+// itself is invalid.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	v, err = p.apply(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// ApplyValue is like Apply but works on a decoded document. It doesn't
+// modify doc; the result shares no maps or slices with it.
+func (p Patch) ApplyValue(doc interface{}) (interface{}, error) {
+	return p.apply(deepCopy(doc))
+}
+
+func (p Patch) apply(doc interface{}) (interface{}, error) {
+	for i, op := range p {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, &OperationError{i, op, err}
+		}
+	}
+	return doc, nil
+}
+
+func (op *Operation) apply(doc interface{}) (interface{}, error) {
+	path, err := ParsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return v, nil
+		}
+		return update(doc, path, 0, func(c interface{}, tok string) (interface{}, error) {
+			switch c := c.(type) {
+			case map[string]interface{}:
+				if _, ok := c[tok]; !ok {
+					return nil, errors.New("jsonpatch: no member " + strconv.Quote(tok) + " to replace")
+				}
+				c[tok] = v
+				return c, nil
+			case []interface{}:
+				i, err := arrayIndex(tok, len(c), false)
+				if err != nil {
+					return nil, err
+				}
+				c[i] = v
+				return c, nil
+			}
+			return nil, errNotContainer
+		})
+	case "move":
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if from.isPrefixOf(path) {
+			return nil, errors.New("jsonpatch: can't move a value into itself")
+		}
+		doc, v, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "copy":
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := from.Get(doc)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(v))
+	case "test":
+		want, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := path.Get(doc)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(v, want) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, errors.New("jsonpatch: unknown operation " + strconv.Quote(op.Op))
+}
+
+// value decodes op.Value.
+func (op *Operation) value() (interface{}, error) {
+	if len(op.Value) == 0 {
+		return nil, errors.New("jsonpatch: missing value")
+	}
+	return decode(op.Value)
+}
+
+var errNotContainer = errors.New("jsonpatch: parent is not an object or array")
+
+// update finds the container that holds the value p refers to and
+// replaces it, in its own parent, by what fn returns for it and the last
+// token of p. It returns the updated document. Maps are changed in place;
+// slices may be reallocated, which is why each level is stored back. The
+// first i tokens of p have already been followed to reach doc.
+func update(doc interface{}, p Pointer, i int, fn func(container interface{}, tok string) (interface{}, error)) (interface{}, error) {
+	if i == len(p)-1 {
+		return fn(doc, p[i])
+	}
+	tok := p[i]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[tok]
+		if !ok {
+			return nil, errors.New("jsonpatch: no member " + strconv.Quote(tok) + " at " + p[:i].String())
+		}
+		child, err := update(child, p, i+1, fn)
+		if err != nil {
+			return nil, err
+		}
+		v[tok] = child
+		return v, nil
+	case []interface{}:
+		j, err := arrayIndex(tok, len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(v[j], p, i+1, fn)
+		if err != nil {
+			return nil, err
+		}
+		v[j] = child
+		return v, nil
+	}
+	return nil, errors.New("jsonpatch: " + p[:i].String() + " is not an object or array")
+}
+
+// add adds v to doc at p.
+func add(doc interface{}, p Pointer, v interface{}) (interface{}, error) {
+	if len(p) == 0 {
+		return v, nil
+	}
+	return update(doc, p, 0, func(c interface{}, tok string) (interface{}, error) {
+		switch c := c.(type) {
+		case map[string]interface{}:
+			c[tok] = v
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(tok, len(c), true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = v
+			return c, nil
+		}
+		return nil, errNotContainer
+	})
+}
+
+// remove removes the value at p from doc. It returns the updated document
+// and the removed value.
+func remove(doc interface{}, p Pointer) (interface{}, interface{}, error) {
+	if len(p) == 0 {
+		return nil, nil, errors.New("jsonpatch: can't remove the whole document")
+	}
+	var removed interface{}
+	doc, err := update(doc, p, 0, func(c interface{}, tok string) (interface{}, error) {
+		switch c := c.(type) {
+		case map[string]interface{}:
+			v, ok := c[tok]
+			if !ok {
+				return nil, errors.New("jsonpatch: no member " + strconv.Quote(tok) + " to remove")
+			}
+			delete(c, tok)
+			removed = v
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			copy(c[i:], c[i+1:])
+			c[len(c)-1] = nil
+			return c[:len(c)-1], nil
+		}
+		return nil, errNotContainer
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, removed, nil
+}
+
+// CreatePatch returns a Patch that turns the JSON document original into
+// modified. Objects are compared member by member and arrays element by
+// element, so the patch is made of add, remove and replace operations
+// only, and an element inserted near the start of an array shows up as
+// changes to all the elements after it.
+func CreatePatch(original, modified []byte) (Patch, error) {
+	a, err := decode(original)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decode(modified)
+	if err != nil {
+		return nil, err
+	}
+	return diff(Pointer{}, a, b, Patch{})
+}
+
+func diff(p Pointer, a, b interface{}, patch Patch) (Patch, error) {
+	var err error
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			av, inA := a[k]
+			bv, inB := b[k]
+			switch {
+			case !inB:
+				patch = append(patch, Operation{Op: "remove", Path: p.append(k).String()})
+			case !inA:
+				patch, err = appendValueOp(patch, "add", p.append(k), bv)
+			default:
+				patch, err = diff(p.append(k), av, bv, patch)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return patch, nil
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		n := len(a)
+		if len(b) < n {
+			n = len(b)
+		}
+		for i := 0; i < n; i++ {
+			if patch, err = diff(p.append(strconv.Itoa(i)), a[i], b[i], patch); err != nil {
+				return nil, err
+			}
+		}
+		// Remove from the end so that the indexes stay valid.
+		for i := len(a) - 1; i >= n; i-- {
+			patch = append(patch, Operation{Op: "remove", Path: p.append(strconv.Itoa(i)).String()})
+		}
+		for i := n; i < len(b); i++ {
+			if patch, err = appendValueOp(patch, "add", p.append("-"), b[i]); err != nil {
+				return nil, err
+			}
+		}
+		return patch, nil
+	}
+	if equal(a, b) {
+		return patch, nil
+	}
+	return appendValueOp(patch, "replace", p, b)
+}
+
+func appendValueOp(patch Patch, op string, p Pointer, v interface{}) (Patch, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(patch, Operation{Op: op, Path: p.String(), Value: data}), nil
+}
+
+// decode decodes the JSON value in data, keeping numbers as json.Number.
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	// Anything but space after the value, even a stray ] or }, is an error.
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("jsonpatch: invalid data after top-level value")
+	}
+	return v, nil
+}
+
+// deepCopy returns a copy of the decoded JSON value v that shares no maps
+// or slices with it.
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = deepCopy(e)
+		}
+		return a
+	}
+	return v
+}
+
+// equal reports whether the decoded JSON values a and b are equal. Numbers
+// are compared by value, and a json.Number equals a float64 if it rounds
+// to it. Objects are compared regardless of the order of their members.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := b[k]
+			if !ok || !equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		switch b := b.(type) {
+		case json.Number:
+			// Compare exactly, since json.Numbers may hold more
+			// precision than a float64.
+			x, ok := new(big.Rat).SetString(string(a))
+			if !ok {
+				return a == b
+			}
+			y, ok := new(big.Rat).SetString(string(b))
+			return ok && x.Cmp(y) == 0
+		case float64:
+			x, err := a.Float64()
+			return err == nil && x == b
+		}
+		return false
+	case float64:
+		if n, ok := b.(json.Number); ok {
+			return equal(n, a)
+		}
+		return a == b
+	case nil:
+		return b == nil
+	}
+	return reflect.DeepEqual(a, b)
+}
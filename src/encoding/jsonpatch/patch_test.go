@@ -0,0 +1,333 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonpatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// The examples of appendix A of RFC 6902, and a few more. An empty want
+// means that the patch must fail.
+var patchTests = []struct {
+	doc, patch, want string
+}{
+	// A.1. Adding an Object Member
+	{
+		`{"foo": "bar"}`,
+		`[{"op": "add", "path": "/baz", "value": "qux"}]`,
+		`{"baz": "qux", "foo": "bar"}`,
+	},
+	// A.2. Adding an Array Element
+	{
+		`{"foo": ["bar", "baz"]}`,
+		`[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+		`{"foo": ["bar", "qux", "baz"]}`,
+	},
+	// A.3. Removing an Object Member
+	{
+		`{"baz": "qux", "foo": "bar"}`,
+		`[{"op": "remove", "path": "/baz"}]`,
+		`{"foo": "bar"}`,
+	},
+	// A.4. Removing an Array Element
+	{
+		`{"foo": ["bar", "qux", "baz"]}`,
+		`[{"op": "remove", "path": "/foo/1"}]`,
+		`{"foo": ["bar", "baz"]}`,
+	},
+	// A.5. Replacing a Value
+	{
+		`{"baz": "qux", "foo": "bar"}`,
+		`[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+		`{"baz": "boo", "foo": "bar"}`,
+	},
+	// A.6. Moving a Value
+	{
+		`{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+		`[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+		`{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+	},
+	// A.7. Moving an Array Element
+	{
+		`{"foo": ["all", "grass", "cows", "eat"]}`,
+		`[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+		`{"foo": ["all", "cows", "eat", "grass"]}`,
+	},
+	// A.8. Testing a Value: Success
+	{
+		`{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		`[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+		`{"baz": "qux", "foo": ["a", 2, "c"]}`,
+	},
+	// A.9. Testing a Value: Error
+	{
+		`{"baz": "qux"}`,
+		`[{"op": "test", "path": "/baz", "value": "bar"}]`,
+		``,
+	},
+	// A.10. Adding a Nested Member Object
+	{
+		`{"foo": "bar"}`,
+		`[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+		`{"foo": "bar", "child": {"grandchild": {}}}`,
+	},
+	// A.11. Ignoring Unrecognized Elements
+	{
+		`{"foo": "bar"}`,
+		`[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+		`{"foo": "bar", "baz": "qux"}`,
+	},
+	// A.12. Adding to a Nonexistent Target
+	{
+		`{"foo": "bar"}`,
+		`[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		``,
+	},
+	// A.14. ~ Escape Ordering
+	{
+		`{"/": 9, "~1": 10}`,
+		`[{"op": "test", "path": "/~01", "value": 10}]`,
+		`{"/": 9, "~1": 10}`,
+	},
+	// A.15. Comparing Strings and Numbers
+	{
+		`{"/": 9, "~1": 10}`,
+		`[{"op": "test", "path": "/~01", "value": "10"}]`,
+		``,
+	},
+	// A.16. Adding an Array Value
+	{
+		`{"foo": ["bar"]}`,
+		`[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+		`{"foo": ["bar", ["abc", "def"]]}`,
+	},
+
+	// Whole documents.
+	{`{"foo": "bar"}`, `[{"op": "add", "path": "", "value": [1]}]`, `[1]`},
+	{`{"foo": "bar"}`, `[{"op": "replace", "path": "", "value": null}]`, `null`},
+	{`{"foo": "bar"}`, `[{"op": "remove", "path": ""}]`, ``},
+	{`{"foo": "bar"}`, `[{"op": "test", "path": "", "value": {"foo": "bar"}}]`, `{"foo": "bar"}`},
+
+	// Null values.
+	{`{}`, `[{"op": "add", "path": "/a", "value": null}]`, `{"a": null}`},
+	{`{"a": null}`, `[{"op": "test", "path": "/a", "value": null}]`, `{"a": null}`},
+	{`{"a": null}`, `[{"op": "remove", "path": "/a"}]`, `{}`},
+	{`{}`, `[{"op": "add", "path": "/a"}]`, ``},
+
+	// Numbers are compared by value and kept as they are.
+	{`{"a": 1.0}`, `[{"op": "test", "path": "/a", "value": 1e0}]`, `{"a": 1.0}`},
+	{`{"a": 12345678901234567890}`, `[{"op": "test", "path": "/a", "value": 12345678901234567891}]`, ``},
+	{`[1, 2]`, `[{"op": "copy", "from": "/0", "path": "/-"}]`, `[1, 2, 1]`},
+
+	// Objects are compared regardless of member order.
+	{`{"a": {"x": 1, "y": [2]}}`, `[{"op": "test", "path": "/a", "value": {"y": [2], "x": 1}}]`, `{"a": {"x": 1, "y": [2]}}`},
+
+	// Arrays.
+	{`[1, 2]`, `[{"op": "add", "path": "/2", "value": 3}]`, `[1, 2, 3]`},
+	{`[1, 2]`, `[{"op": "add", "path": "/3", "value": 3}]`, ``},
+	{`[1, 2]`, `[{"op": "add", "path": "/01", "value": 3}]`, ``},
+	{`[1, 2]`, `[{"op": "remove", "path": "/2"}]`, ``},
+	{`[1, 2]`, `[{"op": "remove", "path": "/-"}]`, ``},
+	{`[1, 2]`, `[{"op": "replace", "path": "/1", "value": 3}]`, `[1, 3]`},
+	{`[1, 2]`, `[{"op": "replace", "path": "/2", "value": 3}]`, ``},
+
+	// Move and copy.
+	{`{"a": {"b": 1}}`, `[{"op": "move", "from": "/a", "path": "/a/c"}]`, ``},
+	{`{"a": {"b": 1}}`, `[{"op": "move", "from": "/a", "path": "/a"}]`, `{"a": {"b": 1}}`},
+	{`{"a": {"b": 1}}`, `[{"op": "move", "from": "/x", "path": "/y"}]`, ``},
+	{
+		`{"a": {"b": 1}}`,
+		`[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "replace", "path": "/c/b", "value": 2}]`,
+		`{"a": {"b": 1}, "c": {"b": 2}}`,
+	},
+
+	// Other errors.
+	{`{"a": 1}`, `[{"op": "replace", "path": "/b", "value": 2}]`, ``},
+	{`{"a": 1}`, `[{"op": "remove", "path": "/b"}]`, ``},
+	{`{"a": 1}`, `[{"op": "add", "path": "/a/b", "value": 2}]`, ``},
+	{`{"a": 1}`, `[{"op": "add", "path": "a", "value": 2}]`, ``},
+	{`{"a": 1}`, `[{"op": "frob", "path": "/a"}]`, ``},
+
+	// A failing operation undoes the earlier ones.
+	{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2}, {"op": "test", "path": "/a", "value": 2}]`, ``},
+}
+
+// jsonEqual reports whether the JSON documents a and b hold equal values.
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	x, err := decode(a)
+	if err != nil {
+		t.Fatalf("decode %s: %v", a, err)
+	}
+	y, err := decode(b)
+	if err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	return equal(x, y)
+}
+
+func TestPatchApply(t *testing.T) {
+	for i, tt := range patchTests {
+		var p Patch
+		if err := json.Unmarshal([]byte(tt.patch), &p); err != nil {
+			t.Errorf("#%d: unmarshal patch: %v", i, err)
+			continue
+		}
+		out, err := p.Apply([]byte(tt.doc))
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("#%d: Apply = %s, want error", i, out)
+			} else if _, ok := err.(*OperationError); !ok {
+				t.Errorf("#%d: Apply error is %T, want *OperationError", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: Apply: %v", i, err)
+			continue
+		}
+		if !jsonEqual(t, out, []byte(tt.want)) {
+			t.Errorf("#%d: Apply = %s, want %s", i, out, tt.want)
+		}
+	}
+}
+
+func TestPatchApplyValue(t *testing.T) {
+	for i, tt := range patchTests {
+		var p Patch
+		if err := json.Unmarshal([]byte(tt.patch), &p); err != nil {
+			t.Errorf("#%d: unmarshal patch: %v", i, err)
+			continue
+		}
+		doc, err := decode([]byte(tt.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig := deepCopy(doc)
+		v, err := p.ApplyValue(doc)
+		if !reflect.DeepEqual(doc, orig) {
+			t.Errorf("#%d: ApplyValue modified the document to %v", i, doc)
+		}
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("#%d: ApplyValue = %v, want error", i, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: ApplyValue: %v", i, err)
+			continue
+		}
+		want, _ := decode([]byte(tt.want))
+		if !equal(v, want) {
+			t.Errorf("#%d: ApplyValue = %v, want %v", i, v, want)
+		}
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	var p Patch
+	if err := json.Unmarshal([]byte(`[{"op": "add", "path": "/a", "value": 1}, {"op": "test", "path": "/a", "value": 2}]`), &p); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.Apply([]byte(`{}`))
+	oe, ok := err.(*OperationError)
+	if !ok {
+		t.Fatalf("Apply error = %v, want *OperationError", err)
+	}
+	if oe.Index != 1 || oe.Err != ErrTestFailed {
+		t.Errorf("Apply error = %+v, want index 1 and ErrTestFailed", oe)
+	}
+	const want = `jsonpatch: operation 1 (test "/a"): test failed`
+	if s := err.Error(); s != want {
+		t.Errorf("Error() = %q, want %q", s, want)
+	}
+}
+
+var diffTests = []struct {
+	a, b string
+}{
+	{`{}`, `{}`},
+	{`{"a": 1}`, `{"a": 1.0}`},
+	{`{"a": 1, "b": 2}`, `{"b": 3, "c": 4}`},
+	{`{"a": {"x": [1, 2, 3]}}`, `{"a": {"x": [1, 5]}}`},
+	{`{"a": [1]}`, `{"a": [1, {"b": null}, 3]}`},
+	{`{"a": [1, 2]}`, `{"a": {"0": 1}}`},
+	{`{"a~b": {"c/d": 1}}`, `{"a~b": {"c/d": 2}}`},
+	{`[1, 2, 3]`, `[3, 2, 1, 0]`},
+	{`{"a": 1}`, `[1]`},
+	{`"x"`, `null`},
+}
+
+func TestCreatePatch(t *testing.T) {
+	for _, tt := range diffTests {
+		p, err := CreatePatch([]byte(tt.a), []byte(tt.b))
+		if err != nil {
+			t.Errorf("CreatePatch(%s, %s): %v", tt.a, tt.b, err)
+			continue
+		}
+		if jsonEqual(t, []byte(tt.a), []byte(tt.b)) && len(p) != 0 {
+			t.Errorf("CreatePatch(%s, %s) = %v, want empty patch", tt.a, tt.b, p)
+		}
+		out, err := p.Apply([]byte(tt.a))
+		if err != nil {
+			t.Errorf("CreatePatch(%s, %s): Apply: %v", tt.a, tt.b, err)
+			continue
+		}
+		if !jsonEqual(t, out, []byte(tt.b)) {
+			t.Errorf("CreatePatch(%s, %s): Apply = %s", tt.a, tt.b, out)
+		}
+	}
+}
+
+func TestEqualNumbers(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want bool
+	}{
+		{1.0, json.Number("1"), true},
+		{json.Number("1"), 1.0, true},
+		{json.Number("100"), json.Number("1e2"), true},
+		{0.1, json.Number("0.1"), true},
+		{json.Number("12345678901234567890"), json.Number("12345678901234567891"), false},
+		{json.Number("1"), "1", false},
+		{1.0, nil, false},
+	}
+	for _, tt := range tests {
+		if got := equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("equal(%#v, %#v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+var trailingDataTests = []string{
+	`{"a":1}]`,
+	`{"a":1}}`,
+	`{"a":1} {}`,
+	`[1] 2`,
+	`1 x`,
+}
+
+func TestTrailingData(t *testing.T) {
+	var p Patch
+	for _, doc := range trailingDataTests {
+		if out, err := p.Apply([]byte(doc)); err == nil {
+			t.Errorf("Apply(%s) = %s, want error", doc, out)
+		}
+		if out, err := MergePatch([]byte(doc), []byte(`{}`)); err == nil {
+			t.Errorf("MergePatch(%s, {}) = %s, want error", doc, out)
+		}
+		if out, err := MergePatch([]byte(`{}`), []byte(doc)); err == nil {
+			t.Errorf("MergePatch({}, %s) = %s, want error", doc, out)
+		}
+		if out, err := CreatePatch([]byte(`{}`), []byte(doc)); err == nil {
+			t.Errorf("CreatePatch({}, %s) = %v, want error", doc, out)
+		}
+	}
+	if _, err := p.Apply([]byte(" {\"a\":1} \n")); err != nil {
+		t.Errorf("Apply with surrounding space: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jsonpatch implements JSON Pointer, JSON Patch and JSON Merge
+// Patch, as defined in RFC 6901, RFC 6902 and RFC 7386, on top of
+// encoding/json.
+//
+// Documents are either JSON text or trees of the values that
+// encoding/json decodes JSON into an interface{} as:
+// map[string]interface{}, []interface{}, string, float64 or json.Number,
+// bool and nil. When this package decodes JSON text itself, numbers
+// are decoded as json.Number so that they are reproduced exactly.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A Pointer is a JSON Pointer, which identifies a value within a
+// document. It holds the pointer's reference tokens, unescaped. The empty
+// Pointer refers to the whole document.
+type Pointer []string
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// ParsePointer parses a JSON Pointer in its string form, such as
+// "/items/3/name".
+func ParsePointer(s string) (Pointer, error) {
+	if s == "" {
+		return Pointer{}, nil
+	}
+	if s[0] != '/' {
+		return nil, errors.New("jsonpatch: pointer " + strconv.Quote(s) + " doesn't start with /")
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, tok := range tokens {
+		for j := 0; j < len(tok); j++ {
+			if tok[j] == '~' && (j+1 == len(tok) || tok[j+1] != '0' && tok[j+1] != '1') {
+				return nil, errors.New("jsonpatch: bad escape in pointer " + strconv.Quote(s))
+			}
+		}
+		tokens[i] = pointerUnescaper.Replace(tok)
+	}
+	return Pointer(tokens), nil
+}
+
+// String returns the string form of p.
+func (p Pointer) String() string {
+	var b bytes.Buffer
+	for _, tok := range p {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(tok))
+	}
+	return b.String()
+}
+
+// append returns a copy of p with tok added.
+func (p Pointer) append(tok string) Pointer {
+	q := make(Pointer, len(p)+1)
+	copy(q, p)
+	q[len(p)] = tok
+	return q
+}
+
+// isPrefixOf reports whether p is a proper prefix of q, which would make
+// q a location inside p.
+func (p Pointer) isPrefixOf(q Pointer) bool {
+	if len(p) >= len(q) {
+		return false
+	}
+	for i := range p {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the value in doc that p refers to.
+func (p Pointer) Get(doc interface{}) (interface{}, error) {
+	for i, tok := range p {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			child, ok := v[tok]
+			if !ok {
+				return nil, errors.New("jsonpatch: no member " + strconv.Quote(tok) + " at " + p[:i].String())
+			}
+			doc = child
+		case []interface{}:
+			j, err := arrayIndex(tok, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[j]
+		default:
+			return nil, errors.New("jsonpatch: " + p[:i].String() + " is not an object or array")
+		}
+	}
+	return doc, nil
+}
+
+// GetRaw returns the encoding of the value in the JSON document doc that p
+// refers to. Unlike Get, it doesn't decode the rest of the document into
+// Go values, and it returns the value's encoding unchanged.
+func (p Pointer) GetRaw(doc []byte) (json.RawMessage, error) {
+	raw := json.RawMessage(bytes.TrimSpace(doc))
+	for i, tok := range p {
+		if len(raw) == 0 {
+			return nil, errors.New("jsonpatch: empty document")
+		}
+		switch raw[0] {
+		case '{':
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &m); err != nil {
+				return nil, err
+			}
+			child, ok := m[tok]
+			if !ok {
+				return nil, errors.New("jsonpatch: no member " + strconv.Quote(tok) + " at " + p[:i].String())
+			}
+			raw = child
+		case '[':
+			var a []json.RawMessage
+			if err := json.Unmarshal(raw, &a); err != nil {
+				return nil, err
+			}
+			j, err := arrayIndex(tok, len(a), false)
+			if err != nil {
+				return nil, err
+			}
+			raw = a[j]
+		default:
+			return nil, errors.New("jsonpatch: " + p[:i].String() + " is not an object or array")
+		}
+	}
+	if len(p) == 0 {
+		// Nothing was unmarshaled on the way, so check the document here.
+		var v json.RawMessage
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// arrayIndex parses tok as an index into an array of length n. The index
+// must be less than n, or, if end is set, may be n, which is also what the
+// token "-" means.
+func arrayIndex(tok string, n int, end bool) (int, error) {
+	if tok == "-" {
+		if end {
+			return n, nil
+		}
+		return 0, errors.New("jsonpatch: index - refers past the end of the array")
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || tok[0] == '+' || len(tok) > 1 && tok[0] == '0' {
+		return 0, errors.New("jsonpatch: bad array index " + strconv.Quote(tok))
+	}
+	if i > n || i == n && !end {
+		return 0, errors.New("jsonpatch: array index " + tok + " out of range")
+	}
+	return i, nil
+}
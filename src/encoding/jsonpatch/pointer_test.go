@@ -0,0 +1,131 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The example document of section 5 of RFC 6901.
+const pointerDoc = `{
+	"foo": ["bar", "baz"],
+	"": 0,
+	"a/b": 1,
+	"c%d": 2,
+	"e^f": 3,
+	"g|h": 4,
+	"i\\j": 5,
+	"k\"l": 6,
+	" ": 7,
+	"m~n": 8
+}`
+
+var pointerTests = []struct {
+	ptr    string
+	tokens Pointer
+	want   string // encoding of the value
+}{
+	{``, Pointer{}, ``},
+	{`/foo`, Pointer{"foo"}, `["bar", "baz"]`},
+	{`/foo/0`, Pointer{"foo", "0"}, `"bar"`},
+	{`/`, Pointer{""}, `0`},
+	{`/a~1b`, Pointer{"a/b"}, `1`},
+	{`/c%d`, Pointer{"c%d"}, `2`},
+	{`/e^f`, Pointer{"e^f"}, `3`},
+	{`/g|h`, Pointer{"g|h"}, `4`},
+	{`/i\j`, Pointer{`i\j`}, `5`},
+	{`/k"l`, Pointer{`k"l`}, `6`},
+	{`/ `, Pointer{" "}, `7`},
+	{`/m~0n`, Pointer{"m~n"}, `8`},
+}
+
+func TestPointer(t *testing.T) {
+	doc, err := decode([]byte(pointerDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range pointerTests {
+		p, err := ParsePointer(tt.ptr)
+		if err != nil {
+			t.Errorf("ParsePointer(%q): %v", tt.ptr, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, tt.tokens) {
+			t.Errorf("ParsePointer(%q) = %q, want %q", tt.ptr, p, tt.tokens)
+		}
+		if s := p.String(); s != tt.ptr {
+			t.Errorf("ParsePointer(%q).String() = %q", tt.ptr, s)
+		}
+
+		want := doc
+		if tt.want != "" {
+			if want, err = decode([]byte(tt.want)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		v, err := p.Get(doc)
+		if err != nil {
+			t.Errorf("Get(%q): %v", tt.ptr, err)
+		} else if !equal(v, want) {
+			t.Errorf("Get(%q) = %v, want %v", tt.ptr, v, want)
+		}
+
+		raw, err := p.GetRaw([]byte(pointerDoc))
+		if err != nil {
+			t.Errorf("GetRaw(%q): %v", tt.ptr, err)
+			continue
+		}
+		if tt.want != "" && string(raw) != tt.want {
+			t.Errorf("GetRaw(%q) = %s, want %s", tt.ptr, raw, tt.want)
+		}
+	}
+}
+
+var badPointerTests = []string{
+	`foo`,
+	`/m~n`,
+	`/m~`,
+	`/~2`,
+}
+
+func TestParsePointerError(t *testing.T) {
+	for _, s := range badPointerTests {
+		if p, err := ParsePointer(s); err == nil {
+			t.Errorf("ParsePointer(%q) = %q, want error", s, p)
+		}
+	}
+}
+
+var pointerErrorTests = []string{
+	`/missing`,
+	`/foo/2`,
+	`/foo/-`,
+	`/foo/01`,
+	`/foo/+1`,
+	`/foo/-1`,
+	`/foo/x`,
+	`/foo/0/bar`,
+	`/a~1b/c`,
+}
+
+func TestPointerGetError(t *testing.T) {
+	doc, err := decode([]byte(pointerDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range pointerErrorTests {
+		p, err := ParsePointer(s)
+		if err != nil {
+			t.Fatalf("ParsePointer(%q): %v", s, err)
+		}
+		if v, err := p.Get(doc); err == nil {
+			t.Errorf("Get(%q) = %v, want error", s, v)
+		}
+		if raw, err := p.GetRaw([]byte(pointerDoc)); err == nil {
+			t.Errorf("GetRaw(%q) = %s, want error", s, raw)
+		}
+	}
+}
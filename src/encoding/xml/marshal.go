@@ -143,6 +143,29 @@ func (enc *Encoder) Indent(prefix, indent string) {
 	enc.p.indent = indent
 }
 
+// BindPrefix arranges for the next start element the encoder writes to
+// declare prefix as standing for the name space url. Within that element,
+// elements and attributes in the name space are written with the prefix
+// instead of each declaring the name space again, which is how, for
+// example, SOAP and XMPP expect their name spaces to appear. A binding
+// can be shadowed by another binding of the same prefix on an element
+// inside it. A Marshaler may call BindPrefix before writing its own start
+// element.
+//
+// BindPrefix returns an error if prefix is not a valid name space prefix
+// or url is empty. Prefixes beginning with "xml" are reserved.
+func (enc *Encoder) BindPrefix(prefix, url string) error {
+	if prefix == "" || !isName([]byte(prefix)) || strings.Contains(prefix, ":") ||
+		strings.HasPrefix(strings.ToLower(prefix), "xml") {
+		return fmt.Errorf("xml: invalid name space prefix %q", prefix)
+	}
+	if url == "" || url == xmlURL {
+		return fmt.Errorf("xml: invalid name space %q for prefix %s", url, prefix)
+	}
+	enc.p.pending = append(enc.p.pending, printerPrefix{prefix: prefix, url: url})
+	return nil
+}
+
 // Encode writes the XML encoding of v to the stream.
 //
 // See the documentation for Marshal for details about the conversion
@@ -256,16 +279,46 @@ type printer struct {
 	depth      int
 	indentedIn bool
 	putNewline bool
-	attrNS     map[string]string // map prefix -> name space
-	attrPrefix map[string]string // map name space -> prefix
-	prefixes   []string
+	prefixes   []printerPrefix // bindings in scope, innermost last
+	pending    []printerPrefix // bindings for the next start element
 	tags       []Name
 }
 
+// A printerPrefix binds a name space prefix to a name space on an open
+// element. The zero printerPrefix marks where an element's bindings begin.
+type printerPrefix struct {
+	prefix string
+	url    string
+	auto   bool // created by createAttrPrefix for an attribute
+}
+
+// lookupNS returns the name space bound to prefix, or "" if there is none.
+func (p *printer) lookupNS(prefix string) string {
+	for i := len(p.prefixes) - 1; i >= 0; i-- {
+		if b := p.prefixes[i]; b.prefix == prefix {
+			return b.url
+		}
+	}
+	return ""
+}
+
+// lookupPrefix returns the innermost prefix bound to url that hasn't been
+// rebound to another name space since. Prefixes created for attributes
+// are only considered if auto is set.
+func (p *printer) lookupPrefix(url string, auto bool) string {
+	for i := len(p.prefixes) - 1; i >= 0; i-- {
+		b := p.prefixes[i]
+		if b.url == url && b.prefix != "" && (auto || !b.auto) && p.lookupNS(b.prefix) == url {
+			return b.prefix
+		}
+	}
+	return ""
+}
+
 // createAttrPrefix finds the name space prefix attribute to use for the given name space,
 // defining a new prefix if necessary. It returns the prefix.
 func (p *printer) createAttrPrefix(url string) string {
-	if prefix := p.attrPrefix[url]; prefix != "" {
+	if prefix := p.lookupPrefix(url, true); prefix != "" {
 		return prefix
 	}
 
@@ -278,11 +331,6 @@ func (p *printer) createAttrPrefix(url string) string {
 	}
 
 	// Need to define a new name space.
-	if p.attrPrefix == nil {
-		p.attrPrefix = make(map[string]string)
-		p.attrNS = make(map[string]string)
-	}
-
 	// Pick a name. We try to use the final element of the path
 	// but fall back to _.
 	prefix := strings.TrimRight(url, "/")
@@ -296,48 +344,38 @@ func (p *printer) createAttrPrefix(url string) string {
 		// xmlanything is reserved.
 		prefix = "_" + prefix
 	}
-	if p.attrNS[prefix] != "" {
+	if p.lookupNS(prefix) != "" {
 		// Name is taken. Find a better one.
 		for p.seq++; ; p.seq++ {
-			if id := prefix + "_" + strconv.Itoa(p.seq); p.attrNS[id] == "" {
+			if id := prefix + "_" + strconv.Itoa(p.seq); p.lookupNS(id) == "" {
 				prefix = id
 				break
 			}
 		}
 	}
 
-	p.attrPrefix[url] = prefix
-	p.attrNS[prefix] = url
-
 	p.WriteString(`xmlns:`)
 	p.WriteString(prefix)
 	p.WriteString(`="`)
 	EscapeText(p, []byte(url))
 	p.WriteString(`" `)
 
-	p.prefixes = append(p.prefixes, prefix)
+	p.prefixes = append(p.prefixes, printerPrefix{prefix: prefix, url: url, auto: true})
 
 	return prefix
 }
 
-// deleteAttrPrefix removes an attribute name space prefix.
-func (p *printer) deleteAttrPrefix(prefix string) {
-	delete(p.attrPrefix, p.attrNS[prefix])
-	delete(p.attrNS, prefix)
-}
-
 func (p *printer) markPrefix() {
-	p.prefixes = append(p.prefixes, "")
+	p.prefixes = append(p.prefixes, printerPrefix{})
 }
 
 func (p *printer) popPrefix() {
 	for len(p.prefixes) > 0 {
-		prefix := p.prefixes[len(p.prefixes)-1]
+		b := p.prefixes[len(p.prefixes)-1]
 		p.prefixes = p.prefixes[:len(p.prefixes)-1]
-		if prefix == "" {
+		if b.prefix == "" {
 			break
 		}
-		p.deleteAttrPrefix(prefix)
 	}
 }
 
@@ -614,16 +652,50 @@ func (p *printer) writeStart(start *StartElement) error {
 	p.tags = append(p.tags, start.Name)
 	p.markPrefix()
 
+	// The element's own name space declarations apply to its name and
+	// attributes too, so bring them into scope first. Declarations among
+	// the attributes take precedence over those made with BindPrefix.
+	pending := p.pending
+	p.pending = nil
+	defaultNS := false
+	for _, b := range pending {
+		p.prefixes = append(p.prefixes, b)
+	}
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "xmlns" && attr.Name.Local != "" && attr.Value != "":
+			p.prefixes = append(p.prefixes, printerPrefix{prefix: attr.Name.Local, url: attr.Value})
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns" && attr.Value == start.Name.Space:
+			defaultNS = true
+		}
+	}
+
 	p.writeIndent(1)
 	p.WriteByte('<')
+	prefix := p.elementPrefix(start.Name)
+	if prefix != "" {
+		p.WriteString(prefix)
+		p.WriteByte(':')
+	}
 	p.WriteString(start.Name.Local)
 
-	if start.Name.Space != "" {
+	if start.Name.Space != "" && prefix == "" && !defaultNS {
 		p.WriteString(` xmlns="`)
 		p.EscapeString(start.Name.Space)
 		p.WriteByte('"')
 	}
 
+	for _, b := range pending {
+		if declaresPrefix(start, b.prefix) {
+			continue
+		}
+		p.WriteString(` xmlns:`)
+		p.WriteString(b.prefix)
+		p.WriteString(`="`)
+		p.EscapeString(b.url)
+		p.WriteByte('"')
+	}
+
 	// Attributes
 	for _, attr := range start.Attr {
 		name := attr.Name
@@ -631,7 +703,10 @@ func (p *printer) writeStart(start *StartElement) error {
 			continue
 		}
 		p.WriteByte(' ')
-		if name.Space != "" {
+		if name.Space == "xmlns" {
+			// A name space declaration, already in scope.
+			p.WriteString("xmlns:")
+		} else if name.Space != "" {
 			p.WriteString(p.createAttrPrefix(name.Space))
 			p.WriteByte(':')
 		}
@@ -644,6 +719,26 @@ func (p *printer) writeStart(start *StartElement) error {
 	return nil
 }
 
+// elementPrefix returns the prefix to write an element with the given
+// name with, or "" if it is written unqualified. Only prefixes declared
+// explicitly, with BindPrefix or an xmlns attribute, are used.
+func (p *printer) elementPrefix(name Name) string {
+	if name.Space == "" {
+		return ""
+	}
+	return p.lookupPrefix(name.Space, false)
+}
+
+// declaresPrefix reports whether start has an attribute declaring prefix.
+func declaresPrefix(start *StartElement, prefix string) bool {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" && attr.Name.Local == prefix {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *printer) writeEnd(name Name) error {
 	if name.Local == "" {
 		return fmt.Errorf("xml: end tag with no name")
@@ -662,6 +757,11 @@ func (p *printer) writeEnd(name Name) error {
 	p.writeIndent(-1)
 	p.WriteByte('<')
 	p.WriteByte('/')
+	// The bindings in scope are those the start tag saw.
+	if prefix := p.elementPrefix(name); prefix != "" {
+		p.WriteString(prefix)
+		p.WriteByte(':')
+	}
 	p.WriteString(name.Local)
 	p.WriteByte('>')
 	p.popPrefix()
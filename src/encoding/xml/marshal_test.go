@@ -1197,6 +1197,9 @@ var encodeTokenTests = []struct {
 	ok   bool
 }{
 	{StartElement{Name{"space", "local"}, nil}, "<local xmlns=\"space\">", true},
+	{StartElement{Name{"space", "local"}, []Attr{{Name{"", "xmlns"}, "space"}}}, "<local xmlns=\"space\">", true},
+	{StartElement{Name{"space", "local"}, []Attr{{Name{"xmlns", "s"}, "space"}}}, "<s:local xmlns:s=\"space\">", true},
+	{StartElement{Name{"", "local"}, []Attr{{Name{"xmlns", "s"}, "space"}, {Name{"space", "a"}, "b"}}}, "<local xmlns:s=\"space\" s:a=\"b\">", true},
 	{StartElement{Name{"space", ""}, nil}, "", false},
 	{EndElement{Name{"space", ""}}, "", false},
 	{CharData("foo"), "foo", true},
@@ -1264,3 +1267,192 @@ func TestDecodeEncode(t *testing.T) {
 		}
 	}
 }
+
+const (
+	soapNS  = "http://schemas.xmlsoap.org/soap/envelope/"
+	stockNS = "urn:example:stock"
+)
+
+type SOAPEnvelope struct {
+	XMLName Name     `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    SOAPBody `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+type SOAPBody struct {
+	EncodingStyle string    `xml:"http://schemas.xmlsoap.org/soap/envelope/ encodingStyle,attr"`
+	GetPrice      *GetPrice `xml:"urn:example:stock GetPrice"`
+}
+
+type GetPrice struct {
+	Item  string `xml:"urn:example:stock Item"`
+	Other string `xml:"Other,omitempty"`
+}
+
+// tokenNames returns the names of the elements and attributes in the XML
+// document data, as the Decoder reports them.
+func tokenNames(t *testing.T, data []byte) []Name {
+	var names []Name
+	dec := NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("decoding %s: %v", data, err)
+		}
+		if start, ok := tok.(StartElement); ok {
+			names = append(names, start.Name)
+			for _, attr := range start.Attr {
+				if attr.Name.Space != "xmlns" && attr.Name != (Name{"", "xmlns"}) {
+					names = append(names, attr.Name)
+				}
+			}
+		}
+	}
+}
+
+func TestBindPrefix(t *testing.T) {
+	in := &SOAPEnvelope{
+		XMLName: Name{soapNS, "Envelope"},
+		Body: SOAPBody{
+			EncodingStyle: "http://www.w3.org/2001/12/soap-encoding",
+			GetPrice:      &GetPrice{Item: "IBM"},
+		},
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.BindPrefix("soap", soapNS); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.BindPrefix("m", stockNS); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	const want = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:m="urn:example:stock">` +
+		`<soap:Body soap:encodingStyle="http://www.w3.org/2001/12/soap-encoding">` +
+		`<m:GetPrice><m:Item>IBM</m:Item></m:GetPrice>` +
+		`</soap:Body></soap:Envelope>`
+	if got := buf.String(); got != want {
+		t.Errorf("Encode:\nhave %s\nwant %s", got, want)
+	}
+
+	wantNames := []Name{
+		{soapNS, "Envelope"},
+		{soapNS, "Body"},
+		{soapNS, "encodingStyle"},
+		{stockNS, "GetPrice"},
+		{stockNS, "Item"},
+	}
+	if names := tokenNames(t, buf.Bytes()); !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("decoded names:\nhave %v\nwant %v", names, wantNames)
+	}
+
+	out := new(SOAPEnvelope)
+	if err := Unmarshal(buf.Bytes(), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal:\nhave %+v\nwant %+v", out, in)
+	}
+
+	// The bindings were used up by the first element.
+	buf.Reset()
+	if err := enc.Encode(in.Body.GetPrice); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), `<GetPrice><Item xmlns="urn:example:stock">IBM</Item></GetPrice>`; got != want {
+		t.Errorf("second Encode:\nhave %s\nwant %s", got, want)
+	}
+}
+
+func TestBindPrefixScope(t *testing.T) {
+	type binding struct{ prefix, url string }
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, tok := range []interface{}{
+		binding{"p", "urn:1"},
+		StartElement{Name: Name{"urn:1", "a"}},
+		binding{"p", "urn:2"},
+		StartElement{Name: Name{"urn:2", "b"}},
+		StartElement{Name: Name{"urn:1", "c"}, Attr: []Attr{{Name{"urn:2", "x"}, "1"}}},
+		EndElement{Name{"urn:1", "c"}},
+		EndElement{Name{"urn:2", "b"}},
+		StartElement{Name: Name{"urn:1", "d"}, Attr: []Attr{{Name{"urn:2", "x"}, "2"}}},
+		EndElement{Name{"urn:1", "d"}},
+		EndElement{Name{"urn:1", "a"}},
+	} {
+		var err error
+		if b, ok := tok.(binding); ok {
+			err = enc.BindPrefix(b.prefix, b.url)
+		} else {
+			err = enc.EncodeToken(tok)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	const want = `<p:a xmlns:p="urn:1"><p:b xmlns:p="urn:2"><c xmlns="urn:1" p:x="1"></c></p:b>` +
+		`<p:d xmlns:_="urn:2" _:x="2"></p:d></p:a>`
+	if got := buf.String(); got != want {
+		t.Errorf("have %s\nwant %s", got, want)
+	}
+	wantNames := []Name{
+		{"urn:1", "a"},
+		{"urn:2", "b"},
+		{"urn:1", "c"},
+		{"urn:2", "x"},
+		{"urn:1", "d"},
+		{"urn:2", "x"},
+	}
+	if names := tokenNames(t, buf.Bytes()); !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("decoded names:\nhave %v\nwant %v", names, wantNames)
+	}
+}
+
+func TestBindPrefixError(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer))
+	for _, b := range []struct{ prefix, url string }{
+		{"", "urn:x"},
+		{"a:b", "urn:x"},
+		{"1a", "urn:x"},
+		{"xmlfoo", "urn:x"},
+		{"XMLfoo", "urn:x"},
+		{"a", ""},
+		{"a", "http://www.w3.org/XML/1998/namespace"},
+	} {
+		if err := enc.BindPrefix(b.prefix, b.url); err == nil {
+			t.Errorf("BindPrefix(%q, %q) succeeded, want error", b.prefix, b.url)
+		}
+	}
+}
+
+func TestDecodeEncodePrefixes(t *testing.T) {
+	const in = `<a:root xmlns:a="urn:a" xmlns:b="urn:b"><b:child a:attr="1" plain="2"><b:x></b:x>text</b:child></a:root>`
+	var out bytes.Buffer
+	dec := NewDecoder(strings.NewReader(in))
+	enc := NewEncoder(&out)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.EncodeToken(tok); err != nil {
+			t.Fatalf("EncodeToken(%#v): %v", tok, err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != in {
+		t.Errorf("have %s\nwant %s", got, in)
+	}
+}
@@ -202,6 +202,7 @@ var pkgDeps = map[string][]string{
 	"encoding/gob":        {"L4", "OS", "encoding"},
 	"encoding/hex":        {"L4"},
 	"encoding/json":       {"L4", "encoding"},
+	"encoding/jsonpatch":  {"L4", "encoding/json", "math/big"},
 	"encoding/pem":        {"L4"},
 	"encoding/xml":        {"L4", "encoding"},
 	"flag":                {"L4", "OS"},
@@ -256,17 +257,23 @@ var pkgDeps = map[string][]string{
 	"net/textproto": {"L4", "OS", "net"},
 
 	// Core crypto.
-	"crypto/aes":    {"L3"},
-	"crypto/des":    {"L3"},
-	"crypto/hmac":   {"L3"},
-	"crypto/md5":    {"L3"},
-	"crypto/rc4":    {"L3"},
-	"crypto/sha1":   {"L3"},
-	"crypto/sha256": {"L3"},
-	"crypto/sha512": {"L3"},
+	"crypto/aes":              {"L3"},
+	"crypto/chacha20poly1305": {"L3"},
+	"crypto/curve25519":       {"L3", "crypto/internal/edwards25519"},
+	"crypto/des":              {"L3"},
+	"crypto/hmac":             {"L3"},
+	"crypto/md5":              {"L3"},
+	"crypto/rc4":              {"L3"},
+	"crypto/sha1":             {"L3"},
+	"crypto/sha256":           {"L3"},
+	"crypto/sha512":           {"L3"},
+
+	"crypto/internal/edwards25519": {"L3"},
 
 	"CRYPTO": {
 		"crypto/aes",
+		"crypto/chacha20poly1305",
+		"crypto/curve25519",
 		"crypto/des",
 		"crypto/hmac",
 		"crypto/md5",
@@ -285,6 +292,7 @@ var pkgDeps = map[string][]string{
 	// We could avoid some of the fmt, but math/big imports fmt anyway.
 	"crypto/dsa":      {"L4", "CRYPTO", "math/big"},
 	"crypto/ecdsa":    {"L4", "CRYPTO", "crypto/elliptic", "math/big", "encoding/asn1"},
+	"crypto/ed25519":  {"L4", "CRYPTO", "crypto/internal/edwards25519", "crypto/rand"},
 	"crypto/elliptic": {"L4", "CRYPTO", "math/big"},
 	"crypto/rsa":      {"L4", "CRYPTO", "crypto/rand", "math/big"},
 
@@ -292,6 +300,7 @@ var pkgDeps = map[string][]string{
 		"CRYPTO",
 		"crypto/dsa",
 		"crypto/ecdsa",
+		"crypto/ed25519",
 		"crypto/elliptic",
 		"crypto/rand",
 		"crypto/rsa",
@@ -304,9 +313,15 @@ var pkgDeps = map[string][]string{
 		"L4", "CRYPTO-MATH", "CGO", "OS",
 		"container/list", "crypto/x509", "encoding/pem", "net", "syscall",
 	},
+	"crypto/ocsp": {
+		"L4", "CRYPTO-MATH", "crypto/x509", "crypto/x509/pkix",
+	},
+	"crypto/pkcs12": {
+		"L4", "CRYPTO-MATH", "crypto/x509", "crypto/x509/pkix",
+	},
 	"crypto/x509": {
 		"L4", "CRYPTO-MATH", "OS", "CGO",
-		"crypto/x509/pkix", "encoding/pem", "encoding/hex", "net", "syscall",
+		"crypto/x509/pkix", "encoding/pem", "encoding/hex", "net", "net/url", "syscall",
 	},
 	"crypto/x509/pkix": {"L4", "CRYPTO-MATH"},
 
@@ -314,11 +329,14 @@ var pkgDeps = map[string][]string{
 	"mime/multipart": {"L4", "OS", "mime", "crypto/rand", "net/textproto"},
 	"net/smtp":       {"L4", "CRYPTO", "NET", "crypto/tls"},
 
+	// HTTP/2 header compression.
+	"net/http/internal/hpack": {"L4"},
+
 	// HTTP, kingpin of dependencies.
 	"net/http": {
 		"L4", "NET", "OS",
-		"compress/gzip", "crypto/tls", "mime/multipart", "runtime/debug",
-		"net/http/internal",
+		"compress/gzip", "compress/zlib", "crypto/tls", "mime/multipart", "runtime/debug",
+		"net/http/internal", "net/http/internal/hpack",
 	},
 
 	// HTTP-using packages.
@@ -50,6 +50,12 @@ type Dialer struct {
 	// If zero, keep-alives are not enabled. Network protocols
 	// that do not support keep-alives ignore this field.
 	KeepAlive time.Duration
+
+	// Cancel is an optional channel whose closure indicates that
+	// the dial should be canceled. A canceled dial returns an
+	// error immediately; a connection that is established after
+	// the cancellation is closed.
+	Cancel <-chan struct{}
 }
 
 // Return either now+Timeout or Deadline, whichever comes first.
@@ -155,6 +161,39 @@ func DialTimeout(network, address string, timeout time.Duration) (Conn, error) {
 // See func Dial for a description of the network and address
 // parameters.
 func (d *Dialer) Dial(network, address string) (Conn, error) {
+	if d.Cancel == nil {
+		return d.dial(network, address)
+	}
+	select {
+	case <-d.Cancel:
+		return nil, &OpError{Op: "dial", Net: network, Addr: nil, Err: errCanceled}
+	default:
+	}
+	type racer struct {
+		Conn
+		error
+	}
+	ch := make(chan racer, 1)
+	go func() {
+		c, err := d.dial(network, address)
+		ch <- racer{c, err}
+	}()
+	select {
+	case <-d.Cancel:
+		go func() {
+			// Release the connection once the abandoned
+			// dial finishes.
+			if racer := <-ch; racer.error == nil {
+				racer.Conn.Close()
+			}
+		}()
+		return nil, &OpError{Op: "dial", Net: network, Addr: nil, Err: errCanceled}
+	case racer := <-ch:
+		return racer.Conn, racer.error
+	}
+}
+
+func (d *Dialer) dial(network, address string) (Conn, error) {
 	ra, err := resolveAddr("dial", network, address, d.deadline())
 	if err != nil {
 		return nil, &OpError{Op: "dial", Net: network, Addr: nil, Err: err}
@@ -546,3 +546,33 @@ func TestDialerKeepAlive(t *testing.T) {
 		}
 	}
 }
+
+func TestDialerCancel(t *testing.T) {
+	cancel := make(chan struct{})
+	close(cancel)
+	d := &Dialer{Cancel: cancel}
+	if c, err := d.Dial("tcp", "127.0.0.1:0"); err == nil {
+		c.Close()
+		t.Fatal("Dial succeeded; want cancellation error")
+	} else if oe, ok := err.(*OpError); !ok || oe.Err != errCanceled {
+		t.Fatalf("Dial error = %v; want %v", err, errCanceled)
+	}
+
+	ln := newLocalListener(t)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	d = &Dialer{Cancel: make(chan struct{})}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial with open Cancel channel failed: %v", err)
+	}
+	c.Close()
+}
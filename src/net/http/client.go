@@ -168,6 +168,9 @@ func (c *Client) send(req *Request) (*Response, error) {
 // The request Body, if non-nil, will be closed by the underlying
 // Transport, even on errors.
 //
+// The request's Cancel and Deadline fields also apply to any
+// redirects that are followed.
+//
 // Generally Get, Post, or PostForm will be used instead of Do.
 func (c *Client) Do(req *Request) (resp *Response, err error) {
 	if req.Method == "GET" || req.Method == "HEAD" {
@@ -341,6 +344,8 @@ func (c *Client) doFollowingRedirects(ireq *Request, shouldRedirect func(int) bo
 				nreq.Method = "GET"
 			}
 			nreq.Header = make(Header)
+			nreq.Cancel = ireq.Cancel
+			nreq.Deadline = ireq.Deadline
 			nreq.URL, err = base.Parse(urlStr)
 			if err != nil {
 				break
@@ -0,0 +1,167 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+)
+
+// ClientTrace is a set of hooks to run at various stages of an
+// outgoing HTTP request made by a Transport. Any particular hook may
+// be nil. Functions may be called concurrently from different
+// goroutines and some may be called after the request has completed
+// or failed.
+//
+// A ClientTrace is attached to a request through its Trace field.
+type ClientTrace struct {
+	// GetConn is called before a connection is created or
+	// retrieved from the idle pool. The hostPort is the
+	// "host:port" of the target or proxy.
+	GetConn func(hostPort string)
+
+	// GotConn is called after a successful connection is
+	// obtained. There is no hook for failure to obtain a
+	// connection; instead, use the error from RoundTrip.
+	GotConn func(GotConnInfo)
+
+	// GotFirstResponseByte is called when the first byte of the
+	// response headers is available.
+	GotFirstResponseByte func()
+
+	// DNSStart is called when a DNS lookup begins.
+	DNSStart func(DNSStartInfo)
+
+	// DNSDone is called when a DNS lookup ends.
+	DNSDone func(DNSDoneInfo)
+
+	// ConnectStart is called when a new connection's dial begins.
+	// The addr is the resolved address being dialed.
+	ConnectStart func(network, addr string)
+
+	// ConnectDone is called when a new connection's dial
+	// completes. The provided err indicates whether the
+	// connection completed successfully.
+	ConnectDone func(network, addr string, err error)
+
+	// TLSHandshakeStart is called when the TLS handshake is
+	// started. It's not called when DialTLS is used.
+	TLSHandshakeStart func()
+
+	// TLSHandshakeDone is called after the TLS handshake with
+	// either the successful handshake's connection state, or a
+	// non-nil error on handshake failure.
+	TLSHandshakeDone func(tls.ConnectionState, error)
+
+	// WroteHeaders is called after the Transport has written the
+	// request headers.
+	WroteHeaders func()
+
+	// WroteRequest is called with the result of writing the
+	// request and any body.
+	WroteRequest func(WroteRequestInfo)
+}
+
+// DNSStartInfo is passed to ClientTrace.DNSStart.
+type DNSStartInfo struct {
+	Host string
+}
+
+// DNSDoneInfo is passed to ClientTrace.DNSDone.
+type DNSDoneInfo struct {
+	// Addrs holds the IP address that will be dialed, chosen
+	// from those found in the DNS lookup as net.Dial would.
+	Addrs []net.IP
+
+	// Err is any error that occurred during the DNS lookup.
+	Err error
+}
+
+// GotConnInfo is the argument to ClientTrace.GotConn and contains
+// information about the obtained connection.
+type GotConnInfo struct {
+	// Conn is the connection that was obtained. It is owned by
+	// the Transport and should not be read, written or closed by
+	// users of ClientTrace.
+	Conn net.Conn
+
+	// Reused is whether this connection has been previously
+	// used for another HTTP request.
+	Reused bool
+
+	// WasIdle is whether this connection was obtained from an
+	// idle pool.
+	WasIdle bool
+
+	// IdleTime reports how long the connection was previously
+	// idle, if WasIdle is true.
+	IdleTime time.Duration
+}
+
+// WroteRequestInfo contains information provided to the WroteRequest
+// hook.
+type WroteRequestInfo struct {
+	// Err is any error encountered while writing the Request.
+	Err error
+}
+
+// traceDial dials addr like Transport.dial does without a trace:
+// it resolves addr as net.Dial would and dials the one address
+// chosen with the same Dialer, reporting both steps to trace.
+func traceDial(trace *ClientTrace, network, addr string, cancel <-chan struct{}) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err == nil && net.ParseIP(host) == nil && !strings.Contains(host, "%") {
+		ta, err := traceResolve(trace, network, host, addr, cancel)
+		if err != nil {
+			return nil, err
+		}
+		addr = ta.String()
+	}
+	if trace.ConnectStart != nil {
+		trace.ConnectStart(network, addr)
+	}
+	d := net.Dialer{Cancel: cancel}
+	c, err := d.Dial(network, addr)
+	if trace.ConnectDone != nil {
+		trace.ConnectDone(network, addr, err)
+	}
+	return c, err
+}
+
+// traceResolve resolves addr, whose host part is host, reporting the
+// lookup to trace.
+func traceResolve(trace *ClientTrace, network, host, addr string, cancel <-chan struct{}) (*net.TCPAddr, error) {
+	if trace.DNSStart != nil {
+		trace.DNSStart(DNSStartInfo{Host: host})
+	}
+	type result struct {
+		addr *net.TCPAddr
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		ta, err := net.ResolveTCPAddr(network, addr)
+		if err != nil {
+			err = &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		ch <- result{ta, err}
+	}()
+	var r result
+	select {
+	case r = <-ch:
+	case <-cancel:
+		r.err = errRequestCanceled
+	}
+	if trace.DNSDone != nil {
+		var addrs []net.IP
+		if r.err == nil {
+			addrs = []net.IP{r.addr.IP}
+		}
+		trace.DNSDone(DNSDoneInfo{Addrs: addrs, Err: r.err})
+	}
+	return r.addr, r.err
+}
@@ -0,0 +1,323 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Response compression.
+
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compressMinSize is the smallest response body CompressHandler
+// compresses. Smaller bodies gain little and may even grow.
+const compressMinSize = 1024
+
+// CompressHandler returns a Handler that runs h, compressing its
+// responses with gzip or deflate when the request's Accept-Encoding
+// header allows it.
+//
+// Responses aren't compressed if they're shorter than 1 KB, if their
+// status code doesn't allow a body or is 206 Partial Content, if h
+// set a Content-Encoding itself, or if their Content-Type is a
+// compressed format, such as most images, audio and video. Responses
+// to HEAD requests are never compressed.
+//
+// When a response is compressed, its Content-Type is sniffed, if h
+// didn't set one, before compression, and its Content-Length and
+// Accept-Ranges headers are removed. Every response gets a
+// "Vary: Accept-Encoding" header.
+//
+// The ResponseWriter passed to h implements Flusher, Hijacker,
+// CloseNotifier, Pusher and DeadlineSetter. Flushing sends the header
+// and whatever has been compressed so far. The other methods return
+// ErrNotSupported if the underlying ResponseWriter doesn't support
+// them.
+func CompressHandler(h Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		cw := &compressWriter{w: w, code: StatusOK}
+		if r.Method != "HEAD" {
+			cw.encoding = negotiateEncoding(r.Header["Accept-Encoding"])
+		}
+		h.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
+
+// negotiateEncoding returns the content coding to use for a request
+// with the given Accept-Encoding header values: "gzip", "deflate" or
+// "" for none. Ties go to gzip.
+func negotiateEncoding(accept []string) string {
+	q := map[string]float64{}
+	for _, v := range accept {
+		for _, part := range strings.Split(v, ",") {
+			coding, qval := part, 1.0
+			if i := strings.Index(part, ";"); i >= 0 {
+				coding = part[:i]
+				qval = parseQValue(part[i+1:])
+			}
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "x-gzip" {
+				coding = "gzip"
+			}
+			if coding != "" {
+				q[coding] = qval
+			}
+		}
+	}
+	pick := func(coding string) float64 {
+		if v, ok := q[coding]; ok {
+			return v
+		}
+		return q["*"]
+	}
+	gz, fl := pick("gzip"), pick("deflate")
+	switch {
+	case gz > 0 && gz >= fl:
+		return "gzip"
+	case fl > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// parseQValue returns the q parameter of the Accept-Encoding
+// parameters params, or 1 if there isn't one. Malformed q values
+// count as 0.
+func parseQValue(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		p = strings.TrimSpace(p)
+		if len(p) < 2 || (p[0] != 'q' && p[0] != 'Q') || p[1] != '=' {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(p[2:]), 64)
+		if err != nil || v < 0 || v > 1 {
+			return 0
+		}
+		return v
+	}
+	return 1
+}
+
+// incompressibleType reports whether the media type of contentType
+// is already compressed.
+func incompressibleType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = ct[:i]
+	}
+	ct = strings.TrimSpace(ct)
+	switch {
+	case strings.HasPrefix(ct, "image/"):
+		return ct != "image/svg+xml" && ct != "image/bmp" && ct != "image/x-icon"
+	case strings.HasPrefix(ct, "audio/"), strings.HasPrefix(ct, "video/"):
+		return true
+	}
+	switch ct {
+	case "application/zip", "application/gzip", "application/x-gzip",
+		"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/x-compress",
+		"application/pdf", "application/font-woff":
+		return true
+	}
+	return false
+}
+
+// compressWriter is the ResponseWriter of a CompressHandler. It
+// holds back the header and the start of the body until it has seen
+// enough to decide whether to compress.
+type compressWriter struct {
+	w        ResponseWriter
+	encoding string // negotiated coding, or "" to never compress
+
+	code        int
+	wroteHeader bool   // the handler called WriteHeader or Write
+	buf         []byte // body held back until decided
+	decided     bool   // the header has been sent to w
+	hijacked    bool
+	zw          io.WriteCloser // compressor; non-nil if compressing
+}
+
+func (cw *compressWriter) Header() Header {
+	return cw.w.Header()
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.code = code
+	h := cw.w.Header()
+	if cw.encoding == "" || code == StatusPartialContent || !bodyAllowedForStatus(code) || h.Get("Content-Encoding") != "" {
+		cw.decide(false)
+		return
+	}
+	if cl, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && cl < compressMinSize {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(StatusOK)
+	}
+	if cw.decided {
+		if cw.zw != nil {
+			return cw.zw.Write(p)
+		}
+		return cw.w.Write(p)
+	}
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= compressMinSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide sends the header to the underlying ResponseWriter,
+// followed by any held back body. The body is compressed if large is
+// set, meaning it's long enough or being flushed, an encoding was
+// negotiated and the response allows it.
+func (cw *compressWriter) decide(large bool) error {
+	if cw.decided {
+		return nil
+	}
+	cw.decided = true
+	h := cw.w.Header()
+	addVary(h, "Accept-Encoding")
+	compress := large && cw.encoding != "" && cw.code != StatusPartialContent &&
+		bodyAllowedForStatus(cw.code) && h.Get("Content-Encoding") == ""
+	if compress {
+		if _, haveType := h["Content-Type"]; !haveType {
+			// Sniff now, as the Server would only see
+			// compressed bytes.
+			h.Set("Content-Type", DetectContentType(cw.buf))
+		}
+		compress = !incompressibleType(h.Get("Content-Type"))
+	}
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+	}
+	cw.w.WriteHeader(cw.code)
+	buf := cw.buf
+	cw.buf = nil
+	if !compress {
+		if len(buf) == 0 {
+			return nil
+		}
+		_, err := cw.w.Write(buf)
+		return err
+	}
+	if cw.encoding == "gzip" {
+		cw.zw = gzip.NewWriter(cw.w)
+	} else {
+		cw.zw = zlib.NewWriter(cw.w)
+	}
+	_, err := cw.zw.Write(buf)
+	return err
+}
+
+// addVary adds field to the Vary header of h, unless it's already
+// listed.
+func addVary(h Header, field string) {
+	for _, v := range h["Vary"] {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		if cw.wroteHeader {
+			cw.decide(false)
+		} else {
+			// The handler wrote nothing; the Server sends the
+			// header on its own, and it still needs Vary.
+			addVary(cw.w.Header(), "Accept-Encoding")
+		}
+	}
+	if cw.zw != nil {
+		cw.zw.Close()
+	}
+}
+
+// Flush sends the header, if it hasn't been yet, deciding to
+// compress without waiting for the body to reach the minimum size,
+// then flushes the compressor and the underlying ResponseWriter.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(StatusOK)
+	}
+	cw.decide(true)
+	if zw, ok := cw.zw.(interface {
+		Flush() error
+	}); ok {
+		zw.Flush()
+	}
+	if f, ok := cw.w.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.w.(Hijacker)
+	if !ok {
+		return nil, nil, ErrNotSupported
+	}
+	c, rw, err := hj.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return c, rw, err
+}
+
+func (cw *compressWriter) CloseNotify() <-chan bool {
+	if cn, ok := cw.w.(CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	// Never fires.
+	return make(chan bool)
+}
+
+func (cw *compressWriter) Push(target string, opts *PushOptions) error {
+	if p, ok := cw.w.(Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return ErrNotSupported
+}
+
+func (cw *compressWriter) SetReadDeadline(t time.Time) error {
+	if ds, ok := cw.w.(DeadlineSetter); ok {
+		return ds.SetReadDeadline(t)
+	}
+	return ErrNotSupported
+}
+
+func (cw *compressWriter) SetWriteDeadline(t time.Time) error {
+	if ds, ok := cw.w.(DeadlineSetter); ok {
+		return ds.SetWriteDeadline(t)
+	}
+	return ErrNotSupported
+}
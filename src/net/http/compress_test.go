@@ -0,0 +1,233 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"GZIP; Q=0.8", "gzip"},
+		{"br, identity", ""},
+		{"*", "gzip"},
+		{"*;q=0.1, gzip;q=0", "deflate"},
+		{"gzip;q=nonsense", ""},
+	}
+	for _, tt := range tests {
+		var h []string
+		if tt.accept != "" {
+			h = []string{tt.accept}
+		}
+		if got := ExportNegotiateEncoding(h); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q; want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+var compressBody = strings.Repeat("all work and no play makes jack a dull boy\n", 100)
+
+func TestCompressHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		accept      string
+		contentType string
+		encoding    string // set by the handler
+		body        string
+		wantEnc     string
+	}{
+		{"gzip", "GET", "gzip, deflate", "", "", compressBody, "gzip"},
+		{"deflate", "GET", "deflate, gzip;q=0.5", "text/css", "", compressBody, "deflate"},
+		{"not accepted", "GET", "", "", "", compressBody, ""},
+		{"small", "GET", "gzip", "", "", "tiny", ""},
+		{"image", "GET", "gzip", "image/png", "", compressBody, ""},
+		{"svg", "GET", "gzip", "image/svg+xml", "", compressBody, "gzip"},
+		{"HEAD", "HEAD", "gzip", "", "", compressBody, ""},
+		{"precompressed", "GET", "gzip", "", "br", compressBody, "br"},
+	}
+	for _, tt := range tests {
+		h := CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+			if tt.contentType != "" {
+				w.Header().Set("Content-Type", tt.contentType)
+			}
+			if tt.encoding != "" {
+				w.Header().Set("Content-Encoding", tt.encoding)
+			}
+			w.Header().Set("Accept-Ranges", "bytes")
+			// Write in pieces straddling the size threshold.
+			for i := 0; i < len(tt.body); i += 300 {
+				end := i + 300
+				if end > len(tt.body) {
+					end = len(tt.body)
+				}
+				io.WriteString(w, tt.body[i:end])
+			}
+		}))
+		req, _ := NewRequest(tt.method, "http://example.com/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept-Encoding", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.HeaderMap.Get("Content-Encoding"); got != tt.wantEnc {
+			t.Errorf("%s: Content-Encoding = %q; want %q", tt.name, got, tt.wantEnc)
+			continue
+		}
+		if got := rec.HeaderMap.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q", tt.name, got)
+		}
+		var r io.Reader = rec.Body
+		switch tt.wantEnc {
+		case "gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			r = zr
+		case "deflate":
+			zr, err := zlib.NewReader(r)
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			r = zr
+		}
+		if b, err := ioutil.ReadAll(r); err != nil || string(b) != tt.body {
+			t.Errorf("%s: decoded %d bytes, %v; want the %d bytes written", tt.name, len(b), err, len(tt.body))
+		}
+		if tt.wantEnc == "gzip" || tt.wantEnc == "deflate" {
+			if got := rec.HeaderMap.Get("Accept-Ranges"); got != "" {
+				t.Errorf("%s: Accept-Ranges = %q on a compressed response", tt.name, got)
+			}
+			if tt.contentType == "" && rec.HeaderMap.Get("Content-Type") != "text/plain; charset=utf-8" {
+				t.Errorf("%s: Content-Type = %q; want it sniffed from the uncompressed body", tt.name, rec.HeaderMap.Get("Content-Type"))
+			}
+		}
+	}
+}
+
+func TestCompressHandlerStatus(t *testing.T) {
+	for _, code := range []int{StatusNoContent, StatusNotModified, StatusPartialContent} {
+		h := CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.WriteHeader(code)
+			if code == StatusPartialContent {
+				io.WriteString(w, compressBody)
+			}
+		}))
+		req, _ := NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != code || rec.HeaderMap.Get("Content-Encoding") != "" {
+			t.Errorf("status %d: got %d, Content-Encoding %q", code, rec.Code, rec.HeaderMap.Get("Content-Encoding"))
+		}
+	}
+}
+
+// A handler that writes nothing still gets Vary.
+func TestCompressHandlerEmpty(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("X-Empty", "yes")
+	})))
+	defer ts.Close()
+
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != StatusOK || res.Header.Get("X-Empty") != "yes" {
+		t.Errorf("got status %d, X-Empty %q", res.StatusCode, res.Header.Get("X-Empty"))
+	}
+	if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q; want Accept-Encoding", got)
+	}
+	if got := res.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q on an empty response", got)
+	}
+}
+
+// A flushed response is compressed as it's streamed, and the
+// Transport decodes it.
+func TestCompressHandlerFlush(t *testing.T) {
+	defer afterTest(t)
+	step := make(chan bool)
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "first\n")
+		w.(Flusher).Flush()
+		<-step
+		io.WriteString(w, "second\n")
+	})))
+	defer ts.Close()
+
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	br := bufio.NewReader(res.Body)
+	if line, err := br.ReadString('\n'); err != nil || line != "first\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	close(step)
+	if rest, err := ioutil.ReadAll(br); err != nil || string(rest) != "second\n" {
+		t.Errorf("rest = %q, %v", rest, err)
+	}
+}
+
+func TestCompressHandlerInterfaces(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if _, ok := w.(CloseNotifier); !ok {
+			t.Error("ResponseWriter isn't a CloseNotifier")
+		}
+		if err := w.(Pusher).Push("/x", nil); err != ErrNotSupported {
+			t.Errorf("Push over HTTP/1 = %v; want ErrNotSupported", err)
+		}
+		conn, brw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		brw.Flush()
+	})))
+	defer ts.Close()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != "hijacked" {
+		t.Errorf("body = %q", b)
+	}
+}
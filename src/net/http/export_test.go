@@ -19,6 +19,10 @@ func NewLoggingConn(baseName string, c net.Conn) net.Conn {
 
 var ExportAppendTime = appendTime
 
+var ExportNegotiateEncoding = negotiateEncoding
+
+const ExportShutdownPollInterval = shutdownPollInterval
+
 func (t *Transport) NumPendingRequestsForTesting() int {
 	t.reqMu.Lock()
 	defer t.reqMu.Unlock()
@@ -82,13 +86,14 @@ func NewTestTimeoutHandler(handler Handler, ch <-chan time.Time) Handler {
 	f := func() <-chan time.Time {
 		return ch
 	}
-	return &timeoutHandler{handler, f, ""}
+	return &timeoutHandler{handler: handler, timeout: f}
 }
 
 func ResetCachedEnvironment() {
 	httpProxyEnv.reset()
 	httpsProxyEnv.reset()
 	noProxyEnv.reset()
+	godebugEnv.reset()
 }
 
 var DefaultUserAgent = defaultUserAgent
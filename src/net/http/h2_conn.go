@@ -0,0 +1,319 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http/internal/hpack"
+	"sync"
+)
+
+var errH2StreamClosed = errors.New("http2: stream closed")
+
+// h2Conn is the state shared by the client and server ends of an
+// HTTP/2 connection: writing frames and the flow control of what we
+// send and receive.
+//
+// One goroutine reads and processes frames; the goroutines serving
+// individual streams write their frames directly, serialized by wmu.
+// When both locks are needed, wmu is acquired before mu.
+type h2Conn struct {
+	nc net.Conn
+	fr *h2Framer
+
+	wmu    sync.Mutex // serializes frame writes; guards enc and encBuf
+	enc    *hpack.Encoder
+	encBuf bytes.Buffer
+
+	mu                sync.Mutex // guards the following and the h2Streams of the conn
+	cond              sync.Cond  // broadcast when send windows grow or streams close
+	sendWindow        int64      // connection send window
+	initialSendWindow int64      // peer's SETTINGS_INITIAL_WINDOW_SIZE
+	maxFrameSize      uint32     // peer's SETTINGS_MAX_FRAME_SIZE
+	recvWindow        int64      // remaining connection receive window
+	closed            bool
+
+	// streamList returns the open streams. It's called with mu
+	// held.
+	streamList func() []*h2Stream
+}
+
+func (c *h2Conn) init(nc net.Conn, r io.Reader, streamList func() []*h2Stream) {
+	c.nc = nc
+	c.fr = newH2Framer(nc, r)
+	c.enc = hpack.NewEncoder(&c.encBuf)
+	c.cond.L = &c.mu
+	c.sendWindow = h2InitialWindowSize
+	c.initialSendWindow = h2InitialWindowSize
+	c.maxFrameSize = h2DefaultMaxFrameSize
+	c.recvWindow = h2ConnRecvWindow
+	c.streamList = streamList
+}
+
+// h2Stream is the protocol state of a stream shared by clients and
+// servers. Its fields are guarded by the h2Conn's mu.
+type h2Stream struct {
+	id           uint32
+	sendWindow   int64
+	recvWindow   int64
+	remoteClosed bool // END_STREAM received
+	localClosed  bool // END_STREAM or RST_STREAM sent
+	reset        bool // RST_STREAM sent or received, or the conn died
+}
+
+// applySetting applies a setting received from the peer, if it's
+// one that affects framing or flow control.
+func (c *h2Conn) applySetting(s h2Setting) error {
+	switch s.ID {
+	case h2SettingHeaderTableSize:
+		c.wmu.Lock()
+		c.enc.SetMaxDynamicTableSizeLimit(s.Val)
+		c.wmu.Unlock()
+	case h2SettingInitialWindowSize:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delta := int64(s.Val) - c.initialSendWindow
+		c.initialSendWindow = int64(s.Val)
+		for _, st := range c.streamList() {
+			st.sendWindow += delta
+			if st.sendWindow > h2MaxWindowSize {
+				return h2ConnError{h2ErrCodeFlowControl, "stream window too large"}
+			}
+		}
+		c.cond.Broadcast()
+	case h2SettingMaxFrameSize:
+		c.wmu.Lock()
+		c.fr.maxWriteSize = s.Val
+		c.wmu.Unlock()
+		c.mu.Lock()
+		c.maxFrameSize = s.Val
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// processWindowUpdate applies a WINDOW_UPDATE frame to the
+// connection or to st, which is nil if the stream is gone.
+func (c *h2Conn) processWindowUpdate(f *h2Frame, st *h2Stream) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f.StreamID == 0 {
+		c.sendWindow += int64(f.Increment)
+		if c.sendWindow > h2MaxWindowSize {
+			return h2ConnError{h2ErrCodeFlowControl, "connection window too large"}
+		}
+	} else if st != nil {
+		st.sendWindow += int64(f.Increment)
+		if st.sendWindow > h2MaxWindowSize {
+			return h2StreamError{f.StreamID, h2ErrCodeFlowControl}
+		}
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+// takeRecvData accounts for a DATA frame of length n received on st
+// against our receive windows.
+func (c *h2Conn) takeRecvData(st *h2Stream, n uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if int64(n) > c.recvWindow || int64(n) > st.recvWindow {
+		return h2ConnError{h2ErrCodeFlowControl, "flow control window exceeded"}
+	}
+	c.recvWindow -= int64(n)
+	st.recvWindow -= int64(n)
+	return nil
+}
+
+// returnCredit tells the peer that n more bytes may be sent on the
+// connection and, if st is non-nil and still receiving, on st.
+func (c *h2Conn) returnCredit(st *h2Stream, n int) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	c.recvWindow += int64(n)
+	streamOpen := st != nil && !st.remoteClosed && !st.reset
+	if streamOpen {
+		st.recvWindow += int64(n)
+	}
+	c.mu.Unlock()
+	c.fr.WriteWindowUpdate(0, uint32(n))
+	if streamOpen {
+		c.fr.WriteWindowUpdate(st.id, uint32(n))
+	}
+}
+
+// writeHeaders encodes fields and writes them as st's header block.
+func (c *h2Conn) writeHeaders(st *h2Stream, endStream bool, fields []hpack.HeaderField) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	if st.reset || c.closed {
+		c.mu.Unlock()
+		return errH2StreamClosed
+	}
+	if endStream {
+		st.localClosed = true
+	}
+	c.mu.Unlock()
+	return c.fr.WriteHeaders(st.id, endStream, c.encodeHeaders(fields))
+}
+
+// encodeHeaders returns the header block for fields. c.wmu must be
+// held, and the block used before it's released.
+func (c *h2Conn) encodeHeaders(fields []hpack.HeaderField) []byte {
+	c.encBuf.Reset()
+	for _, f := range fields {
+		c.enc.WriteField(f)
+	}
+	return c.encBuf.Bytes()
+}
+
+// writeData writes p to st as DATA frames, waiting for the peer to
+// open the flow control windows as needed.
+func (c *h2Conn) writeData(st *h2Stream, p []byte, endStream bool) error {
+	for {
+		c.mu.Lock()
+		for len(p) > 0 && !st.reset && !c.closed && (st.sendWindow <= 0 || c.sendWindow <= 0) {
+			c.cond.Wait()
+		}
+		if st.reset || c.closed {
+			c.mu.Unlock()
+			return errH2StreamClosed
+		}
+		n := int64(len(p))
+		for _, max := range []int64{st.sendWindow, c.sendWindow, int64(c.maxFrameSize)} {
+			if n > max {
+				n = max
+			}
+		}
+		st.sendWindow -= n
+		c.sendWindow -= n
+		end := endStream && n == int64(len(p))
+		c.mu.Unlock()
+
+		c.wmu.Lock()
+		if end {
+			c.mu.Lock()
+			st.localClosed = true
+			c.mu.Unlock()
+		}
+		err := c.fr.WriteData(st.id, end, p[:n])
+		c.wmu.Unlock()
+		if err != nil {
+			return err
+		}
+		p = p[n:]
+		if len(p) == 0 {
+			return nil
+		}
+	}
+}
+
+// writeRSTStream sends RST_STREAM for st unless it was already reset.
+func (c *h2Conn) writeRSTStream(st *h2Stream, code h2ErrCode) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	already := st.reset
+	st.reset = true
+	st.localClosed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	if !already {
+		c.fr.WriteRSTStream(st.id, code)
+	}
+}
+
+// h2Pipe is a goroutine-safe buffer connecting the HTTP/2 frame
+// reader, which writes the DATA frames of a stream into it, with the
+// Request or Response Body reading from it. The buffer is bounded by
+// flow control rather than by the pipe itself.
+type h2Pipe struct {
+	mu  sync.Mutex
+	c   sync.Cond // c.L == &mu
+	b   bytes.Buffer
+	err error // returned by Read once b is drained
+
+	// broken is set when the reader is no longer interested; any
+	// buffered and future data is discarded.
+	broken bool
+
+	// onRead, if non-nil, is called after Read consumes n bytes,
+	// so the caller can return flow control credit to the peer.
+	onRead func(n int)
+}
+
+func newH2Pipe(onRead func(int)) *h2Pipe {
+	p := &h2Pipe{onRead: onRead}
+	p.c.L = &p.mu
+	return p
+}
+
+// Read reads from the buffer, blocking until data is available or
+// the pipe is closed.
+func (p *h2Pipe) Read(d []byte) (n int, err error) {
+	p.mu.Lock()
+	for p.b.Len() == 0 && p.err == nil {
+		p.c.Wait()
+	}
+	if p.b.Len() > 0 {
+		n, _ = p.b.Read(d)
+	} else {
+		err = p.err
+	}
+	p.mu.Unlock()
+	if n > 0 && p.onRead != nil {
+		p.onRead(n)
+	}
+	return n, err
+}
+
+// Write appends d to the buffer. It reports false, discarding d, if
+// the reader is gone or the pipe was already closed.
+func (p *h2Pipe) Write(d []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.broken || p.err != nil {
+		return false
+	}
+	p.b.Write(d)
+	p.c.Signal()
+	return true
+}
+
+// CloseWithError makes Read return err once the buffered data has
+// been consumed. Only the first error is kept.
+func (p *h2Pipe) CloseWithError(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+		p.c.Broadcast()
+	}
+}
+
+// Break discards any buffered data, makes Read return err at once,
+// and makes future Writes fail. It returns the number of bytes
+// discarded, which the caller should return to the peer as flow
+// control credit.
+func (p *h2Pipe) Break(err error) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := p.b.Len()
+	p.b.Reset()
+	p.broken = true
+	if p.err == nil || p.err == io.EOF {
+		p.err = err
+	}
+	p.c.Broadcast()
+	return n
+}
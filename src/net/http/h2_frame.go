@@ -0,0 +1,611 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/2 framing layer, as defined in RFC 7540 section 4 and 6.
+
+package http
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// h2ClientPreface is the string that must be sent by new
+// connections from clients.
+const h2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const (
+	h2FrameHeaderLen = 9
+
+	// h2InitialWindowSize is the initial flow control window size
+	// of new streams and connections, per RFC 7540 section 6.9.2.
+	h2InitialWindowSize = 65535
+
+	// h2MaxWindowSize is the largest flow control window allowed.
+	h2MaxWindowSize = 1<<31 - 1
+
+	// h2DefaultMaxFrameSize is the initial SETTINGS_MAX_FRAME_SIZE.
+	h2DefaultMaxFrameSize = 1 << 14
+
+	// h2MaxFrameSizeLimit is the largest SETTINGS_MAX_FRAME_SIZE a
+	// peer may advertise.
+	h2MaxFrameSizeLimit = 1<<24 - 1
+)
+
+// An h2FrameType is a registered frame type as defined in
+// RFC 7540 section 11.2.
+type h2FrameType uint8
+
+const (
+	h2FrameData         h2FrameType = 0x0
+	h2FrameHeaders      h2FrameType = 0x1
+	h2FramePriority     h2FrameType = 0x2
+	h2FrameRSTStream    h2FrameType = 0x3
+	h2FrameSettings     h2FrameType = 0x4
+	h2FramePushPromise  h2FrameType = 0x5
+	h2FramePing         h2FrameType = 0x6
+	h2FrameGoAway       h2FrameType = 0x7
+	h2FrameWindowUpdate h2FrameType = 0x8
+	h2FrameContinuation h2FrameType = 0x9
+)
+
+var h2FrameName = map[h2FrameType]string{
+	h2FrameData:         "DATA",
+	h2FrameHeaders:      "HEADERS",
+	h2FramePriority:     "PRIORITY",
+	h2FrameRSTStream:    "RST_STREAM",
+	h2FrameSettings:     "SETTINGS",
+	h2FramePushPromise:  "PUSH_PROMISE",
+	h2FramePing:         "PING",
+	h2FrameGoAway:       "GOAWAY",
+	h2FrameWindowUpdate: "WINDOW_UPDATE",
+	h2FrameContinuation: "CONTINUATION",
+}
+
+func (t h2FrameType) String() string {
+	if s, ok := h2FrameName[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("UNKNOWN_FRAME_TYPE_%d", uint8(t))
+}
+
+// h2Flags is a bitmask of HTTP/2 flags. Their meaning depends on
+// the frame type.
+type h2Flags uint8
+
+const (
+	h2FlagEndStream  h2Flags = 0x1 // DATA, HEADERS
+	h2FlagAck        h2Flags = 0x1 // SETTINGS, PING
+	h2FlagEndHeaders h2Flags = 0x4 // HEADERS, PUSH_PROMISE, CONTINUATION
+	h2FlagPadded     h2Flags = 0x8 // DATA, HEADERS, PUSH_PROMISE
+	h2FlagPriority   h2Flags = 0x20
+)
+
+func (f h2Flags) has(v h2Flags) bool { return f&v == v }
+
+// An h2SettingID is an HTTP/2 setting as defined in RFC 7540
+// section 6.5.2.
+type h2SettingID uint16
+
+const (
+	h2SettingHeaderTableSize      h2SettingID = 0x1
+	h2SettingEnablePush           h2SettingID = 0x2
+	h2SettingMaxConcurrentStreams h2SettingID = 0x3
+	h2SettingInitialWindowSize    h2SettingID = 0x4
+	h2SettingMaxFrameSize         h2SettingID = 0x5
+	h2SettingMaxHeaderListSize    h2SettingID = 0x6
+)
+
+// An h2Setting is a setting parameter: which setting it is, and its
+// value.
+type h2Setting struct {
+	ID  h2SettingID
+	Val uint32
+}
+
+// valid reports an error if the setting's value is out of range.
+func (s h2Setting) valid() error {
+	switch s.ID {
+	case h2SettingEnablePush:
+		if s.Val != 0 && s.Val != 1 {
+			return h2ConnError{h2ErrCodeProtocol, "invalid SETTINGS_ENABLE_PUSH"}
+		}
+	case h2SettingInitialWindowSize:
+		if s.Val > h2MaxWindowSize {
+			return h2ConnError{h2ErrCodeFlowControl, "invalid SETTINGS_INITIAL_WINDOW_SIZE"}
+		}
+	case h2SettingMaxFrameSize:
+		if s.Val < h2DefaultMaxFrameSize || s.Val > h2MaxFrameSizeLimit {
+			return h2ConnError{h2ErrCodeProtocol, "invalid SETTINGS_MAX_FRAME_SIZE"}
+		}
+	}
+	return nil
+}
+
+// An h2ErrCode is an unsigned 32-bit error code as defined in
+// RFC 7540 section 7.
+type h2ErrCode uint32
+
+const (
+	h2ErrCodeNo                 h2ErrCode = 0x0
+	h2ErrCodeProtocol           h2ErrCode = 0x1
+	h2ErrCodeInternal           h2ErrCode = 0x2
+	h2ErrCodeFlowControl        h2ErrCode = 0x3
+	h2ErrCodeSettingsTimeout    h2ErrCode = 0x4
+	h2ErrCodeStreamClosed       h2ErrCode = 0x5
+	h2ErrCodeFrameSize          h2ErrCode = 0x6
+	h2ErrCodeRefusedStream      h2ErrCode = 0x7
+	h2ErrCodeCancel             h2ErrCode = 0x8
+	h2ErrCodeCompression        h2ErrCode = 0x9
+	h2ErrCodeConnect            h2ErrCode = 0xa
+	h2ErrCodeEnhanceYourCalm    h2ErrCode = 0xb
+	h2ErrCodeInadequateSecurity h2ErrCode = 0xc
+	h2ErrCodeHTTP11Required     h2ErrCode = 0xd
+)
+
+var h2ErrCodeName = map[h2ErrCode]string{
+	h2ErrCodeNo:                 "NO_ERROR",
+	h2ErrCodeProtocol:           "PROTOCOL_ERROR",
+	h2ErrCodeInternal:           "INTERNAL_ERROR",
+	h2ErrCodeFlowControl:        "FLOW_CONTROL_ERROR",
+	h2ErrCodeSettingsTimeout:    "SETTINGS_TIMEOUT",
+	h2ErrCodeStreamClosed:       "STREAM_CLOSED",
+	h2ErrCodeFrameSize:          "FRAME_SIZE_ERROR",
+	h2ErrCodeRefusedStream:      "REFUSED_STREAM",
+	h2ErrCodeCancel:             "CANCEL",
+	h2ErrCodeCompression:        "COMPRESSION_ERROR",
+	h2ErrCodeConnect:            "CONNECT_ERROR",
+	h2ErrCodeEnhanceYourCalm:    "ENHANCE_YOUR_CALM",
+	h2ErrCodeInadequateSecurity: "INADEQUATE_SECURITY",
+	h2ErrCodeHTTP11Required:     "HTTP_1_1_REQUIRED",
+}
+
+func (e h2ErrCode) String() string {
+	if s, ok := h2ErrCodeName[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown error code 0x%x", uint32(e))
+}
+
+// h2ConnError is an error that applies to the whole connection.
+// The connection is closed with a GOAWAY frame carrying Code.
+type h2ConnError struct {
+	Code   h2ErrCode
+	Reason string
+}
+
+func (e h2ConnError) Error() string {
+	return fmt.Sprintf("http2: connection error: %v: %s", e.Code, e.Reason)
+}
+
+// h2StreamError is an error that only affects one stream. The
+// stream is reset with an RST_STREAM frame carrying Code.
+type h2StreamError struct {
+	StreamID uint32
+	Code     h2ErrCode
+}
+
+func (e h2StreamError) Error() string {
+	return fmt.Sprintf("http2: stream error: stream ID %d; %v", e.StreamID, e.Code)
+}
+
+// h2GoAwayError is returned by the client when the server closes
+// the connection with a GOAWAY frame carrying an error.
+type h2GoAwayError struct {
+	LastStreamID uint32
+	Code         h2ErrCode
+	Debug        string
+}
+
+func (e h2GoAwayError) Error() string {
+	return fmt.Sprintf("http2: server sent GOAWAY and closed the connection; LastStreamID=%d, ErrCode=%v, debug=%q",
+		e.LastStreamID, e.Code, e.Debug)
+}
+
+// An h2Frame is a single frame read by an h2Framer. Which fields
+// are meaningful depends on Type.
+type h2Frame struct {
+	Type     h2FrameType
+	Flags    h2Flags
+	StreamID uint32
+
+	// Length is the length of the frame payload, including any
+	// padding. It is what DATA frames count against flow control.
+	Length uint32
+
+	// Data is the payload with any padding and priority fields
+	// removed. For HEADERS and PUSH_PROMISE frames it's the
+	// complete header block, including the fragments carried by
+	// CONTINUATION frames.
+	Data []byte
+
+	Settings     []h2Setting // SETTINGS
+	ErrCode      h2ErrCode   // RST_STREAM, GOAWAY
+	LastStreamID uint32      // GOAWAY
+	PromiseID    uint32      // PUSH_PROMISE
+	Increment    uint32      // WINDOW_UPDATE
+}
+
+func (f *h2Frame) String() string {
+	return fmt.Sprintf("[FrameHeader %v flags=0x%x stream=%d len=%d]", f.Type, uint8(f.Flags), f.StreamID, f.Length)
+}
+
+var errH2FrameTooLarge = errors.New("http2: frame too large")
+
+// An h2Framer reads and writes HTTP/2 frames.
+//
+// Reads and writes are independent; callers must serialize their
+// own calls to the write methods.
+type h2Framer struct {
+	r    io.Reader
+	hbuf [h2FrameHeaderLen]byte
+
+	// maxReadSize is the largest frame payload the peer may
+	// send us: our SETTINGS_MAX_FRAME_SIZE.
+	maxReadSize uint32
+
+	// maxHeaderBlock limits the total size of a header block
+	// assembled from HEADERS and CONTINUATION frames.
+	maxHeaderBlock int
+
+	w    io.Writer
+	wbuf []byte
+
+	// maxWriteSize is the largest frame payload we may send: the
+	// peer's SETTINGS_MAX_FRAME_SIZE.
+	maxWriteSize uint32
+}
+
+func newH2Framer(w io.Writer, r io.Reader) *h2Framer {
+	return &h2Framer{
+		r:              r,
+		w:              w,
+		maxReadSize:    h2DefaultMaxFrameSize,
+		maxWriteSize:   h2DefaultMaxFrameSize,
+		maxHeaderBlock: DefaultMaxHeaderBytes,
+	}
+}
+
+// readRawFrame reads the next frame header and its payload.
+func (fr *h2Framer) readRawFrame() (*h2Frame, error) {
+	if _, err := io.ReadFull(fr.r, fr.hbuf[:]); err != nil {
+		return nil, err
+	}
+	b := fr.hbuf[:]
+	f := &h2Frame{
+		Length:   uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]),
+		Type:     h2FrameType(b[3]),
+		Flags:    h2Flags(b[4]),
+		StreamID: binary.BigEndian.Uint32(b[5:]) & (1<<31 - 1),
+	}
+	if f.Length > fr.maxReadSize {
+		return nil, h2ConnError{h2ErrCodeFrameSize, errH2FrameTooLarge.Error()}
+	}
+	f.Data = make([]byte, f.Length)
+	if _, err := io.ReadFull(fr.r, f.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadFrame reads a single frame and validates it. CONTINUATION
+// frames are consumed here and their fragments appended to the
+// HEADERS or PUSH_PROMISE frame they continue, so callers never see
+// them.
+//
+// Errors of type h2ConnError or h2StreamError describe protocol
+// violations by the peer; other errors come from the underlying
+// reader.
+func (fr *h2Framer) ReadFrame() (*h2Frame, error) {
+	f, err := fr.readRawFrame()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.parse(); err != nil {
+		return nil, err
+	}
+	if (f.Type == h2FrameHeaders || f.Type == h2FramePushPromise) && !f.Flags.has(h2FlagEndHeaders) {
+		for {
+			c, err := fr.readRawFrame()
+			if err != nil {
+				return nil, err
+			}
+			if c.Type != h2FrameContinuation || c.StreamID != f.StreamID {
+				return nil, h2ConnError{h2ErrCodeProtocol, "expected CONTINUATION frame"}
+			}
+			if len(f.Data)+len(c.Data) > fr.maxHeaderBlock {
+				return nil, h2ConnError{h2ErrCodeEnhanceYourCalm, "header block too large"}
+			}
+			f.Data = append(f.Data, c.Data...)
+			if c.Flags.has(h2FlagEndHeaders) {
+				f.Flags |= h2FlagEndHeaders
+				break
+			}
+		}
+	}
+	return f, nil
+}
+
+// parse validates f's payload and decodes its type-specific fields.
+func (f *h2Frame) parse() error {
+	protoErr := func(reason string) error {
+		return h2ConnError{h2ErrCodeProtocol, fmt.Sprintf("%v: %s", f.Type, reason)}
+	}
+	sizeErr := func() error {
+		return h2ConnError{h2ErrCodeFrameSize, fmt.Sprintf("%v frame with invalid length %d", f.Type, f.Length)}
+	}
+	switch f.Type {
+	case h2FrameData, h2FrameHeaders, h2FramePushPromise, h2FramePriority,
+		h2FrameRSTStream, h2FrameContinuation:
+		if f.StreamID == 0 {
+			return protoErr("stream ID 0")
+		}
+	case h2FrameSettings, h2FramePing, h2FrameGoAway:
+		if f.StreamID != 0 {
+			return protoErr("non-zero stream ID")
+		}
+	}
+	switch f.Type {
+	case h2FrameData, h2FrameHeaders, h2FramePushPromise:
+		if f.Flags.has(h2FlagPadded) {
+			if len(f.Data) < 1 {
+				return sizeErr()
+			}
+			pad := int(f.Data[0])
+			f.Data = f.Data[1:]
+			if pad > len(f.Data) {
+				return protoErr("pad length too large")
+			}
+			f.Data = f.Data[:len(f.Data)-pad]
+		}
+		switch {
+		case f.Type == h2FrameHeaders && f.Flags.has(h2FlagPriority):
+			if len(f.Data) < 5 {
+				return sizeErr()
+			}
+			f.Data = f.Data[5:] // priority is advisory; ignore it
+		case f.Type == h2FramePushPromise:
+			if len(f.Data) < 4 {
+				return sizeErr()
+			}
+			f.PromiseID = binary.BigEndian.Uint32(f.Data) & (1<<31 - 1)
+			f.Data = f.Data[4:]
+		}
+	case h2FramePriority:
+		if f.Length != 5 {
+			return h2StreamError{f.StreamID, h2ErrCodeFrameSize}
+		}
+	case h2FrameRSTStream:
+		if f.Length != 4 {
+			return sizeErr()
+		}
+		f.ErrCode = h2ErrCode(binary.BigEndian.Uint32(f.Data))
+	case h2FrameSettings:
+		if f.Flags.has(h2FlagAck) {
+			if f.Length != 0 {
+				return sizeErr()
+			}
+			break
+		}
+		if f.Length%6 != 0 {
+			return sizeErr()
+		}
+		for p := f.Data; len(p) > 0; p = p[6:] {
+			s := h2Setting{h2SettingID(binary.BigEndian.Uint16(p)), binary.BigEndian.Uint32(p[2:])}
+			if err := s.valid(); err != nil {
+				return err
+			}
+			f.Settings = append(f.Settings, s)
+		}
+	case h2FramePing:
+		if f.Length != 8 {
+			return sizeErr()
+		}
+	case h2FrameGoAway:
+		if f.Length < 8 {
+			return sizeErr()
+		}
+		f.LastStreamID = binary.BigEndian.Uint32(f.Data) & (1<<31 - 1)
+		f.ErrCode = h2ErrCode(binary.BigEndian.Uint32(f.Data[4:]))
+		f.Data = f.Data[8:]
+	case h2FrameWindowUpdate:
+		if f.Length != 4 {
+			return sizeErr()
+		}
+		f.Increment = binary.BigEndian.Uint32(f.Data) & (1<<31 - 1)
+		if f.Increment == 0 {
+			if f.StreamID == 0 {
+				return protoErr("zero increment")
+			}
+			return h2StreamError{f.StreamID, h2ErrCodeProtocol}
+		}
+	case h2FrameContinuation:
+		return protoErr("unexpected CONTINUATION frame")
+	}
+	return nil
+}
+
+// startWrite begins a frame with the given header fields. The
+// length is filled in by endWrite.
+func (fr *h2Framer) startWrite(t h2FrameType, flags h2Flags, streamID uint32) {
+	fr.wbuf = append(fr.wbuf[:0],
+		0, 0, 0, // length, filled in later
+		byte(t),
+		byte(flags),
+		byte(streamID>>24),
+		byte(streamID>>16),
+		byte(streamID>>8),
+		byte(streamID))
+}
+
+func (fr *h2Framer) endWrite() error {
+	n := len(fr.wbuf) - h2FrameHeaderLen
+	if n >= 1<<24 {
+		return errH2FrameTooLarge
+	}
+	fr.wbuf[0], fr.wbuf[1], fr.wbuf[2] = byte(n>>16), byte(n>>8), byte(n)
+	_, err := fr.w.Write(fr.wbuf)
+	return err
+}
+
+func (fr *h2Framer) writeUint32(v uint32) {
+	fr.wbuf = append(fr.wbuf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// WriteData writes a DATA frame. The caller is responsible for not
+// exceeding the peer's flow control windows and maximum frame size.
+func (fr *h2Framer) WriteData(streamID uint32, endStream bool, data []byte) error {
+	var flags h2Flags
+	if endStream {
+		flags |= h2FlagEndStream
+	}
+	fr.startWrite(h2FrameData, flags, streamID)
+	fr.wbuf = append(fr.wbuf, data...)
+	return fr.endWrite()
+}
+
+// WriteHeaders writes an encoded header block as a HEADERS frame,
+// followed by as many CONTINUATION frames as needed to stay within
+// the peer's maximum frame size.
+func (fr *h2Framer) WriteHeaders(streamID uint32, endStream bool, block []byte) error {
+	var flags h2Flags
+	if endStream {
+		flags |= h2FlagEndStream
+	}
+	return fr.writeHeaderBlock(h2FrameHeaders, flags, streamID, nil, block)
+}
+
+// WritePushPromise writes a PUSH_PROMISE frame on streamID promising
+// promiseID, with any CONTINUATION frames needed for the block.
+func (fr *h2Framer) WritePushPromise(streamID, promiseID uint32, block []byte) error {
+	return fr.writeHeaderBlock(h2FramePushPromise, 0, streamID, []byte{
+		byte(promiseID >> 24), byte(promiseID >> 16), byte(promiseID >> 8), byte(promiseID),
+	}, block)
+}
+
+func (fr *h2Framer) writeHeaderBlock(t h2FrameType, flags h2Flags, streamID uint32, prefix, block []byte) error {
+	max := int(fr.maxWriteSize) - len(prefix)
+	first := true
+	for first || len(block) > 0 {
+		frag := block
+		if len(frag) > max {
+			frag = frag[:max]
+		}
+		block = block[len(frag):]
+		f := flags
+		if len(block) == 0 {
+			f |= h2FlagEndHeaders
+		}
+		if first {
+			fr.startWrite(t, f, streamID)
+			fr.wbuf = append(fr.wbuf, prefix...)
+		} else {
+			fr.startWrite(h2FrameContinuation, f&h2FlagEndHeaders, streamID)
+		}
+		fr.wbuf = append(fr.wbuf, frag...)
+		if err := fr.endWrite(); err != nil {
+			return err
+		}
+		first, max = false, int(fr.maxWriteSize)
+	}
+	return nil
+}
+
+// WriteSettings writes a SETTINGS frame with zero or more settings.
+func (fr *h2Framer) WriteSettings(settings ...h2Setting) error {
+	fr.startWrite(h2FrameSettings, 0, 0)
+	for _, s := range settings {
+		fr.wbuf = append(fr.wbuf, byte(s.ID>>8), byte(s.ID))
+		fr.writeUint32(s.Val)
+	}
+	return fr.endWrite()
+}
+
+// WriteSettingsAck writes an empty SETTINGS frame with the ACK bit set.
+func (fr *h2Framer) WriteSettingsAck() error {
+	fr.startWrite(h2FrameSettings, h2FlagAck, 0)
+	return fr.endWrite()
+}
+
+// WritePing writes a PING frame.
+func (fr *h2Framer) WritePing(ack bool, data [8]byte) error {
+	var flags h2Flags
+	if ack {
+		flags = h2FlagAck
+	}
+	fr.startWrite(h2FramePing, flags, 0)
+	fr.wbuf = append(fr.wbuf, data[:]...)
+	return fr.endWrite()
+}
+
+// WriteGoAway writes a GOAWAY frame.
+func (fr *h2Framer) WriteGoAway(maxStreamID uint32, code h2ErrCode, debug string) error {
+	fr.startWrite(h2FrameGoAway, 0, 0)
+	fr.writeUint32(maxStreamID & (1<<31 - 1))
+	fr.writeUint32(uint32(code))
+	fr.wbuf = append(fr.wbuf, debug...)
+	return fr.endWrite()
+}
+
+// WriteRSTStream writes a RST_STREAM frame.
+func (fr *h2Framer) WriteRSTStream(streamID uint32, code h2ErrCode) error {
+	fr.startWrite(h2FrameRSTStream, 0, streamID)
+	fr.writeUint32(uint32(code))
+	return fr.endWrite()
+}
+
+// WriteWindowUpdate writes a WINDOW_UPDATE frame. A streamID of zero
+// updates the connection's window.
+func (fr *h2Framer) WriteWindowUpdate(streamID, incr uint32) error {
+	fr.startWrite(h2FrameWindowUpdate, 0, streamID)
+	fr.writeUint32(incr)
+	return fr.endWrite()
+}
+
+// h2ConnectionHeaders are the HTTP/1 connection-specific header
+// fields which must not appear in HTTP/2 messages (RFC 7540 section
+// 8.1.2.2).
+var h2ConnectionHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// h2ValidHeaderName reports whether name is a valid lowercase
+// HTTP/2 field name, not counting pseudo-header fields.
+func h2ValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' || !isToken(rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// h2ForbiddenField reports whether the decoded field name, which
+// is lowercase, is a connection-specific header or a TE header with
+// a value other than "trailers".
+func h2ForbiddenField(name, value string) bool {
+	if name == "te" {
+		return value != "trailers"
+	}
+	for _, h := range h2ConnectionHeaders {
+		if strings.ToLower(h) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http/internal/hpack"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestH2FramerRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	fr := newH2Framer(&buf, &buf)
+	block := bytes.Repeat([]byte("h"), 3*h2DefaultMaxFrameSize/2)
+	fr.WriteSettings(h2Setting{h2SettingInitialWindowSize, 1 << 20}, h2Setting{h2SettingEnablePush, 0})
+	fr.WriteHeaders(1, false, block) // split into CONTINUATION
+	fr.WriteData(1, true, []byte("body"))
+	fr.WriteWindowUpdate(0, 1000)
+	fr.WriteRSTStream(3, h2ErrCodeCancel)
+	fr.WriteGoAway(1, h2ErrCodeNo, "bye")
+
+	check := func(f *h2Frame, err error, typ h2FrameType) *h2Frame {
+		if err != nil {
+			t.Fatalf("reading %v: %v", typ, err)
+		}
+		if f.Type != typ {
+			t.Fatalf("read %v frame; want %v", f.Type, typ)
+		}
+		return f
+	}
+	f, err := fr.ReadFrame()
+	check(f, err, h2FrameSettings)
+	if want := []h2Setting{{h2SettingInitialWindowSize, 1 << 20}, {h2SettingEnablePush, 0}}; !reflect.DeepEqual(f.Settings, want) {
+		t.Errorf("settings = %v; want %v", f.Settings, want)
+	}
+	f, err = fr.ReadFrame()
+	check(f, err, h2FrameHeaders)
+	if !bytes.Equal(f.Data, block) || !f.Flags.has(h2FlagEndHeaders) || f.Flags.has(h2FlagEndStream) {
+		t.Errorf("headers: %d bytes, flags %v", len(f.Data), f.Flags)
+	}
+	f, err = fr.ReadFrame()
+	check(f, err, h2FrameData)
+	if string(f.Data) != "body" || !f.Flags.has(h2FlagEndStream) || f.StreamID != 1 {
+		t.Errorf("data frame = %+v", f)
+	}
+	f, err = fr.ReadFrame()
+	if check(f, err, h2FrameWindowUpdate).Increment != 1000 {
+		t.Errorf("window increment = %d", f.Increment)
+	}
+	f, err = fr.ReadFrame()
+	if check(f, err, h2FrameRSTStream).ErrCode != h2ErrCodeCancel {
+		t.Errorf("RST_STREAM code = %v", f.ErrCode)
+	}
+	f, err = fr.ReadFrame()
+	if check(f, err, h2FrameGoAway); f.LastStreamID != 1 || string(f.Data) != "bye" {
+		t.Errorf("GOAWAY = %+v", f)
+	}
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Errorf("final read = %v; want EOF", err)
+	}
+}
+
+func TestH2FramerErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"DATA on stream 0", []byte{0, 0, 1, 0, 0, 0, 0, 0, 0, 'x'}},
+		{"SETTINGS on stream 1", []byte{0, 0, 0, 4, 0, 0, 0, 0, 1}},
+		{"bad SETTINGS length", []byte{0, 0, 1, 4, 0, 0, 0, 0, 0, 0}},
+		{"PING length", []byte{0, 0, 1, 6, 0, 0, 0, 0, 0, 0}},
+		{"zero WINDOW_UPDATE", []byte{0, 0, 4, 8, 0, 0, 0, 0, 1, 0, 0, 0, 0}},
+		{"oversized frame", []byte{0, 0x40, 1, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		fr := newH2Framer(nil, bytes.NewReader(tt.frame))
+		_, err := fr.ReadFrame()
+		if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+			t.Errorf("%s: ReadFrame error = %v; want protocol error", tt.name, err)
+		}
+	}
+}
+
+// h2TestClient speaks raw HTTP/2 frames to a Server.
+type h2TestClient struct {
+	t   *testing.T
+	nc  net.Conn
+	fr  *h2Framer
+	enc *hpack.Encoder
+	buf bytes.Buffer
+	dec *hpack.Decoder
+}
+
+func newH2TestClient(t *testing.T, h Handler) (*h2TestClient, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: h, EnableH2C: true}
+	go srv.Serve(ln)
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		t.Fatal(err)
+	}
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+	c := &h2TestClient{t: t, nc: nc, fr: newH2Framer(nc, nc), dec: hpack.NewDecoder(hpack.DefaultTableSize)}
+	c.enc = hpack.NewEncoder(&c.buf)
+	io.WriteString(nc, h2ClientPreface)
+	c.fr.WriteSettings()
+	return c, func() {
+		nc.Close()
+		ln.Close()
+	}
+}
+
+func (c *h2TestClient) writeHeaders(id uint32, endStream bool, kv ...string) {
+	c.buf.Reset()
+	for i := 0; i < len(kv); i += 2 {
+		c.enc.WriteField(hpack.HeaderField{Name: kv[i], Value: kv[i+1]})
+	}
+	if err := c.fr.WriteHeaders(id, endStream, c.buf.Bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readFrame returns the next frame of one of the given types,
+// skipping others.
+func (c *h2TestClient) readFrame(types ...h2FrameType) *h2Frame {
+	for {
+		f, err := c.fr.ReadFrame()
+		if err != nil {
+			c.t.Fatalf("reading %v: %v", types, err)
+		}
+		for _, typ := range types {
+			if f.Type == typ {
+				return f
+			}
+		}
+	}
+}
+
+func (c *h2TestClient) decode(f *h2Frame) map[string]string {
+	fields, err := c.dec.Decode(f.Data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	m := make(map[string]string)
+	for _, hf := range fields {
+		m[hf.Name] = hf.Value
+	}
+	return m
+}
+
+func TestH2ServerPush(t *testing.T) {
+	c, cleanup := newH2TestClient(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/style.css" {
+			if r.Header.Get("X-Pushed") != "yes" {
+				t.Errorf("pushed request header = %v", r.Header)
+			}
+			io.WriteString(w, "body{}")
+			return
+		}
+		err := w.(Pusher).Push("/style.css", &PushOptions{Header: Header{"X-Pushed": {"yes"}}})
+		if err != nil {
+			t.Errorf("Push: %v", err)
+		}
+		io.WriteString(w, "<html>")
+	}))
+	defer cleanup()
+
+	c.writeHeaders(1, true, ":method", "GET", ":scheme", "http", ":authority", "example.com", ":path", "/")
+	f := c.readFrame(h2FramePushPromise)
+	if f.StreamID != 1 || f.PromiseID != 2 {
+		t.Fatalf("PUSH_PROMISE on stream %d promising %d; want 1 and 2", f.StreamID, f.PromiseID)
+	}
+	if h := c.decode(f); h[":path"] != "/style.css" || h[":authority"] != "example.com" || h["x-pushed"] != "yes" {
+		t.Errorf("promised request = %v", h)
+	}
+
+	bodies := make(map[uint32]string)
+	ended := 0
+	for ended < 2 {
+		f := c.readFrame(h2FrameHeaders, h2FrameData)
+		if f.Type == h2FrameHeaders {
+			if h := c.decode(f); h[":status"] != "200" {
+				t.Errorf("stream %d: status %q", f.StreamID, h[":status"])
+			}
+		} else {
+			bodies[f.StreamID] += string(f.Data)
+		}
+		if f.Flags.has(h2FlagEndStream) {
+			ended++
+		}
+	}
+	if bodies[1] != "<html>" || bodies[2] != "body{}" {
+		t.Errorf("bodies = %q", bodies)
+	}
+}
+
+func TestH2ServerBadRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		kv   []string
+	}{
+		{"missing path", []string{":method", "GET", ":scheme", "http"}},
+		{"uppercase name", []string{":method", "GET", ":scheme", "http", ":path", "/", "X-Upper", "1"}},
+		{"connection header", []string{":method", "GET", ":scheme", "http", ":path", "/", "connection", "close"}},
+		{"pseudo after regular", []string{":method", "GET", "accept", "*/*", ":scheme", "http", ":path", "/"}},
+	}
+	for _, tt := range tests {
+		c, cleanup := newH2TestClient(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+			t.Errorf("handler ran for malformed request %v", r)
+		}))
+		c.writeHeaders(1, true, tt.kv...)
+		f := c.readFrame(h2FrameRSTStream, h2FrameGoAway)
+		if f.Type != h2FrameRSTStream || f.ErrCode != h2ErrCodeProtocol {
+			t.Errorf("%s: got %v %v; want RST_STREAM PROTOCOL_ERROR", tt.name, f.Type, f.ErrCode)
+		}
+		cleanup()
+	}
+}
+
+func TestH2ServerIgnoresUnknownFrames(t *testing.T) {
+	c, cleanup := newH2TestClient(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, strings.ToUpper(r.URL.Path))
+	}))
+	defer cleanup()
+	// An extension frame of type 0xbe must be ignored.
+	c.nc.Write([]byte{0, 0, 3, 0xbe, 0, 0, 0, 0, 0, 'a', 'b', 'c'})
+	c.writeHeaders(1, true, ":method", "GET", ":scheme", "http", ":path", "/ok")
+	if f := c.readFrame(h2FrameData); string(f.Data) != "/OK" {
+		t.Errorf("body = %q", f.Data)
+	}
+}
@@ -0,0 +1,1023 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/2 server, RFC 7540.
+
+package http
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http/internal/hpack"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// h2MaxConcurrentStreams is the SETTINGS_MAX_CONCURRENT_STREAMS
+	// advertised by the server.
+	h2MaxConcurrentStreams = 250
+
+	// h2StreamRecvWindow and h2ConnRecvWindow are the flow control
+	// windows granted to the peer for each stream and for the
+	// connection as a whole, by both the server and the client.
+	h2StreamRecvWindow = 1 << 20
+	h2ConnRecvWindow   = 1 << 20
+)
+
+var (
+	errH2ConnClosed = errors.New("http2: client connection lost")
+	errH2BodyLength = errors.New("http2: request body length does not match Content-Length")
+
+	errH2ReadTimeout error = &httpError{err: "http2: request body read deadline exceeded", timeout: true}
+)
+
+// h2ServerConn is the server side of an HTTP/2 connection. The
+// goroutine running serve reads and processes frames; each stream's
+// handler runs in its own goroutine.
+type h2ServerConn struct {
+	h2Conn
+	srv        *Server
+	handler    Handler
+	remoteAddr string
+	tlsState   *tls.ConnectionState
+	dec        *hpack.Decoder // only used by serve
+
+	// The following are guarded by mu.
+	streams           map[uint32]*h2ServerStream
+	maxClientStreamID uint32
+	nextPushID        uint32
+	clientStreams     int    // open client-initiated streams
+	pushStreams       uint32 // open server-initiated streams
+	peerMaxStreams    uint32 // peer's SETTINGS_MAX_CONCURRENT_STREAMS
+	pushEnabled       bool
+	goAwaySent        bool
+	idleTimer         *time.Timer // runs while no streams are open; nil without an IdleTimeout
+
+	shutdownOnce sync.Once
+}
+
+// h2ServerStream is a single request-response exchange on an
+// h2ServerConn.
+type h2ServerStream struct {
+	h2Stream
+	sc     *h2ServerConn
+	isPush bool
+	body   *h2Pipe // request body; nil if the request had none
+	req    *Request
+
+	declBodyBytes int64 // Content-Length of the request, or -1; only used by serve
+	bodyBytes     int64 // only used by serve
+
+	cancelOnce   sync.Once
+	cancelc      chan struct{} // the Request's Cancel channel
+	closeNotifyc chan bool     // buffered; receives true if the stream is reset
+}
+
+func (st *h2ServerStream) cancel() {
+	st.cancelOnce.Do(func() { close(st.cancelc) })
+}
+
+// serveH2 serves HTTP/2 on c, whose client has negotiated "h2" or
+// sent the prior-knowledge connection preface. Any bytes c has
+// already buffered are read through r.
+func (c *conn) serveH2(r io.Reader) {
+	srv := c.server
+	sc := &h2ServerConn{
+		srv:            srv,
+		handler:        serverHandler{srv},
+		remoteAddr:     c.remoteAddr,
+		tlsState:       c.tlsState,
+		dec:            hpack.NewDecoder(hpack.DefaultTableSize),
+		streams:        make(map[uint32]*h2ServerStream),
+		peerMaxStreams: ^uint32(0),
+		pushEnabled:    true,
+	}
+	sc.init(c.rwc, r, sc.streamList)
+	sc.dec.SetMaxStringLength(srv.maxHeaderBytes())
+	sc.fr.maxHeaderBlock = srv.maxHeaderBytes()
+
+	c.mu.Lock()
+	c.h2 = sc
+	c.mu.Unlock()
+	sc.serve()
+}
+
+func (sc *h2ServerConn) serve() {
+	defer sc.close()
+
+	// The deadlines set for the TLS handshake don't apply to the
+	// long-lived HTTP/2 connection.
+	sc.nc.SetDeadline(time.Time{})
+	if d := sc.srv.idleTimeout(); d != 0 {
+		sc.mu.Lock()
+		sc.idleTimer = time.AfterFunc(d, sc.onIdleTimeout)
+		sc.mu.Unlock()
+	}
+
+	sc.wmu.Lock()
+	err := sc.fr.WriteSettings(
+		h2Setting{h2SettingMaxConcurrentStreams, h2MaxConcurrentStreams},
+		h2Setting{h2SettingInitialWindowSize, h2StreamRecvWindow},
+		h2Setting{h2SettingMaxHeaderListSize, uint32(sc.srv.maxHeaderBytes())},
+	)
+	if err == nil {
+		err = sc.fr.WriteWindowUpdate(0, h2ConnRecvWindow-h2InitialWindowSize)
+	}
+	sc.wmu.Unlock()
+	if err != nil {
+		return
+	}
+
+	preface := make([]byte, len(h2ClientPreface))
+	if _, err := io.ReadFull(sc.fr.r, preface); err != nil || string(preface) != h2ClientPreface {
+		return
+	}
+
+	for first := true; ; first = false {
+		f, err := sc.fr.ReadFrame()
+		if err == nil && first && f.Type != h2FrameSettings {
+			err = h2ConnError{h2ErrCodeProtocol, "expected SETTINGS frame"}
+		}
+		if err == nil {
+			err = sc.processFrame(f)
+		}
+		switch e := err.(type) {
+		case nil:
+		case h2StreamError:
+			sc.resetStream(e.StreamID, e.Code)
+		case h2ConnError:
+			sc.mu.Lock()
+			last := sc.maxClientStreamID
+			sc.mu.Unlock()
+			sc.wmu.Lock()
+			sc.fr.WriteGoAway(last, e.Code, e.Reason)
+			sc.wmu.Unlock()
+			return
+		default:
+			return
+		}
+	}
+}
+
+// close tears down the connection once serve is done, failing any
+// streams still in flight.
+func (sc *h2ServerConn) close() {
+	sc.mu.Lock()
+	sc.closed = true
+	if sc.idleTimer != nil {
+		sc.idleTimer.Stop()
+	}
+	var open []*h2ServerStream
+	for _, st := range sc.streams {
+		open = append(open, st)
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+	for _, st := range open {
+		sc.closeStream(st, errH2ConnClosed)
+	}
+	sc.nc.Close()
+}
+
+// startGracefulShutdown arranges for a GOAWAY frame to be sent, so
+// the client stops opening new streams, and for the connection to be
+// closed once the streams in flight are done. It's called repeatedly
+// by Server.Shutdown and never blocks.
+func (sc *h2ServerConn) startGracefulShutdown() {
+	sc.shutdownOnce.Do(func() { go sc.goAway() })
+}
+
+func (sc *h2ServerConn) goAway() {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	sc.mu.Lock()
+	if sc.goAwaySent || sc.closed {
+		sc.mu.Unlock()
+		return
+	}
+	sc.goAwaySent = true
+	last := sc.maxClientStreamID
+	idle := len(sc.streams) == 0
+	sc.mu.Unlock()
+	sc.fr.WriteGoAway(last, h2ErrCodeNo, "")
+	if idle {
+		sc.nc.Close()
+	}
+}
+
+// onIdleTimeout shuts the connection down if it's been without
+// streams for the Server's IdleTimeout.
+func (sc *h2ServerConn) onIdleTimeout() {
+	sc.mu.Lock()
+	idle := len(sc.streams) == 0 && !sc.closed
+	sc.mu.Unlock()
+	if idle {
+		sc.startGracefulShutdown()
+	}
+}
+
+func (sc *h2ServerConn) processFrame(f *h2Frame) error {
+	switch f.Type {
+	case h2FrameSettings:
+		return sc.processSettings(f)
+	case h2FrameHeaders:
+		return sc.processHeaders(f)
+	case h2FrameData:
+		return sc.processData(f)
+	case h2FrameWindowUpdate:
+		return sc.processWindowUpdate(f)
+	case h2FramePing:
+		if f.Flags.has(h2FlagAck) {
+			return nil
+		}
+		var data [8]byte
+		copy(data[:], f.Data)
+		sc.wmu.Lock()
+		defer sc.wmu.Unlock()
+		return sc.fr.WritePing(true, data)
+	case h2FrameRSTStream:
+		sc.mu.Lock()
+		st := sc.streams[f.StreamID]
+		idle := sc.isIdleStream(f.StreamID)
+		sc.mu.Unlock()
+		if idle {
+			return h2ConnError{h2ErrCodeProtocol, "RST_STREAM on idle stream"}
+		}
+		if st != nil {
+			sc.closeStream(st, h2StreamError{f.StreamID, f.ErrCode})
+		}
+	case h2FrameGoAway:
+		// The client won't open new streams, nor accept pushed ones.
+		sc.mu.Lock()
+		sc.pushEnabled = false
+		sc.mu.Unlock()
+	case h2FramePushPromise:
+		return h2ConnError{h2ErrCodeProtocol, "PUSH_PROMISE sent by client"}
+	}
+	// PRIORITY frames are advisory and frames of unknown types
+	// must be ignored.
+	return nil
+}
+
+func (sc *h2ServerConn) streamList() []*h2Stream {
+	list := make([]*h2Stream, 0, len(sc.streams))
+	for _, st := range sc.streams {
+		list = append(list, &st.h2Stream)
+	}
+	return list
+}
+
+// isIdleStream reports whether id names a stream which hasn't been
+// opened yet. sc.mu must be held.
+func (sc *h2ServerConn) isIdleStream(id uint32) bool {
+	if id%2 == 1 {
+		return id > sc.maxClientStreamID
+	}
+	return id > sc.nextPushID
+}
+
+func (sc *h2ServerConn) processSettings(f *h2Frame) error {
+	if f.Flags.has(h2FlagAck) {
+		return nil
+	}
+	for _, s := range f.Settings {
+		if err := sc.applySetting(s); err != nil {
+			return err
+		}
+		switch s.ID {
+		case h2SettingEnablePush:
+			sc.mu.Lock()
+			sc.pushEnabled = s.Val != 0
+			sc.mu.Unlock()
+		case h2SettingMaxConcurrentStreams:
+			sc.mu.Lock()
+			sc.peerMaxStreams = s.Val
+			sc.mu.Unlock()
+		}
+	}
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	return sc.fr.WriteSettingsAck()
+}
+
+func (sc *h2ServerConn) processWindowUpdate(f *h2Frame) error {
+	var st *h2Stream
+	if f.StreamID != 0 {
+		sc.mu.Lock()
+		if sst := sc.streams[f.StreamID]; sst != nil {
+			st = &sst.h2Stream
+		}
+		sc.mu.Unlock()
+	}
+	return sc.h2Conn.processWindowUpdate(f, st)
+}
+
+func (sc *h2ServerConn) processHeaders(f *h2Frame) error {
+	id := f.StreamID
+	endStream := f.Flags.has(h2FlagEndStream)
+
+	// Always decode the block, to keep the HPACK state in sync
+	// with the client's, even if the stream is then refused.
+	fields, err := sc.dec.Decode(f.Data)
+	if err != nil {
+		return h2ConnError{h2ErrCodeCompression, err.Error()}
+	}
+
+	sc.mu.Lock()
+	if st := sc.streams[id]; st != nil {
+		remoteClosed := st.remoteClosed
+		sc.mu.Unlock()
+		if remoteClosed {
+			return h2StreamError{id, h2ErrCodeStreamClosed}
+		}
+		if !endStream {
+			return h2StreamError{id, h2ErrCodeProtocol}
+		}
+		return sc.processTrailers(st, fields)
+	}
+	if id%2 != 1 || id <= sc.maxClientStreamID {
+		sc.mu.Unlock()
+		return h2ConnError{h2ErrCodeProtocol, "invalid stream ID"}
+	}
+	sc.maxClientStreamID = id
+	goAwaySent := sc.goAwaySent
+	full := sc.clientStreams >= h2MaxConcurrentStreams
+	sc.mu.Unlock()
+	if goAwaySent {
+		// Streams newer than our GOAWAY are ignored; the
+		// client will retry them on a new connection.
+		return nil
+	}
+	if full {
+		return h2StreamError{id, h2ErrCodeRefusedStream}
+	}
+
+	st := &h2ServerStream{
+		h2Stream:     h2Stream{id: id, recvWindow: h2StreamRecvWindow, remoteClosed: endStream},
+		sc:           sc,
+		cancelc:      make(chan struct{}),
+		closeNotifyc: make(chan bool, 1),
+	}
+	req, err := sc.newRequest(st, fields)
+	if err != nil {
+		return err
+	}
+	st.req = req
+
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		return nil
+	}
+	st.sendWindow = sc.initialSendWindow
+	sc.streams[id] = st
+	sc.clientStreams++
+	if sc.idleTimer != nil {
+		sc.idleTimer.Stop()
+	}
+	sc.mu.Unlock()
+
+	go sc.runHandler(st, req)
+	return nil
+}
+
+// newRequest builds the Request for st from the decoded header
+// block of its HEADERS frame.
+func (sc *h2ServerConn) newRequest(st *h2ServerStream, fields []hpack.HeaderField) (*Request, error) {
+	badRequest := h2StreamError{st.id, h2ErrCodeProtocol}
+	var method, scheme, authority, path string
+	header := make(Header)
+	sawRegular := false
+	for _, hf := range fields {
+		if strings.HasPrefix(hf.Name, ":") {
+			var p *string
+			switch hf.Name {
+			case ":method":
+				p = &method
+			case ":scheme":
+				p = &scheme
+			case ":authority":
+				p = &authority
+			case ":path":
+				p = &path
+			}
+			if p == nil || *p != "" || sawRegular || hf.Value == "" {
+				return nil, badRequest
+			}
+			*p = hf.Value
+			continue
+		}
+		sawRegular = true
+		if !h2ValidHeaderName(hf.Name) || h2ForbiddenField(hf.Name, hf.Value) {
+			return nil, badRequest
+		}
+		key := CanonicalHeaderKey(hf.Name)
+		header[key] = append(header[key], hf.Value)
+	}
+	if cookies := header["Cookie"]; len(cookies) > 1 {
+		// RFC 7540 section 8.1.2.5 allows splitting the Cookie
+		// header into several fields; join them back.
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	req := &Request{
+		Method:     method,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     header,
+		Host:       authority,
+		RemoteAddr: sc.remoteAddr,
+		TLS:        sc.tlsState,
+		RequestURI: path,
+		Cancel:     st.cancelc,
+	}
+	if method == "CONNECT" {
+		if authority == "" || scheme != "" || path != "" {
+			return nil, badRequest
+		}
+		req.URL = &url.URL{Host: authority}
+		req.RequestURI = authority
+	} else {
+		if method == "" || scheme == "" || path == "" {
+			return nil, badRequest
+		}
+		u, err := url.ParseRequestURI(path)
+		if err != nil {
+			return nil, badRequest
+		}
+		req.URL = u
+	}
+	if req.Host == "" {
+		req.Host = header.get("Host")
+	}
+	header.Del("Host")
+
+	for _, v := range header["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			if key = CanonicalHeaderKey(strings.TrimSpace(key)); key != "" {
+				if req.Trailer == nil {
+					req.Trailer = make(Header)
+				}
+				req.Trailer[key] = nil
+			}
+		}
+	}
+
+	st.declBodyBytes = -1
+	if cl := header.get("Content-Length"); cl != "" {
+		n, err := parseContentLength(cl)
+		if err != nil || n < 0 {
+			return nil, badRequest
+		}
+		st.declBodyBytes = n
+	}
+	if st.remoteClosed {
+		if st.declBodyBytes > 0 {
+			return nil, badRequest
+		}
+		req.Body = eofReader
+		return req, nil
+	}
+	req.ContentLength = st.declBodyBytes
+	st.body = newH2Pipe(func(n int) { sc.returnCredit(&st.h2Stream, n) })
+	req.Body = &h2RequestBody{st: st}
+	return req, nil
+}
+
+// h2RequestBody is the Body of a Request received over HTTP/2.
+type h2RequestBody struct {
+	st     *h2ServerStream
+	closed bool
+}
+
+func (b *h2RequestBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyReadAfterClose
+	}
+	return b.st.body.Read(p)
+}
+
+func (b *h2RequestBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		if n := b.st.body.Break(ErrBodyReadAfterClose); n > 0 {
+			b.st.sc.returnCredit(nil, n)
+		}
+	}
+	return nil
+}
+
+func (sc *h2ServerConn) processData(f *h2Frame) error {
+	id := f.StreamID
+	sc.mu.Lock()
+	st := sc.streams[id]
+	if st == nil || st.remoteClosed || st.reset || st.body == nil {
+		idle := sc.isIdleStream(id)
+		sc.mu.Unlock()
+		if idle {
+			return h2ConnError{h2ErrCodeProtocol, "DATA on idle stream"}
+		}
+		// The frame still counted against the connection's
+		// flow control window.
+		if f.Length > 0 {
+			sc.returnCredit(nil, int(f.Length))
+		}
+		if st == nil {
+			return nil // stream already finished
+		}
+		return h2StreamError{id, h2ErrCodeStreamClosed}
+	}
+	sc.mu.Unlock()
+	if err := sc.takeRecvData(&st.h2Stream, f.Length); err != nil {
+		return err
+	}
+	endStream := f.Flags.has(h2FlagEndStream)
+	if endStream {
+		sc.mu.Lock()
+		st.remoteClosed = true
+		sc.mu.Unlock()
+	}
+
+	if pad := int(f.Length) - len(f.Data); pad > 0 {
+		sc.returnCredit(&st.h2Stream, pad)
+	}
+	if len(f.Data) > 0 && !st.body.Write(f.Data) {
+		// The handler closed the body; discard the data.
+		sc.returnCredit(&st.h2Stream, len(f.Data))
+	}
+	st.bodyBytes += int64(len(f.Data))
+	if d := st.declBodyBytes; d != -1 && (st.bodyBytes > d || endStream && st.bodyBytes != d) {
+		st.body.CloseWithError(errH2BodyLength)
+		return h2StreamError{id, h2ErrCodeProtocol}
+	}
+	if endStream {
+		st.body.CloseWithError(io.EOF)
+		sc.maybeFinishStream(st)
+	}
+	return nil
+}
+
+// processTrailers records the trailers of st's request, which ends
+// its body.
+func (sc *h2ServerConn) processTrailers(st *h2ServerStream, fields []hpack.HeaderField) error {
+	for _, hf := range fields {
+		if strings.HasPrefix(hf.Name, ":") || !h2ValidHeaderName(hf.Name) {
+			return h2StreamError{st.id, h2ErrCodeProtocol}
+		}
+		key := CanonicalHeaderKey(hf.Name)
+		if _, declared := st.req.Trailer[key]; declared {
+			st.req.Trailer[key] = append(st.req.Trailer[key], hf.Value)
+		}
+	}
+	sc.mu.Lock()
+	st.remoteClosed = true
+	sc.mu.Unlock()
+	if d := st.declBodyBytes; d != -1 && st.bodyBytes != d {
+		st.body.CloseWithError(errH2BodyLength)
+		return h2StreamError{st.id, h2ErrCodeProtocol}
+	}
+	st.body.CloseWithError(io.EOF)
+	sc.maybeFinishStream(st)
+	return nil
+}
+
+// maybeFinishStream closes st if both endpoints are done sending.
+func (sc *h2ServerConn) maybeFinishStream(st *h2ServerStream) {
+	sc.mu.Lock()
+	done := st.localClosed && st.remoteClosed
+	sc.mu.Unlock()
+	if done {
+		sc.closeStream(st, nil)
+	}
+}
+
+// closeStream removes st from the connection. A non-nil err means
+// the stream ended abnormally: it's reported to the handler through
+// the request body, Cancel and CloseNotify.
+func (sc *h2ServerConn) closeStream(st *h2ServerStream, err error) {
+	sc.mu.Lock()
+	if sc.streams[st.id] != st {
+		sc.mu.Unlock()
+		return
+	}
+	delete(sc.streams, st.id)
+	if st.isPush {
+		sc.pushStreams--
+	} else {
+		sc.clientStreams--
+	}
+	if err != nil {
+		st.reset = true
+		st.localClosed = true
+	}
+	closeConn := sc.goAwaySent && len(sc.streams) == 0
+	if len(sc.streams) == 0 && sc.idleTimer != nil {
+		sc.idleTimer.Reset(sc.srv.idleTimeout())
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+
+	var discarded int
+	if st.body != nil {
+		if err == nil {
+			err = errH2StreamClosed
+		}
+		discarded = st.body.Break(err)
+	}
+	if err != nil && err != errH2StreamClosed {
+		st.cancel()
+		select {
+		case st.closeNotifyc <- true:
+		default:
+		}
+	}
+	if discarded > 0 {
+		sc.returnCredit(nil, discarded)
+	}
+	if closeConn {
+		sc.nc.Close()
+	}
+}
+
+// resetStream sends RST_STREAM for the stream id and closes it.
+func (sc *h2ServerConn) resetStream(id uint32, code h2ErrCode) {
+	sc.mu.Lock()
+	st := sc.streams[id]
+	sc.mu.Unlock()
+	if st == nil {
+		// A stream we refused, or one that's already gone.
+		sc.wmu.Lock()
+		sc.fr.WriteRSTStream(id, code)
+		sc.wmu.Unlock()
+		return
+	}
+	sc.writeRSTStream(&st.h2Stream, code)
+	sc.closeStream(st, h2StreamError{id, code})
+}
+
+// runHandler runs the Server's handler for st in its own goroutine.
+func (sc *h2ServerConn) runHandler(st *h2ServerStream, req *Request) {
+	w := &h2ResponseWriter{
+		st:            st,
+		req:           req,
+		handlerHeader: make(Header),
+		contentLength: -1,
+	}
+	w.bw = newBufioWriterSize(h2ChunkWriter{w}, bufferBeforeChunkingSize)
+	didPanic := true
+	defer func() {
+		if didPanic {
+			err := recover()
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			sc.srv.logf("http: panic serving %v: %v\n%s", sc.remoteAddr, err, buf)
+			sc.resetStream(st.id, h2ErrCodeInternal)
+		} else {
+			w.finishRequest()
+		}
+		w.stopDeadlines()
+		st.cancel()
+	}()
+	sc.handler.ServeHTTP(w, req)
+	didPanic = false
+}
+
+// h2ResponseWriter is the ResponseWriter for HTTP/2 requests. Like
+// the HTTP/1 response, it buffers small bodies so it can send their
+// Content-Length and sniff their Content-Type.
+type h2ResponseWriter struct {
+	st            *h2ServerStream
+	req           *Request
+	handlerHeader Header
+	bw            *bufio.Writer // buffers output to h2ChunkWriter
+
+	status        int
+	wroteHeader   bool  // WriteHeader was called
+	sentHeader    bool  // the HEADERS frame was sent
+	handlerDone   bool  // the handler has returned
+	contentLength int64 // explicitly-declared Content-Length, or -1
+	written       int64 // bytes written by the handler
+	trailers      []string
+
+	readTimer, writeTimer *time.Timer // fire at the handler's deadlines
+}
+
+// h2ChunkWriter writes the body buffered by an h2ResponseWriter,
+// sending the header first if needed.
+type h2ChunkWriter struct{ w *h2ResponseWriter }
+
+func (cw h2ChunkWriter) Write(p []byte) (int, error) {
+	w := cw.w
+	if !w.sentHeader {
+		if err := w.writeHeader(p, false); err != nil {
+			return 0, err
+		}
+	}
+	if w.req.Method == "HEAD" {
+		return len(p), nil
+	}
+	if err := w.st.sc.writeData(&w.st.h2Stream, p, false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *h2ResponseWriter) Header() Header {
+	return w.handlerHeader
+}
+
+func (w *h2ResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.st.sc.srv.logf("http: multiple response.WriteHeader calls")
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	if cl := w.handlerHeader.get("Content-Length"); cl != "" {
+		v, err := strconv.ParseInt(cl, 10, 64)
+		if err == nil && v >= 0 {
+			w.contentLength = v
+		} else {
+			w.st.sc.srv.logf("http: invalid Content-Length of %q", cl)
+			w.handlerHeader.Del("Content-Length")
+		}
+	}
+}
+
+func (w *h2ResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if !bodyAllowedForStatus(w.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	w.written += int64(len(p))
+	if w.contentLength != -1 && w.written > w.contentLength {
+		return 0, ErrContentLength
+	}
+	return w.bw.Write(p)
+}
+
+func (w *h2ResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	w.bw.Flush()
+	if !w.sentHeader {
+		w.writeHeader(nil, false)
+	}
+}
+
+func (w *h2ResponseWriter) CloseNotify() <-chan bool {
+	return w.st.closeNotifyc
+}
+
+func (w *h2ResponseWriter) SetReadDeadline(t time.Time) error {
+	st := w.st
+	w.setDeadline(&w.readTimer, t, func() {
+		if st.body == nil {
+			return
+		}
+		if n := st.body.Break(errH2ReadTimeout); n > 0 {
+			st.sc.returnCredit(nil, n)
+		}
+	})
+	return nil
+}
+
+func (w *h2ResponseWriter) SetWriteDeadline(t time.Time) error {
+	st := w.st
+	w.setDeadline(&w.writeTimer, t, func() {
+		st.sc.resetStream(st.id, h2ErrCodeCancel)
+	})
+	return nil
+}
+
+// setDeadline arranges for f to run at t, replacing the deadline
+// held in *timer.
+func (w *h2ResponseWriter) setDeadline(timer **time.Timer, t time.Time, f func()) {
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if t.IsZero() {
+		return
+	}
+	*timer = time.AfterFunc(t.Sub(time.Now()), f)
+}
+
+func (w *h2ResponseWriter) stopDeadlines() {
+	w.setDeadline(&w.readTimer, time.Time{}, nil)
+	w.setDeadline(&w.writeTimer, time.Time{}, nil)
+}
+
+// writeHeader sends the response HEADERS frame. p is the start of
+// the body, used to sniff the Content-Type and, if it's the whole
+// body, to set the Content-Length.
+func (w *h2ResponseWriter) writeHeader(p []byte, endStream bool) error {
+	w.sentHeader = true
+	h := w.handlerHeader
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(w.status)}}
+	for k, vv := range h {
+		if h2IsConnectionHeader(k) {
+			continue
+		}
+		name := strings.ToLower(k)
+		for _, v := range vv {
+			fields = append(fields, hpack.HeaderField{Name: name, Value: v})
+		}
+	}
+	if bodyAllowedForStatus(w.status) {
+		if _, ok := h["Content-Type"]; !ok {
+			fields = append(fields, hpack.HeaderField{Name: "content-type", Value: DetectContentType(p)})
+		}
+		if w.handlerDone && h.get("Content-Length") == "" && (w.req.Method != "HEAD" || len(p) > 0) {
+			fields = append(fields, hpack.HeaderField{Name: "content-length", Value: strconv.Itoa(len(p))})
+		}
+	}
+	if _, ok := h["Date"]; !ok {
+		fields = append(fields, hpack.HeaderField{Name: "date", Value: time.Now().UTC().Format(TimeFormat)})
+	}
+	for _, v := range h["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			if key = CanonicalHeaderKey(strings.TrimSpace(key)); key != "" {
+				w.trailers = append(w.trailers, key)
+			}
+		}
+	}
+	return w.st.sc.writeHeaders(&w.st.h2Stream, endStream, fields)
+}
+
+// finishRequest sends whatever the handler left buffered and ends
+// the stream, once the handler has returned.
+func (w *h2ResponseWriter) finishRequest() {
+	st, sc := w.st, w.st.sc
+	w.handlerDone = true
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	err := w.bw.Flush()
+	putBufioWriter(w.bw)
+	if err == nil && !w.sentHeader {
+		err = w.writeHeader(nil, len(w.handlerHeader["Trailer"]) == 0)
+	}
+	sc.mu.Lock()
+	localClosed := st.localClosed
+	sc.mu.Unlock()
+	if err == nil && !localClosed {
+		var trailers []hpack.HeaderField
+		for _, k := range w.trailers {
+			for _, v := range w.handlerHeader[k] {
+				trailers = append(trailers, hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+			}
+		}
+		if len(trailers) > 0 {
+			err = sc.writeHeaders(&st.h2Stream, true, trailers)
+		} else {
+			err = sc.writeData(&st.h2Stream, nil, true)
+		}
+	}
+	if err != nil {
+		sc.resetStream(st.id, h2ErrCodeInternal)
+		return
+	}
+	sc.mu.Lock()
+	remoteClosed := st.remoteClosed
+	sc.mu.Unlock()
+	if !remoteClosed {
+		// The handler is done but the client is still sending
+		// the request body; tell it to stop (RFC 7540 section
+		// 8.1).
+		sc.resetStream(st.id, h2ErrCodeNo)
+		return
+	}
+	sc.maybeFinishStream(st)
+}
+
+// h2IsConnectionHeader reports whether the canonical header key k
+// is an HTTP/1 connection-specific header.
+func h2IsConnectionHeader(k string) bool {
+	for _, h := range h2ConnectionHeaders {
+		if k == h {
+			return true
+		}
+	}
+	return false
+}
+
+// Push implements the Pusher interface.
+func (w *h2ResponseWriter) Push(target string, opts *PushOptions) error {
+	st, sc := w.st, w.st.sc
+	if st.isPush {
+		return ErrNotSupported
+	}
+	if opts == nil {
+		opts = new(PushOptions)
+	}
+	method := opts.Method
+	if method == "" {
+		method = "GET"
+	}
+	if method != "GET" && method != "HEAD" {
+		return errors.New("http: push method must be GET or HEAD")
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if u.Host != w.req.Host {
+			return errors.New("http: push target must be on the request's host")
+		}
+	} else if !strings.HasPrefix(target, "/") {
+		return errors.New("http: push target must be an absolute path")
+	}
+	scheme := "https"
+	if w.req.TLS == nil {
+		scheme = "http"
+	}
+	path := u.RequestURI()
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: method},
+		{Name: ":scheme", Value: scheme},
+		{Name: ":authority", Value: w.req.Host},
+		{Name: ":path", Value: path},
+	}
+	header := make(Header)
+	for k, vv := range opts.Header {
+		if h2IsConnectionHeader(k) || k == "Host" || k == "Content-Length" {
+			continue
+		}
+		header[k] = append([]string(nil), vv...)
+		for _, v := range vv {
+			fields = append(fields, hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+
+	pst := &h2ServerStream{
+		h2Stream:     h2Stream{remoteClosed: true},
+		sc:           sc,
+		isPush:       true,
+		cancelc:      make(chan struct{}),
+		closeNotifyc: make(chan bool, 1),
+	}
+
+	// The promised stream ID is allocated and sent under wmu, so
+	// that promised IDs reach the client in increasing order.
+	sc.wmu.Lock()
+	sc.mu.Lock()
+	switch {
+	case sc.closed || st.reset || st.localClosed:
+		err = errH2StreamClosed
+	case !sc.pushEnabled || sc.goAwaySent:
+		err = ErrNotSupported
+	case sc.pushStreams >= sc.peerMaxStreams || sc.nextPushID+2 >= 1<<31:
+		err = errors.New("http: too many pushed streams")
+	}
+	if err != nil {
+		sc.mu.Unlock()
+		sc.wmu.Unlock()
+		return err
+	}
+	sc.nextPushID += 2
+	pst.id = sc.nextPushID
+	pst.sendWindow = sc.initialSendWindow
+	sc.streams[pst.id] = pst
+	sc.pushStreams++
+	sc.mu.Unlock()
+	err = sc.fr.WritePushPromise(st.id, pst.id, sc.encodeHeaders(fields))
+	sc.wmu.Unlock()
+	if err != nil {
+		sc.closeStream(pst, err)
+		return err
+	}
+
+	req := &Request{
+		Method:     method,
+		URL:        &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     header,
+		Body:       eofReader,
+		Host:       w.req.Host,
+		RemoteAddr: w.req.RemoteAddr,
+		TLS:        w.req.TLS,
+		RequestURI: path,
+		Cancel:     pst.cancelc,
+	}
+	pst.req = req
+	go sc.runHandler(pst, req)
+	return nil
+}
@@ -0,0 +1,424 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	. "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newH2TLSServer(h Handler) *httptest.Server {
+	ts := httptest.NewUnstartedServer(h)
+	ts.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	ts.StartTLS()
+	return ts
+}
+
+func newH2CServer(h Handler) *httptest.Server {
+	ts := httptest.NewUnstartedServer(h)
+	ts.Config.EnableH2C = true
+	ts.Start()
+	return ts
+}
+
+func TestH2TLSNegotiation(t *testing.T) {
+	defer afterTest(t)
+	var mu sync.Mutex
+	conns := 0
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "%s %s %s", r.Proto, r.TLS.NegotiatedProtocol, r.URL.Path)
+	}))
+	ts.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	ts.Config.ConnState = func(c net.Conn, state ConnState) {
+		if state == StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+	tr := &Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	// The first request dials; the others share its connection,
+	// some of them concurrently.
+	get := func(path string) {
+		res, err := c.Get(ts.URL + path)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer res.Body.Close()
+		if res.Proto != "HTTP/2.0" || res.ProtoMajor != 2 {
+			t.Errorf("%s: response proto = %q", path, res.Proto)
+		}
+		if res.TLS == nil || res.TLS.NegotiatedProtocol != "h2" {
+			t.Errorf("%s: response TLS = %+v", path, res.TLS)
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if want := "HTTP/2.0 h2 " + path; string(b) != want {
+			t.Errorf("%s: body = %q; want %q", path, b, want)
+		}
+	}
+	get("/first")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			get(fmt.Sprintf("/%d", i))
+		}(i)
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Errorf("server saw %d connections; want 1", conns)
+	}
+}
+
+// The Transport falls back to HTTP/1.1 for servers without HTTP/2,
+// and setting NextProtos opts out of it.
+func TestH2Fallback(t *testing.T) {
+	defer afterTest(t)
+	h := HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.Proto)
+	})
+	ts := httptest.NewTLSServer(h)
+	defer ts.Close()
+	ts2 := newH2TLSServer(h)
+	defer ts2.Close()
+
+	tests := []struct {
+		url       string
+		nextProto []string
+	}{
+		{ts.URL, nil},
+		{ts2.URL, []string{"http/1.1"}},
+	}
+	for _, tt := range tests {
+		tr := &Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, NextProtos: tt.nextProto}}
+		res, err := (&Client{Transport: tr}).Get(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		tr.CloseIdleConnections()
+		if res.ProtoMajor != 1 || string(b) != "HTTP/1.1" {
+			t.Errorf("NextProtos %q: got %s, handler saw %q; want HTTP/1.1", tt.nextProto, res.Proto, b)
+		}
+	}
+}
+
+func TestH2CFlowControl(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("request proto = %q", r.Proto)
+		}
+		w.Header().Set("Trailer", "X-Sum")
+		n, err := io.Copy(w, r.Body)
+		if err != nil {
+			t.Errorf("copying body: %v", err)
+		}
+		w.Header().Set("X-Sum", fmt.Sprint(n))
+	}))
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+
+	// The body is larger than all the flow control windows, so
+	// both sides have to wait for WINDOW_UPDATE frames.
+	body := bytes.Repeat([]byte("0123456789abcdef"), 3<<20/16)
+	req, _ := NewRequest("POST", ts.URL, ioutil.NopCloser(bytes.NewReader(body)))
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.ProtoMajor != 2 {
+		t.Fatalf("response proto = %q", res.Proto)
+	}
+	got, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("echoed %d bytes; want %d matching bytes", len(got), len(body))
+	}
+	if want := fmt.Sprint(len(body)); res.Trailer.Get("X-Sum") != want {
+		t.Errorf("trailer X-Sum = %q; want %q", res.Trailer.Get("X-Sum"), want)
+	}
+}
+
+func TestH2CGzip(t *testing.T) {
+	defer afterTest(t)
+	const msg = "hello, compressed world"
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Accept-Encoding = %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, msg)
+		gz.Close()
+	}))
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || string(b) != msg {
+		t.Errorf("body = %q, %v; want %q", b, err, msg)
+	}
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Content-Encoding = %q; want it removed", res.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestH2CCancelRequest(t *testing.T) {
+	defer afterTest(t)
+	gone := make(chan bool, 1)
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteHeader(200)
+		w.(Flusher).Flush()
+		select {
+		case <-w.(CloseNotifier).CloseNotify():
+			gone <- true
+		case <-time.After(5 * time.Second):
+			gone <- false
+		}
+	}))
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+
+	cancel := make(chan struct{})
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Cancel = cancel
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(cancel)
+	if _, err := ioutil.ReadAll(res.Body); err == nil {
+		t.Error("reading canceled body succeeded")
+	}
+	res.Body.Close()
+	if !<-gone {
+		t.Error("handler wasn't notified of the canceled stream")
+	}
+
+	// The connection is still usable.
+	res, err = (&Client{Transport: tr}).Get(ts.URL + "/again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	<-gone
+}
+
+func TestH2CShutdown(t *testing.T) {
+	defer afterTest(t)
+	started := make(chan bool)
+	release := make(chan bool)
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/slow" {
+			started <- true
+			<-release
+		}
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result)
+	go func() {
+		res, err := c.Get(ts.URL + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		slow <- result{string(b), err}
+	}()
+	<-started
+	shutdown := make(chan error)
+	go func() { shutdown <- ts.Config.Shutdown(5 * time.Second) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if r := <-slow; r.err != nil || r.body != "/slow" {
+		t.Errorf("in-flight request = %q, %v; want it to finish", r.body, r.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	if res, err := c.Get(ts.URL + "/after"); err == nil {
+		res.Body.Close()
+		t.Error("request after Shutdown succeeded")
+	}
+}
+
+func TestH2CServerPushNotSupported(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		p, ok := w.(Pusher)
+		if !ok {
+			t.Fatal("HTTP/2 ResponseWriter isn't a Pusher")
+		}
+		// Our Transport disables push.
+		if err := p.Push("/style.css", nil); err != ErrNotSupported {
+			t.Errorf("Push = %v; want ErrNotSupported", err)
+		}
+	}))
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+// HTTP/1 requests still work on a Server with EnableH2C set.
+func TestH2CServerHTTP1(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	defer ts.Close()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.HasPrefix(string(b), "HTTP/1.") {
+		t.Errorf("handler saw proto %q", b)
+	}
+}
+
+func TestH2CIdleTimeout(t *testing.T) {
+	defer afterTest(t)
+	closed := make(chan bool, 1)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	ts.Config.EnableH2C = true
+	ts.Config.IdleTimeout = 100 * time.Millisecond
+	ts.Config.ConnState = func(c net.Conn, state ConnState) {
+		if state == StateClosed {
+			closed <- true
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.ProtoMajor != 2 {
+		t.Fatalf("response proto = %q", res.Proto)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle HTTP/2 connection wasn't closed")
+	}
+}
+
+// A stream is reset when its handler's write deadline passes.
+func TestH2CWriteDeadline(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.(DeadlineSetter).SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+		w.(Flusher).Flush()
+		select {
+		case <-w.(CloseNotifier).CloseNotify():
+		case <-time.After(5 * time.Second):
+			t.Error("stream wasn't reset at the write deadline")
+		}
+	}))
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if _, err := ioutil.ReadAll(res.Body); err == nil {
+		t.Error("reading the body of a reset stream succeeded")
+	}
+}
+
+// Passing the read deadline only fails reads of the request body;
+// the response is still delivered.
+func TestH2CReadDeadline(t *testing.T) {
+	defer afterTest(t)
+	readErr := make(chan error, 1)
+	ts := newH2CServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.(DeadlineSetter).SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		io.WriteString(w, "foo")
+		w.(Flusher).Flush()
+		_, err := ioutil.ReadAll(r.Body)
+		readErr <- err
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "bar")
+	}))
+	defer ts.Close()
+	tr := &Transport{EnableH2C: true}
+	defer tr.CloseIdleConnections()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req, _ := NewRequest("POST", ts.URL, pr)
+	res, err := (&Client{Transport: tr}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foobar" {
+		t.Errorf("body = %q; want %q", b, "foobar")
+	}
+	err = <-readErr
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("request body read error = %v; want a timeout", err)
+	}
+}
@@ -0,0 +1,779 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/2 client, RFC 7540.
+
+package http
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http/internal/hpack"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// h2ClientMaxStreams bounds the streams a client opens on one
+	// connection before the server's SETTINGS arrive.
+	h2ClientMaxStreams = 100
+
+	// h2MaxRetries bounds how many connections a request tries
+	// when streams are refused before the server processed them.
+	h2MaxRetries = 3
+)
+
+var (
+	// errH2RetryRequest is returned by h2ClientConn.roundTrip when
+	// the request wasn't processed by the server and may be tried
+	// again on another connection.
+	errH2RetryRequest = errors.New("http2: request not processed; retry")
+
+	errH2ClientConnClosed = errors.New("http2: client connection closed")
+	errH2ResponseClosed   = errors.New("http2: response body closed")
+)
+
+// h2ClientConn is the client side of an HTTP/2 connection. Its
+// readLoop goroutine reads and processes frames from the server; any
+// number of goroutines can run requests on it at once.
+type h2ClientConn struct {
+	h2Conn
+	t        *Transport
+	key      connectMethodKey // of the Transport's pool
+	tlsState *tls.ConnectionState
+	dec      *hpack.Decoder // only used by readLoop
+
+	// The following are guarded by mu.
+	streams       map[uint32]*h2ClientStream
+	nextStreamID  uint32
+	maxStreams    uint32 // peer's SETTINGS_MAX_CONCURRENT_STREAMS
+	goAway        *h2Frame
+	closeWhenIdle bool
+	idleTimer     *time.Timer // closes cc after Transport.IdleConnTimeout without streams
+}
+
+// h2ClientStream is a single request-response exchange on an
+// h2ClientConn.
+type h2ClientStream struct {
+	h2Stream
+	cc        *h2ClientConn
+	req       *Request
+	addedGzip bool
+	resc      chan responseAndError // buffered; receives the response or an error
+	body      *h2Pipe               // response body
+
+	// The following are guarded by cc.mu.
+	gotResponse bool
+	bodyStarted bool // the request body may have been read, so it can't be retried
+	done        chan struct{}
+
+	// The following are only used by readLoop.
+	sawFirstByte bool // any HEADERS frame, even for a 1xx response, was received
+	pastHeaders  bool // the final response's HEADERS frame was received
+	resp         *Response
+}
+
+// newH2ClientConn starts speaking HTTP/2 on nc, which the Transport
+// dialed for key, and completed the TLS handshake on if applicable.
+func (t *Transport) newH2ClientConn(nc net.Conn, tlsState *tls.ConnectionState, key connectMethodKey) (*h2ClientConn, error) {
+	cc := &h2ClientConn{
+		t:            t,
+		key:          key,
+		tlsState:     tlsState,
+		dec:          hpack.NewDecoder(hpack.DefaultTableSize),
+		streams:      make(map[uint32]*h2ClientStream),
+		nextStreamID: 1,
+		maxStreams:   h2ClientMaxStreams,
+	}
+	cc.init(nc, nc, cc.streamList)
+	cc.dec.SetMaxStringLength(DefaultMaxHeaderBytes)
+
+	cc.wmu.Lock()
+	_, err := io.WriteString(nc, h2ClientPreface)
+	if err == nil {
+		err = cc.fr.WriteSettings(
+			h2Setting{h2SettingEnablePush, 0},
+			h2Setting{h2SettingInitialWindowSize, h2StreamRecvWindow},
+		)
+	}
+	if err == nil {
+		err = cc.fr.WriteWindowUpdate(0, h2ConnRecvWindow-h2InitialWindowSize)
+	}
+	cc.wmu.Unlock()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	go cc.readLoop()
+	return cc, nil
+}
+
+func (cc *h2ClientConn) streamList() []*h2Stream {
+	list := make([]*h2Stream, 0, len(cc.streams))
+	for _, cs := range cc.streams {
+		list = append(list, &cs.h2Stream)
+	}
+	return list
+}
+
+// canTakeNewRequest reports whether a new stream can be opened on cc.
+func (cc *h2ClientConn) canTakeNewRequest() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.canTakeNewRequestLocked()
+}
+
+func (cc *h2ClientConn) canTakeNewRequestLocked() bool {
+	return !cc.closed && !cc.closeWhenIdle && cc.goAway == nil &&
+		uint32(len(cc.streams)) < cc.maxStreams && cc.nextStreamID < 1<<31
+}
+
+// isDead reports whether cc can never take another request.
+func (cc *h2ClientConn) isDead() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.closed || cc.closeWhenIdle || cc.goAway != nil || cc.nextStreamID >= 1<<31
+}
+
+// closeIfIdle closes cc once it has no streams in flight. It takes
+// no new requests after the call.
+func (cc *h2ClientConn) closeIfIdle() {
+	cc.mu.Lock()
+	cc.closeWhenIdle = true
+	idle := len(cc.streams) == 0
+	cc.mu.Unlock()
+	if idle {
+		cc.nc.Close()
+	}
+}
+
+// closeIfStillIdle closes cc when the idle timer has fired, unless
+// cc was used again in the meantime.
+func (cc *h2ClientConn) closeIfStillIdle(timer *time.Timer) {
+	cc.mu.Lock()
+	idle := cc.idleTimer == timer && len(cc.streams) == 0
+	if idle {
+		cc.closeWhenIdle = true
+	}
+	cc.mu.Unlock()
+	if idle {
+		cc.nc.Close()
+	}
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (cc *h2ClientConn) RoundTrip(req *Request) (*Response, error) {
+	treq := &transportRequest{Request: req}
+	treq.cancel, treq.stop = requestCancelChan(req)
+	return cc.roundTrip(treq)
+}
+
+func (cc *h2ClientConn) roundTrip(treq *transportRequest) (*Response, error) {
+	req := treq.Request
+	hasBody := req.Body != nil
+	cs := &h2ClientStream{
+		cc:   cc,
+		req:  req,
+		resc: make(chan responseAndError, 1),
+		done: make(chan struct{}),
+	}
+	cs.addedGzip = !cc.t.DisableCompression &&
+		req.Header.Get("Accept-Encoding") == "" &&
+		req.Header.Get("Range") == "" &&
+		req.Method != "HEAD"
+	fields := cc.requestFields(req, cs.addedGzip)
+
+	// Stream IDs must be used in increasing order, so the ID is
+	// allocated with wmu held until the HEADERS frame is written.
+	cc.wmu.Lock()
+	cc.mu.Lock()
+	if !cc.canTakeNewRequestLocked() {
+		cc.mu.Unlock()
+		cc.wmu.Unlock()
+		return nil, errH2RetryRequest
+	}
+	cs.id = cc.nextStreamID
+	cc.nextStreamID += 2
+	if cc.idleTimer != nil {
+		cc.idleTimer.Stop()
+		cc.idleTimer = nil
+	}
+	cs.sendWindow = cc.initialSendWindow
+	cs.recvWindow = h2StreamRecvWindow
+	cs.localClosed = !hasBody
+	cs.bodyStarted = hasBody
+	cc.streams[cs.id] = cs
+	cc.mu.Unlock()
+	err := cc.fr.WriteHeaders(cs.id, !hasBody, cc.encodeHeaders(fields))
+	cc.wmu.Unlock()
+	trace := req.Trace
+	if trace != nil {
+		if err == nil && trace.WroteHeaders != nil {
+			trace.WroteHeaders()
+		}
+		if (err != nil || !hasBody) && trace.WroteRequest != nil {
+			trace.WroteRequest(WroteRequestInfo{Err: err})
+		}
+	}
+	if err != nil {
+		treq.stop()
+		req.closeBody()
+		cc.closeStream(cs, err)
+		return nil, err
+	}
+	cc.t.setReqCanceler(req, func() { cs.abort(errRequestCanceled) })
+
+	var bodyc chan error
+	var respHeaderTimer <-chan time.Time
+	if hasBody {
+		bodyc = make(chan error, 1)
+		go func() {
+			err := cs.writeBody()
+			if trace != nil && trace.WroteRequest != nil {
+				trace.WroteRequest(WroteRequestInfo{Err: err})
+			}
+			bodyc <- err
+		}()
+	} else if d := cc.t.ResponseHeaderTimeout; d > 0 {
+		respHeaderTimer = time.After(d)
+	}
+	for {
+		select {
+		case re := <-cs.resc:
+			if re.err != nil {
+				cc.t.setReqCanceler(req, nil)
+				treq.stop()
+				return nil, re.err
+			}
+			go cs.awaitDone(treq)
+			return re.res, nil
+		case err := <-bodyc:
+			bodyc = nil
+			if err != nil {
+				cs.abort(err)
+			} else if d := cc.t.ResponseHeaderTimeout; d > 0 {
+				respHeaderTimer = time.After(d)
+			}
+		case <-respHeaderTimer:
+			cs.abort(errTimeout)
+		case <-treq.cancel:
+			cs.abort(canceledError(req))
+		}
+	}
+}
+
+// awaitDone aborts cs if its request is canceled before the
+// response body is done, and cleans up after it.
+func (cs *h2ClientStream) awaitDone(treq *transportRequest) {
+	select {
+	case <-cs.done:
+	case <-treq.cancel:
+		cs.abort(canceledError(treq.Request))
+	}
+	cs.cc.t.setReqCanceler(treq.Request, nil)
+	treq.stop()
+}
+
+// requestFields returns the header fields of req.
+func (cc *h2ClientConn) requestFields(req *Request, addedGzip bool) []hpack.HeaderField {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fields := []hpack.HeaderField{
+		{Name: ":authority", Value: host},
+		{Name: ":method", Value: valueOrDefault(req.Method, "GET")},
+	}
+	if req.Method != "CONNECT" {
+		fields = append(fields,
+			hpack.HeaderField{Name: ":path", Value: req.URL.RequestURI()},
+			hpack.HeaderField{Name: ":scheme", Value: req.URL.Scheme},
+		)
+	}
+	for k, vv := range req.Header {
+		if h2IsConnectionHeader(k) || k == "Host" || k == "Content-Length" || k == "Trailer" {
+			continue
+		}
+		name := strings.ToLower(k)
+		if name == "te" {
+			continue
+		}
+		for _, v := range vv {
+			fields = append(fields, hpack.HeaderField{Name: name, Value: v})
+		}
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		fields = append(fields, hpack.HeaderField{Name: "user-agent", Value: defaultUserAgent})
+	}
+	if addedGzip {
+		fields = append(fields, hpack.HeaderField{Name: "accept-encoding", Value: "gzip"})
+	}
+	if req.ContentLength > 0 {
+		fields = append(fields, hpack.HeaderField{Name: "content-length", Value: strconv.FormatInt(req.ContentLength, 10)})
+	}
+	if len(req.Trailer) > 0 {
+		var keys []string
+		for k := range req.Trailer {
+			keys = append(keys, k)
+		}
+		fields = append(fields, hpack.HeaderField{Name: "trailer", Value: strings.Join(keys, ",")})
+	}
+	return fields
+}
+
+// writeBody sends the request body and trailers, ending the stream.
+func (cs *h2ClientStream) writeBody() (err error) {
+	cc, req := cs.cc, cs.req
+	defer req.closeBody()
+	buf := make([]byte, 16<<10)
+	var sent int64
+	for {
+		n, rerr := req.Body.Read(buf)
+		if n > 0 {
+			sent += int64(n)
+			if req.ContentLength > 0 && sent > req.ContentLength {
+				return errors.New("http: ContentLength=" + strconv.FormatInt(req.ContentLength, 10) +
+					" with Body length " + strconv.FormatInt(sent, 10))
+			}
+			if err := cc.writeData(&cs.h2Stream, buf[:n], false); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	if req.ContentLength > 0 && sent != req.ContentLength {
+		return errors.New("http: ContentLength=" + strconv.FormatInt(req.ContentLength, 10) +
+			" with Body length " + strconv.FormatInt(sent, 10))
+	}
+	var trailers []hpack.HeaderField
+	for k, vv := range req.Trailer {
+		for _, v := range vv {
+			trailers = append(trailers, hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	if len(trailers) > 0 {
+		return cc.writeHeaders(&cs.h2Stream, true, trailers)
+	}
+	return cc.writeData(&cs.h2Stream, nil, true)
+}
+
+// abort resets cs, unless it's already done, and fails the request
+// or its response body with err.
+func (cs *h2ClientStream) abort(err error) {
+	cc := cs.cc
+	cc.mu.Lock()
+	done := cc.streams[cs.id] != cs
+	cc.mu.Unlock()
+	if done {
+		return
+	}
+	cc.writeRSTStream(&cs.h2Stream, h2ErrCodeCancel)
+	cc.closeStream(cs, err)
+}
+
+// closeStream removes cs from the connection. A nil err means the
+// exchange completed normally. Otherwise err is reported to the
+// caller waiting for the response or reading its body.
+func (cc *h2ClientConn) closeStream(cs *h2ClientStream, err error) {
+	cc.mu.Lock()
+	if cc.streams[cs.id] != cs {
+		cc.mu.Unlock()
+		return
+	}
+	delete(cc.streams, cs.id)
+	close(cs.done)
+	if err != nil {
+		cs.reset = true
+		cs.localClosed = true
+		if !cs.gotResponse {
+			cs.gotResponse = true
+			cs.resc <- responseAndError{err: err}
+		}
+	}
+	closeConn := cc.closeWhenIdle && len(cc.streams) == 0
+	if d := cc.t.IdleConnTimeout; d > 0 && len(cc.streams) == 0 && !cc.closed {
+		var timer *time.Timer
+		timer = time.AfterFunc(d, func() { cc.closeIfStillIdle(timer) })
+		cc.idleTimer = timer
+	}
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+
+	if err != nil && cs.body != nil {
+		if n := cs.body.Break(err); n > 0 {
+			cc.returnCredit(nil, n)
+		}
+	}
+	if closeConn {
+		cc.nc.Close()
+	}
+}
+
+// maybeFinishStream closes cs if both endpoints are done sending.
+func (cc *h2ClientConn) maybeFinishStream(cs *h2ClientStream) {
+	cc.mu.Lock()
+	done := cs.localClosed && cs.remoteClosed
+	cc.mu.Unlock()
+	if done {
+		cc.closeStream(cs, nil)
+	}
+}
+
+func (cc *h2ClientConn) readLoop() {
+	var err error
+	for {
+		var f *h2Frame
+		f, err = cc.fr.ReadFrame()
+		if err == nil {
+			err = cc.processFrame(f)
+		}
+		if se, ok := err.(h2StreamError); ok {
+			cc.mu.Lock()
+			cs := cc.streams[se.StreamID]
+			cc.mu.Unlock()
+			if cs != nil {
+				cc.writeRSTStream(&cs.h2Stream, se.Code)
+				cc.closeStream(cs, se)
+			}
+			continue
+		}
+		if ce, ok := err.(h2ConnError); ok {
+			cc.wmu.Lock()
+			cc.fr.WriteGoAway(0, ce.Code, ce.Reason)
+			cc.wmu.Unlock()
+		}
+		if err != nil {
+			break
+		}
+	}
+	cc.nc.Close()
+
+	cc.mu.Lock()
+	cc.closed = true
+	if ga := cc.goAway; ga != nil && ga.ErrCode != h2ErrCodeNo {
+		err = h2GoAwayError{ga.LastStreamID, ga.ErrCode, string(ga.Data)}
+	} else if err == io.EOF {
+		err = errH2ClientConnClosed
+	}
+	var open []*h2ClientStream
+	for _, cs := range cc.streams {
+		open = append(open, cs)
+	}
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+	for _, cs := range open {
+		cc.closeStream(cs, err)
+	}
+	cc.t.releaseConnSlot(cc.key)
+}
+
+func (cc *h2ClientConn) processFrame(f *h2Frame) error {
+	switch f.Type {
+	case h2FrameSettings:
+		if f.Flags.has(h2FlagAck) {
+			return nil
+		}
+		for _, s := range f.Settings {
+			if err := cc.applySetting(s); err != nil {
+				return err
+			}
+			if s.ID == h2SettingMaxConcurrentStreams {
+				cc.mu.Lock()
+				cc.maxStreams = s.Val
+				cc.cond.Broadcast()
+				cc.mu.Unlock()
+			}
+		}
+		cc.wmu.Lock()
+		defer cc.wmu.Unlock()
+		return cc.fr.WriteSettingsAck()
+	case h2FrameHeaders:
+		return cc.processHeaders(f)
+	case h2FrameData:
+		return cc.processData(f)
+	case h2FrameWindowUpdate:
+		var st *h2Stream
+		cc.mu.Lock()
+		if cs := cc.streams[f.StreamID]; cs != nil {
+			st = &cs.h2Stream
+		}
+		cc.mu.Unlock()
+		return cc.processWindowUpdate(f, st)
+	case h2FrameRSTStream:
+		cc.mu.Lock()
+		cs := cc.streams[f.StreamID]
+		if cs == nil {
+			cc.mu.Unlock()
+			return nil
+		}
+		cs.reset = true
+		// The request can be retried elsewhere if the server
+		// refused it before reading any of it.
+		retry := f.ErrCode == h2ErrCodeRefusedStream && !cs.bodyStarted
+		// A server that sent its whole response may stop the
+		// request body with NO_ERROR.
+		finished := f.ErrCode == h2ErrCodeNo && cs.remoteClosed
+		cc.mu.Unlock()
+		var err error = h2StreamError{f.StreamID, f.ErrCode}
+		switch {
+		case retry:
+			err = errH2RetryRequest
+		case finished:
+			err = nil
+		}
+		cc.closeStream(cs, err)
+	case h2FramePing:
+		if f.Flags.has(h2FlagAck) {
+			return nil
+		}
+		var data [8]byte
+		copy(data[:], f.Data)
+		cc.wmu.Lock()
+		defer cc.wmu.Unlock()
+		return cc.fr.WritePing(true, data)
+	case h2FrameGoAway:
+		cc.mu.Lock()
+		cc.goAway = f
+		var unprocessed []*h2ClientStream
+		for id, cs := range cc.streams {
+			if id > f.LastStreamID {
+				unprocessed = append(unprocessed, cs)
+			}
+		}
+		idle := len(cc.streams) == len(unprocessed)
+		cc.mu.Unlock()
+		// Streams the server never saw can be retried on
+		// another connection.
+		for _, cs := range unprocessed {
+			cc.mu.Lock()
+			var err error = errH2RetryRequest
+			if cs.bodyStarted {
+				err = h2GoAwayError{f.LastStreamID, f.ErrCode, string(f.Data)}
+			}
+			cc.mu.Unlock()
+			cc.closeStream(cs, err)
+		}
+		if idle {
+			cc.nc.Close()
+		}
+	case h2FramePushPromise:
+		// We disabled push in our SETTINGS.
+		return h2ConnError{h2ErrCodeProtocol, "PUSH_PROMISE with push disabled"}
+	}
+	return nil
+}
+
+func (cc *h2ClientConn) processHeaders(f *h2Frame) error {
+	fields, err := cc.dec.Decode(f.Data)
+	if err != nil {
+		return h2ConnError{h2ErrCodeCompression, err.Error()}
+	}
+	cc.mu.Lock()
+	cs := cc.streams[f.StreamID]
+	if cs == nil && f.StreamID >= cc.nextStreamID {
+		cc.mu.Unlock()
+		return h2ConnError{h2ErrCodeProtocol, "HEADERS on idle stream"}
+	}
+	cc.mu.Unlock()
+	if cs == nil {
+		return nil // a stream we already reset
+	}
+	endStream := f.Flags.has(h2FlagEndStream)
+	if cs.pastHeaders {
+		return cc.processTrailers(cs, fields, endStream)
+	}
+	if !cs.sawFirstByte {
+		cs.sawFirstByte = true
+		if trace := cs.req.Trace; trace != nil && trace.GotFirstResponseByte != nil {
+			trace.GotFirstResponseByte()
+		}
+	}
+
+	var status string
+	header := make(Header)
+	for _, hf := range fields {
+		if strings.HasPrefix(hf.Name, ":") {
+			if hf.Name != ":status" || status != "" {
+				return h2StreamError{cs.id, h2ErrCodeProtocol}
+			}
+			status = hf.Value
+			continue
+		}
+		if !h2ValidHeaderName(hf.Name) {
+			return h2StreamError{cs.id, h2ErrCodeProtocol}
+		}
+		key := CanonicalHeaderKey(hf.Name)
+		header[key] = append(header[key], hf.Value)
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 999 {
+		return h2StreamError{cs.id, h2ErrCodeProtocol}
+	}
+	if code < 200 {
+		// Informational responses, such as 100 Continue, are
+		// followed by the real one.
+		return nil
+	}
+	cs.pastHeaders = true
+
+	resp := &Response{
+		Status:        status + " " + StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        header,
+		ContentLength: -1,
+		Request:       cs.req,
+		TLS:           cc.tlsState,
+	}
+	if cl := header.get("Content-Length"); cl != "" {
+		if n, err := parseContentLength(cl); err == nil {
+			resp.ContentLength = n
+		}
+	}
+	for _, v := range header["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			if key = CanonicalHeaderKey(strings.TrimSpace(key)); key != "" {
+				if resp.Trailer == nil {
+					resp.Trailer = make(Header)
+				}
+				resp.Trailer[key] = nil
+			}
+		}
+	}
+	cs.resp = resp
+
+	if endStream || cs.req.Method == "HEAD" {
+		if endStream {
+			resp.ContentLength = 0
+		}
+		resp.Body = eofReader
+	} else {
+		cs.body = newH2Pipe(func(n int) { cc.returnCredit(&cs.h2Stream, n) })
+		resp.Body = &h2ResponseBody{cs: cs}
+		if cs.addedGzip && resp.Header.Get("Content-Encoding") == "gzip" {
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+			resp.ContentLength = -1
+			resp.Body = &gzipReader{body: resp.Body}
+		}
+	}
+
+	cc.mu.Lock()
+	sent := cs.gotResponse
+	cs.gotResponse = true
+	if endStream {
+		cs.remoteClosed = true
+	}
+	cc.mu.Unlock()
+	if !sent {
+		cs.resc <- responseAndError{res: resp}
+	}
+	if endStream {
+		cc.maybeFinishStream(cs)
+	}
+	return nil
+}
+
+// processTrailers records the response trailers of cs, which end its
+// body.
+func (cc *h2ClientConn) processTrailers(cs *h2ClientStream, fields []hpack.HeaderField, endStream bool) error {
+	if !endStream {
+		return h2StreamError{cs.id, h2ErrCodeProtocol}
+	}
+	for _, hf := range fields {
+		if strings.HasPrefix(hf.Name, ":") {
+			return h2StreamError{cs.id, h2ErrCodeProtocol}
+		}
+		key := CanonicalHeaderKey(hf.Name)
+		if _, declared := cs.resp.Trailer[key]; declared {
+			cs.resp.Trailer[key] = append(cs.resp.Trailer[key], hf.Value)
+		}
+	}
+	cc.mu.Lock()
+	cs.remoteClosed = true
+	cc.mu.Unlock()
+	if cs.body != nil {
+		cs.body.CloseWithError(io.EOF)
+	}
+	cc.maybeFinishStream(cs)
+	return nil
+}
+
+func (cc *h2ClientConn) processData(f *h2Frame) error {
+	cc.mu.Lock()
+	cs := cc.streams[f.StreamID]
+	if cs == nil && f.StreamID >= cc.nextStreamID {
+		cc.mu.Unlock()
+		return h2ConnError{h2ErrCodeProtocol, "DATA on idle stream"}
+	}
+	cc.mu.Unlock()
+	if cs == nil || cs.body == nil {
+		// A stream we reset or a response without a body;
+		// the data still counts against the connection window.
+		if f.Length > 0 {
+			cc.returnCredit(nil, int(f.Length))
+		}
+		if cs != nil {
+			return h2StreamError{cs.id, h2ErrCodeProtocol}
+		}
+		return nil
+	}
+	if err := cc.takeRecvData(&cs.h2Stream, f.Length); err != nil {
+		return err
+	}
+	endStream := f.Flags.has(h2FlagEndStream)
+	if endStream {
+		cc.mu.Lock()
+		cs.remoteClosed = true
+		cc.mu.Unlock()
+	}
+	if pad := int(f.Length) - len(f.Data); pad > 0 {
+		cc.returnCredit(&cs.h2Stream, pad)
+	}
+	if len(f.Data) > 0 && !cs.body.Write(f.Data) {
+		cc.returnCredit(&cs.h2Stream, len(f.Data))
+	}
+	if endStream {
+		cs.body.CloseWithError(io.EOF)
+		cc.maybeFinishStream(cs)
+	}
+	return nil
+}
+
+// h2ResponseBody is the Body of a Response received over HTTP/2.
+type h2ResponseBody struct {
+	cs     *h2ClientStream
+	closed bool
+}
+
+func (b *h2ResponseBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errH2ResponseClosed
+	}
+	return b.cs.body.Read(p)
+}
+
+// Close discards the rest of the body, resetting the stream if the
+// server is still sending it.
+func (b *h2ResponseBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	cs := b.cs
+	if n := cs.body.Break(errH2ResponseClosed); n > 0 {
+		cs.cc.returnCredit(nil, n)
+	}
+	cs.abort(errH2ResponseClosed)
+	return nil
+}
@@ -0,0 +1,320 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Recording and replaying of HTTP exchanges.
+
+package httptest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// An Exchange is an HTTP request and the response it received, as
+// captured by a RecordingTransport or read by ReadExchanges.
+//
+// The Body fields of Request and Response are nil; the bodies are
+// held in RequestBody and ResponseBody instead.
+type Exchange struct {
+	Request      *http.Request
+	RequestBody  []byte
+	Response     *http.Response
+	ResponseBody []byte
+}
+
+// newResponse returns a copy of x's response for req, reading from
+// a fresh copy of its body.
+func (x *Exchange) newResponse(req *http.Request) *http.Response {
+	res := new(http.Response)
+	*res = *x.Response
+	res.Header = cloneHeader(x.Response.Header)
+	res.Body = ioutil.NopCloser(bytes.NewReader(x.ResponseBody))
+	res.Request = req
+	return res
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, vv := range h {
+		h2[k] = append([]string(nil), vv...)
+	}
+	return h2
+}
+
+// readBody reads and closes body, which may be nil.
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// A RecordingTransport is an http.RoundTripper that sends requests
+// through another RoundTripper and records each exchange, so that it
+// can be saved with WriteExchanges and replayed by a ReplayTransport.
+//
+// Request and response bodies are read in full before RoundTrip
+// returns, so a RecordingTransport is unsuited to streaming
+// responses. Requests that fail with an error are not recorded.
+type RecordingTransport struct {
+	// Transport is the RoundTripper used to make requests.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	mu        sync.Mutex
+	exchanges []*Exchange
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	reqBody, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	outreq := new(http.Request)
+	*outreq = *req
+	if req.Body != nil {
+		outreq.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	res, err := transport.RoundTrip(outreq)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readBody(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &Exchange{
+		Request:      new(http.Request),
+		RequestBody:  reqBody,
+		Response:     new(http.Response),
+		ResponseBody: resBody,
+	}
+	*x.Request = *req
+	u := *req.URL
+	x.Request.URL = &u
+	x.Request.Header = cloneHeader(req.Header)
+	x.Request.Body = nil
+	x.Request.Trace = nil
+	x.Request.Cancel = nil
+	*x.Response = *res
+	x.Response.Header = cloneHeader(res.Header)
+	x.Response.Body = nil
+	x.Response.Request = x.Request
+	t.mu.Lock()
+	t.exchanges = append(t.exchanges, x)
+	t.mu.Unlock()
+
+	return x.newResponse(req), nil
+}
+
+// Exchanges returns the exchanges recorded so far, in the order
+// their responses arrived.
+func (t *RecordingTransport) Exchanges() []*Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Exchange(nil), t.exchanges...)
+}
+
+// WriteExchanges writes xs to w in HTTP/1.1 wire format: each
+// request, with an absolute URL in its request line, followed by its
+// response. Bodies are written with a Content-Length rather than
+// chunked, and header fields are sorted, so the output is stable
+// and can be read back by ReadExchanges.
+func WriteExchanges(w io.Writer, xs []*Exchange) error {
+	bw := bufio.NewWriter(w)
+	for _, x := range xs {
+		req := new(http.Request)
+		*req = *x.Request
+		req.Header = cloneHeader(x.Request.Header)
+		if _, ok := req.Header["User-Agent"]; !ok {
+			// Don't let Request.Write add its default.
+			req.Header["User-Agent"] = []string{""}
+		}
+		req.Body = nil
+		req.ContentLength = int64(len(x.RequestBody))
+		if len(x.RequestBody) > 0 {
+			req.Body = ioutil.NopCloser(bytes.NewReader(x.RequestBody))
+		}
+		req.TransferEncoding = nil
+		req.Trailer = nil
+		req.Trace = nil
+		if err := req.WriteProxy(bw); err != nil {
+			return err
+		}
+
+		res := new(http.Response)
+		*res = *x.Response
+		res.Request = req
+		res.Body = nil
+		if req.Method != "HEAD" {
+			res.ContentLength = int64(len(x.ResponseBody))
+			if len(x.ResponseBody) > 0 {
+				res.Body = ioutil.NopCloser(bytes.NewReader(x.ResponseBody))
+			}
+		}
+		res.TransferEncoding = nil
+		res.Trailer = nil
+		if err := res.Write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadExchanges reads the exchanges written by WriteExchanges from r.
+func ReadExchanges(r io.Reader) ([]*Exchange, error) {
+	br := bufio.NewReader(r)
+	var xs []*Exchange
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return xs, nil
+		}
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return nil, fmt.Errorf("httptest: reading request of exchange %d: %v", len(xs), err)
+		}
+		reqBody, err := readBody(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("httptest: reading request body of exchange %d: %v", len(xs), err)
+		}
+		req.Body = nil
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, fmt.Errorf("httptest: reading response of exchange %d: %v", len(xs), err)
+		}
+		resBody, err := readBody(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("httptest: reading response body of exchange %d: %v", len(xs), err)
+		}
+		res.Body = nil
+		xs = append(xs, &Exchange{
+			Request:      req,
+			RequestBody:  reqBody,
+			Response:     res,
+			ResponseBody: resBody,
+		})
+	}
+}
+
+// A ReplayTransport is an http.RoundTripper that answers requests
+// with the responses of recorded exchanges, without using the
+// network.
+//
+// By default a request matches an exchange if their methods, URLs
+// and bodies are equal, along with the headers named in
+// MatchHeaders. Each exchange is replayed once, in recording order,
+// so repeated requests get successive responses; once all matching
+// exchanges have been used, the last of them is replayed again.
+//
+// Requests that match no exchange fail, and are reported by
+// Unmatched.
+type ReplayTransport struct {
+	// MatchHeaders lists request header fields whose values must
+	// be equal for a request to match an exchange.
+	MatchHeaders []string
+
+	// IgnoreBody makes requests match exchanges regardless of
+	// their bodies.
+	IgnoreBody bool
+
+	// Match optionally replaces the default matching. It reports
+	// whether req, whose body has been read into body, matches x.
+	Match func(req *http.Request, body []byte, x *Exchange) bool
+
+	mu        sync.Mutex
+	exchanges []*Exchange
+	used      []bool
+	unmatched []*http.Request
+}
+
+// NewReplayTransport returns a ReplayTransport that replays xs.
+func NewReplayTransport(xs []*Exchange) *ReplayTransport {
+	return &ReplayTransport{
+		exchanges: xs,
+		used:      make([]bool, len(xs)),
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last := -1
+	for i, x := range t.exchanges {
+		if !t.matches(req, body, x) {
+			continue
+		}
+		last = i
+		if !t.used[i] {
+			break
+		}
+	}
+	if last < 0 {
+		t.unmatched = append(t.unmatched, req)
+		return nil, fmt.Errorf("httptest: no recorded exchange matches %s %s", req.Method, req.URL)
+	}
+	t.used[last] = true
+	return t.exchanges[last].newResponse(req), nil
+}
+
+func (t *ReplayTransport) matches(req *http.Request, body []byte, x *Exchange) bool {
+	if t.Match != nil {
+		return t.Match(req, body, x)
+	}
+	if req.Method != x.Request.Method || req.URL.String() != x.Request.URL.String() {
+		return false
+	}
+	if !t.IgnoreBody && !bytes.Equal(body, x.RequestBody) {
+		return false
+	}
+	for _, name := range t.MatchHeaders {
+		name = http.CanonicalHeaderKey(name)
+		v1, v2 := req.Header[name], x.Request.Header[name]
+		if len(v1) != len(v2) {
+			return false
+		}
+		for i := range v1 {
+			if v1[i] != v2[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Unmatched returns the requests that matched no recorded exchange.
+func (t *ReplayTransport) Unmatched() []*http.Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*http.Request(nil), t.unmatched...)
+}
+
+// Unused returns the exchanges that haven't been replayed.
+func (t *ReplayTransport) Unused() []*Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var xs []*Exchange
+	for i, x := range t.exchanges {
+		if !t.used[i] {
+			xs = append(xs, x)
+		}
+	}
+	return xs
+}
@@ -0,0 +1,154 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// record makes some requests to a test server through a
+// RecordingTransport and returns the saved exchanges and the URL
+// they were made to.
+func record(t *testing.T) ([]byte, string) {
+	hits := 0
+	ts := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Hit", fmt.Sprint(hits))
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.URL.Path, r.Header.Get("X-Lang"), body)
+	}))
+	defer ts.Close()
+
+	rt := &RecordingTransport{}
+	c := &http.Client{Transport: rt}
+	get := func(path, lang string) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		if lang != "" {
+			req.Header.Set("X-Lang", lang)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	get("/a", "en")
+	get("/a", "fr")
+	get("/missing", "")
+	res, err := c.Post(ts.URL+"/form", "text/plain", strings.NewReader("x=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(res.Body); string(b) != "POST /form  x=1" {
+		t.Errorf("recorded request got body %q", b)
+	}
+	res.Body.Close()
+
+	xs := rt.Exchanges()
+	if len(xs) != 4 {
+		t.Fatalf("recorded %d exchanges; want 4", len(xs))
+	}
+	var buf bytes.Buffer
+	if err := WriteExchanges(&buf, xs); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), ts.URL
+}
+
+func TestExchangesRoundTrip(t *testing.T) {
+	saved, _ := record(t)
+	xs, err := ReadExchanges(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xs) != 4 {
+		t.Fatalf("read %d exchanges; want 4", len(xs))
+	}
+	if x := xs[3]; x.Request.Method != "POST" || string(x.RequestBody) != "x=1" || string(x.ResponseBody) != "POST /form  x=1" {
+		t.Errorf("last exchange = %s %q -> %q", x.Request.Method, x.RequestBody, x.ResponseBody)
+	}
+	if x := xs[2]; x.Response.StatusCode != 404 {
+		t.Errorf("status of /missing = %d; want 404", x.Response.StatusCode)
+	}
+
+	// Writing what was read gives the same bytes.
+	var buf bytes.Buffer
+	if err := WriteExchanges(&buf, xs); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), saved) {
+		t.Errorf("rewritten exchanges differ:\n%s\nwant:\n%s", buf.Bytes(), saved)
+	}
+}
+
+func TestReplayTransport(t *testing.T) {
+	saved, url := record(t) // the server is gone now
+	xs, err := ReadExchanges(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := NewReplayTransport(xs)
+	rt.MatchHeaders = []string{"X-Lang"}
+	c := &http.Client{Transport: rt}
+
+	get := func(path, lang string) (string, error) {
+		req, _ := http.NewRequest("GET", url+path, nil)
+		if lang != "" {
+			req.Header.Set("X-Lang", lang)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		return res.Header.Get("X-Hit") + " " + string(b), err
+	}
+	tests := []struct {
+		path, lang, want string
+	}{
+		{"/a", "fr", "2 GET /a fr "},
+		{"/a", "en", "1 GET /a en "},
+		{"/a", "en", "1 GET /a en "}, // used up; replayed again
+	}
+	for _, tt := range tests {
+		if got, err := get(tt.path, tt.lang); err != nil || got != tt.want {
+			t.Errorf("GET %s (%s) = %q, %v; want %q", tt.path, tt.lang, got, err, tt.want)
+		}
+	}
+	if _, err := get("/a", "de"); err == nil {
+		t.Error("request with unrecorded header value succeeded")
+	}
+	res, err := c.Post(url+"/form", "text/plain", strings.NewReader("x=2"))
+	if err == nil {
+		res.Body.Close()
+		t.Error("request with unrecorded body succeeded")
+	}
+
+	unmatched := rt.Unmatched()
+	if len(unmatched) != 2 || unmatched[0].Header.Get("X-Lang") != "de" || unmatched[1].Method != "POST" {
+		t.Errorf("Unmatched = %v; want the de GET and the POST", unmatched)
+	}
+	unused := rt.Unused()
+	if len(unused) != 2 || unused[0].Request.URL.Path != "/missing" || unused[1].Request.URL.Path != "/form" {
+		t.Errorf("Unused = %v; want /missing and /form", unused)
+	}
+
+	rt.IgnoreBody = true
+	res, err = c.Post(url+"/form", "text/plain", strings.NewReader("x=2"))
+	if err != nil {
+		t.Fatalf("POST with IgnoreBody: %v", err)
+	}
+	res.Body.Close()
+}
@@ -7,6 +7,8 @@
 package httputil
 
 import (
+	"bufio"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -46,6 +48,36 @@ type ReverseProxy struct {
 	// If nil, logging goes to os.Stderr via the log package's
 	// standard logger.
 	ErrorLog *log.Logger
+
+	// BufferPool optionally specifies a buffer pool to
+	// get byte slices for use by io.Copy-like operations
+	// when copying response bodies.
+	BufferPool BufferPool
+
+	// ModifyResponse is an optional function that modifies the
+	// Response from the backend. It is called if the backend
+	// returns a response at all, with any HTTP status code,
+	// after hop-by-hop headers have been removed.
+	//
+	// If ModifyResponse returns an error, ErrorHandler is called
+	// with its error value and the backend response is discarded.
+	ModifyResponse func(*http.Response) error
+
+	// ErrorHandler is an optional function that handles errors
+	// reaching the backend or errors from ModifyResponse. The
+	// request passed to it is the outgoing request, as modified
+	// by Director.
+	//
+	// If nil, the default is to log the provided error and
+	// return a 500 Internal Server Error response.
+	ErrorHandler func(http.ResponseWriter, *http.Request, error)
+}
+
+// A BufferPool is an interface for getting and returning temporary
+// byte slices for use when copying response bodies.
+type BufferPool interface {
+	Get() []byte
+	Put([]byte)
 }
 
 func singleJoiningSlash(a, b string) string {
@@ -100,6 +132,19 @@ var hopHeaders = []string{
 	"Upgrade",
 }
 
+// upgradeType returns the protocol requested by h's Upgrade header,
+// or "" if its Connection header doesn't ask for an upgrade.
+func upgradeType(h http.Header) string {
+	for _, v := range h["Connection"] {
+		for _, tok := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(tok), "upgrade") {
+				return h.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
 func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	transport := p.Transport
 	if transport == nil {
@@ -132,6 +177,14 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// The Connection and Upgrade headers are hop-by-hop, but an
+	// upgrade request such as a WebSocket handshake has to reach
+	// the backend for the connection to be tunneled through.
+	if up := upgradeType(req.Header); up != "" {
+		outreq.Header.Set("Connection", "Upgrade")
+		outreq.Header.Set("Upgrade", up)
+	}
+
 	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
 		// If we aren't the first proxy retain prior
 		// X-Forwarded-For information as a comma+space
@@ -144,22 +197,113 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	res, err := transport.RoundTrip(outreq)
 	if err != nil {
-		p.logf("http: proxy error: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		p.handleError(rw, outreq, err)
+		return
+	}
+
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		if p.modifyResponse(rw, outreq, res) {
+			p.handleUpgradeResponse(rw, outreq, res)
+		}
 		return
 	}
-	defer res.Body.Close()
 
 	for _, h := range hopHeaders {
 		res.Header.Del(h)
 	}
 
+	if !p.modifyResponse(rw, outreq, res) {
+		return
+	}
+	defer res.Body.Close()
+
 	copyHeader(rw.Header(), res.Header)
 
 	rw.WriteHeader(res.StatusCode)
 	p.copyResponse(rw, res.Body)
 }
 
+func (p *ReverseProxy) handleError(rw http.ResponseWriter, req *http.Request, err error) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(rw, req, err)
+		return
+	}
+	p.logf("http: proxy error: %v", err)
+	rw.WriteHeader(http.StatusInternalServerError)
+}
+
+// modifyResponse runs ModifyResponse on res, if set. It reports
+// whether the caller should proceed with res; if not, res's body has
+// been closed and the error handled.
+func (p *ReverseProxy) modifyResponse(rw http.ResponseWriter, req *http.Request, res *http.Response) bool {
+	if p.ModifyResponse == nil {
+		return true
+	}
+	if err := p.ModifyResponse(res); err != nil {
+		res.Body.Close()
+		p.handleError(rw, req, err)
+		return false
+	}
+	return true
+}
+
+// handleUpgradeResponse completes a protocol switch accepted by the
+// backend, then copies data both ways between the client and backend
+// connections until either side is done.
+func (p *ReverseProxy) handleUpgradeResponse(rw http.ResponseWriter, req *http.Request, res *http.Response) {
+	backConn, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		res.Body.Close()
+		p.handleError(rw, req, fmt.Errorf("internal error: 101 switching protocols response with non-writable body"))
+		return
+	}
+	defer backConn.Close()
+
+	if reqUp, resUp := upgradeType(req.Header), upgradeType(res.Header); !strings.EqualFold(reqUp, resUp) {
+		p.handleError(rw, req, fmt.Errorf("backend tried to switch protocol %q when %q was requested", resUp, reqUp))
+		return
+	}
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		p.handleError(rw, req, fmt.Errorf("can't switch protocols using non-Hijacker ResponseWriter type %T", rw))
+		return
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		p.handleError(rw, req, fmt.Errorf("hijack failed on protocol switch: %v", err))
+		return
+	}
+	defer conn.Close()
+
+	copyHeader(res.Header, rw.Header())
+	if err := writeSwitchingProtocols(brw.Writer, res); err != nil {
+		p.logf("http: proxy error: response write: %v", err)
+		return
+	}
+
+	errc := make(chan error, 2)
+	go p.tunnel(backConn, brw.Reader, errc)
+	go p.tunnel(conn, backConn, errc)
+	<-errc
+}
+
+// writeSwitchingProtocols writes res's status line and header to w.
+// Unlike res.Write, it doesn't describe a body: the connection
+// carries the new protocol right after the header.
+func writeSwitchingProtocols(w *bufio.Writer, res *http.Response) error {
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", res.StatusCode, http.StatusText(res.StatusCode))
+	if err := res.Header.Write(w); err != nil {
+		return err
+	}
+	w.WriteString("\r\n")
+	return w.Flush()
+}
+
+func (p *ReverseProxy) tunnel(dst io.Writer, src io.Reader, errc chan<- error) {
+	_, err := p.copyBuffer(dst, src)
+	errc <- err
+}
+
 func (p *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
 	if p.FlushInterval != 0 {
 		if wf, ok := dst.(writeFlusher); ok {
@@ -174,7 +318,38 @@ func (p *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
 		}
 	}
 
-	io.Copy(dst, src)
+	p.copyBuffer(dst, src)
+}
+
+func (p *ReverseProxy) copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	var buf []byte
+	if p.BufferPool != nil {
+		buf = p.BufferPool.Get()
+		defer p.BufferPool.Put(buf)
+	}
+	if len(buf) == 0 {
+		buf = make([]byte, 32*1024)
+	}
+	var written int64
+	for {
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr != nil {
+			if rerr == io.EOF {
+				rerr = nil
+			}
+			return written, rerr
+		}
+	}
 }
 
 func (p *ReverseProxy) logf(format string, args ...interface{}) {
@@ -7,7 +7,11 @@
 package httputil
 
 import (
+	"bufio"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -211,3 +215,174 @@ func TestReverseProxyFlushInterval(t *testing.T) {
 		t.Error("maxLatencyWriter flushLoop() never exited")
 	}
 }
+
+func TestReverseProxyModifyResponse(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Hit", r.URL.Path)
+		io.WriteString(w, "backend")
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	proxyHandler := NewSingleHostReverseProxy(backendURL)
+	proxyHandler.ModifyResponse = func(res *http.Response) error {
+		if res.Header.Get("X-Hit") == "/fail" {
+			return errors.New("rejected")
+		}
+		res.Header.Set("X-Modified", "true")
+		return nil
+	}
+	var handledErr error
+	proxyHandler.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handledErr = err
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	frontend := httptest.NewServer(proxyHandler)
+	defer frontend.Close()
+
+	res, err := http.Get(frontend.URL + "/ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Header.Get("X-Modified") != "true" {
+		t.Errorf("response header = %v; want X-Modified set", res.Header)
+	}
+
+	res, err = http.Get(frontend.URL + "/fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway || handledErr == nil || handledErr.Error() != "rejected" {
+		t.Errorf("got status %d, handled error %v; want 502 after ModifyResponse error", res.StatusCode, handledErr)
+	}
+}
+
+func TestReverseProxyErrorHandler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // nothing listens on addr now
+
+	proxyHandler := NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: addr})
+	var gotHost string
+	proxyHandler.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		gotHost = r.URL.Host
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	frontend := httptest.NewServer(proxyHandler)
+	defer frontend.Close()
+
+	res, err := http.Get(frontend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want 503 from ErrorHandler", res.StatusCode)
+	}
+	if gotHost != addr {
+		t.Errorf("ErrorHandler got request for host %q; want the outgoing request for %q", gotHost, addr)
+	}
+}
+
+type countingPool struct {
+	gets, puts int
+}
+
+func (p *countingPool) Get() []byte { p.gets++; return make([]byte, 16) }
+func (p *countingPool) Put([]byte)  { p.puts++ }
+
+func TestReverseProxyBufferPool(t *testing.T) {
+	const body = "a body longer than the sixteen byte pooled buffer"
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	proxyHandler := NewSingleHostReverseProxy(backendURL)
+	pool := new(countingPool)
+	proxyHandler.BufferPool = pool
+	frontend := httptest.NewServer(proxyHandler)
+	defer frontend.Close()
+
+	res, err := http.Get(frontend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != body {
+		t.Errorf("body = %q; want %q", b, body)
+	}
+	if pool.gets != 1 || pool.puts != 1 {
+		t.Errorf("pool saw %d gets and %d puts; want 1 of each", pool.gets, pool.puts)
+	}
+}
+
+func TestReverseProxyUpgrade(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Connection") != "Upgrade" || r.Header.Get("Upgrade") != "websocket" {
+			t.Errorf("backend got Connection %q, Upgrade %q", r.Header.Get("Connection"), r.Header.Get("Upgrade"))
+			http.Error(w, "no upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		brw.Flush()
+		// Echo lines, upper-cased, until the client hangs up.
+		for {
+			line, err := brw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			brw.WriteString(strings.ToUpper(line))
+			brw.Flush()
+		}
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	proxyHandler := NewSingleHostReverseProxy(backendURL)
+	proxyHandler.ModifyResponse = func(res *http.Response) error {
+		res.Header.Set("X-Modified", "true")
+		return nil
+	}
+	frontend := httptest.NewServer(proxyHandler)
+	defer frontend.Close()
+
+	c, err := net.Dial("tcp", frontend.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n\r\n")
+	br := bufio.NewReader(c)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Upgrade") != "websocket" {
+		t.Fatalf("got status %d, header %v; want a switch to websocket", res.StatusCode, res.Header)
+	}
+	if res.Header.Get("X-Modified") != "true" {
+		t.Errorf("ModifyResponse wasn't applied to the 101 response: %v", res.Header)
+	}
+	if cl := res.Header.Get("Content-Length"); cl != "" {
+		t.Errorf("101 response has Content-Length %q", cl)
+	}
+	for _, msg := range []string{"hello\n", "again\n"} {
+		io.WriteString(c, msg)
+		got, err := br.ReadString('\n')
+		if err != nil || got != strings.ToUpper(msg) {
+			t.Fatalf("echo of %q = %q, %v", msg, got, err)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hpack implements HPACK, the header compression format for
+// HTTP/2 defined in RFC 7541.
+package hpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A HeaderField is a name-value pair. Both the name and value are
+// treated as opaque sequences of octets.
+type HeaderField struct {
+	Name, Value string
+
+	// Sensitive means that this header field should never be
+	// indexed by an encoder or an intermediary.
+	Sensitive bool
+}
+
+func (hf HeaderField) String() string {
+	var suffix string
+	if hf.Sensitive {
+		suffix = " (sensitive)"
+	}
+	return fmt.Sprintf("header field %q = %q%s", hf.Name, hf.Value, suffix)
+}
+
+// Size returns the size of an entry per RFC 7541 section 4.1.
+func (hf HeaderField) Size() uint32 {
+	return uint32(len(hf.Name) + len(hf.Value) + 32)
+}
+
+// DefaultTableSize is the initial size of the dynamic table of both
+// peers, per RFC 7540 section 6.5.2.
+const DefaultTableSize = 4096
+
+// A DecodingError is something the spec defines as a decoding error.
+type DecodingError struct {
+	Err error
+}
+
+func (de DecodingError) Error() string {
+	return fmt.Sprintf("decoding error: %v", de.Err)
+}
+
+// An InvalidIndexError is returned when a header block refers to
+// an index outside of the static and dynamic tables.
+type InvalidIndexError int
+
+func (e InvalidIndexError) Error() string {
+	return fmt.Sprintf("invalid indexed representation index %d", int(e))
+}
+
+var (
+	errVarintOverflow = DecodingError{errors.New("varint integer overflow")}
+	errNeedMore       = DecodingError{errors.New("truncated header block")}
+	errStringLength   = DecodingError{errors.New("string literal too long")}
+	errLateSizeUpdate = DecodingError{errors.New("dynamic table size update not at start of header block")}
+)
+
+// A dynamicTable is the table of header fields shared by an encoder
+// and its decoder. Entries are stored oldest first.
+type dynamicTable struct {
+	ents    []HeaderField
+	size    uint32
+	maxSize uint32
+}
+
+func (dt *dynamicTable) setMaxSize(v uint32) {
+	dt.maxSize = v
+	dt.evict()
+}
+
+func (dt *dynamicTable) add(f HeaderField) {
+	dt.ents = append(dt.ents, f)
+	dt.size += f.Size()
+	dt.evict()
+}
+
+// evict removes the oldest entries until the table fits in maxSize.
+func (dt *dynamicTable) evict() {
+	n := 0
+	for dt.size > dt.maxSize && n < len(dt.ents) {
+		dt.size -= dt.ents[n].Size()
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	copy(dt.ents, dt.ents[n:])
+	for i := len(dt.ents) - n; i < len(dt.ents); i++ {
+		dt.ents[i] = HeaderField{} // so strings can be garbage collected
+	}
+	dt.ents = dt.ents[:len(dt.ents)-n]
+}
+
+// at returns the entry at the 1-based index i of the combined static
+// and dynamic table address space (RFC 7541 section 2.3.3).
+func (dt *dynamicTable) at(i uint64) (HeaderField, bool) {
+	if i == 0 {
+		return HeaderField{}, false
+	}
+	if i <= uint64(len(staticTable)) {
+		return staticTable[i-1], true
+	}
+	i -= uint64(len(staticTable))
+	if i > uint64(len(dt.ents)) {
+		return HeaderField{}, false
+	}
+	return dt.ents[len(dt.ents)-int(i)], true
+}
+
+// search looks for f in the static and dynamic tables. It returns the
+// index of an exact match if there is one, and otherwise the index of
+// an entry with the same name, or 0.
+func (dt *dynamicTable) search(f HeaderField) (i uint64, nameValueMatch bool) {
+	for j, hf := range staticTable {
+		if hf.Name != f.Name {
+			continue
+		}
+		if i == 0 {
+			i = uint64(j + 1)
+		}
+		if !f.Sensitive && hf.Value == f.Value {
+			return uint64(j + 1), true
+		}
+	}
+	for j := len(dt.ents) - 1; j >= 0; j-- {
+		hf := dt.ents[j]
+		if hf.Name != f.Name {
+			continue
+		}
+		idx := uint64(len(staticTable) + len(dt.ents) - j)
+		if i == 0 {
+			i = idx
+		}
+		if !f.Sensitive && hf.Value == f.Value {
+			return idx, true
+		}
+	}
+	return i, false
+}
+
+// A Decoder decodes header blocks. It keeps the dynamic table state
+// between calls to Decode, so a connection must use one Decoder for
+// all the header blocks it receives, in order.
+type Decoder struct {
+	dt dynamicTable
+
+	// maxAllowed is the largest dynamic table size the encoder
+	// may ask for; it's the SETTINGS_HEADER_TABLE_SIZE we sent.
+	maxAllowed uint32
+
+	maxStrLen int // 0 means unlimited
+}
+
+// NewDecoder returns a new decoder whose dynamic table may grow up to
+// maxDynamicTableSize bytes.
+func NewDecoder(maxDynamicTableSize uint32) *Decoder {
+	d := &Decoder{maxAllowed: maxDynamicTableSize}
+	d.dt.maxSize = maxDynamicTableSize
+	return d
+}
+
+// SetAllowedMaxDynamicTableSize sets the upper bound that the encoded
+// stream may set the dynamic table size to.
+func (d *Decoder) SetAllowedMaxDynamicTableSize(v uint32) {
+	d.maxAllowed = v
+}
+
+// SetMaxStringLength sets the maximum size of a Name or Value string
+// in a HeaderField. Zero means unlimited.
+func (d *Decoder) SetMaxStringLength(n int) {
+	d.maxStrLen = n
+}
+
+// Decode decodes a complete header block, such as the concatenated
+// fragments of a HEADERS frame and its CONTINUATION frames, and
+// returns its fields in order.
+func (d *Decoder) Decode(p []byte) ([]HeaderField, error) {
+	var hf []HeaderField
+	first := true
+	for len(p) > 0 {
+		b := p[0]
+		var (
+			f   HeaderField
+			err error
+		)
+		switch {
+		case b&0x80 != 0: // indexed header field, section 6.1
+			var i uint64
+			if i, p, err = readVarInt(7, p); err != nil {
+				return nil, err
+			}
+			var ok bool
+			if f, ok = d.dt.at(i); !ok {
+				return nil, DecodingError{InvalidIndexError(i)}
+			}
+			f.Sensitive = false
+		case b&0xc0 == 0x40: // literal with incremental indexing, 6.2.1
+			if f, p, err = d.readLiteral(6, p); err != nil {
+				return nil, err
+			}
+			d.dt.add(f)
+		case b&0xe0 == 0x20: // dynamic table size update, 6.3
+			if !first {
+				return nil, errLateSizeUpdate
+			}
+			var size uint64
+			if size, p, err = readVarInt(5, p); err != nil {
+				return nil, err
+			}
+			if size > uint64(d.maxAllowed) {
+				return nil, DecodingError{errors.New("dynamic table size update too large")}
+			}
+			d.dt.setMaxSize(uint32(size))
+			continue
+		case b&0xf0 == 0x10: // literal never indexed, 6.2.3
+			if f, p, err = d.readLiteral(4, p); err != nil {
+				return nil, err
+			}
+			f.Sensitive = true
+		default: // literal without indexing, 6.2.2
+			if f, p, err = d.readLiteral(4, p); err != nil {
+				return nil, err
+			}
+		}
+		first = false
+		hf = append(hf, f)
+	}
+	return hf, nil
+}
+
+// readLiteral reads a literal header field representation whose
+// name index has an n-bit prefix.
+func (d *Decoder) readLiteral(n byte, p []byte) (f HeaderField, rest []byte, err error) {
+	idx, p, err := readVarInt(n, p)
+	if err != nil {
+		return f, nil, err
+	}
+	if idx > 0 {
+		ent, ok := d.dt.at(idx)
+		if !ok {
+			return f, nil, DecodingError{InvalidIndexError(idx)}
+		}
+		f.Name = ent.Name
+	} else if f.Name, p, err = d.readString(p); err != nil {
+		return f, nil, err
+	}
+	if f.Value, p, err = d.readString(p); err != nil {
+		return f, nil, err
+	}
+	return f, p, nil
+}
+
+// readString reads a string literal, section 5.2.
+func (d *Decoder) readString(p []byte) (s string, rest []byte, err error) {
+	if len(p) == 0 {
+		return "", nil, errNeedMore
+	}
+	isHuff := p[0]&0x80 != 0
+	strLen, p, err := readVarInt(7, p)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(p)) < strLen {
+		return "", nil, errNeedMore
+	}
+	if d.maxStrLen != 0 && strLen > uint64(d.maxStrLen) {
+		return "", nil, errStringLength
+	}
+	if !isHuff {
+		return string(p[:strLen]), p[strLen:], nil
+	}
+	buf, err := huffmanDecode(nil, d.maxStrLen, p[:strLen])
+	if err != nil {
+		return "", nil, err
+	}
+	return string(buf), p[strLen:], nil
+}
+
+// readVarInt reads an unsigned variable length integer off the
+// beginning of p, using an n-bit prefix (section 5.1).
+func readVarInt(n byte, p []byte) (i uint64, rest []byte, err error) {
+	if len(p) == 0 {
+		return 0, nil, errNeedMore
+	}
+	i = uint64(p[0])
+	if n < 8 {
+		i &= (1 << uint64(n)) - 1
+	}
+	if i < (1<<uint64(n))-1 {
+		return i, p[1:], nil
+	}
+	origP := p
+	p = p[1:]
+	var m uint64
+	for len(p) > 0 {
+		b := p[0]
+		p = p[1:]
+		i += uint64(b&127) << m
+		if b&128 == 0 {
+			return i, p, nil
+		}
+		m += 7
+		if m >= 63 {
+			return 0, origP, errVarintOverflow
+		}
+	}
+	return 0, origP, errNeedMore
+}
+
+// appendVarInt appends i, encoded as a variable length integer with
+// an n-bit prefix, to dst.
+func appendVarInt(dst []byte, n byte, i uint64) []byte {
+	k := uint64((1 << n) - 1)
+	if i < k {
+		return append(dst, byte(i))
+	}
+	dst = append(dst, byte(k))
+	i -= k
+	for ; i >= 128; i >>= 7 {
+		dst = append(dst, byte(0x80|(i&0x7f)))
+	}
+	return append(dst, byte(i))
+}
+
+// An Encoder encodes header fields, writing each one to its Writer as
+// it's added. Like a Decoder, an Encoder keeps dynamic table state, so
+// a connection must use one Encoder for all the header blocks it
+// sends.
+type Encoder struct {
+	dt dynamicTable
+	w  io.Writer
+	// minSize is the smallest dynamic table size set since the
+	// last header block, which must be signaled to the decoder
+	// along with the final size (RFC 7541 section 4.2).
+	minSize         uint32
+	maxSizeLimit    uint32 // SETTINGS_HEADER_TABLE_SIZE of the peer
+	tableSizeUpdate bool
+	buf             []byte
+}
+
+// NewEncoder returns a new Encoder which writes to w. The dynamic
+// table starts out at DefaultTableSize.
+func NewEncoder(w io.Writer) *Encoder {
+	e := &Encoder{
+		w:            w,
+		minSize:      ^uint32(0),
+		maxSizeLimit: DefaultTableSize,
+	}
+	e.dt.maxSize = DefaultTableSize
+	return e
+}
+
+// WriteField encodes f into a single Write to e's underlying Writer.
+// Fields which are not Sensitive are added to the dynamic table.
+func (e *Encoder) WriteField(f HeaderField) error {
+	e.buf = e.buf[:0]
+	if e.tableSizeUpdate {
+		e.tableSizeUpdate = false
+		if e.minSize < e.dt.maxSize {
+			e.buf = appendTableSize(e.buf, e.minSize)
+		}
+		e.minSize = ^uint32(0)
+		e.buf = appendTableSize(e.buf, e.dt.maxSize)
+	}
+	idx, nameValueMatch := e.dt.search(f)
+	switch {
+	case nameValueMatch:
+		first := len(e.buf)
+		e.buf = appendVarInt(e.buf, 7, idx)
+		e.buf[first] |= 0x80
+	case f.Sensitive:
+		e.buf = appendLiteral(e.buf, 0x10, 4, idx, f)
+	default:
+		e.buf = appendLiteral(e.buf, 0x40, 6, idx, f)
+		e.dt.add(f)
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// SetMaxDynamicTableSize changes the dynamic table size to v. The
+// actual size is bounded by the value set by
+// SetMaxDynamicTableSizeLimit.
+func (e *Encoder) SetMaxDynamicTableSize(v uint32) {
+	if v > e.maxSizeLimit {
+		v = e.maxSizeLimit
+	}
+	if v < e.minSize {
+		e.minSize = v
+	}
+	e.tableSizeUpdate = true
+	e.dt.setMaxSize(v)
+}
+
+// SetMaxDynamicTableSizeLimit changes the upper bound of the dynamic
+// table size to v, which is typically the peer's
+// SETTINGS_HEADER_TABLE_SIZE. The table shrinks if needed.
+func (e *Encoder) SetMaxDynamicTableSizeLimit(v uint32) {
+	e.maxSizeLimit = v
+	if e.dt.maxSize > v {
+		e.SetMaxDynamicTableSize(v)
+	}
+}
+
+func appendTableSize(dst []byte, v uint32) []byte {
+	first := len(dst)
+	dst = appendVarInt(dst, 5, uint64(v))
+	dst[first] |= 0x20
+	return dst
+}
+
+// appendLiteral appends a literal representation of f. pattern is
+// the representation's leading bits and n the size of the name index
+// prefix; idx is the index of f's name, or 0 to send it literally.
+func appendLiteral(dst []byte, pattern, n byte, idx uint64, f HeaderField) []byte {
+	first := len(dst)
+	dst = appendVarInt(dst, n, idx)
+	dst[first] |= pattern
+	if idx == 0 {
+		dst = appendString(dst, f.Name)
+	}
+	return appendString(dst, f.Value)
+}
+
+// appendString appends s as a string literal, Huffman encoded if
+// that is shorter.
+func appendString(dst []byte, s string) []byte {
+	huffLen := huffmanEncodeLength(s)
+	if huffLen < uint64(len(s)) {
+		first := len(dst)
+		dst = appendVarInt(dst, 7, huffLen)
+		dst[first] |= 0x80
+		return huffmanEncode(dst, s)
+	}
+	dst = appendVarInt(dst, 7, uint64(len(s)))
+	return append(dst, s...)
+}
@@ -0,0 +1,303 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func dehex(s string) []byte {
+	s = strings.Replace(s, " ", "", -1)
+	s = strings.Replace(s, "\n", "", -1)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+type encAndWant struct {
+	enc  []byte
+	want []HeaderField
+	// wantDynTab is the dynamic table after decoding, newest first.
+	wantDynTab []HeaderField
+	wantSize   uint32
+}
+
+func pair(name, value string) HeaderField {
+	return HeaderField{Name: name, Value: value}
+}
+
+// RFC 7541 Appendix C.3: requests without Huffman coding.
+var requestsNoHuffman = []encAndWant{
+	{
+		dehex("8286 8441 0f77 7777 2e65 7861 6d70 6c65 2e63 6f6d"),
+		[]HeaderField{
+			pair(":method", "GET"),
+			pair(":scheme", "http"),
+			pair(":path", "/"),
+			pair(":authority", "www.example.com"),
+		},
+		[]HeaderField{pair(":authority", "www.example.com")},
+		57,
+	},
+	{
+		dehex("8286 84be 5808 6e6f 2d63 6163 6865"),
+		[]HeaderField{
+			pair(":method", "GET"),
+			pair(":scheme", "http"),
+			pair(":path", "/"),
+			pair(":authority", "www.example.com"),
+			pair("cache-control", "no-cache"),
+		},
+		[]HeaderField{
+			pair("cache-control", "no-cache"),
+			pair(":authority", "www.example.com"),
+		},
+		110,
+	},
+	{
+		dehex("8287 85bf 400a 6375 7374 6f6d 2d6b 6579 0c63 7573 746f 6d2d 7661 6c75 65"),
+		[]HeaderField{
+			pair(":method", "GET"),
+			pair(":scheme", "https"),
+			pair(":path", "/index.html"),
+			pair(":authority", "www.example.com"),
+			pair("custom-key", "custom-value"),
+		},
+		[]HeaderField{
+			pair("custom-key", "custom-value"),
+			pair("cache-control", "no-cache"),
+			pair(":authority", "www.example.com"),
+		},
+		164,
+	},
+}
+
+// RFC 7541 Appendix C.4: requests with Huffman coding.
+var requestsHuffman = []encAndWant{
+	{
+		dehex("8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff"),
+		requestsNoHuffman[0].want,
+		requestsNoHuffman[0].wantDynTab,
+		57,
+	},
+	{
+		dehex("8286 84be 5886 a8eb 1064 9cbf"),
+		requestsNoHuffman[1].want,
+		requestsNoHuffman[1].wantDynTab,
+		110,
+	},
+	{
+		dehex("8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf"),
+		requestsNoHuffman[2].want,
+		requestsNoHuffman[2].wantDynTab,
+		164,
+	},
+}
+
+// RFC 7541 Appendix C.6: responses with Huffman coding and a
+// 256 byte dynamic table, which forces evictions.
+var responsesHuffman = []encAndWant{
+	{
+		dehex(`
+4882 6402 5885 aec3 771a 4b61 96d0 7abe
+9410 54d4 44a8 2005 9504 0b81 66e0 82a6
+2d1b ff6e 919d 29ad 1718 63c7 8f0b 97c8
+e9ae 82ae 43d3`),
+		[]HeaderField{
+			pair(":status", "302"),
+			pair("cache-control", "private"),
+			pair("date", "Mon, 21 Oct 2013 20:13:21 GMT"),
+			pair("location", "https://www.example.com"),
+		},
+		[]HeaderField{
+			pair("location", "https://www.example.com"),
+			pair("date", "Mon, 21 Oct 2013 20:13:21 GMT"),
+			pair("cache-control", "private"),
+			pair(":status", "302"),
+		},
+		222,
+	},
+	{
+		dehex("4883 640e ffc1 c0bf"),
+		[]HeaderField{
+			pair(":status", "307"),
+			pair("cache-control", "private"),
+			pair("date", "Mon, 21 Oct 2013 20:13:21 GMT"),
+			pair("location", "https://www.example.com"),
+		},
+		[]HeaderField{
+			pair(":status", "307"),
+			pair("location", "https://www.example.com"),
+			pair("date", "Mon, 21 Oct 2013 20:13:21 GMT"),
+			pair("cache-control", "private"),
+		},
+		222,
+	},
+	{
+		dehex(`
+88c1 6196 d07a be94 1054 d444 a820 0595
+040b 8166 e084 a62d 1bff c05a 839b d9ab
+77ad 94e7 821d d7f2 e6c7 b335 dfdf cd5b
+3960 d5af 2708 7f36 72c1 ab27 0fb5 291f
+9587 3160 65c0 03ed 4ee5 b106 3d50 07`),
+		[]HeaderField{
+			pair(":status", "200"),
+			pair("cache-control", "private"),
+			pair("date", "Mon, 21 Oct 2013 20:13:22 GMT"),
+			pair("location", "https://www.example.com"),
+			pair("content-encoding", "gzip"),
+			pair("set-cookie", "foo=ASDJKHQKBZXOQWEOPIUAXQWEOIU; max-age=3600; version=1"),
+		},
+		[]HeaderField{
+			pair("set-cookie", "foo=ASDJKHQKBZXOQWEOPIUAXQWEOIU; max-age=3600; version=1"),
+			pair("content-encoding", "gzip"),
+			pair("date", "Mon, 21 Oct 2013 20:13:22 GMT"),
+		},
+		215,
+	},
+}
+
+// dynTab returns d's dynamic table, newest first.
+func (d *Decoder) dynTab() []HeaderField {
+	var hf []HeaderField
+	for i := len(d.dt.ents) - 1; i >= 0; i-- {
+		hf = append(hf, d.dt.ents[i])
+	}
+	return hf
+}
+
+func testDecodeSeries(t *testing.T, name string, size uint32, steps []encAndWant) {
+	d := NewDecoder(size)
+	for i, st := range steps {
+		got, err := d.Decode(st.enc)
+		if err != nil {
+			t.Fatalf("%s: step %d: Decode error: %v", name, i, err)
+		}
+		if !reflect.DeepEqual(got, st.want) {
+			t.Errorf("%s: step %d: fields =\n%v\nwant\n%v", name, i, got, st.want)
+		}
+		if tab := d.dynTab(); !reflect.DeepEqual(tab, st.wantDynTab) {
+			t.Errorf("%s: step %d: dynamic table =\n%v\nwant\n%v", name, i, tab, st.wantDynTab)
+		}
+		if d.dt.size != st.wantSize {
+			t.Errorf("%s: step %d: table size = %d; want %d", name, i, d.dt.size, st.wantSize)
+		}
+	}
+}
+
+func TestDecodeRFCExamples(t *testing.T) {
+	testDecodeSeries(t, "C.3", DefaultTableSize, requestsNoHuffman)
+	testDecodeSeries(t, "C.4", DefaultTableSize, requestsHuffman)
+	testDecodeSeries(t, "C.6", 256, responsesHuffman)
+}
+
+func TestEncodeRFCExamples(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for i, st := range requestsHuffman {
+		buf.Reset()
+		for _, f := range st.want {
+			if err := e.WriteField(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(buf.Bytes(), st.enc) {
+			t.Errorf("step %d: encoded %x; want %x", i, buf.Bytes(), st.enc)
+		}
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	fields := []HeaderField{
+		pair(":method", "POST"),
+		pair("content-type", "application/json"),
+		{Name: "authorization", Value: "secret", Sensitive: true},
+		pair("x-long", strings.Repeat("abc~\x00\xff", 100)),
+		pair("content-type", "application/json"),
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetMaxDynamicTableSize(100)
+	d := NewDecoder(DefaultTableSize)
+	for round := 0; round < 3; round++ {
+		buf.Reset()
+		for _, f := range fields {
+			if err := e.WriteField(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := d.Decode(buf.Bytes())
+		if err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		if !reflect.DeepEqual(got, fields) {
+			t.Fatalf("round %d: got %v; want %v", round, got, fields)
+		}
+		if d.dt.maxSize != 100 {
+			t.Errorf("round %d: decoder table max size = %d; want 100", round, d.dt.maxSize)
+		}
+	}
+	for _, f := range d.dt.ents {
+		if f.Name == "authorization" {
+			t.Errorf("sensitive field was indexed")
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"index zero", dehex("80")},
+		{"index past tables", dehex("ff00")},
+		{"truncated string", dehex("4005 6162")},
+		{"varint overflow", dehex("ff ffffffffffffffffff01")},
+		{"late size update", dehex("82 20")},
+		{"size update too large", dehex("3fe1 7f")},
+		{"huffman EOS", dehex("0082 ffff 0161")},
+		{"huffman long padding", dehex("0081 ff 0161")},
+	}
+	for _, tt := range tests {
+		d := NewDecoder(DefaultTableSize)
+		if _, err := d.Decode(tt.in); err == nil {
+			t.Errorf("%s: Decode(%x) succeeded; want error", tt.name, tt.in)
+		}
+	}
+}
+
+func TestDecodeMaxStringLength(t *testing.T) {
+	d := NewDecoder(DefaultTableSize)
+	d.SetMaxStringLength(3)
+	if _, err := d.Decode(dehex("0003 616263 0161")); err != nil {
+		t.Fatalf("short strings: %v", err)
+	}
+	if _, err := d.Decode(dehex("0004 61626364 0161")); err != errStringLength {
+		t.Errorf("long string: err = %v; want %v", err, errStringLength)
+	}
+}
+
+func TestHuffmanRoundTrip(t *testing.T) {
+	var all []byte
+	for i := 0; i < 256; i++ {
+		all = append(all, byte(i))
+	}
+	for _, s := range []string{"", "a", "www.example.com", "no-cache", string(all)} {
+		enc := huffmanEncode(nil, s)
+		if uint64(len(enc)) != huffmanEncodeLength(s) {
+			t.Errorf("huffmanEncodeLength(%q) = %d; encoded to %d bytes", s, huffmanEncodeLength(s), len(enc))
+		}
+		dec, err := huffmanDecode(nil, 0, enc)
+		if err != nil || string(dec) != s {
+			t.Errorf("huffman round trip of %q = %q, %v", s, dec, err)
+		}
+	}
+}
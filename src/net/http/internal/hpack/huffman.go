@@ -0,0 +1,112 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpack
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrInvalidHuffman is returned for errors found decoding
+// Huffman-encoded strings.
+var ErrInvalidHuffman = errors.New("hpack: invalid Huffman-encoded data")
+
+// A huffNode is a node of the binary tree used to decode the
+// canonical Huffman code of RFC 7541 Appendix B.
+type huffNode struct {
+	child [2]*huffNode
+	leaf  bool
+	sym   byte
+}
+
+var (
+	huffRootOnce sync.Once
+	huffRoot     *huffNode
+)
+
+func buildHuffmanTree() {
+	huffRoot = new(huffNode)
+	for sym, code := range huffmanCodes {
+		n := huffRoot
+		for i := int(huffmanCodeLen[sym]) - 1; i >= 0; i-- {
+			b := (code >> uint(i)) & 1
+			if n.child[b] == nil {
+				n.child[b] = new(huffNode)
+			}
+			n = n.child[b]
+		}
+		n.leaf = true
+		n.sym = byte(sym)
+	}
+}
+
+// huffmanDecode appends the decoding of the Huffman-encoded v to dst.
+// If maxLen is greater than 0, it's an error for the decoded string
+// to be longer than maxLen.
+func huffmanDecode(dst []byte, maxLen int, v []byte) ([]byte, error) {
+	huffRootOnce.Do(buildHuffmanTree)
+	n := huffRoot
+	// depth and ones track the bits read since the last symbol,
+	// so the padding can be validated at the end.
+	depth, ones := 0, true
+	for _, c := range v {
+		for i := 7; i >= 0; i-- {
+			b := (c >> uint(i)) & 1
+			n = n.child[b]
+			if n == nil {
+				// Only the 30-bit EOS symbol isn't in the tree.
+				return nil, ErrInvalidHuffman
+			}
+			depth++
+			ones = ones && b == 1
+			if n.leaf {
+				if maxLen > 0 && len(dst) == maxLen {
+					return nil, errStringLength
+				}
+				dst = append(dst, n.sym)
+				n, depth, ones = huffRoot, 0, true
+			}
+		}
+	}
+	// Padding must be strictly shorter than 8 bits and consist of
+	// the most significant bits of EOS, which are all ones.
+	if depth > 7 || !ones {
+		return nil, ErrInvalidHuffman
+	}
+	return dst, nil
+}
+
+// huffmanEncode appends the Huffman encoding of s to dst.
+func huffmanEncode(dst []byte, s string) []byte {
+	var (
+		x uint64 // pending bits, right aligned
+		n uint   // number of pending bits
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		x = x<<huffmanCodeLen[c] | uint64(huffmanCodes[c])
+		n += uint(huffmanCodeLen[c])
+		for n >= 8 {
+			n -= 8
+			dst = append(dst, byte(x>>n))
+		}
+	}
+	if n > 0 {
+		// Pad with the most significant bits of EOS.
+		x = x<<(8-n) | (1<<(8-n) - 1)
+		dst = append(dst, byte(x))
+	}
+	return dst
+}
+
+// huffmanEncodeLength returns the number of bytes required to encode
+// s in Huffman codes.
+func huffmanEncodeLength(s string) uint64 {
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		n += uint64(huffmanCodeLen[s[i]])
+	}
+	return (n + 7) / 8
+}
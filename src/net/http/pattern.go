@@ -0,0 +1,358 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Patterns for ServeMux routing.
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A muxPattern is a parsed ServeMux pattern, of the form
+//
+//	[METHOD ][HOST]/[PATH]
+//
+// where the path may contain wildcards.
+type muxPattern struct {
+	str    string // original string
+	method string // "" for any method
+	host   string
+	// segments holds the segments of the path after its leading
+	// slash. A path ending in a slash, like "/images/", ends with
+	// an anonymous multi segment.
+	segments []muxSegment
+}
+
+// A muxSegment is a path segment of a pattern: a literal, a single
+// wildcard "{name}", or a multi wildcard "{name...}" matching the
+// rest of the path, which can only be the last segment. The "{$}"
+// wildcard is represented as an empty literal: it matches only the
+// end of a path with a trailing slash.
+type muxSegment struct {
+	s     string // literal or wildcard name
+	wild  bool
+	multi bool
+}
+
+func (p *muxPattern) String() string { return p.str }
+
+func (p *muxPattern) lastSegment() muxSegment {
+	return p.segments[len(p.segments)-1]
+}
+
+// godebugEnv holds GODEBUG. Including httpmuxlegacy=1 in it makes
+// ServeMux parse patterns with their original syntax.
+var godebugEnv = &envOnce{names: []string{"GODEBUG"}}
+
+// muxLegacyPatterns reports whether GODEBUG asks for the original
+// ServeMux pattern syntax.
+func muxLegacyPatterns() bool {
+	for _, kv := range strings.Split(godebugEnv.Get(), ",") {
+		if kv == "httpmuxlegacy=1" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMuxPattern parses s as a ServeMux pattern.
+func parseMuxPattern(s string) (*muxPattern, error) {
+	if len(s) == 0 {
+		return nil, errors.New("empty pattern")
+	}
+	if muxLegacyPatterns() {
+		return parseLegacyMuxPattern(s), nil
+	}
+	p := &muxPattern{str: s}
+	rest := s
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		p.method = rest[:i]
+		rest = strings.TrimLeft(rest[i+1:], " \t")
+		if !validMethod(p.method) {
+			return nil, fmt.Errorf("invalid method %q", p.method)
+		}
+	}
+	i := strings.Index(rest, "/")
+	if i < 0 {
+		return nil, errors.New("host/path missing /")
+	}
+	p.host = rest[:i]
+	rest = rest[i+1:]
+	if strings.Contains(p.host, "{") {
+		return nil, errors.New("host contains '{' (missing initial '/'?)")
+	}
+
+	seen := make(map[string]bool)
+	for {
+		var seg string
+		i := strings.Index(rest, "/")
+		if i < 0 {
+			seg, rest = rest, ""
+		} else {
+			seg, rest = rest[:i], rest[i+1:]
+		}
+		last := i < 0
+		if seg == "" && last {
+			// Trailing slash: match the rest of the path.
+			p.segments = append(p.segments, muxSegment{wild: true, multi: true})
+			break
+		}
+		if !strings.Contains(seg, "{") {
+			p.segments = append(p.segments, muxSegment{s: seg})
+		} else {
+			if seg[0] != '{' || seg[len(seg)-1] != '}' || strings.Count(seg, "{") > 1 {
+				return nil, fmt.Errorf("bad wildcard segment %q (must be entire segment)", seg)
+			}
+			name := seg[1 : len(seg)-1]
+			if name == "$" {
+				if !last {
+					return nil, errors.New("{$} not at end")
+				}
+				p.segments = append(p.segments, muxSegment{s: ""})
+				break
+			}
+			name, multi := strings.TrimSuffix(name, "..."), strings.HasSuffix(name, "...")
+			if multi && !last {
+				return nil, fmt.Errorf("{%s...} wildcard not at end", name)
+			}
+			if !isWildcardName(name) {
+				return nil, fmt.Errorf("bad wildcard name %q", name)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicate wildcard name %q", name)
+			}
+			seen[name] = true
+			p.segments = append(p.segments, muxSegment{s: name, wild: true, multi: multi})
+		}
+		if last {
+			break
+		}
+	}
+	return p, nil
+}
+
+// parseLegacyMuxPattern parses the non-empty s with the original
+// pattern syntax, [HOST]/[PATH], where there are no methods and
+// every path segment is a literal, even if it contains braces or
+// spaces.
+func parseLegacyMuxPattern(s string) *muxPattern {
+	p := &muxPattern{str: s}
+	i := strings.Index(s, "/")
+	if i < 0 {
+		// A pattern with no path never matches.
+		p.host = s
+		return p
+	}
+	p.host = s[:i]
+	segs := strings.Split(s[i+1:], "/")
+	for j, seg := range segs {
+		if seg == "" && j == len(segs)-1 {
+			p.segments = append(p.segments, muxSegment{wild: true, multi: true})
+		} else {
+			p.segments = append(p.segments, muxSegment{s: seg})
+		}
+	}
+	return p
+}
+
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, c := range method {
+		if !isToken(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWildcardName reports whether s is a Go identifier.
+func isWildcardName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPath reports whether the path part of p matches path, which
+// starts with a slash. If so, it returns the values of p's named
+// wildcards in order.
+func (p *muxPattern) matchPath(path string) (values []string, ok bool) {
+	if path == "" || path[0] != '/' {
+		return nil, false
+	}
+	parts := strings.Split(path[1:], "/")
+	for i, seg := range p.segments {
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch {
+		case seg.multi:
+			if seg.s != "" {
+				values = append(values, strings.Join(parts[i:], "/"))
+			}
+			return values, true
+		case seg.wild:
+			if parts[i] == "" {
+				return nil, false
+			}
+			values = append(values, parts[i])
+		case parts[i] != seg.s:
+			return nil, false
+		}
+	}
+	return values, len(parts) == len(p.segments)
+}
+
+// matchesMethod reports whether p applies to requests with the given
+// method. Patterns for GET also match HEAD requests.
+func (p *muxPattern) matchesMethod(method string) bool {
+	return p.method == "" || p.method == method || p.method == "GET" && method == "HEAD"
+}
+
+// exactMatch reports whether p, which matches path, does so without
+// a trailing multi wildcard standing in for a missing slash.
+func (p *muxPattern) exactMatch(path string) bool {
+	if !p.lastSegment().multi {
+		return true
+	}
+	if !strings.HasSuffix(path, "/") {
+		return false
+	}
+	return len(p.segments) == strings.Count(path, "/")
+}
+
+// A muxRelationship is how the sets of requests matched by two
+// patterns relate to each other.
+type muxRelationship string
+
+const (
+	muxEquivalent   muxRelationship = "equivalent"
+	muxMoreGeneral  muxRelationship = "moreGeneral"
+	muxMoreSpecific muxRelationship = "moreSpecific"
+	muxDisjoint     muxRelationship = "disjoint"
+	muxOverlaps     muxRelationship = "overlaps"
+)
+
+// conflictsWith reports whether p1 and p2 both match some request
+// without either one being more specific than the other, so that
+// neither can take precedence. Patterns with different hosts don't
+// conflict, as host-specific patterns are always tried first.
+func (p1 *muxPattern) conflictsWith(p2 *muxPattern) bool {
+	if p1.host != p2.host {
+		return false
+	}
+	rel := p1.compare(p2)
+	return rel == muxEquivalent || rel == muxOverlaps
+}
+
+// compare returns the relationship of p1 to p2, ignoring hosts.
+func (p1 *muxPattern) compare(p2 *muxPattern) muxRelationship {
+	mrel := p1.compareMethods(p2)
+	if mrel == muxDisjoint {
+		return muxDisjoint
+	}
+	return combineRelationships(mrel, p1.comparePaths(p2))
+}
+
+func (p1 *muxPattern) compareMethods(p2 *muxPattern) muxRelationship {
+	switch {
+	case p1.method == p2.method:
+		return muxEquivalent
+	case p1.method == "":
+		return muxMoreGeneral
+	case p2.method == "":
+		return muxMoreSpecific
+	case p1.method == "GET" && p2.method == "HEAD":
+		return muxMoreGeneral
+	case p2.method == "GET" && p1.method == "HEAD":
+		return muxMoreSpecific
+	}
+	return muxDisjoint
+}
+
+func (p1 *muxPattern) comparePaths(p2 *muxPattern) muxRelationship {
+	segs1, segs2 := p1.segments, p2.segments
+	rel := muxEquivalent
+	for ; len(segs1) > 0 && len(segs2) > 0; segs1, segs2 = segs1[1:], segs2[1:] {
+		s1, s2 := segs1[0], segs2[0]
+		rel = combineRelationships(rel, compareSegments(s1, s2))
+		if s1.multi || s2.multi {
+			// The multi wildcard swallows what's left of the
+			// other pattern.
+			return rel
+		}
+		if rel == muxDisjoint {
+			return rel
+		}
+	}
+	if len(segs1) == 0 && len(segs2) == 0 {
+		return rel
+	}
+	// One pattern has more segments; as neither ended in a multi
+	// wildcard, they match paths of different lengths.
+	return muxDisjoint
+}
+
+func compareSegments(s1, s2 muxSegment) muxRelationship {
+	switch {
+	case s1.multi && s2.multi:
+		return muxEquivalent
+	case s1.multi:
+		return muxMoreGeneral
+	case s2.multi:
+		return muxMoreSpecific
+	case s1.wild && s2.wild:
+		return muxEquivalent
+	case s1.wild:
+		if s2.s == "" {
+			// Single wildcards don't match empty segments.
+			return muxDisjoint
+		}
+		return muxMoreGeneral
+	case s2.wild:
+		if s1.s == "" {
+			return muxDisjoint
+		}
+		return muxMoreSpecific
+	case s1.s == s2.s:
+		return muxEquivalent
+	}
+	return muxDisjoint
+}
+
+// combineRelationships returns the relationship of two patterns
+// whose parts relate by r1 and r2.
+func combineRelationships(r1, r2 muxRelationship) muxRelationship {
+	switch r1 {
+	case muxEquivalent:
+		return r2
+	case muxDisjoint:
+		return muxDisjoint
+	case muxOverlaps:
+		if r2 == muxDisjoint {
+			return muxDisjoint
+		}
+		return muxOverlaps
+	}
+	// r1 is muxMoreGeneral or muxMoreSpecific.
+	switch {
+	case r2 == muxEquivalent:
+		return r1
+	case r1 == muxMoreGeneral && r2 == muxMoreSpecific,
+		r1 == muxMoreSpecific && r2 == muxMoreGeneral:
+		return muxOverlaps
+	}
+	return r2
+}
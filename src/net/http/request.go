@@ -22,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -226,6 +227,60 @@ type Request struct {
 	// otherwise it leaves the field nil.
 	// This field is ignored by the HTTP client.
 	TLS *tls.ConnectionState
+
+	// Cancel is an optional channel whose closure indicates that
+	// the request should be regarded as canceled.
+	//
+	// For client requests, closing Cancel aborts whatever the
+	// Transport is doing on behalf of the request: waiting for or
+	// dialing a connection, the TLS handshake, writing the request,
+	// waiting for response headers or reading the response Body.
+	// Not all RoundTrippers support Cancel.
+	//
+	// For server requests, the Server sets Cancel to a channel that
+	// is closed when the client's connection goes away, when the
+	// request is timed out by TimeoutHandler, or when the ServeHTTP
+	// method returns. A handler making outgoing requests on behalf
+	// of an incoming one can copy the incoming request's Cancel
+	// (and Deadline) to them so that they are aborted as well.
+	Cancel <-chan struct{}
+
+	// Deadline optionally specifies the time by which the request
+	// must complete.
+	//
+	// For client requests, a non-zero Deadline causes the Transport
+	// to cancel the request, as if Cancel had been closed, once the
+	// deadline has passed. The resulting errors report Timeout.
+	//
+	// For server requests, Deadline is zero unless set by a wrapping
+	// Handler such as TimeoutHandler.
+	Deadline time.Time
+
+	// Trace optionally specifies hooks that the Transport calls
+	// as the request progresses. See ClientTrace.
+	// This field is ignored by the HTTP server.
+	Trace *ClientTrace
+
+	// pathValues holds the values of the wildcards of the
+	// ServeMux pattern that matched the request.
+	pathValues map[string]string
+}
+
+// PathValue returns the value for the named path wildcard in the
+// ServeMux pattern that matched the request. It returns the empty
+// string if the request was not matched against a pattern or there
+// is no such wildcard in the pattern.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+// SetPathValue sets name to value, so that subsequent calls to
+// r.PathValue(name) return value.
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = make(map[string]string)
+	}
+	r.pathValues[name] = value
 }
 
 // ProtoAtLeast reports whether the HTTP protocol used
@@ -443,6 +498,9 @@ func (req *Request) write(w io.Writer, usingProxy bool, extraHeaders Header) err
 	if err != nil {
 		return err
 	}
+	if req.Trace != nil && req.Trace.WroteHeaders != nil {
+		req.Trace.WroteHeaders()
+	}
 
 	// Write body and trailer
 	err = tw.WriteBody(w)
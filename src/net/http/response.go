@@ -52,6 +52,11 @@ type Response struct {
 	//
 	// The Body is automatically dechunked if the server replied
 	// with a "chunked" Transfer-Encoding.
+	//
+	// For a 101 Switching Protocols response returned by the
+	// Transport, Body is an io.ReadWriteCloser carrying the
+	// connection, which now speaks the new protocol and is owned
+	// by the caller.
 	Body io.ReadCloser
 
 	// ContentLength records the length of the associated content.  The
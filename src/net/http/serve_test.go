@@ -416,6 +416,167 @@ func TestServeMuxHandlerRedirects(t *testing.T) {
 	}
 }
 
+func TestServeMuxPatterns(t *testing.T) {
+	mux := NewServeMux()
+	for _, pat := range []string{
+		"/items/",
+		"/items/{id}",
+		"GET /items/{id}",
+		"HEAD /items/{id}",
+		"/items/{id}/parts/{part}",
+		"POST /items/{$}",
+		"/files/{path...}",
+		"example.com/items/{id}",
+		"/{$}",
+	} {
+		pat := pat
+		mux.HandleFunc(pat, func(w ResponseWriter, r *Request) {
+			w.Header().Set("Pattern", pat)
+			fmt.Fprintf(w, "%s|%s|%s", r.PathValue("id"), r.PathValue("part"), r.PathValue("path"))
+		})
+	}
+	tests := []struct {
+		method, host, path string
+		code               int
+		pattern, values    string
+	}{
+		{"GET", "", "/items/", 200, "/items/", "||"},
+		{"POST", "", "/items/", 200, "POST /items/{$}", "||"},
+		{"POST", "", "/items/a/b", 200, "/items/", "||"},
+		{"GET", "", "/items/7", 200, "GET /items/{id}", "7||"},
+		{"HEAD", "", "/items/7", 200, "HEAD /items/{id}", "7||"},
+		{"DELETE", "", "/items/7", 200, "/items/{id}", "7||"},
+		{"GET", "", "/items/7/parts/x", 200, "/items/{id}/parts/{part}", "7|x|"},
+		{"GET", "", "/files/a/b/c.txt", 200, "/files/{path...}", "||a/b/c.txt"},
+		{"GET", "", "/files/", 200, "/files/{path...}", "||"},
+		{"GET", "example.com", "/items/7", 200, "example.com/items/{id}", "7||"},
+		{"GET", "", "/", 200, "/{$}", "||"},
+		{"GET", "", "/other", 404, "", ""},
+		{"GET", "", "/items", 301, "/items/", ""},
+		{"GET", "", "/files", 301, "/files/{path...}", ""},
+	}
+	for _, tt := range tests {
+		r := &Request{Method: tt.method, Host: tt.host, URL: &url.URL{Path: tt.path}}
+		_, pattern := mux.Handler(r)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, r)
+		if rr.Code != tt.code || pattern != tt.pattern {
+			t.Errorf("%s %s%s = %d, %q; want %d, %q", tt.method, tt.host, tt.path, rr.Code, pattern, tt.code, tt.pattern)
+			continue
+		}
+		if tt.code == 200 && rr.Body.String() != tt.values {
+			t.Errorf("%s %s%s: path values %q; want %q", tt.method, tt.host, tt.path, rr.Body.String(), tt.values)
+		}
+	}
+}
+
+func TestServeMuxMethodNotAllowed(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w ResponseWriter, r *Request) {})
+	mux.HandleFunc("PUT /items/{id}", func(w ResponseWriter, r *Request) {})
+	mux.HandleFunc("POST /items/", func(w ResponseWriter, r *Request) {})
+
+	r := &Request{Method: "DELETE", URL: &url.URL{Path: "/items/1"}}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, r)
+	if rr.Code != StatusMethodNotAllowed {
+		t.Fatalf("code = %d; want 405", rr.Code)
+	}
+	if got, want := rr.HeaderMap.Get("Allow"), "GET, HEAD, POST, PUT"; got != want {
+		t.Errorf("Allow = %q; want %q", got, want)
+	}
+}
+
+func TestServeMuxRegistrationErrors(t *testing.T) {
+	tests := []struct {
+		existing, pattern string
+	}{
+		{"", "GET"},
+		{"", "/{x"},
+		{"", "/a{x}"},
+		{"", "/{x...}/b"},
+		{"", "/{$}/b"},
+		{"", "/{1x}"},
+		{"", "/{x}/{x}"},
+		{"", "G@T /a"},
+		{"/a/", "/a/"},
+		{"/a/{x}", "/a/{y}"},
+		{"/a/{x}", "/{y}/b"},
+		{"GET /a/", "/a/b"},
+		{"/{x...}", "/{y...}"},
+	}
+	for _, tt := range tests {
+		mux := NewServeMux()
+		h := HandlerFunc(func(w ResponseWriter, r *Request) {})
+		if tt.existing != "" {
+			mux.Handle(tt.existing, h)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %q after %q didn't panic", tt.pattern, tt.existing)
+				}
+			}()
+			mux.Handle(tt.pattern, h)
+		}()
+	}
+
+	// These don't conflict: one is more specific or they're disjoint.
+	mux := NewServeMux()
+	for _, pat := range []string{"/a/", "/a/{x}", "/a/b", "GET /a/b", "/a/{x}/", "/b/{x}", "POST /b/{x}", "h.com/a/{y}"} {
+		mux.Handle(pat, NotFoundHandler())
+	}
+}
+
+// With GODEBUG=httpmuxlegacy=1, patterns keep their original,
+// literal meaning.
+func TestServeMuxLegacyPatterns(t *testing.T) {
+	defer ResetCachedEnvironment()
+	defer os.Setenv("GODEBUG", os.Getenv("GODEBUG"))
+	os.Setenv("GODEBUG", "httpmuxlegacy=1")
+	ResetCachedEnvironment()
+
+	mux := NewServeMux()
+	for _, pat := range []string{"/files/{name}", "/a b", "/items/{id}/", "/{$}"} {
+		pat := pat
+		mux.HandleFunc(pat, func(w ResponseWriter, r *Request) {
+			w.Header().Set("Pattern", pat)
+		})
+	}
+	tests := []struct {
+		path    string
+		code    int
+		pattern string
+	}{
+		{"/files/{name}", 200, "/files/{name}"},
+		{"/files/x", 404, ""},
+		{"/a b", 200, "/a b"},
+		{"/items/{id}/x", 200, "/items/{id}/"},
+		{"/items/7/", 404, ""},
+		{"/{$}", 200, "/{$}"},
+		{"/", 404, ""},
+	}
+	for _, tt := range tests {
+		r := &Request{Method: "GET", URL: &url.URL{Path: tt.path}}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, r)
+		if rr.Code != tt.code || rr.HeaderMap.Get("Pattern") != tt.pattern {
+			t.Errorf("GET %s = %d, %q; want %d, %q", tt.path, rr.Code, rr.HeaderMap.Get("Pattern"), tt.code, tt.pattern)
+		}
+	}
+}
+
+func TestRequestPathValue(t *testing.T) {
+	r := new(Request)
+	if v := r.PathValue("x"); v != "" {
+		t.Errorf("PathValue of unmatched request = %q", v)
+	}
+	r.SetPathValue("x", "1")
+	if v := r.PathValue("x"); v != "1" {
+		t.Errorf("PathValue after SetPathValue = %q; want 1", v)
+	}
+}
+
 // Tests for http://code.google.com/p/go/issues/detail?id=900
 func TestMuxRedirectLeadingSlashes(t *testing.T) {
 	paths := []string{"//foo.txt", "///foo.txt", "/../../foo.txt"}
@@ -569,6 +730,136 @@ func TestOnlyWriteTimeout(t *testing.T) {
 	}
 }
 
+// A slow request header is cut off by ReadHeaderTimeout, while a
+// slow body isn't.
+func TestServerReadHeaderTimeout(t *testing.T) {
+	if runtime.GOOS == "plan9" {
+		t.Skip("skipping test; see http://golang.org/issue/7237")
+	}
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.Copy(w, r.Body)
+	}))
+	ts.Config.ReadHeaderTimeout = 200 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t1 := time.Now()
+	io.WriteString(conn, "GET / HTTP/1.1\r\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read = %v, %v; want 0, EOF", n, err)
+	}
+	if latency := time.Since(t1); latency < 150*time.Millisecond {
+		t.Errorf("got EOF after %s; want >= 150ms", latency)
+	}
+
+	conn2, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	conn2.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn2, "POST / HTTP/1.1\r\nHost: foo\r\nContent-Length: 4\r\n\r\nab")
+	time.Sleep(400 * time.Millisecond)
+	io.WriteString(conn2, "cd")
+	res, err := ReadResponse(bufio.NewReader(conn2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != "abcd" {
+		t.Errorf("slow body echoed as %q; want abcd", b)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	if runtime.GOOS == "plan9" {
+		t.Skip("skipping test; see http://golang.org/issue/7237")
+	}
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	ts.Config.ReadTimeout = 5 * time.Second
+	ts.Config.IdleTimeout = 200 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+	for _, path := range []string{"/1", "/2"} {
+		io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: foo\r\n\r\n")
+		res, err := ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(b) != path {
+			t.Errorf("got %q; want %q", b, path)
+		}
+		time.Sleep(50 * time.Millisecond) // shorter than IdleTimeout
+	}
+	t1 := time.Now()
+	if n, err := br.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read = %v, %v; want 0, EOF", n, err)
+	}
+	if latency := time.Since(t1); latency > 2*time.Second {
+		t.Errorf("idle connection closed after %s; want about 200ms", latency)
+	}
+}
+
+// A handler can extend its write deadline past the server's
+// WriteTimeout.
+func TestServerHandlerSetWriteDeadline(t *testing.T) {
+	if runtime.GOOS == "plan9" {
+		t.Skip("skipping test; see http://golang.org/issue/7237")
+	}
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/extend" {
+			if err := w.(DeadlineSetter).SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Errorf("SetWriteDeadline: %v", err)
+			}
+		}
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, "late")
+	}))
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+	tr := &Transport{DisableKeepAlives: true}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	res, err := c.Get(ts.URL + "/extend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != "late" {
+		t.Errorf("body = %q; want late", b)
+	}
+
+	if res, err := c.Get(ts.URL + "/plain"); err == nil {
+		res.Body.Close()
+		t.Error("response written after WriteTimeout succeeded")
+	}
+}
+
 // trackLastConnListener tracks the last net.Conn that was accepted.
 type trackLastConnListener struct {
 	net.Listener
@@ -3091,3 +3382,329 @@ Host: golang.org
 		<-conn.closec
 	}
 }
+
+func TestServerShutdown(t *testing.T) {
+	defer afterTest(t)
+	release := make(chan bool)
+	gotReq := make(chan bool, 1)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/slow" {
+			gotReq <- true
+			<-release
+		}
+		io.WriteString(w, r.URL.Path)
+	}))
+	hookRan := make(chan bool, 1)
+	ts.Config.RegisterOnShutdown(func() { hookRan <- true })
+	ts.Start()
+	defer ts.Close()
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	// Leave one connection idle in the Transport's pool.
+	res, err := c.Get(ts.URL + "/fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	type result struct {
+		body  string
+		close bool
+		err   error
+	}
+	slowc := make(chan result, 1)
+	go func() {
+		res, err := c.Get(ts.URL + "/slow")
+		if err != nil {
+			slowc <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		slurp, err := ioutil.ReadAll(res.Body)
+		slowc <- result{string(slurp), res.Close, err}
+	}()
+	<-gotReq
+
+	shutdownc := make(chan error, 1)
+	go func() { shutdownc <- ts.Config.Shutdown(0) }()
+	select {
+	case err := <-shutdownc:
+		t.Fatalf("Shutdown returned %v before the active request finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := Get(ts.URL + "/fast"); err == nil {
+		t.Error("expected error dialing a shut down server")
+	}
+
+	close(release)
+	if r := <-slowc; r.err != nil || r.body != "/slow" || !r.close {
+		t.Errorf("slow request = %+v; want body %q with Close set", r, "/slow")
+	}
+	select {
+	case err := <-shutdownc:
+		if err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for Shutdown")
+	}
+	select {
+	case <-hookRan:
+	case <-time.After(5 * time.Second):
+		t.Error("RegisterOnShutdown hook didn't run")
+	}
+}
+
+// A request on a connection that was accepted, but not yet read from,
+// when Shutdown started is still served.
+func TestServerShutdownNewConn(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	}))
+	accepted := make(chan bool, 1)
+	ts.Config.ConnState = func(c net.Conn, state ConnState) {
+		if state == StateNew {
+			accepted <- true
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-accepted
+
+	shutdownc := make(chan error, 1)
+	go func() { shutdownc <- ts.Config.Shutdown(0) }()
+	// Let Shutdown poll the connection a few times before the
+	// request arrives.
+	time.Sleep(4 * ExportShutdownPollInterval)
+	select {
+	case err := <-shutdownc:
+		t.Fatalf("Shutdown returned %v while a new connection was open", err)
+	default:
+	}
+
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: foo\r\n\r\n")
+	res, err := ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || string(body) != "ok" || !res.Close {
+		t.Errorf("response = %q, %v, Close %v; want %q with Close set", body, err, res.Close, "ok")
+	}
+	select {
+	case err := <-shutdownc:
+		if err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Shutdown didn't return after the request finished")
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	defer afterTest(t)
+	release := make(chan bool)
+	gotReq := make(chan bool, 1)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		gotReq <- true
+		<-release
+	}))
+	defer ts.Close()
+	errc := make(chan error, 1)
+	go func() {
+		res, err := Get(ts.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		errc <- err
+	}()
+	<-gotReq
+	if err := ts.Config.Shutdown(100 * time.Millisecond); err != ErrShutdownTimeout {
+		t.Errorf("Shutdown = %v; want ErrShutdownTimeout", err)
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Errorf("Get = %v", err)
+	}
+}
+
+func TestServeAfterShutdown(t *testing.T) {
+	var srv Server
+	if err := srv.Shutdown(0); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	ln := &oneConnListener{conn: &rwTestConn{
+		Reader: strings.NewReader("GET / HTTP/1.1\r\nHost: foo\r\n\r\n"),
+		Writer: ioutil.Discard,
+	}}
+	if err := srv.Serve(ln); err != ErrServerClosed {
+		t.Errorf("Serve = %v; want ErrServerClosed", err)
+	}
+}
+
+func TestServerRequestCancelClientGone(t *testing.T) {
+	defer afterTest(t)
+	for _, tt := range []struct {
+		name string
+		req  string
+	}{
+		{"no body", "GET / HTTP/1.1\r\nHost: foo\r\n\r\n"},
+		{"read body", "POST / HTTP/1.1\r\nHost: foo\r\nContent-Length: 5\r\n\r\nhello"},
+	} {
+		gotReq := make(chan bool, 1)
+		sawCancel := make(chan bool, 1)
+		ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+			ioutil.ReadAll(r.Body)
+			gotReq <- true
+			select {
+			case <-r.Cancel:
+				sawCancel <- true
+			case <-time.After(5 * time.Second):
+				sawCancel <- false
+			}
+		}))
+		conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: error dialing: %v", tt.name, err)
+		}
+		if _, err := io.WriteString(conn, tt.req); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		<-gotReq
+		conn.Close()
+		if !<-sawCancel {
+			t.Errorf("%s: Request.Cancel not closed after client hung up", tt.name)
+		}
+		ts.Close()
+	}
+}
+
+func TestServerRequestCancelAfterHandler(t *testing.T) {
+	defer afterTest(t)
+	cancelc := make(chan (<-chan struct{}), 1)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		select {
+		case <-r.Cancel:
+			t.Error("Request.Cancel closed while handler running")
+		default:
+		}
+		cancelc <- r.Cancel
+	}))
+	defer ts.Close()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	select {
+	case <-<-cancelc:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request.Cancel not closed after handler returned")
+	}
+}
+
+func TestServerRequestCancelHijack(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		// Give the background read a chance to start.
+		time.Sleep(50 * time.Millisecond)
+		conn, buf, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buf.WriteString("got " + line)
+		buf.Flush()
+	}))
+	defer ts.Close()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: foo\r\n\r\n")
+	time.Sleep(100 * time.Millisecond)
+	io.WriteString(conn, "ping\n")
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "got ping\n"; got != want {
+		t.Errorf("read %q; want %q", got, want)
+	}
+}
+
+func TestTimeoutHandlerCancel(t *testing.T) {
+	defer afterTest(t)
+	sendHi := make(chan bool, 1)
+	canceled := make(chan bool, 1)
+	sayHi := HandlerFunc(func(w ResponseWriter, r *Request) {
+		select {
+		case <-r.Cancel:
+			canceled <- true
+		case <-sendHi:
+			canceled <- false
+		}
+	})
+	timeout := make(chan time.Time, 1)
+	ts := httptest.NewServer(NewTestTimeoutHandler(sayHi, timeout))
+	defer ts.Close()
+
+	timeout <- time.Time{}
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if g, e := res.StatusCode, StatusServiceUnavailable; g != e {
+		t.Errorf("got res.StatusCode %d; expected %d", g, e)
+	}
+	select {
+	case ok := <-canceled:
+		if !ok {
+			t.Error("handler finished without seeing Request.Cancel")
+		}
+	case <-time.After(5 * time.Second):
+		sendHi <- true
+		t.Fatal("handler's Request.Cancel not closed after timeout")
+	}
+}
+
+func TestTimeoutHandlerDeadline(t *testing.T) {
+	defer afterTest(t)
+	deadlinec := make(chan time.Time, 1)
+	h := TimeoutHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		deadlinec <- r.Deadline
+	}), time.Minute, "")
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	t0 := time.Now()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	d := <-deadlinec
+	if d.Before(t0.Add(time.Minute)) || d.After(time.Now().Add(time.Minute)) {
+		t.Errorf("Request.Deadline = %v; want about %v", d, t0.Add(time.Minute))
+	}
+}
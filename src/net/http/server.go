@@ -19,6 +19,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,6 +33,14 @@ var (
 	ErrBodyNotAllowed  = errors.New("http: request method or response status code does not allow body")
 	ErrHijacked        = errors.New("Conn has been hijacked")
 	ErrContentLength   = errors.New("Conn.Write wrote more than the declared Content-Length")
+
+	// ErrServerClosed is returned by the Server's Serve and
+	// ListenAndServe methods after a call to Shutdown.
+	ErrServerClosed = errors.New("http: Server closed")
+
+	// ErrShutdownTimeout is returned by Server.Shutdown when
+	// active connections remain after its timeout has expired.
+	ErrShutdownTimeout = errors.New("http: Server shutdown timed out")
 )
 
 // Objects implementing the Handler interface can be
@@ -109,6 +118,49 @@ type CloseNotifier interface {
 	CloseNotify() <-chan bool
 }
 
+// The Pusher interface is implemented by ResponseWriters that support
+// HTTP/2 server push.
+type Pusher interface {
+	// Push initiates an HTTP/2 server push of target, which must
+	// be an absolute path or an absolute URL on the request's
+	// host. The pushed request is constructed from target and
+	// opts and served by the Server's Handler as if the client
+	// had sent it; its response is sent to the client on a new
+	// stream.
+	//
+	// Push returns ErrNotSupported if the client has disabled
+	// push or if the request is itself a pushed one. It should be
+	// called before writing any part of the response that refers
+	// to target, so the client doesn't request it itself.
+	Push(target string, opts *PushOptions) error
+}
+
+// The DeadlineSetter interface is implemented by ResponseWriters that
+// let a handler move the deadlines for reading its request and
+// writing its response, for instance to stream a long response past
+// the Server's WriteTimeout or to accept a slow upload past its
+// ReadTimeout. A zero time means no deadline. The deadlines only
+// apply to the current request.
+//
+// For HTTP/1 requests these are the deadlines of the underlying
+// connection. HTTP/2 requests share their connection, so instead
+// reads of the request body fail once the read deadline passes,
+// and the stream is reset when the write deadline passes.
+type DeadlineSetter interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// PushOptions describes options for Pusher.Push.
+type PushOptions struct {
+	// Method specifies the HTTP method for the promised request.
+	// If set, it must be "GET" or "HEAD". Empty means "GET".
+	Method string
+
+	// Header specifies additional promised request headers.
+	Header Header
+}
+
 // A conn represents the server side of an HTTP connection.
 type conn struct {
 	remoteAddr string               // network address of remote side
@@ -117,14 +169,19 @@ type conn struct {
 	w          io.Writer            // checkConnErrorWriter's copy of wrc, not zeroed on Hijack
 	werr       error                // any errors writing to w
 	sr         liveSwitchReader     // where the LimitReader reads from; usually the rwc
-	lr         *io.LimitedReader    // io.LimitReader(sr)
-	buf        *bufio.ReadWriter    // buffered(lr,rwc), reading from bufio->limitReader->sr->rwc
+	cr         *connReader          // watches for client hangups; reads from sr
+	lr         *io.LimitedReader    // io.LimitReader(cr)
+	buf        *bufio.ReadWriter    // buffered(lr,rwc), reading from bufio->limitReader->cr->sr->rwc
 	tlsState   *tls.ConnectionState // or nil when not using TLS
+	curState   int32                // ConnState of the connection; accessed atomically
+	newTime    time.Time            // when the connection was accepted; guarded by server.mu
 
-	mu           sync.Mutex // guards the following
-	clientGone   bool       // if client has disconnected mid-request
-	closeNotifyc chan bool  // made lazily
-	hijackedv    bool       // connection has been hijacked by handler
+	mu           sync.Mutex    // guards the following
+	clientGone   bool          // if client has disconnected mid-request
+	closeNotifyc chan bool     // made lazily
+	hijackedv    bool          // connection has been hijacked by handler
+	cancelReq    func()        // cancels the active request, if any
+	h2           *h2ServerConn // set once the connection switches to HTTP/2
 }
 
 func (c *conn) hijacked() bool {
@@ -134,6 +191,7 @@ func (c *conn) hijacked() bool {
 }
 
 func (c *conn) hijack() (rwc net.Conn, buf *bufio.ReadWriter, err error) {
+	c.cr.disable()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.hijackedv {
@@ -152,6 +210,9 @@ func (c *conn) hijack() (rwc net.Conn, buf *bufio.ReadWriter, err error) {
 }
 
 func (c *conn) closeNotify() <-chan bool {
+	// The CloseNotifier machinery below reads from the connection
+	// on its own, so stop any background read first.
+	c.cr.disable()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.closeNotifyc == nil {
@@ -186,6 +247,145 @@ func (c *conn) noteClientGone() {
 		c.closeNotifyc <- true
 	}
 	c.clientGone = true
+	if c.cancelReq != nil {
+		c.cancelReq()
+	}
+}
+
+func (c *conn) setCancelReq(cancel func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancelReq = cancel
+}
+
+// startBackgroundRead begins watching for the client going away
+// while a handler runs, once the request body has been consumed. It
+// does nothing if the client has already sent more data, such as a
+// pipelined request, which shows that it is still there.
+func (c *conn) startBackgroundRead() {
+	if c.buf != nil && c.buf.Reader.Buffered() > 0 {
+		return
+	}
+	c.cr.startBackgroundRead()
+}
+
+// aLongTimeAgo is a non-zero time, far in the past, used for
+// immediate cancelation of network operations.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// A connReader is the io.Reader between a conn's LimitedReader and
+// its liveSwitchReader. While a handler runs and the request body
+// has been fully read, a connReader can keep a one-byte read pending
+// on the connection, so that the server notices when the client
+// hangs up and can cancel the request.
+type connReader struct {
+	c  *conn
+	nc net.Conn  // the original connection, for aborting reads
+	r  io.Reader // the conn's liveSwitchReader
+
+	mu       sync.Mutex // guards following
+	cond     *sync.Cond // signaled when inRead becomes false
+	watching bool       // a handler is running; background reads are allowed
+	disabled bool       // connection hijacked or using CloseNotifier
+	inRead   bool       // a background read is in progress
+	aborting bool       // the background read is being aborted
+	hasByte  bool       // byteBuf holds a byte read in the background
+	byteBuf  [1]byte
+}
+
+func newConnReader(c *conn, nc net.Conn, r io.Reader) *connReader {
+	cr := &connReader{c: c, nc: nc, r: r}
+	cr.cond = sync.NewCond(&cr.mu)
+	return cr
+}
+
+func (cr *connReader) Read(p []byte) (n int, err error) {
+	cr.abortPendingRead()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	cr.mu.Lock()
+	if cr.hasByte {
+		p[0] = cr.byteBuf[0]
+		cr.hasByte = false
+		cr.mu.Unlock()
+		return 1, nil
+	}
+	cr.mu.Unlock()
+	return cr.r.Read(p)
+}
+
+// setWatching records whether a handler is running. Background reads
+// are only started while one is, and are aborted when it returns.
+func (cr *connReader) setWatching(v bool) {
+	cr.mu.Lock()
+	cr.watching = v
+	cr.mu.Unlock()
+	if !v {
+		cr.abortPendingRead()
+	}
+}
+
+// disable aborts any background read and prevents further ones.
+func (cr *connReader) disable() {
+	cr.mu.Lock()
+	cr.disabled = true
+	cr.mu.Unlock()
+	cr.abortPendingRead()
+}
+
+func (cr *connReader) startBackgroundRead() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if !cr.watching || cr.disabled || cr.inRead || cr.hasByte {
+		return
+	}
+	// The read can only be aborted if the connection supports
+	// deadlines. Clearing the deadline also keeps the server's
+	// ReadTimeout, which covered reading the request, from ending
+	// the watch early.
+	if err := cr.nc.SetReadDeadline(time.Time{}); err != nil {
+		return
+	}
+	cr.inRead = true
+	go cr.backgroundRead()
+}
+
+func (cr *connReader) backgroundRead() {
+	n, err := cr.r.Read(cr.byteBuf[:])
+	cr.mu.Lock()
+	if n == 1 {
+		cr.hasByte = true
+	}
+	gone := err != nil && !cr.aborting
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		// Either we aborted the read or the server's ReadTimeout
+		// expired; neither means the client went away.
+		gone = false
+	}
+	cr.inRead = false
+	cr.mu.Unlock()
+	cr.cond.Broadcast()
+	if gone {
+		cr.c.noteClientGone()
+	}
+}
+
+// abortPendingRead interrupts a background read, if any, and waits
+// for it to finish. Any byte it read is kept for the next Read.
+func (cr *connReader) abortPendingRead() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if !cr.inRead {
+		return
+	}
+	cr.aborting = true
+	cr.nc.SetReadDeadline(aLongTimeAgo)
+	for cr.inRead {
+		cr.cond.Wait()
+	}
+	cr.aborting = false
+	cr.nc.SetReadDeadline(time.Time{})
 }
 
 // A switchReader can have its Reader changed at runtime.
@@ -332,13 +532,22 @@ type response struct {
 	// input from it.
 	requestBodyLimitHit bool
 
-	handlerDone bool // set true when the handler exits
+	handlerDone  bool // set true when the handler exits
+	setDeadlines bool // the handler called SetReadDeadline or SetWriteDeadline
+
+	cancelc    chan struct{} // the request's Cancel channel
+	cancelOnce sync.Once     // guards close of cancelc
 
 	// Buffers for Date and Content-Length
 	dateBuf [len(TimeFormat)]byte
 	clenBuf [10]byte
 }
 
+// cancel closes the request's Cancel channel.
+func (w *response) cancel() {
+	w.cancelOnce.Do(func() { close(w.cancelc) })
+}
+
 // requestTooLarge is called by maxBytesReader when too much input has
 // been read from the client.
 func (w *response) requestTooLarge() {
@@ -439,7 +648,8 @@ func (srv *Server) newConn(rwc net.Conn) (c *conn, err error) {
 		c.rwc = newLoggingConn("server", c.rwc)
 	}
 	c.sr = liveSwitchReader{r: c.rwc}
-	c.lr = io.LimitReader(&c.sr, noLimit).(*io.LimitedReader)
+	c.cr = newConnReader(c, c.rwc, &c.sr)
+	c.lr = io.LimitReader(c.cr, noLimit).(*io.LimitedReader)
 	br := newBufioReader(c.lr)
 	bw := newBufioWriterSize(checkConnErrorWriter{c}, 4<<10)
 	c.buf = bufio.NewReadWriter(br, bw)
@@ -572,9 +782,15 @@ func (c *conn) readRequest() (w *response, err error) {
 		return nil, ErrHijacked
 	}
 
+	var hdrDeadline, wholeReqDeadline time.Time
+	t0 := time.Now()
+	if d := c.server.readHeaderTimeout(); d != 0 {
+		hdrDeadline = t0.Add(d)
+	}
 	if d := c.server.ReadTimeout; d != 0 {
-		c.rwc.SetReadDeadline(time.Now().Add(d))
+		wholeReqDeadline = t0.Add(d)
 	}
+	c.rwc.SetReadDeadline(hdrDeadline)
 	if d := c.server.WriteTimeout; d != 0 {
 		defer func() {
 			c.rwc.SetWriteDeadline(time.Now().Add(d))
@@ -591,6 +807,10 @@ func (c *conn) readRequest() (w *response, err error) {
 	}
 	c.lr.N = noLimit
 
+	// The ReadHeaderTimeout was for the header only; the body is
+	// covered by ReadTimeout, if any.
+	c.rwc.SetReadDeadline(wholeReqDeadline)
+
 	req.RemoteAddr = c.remoteAddr
 	req.TLS = c.tlsState
 
@@ -599,6 +819,11 @@ func (c *conn) readRequest() (w *response, err error) {
 		req:           req,
 		handlerHeader: make(Header),
 		contentLength: -1,
+		cancelc:       make(chan struct{}),
+	}
+	req.Cancel = w.cancelc
+	if b, ok := req.Body.(*body); ok {
+		b.onHitEOF = c.startBackgroundRead
 	}
 	w.cw.res = w
 	w.w = newBufioWriterSize(&w.cw, bufferBeforeChunkingSize)
@@ -1115,6 +1340,13 @@ func validNPN(proto string) bool {
 }
 
 func (c *conn) setState(nc net.Conn, state ConnState) {
+	atomic.StoreInt32(&c.curState, int32(state))
+	switch state {
+	case StateNew:
+		c.server.trackConn(c, nc, true)
+	case StateHijacked, StateClosed:
+		c.server.trackConn(c, nc, false)
+	}
 	if hook := c.server.ConnState; hook != nil {
 		hook(nc, state)
 	}
@@ -1150,17 +1382,24 @@ func (c *conn) serve() {
 		c.tlsState = new(tls.ConnectionState)
 		*c.tlsState = tlsConn.ConnectionState()
 		if proto := c.tlsState.NegotiatedProtocol; validNPN(proto) {
-			if fn := c.server.TLSNextProto[proto]; fn != nil {
+			c.setState(c.rwc, StateActive)
+			if proto == "h2" && c.server.TLSNextProto == nil {
+				c.serveH2(c.buf.Reader)
+			} else if fn := c.server.TLSNextProto[proto]; fn != nil {
 				h := initNPNRequest{tlsConn, serverHandler{c.server}}
 				fn(c.server, tlsConn, h)
 			}
 			return
 		}
+	} else if c.server.EnableH2C && c.sawH2Preface() {
+		c.setState(c.rwc, StateActive)
+		c.serveH2(c.buf.Reader)
+		return
 	}
 
 	for {
 		w, err := c.readRequest()
-		if c.lr.N != c.server.initialLimitedReaderSize() {
+		if c.lr.N != c.server.initialLimitedReaderSize() && ConnState(atomic.LoadInt32(&c.curState)) != StateActive {
 			// If we read any bytes off the wire, we're active.
 			c.setState(c.rwc, StateActive)
 		}
@@ -1201,11 +1440,25 @@ func (c *conn) serve() {
 		// so we might as well run the handler in this goroutine.
 		// [*] Not strictly true: HTTP pipelining.  We could let them all process
 		// in parallel even if their responses need to be serialized.
+		c.setCancelReq(w.cancel)
+		c.cr.setWatching(true)
+		if req.Body == eofReader {
+			c.startBackgroundRead()
+		}
 		serverHandler{c.server}.ServeHTTP(w, w.req)
+		c.setCancelReq(nil)
+		w.cancel()
 		if c.hijacked() {
 			return
 		}
+		c.cr.setWatching(false)
 		w.finishRequest()
+		if w.setDeadlines {
+			// Don't let the handler's deadlines outlive its
+			// request.
+			c.rwc.SetReadDeadline(time.Time{})
+			c.rwc.SetWriteDeadline(time.Time{})
+		}
 		if w.closeAfterReply {
 			if w.requestBodyLimitHit {
 				c.closeWriteAndWait()
@@ -1213,7 +1466,33 @@ func (c *conn) serve() {
 			break
 		}
 		c.setState(c.rwc, StateIdle)
+
+		// Wait for the next request, for up to IdleTimeout. Its
+		// ReadHeaderTimeout starts once it begins to arrive.
+		if d := c.server.idleTimeout(); d != 0 {
+			c.rwc.SetReadDeadline(time.Now().Add(d))
+			if _, err := c.buf.Reader.Peek(1); err != nil {
+				break
+			}
+			c.setState(c.rwc, StateActive)
+		}
+	}
+}
+
+// sawH2Preface reports whether the client opened the connection with
+// the HTTP/2 connection preface. It peeks one byte at a time, so it
+// doesn't block on HTTP/1 requests shorter than the preface.
+func (c *conn) sawH2Preface() bool {
+	if d := c.server.ReadTimeout; d != 0 {
+		c.rwc.SetReadDeadline(time.Now().Add(d))
 	}
+	for i := 1; i <= len(h2ClientPreface); i++ {
+		b, err := c.buf.Reader.Peek(i)
+		if err != nil || b[i-1] != h2ClientPreface[i-1] {
+			return false
+		}
+	}
+	return true
 }
 
 func (w *response) sendExpectationFailed() {
@@ -1254,6 +1533,22 @@ func (w *response) CloseNotify() <-chan bool {
 	return w.conn.closeNotify()
 }
 
+func (w *response) SetReadDeadline(t time.Time) error {
+	if w.conn.hijacked() {
+		return ErrHijacked
+	}
+	w.setDeadlines = true
+	return w.conn.rwc.SetReadDeadline(t)
+}
+
+func (w *response) SetWriteDeadline(t time.Time) error {
+	if w.conn.hijacked() {
+		return ErrHijacked
+	}
+	w.setDeadlines = true
+	return w.conn.rwc.SetWriteDeadline(t)
+}
+
 // The HandlerFunc type is an adapter to allow the use of
 // ordinary functions as HTTP handlers.  If f is a function
 // with the appropriate signature, HandlerFunc(f) is a
@@ -1415,6 +1710,43 @@ func RedirectHandler(url string, code int) Handler {
 // "/codesearch" and "codesearch.google.com/" without also taking over
 // requests for "http://www.google.com/".
 //
+// Patterns may also begin with a method followed by a space, as in
+// "GET /items/", to match only requests with that method. A pattern
+// for GET also matches HEAD requests. If some pattern matches the
+// request's path but none matches its method, ServeMux replies with
+// 405 Method Not Allowed and an Allow header listing the methods of
+// the patterns that matched.
+//
+// Path segments of a pattern may be wildcards: "{name}" matches one
+// non-empty segment, and "{name...}", which must come last, matches
+// the remainder of the path. A trailing "{$}", as in "/items/{$}",
+// matches only the path ending in the slash rather than the whole
+// subtree. The values matched by wildcards are available to the
+// handler through Request.PathValue.
+//
+// When several patterns match a request, the most specific one wins:
+// the one that matches a strict subset of the requests the others
+// match. For example, "/items/{id}" is more specific than "/items/"
+// and "GET /items/{id}" is more specific than "/items/{id}".
+// Registering two patterns that match some request in common without
+// either being more specific, such as "/items/{id}" and "/{x}/new",
+// panics.
+//
+// Setting the GODEBUG environment variable to include
+// httpmuxlegacy=1 restores the original pattern syntax, for programs
+// whose existing patterns would change meaning: patterns then have no
+// method, and every path segment is matched literally, so that
+// "/files/{name}" matches only that path. GODEBUG is read when the
+// first pattern is registered.
+//
+// If a subtree has been registered and a request is received naming
+// the subtree root without its trailing slash, ServeMux redirects that
+// request to the subtree root (adding the trailing slash). This
+// behavior can be overridden with a separate registration for the
+// path without the trailing slash. For example, registering "/images/"
+// causes ServeMux to redirect a request for "/images" to "/images/",
+// unless "/images" has been registered separately.
+//
 // ServeMux also takes care of sanitizing the URL request path,
 // redirecting any request containing . or .. elements to an
 // equivalent .- and ..-free URL.
@@ -1425,9 +1757,8 @@ type ServeMux struct {
 }
 
 type muxEntry struct {
-	explicit bool
-	h        Handler
-	pattern  string
+	h       Handler
+	pattern *muxPattern
 }
 
 // NewServeMux allocates and returns a new ServeMux.
@@ -1436,19 +1767,6 @@ func NewServeMux() *ServeMux { return &ServeMux{m: make(map[string]muxEntry)} }
 // DefaultServeMux is the default ServeMux used by Serve.
 var DefaultServeMux = NewServeMux()
 
-// Does path match pattern?
-func pathMatch(pattern, path string) bool {
-	if len(pattern) == 0 {
-		// should not happen
-		return false
-	}
-	n := len(pattern)
-	if pattern[n-1] != '/' {
-		return pattern == path
-	}
-	return len(path) >= n && path[0:n] == pattern
-}
-
 // Return the canonical path for p, eliminating . and .. elements.
 func cleanPath(p string) string {
 	if p == "" {
@@ -1466,20 +1784,50 @@ func cleanPath(p string) string {
 	return np
 }
 
-// Find a handler on a handler map given a path string
-// Most-specific (longest) pattern wins
-func (mux *ServeMux) match(path string) (h Handler, pattern string) {
-	var n = 0
-	for k, v := range mux.m {
-		if !pathMatch(k, path) {
+// match returns the most specific pattern for host and path matching
+// method, and the values of its wildcards. If no pattern matches
+// method, allow lists the methods of patterns matching the path.
+// Host-specific patterns take precedence over generic ones.
+func (mux *ServeMux) match(host, method, path string) (e muxEntry, values []string, allow []string) {
+	if mux.hosts {
+		e, values, allow = mux.matchHost(host, method, path)
+		if e.pattern != nil {
+			return
+		}
+	}
+	e, values, allow2 := mux.matchHost("", method, path)
+	if e.pattern != nil {
+		return e, values, nil
+	}
+	return e, nil, append(allow, allow2...)
+}
+
+func (mux *ServeMux) matchHost(host, method, path string) (best muxEntry, values []string, allow []string) {
+	for _, e := range mux.m {
+		p := e.pattern
+		if p.host != host {
+			continue
+		}
+		v, ok := p.matchPath(path)
+		if !ok {
 			continue
 		}
-		if h == nil || len(k) > n {
-			n = len(k)
-			h = v.h
-			pattern = v.pattern
+		if !p.matchesMethod(method) {
+			allow = append(allow, p.method)
+			if p.method == "GET" {
+				allow = append(allow, "HEAD")
+			}
+			continue
+		}
+		// Registration ensures that of two patterns matching
+		// the same request, one is more specific.
+		if best.pattern == nil || p.compare(best.pattern) == muxMoreSpecific {
+			best, values = e, v
 		}
 	}
+	if best.pattern != nil {
+		allow = nil
+	}
 	return
 }
 
@@ -1496,35 +1844,65 @@ func (mux *ServeMux) match(path string) (h Handler, pattern string) {
 // If there is no registered handler that applies to the request,
 // Handler returns a ``page not found'' handler and an empty pattern.
 func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
+	h, p, _ := mux.findHandler(r)
+	if p != nil {
+		pattern = p.str
+	}
+	return
+}
+
+// findHandler implements Handler, also returning the values of the
+// matched pattern's wildcards.
+func (mux *ServeMux) findHandler(r *Request) (h Handler, p *muxPattern, values []string) {
 	if r.Method != "CONNECT" {
-		if p := cleanPath(r.URL.Path); p != r.URL.Path {
-			_, pattern = mux.handler(r.Host, p)
+		if cp := cleanPath(r.URL.Path); cp != r.URL.Path {
+			_, p, _ = mux.handler(r.Host, r.Method, cp)
 			url := *r.URL
-			url.Path = p
-			return RedirectHandler(url.String(), StatusMovedPermanently), pattern
+			url.Path = cp
+			return RedirectHandler(url.String(), StatusMovedPermanently), p, nil
 		}
 	}
 
-	return mux.handler(r.Host, r.URL.Path)
+	return mux.handler(r.Host, r.Method, r.URL.Path)
 }
 
 // handler is the main implementation of Handler.
 // The path is known to be in canonical form, except for CONNECT methods.
-func (mux *ServeMux) handler(host, path string) (h Handler, pattern string) {
+func (mux *ServeMux) handler(host, method, path string) (h Handler, p *muxPattern, values []string) {
 	mux.mu.RLock()
 	defer mux.mu.RUnlock()
 
-	// Host-specific pattern takes precedence over generic ones
-	if mux.hosts {
-		h, pattern = mux.match(host + path)
+	e, values, allow := mux.match(host, method, path)
+	if (e.pattern == nil || !e.pattern.exactMatch(path)) && !strings.HasSuffix(path, "/") {
+		// Redirect to the subtree root if it was registered
+		// without this path.
+		if e2, _, _ := mux.match(host, method, path+"/"); e2.pattern != nil && e2.pattern.exactMatch(path+"/") {
+			return RedirectHandler(path+"/", StatusMovedPermanently), e2.pattern, nil
+		}
 	}
-	if h == nil {
-		h, pattern = mux.match(path)
+	if e.pattern != nil {
+		return e.h, e.pattern, values
 	}
-	if h == nil {
-		h, pattern = NotFoundHandler(), ""
+	if len(allow) > 0 {
+		return methodNotAllowedHandler(allow), nil, nil
 	}
-	return
+	return NotFoundHandler(), nil, nil
+}
+
+// methodNotAllowedHandler returns a handler that replies with 405
+// Method Not Allowed, listing the allowed methods.
+func methodNotAllowedHandler(allow []string) Handler {
+	sort.Strings(allow)
+	var methods []string
+	for i, m := range allow {
+		if i == 0 || m != allow[i-1] {
+			methods = append(methods, m)
+		}
+	}
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		Error(w, StatusText(StatusMethodNotAllowed), StatusMethodNotAllowed)
+	})
 }
 
 // ServeHTTP dispatches the request to the handler whose
@@ -1537,46 +1915,46 @@ func (mux *ServeMux) ServeHTTP(w ResponseWriter, r *Request) {
 		w.WriteHeader(StatusBadRequest)
 		return
 	}
-	h, _ := mux.Handler(r)
+	h, p, values := mux.findHandler(r)
+	if len(values) > 0 {
+		r.pathValues = make(map[string]string, len(values))
+		i := 0
+		for _, seg := range p.segments {
+			if seg.wild && seg.s != "" {
+				r.pathValues[seg.s] = values[i]
+				i++
+			}
+		}
+	}
 	h.ServeHTTP(w, r)
 }
 
 // Handle registers the handler for the given pattern.
-// If a handler already exists for pattern, Handle panics.
+// If a handler already exists for pattern, or pattern conflicts
+// with a registered one, Handle panics.
 func (mux *ServeMux) Handle(pattern string, handler Handler) {
 	mux.mu.Lock()
 	defer mux.mu.Unlock()
 
-	if pattern == "" {
-		panic("http: invalid pattern " + pattern)
-	}
 	if handler == nil {
 		panic("http: nil handler")
 	}
-	if mux.m[pattern].explicit {
+	if _, exist := mux.m[pattern]; exist {
 		panic("http: multiple registrations for " + pattern)
 	}
-
-	mux.m[pattern] = muxEntry{explicit: true, h: handler, pattern: pattern}
-
-	if pattern[0] != '/' {
-		mux.hosts = true
+	p, err := parseMuxPattern(pattern)
+	if err != nil {
+		panic("http: invalid pattern " + pattern + ": " + err.Error())
 	}
-
-	// Helpful behavior:
-	// If pattern is /tree/, insert an implicit permanent redirect for /tree.
-	// It can be overridden by an explicit registration.
-	n := len(pattern)
-	if n > 0 && pattern[n-1] == '/' && !mux.m[pattern[0:n-1]].explicit {
-		// If pattern contains a host name, strip it and use remaining
-		// path for redirect.
-		path := pattern
-		if pattern[0] != '/' {
-			// In pattern, at least the last character is a '/', so
-			// strings.Index can't be -1.
-			path = pattern[strings.Index(pattern, "/"):]
+	for _, e := range mux.m {
+		if p.conflictsWith(e.pattern) {
+			panic("http: pattern " + pattern + " conflicts with pattern " + e.pattern.str)
 		}
-		mux.m[pattern[0:n-1]] = muxEntry{h: RedirectHandler(path, StatusMovedPermanently), pattern: pattern}
+	}
+	mux.m[pattern] = muxEntry{h: handler, pattern: p}
+
+	if p.host != "" {
+		mux.hosts = true
 	}
 }
 
@@ -1616,6 +1994,22 @@ type Server struct {
 	MaxHeaderBytes int           // maximum size of request headers, DefaultMaxHeaderBytes if 0
 	TLSConfig      *tls.Config   // optional TLS config, used by ListenAndServeTLS
 
+	// ReadHeaderTimeout is the amount of time allowed to read
+	// request headers. The connection's read deadline is reset
+	// after reading the headers, so the body is only limited by
+	// ReadTimeout; this lets a server cut off clients that send
+	// headers slowly without limiting the time to upload a body.
+	// If ReadHeaderTimeout is zero, the value of ReadTimeout is
+	// used. If both are zero, there is no timeout.
+	ReadHeaderTimeout time.Duration
+
+	// IdleTimeout is the maximum amount of time to wait for the
+	// next request when keep-alives are enabled, for HTTP/1
+	// connections as well as HTTP/2 ones without open streams. If
+	// IdleTimeout is zero, the value of ReadTimeout is used. If
+	// both are zero, there is no timeout.
+	IdleTimeout time.Duration
+
 	// TLSNextProto optionally specifies a function to take over
 	// ownership of the provided TLS connection when an NPN
 	// protocol upgrade has occurred.  The map key is the protocol
@@ -1623,8 +2017,18 @@ type Server struct {
 	// handle HTTP requests and will initialize the Request's TLS
 	// and RemoteAddr if not already set.  The connection is
 	// automatically closed when the function returns.
+	//
+	// If TLSNextProto is nil, HTTP/2 is served to clients that
+	// negotiate "h2". A non-nil map, even an empty one, disables
+	// the built-in HTTP/2 support.
 	TLSNextProto map[string]func(*Server, *tls.Conn, Handler)
 
+	// EnableH2C, if true, makes the server accept HTTP/2 without
+	// TLS from clients that open the connection with the HTTP/2
+	// preface ("prior knowledge", RFC 7540 section 3.4). It is
+	// mostly useful for tests and behind trusted proxies.
+	EnableH2C bool
+
 	// ConnState specifies an optional callback function that is
 	// called when a client connection changes state. See the
 	// ConnState type and associated constants for details.
@@ -1637,6 +2041,26 @@ type Server struct {
 	ErrorLog *log.Logger
 
 	disableKeepAlives int32 // accessed atomically.
+	inShutdown        int32 // accessed atomically; non-zero once Shutdown is called
+
+	mu         sync.Mutex // guards the following
+	listeners  map[net.Listener]bool
+	activeConn map[*conn]net.Conn // conn -> its original net.Conn
+	onShutdown []func()
+}
+
+func (srv *Server) readHeaderTimeout() time.Duration {
+	if srv.ReadHeaderTimeout != 0 {
+		return srv.ReadHeaderTimeout
+	}
+	return srv.ReadTimeout
+}
+
+func (srv *Server) idleTimeout() time.Duration {
+	if srv.IdleTimeout != 0 {
+		return srv.IdleTimeout
+	}
+	return srv.ReadTimeout
 }
 
 // A ConnState represents the state of a client connection to a server.
@@ -1721,12 +2145,22 @@ func (srv *Server) ListenAndServe() error {
 // Serve accepts incoming connections on the Listener l, creating a
 // new service goroutine for each.  The service goroutines read requests and
 // then call srv.Handler to reply to them.
+//
+// Serve always returns a non-nil error. After Shutdown, the returned
+// error is ErrServerClosed.
 func (srv *Server) Serve(l net.Listener) error {
 	defer l.Close()
+	if !srv.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer srv.trackListener(l, false)
 	var tempDelay time.Duration // how long to sleep on accept failure
 	for {
 		rw, e := l.Accept()
 		if e != nil {
+			if srv.shuttingDown() {
+				return ErrServerClosed
+			}
 			if ne, ok := e.(net.Error); ok && ne.Temporary() {
 				if tempDelay == 0 {
 					tempDelay = 5 * time.Millisecond
@@ -1753,7 +2187,154 @@ func (srv *Server) Serve(l net.Listener) error {
 }
 
 func (s *Server) doKeepAlives() bool {
-	return atomic.LoadInt32(&s.disableKeepAlives) == 0
+	return atomic.LoadInt32(&s.disableKeepAlives) == 0 && !s.shuttingDown()
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) != 0
+}
+
+// shutdownPollInterval is how often Shutdown looks for connections
+// that have become idle while it waits for active requests to finish.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// shutdownNewConnGrace is how long Shutdown leaves a connection in
+// StateNew open, since its client may already have sent a request the
+// server hasn't read yet.
+const shutdownNewConnGrace = 5 * time.Second
+
+// Shutdown gracefully shuts down the server without interrupting any
+// active connections. Shutdown works by first closing all open
+// listeners, then closing all idle connections, and then waiting for
+// connections to return to idle and then closing them. Connections
+// which finish their current request while the server is shutting
+// down are closed instead of being kept alive. A newly accepted
+// connection whose request hasn't been read yet is given a few
+// seconds for it before being closed.
+//
+// If timeout is positive and connections are still active once it
+// has elapsed, Shutdown returns ErrShutdownTimeout. The remaining
+// connections are left open; the caller may wait longer or exit.
+// A zero timeout waits for all connections to finish.
+//
+// Shutdown does not close or wait for hijacked connections such as
+// WebSockets. Callers should use RegisterOnShutdown to be notified
+// of shutdown and close such connections themselves.
+//
+// Once Shutdown has been called, Serve, ListenAndServe and
+// ListenAndServeTLS return ErrServerClosed.
+func (srv *Server) Shutdown(timeout time.Duration) error {
+	atomic.StoreInt32(&srv.inShutdown, 1)
+
+	srv.mu.Lock()
+	var lnerr error
+	for ln := range srv.listeners {
+		if err := ln.Close(); err != nil && lnerr == nil {
+			lnerr = err
+		}
+		delete(srv.listeners, ln)
+	}
+	for _, f := range srv.onShutdown {
+		go f()
+	}
+	srv.mu.Unlock()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if srv.closeIdleConns() {
+			return lnerr
+		}
+		select {
+		case <-deadline:
+			return ErrShutdownTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterOnShutdown registers a function to call on Shutdown.
+// This can be used to gracefully shutdown connections that have
+// been hijacked or have otherwise left the Server's control.
+// Each function is run in its own goroutine and Shutdown does
+// not wait for it to return.
+func (srv *Server) RegisterOnShutdown(f func()) {
+	srv.mu.Lock()
+	srv.onShutdown = append(srv.onShutdown, f)
+	srv.mu.Unlock()
+}
+
+// closeIdleConns closes all connections that are idle, or new and
+// older than shutdownNewConnGrace, and reports whether the server has
+// no connections left.
+func (srv *Server) closeIdleConns() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	quiescent := true
+	now := time.Now()
+	for c, nc := range srv.activeConn {
+		switch ConnState(atomic.LoadInt32(&c.curState)) {
+		case StateNew:
+			if now.Sub(c.newTime) < shutdownNewConnGrace {
+				quiescent = false
+				continue
+			}
+			nc.Close()
+			delete(srv.activeConn, c)
+		case StateIdle:
+			nc.Close()
+			delete(srv.activeConn, c)
+		default:
+			c.mu.Lock()
+			sc := c.h2
+			c.mu.Unlock()
+			if sc != nil {
+				sc.startGracefulShutdown()
+			}
+			quiescent = false
+		}
+	}
+	return quiescent
+}
+
+// trackListener adds or removes l from the set of listeners closed by
+// Shutdown. It reports false if l was to be added but the server is
+// already shutting down.
+func (srv *Server) trackListener(l net.Listener, add bool) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !add {
+		delete(srv.listeners, l)
+		return true
+	}
+	if srv.shuttingDown() {
+		return false
+	}
+	if srv.listeners == nil {
+		srv.listeners = make(map[net.Listener]bool)
+	}
+	srv.listeners[l] = true
+	return true
+}
+
+func (srv *Server) trackConn(c *conn, nc net.Conn, add bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !add {
+		delete(srv.activeConn, c)
+		return
+	}
+	if srv.activeConn == nil {
+		srv.activeConn = make(map[*conn]net.Conn)
+	}
+	c.newTime = time.Now()
+	srv.activeConn[c] = nc
 }
 
 // SetKeepAlivesEnabled controls whether HTTP keep-alives are enabled.
@@ -1849,6 +2430,9 @@ func ListenAndServeTLS(addr string, certFile string, keyFile string, handler Han
 // certificate authority, the certFile should be the concatenation
 // of the server's certificate followed by the CA's certificate.
 //
+// Unless srv.TLSConfig sets NextProtos or srv.TLSNextProto is
+// non-nil, HTTP/2 is offered to clients during the TLS handshake.
+//
 // If srv.Addr is blank, ":https" is used.
 func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
 	addr := srv.Addr
@@ -1861,6 +2445,9 @@ func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
 	}
 	if config.NextProtos == nil {
 		config.NextProtos = []string{"http/1.1"}
+		if srv.TLSNextProto == nil {
+			config.NextProtos = []string{"h2", "http/1.1"}
+		}
 	}
 
 	var err error
@@ -1887,11 +2474,15 @@ func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
 // (If msg is empty, a suitable default message will be sent.)
 // After such a timeout, writes by h to its ResponseWriter will return
 // ErrHandlerTimeout.
+//
+// The Request passed to h is a copy of the incoming one whose Deadline
+// is set to the time limit and whose Cancel channel is closed when the
+// time limit expires or the incoming request is canceled.
 func TimeoutHandler(h Handler, dt time.Duration, msg string) Handler {
 	f := func() <-chan time.Time {
 		return time.After(dt)
 	}
-	return &timeoutHandler{h, f, msg}
+	return &timeoutHandler{handler: h, timeout: f, dt: dt, body: msg}
 }
 
 // ErrHandlerTimeout is returned on ResponseWriter Write calls
@@ -1901,6 +2492,7 @@ var ErrHandlerTimeout = errors.New("http: Handler timeout")
 type timeoutHandler struct {
 	handler Handler
 	timeout func() <-chan time.Time // returns channel producing a timeout
+	dt      time.Duration           // for Request.Deadline; zero in tests
 	body    string
 }
 
@@ -1912,23 +2504,45 @@ func (h *timeoutHandler) errorBody() string {
 }
 
 func (h *timeoutHandler) ServeHTTP(w ResponseWriter, r *Request) {
+	cancelc := make(chan struct{})
+	var cancelOnce sync.Once
+	cancel := func() { cancelOnce.Do(func() { close(cancelc) }) }
+	defer cancel()
+
+	r2 := new(Request)
+	*r2 = *r
+	r2.Cancel = cancelc
+	if h.dt > 0 {
+		if d := time.Now().Add(h.dt); r.Deadline.IsZero() || d.Before(r.Deadline) {
+			r2.Deadline = d
+		}
+	}
+
 	done := make(chan bool, 1)
 	tw := &timeoutWriter{w: w}
 	go func() {
-		h.handler.ServeHTTP(tw, r)
+		h.handler.ServeHTTP(tw, r2)
 		done <- true
 	}()
-	select {
-	case <-done:
-		return
-	case <-h.timeout():
-		tw.mu.Lock()
-		defer tw.mu.Unlock()
-		if !tw.wroteHeader {
-			tw.w.WriteHeader(StatusServiceUnavailable)
-			tw.w.Write([]byte(h.errorBody()))
+	timeout := h.timeout()
+	parentCancel := r.Cancel
+	for {
+		select {
+		case <-done:
+			return
+		case <-parentCancel:
+			parentCancel = nil
+			cancel()
+		case <-timeout:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			if !tw.wroteHeader {
+				tw.w.WriteHeader(StatusServiceUnavailable)
+				tw.w.Write([]byte(h.errorBody()))
+			}
+			tw.timedOut = true
+			return
 		}
-		tw.timedOut = true
 	}
 }
 
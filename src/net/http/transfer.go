@@ -555,10 +555,11 @@ func fixTrailer(header Header, te []string) (Header, error) {
 // Close ensures that the body has been fully read
 // and then reads the trailer if necessary.
 type body struct {
-	src     io.Reader
-	hdr     interface{}   // non-nil (Response or Request) value means read trailer
-	r       *bufio.Reader // underlying wire-format reader for the trailer
-	closing bool          // is the connection to be closed after reading body?
+	src      io.Reader
+	hdr      interface{}   // non-nil (Response or Request) value means read trailer
+	r        *bufio.Reader // underlying wire-format reader for the trailer
+	closing  bool          // is the connection to be closed after reading body?
+	onHitEOF func()        // if non-nil, func to call when EOF is Read
 
 	mu     sync.Mutex // guards closed, and calls to Read and Close
 	closed bool
@@ -610,6 +611,11 @@ func (b *body) readLocked(p []byte) (n int, err error) {
 		}
 	}
 
+	if err == io.EOF && b.onHitEOF != nil {
+		b.onHitEOF()
+		b.onHitEOF = nil
+	}
+
 	return n, err
 }
 
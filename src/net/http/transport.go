@@ -51,6 +51,11 @@ type Transport struct {
 	wantIdle   bool // user has requested to close all idle conns
 	idleConn   map[connectMethodKey][]*persistConn
 	idleConnCh map[connectMethodKey]chan *persistConn
+	h2Conns    map[connectMethodKey][]*h2ClientConn
+
+	connsMu   sync.Mutex
+	conns     map[connectMethodKey]int             // connections open or being dialed
+	connsWait map[connectMethodKey][]chan struct{} // requests waiting on MaxConnsPerHost
 
 	reqMu       sync.Mutex
 	reqCanceler map[*Request]func()
@@ -82,6 +87,10 @@ type Transport struct {
 
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client. If nil, the default configuration is used.
+	//
+	// Unless DisableKeepAlives is set, HTTP/2 is offered to
+	// servers through ALPN and used when the server selects it. A
+	// TLSClientConfig with a non-empty NextProtos disables this.
 	TLSClientConfig *tls.Config
 
 	// TLSHandshakeTimeout specifies the maximum amount of time waiting to
@@ -102,19 +111,41 @@ type Transport struct {
 	// uncompressed.
 	DisableCompression bool
 
+	// MaxIdleConns controls the maximum number of idle
+	// (keep-alive) connections across all hosts. When the limit
+	// is reached, the connection that has been idle the longest
+	// is closed. Zero means no limit.
+	MaxIdleConns int
+
 	// MaxIdleConnsPerHost, if non-zero, controls the maximum idle
 	// (keep-alive) to keep per-host.  If zero,
 	// DefaultMaxIdleConnsPerHost is used.
 	MaxIdleConnsPerHost int
 
+	// MaxConnsPerHost optionally limits the total number of
+	// connections per host, including connections in the dialing,
+	// active, and idle states. Requests that would exceed the
+	// limit wait for a connection to become idle or to be closed.
+	// Zero means no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is the maximum amount of time an idle
+	// (keep-alive) connection will remain idle before closing
+	// itself. Zero means no limit.
+	IdleConnTimeout time.Duration
+
 	// ResponseHeaderTimeout, if non-zero, specifies the amount of
 	// time to wait for a server's response headers after fully
 	// writing the request (including its body, if any). This
 	// time does not include the time to read the response body.
 	ResponseHeaderTimeout time.Duration
 
-	// TODO: tunable on global max cached connections
-	// TODO: tunable on timeout on cached connections
+	// EnableH2C, if true, makes requests with the "http" scheme
+	// that don't go through a proxy use HTTP/2 directly on the
+	// TCP connection, without negotiation ("prior knowledge").
+	// The server must support it, as Server does when its
+	// EnableH2C field is set.
+	EnableH2C bool
 }
 
 // ProxyFromEnvironment returns the URL of the proxy to use for a
@@ -173,8 +204,10 @@ func ProxyURL(fixedURL *url.URL) func(*Request) (*url.URL, error) {
 // transportRequest is a wrapper around a *Request that adds
 // optional extra headers to write.
 type transportRequest struct {
-	*Request        // original request, not to be mutated
-	extra    Header // extra headers to write, or nil
+	*Request                 // original request, not to be mutated
+	extra    Header          // extra headers to write, or nil
+	cancel   <-chan struct{} // closed when the request is canceled, or nil
+	stop     func()          // releases cancel's resources; safe to call more than once
 }
 
 func (tr *transportRequest) extraHeaders() Header {
@@ -186,6 +219,10 @@ func (tr *transportRequest) extraHeaders() Header {
 
 // RoundTrip implements the RoundTripper interface.
 //
+// RoundTrip honors the request's Cancel and Deadline fields for the
+// lifetime of the request, up to and including reading the response
+// Body.
+//
 // For higher-level HTTP client support (such as handling of cookies
 // and redirects), see Get, Post, and the Client type.
 func (t *Transport) RoundTrip(req *Request) (resp *Response, err error) {
@@ -220,19 +257,95 @@ func (t *Transport) RoundTrip(req *Request) (resp *Response, err error) {
 		req.closeBody()
 		return nil, err
 	}
+	treq.cancel, treq.stop = requestCancelChan(req)
 
-	// Get the cached or newly-created connection to either the
-	// host (for http or https), the http proxy, or the http proxy
-	// pre-CONNECTed to https server.  In any case, we'll be ready
-	// to send it requests.
-	pconn, err := t.getConn(req, cm)
-	if err != nil {
-		t.setReqCanceler(req, nil)
-		req.closeBody()
-		return nil, err
+	for retry := 0; ; retry++ {
+		// Requests to a server already speaking HTTP/2 share its
+		// connection.
+		cc := t.getH2Conn(cm)
+		if cc != nil && req.Trace != nil {
+			if req.Trace.GetConn != nil {
+				req.Trace.GetConn(cm.addr())
+			}
+			if req.Trace.GotConn != nil {
+				req.Trace.GotConn(GotConnInfo{Conn: cc.nc, Reused: true})
+			}
+		}
+		if cc == nil {
+			// Get the cached or newly-created connection to
+			// either the host (for http or https), the http
+			// proxy, or the http proxy pre-CONNECTed to https
+			// server.  In any case, we'll be ready to send it
+			// requests.
+			pconn, err := t.getConn(treq, cm)
+			if err != nil {
+				treq.stop()
+				t.setReqCanceler(req, nil)
+				req.closeBody()
+				return nil, err
+			}
+			if pconn.h2 == nil {
+				return pconn.roundTrip(treq)
+			}
+			cc = pconn.h2
+			t.putH2Conn(pconn)
+		}
+		resp, err = cc.roundTrip(treq)
+		if err != errH2RetryRequest {
+			return resp, err
+		}
+		if retry == h2MaxRetries {
+			t.setReqCanceler(req, nil)
+			treq.stop()
+			req.closeBody()
+			return nil, err
+		}
+	}
+}
+
+var (
+	errRequestCanceled  error = &httpError{err: "net/http: request canceled"}
+	errDeadlineExceeded error = &httpError{err: "net/http: request deadline exceeded", timeout: true}
+)
+
+// requestCancelChan returns a channel that is closed once req is
+// canceled, either by the closing of req.Cancel or by req.Deadline
+// passing, and a func that releases the resources used to watch for
+// the deadline. The channel is nil if req can't be canceled.
+func requestCancelChan(req *Request) (cancel <-chan struct{}, stop func()) {
+	if req.Deadline.IsZero() {
+		return req.Cancel, func() {}
+	}
+	ch := make(chan struct{})
+	done := make(chan struct{})
+	var fireOnce, stopOnce sync.Once
+	fire := func() { fireOnce.Do(func() { close(ch) }) }
+	timer := time.AfterFunc(req.Deadline.Sub(time.Now()), fire)
+	if req.Cancel != nil {
+		go func() {
+			select {
+			case <-req.Cancel:
+				fire()
+			case <-ch:
+			case <-done:
+			}
+		}()
+	}
+	return ch, func() {
+		stopOnce.Do(func() {
+			timer.Stop()
+			close(done)
+		})
 	}
+}
 
-	return pconn.roundTrip(treq)
+// canceledError returns the error to report for req once it has been
+// canceled through its Cancel or Deadline fields.
+func canceledError(req *Request) error {
+	if !req.Deadline.IsZero() && !time.Now().Before(req.Deadline) {
+		return errDeadlineExceeded
+	}
+	return errRequestCanceled
 }
 
 // RegisterProtocol registers a new protocol with scheme.
@@ -265,6 +378,8 @@ func (t *Transport) CloseIdleConnections() {
 	m := t.idleConn
 	t.idleConn = nil
 	t.idleConnCh = nil
+	h2m := t.h2Conns
+	t.h2Conns = nil
 	t.wantIdle = true
 	t.idleMu.Unlock()
 	for _, conns := range m {
@@ -272,6 +387,13 @@ func (t *Transport) CloseIdleConnections() {
 			pconn.close()
 		}
 	}
+	// HTTP/2 connections close once their streams in flight are
+	// done.
+	for _, conns := range h2m {
+		for _, cc := range conns {
+			cc.closeIfIdle()
+		}
+	}
 }
 
 // CancelRequest cancels an in-flight request by closing its
@@ -358,6 +480,9 @@ func (cm *connectMethod) proxyAuth() string {
 // If pconn is no longer needed or not in a good state, putIdleConn
 // returns false.
 func (t *Transport) putIdleConn(pconn *persistConn) bool {
+	if pconn.h2 != nil {
+		return t.putH2Conn(pconn)
+	}
 	if t.DisableKeepAlives || t.MaxIdleConnsPerHost < 0 {
 		pconn.close()
 		return false
@@ -365,6 +490,9 @@ func (t *Transport) putIdleConn(pconn *persistConn) bool {
 	if pconn.isBroken() {
 		return false
 	}
+	pconn.lk.Lock()
+	pconn.reused = true
+	pconn.lk.Unlock()
 	key := pconn.cacheKey
 	max := t.MaxIdleConnsPerHost
 	if max == 0 {
@@ -407,11 +535,71 @@ func (t *Transport) putIdleConn(pconn *persistConn) bool {
 			log.Fatalf("dup idle pconn %p in freelist", pconn)
 		}
 	}
+	var evict *persistConn
+	if t.MaxIdleConns > 0 && t.idleCountLocked() >= t.MaxIdleConns {
+		evict = t.oldestIdleConnLocked()
+		t.removeIdleConnLocked(evict)
+	}
+	pconn.idleAt = time.Now()
+	if d := t.IdleConnTimeout; d > 0 {
+		if pconn.idleTimer == nil {
+			pconn.idleTimer = time.AfterFunc(d, pconn.closeIfStillIdle)
+		} else {
+			pconn.idleTimer.Reset(d)
+		}
+	}
 	t.idleConn[key] = append(t.idleConn[key], pconn)
 	t.idleMu.Unlock()
+	if evict != nil {
+		evict.close()
+	}
 	return true
 }
 
+// idleCountLocked returns the number of idle HTTP/1 connections.
+// t.idleMu must be held.
+func (t *Transport) idleCountLocked() int {
+	n := 0
+	for _, conns := range t.idleConn {
+		n += len(conns)
+	}
+	return n
+}
+
+// oldestIdleConnLocked returns the connection that has been idle the
+// longest. t.idleMu must be held and there must be one.
+func (t *Transport) oldestIdleConnLocked() *persistConn {
+	var oldest *persistConn
+	for _, conns := range t.idleConn {
+		// Each list is ordered by the time its conns became idle.
+		if len(conns) > 0 && (oldest == nil || conns[0].idleAt.Before(oldest.idleAt)) {
+			oldest = conns[0]
+		}
+	}
+	return oldest
+}
+
+// removeIdleConnLocked removes pconn from the idle pool and reports
+// whether it was there. t.idleMu must be held.
+func (t *Transport) removeIdleConnLocked(pconn *persistConn) bool {
+	key := pconn.cacheKey
+	conns := t.idleConn[key]
+	for i, pc := range conns {
+		if pc != pconn {
+			continue
+		}
+		copy(conns[i:], conns[i+1:])
+		conns[len(conns)-1] = nil
+		if len(conns) == 1 {
+			delete(t.idleConn, key)
+		} else {
+			t.idleConn[key] = conns[:len(conns)-1]
+		}
+		return true
+	}
+	return false
+}
+
 // getIdleConnCh returns a channel to receive and return idle
 // persistent connection for the given connectMethod.
 // It may return nil, if persistent connections are not being used.
@@ -434,17 +622,19 @@ func (t *Transport) getIdleConnCh(cm connectMethod) chan *persistConn {
 	return ch
 }
 
-func (t *Transport) getIdleConn(cm connectMethod) (pconn *persistConn) {
+// getIdleConn returns an idle connection for cm and how long it was
+// idle, or nil.
+func (t *Transport) getIdleConn(cm connectMethod) (pconn *persistConn, idleTime time.Duration) {
 	key := cm.key()
 	t.idleMu.Lock()
 	defer t.idleMu.Unlock()
 	if t.idleConn == nil {
-		return nil
+		return nil, 0
 	}
 	for {
 		pconns, ok := t.idleConn[key]
 		if !ok {
-			return nil
+			return nil, 0
 		}
 		if len(pconns) == 1 {
 			pconn = pconns[0]
@@ -455,10 +645,182 @@ func (t *Transport) getIdleConn(cm connectMethod) (pconn *persistConn) {
 			pconn = pconns[len(pconns)-1]
 			t.idleConn[key] = pconns[:len(pconns)-1]
 		}
+		if pconn.idleTimer != nil {
+			pconn.idleTimer.Stop()
+		}
 		if !pconn.isBroken() {
+			return pconn, time.Since(pconn.idleAt)
+		}
+	}
+}
+
+// acquireConnSlot reserves one of the MaxConnsPerHost connections to
+// key. If none is available, it returns false and a channel that
+// receives a value once a slot is handed over to the caller. Callers
+// that stop waiting must call cancelConnWait.
+func (t *Transport) acquireConnSlot(key connectMethodKey) (ok bool, wait chan struct{}) {
+	t.connsMu.Lock()
+	defer t.connsMu.Unlock()
+	if t.conns == nil {
+		t.conns = make(map[connectMethodKey]int)
+	}
+	if t.MaxConnsPerHost <= 0 || t.conns[key] < t.MaxConnsPerHost {
+		t.conns[key]++
+		return true, nil
+	}
+	if t.connsWait == nil {
+		t.connsWait = make(map[connectMethodKey][]chan struct{})
+	}
+	wait = make(chan struct{}, 1)
+	t.connsWait[key] = append(t.connsWait[key], wait)
+	return false, wait
+}
+
+// releaseConnSlot releases a slot reserved by acquireConnSlot once
+// its connection is closed or fails to dial. The slot goes to the
+// longest waiting request, if any.
+func (t *Transport) releaseConnSlot(key connectMethodKey) {
+	t.connsMu.Lock()
+	defer t.connsMu.Unlock()
+	if waiters := t.connsWait[key]; len(waiters) > 0 {
+		waiters[0] <- struct{}{}
+		copy(waiters, waiters[1:])
+		waiters[len(waiters)-1] = nil
+		if len(waiters) == 1 {
+			delete(t.connsWait, key)
+		} else {
+			t.connsWait[key] = waiters[:len(waiters)-1]
+		}
+		return
+	}
+	if n := t.conns[key]; n > 1 {
+		t.conns[key] = n - 1
+	} else {
+		delete(t.conns, key)
+	}
+}
+
+// cancelConnWait withdraws a request that stopped waiting for a slot,
+// passing on the slot if it was already handed over.
+func (t *Transport) cancelConnWait(key connectMethodKey, wait chan struct{}) {
+	t.connsMu.Lock()
+	waiters := t.connsWait[key]
+	for i, w := range waiters {
+		if w == wait {
+			t.connsWait[key] = append(waiters[:i], waiters[i+1:]...)
+			if len(waiters) == 1 {
+				delete(t.connsWait, key)
+			}
+			t.connsMu.Unlock()
 			return
 		}
 	}
+	t.connsMu.Unlock()
+	<-wait
+	t.releaseConnSlot(key)
+}
+
+// ConnPoolStats describes the connections of a Transport to one
+// destination.
+type ConnPoolStats struct {
+	Conns   int // connections open or being dialed, including idle ones
+	Idle    int // idle HTTP/1 connections
+	Waiting int // requests waiting for a connection because of MaxConnsPerHost
+}
+
+// PoolStats returns the current occupancy of the Transport's
+// connection pool. The map is keyed by destination, in the form
+// "proxy|scheme|host:port", where proxy is empty for direct
+// connections and host:port is empty for HTTP requests through a
+// proxy.
+func (t *Transport) PoolStats() map[string]ConnPoolStats {
+	m := make(map[string]ConnPoolStats)
+	t.connsMu.Lock()
+	for key, n := range t.conns {
+		st := m[key.String()]
+		st.Conns = n
+		m[key.String()] = st
+	}
+	for key, waiters := range t.connsWait {
+		st := m[key.String()]
+		st.Waiting = len(waiters)
+		m[key.String()] = st
+	}
+	t.connsMu.Unlock()
+	t.idleMu.Lock()
+	for key, conns := range t.idleConn {
+		st := m[key.String()]
+		st.Idle = len(conns)
+		m[key.String()] = st
+	}
+	t.idleMu.Unlock()
+	return m
+}
+
+// putH2Conn makes the HTTP/2 connection of pconn available to
+// requests for its key. Unlike HTTP/1 connections, it's shared by all
+// of them until it goes away, including any requests currently
+// waiting for a connection.
+func (t *Transport) putH2Conn(pconn *persistConn) bool {
+	cc := pconn.h2
+	if t.DisableKeepAlives {
+		cc.closeIfIdle()
+		return false
+	}
+	key := pconn.cacheKey
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	for {
+		select {
+		case t.idleConnCh[key] <- pconn:
+			continue
+		default:
+		}
+		break
+	}
+	for _, exist := range t.h2Conns[key] {
+		if exist == cc {
+			return true
+		}
+	}
+	if t.h2Conns == nil {
+		t.h2Conns = make(map[connectMethodKey][]*h2ClientConn)
+	}
+	t.h2Conns[key] = append(t.h2Conns[key], cc)
+	return true
+}
+
+// getH2Conn returns an HTTP/2 connection for cm that can take
+// another request, or nil. Connections that can't ever take one
+// again are dropped.
+func (t *Transport) getH2Conn(cm connectMethod) *h2ClientConn {
+	key := cm.key()
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	conns := t.h2Conns[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	live := conns[:0]
+	for _, cc := range conns {
+		if !cc.isDead() {
+			live = append(live, cc)
+		}
+	}
+	for i := len(live); i < len(conns); i++ {
+		conns[i] = nil
+	}
+	if len(live) == 0 {
+		delete(t.h2Conns, key)
+		return nil
+	}
+	t.h2Conns[key] = live
+	for _, cc := range live {
+		if cc.canTakeNewRequest() {
+			return cc
+		}
+	}
+	return nil
 }
 
 func (t *Transport) setReqCanceler(r *Request, fn func()) {
@@ -474,11 +836,25 @@ func (t *Transport) setReqCanceler(r *Request, fn func()) {
 	}
 }
 
-func (t *Transport) dial(network, addr string) (c net.Conn, err error) {
+// dial dials addr using the Transport's Dial hook, if any. Otherwise
+// the dial is aborted when cancel is closed, and reported to trace
+// if it's non-nil.
+func (t *Transport) dial(network, addr string, trace *ClientTrace, cancel <-chan struct{}) (c net.Conn, err error) {
 	if t.Dial != nil {
-		return t.Dial(network, addr)
+		if trace != nil && trace.ConnectStart != nil {
+			trace.ConnectStart(network, addr)
+		}
+		c, err = t.Dial(network, addr)
+		if trace != nil && trace.ConnectDone != nil {
+			trace.ConnectDone(network, addr, err)
+		}
+		return c, err
 	}
-	return net.Dial(network, addr)
+	if trace != nil {
+		return traceDial(trace, network, addr, cancel)
+	}
+	d := net.Dialer{Cancel: cancel}
+	return d.Dial(network, addr)
 }
 
 // Testing hooks:
@@ -488,8 +864,16 @@ var prePendingDial, postPendingDial func()
 // specified in the connectMethod.  This includes doing a proxy CONNECT
 // and/or setting up TLS.  If this doesn't return an error, the persistConn
 // is ready to write requests to.
-func (t *Transport) getConn(req *Request, cm connectMethod) (*persistConn, error) {
-	if pc := t.getIdleConn(cm); pc != nil {
+func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (*persistConn, error) {
+	req := treq.Request
+	trace := req.Trace
+	if trace != nil && trace.GetConn != nil {
+		trace.GetConn(cm.addr())
+	}
+	if pc, idleTime := t.getIdleConn(cm); pc != nil {
+		if trace != nil && trace.GotConn != nil {
+			trace.GotConn(GotConnInfo{Conn: pc.conn, Reused: true, WasIdle: true, IdleTime: idleTime})
+		}
 		return pc, nil
 	}
 
@@ -516,15 +900,42 @@ func (t *Transport) getConn(req *Request, cm connectMethod) (*persistConn, error
 	cancelc := make(chan struct{})
 	t.setReqCanceler(req, func() { close(cancelc) })
 
+	idleConnCh := t.getIdleConnCh(cm)
+	key := cm.key()
+	if ok, wait := t.acquireConnSlot(key); !ok {
+		// Wait for a connection to go idle, or to close so
+		// that we may dial another.
+		select {
+		case <-wait:
+		case pc := <-idleConnCh:
+			t.cancelConnWait(key, wait)
+			if trace != nil && trace.GotConn != nil {
+				trace.GotConn(GotConnInfo{Conn: pc.conn, Reused: pc.isReused()})
+			}
+			return pc, nil
+		case <-cancelc:
+			t.cancelConnWait(key, wait)
+			return nil, errors.New("net/http: request canceled while waiting for connection")
+		case <-treq.cancel:
+			t.cancelConnWait(key, wait)
+			return nil, canceledError(req)
+		}
+	}
+
 	go func() {
-		pc, err := t.dialConn(cm)
+		pc, err := t.dialConn(cm, trace, treq.cancel)
+		if err != nil {
+			t.releaseConnSlot(key)
+		}
 		dialc <- dialRes{pc, err}
 	}()
 
-	idleConnCh := t.getIdleConnCh(cm)
 	select {
 	case v := <-dialc:
 		// Our dial finished.
+		if v.err == nil && trace != nil && trace.GotConn != nil {
+			trace.GotConn(GotConnInfo{Conn: v.pc.conn})
+		}
 		return v.pc, v.err
 	case pc := <-idleConnCh:
 		// Another request finished first and its net.Conn
@@ -533,14 +944,23 @@ func (t *Transport) getConn(req *Request, cm connectMethod) (*persistConn, error
 		// But our dial is still going, so give it away
 		// when it finishes:
 		handlePendingDial()
+		if trace != nil && trace.GotConn != nil {
+			trace.GotConn(GotConnInfo{Conn: pc.conn, Reused: pc.isReused()})
+		}
 		return pc, nil
 	case <-cancelc:
 		handlePendingDial()
 		return nil, errors.New("net/http: request canceled while waiting for connection")
+	case <-treq.cancel:
+		handlePendingDial()
+		return nil, canceledError(req)
 	}
 }
 
-func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
+// dialConn dials a new persistConn for cm. Closing cancel aborts the
+// dial and TLS handshake. The dial and handshake are reported to
+// trace, if it's non-nil.
+func (t *Transport) dialConn(cm connectMethod, trace *ClientTrace, cancel <-chan struct{}) (*persistConn, error) {
 	pconn := &persistConn{
 		t:          t,
 		cacheKey:   cm.key(),
@@ -559,9 +979,12 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 		if tc, ok := pconn.conn.(*tls.Conn); ok {
 			cs := tc.ConnectionState()
 			pconn.tlsState = &cs
+			if cs.NegotiatedProtocol == "h2" {
+				return t.dialH2Conn(pconn)
+			}
 		}
 	} else {
-		conn, err := t.dial("tcp", cm.addr())
+		conn, err := t.dial("tcp", cm.addr(), trace, cancel)
 		if err != nil {
 			if cm.proxyURL != nil {
 				err = fmt.Errorf("http: error connecting to proxy %s: %v", cm.proxyURL, err)
@@ -624,6 +1047,11 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 				cfg = &clone
 			}
 		}
+		if len(cfg.NextProtos) == 0 && !t.DisableKeepAlives {
+			clone := *cfg
+			clone.NextProtos = []string{"h2", "http/1.1"}
+			cfg = &clone
+		}
 		plainConn := pconn.conn
 		tlsConn := tls.Client(plainConn, cfg)
 		errc := make(chan error, 2)
@@ -633,6 +1061,9 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 				errc <- tlsHandshakeTimeoutError{}
 			})
 		}
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
 		go func() {
 			err := tlsConn.Handshake()
 			if timer != nil {
@@ -640,10 +1071,22 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 			}
 			errc <- err
 		}()
-		if err := <-errc; err != nil {
+		var err error
+		select {
+		case err = <-errc:
+		case <-cancel:
+			err = errRequestCanceled
+		}
+		if err != nil {
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				trace.TLSHandshakeDone(tls.ConnectionState{}, err)
+			}
 			plainConn.Close()
 			return nil, err
 		}
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tlsConn.ConnectionState(), nil)
+		}
 		if !cfg.InsecureSkipVerify {
 			if err := tlsConn.VerifyHostname(cfg.ServerName); err != nil {
 				plainConn.Close()
@@ -653,6 +1096,11 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 		cs := tlsConn.ConnectionState()
 		pconn.tlsState = &cs
 		pconn.conn = tlsConn
+		if cs.NegotiatedProtocol == "h2" {
+			return t.dialH2Conn(pconn)
+		}
+	} else if t.EnableH2C && cm.targetScheme == "http" && cm.proxyURL == nil {
+		return t.dialH2Conn(pconn)
 	}
 
 	pconn.br = bufio.NewReader(noteEOFReader{pconn.conn, &pconn.sawEOF})
@@ -662,6 +1110,17 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 	return pconn, nil
 }
 
+// dialH2Conn starts HTTP/2 on the connection of pconn, which was
+// just dialed, and returns pconn for use with HTTP/2.
+func (t *Transport) dialH2Conn(pconn *persistConn) (*persistConn, error) {
+	cc, err := t.newH2ClientConn(pconn.conn, pconn.tlsState, pconn.cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	pconn.h2 = cc
+	return pconn, nil
+}
+
 // useProxy returns true if requests to addr should use a proxy,
 // according to the NO_PROXY or no_proxy environment variable.
 // addr is always a canonicalAddr with a host and port.
@@ -777,24 +1236,26 @@ type connectMethodKey struct {
 }
 
 func (k connectMethodKey) String() string {
-	// Only used by tests.
 	return fmt.Sprintf("%s|%s|%s", k.proxy, k.scheme, k.addr)
 }
 
 // persistConn wraps a connection, usually a persistent one
 // (but may be used for non-keep-alive requests as well)
 type persistConn struct {
-	t        *Transport
-	cacheKey connectMethodKey
-	conn     net.Conn
-	tlsState *tls.ConnectionState
-	br       *bufio.Reader       // from conn
-	sawEOF   bool                // whether we've seen EOF from conn; owned by readLoop
-	bw       *bufio.Writer       // to conn
-	reqch    chan requestAndChan // written by roundTrip; read by readLoop
-	writech  chan writeRequest   // written by roundTrip; read by writeLoop
-	closech  chan struct{}       // closed when conn closed
-	isProxy  bool
+	t         *Transport
+	cacheKey  connectMethodKey
+	conn      net.Conn
+	tlsState  *tls.ConnectionState
+	br        *bufio.Reader       // from conn
+	sawEOF    bool                // whether we've seen EOF from conn; owned by readLoop
+	bw        *bufio.Writer       // to conn
+	reqch     chan requestAndChan // written by roundTrip; read by readLoop
+	writech   chan writeRequest   // written by roundTrip; read by writeLoop
+	closech   chan struct{}       // closed when conn closed
+	isProxy   bool
+	idleAt    time.Time     // when conn last became idle; guarded by Transport.idleMu
+	idleTimer *time.Timer   // closes conn after Transport.IdleConnTimeout; guarded by Transport.idleMu
+	h2        *h2ClientConn // non-nil if conn speaks HTTP/2; nothing else is used then
 	// writeErrCh passes the request write error (usually nil)
 	// from the writeLoop goroutine to the readLoop which passes
 	// it off to the res.Body reader, which then uses it to decide
@@ -805,6 +1266,7 @@ type persistConn struct {
 	numExpectedResponses int
 	closed               bool // whether conn has been closed
 	broken               bool // an error has happened on this connection; marked broken so it's not reused.
+	reused               bool // whether conn has had a successful request/response and is being reused.
 	// mutateHeaderFunc is an optional func to modify extra
 	// headers on each outbound request before it's written. (the
 	// original Request given to RoundTrip is not modified)
@@ -819,6 +1281,15 @@ func (pc *persistConn) isBroken() bool {
 	return b
 }
 
+// isReused reports whether this connection has been used for a
+// request before.
+func (pc *persistConn) isReused() bool {
+	pc.lk.Lock()
+	r := pc.reused
+	pc.lk.Unlock()
+	return r
+}
+
 func (pc *persistConn) cancelRequest() {
 	pc.conn.Close()
 }
@@ -858,6 +1329,9 @@ func (pc *persistConn) readLoop() {
 		rc := <-pc.reqch
 
 		var resp *Response
+		if err == nil && rc.req.Trace != nil && rc.req.Trace.GotFirstResponseByte != nil {
+			rc.req.Trace.GotFirstResponseByte()
+		}
 		if err == nil {
 			resp, err = ReadResponse(pc.br, rc.req)
 			if err == nil && resp.StatusCode == 100 {
@@ -874,6 +1348,11 @@ func (pc *persistConn) readLoop() {
 			resp.TLS = pc.tlsState
 		}
 
+		if err == nil && resp.StatusCode == StatusSwitchingProtocols {
+			pc.switchProtocols(rc, resp)
+			return
+		}
+
 		hasBody := resp != nil && rc.req.Method != "HEAD" && resp.ContentLength != 0
 
 		if err != nil {
@@ -929,9 +1408,13 @@ func (pc *persistConn) readLoop() {
 			case alive = <-waitForBodyRead:
 			case <-pc.closech:
 				alive = false
+			case <-rc.cancel:
+				alive = false
+				pc.cancelRequest()
 			}
 		}
 
+		rc.stop()
 		pc.t.setReqCanceler(rc.req, nil)
 
 		if !alive {
@@ -956,6 +1439,9 @@ func (pc *persistConn) writeLoop() {
 				pc.markBroken()
 				wr.req.Request.closeBody()
 			}
+			if trace := wr.req.Trace; trace != nil && trace.WroteRequest != nil {
+				trace.WroteRequest(WroteRequestInfo{Err: err})
+			}
 			pc.writeErrCh <- err // to the body reader, which might recycle us
 			wr.ch <- err         // to the roundTrip function
 		case <-pc.closech:
@@ -998,8 +1484,10 @@ type responseAndError struct {
 }
 
 type requestAndChan struct {
-	req *Request
-	ch  chan responseAndError
+	req    *Request
+	ch     chan responseAndError
+	cancel <-chan struct{} // closed when req is canceled, or nil
+	stop   func()          // releases cancel's resources
 
 	// did the Transport (as opposed to the client code) add an
 	// Accept-Encoding gzip header? only if it we set it do
@@ -1071,7 +1559,13 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *Response, err err
 	pc.writech <- writeRequest{req, writeErrCh}
 
 	resc := make(chan responseAndError, 1)
-	pc.reqch <- requestAndChan{req.Request, resc, requestedGzip}
+	pc.reqch <- requestAndChan{
+		req:       req.Request,
+		ch:        resc,
+		cancel:    req.cancel,
+		stop:      req.stop,
+		addedGzip: requestedGzip,
+	}
 
 	var re responseAndError
 	var pconnDeadCh = pc.closech
@@ -1113,6 +1607,10 @@ WaitResponse:
 			break WaitResponse
 		case re = <-resc:
 			break WaitResponse
+		case <-req.cancel:
+			pc.cancelRequest()
+			re = responseAndError{err: canceledError(req.Request)}
+			break WaitResponse
 		}
 	}
 
@@ -1121,6 +1619,7 @@ WaitResponse:
 	pc.lk.Unlock()
 
 	if re.err != nil {
+		req.stop()
 		pc.t.setReqCanceler(req.Request, nil)
 	}
 	return re.res, re.err
@@ -1142,15 +1641,71 @@ func (pc *persistConn) close() {
 }
 
 func (pc *persistConn) closeLocked() {
-	pc.broken = true
 	if !pc.closed {
 		pc.conn.Close()
+	}
+	pc.detachLocked()
+}
+
+// detachLocked retires pc like closeLocked, but leaves its net.Conn
+// open for a caller that has taken it over.
+func (pc *persistConn) detachLocked() {
+	pc.broken = true
+	if !pc.closed {
 		pc.closed = true
 		close(pc.closech)
+		pc.t.releaseConnSlot(pc.cacheKey)
 	}
 	pc.mutateHeaderFunc = nil
 }
 
+// switchProtocols hands pc's connection to the caller as the
+// writable Body of resp, a 101 Switching Protocols response, and
+// retires pc. The readLoop must exit afterwards.
+func (pc *persistConn) switchProtocols(rc requestAndChan, resp *Response) {
+	resp.Body = &readWriteCloserBody{br: pc.br, ReadWriteCloser: pc.conn}
+	rc.ch <- responseAndError{resp, nil}
+	rc.stop()
+	pc.t.setReqCanceler(rc.req, nil)
+	pc.lk.Lock()
+	pc.detachLocked()
+	pc.lk.Unlock()
+}
+
+// readWriteCloserBody is the Body of a 101 Switching Protocols
+// response. Reads drain any bytes the Transport had already buffered
+// before going to the connection.
+type readWriteCloserBody struct {
+	br *bufio.Reader // used until empty
+	io.ReadWriteCloser
+}
+
+func (b *readWriteCloserBody) Read(p []byte) (n int, err error) {
+	if b.br != nil {
+		if n := b.br.Buffered(); len(p) > n {
+			p = p[:n]
+		}
+		n, err = b.br.Read(p)
+		if b.br.Buffered() == 0 {
+			b.br = nil
+		}
+		return n, err
+	}
+	return b.ReadWriteCloser.Read(p)
+}
+
+// closeIfStillIdle closes pc when its IdleConnTimeout elapses, unless
+// it was taken out of the idle pool in the meantime.
+func (pc *persistConn) closeIfStillIdle() {
+	t := pc.t
+	t.idleMu.Lock()
+	idle := t.removeIdleConnLocked(pc)
+	t.idleMu.Unlock()
+	if idle {
+		pc.close()
+	}
+}
+
 var portMap = map[string]string{
 	"http":  "80",
 	"https": "443",
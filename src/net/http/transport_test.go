@@ -404,6 +404,168 @@ func TestTransportMaxPerHostIdleConns(t *testing.T) {
 	}
 }
 
+// waitPoolStats waits for the pool stats of tr for key to match want.
+func waitPoolStats(t *testing.T, tr *Transport, key string, want ConnPoolStats) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := tr.PoolStats()[key]
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool stats for %q = %+v; want %+v", key, got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTransportMaxConnsPerHost(t *testing.T) {
+	defer afterTest(t)
+	var mu sync.Mutex
+	dialed := 0
+	release := make(chan bool)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-release
+	}))
+	ts.Config.ConnState = func(c net.Conn, state ConnState) {
+		if state == StateNew {
+			mu.Lock()
+			dialed++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+	tr := &Transport{MaxConnsPerHost: 2}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	const n = 5
+	errc := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			res, err := c.Get(ts.URL)
+			if err == nil {
+				_, err = ioutil.ReadAll(res.Body)
+				res.Body.Close()
+			}
+			errc <- err
+		}()
+	}
+	key := "|http|" + ts.Listener.Addr().String()
+	waitPoolStats(t, tr, key, ConnPoolStats{Conns: 2, Waiting: n - 2})
+	close(release)
+	for i := 0; i < n; i++ {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+	waitPoolStats(t, tr, key, ConnPoolStats{Conns: 2, Idle: 2})
+	mu.Lock()
+	defer mu.Unlock()
+	if dialed != 2 {
+		t.Errorf("server saw %d connections; want 2", dialed)
+	}
+}
+
+// A request waiting for a connection can be canceled, and gives up
+// its place.
+func TestTransportMaxConnsPerHostCancelWait(t *testing.T) {
+	defer afterTest(t)
+	release := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-release
+	}))
+	defer ts.Close()
+	tr := &Transport{MaxConnsPerHost: 1}
+	defer tr.CloseIdleConnections()
+
+	first := make(chan error, 1)
+	go func() {
+		res, err := tr.RoundTrip(mustNewRequest(t, ts.URL))
+		if err == nil {
+			res.Body.Close()
+		}
+		first <- err
+	}()
+	key := "|http|" + ts.Listener.Addr().String()
+	waitPoolStats(t, tr, key, ConnPoolStats{Conns: 1})
+
+	cancel := make(chan struct{})
+	req := mustNewRequest(t, ts.URL)
+	req.Cancel = cancel
+	second := make(chan error, 1)
+	go func() {
+		_, err := tr.RoundTrip(req)
+		second <- err
+	}()
+	waitPoolStats(t, tr, key, ConnPoolStats{Conns: 1, Waiting: 1})
+	close(cancel)
+	if err := <-second; err == nil {
+		t.Error("canceled request succeeded")
+	}
+	waitPoolStats(t, tr, key, ConnPoolStats{Conns: 1})
+	close(release)
+	if err := <-first; err != nil {
+		t.Error(err)
+	}
+}
+
+func mustNewRequest(t *testing.T, url string) *Request {
+	req, err := NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestTransportIdleConnTimeout(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	tr := &Transport{IdleConnTimeout: 50 * time.Millisecond}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	key := "|http|" + ts.Listener.Addr().String()
+	for i := 0; i < 2; i++ {
+		res, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if i == 0 {
+			waitPoolStats(t, tr, key, ConnPoolStats{Conns: 1, Idle: 1})
+		}
+	}
+	waitPoolStats(t, tr, key, ConnPoolStats{})
+}
+
+func TestTransportMaxIdleConns(t *testing.T) {
+	defer afterTest(t)
+	tr := &Transport{MaxIdleConns: 2}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+	var keys []string
+	for i := 0; i < 3; i++ {
+		ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+		defer ts.Close()
+		res, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		key := "|http|" + ts.Listener.Addr().String()
+		keys = append(keys, key)
+		waitPoolStats(t, tr, key, ConnPoolStats{Conns: 1, Idle: 1})
+	}
+	// The oldest idle connection was closed for the newest.
+	waitPoolStats(t, tr, keys[0], ConnPoolStats{})
+	if got := len(tr.IdleConnKeysForTesting()); got != 2 {
+		t.Errorf("%d hosts with idle conns; want 2", got)
+	}
+}
+
 func TestTransportServerClosingUnexpectedly(t *testing.T) {
 	defer afterTest(t)
 	ts := httptest.NewServer(hostPortHandler)
@@ -1422,6 +1584,307 @@ Get = Get http://something.no-network.tld/: net/http: request canceled while wai
 	}
 }
 
+func TestTransportRequestCancelChan(t *testing.T) {
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-unblockc
+	}))
+	defer ts.Close()
+	defer close(unblockc)
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	cancel := make(chan struct{})
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Cancel = cancel
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(cancel)
+	}()
+	_, err := c.Do(req)
+	if err == nil {
+		t.Fatal("Do succeeded; want cancellation error")
+	}
+	if !strings.Contains(err.Error(), "request canceled") {
+		t.Errorf("Do error = %v; want request canceled", err)
+	}
+	if n := tr.NumPendingRequestsForTesting(); n != 0 {
+		t.Errorf("pending requests = %d; want 0", n)
+	}
+}
+
+func TestTransportRequestCancelChanBody(t *testing.T) {
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "Hello")
+		w.(Flusher).Flush() // send headers and some body
+		<-unblockc
+	}))
+	defer ts.Close()
+	defer close(unblockc)
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	cancel := make(chan struct{})
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Cancel = cancel
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(cancel)
+	}()
+	body, err := ioutil.ReadAll(res.Body)
+	if err == nil {
+		t.Error("expected an error reading the body")
+	}
+	if string(body) != "Hello" {
+		t.Errorf("Body = %q; want Hello", body)
+	}
+}
+
+func TestTransportRequestDeadline(t *testing.T) {
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-unblockc
+	}))
+	defer ts.Close()
+	defer close(unblockc)
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Deadline = time.Now().Add(100 * time.Millisecond)
+	_, err := tr.RoundTrip(req)
+	if err == nil {
+		t.Fatal("RoundTrip succeeded; want deadline error")
+	}
+	ne, ok := err.(net.Error)
+	if !ok || !ne.Timeout() {
+		t.Errorf("RoundTrip error = %v; want a timeout net.Error", err)
+	}
+}
+
+// A canceled incoming request cancels the outgoing requests made on
+// its behalf.
+func TestTransportRequestCancelPropagates(t *testing.T) {
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	backend := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-unblockc
+	}))
+	defer backend.Close()
+	defer close(unblockc)
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	errc := make(chan error, 1)
+	frontend := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		req, _ := NewRequest("GET", backend.URL, nil)
+		req.Cancel = r.Cancel
+		res, err := tr.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		errc <- err
+	}))
+	defer frontend.Close()
+
+	conn, err := net.Dial("tcp", frontend.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: foo\r\n\r\n")
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("backend request succeeded; want cancellation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend request not canceled after client hung up")
+	}
+}
+
+// traceLog records the hooks of a ClientTrace as they're called.
+type traceLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *traceLog) add(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, fmt.Sprintf(format, args...))
+}
+
+func (l *traceLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.events, "\n")
+}
+
+func (l *traceLog) trace() *ClientTrace {
+	return &ClientTrace{
+		GetConn: func(hostPort string) { l.add("GetConn") },
+		GotConn: func(ci GotConnInfo) {
+			l.add("GotConn Reused=%v WasIdle=%v", ci.Reused, ci.WasIdle)
+		},
+		GotFirstResponseByte: func() { l.add("GotFirstResponseByte") },
+		DNSStart:             func(di DNSStartInfo) { l.add("DNSStart %s", di.Host) },
+		DNSDone: func(di DNSDoneInfo) {
+			l.add("DNSDone err=%v", di.Err)
+		},
+		ConnectStart: func(network, addr string) { l.add("ConnectStart %s", network) },
+		ConnectDone: func(network, addr string, err error) {
+			l.add("ConnectDone %s err=%v", network, err)
+		},
+		TLSHandshakeStart: func() { l.add("TLSHandshakeStart") },
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			l.add("TLSHandshakeDone complete=%v err=%v", cs.HandshakeComplete, err)
+		},
+		WroteHeaders: func() { l.add("WroteHeaders") },
+		WroteRequest: func(wi WroteRequestInfo) {
+			l.add("WroteRequest err=%v", wi.Err)
+		},
+	}
+}
+
+func TestTransportTrace(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+
+	get := func() string {
+		var tl traceLog
+		req, _ := NewRequest("GET", "http://localhost:"+port+"/", nil)
+		req.Trace = tl.trace()
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return tl.String()
+	}
+
+	got := get()
+	want := `GetConn
+DNSStart localhost
+DNSDone err=<nil>
+ConnectStart tcp
+ConnectDone tcp err=<nil>
+GotConn Reused=false WasIdle=false
+WroteHeaders
+WroteRequest err=<nil>
+GotFirstResponseByte`
+	if got != want {
+		t.Errorf("first request trace:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = get()
+	want = `GetConn
+GotConn Reused=true WasIdle=true
+WroteHeaders
+WroteRequest err=<nil>
+GotFirstResponseByte`
+	if got != want {
+		t.Errorf("second request trace:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// Tracing must not change which address is dialed.
+func TestTransportTraceDialAddr(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	want, err := net.ResolveTCPAddr("tcp", "localhost:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+
+	var (
+		mu       sync.Mutex
+		dnsAddrs []net.IP
+		dialed   []string
+	)
+	req, _ := NewRequest("GET", "http://localhost:"+port+"/", nil)
+	req.Trace = &ClientTrace{
+		DNSDone: func(di DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			dnsAddrs = di.Addrs
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			dialed = append(dialed, addr)
+		},
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dnsAddrs) != 1 || !dnsAddrs[0].Equal(want.IP) {
+		t.Errorf("DNSDone addrs = %v; want [%v]", dnsAddrs, want.IP)
+	}
+	if len(dialed) != 1 || dialed[0] != want.String() {
+		t.Errorf("dialed %q; want [%q]", dialed, want.String())
+	}
+}
+
+func TestTransportTraceTLS(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	tr := &Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer tr.CloseIdleConnections()
+
+	var tl traceLog
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Trace = tl.trace()
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	got := tl.String()
+	want := `GetConn
+ConnectStart tcp
+ConnectDone tcp err=<nil>
+TLSHandshakeStart
+TLSHandshakeDone complete=true err=<nil>
+GotConn Reused=false WasIdle=false
+WroteHeaders
+WroteRequest err=<nil>
+GotFirstResponseByte`
+	if got != want {
+		t.Errorf("trace:\n%s\nwant:\n%s", got, want)
+	}
+}
+
 // golang.org/issue/3672 -- Client can't close HTTP stream
 // Calling Close on a Response.Body used to just read until EOF.
 // Now it actually closes the TCP connection.
@@ -1593,6 +2056,49 @@ func TestTransportSocketLateBinding(t *testing.T) {
 }
 
 // Issue 2184
+// A 101 Switching Protocols response gives the caller the
+// connection as a writable Body.
+func TestTransportSwitchingProtocols(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		conn, brw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello ")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	defer ts.Close()
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != StatusSwitchingProtocols {
+		t.Fatalf("status = %d; want 101", res.StatusCode)
+	}
+	rwc, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatalf("Body is a %T; want an io.ReadWriteCloser", res.Body)
+	}
+	io.WriteString(rwc, "world")
+	buf := make([]byte, len("hello world"))
+	if _, err := io.ReadFull(rwc, buf); err != nil || string(buf) != "hello world" {
+		t.Errorf("read %q, %v; want %q", buf, err, "hello world")
+	}
+	// The Transport no longer counts the connection as its own.
+	waitPoolStats(t, tr, "|http|"+ts.Listener.Addr().String(), ConnPoolStats{})
+}
+
 func TestTransportReading100Continue(t *testing.T) {
 	defer afterTest(t)
 